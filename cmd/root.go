@@ -13,6 +13,7 @@ import (
 	"github.com/everactive/dmscore/iot-management/identityapi"
 	"github.com/everactive/dmscore/iot-management/service/manage"
 	"github.com/everactive/dmscore/iot-management/twinapi"
+	"github.com/everactive/dmscore/pkg/consistency"
 	datastores2 "github.com/everactive/dmscore/pkg/datastores"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -38,6 +39,11 @@ func init() {
 	Root.AddCommand(&runCommand)
 	Root.AddCommand(&version)
 
+	Root.AddCommand(&rotateKEK)
+
+	Root.AddCommand(&check)
+	check.Flags().Bool("fix", false, "Repair the inconsistencies that can be repaired")
+
 	Root.AddCommand(&createSuperuser)
 	createSuperuser.Flags().String("username", "", "The username of the user to create (must match Ubuntu SSO)")
 	createSuperuser.Flags().String("name", "", "The name of the user to create (must match Ubuntu SSO)")
@@ -130,6 +136,9 @@ var runCommand = cobra.Command{
 		sup.Add(ids)
 		sup.Add(dts)
 		sup.Add(web2.New(srv, dataStores.GetDatabase()))
+		sup.Add(manage.NewJobRunner(srv))
+		sup.Add(manage.NewRetentionRunner(srv))
+		sup.Add(consistency.NewService(consistency.NewChecker(dataStores)))
 
 		ctx := context.Background()
 		ctx, cancelCtx := context.WithCancel(ctx)
@@ -1,16 +1,21 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/everactive/dmscore/config"
 	"github.com/everactive/dmscore/config/keys"
+	identityfactory "github.com/everactive/dmscore/iot-identity/service/factory"
 	"github.com/everactive/dmscore/iot-management/datastore"
 	"github.com/everactive/dmscore/iot-management/service/factory"
+	"github.com/everactive/dmscore/pkg/consistency"
+	"github.com/everactive/dmscore/pkg/datastores"
 	"github.com/everactive/dmscore/versions"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"os"
+	"text/tabwriter"
 )
 
 var version = cobra.Command{
@@ -89,6 +94,7 @@ var createSuperuser = cobra.Command{
 			Name:     name,
 			Email:    email,
 			Role:     datastore.Superuser,
+			Provider: datastore.UserProviderLocal,
 		}
 		_, err = db.CreateUser(user)
 		if err != nil {
@@ -97,3 +103,88 @@ var createSuperuser = cobra.Command{
 		}
 	},
 }
+
+var rotateKEK = cobra.Command{
+	Use:   "rotate-kek",
+	Short: "rotate-kek",
+	Long: `rotate-kek encrypts the private keys in the identity database with the key encryption key configured
+under identity.kek. Keys encrypted with the previous key encryption key, configured under identity.kek.previous,
+are rewrapped and the previous key can be removed from the configuration afterwards.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var configFilePath string
+		if filePath, ok := os.LookupEnv("CONFIG_FILE_PATH"); ok {
+			configFilePath = filePath
+		}
+
+		config.LoadConfig(configFilePath)
+
+		// Opening the identity data store runs the migrations, the rewrap also encrypts any keys still in plaintext
+		databaseDriver := viper.GetString(keys.GetIdentityKey(keys.DatabaseDriver))
+		dataSource := viper.GetString(keys.GetIdentityKey(keys.DatabaseConnectionString))
+		db, err := identityfactory.CreateDataStore(databaseDriver, dataSource)
+		if err != nil || db == nil {
+			log.Fatalf("Error accessing data store: %v", databaseDriver)
+			return
+		}
+
+		count, err := db.PrivateKeysRewrap(context.Background())
+		if err != nil {
+			log.Errorf("Error rotating the key encryption key after %d keys: %v", count, err)
+			return
+		}
+		fmt.Printf("Rewrapped %d private keys\n", count)
+	},
+}
+
+var check = cobra.Command{
+	Use:   "check",
+	Short: "check",
+	Long: `check finds the inconsistencies between the identity, device twin and management databases, such as device
+twins without a registration or in another organization, and group links to deleted devices. With --fix, the
+inconsistencies that can be repaired are repaired.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fix, err := cmd.Flags().GetBool("fix")
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		var configFilePath string
+		if filePath, ok := os.LookupEnv("CONFIG_FILE_PATH"); ok {
+			configFilePath = filePath
+		}
+
+		config.LoadConfig(configFilePath)
+
+		dataStores, err := datastores.New()
+		if err != nil {
+			log.Fatalf("Error accessing the data stores: %v", err)
+			return
+		}
+
+		findings, err := consistency.NewChecker(dataStores).Check(fix)
+		if err != nil {
+			log.Fatalf("Error checking the data stores: %v", err)
+			return
+		}
+
+		fixed := 0
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tORGANIZATION\tDEVICE\tREPAIR\tMESSAGE")
+		for _, f := range findings {
+			status := "-"
+			switch {
+			case f.Fixed:
+				status = "fixed"
+				fixed++
+			case len(f.Error) > 0:
+				status = "failed: " + f.Error
+			case f.Repairable:
+				status = "with --fix"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.Kind, f.OrganizationID, f.DeviceID, status, f.Message)
+		}
+		_ = w.Flush()
+		fmt.Printf("Found %d inconsistencies, fixed %d\n", len(findings), fixed)
+	},
+}
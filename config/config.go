@@ -10,6 +10,9 @@ import (
 var defaultValues = map[string]interface{}{
 	keys.MQTTHealthTopic:                            "devices/health/+",
 	keys.MQTTPubTopic:                               "devices/pub/+",
+	keys.MQTTSubTopic:                               "devices/sub/{device}",
+	keys.MQTTRequiredInstallTopic:                   "devices/actions/{device}/required-install",
+	keys.MQTTTopicPrefix:                            "",
 	keys.MQTTCertificatesPath:                       "/srv/devicetwin-certs",
 	keys.MQTTClientCertificateFilename:              "server.crt",
 	keys.MQTTClientKeyFilename:                      "server.key",
@@ -32,10 +35,39 @@ var defaultValues = map[string]interface{}{
 	keys.GetIdentityKey(keys.ServicePortEnroll):     "8040",
 	keys.GetIdentityKey(keys.MigrationsSourceURL):   "/migrations/identity",
 	keys.GetIdentityKey(keys.CertificatesPath):      "/srv/identity-certs",
+	keys.CRLValidity:                                "24h",
+	keys.OCSPEnabled:                                false,
+	keys.OCSPRespondersRefresh:                      "5m",
+	keys.AccountKeysRefreshInterval:                 "24h",
+	keys.AccountKeysStoreTimeout:                    "10s",
+	keys.CARotationOverlap:                          "720h",
+	keys.KEKTimeout:                                 "30s",
+	keys.RenewalClientCertHeader:                    "",
+	keys.EnrollTrustedProxies:                       []string{},
+	keys.RenewalMaxClockSkew:                        "5m",
+	keys.NonceValidity:                              "5m",
+	keys.ReEnrollmentApprovalRequired:               true,
+	keys.EnrollmentRequestsMaxPending:               1000,
 	keys.DefaultServiceHeartbeat:                    "60s",
 	keys.RequiredSnapsInstallServiceCheckInterval:   "5m",
 	keys.RefreshSnapListOnAnyChange:                 false,
 	keys.RequiredSnapsCheckInterval:                 "100ms",
+	keys.SnapListMinInterval:                        "30s",
+	keys.SnapListPendingTimeout:                     "5m",
+	keys.ActionFollowUpTimeout:                      "2m",
+	keys.JobsInterval:                               "1m",
+	keys.JobStepTimeout:                             "24h",
+	keys.RegistrationJobThreshold:                   100,
+	keys.DecommissionResponseTimeout:                "1h",
+	keys.DecommissionRetries:                        5,
+	keys.JobRetryBackoff:                            "1m",
+	keys.RetentionInterval:                          "24h",
+	keys.RetentionActionsDays:                       0,
+	keys.RetentionActionsArchive:                    false,
+	keys.RetentionDeletedDays:                       0,
+	keys.RetentionStaleDays:                         0,
+	keys.ConsistencyCheckInterval:                   "24h",
+	keys.APITokenExpiryDays:                         90,
 }
 
 const (
@@ -45,6 +45,12 @@ const (
 	MQTTHealthTopic = "mqtt.topic.health"
 	// MQTTPubTopic is publish topic to use for sending devices actions
 	MQTTPubTopic = "mqtt.topic.pub"
+	// MQTTSubTopic is the topic template actions are published to devices on
+	MQTTSubTopic = "mqtt.topic.sub"
+	// MQTTRequiredInstallTopic is the topic template required snap installs are published to devices on
+	MQTTRequiredInstallTopic = "mqtt.topic.required.install"
+	// MQTTTopicPrefix is an optional prefix for all device topics, it may contain {org} (i.e. orgs/{org})
+	MQTTTopicPrefix = "mqtt.topic.prefix"
 	// ServicePortInternal is the port for the internal/private only part of the API
 	ServicePortInternal = "service.port.internal"
 	// ServicePortEnroll is the port for the HTTP service that is exposed externally for clients to use for enrolling
@@ -59,13 +65,53 @@ const (
 	ServiceScheme = "service.scheme"
 	// ServiceHost is the service host name
 	ServiceHost = "service.host"
+	// CRLValidity is how long a generated certificate revocation list, or OCSP response, is valid for
+	CRLValidity = "identity.crl.validity"
+	// OCSPEnabled exposes an OCSP responder for device certificates on the enroll port
+	OCSPEnabled = "identity.ocsp.enabled"
+	// OCSPRespondersRefresh is how long the CAs that answer OCSP requests are cached before they are loaded again
+	OCSPRespondersRefresh = "identity.ocsp.responders.refresh"
+	// CARotationOverlap is how long the previous CA of an organization stays valid after it is rotated
+	CARotationOverlap = "identity.ca.rotation.overlap"
+	// KEK is the configuration prefix of the key encryption key for the private keys stored in the identity
+	// database, e.g. identity.kek.provider, identity.kek.id and identity.kek.passphrase. No provider stores them
+	// in plaintext.
+	KEK = "identity.kek"
+	// KEKPrevious is the configuration prefix of the key encryption key being rotated out, it is only used to decrypt
+	KEKPrevious = "identity.kek.previous"
+	// KEKTimeout bounds each call to the key encryption key provider, which may be a remote KMS
+	KEKTimeout = "identity.kek.timeout"
+	// RenewalClientCertHeader is the request header a TLS terminating proxy passes the URL encoded PEM client
+	// certificate in, for renewals authenticated by the current certificate. Empty disables the header.
+	RenewalClientCertHeader = "identity.renewal.client.cert.header"
+	// EnrollTrustedProxies are the addresses, or CIDR ranges, of the proxies in front of the enroll port. The client
+	// address they forward and the client certificate header are only accepted from them, and ignored from any other
+	// client.
+	EnrollTrustedProxies = "identity.enroll.trusted.proxies"
+	// RenewalMaxClockSkew is how far the timestamp of a renewal request signed with the device key may be from now
+	RenewalMaxClockSkew = "identity.renewal.max.clock.skew"
+	// NonceValidity is how long a nonce issued for a device to sign stays valid, each nonce can only be used once
+	NonceValidity = "identity.nonce.validity"
 	// AutoRegistrationEnabled determines whether devices will be registered when they try to enroll
 	AutoRegistrationEnabled = "identity.auto.registration.enabled"
+	// ReEnrollmentApprovalRequired makes every re-enrollment of an enrolled device wait for admin approval, even when
+	// the device sends the same device key as before. It is on by default.
+	ReEnrollmentApprovalRequired = "identity.reenrollment.approval.required"
+	// EnrollmentRequestsMaxPending is the most pending enrollment requests kept, attempts of other devices are not
+	// recorded until some are decided. Zero means no limit.
+	EnrollmentRequestsMaxPending = "identity.enrollment.requests.max.pending"
 	// DefaultOrganization is default organization used by auto registration
 	DefaultOrganization = "identity.default.organization"
 	// ValidSHA384Keys is and array of the SHA384 of public keys that are acceptable to have signed model and serial
 	// assertions for auto-registration during enrollment
 	ValidSHA384Keys = "identity.assertions.valid.key.signatures"
+	// AccountKeysPath is a file, or a directory of files, of account-key assertions that are trusted to sign model and
+	// serial assertions for auto-registration, in addition to the keys fetched from the store
+	AccountKeysPath = "identity.assertions.account.keys.path"
+	// AccountKeysRefreshInterval is the time between reloading the account-key assertions from the files and the store
+	AccountKeysRefreshInterval = "identity.assertions.refresh.interval"
+	// AccountKeysStoreTimeout is how long fetching an account-key assertion from the store may take
+	AccountKeysStoreTimeout = "identity.assertions.store.timeout"
 	// StoreURL is the URL to Canonicals Snap Store API
 	StoreURL = "store.url"
 	// StoreIDs is a JSON serialized array of modelStoreIds
@@ -92,17 +138,56 @@ const (
 	OAuth2HostPort = "service.oauth2.host.port"
 	// OAuth2HostScheme the scheme for the auth provider (only https should be used)
 	OAuth2HostScheme = "service.oauth2.host.scheme"
+	// OAuth2RoleMappings maps the scopes, realm roles and groups of introspected tokens to a user role and
+	// organization roles, as a list in the config file or as JSON
+	OAuth2RoleMappings = "service.oauth2.role.mappings"
 	// DefaultServiceHeartbeat is the default duration between service heartbeats in the logs (info)
 	DefaultServiceHeartbeat = "service.default.heartbeat"
 	// RequiredSnapsInstallServiceCheckInterval is the interval in which the install service will start or
 	// refresh the checker service which in turn iterates over all the devices to see if they are missing snaps
 	RequiredSnapsInstallServiceCheckInterval = "service.install.interval"
-	// RefreshSnapListOnAnyChange controls whether a snap list is requested if any changes in snaps are detected
+	// RefreshSnapListOnAnyChange controls whether a snap list is requested if any changes in snaps are detected.
+	// Deprecated: reported hashes are now verified against the device twin and a snap list is requested on any drift.
 	RefreshSnapListOnAnyChange = "service.refresh.snaps.any.change"
 	// RequiredSnapsCheckInterval is the time, if the required snaps checker is running, between each device that it
 	// checks to see if it needs snaps that are required (it doesn't have them installed),
 	// 10 devices checked = 1s if this value is 100ms
 	RequiredSnapsCheckInterval = "service.install.required.snaps.check.interval"
+	// SnapListMinInterval is the minimum time between snap list requests sent to a device because its health hashes changed
+	SnapListMinInterval = "service.snaplist.min.interval"
+	// SnapListPendingTimeout is how long to wait on a snap list response before another request can be sent to the device
+	SnapListPendingTimeout = "service.snaplist.pending.timeout"
+	// ActionFollowUpTimeout is how long to wait on a device's response to a snap action before requesting a snap list anyway
+	ActionFollowUpTimeout = "service.action.followup.timeout"
+	// JobsInterval is the time between runs of the jobs that are waiting on a device
+	JobsInterval = "service.jobs.interval"
+	// JobStepTimeout is how long a job step waits on a device before the job fails, zero waits indefinitely
+	JobStepTimeout = "service.jobs.step.timeout"
+	// RegistrationJobThreshold is the number of lines of a bulk registration upload above which the devices are
+	// registered by a background job, zero registers every upload in the request
+	RegistrationJobThreshold = "service.jobs.registration.threshold"
+	// DecommissionResponseTimeout is how long decommissioning waits on the device's response to the unregister action
+	// before carrying on without it, zero waits as long as any job step
+	DecommissionResponseTimeout = "service.jobs.decommission.response.timeout"
+	// DecommissionRetries is the number of times a failed decommissioning step is retried before the job fails
+	DecommissionRetries = "service.jobs.decommission.retries"
+	// JobRetryBackoff is the time before a failed job step is first retried, doubling with each attempt
+	JobRetryBackoff = "service.jobs.retry.backoff"
+	// RetentionInterval is the time between runs of the retention service, zero disables it
+	RetentionInterval = "service.retention.interval"
+	// RetentionActionsDays is the number of days that actions are kept for, zero keeps them indefinitely
+	RetentionActionsDays = "service.retention.actions.days"
+	// RetentionActionsArchive is whether the actions are copied to the archive table before they are deleted
+	RetentionActionsArchive = "service.retention.actions.archive"
+	// RetentionDeletedDays is the grace period, in days, before soft deleted devices are hard deleted, zero keeps them
+	RetentionDeletedDays = "service.retention.deleted.days"
+	// RetentionStaleDays is the number of days a device is not seen for before it is soft deleted, zero keeps it
+	RetentionStaleDays = "service.retention.stale.days"
+	// ConsistencyCheckInterval is the time between checks of the consistency of the data stores, zero disables them
+	ConsistencyCheckInterval = "service.consistency.interval"
+	// APITokenExpiryDays is the number of days an API token is valid for when its creator does not set it, zero
+	// creates tokens that do not expire
+	APITokenExpiryDays = "service.tokens.expiry.days"
 )
 
 func GetIdentityKey(key string) string {
@@ -0,0 +1,8 @@
+ALTER TABLE health_hashes
+    DROP COLUMN drifted;
+
+ALTER TABLE health_hashes
+    DROP COLUMN reported_installed_snaps_hash;
+
+ALTER TABLE health_hashes
+    DROP COLUMN reported_snap_list_hash;
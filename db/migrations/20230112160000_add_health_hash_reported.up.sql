@@ -0,0 +1,8 @@
+ALTER TABLE health_hashes
+    ADD reported_snap_list_hash character varying(256) NOT NULL DEFAULT '';
+
+ALTER TABLE health_hashes
+    ADD reported_installed_snaps_hash character varying(256) NOT NULL DEFAULT '';
+
+ALTER TABLE health_hashes
+    ADD drifted boolean NOT NULL DEFAULT false;
@@ -0,0 +1,30 @@
+CREATE TABLE jobs (
+                        id int generated always as identity primary key,
+                        created_at timestamptz,
+                        deleted_at timestamptz,
+                        updated_at timestamptz,
+                        kind character varying(100) NOT NULL,
+                        org_id character varying(200) NOT NULL,
+                        device_id character varying(200) NOT NULL,
+                        username character varying(200) NOT NULL,
+                        status character varying(50) NOT NULL,
+                        parameters text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX jobs_status_idx ON jobs (status);
+
+CREATE TABLE job_steps (
+                        id int generated always as identity,
+                        created_at timestamptz,
+                        deleted_at timestamptz,
+                        updated_at timestamptz,
+                        job_id int NOT NULL REFERENCES jobs (id) ON DELETE CASCADE,
+                        position int NOT NULL,
+                        name character varying(100) NOT NULL,
+                        status character varying(50) NOT NULL,
+                        message text NOT NULL DEFAULT '',
+                        started_at timestamptz,
+                        finished_at timestamptz
+);
+
+CREATE INDEX job_steps_job_id_idx ON job_steps (job_id);
@@ -0,0 +1 @@
+ALTER TABLE organization_user DROP COLUMN role;
@@ -0,0 +1,7 @@
+ALTER TABLE organization_user ADD COLUMN role character varying(50) NOT NULL DEFAULT 'viewer';
+
+-- Existing members keep what their global role allowed them to do in the organization: standard users could
+-- operate the devices, admins and superusers could administer them
+UPDATE organization_user ou SET role = CASE WHEN u.user_role >= 200 THEN 'org-admin' ELSE 'operator' END
+FROM userinfo u
+WHERE u.username = ou.username AND u.user_role >= 100;
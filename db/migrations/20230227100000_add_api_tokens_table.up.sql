@@ -0,0 +1,21 @@
+CREATE TABLE api_tokens (
+                        id int generated always as identity primary key,
+                        created_at timestamptz,
+                        deleted_at timestamptz,
+                        updated_at timestamptz,
+                        name character varying(200) NOT NULL,
+                        kind character varying(50) NOT NULL,
+                        owner character varying(200) NOT NULL,
+                        username character varying(200) NOT NULL,
+                        prefix character varying(50) NOT NULL,
+                        token_hash character varying(200) NOT NULL,
+                        role integer NOT NULL,
+                        organizations text NOT NULL DEFAULT '',
+                        expires_at timestamptz,
+                        last_used_at timestamptz,
+                        revoked_at timestamptz
+);
+
+CREATE UNIQUE INDEX api_tokens_token_hash_idx ON api_tokens (token_hash);
+CREATE UNIQUE INDEX api_tokens_username_idx ON api_tokens (username);
+CREATE INDEX api_tokens_owner_idx ON api_tokens (owner);
@@ -0,0 +1,21 @@
+CREATE TABLE audit_entries (
+                        id int generated always as identity primary key,
+                        created_at timestamptz NOT NULL DEFAULT now(),
+                        username character varying(200) NOT NULL,
+                        org_id character varying(200) NOT NULL DEFAULT '',
+                        target_type character varying(50) NOT NULL DEFAULT '',
+                        target character varying(200) NOT NULL DEFAULT '',
+                        action character varying(100) NOT NULL,
+                        payload text NOT NULL DEFAULT '',
+                        result character varying(50) NOT NULL,
+                        message text NOT NULL DEFAULT '',
+                        action_id character varying(200) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX audit_entries_created_at_idx ON audit_entries (created_at);
+CREATE INDEX audit_entries_org_id_idx ON audit_entries (org_id, created_at);
+CREATE INDEX audit_entries_target_idx ON audit_entries (target_type, target);
+
+-- The audit log is append-only
+CREATE RULE audit_entries_no_update AS ON UPDATE TO audit_entries DO INSTEAD NOTHING;
+CREATE RULE audit_entries_no_delete AS ON DELETE TO audit_entries DO INSTEAD NOTHING;
@@ -0,0 +1,2 @@
+ALTER TABLE health_hashes
+    DROP COLUMN hash_version;
@@ -0,0 +1,2 @@
+ALTER TABLE health_hashes
+    ADD hash_version integer NOT NULL DEFAULT 1;
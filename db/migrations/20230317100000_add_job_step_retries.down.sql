@@ -0,0 +1,3 @@
+ALTER TABLE job_steps
+    DROP COLUMN attempts,
+    DROP COLUMN retry_at;
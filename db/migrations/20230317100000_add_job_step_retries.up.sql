@@ -0,0 +1,3 @@
+ALTER TABLE job_steps
+    ADD attempts integer NOT NULL DEFAULT 0,
+    ADD retry_at timestamptz;
@@ -0,0 +1,2 @@
+ALTER TABLE userinfo
+    DROP COLUMN provider;
@@ -0,0 +1,8 @@
+ALTER TABLE userinfo
+    ADD provider character varying(50) NOT NULL DEFAULT '';
+
+-- The users of API tokens are only ever created by the tokens
+UPDATE userinfo SET provider = 'api-token' WHERE username LIKE 'token:%';
+
+-- The static client is always created locally, the other users are adopted by the provider that syncs them first
+UPDATE userinfo SET provider = 'local' WHERE username = 'static-client';
@@ -31,10 +31,19 @@ type UnscopedDataStore interface {
 // DataStore is the interfaces for the data repository
 type DataStore interface {
 	DeviceList(orgID string) ([]Device, error)
+	DeviceListAll() ([]Device, error)
 	DeviceGet(id string) (Device, error)
 	DevicePing(id string, refresh time.Time) error
 	DeviceCreate(Device) (int64, error)
 	DeviceDelete(deviceID string) error
+	DeviceProtocolVersionUpdate(deviceID string, version int) error
+	DeviceTransfer(deviceID, orgID string) error
+	DeviceGroupsUnlink(deviceID string) ([]string, error)
+	DeviceListDeleted(orgID string) ([]Device, error)
+	DeviceRestore(deviceID string) error
+	DeviceListStale(before time.Time) ([]Device, error)
+	DevicePurge(deletedBefore time.Time, dryRun bool) ([]string, error)
+	DeviceRecordsPurge(deletedBefore time.Time, dryRun bool) (int64, error)
 
 	DeviceSnapList(id int64) ([]DeviceSnap, error)
 	DeviceSnapDelete(id int64) error
@@ -43,6 +52,10 @@ type DataStore interface {
 	ActionCreate(act Action) (int64, error)
 	ActionUpdate(actionID, status, message string) error
 	ActionListForDevice(orgID, deviceID string) ([]Action, error)
+	ActionGet(actionID string) (Action, error)
+	ActionListFollowUp(actionID, listActionID string) (bool, error)
+	ActionListAwaitingFollowUp(before time.Time) ([]Action, error)
+	ActionPurge(before time.Time, archive, dryRun bool) (int64, error)
 
 	DeviceVersionGet(deviceID int64) (DeviceVersion, error)
 	DeviceVersionUpsert(dv DeviceVersion) error
@@ -55,6 +68,8 @@ type DataStore interface {
 	GroupUnlinkDevice(orgID, name, deviceID string) error
 	GroupGetDevices(orgID, name string) ([]Device, error)
 	GroupGetExcludedDevices(orgID, name string) ([]Device, error)
+	GroupLinkListOrphaned() ([]GroupDeviceLink, error)
+	GroupLinkDelete(id int64) error
 
 	Unscoped() UnscopedDataStore
 }
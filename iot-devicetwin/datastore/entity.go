@@ -37,6 +37,8 @@ type Action struct {
 	Action         string `gorm:"column:action"`
 	Status         string `gorm:"column:status"`
 	Message        string `gorm:"column:message"`
+	ListOnComplete bool   `gorm:"column:list_on_complete"`
+	ListActionID   string `gorm:"column:list_action_id"`
 }
 
 // TableName is the Postgres table name to use
@@ -44,20 +46,32 @@ func (Action) TableName() string {
 	return "action"
 }
 
+// Statuses of an action that the device has responded to
+const (
+	ActionStatusComplete = "complete"
+	ActionStatusError    = "error"
+)
+
+// Finished is whether the device has responded to an action
+func (a Action) Finished() bool {
+	return a.Status == ActionStatusComplete || a.Status == ActionStatusError
+}
+
 // Device the repository definition of a device
 type Device struct {
 	gorm.Model
-	OrganisationID string        `gorm:"column:org_id"`
-	DeviceID       string        `gorm:"column:device_id"`
-	Brand          string        `gorm:"column:brand"`
-	DeviceModel    string        `gorm:"column:model"`
-	SerialNumber   string        `gorm:"column:serial"`
-	DeviceKey      string        `gorm:"column:device_key"`
-	StoreID        string        `gorm:"column:store_id"`
-	Active         bool          `gorm:"column:active"`
-	DeviceVersion  DeviceVersion `gorm:"constraint:OnDelete:CASCADE"`
-	DeviceSnaps    []*DeviceSnap `gorm:"constraint:OnDelete:CASCADE"`
-	LastRefresh    time.Time     `gorm:"column:lastrefresh"`
+	OrganisationID  string        `gorm:"column:org_id"`
+	DeviceID        string        `gorm:"column:device_id"`
+	Brand           string        `gorm:"column:brand"`
+	DeviceModel     string        `gorm:"column:model"`
+	SerialNumber    string        `gorm:"column:serial"`
+	DeviceKey       string        `gorm:"column:device_key"`
+	StoreID         string        `gorm:"column:store_id"`
+	Active          bool          `gorm:"column:active"`
+	DeviceVersion   DeviceVersion `gorm:"constraint:OnDelete:CASCADE"`
+	DeviceSnaps     []*DeviceSnap `gorm:"constraint:OnDelete:CASCADE"`
+	LastRefresh     time.Time     `gorm:"column:lastrefresh"`
+	ProtocolVersion int           `gorm:"column:protocol_version"`
 }
 
 // IsDeleted returns true if the device is soft-deleted in the database
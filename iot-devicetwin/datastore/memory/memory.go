@@ -32,13 +32,14 @@ import (
 
 // Store implements an in-memory store for testing
 type Store struct {
-	Devices        []datastore.Device
-	Snaps          []datastore.DeviceSnap
-	Actions        []datastore.Action
-	DeviceVersions []datastore.DeviceVersion
-	Groups         []datastore.Group
-	GroupLinks     []datastore.GroupDeviceLink
-	lock           sync.RWMutex
+	Devices         []datastore.Device
+	Snaps           []datastore.DeviceSnap
+	Actions         []datastore.Action
+	ArchivedActions []datastore.Action
+	DeviceVersions  []datastore.DeviceVersion
+	Groups          []datastore.Group
+	GroupLinks      []datastore.GroupDeviceLink
+	lock            sync.RWMutex
 }
 
 const (
@@ -75,14 +76,167 @@ func NewStore() *Store {
 
 // Unscoped get an unscoped instance
 func (mem *Store) Unscoped() datastore.UnscopedDataStore {
-	return mem
+	return &unscopedStore{mem: mem}
 }
 
-// DeviceDelete is no-op
-func (mem *Store) DeviceDelete(_ string) error {
+// unscopedStore is an instance of the store that can access (soft) deleted devices
+type unscopedStore struct {
+	mem *Store
+}
+
+// DeviceGet fetches an existing device, even when it is deleted
+func (u *unscopedStore) DeviceGet(id string) (datastore.Device, error) {
+	return u.mem.deviceGet(id, true)
+}
+
+// DeviceDelete soft deletes a device
+func (mem *Store) DeviceDelete(id string) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for i := range mem.Devices {
+		if mem.Devices[i].DeviceID == id {
+			mem.Devices[i].DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		}
+	}
 	return nil
 }
 
+// DeviceListDeleted fetches the soft deleted devices of an organization
+func (mem *Store) DeviceListDeleted(orgID string) ([]datastore.Device, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	devices := []datastore.Device{}
+	for _, d := range mem.Devices {
+		if d.OrganisationID == orgID && d.IsDeleted() {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+// DeviceRestore restores a soft deleted device
+func (mem *Store) DeviceRestore(id string) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for i := range mem.Devices {
+		if mem.Devices[i].DeviceID == id && mem.Devices[i].IsDeleted() {
+			mem.Devices[i].DeletedAt = gorm.DeletedAt{}
+			return nil
+		}
+	}
+	return fmt.Errorf("deleted device with ID `%s` not found", id)
+}
+
+// DeviceListStale fetches the devices that have not been seen since a time
+func (mem *Store) DeviceListStale(before time.Time) ([]datastore.Device, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	devices := []datastore.Device{}
+	for _, d := range mem.Devices {
+		if !d.IsDeleted() && d.LastRefresh.Before(before) {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+// DevicePurge hard deletes the devices soft deleted before a time, with their snaps, version and group links
+func (mem *Store) DevicePurge(deletedBefore time.Time, dryRun bool) ([]string, error) {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	deviceIDs := []string{}
+	ids := map[int64]bool{}
+	devices := []datastore.Device{}
+	for _, d := range mem.Devices {
+		if d.IsDeleted() && d.DeletedAt.Time.Before(deletedBefore) {
+			deviceIDs = append(deviceIDs, d.DeviceID)
+			ids[int64(d.ID)] = true
+			continue
+		}
+		devices = append(devices, d)
+	}
+	if dryRun {
+		return deviceIDs, nil
+	}
+	mem.Devices = devices
+
+	snaps := []datastore.DeviceSnap{}
+	for _, s := range mem.Snaps {
+		if !ids[s.DeviceID] {
+			snaps = append(snaps, s)
+		}
+	}
+	mem.Snaps = snaps
+
+	versions := []datastore.DeviceVersion{}
+	for _, v := range mem.DeviceVersions {
+		if !ids[v.DeviceID] {
+			versions = append(versions, v)
+		}
+	}
+	mem.DeviceVersions = versions
+
+	links := []datastore.GroupDeviceLink{}
+	for _, l := range mem.GroupLinks {
+		if !ids[l.DeviceID] {
+			links = append(links, l)
+		}
+	}
+	mem.GroupLinks = links
+
+	return deviceIDs, nil
+}
+
+// DeviceRecordsPurge hard deletes the snaps and versions soft deleted before a time
+func (mem *Store) DeviceRecordsPurge(deletedBefore time.Time, dryRun bool) (int64, error) {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	var count int64
+	snaps := []datastore.DeviceSnap{}
+	for _, s := range mem.Snaps {
+		if s.DeletedAt.Valid && s.DeletedAt.Time.Before(deletedBefore) {
+			count++
+			continue
+		}
+		snaps = append(snaps, s)
+	}
+
+	versions := []datastore.DeviceVersion{}
+	for _, v := range mem.DeviceVersions {
+		if v.DeletedAt.Valid && v.DeletedAt.Time.Before(deletedBefore) {
+			count++
+			continue
+		}
+		versions = append(versions, v)
+	}
+
+	if !dryRun {
+		mem.Snaps = snaps
+		mem.DeviceVersions = versions
+	}
+	return count, nil
+}
+
+// DeviceListAll fetches the devices of all the organizations
+func (mem *Store) DeviceListAll() ([]datastore.Device, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	devices := []datastore.Device{}
+	for _, d := range mem.Devices {
+		if !d.IsDeleted() {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
 // DeviceList fetches existing devices
 func (mem *Store) DeviceList(orgID string) ([]datastore.Device, error) {
 	mem.lock.RLock()
@@ -95,7 +249,7 @@ func (mem *Store) DeviceList(orgID string) ([]datastore.Device, error) {
 	devices := []datastore.Device{}
 
 	for _, d := range mem.Devices {
-		if d.OrganisationID == orgID {
+		if d.OrganisationID == orgID && !d.IsDeleted() {
 			devices = append(devices, d)
 		}
 	}
@@ -104,11 +258,15 @@ func (mem *Store) DeviceList(orgID string) ([]datastore.Device, error) {
 
 // DeviceGet fetches an existing device
 func (mem *Store) DeviceGet(id string) (datastore.Device, error) {
+	return mem.deviceGet(id, false)
+}
+
+func (mem *Store) deviceGet(id string, unscoped bool) (datastore.Device, error) {
 	mem.lock.RLock()
 	defer mem.lock.RUnlock()
 
 	for _, d := range mem.Devices {
-		if d.DeviceID == id {
+		if d.DeviceID == id && (unscoped || !d.IsDeleted()) {
 			return d, nil
 		}
 	}
@@ -147,6 +305,79 @@ func (mem *Store) DevicePing(id string, refresh time.Time) error {
 	return nil
 }
 
+// DeviceProtocolVersionUpdate records the protocol version for a device, only ever raising it
+func (mem *Store) DeviceProtocolVersionUpdate(id string, version int) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for i := range mem.Devices {
+		if mem.Devices[i].DeviceID == id && mem.Devices[i].ProtocolVersion < version {
+			mem.Devices[i].ProtocolVersion = version
+		}
+	}
+	return nil
+}
+
+// DeviceTransfer moves a device and its actions to another organization, dropping its group links
+func (mem *Store) DeviceTransfer(id, orgID string) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	found := false
+	for i := range mem.Devices {
+		if mem.Devices[i].DeviceID != id {
+			continue
+		}
+		found = true
+		mem.Devices[i].OrganisationID = orgID
+
+		links := []datastore.GroupDeviceLink{}
+		for _, l := range mem.GroupLinks {
+			if l.DeviceID != int64(mem.Devices[i].ID) {
+				links = append(links, l)
+			}
+		}
+		mem.GroupLinks = links
+	}
+	if !found {
+		return fmt.Errorf("device with ID `%s` not found", id)
+	}
+
+	for i := range mem.Actions {
+		if mem.Actions[i].DeviceID == id {
+			mem.Actions[i].OrganizationID = orgID
+		}
+	}
+	return nil
+}
+
+// DeviceGroupsUnlink removes the links of a device to its groups, returning the names of the groups
+func (mem *Store) DeviceGroupsUnlink(id string) ([]string, error) {
+	device, err := mem.DeviceGet(id)
+	if err != nil {
+		return nil, err
+	}
+
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	names := []string{}
+	links := []datastore.GroupDeviceLink{}
+	for _, l := range mem.GroupLinks {
+		if l.DeviceID != int64(device.ID) {
+			links = append(links, l)
+			continue
+		}
+		for _, g := range mem.Groups {
+			if g.ID == l.GroupID {
+				names = append(names, g.Name)
+			}
+		}
+	}
+	mem.GroupLinks = links
+	return names, nil
+}
+
 // DeviceCreate creates a new device
 func (mem *Store) DeviceCreate(device datastore.Device) (int64, error) {
 	// Check the device does not exist
@@ -226,10 +457,36 @@ func (mem *Store) ActionCreate(act datastore.Action) (int64, error) {
 	defer mem.lock.Unlock()
 
 	act.ID = uint(len(mem.Actions) + 1)
+	act.CreatedAt = time.Now()
 	mem.Actions = append(mem.Actions, act)
 	return int64(act.ID), nil
 }
 
+// ActionPurge deletes the actions created before a time that the device has responded to, archiving them if
+// requested
+func (mem *Store) ActionPurge(before time.Time, archive, dryRun bool) (int64, error) {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	var count int64
+	actions := []datastore.Action{}
+	for _, a := range mem.Actions {
+		if a.CreatedAt.Before(before) && a.Finished() {
+			count++
+			if archive && !dryRun {
+				mem.ArchivedActions = append(mem.ArchivedActions, a)
+			}
+			continue
+		}
+		actions = append(actions, a)
+	}
+
+	if !dryRun {
+		mem.Actions = actions
+	}
+	return count, nil
+}
+
 // ActionUpdate updates an action log
 func (mem *Store) ActionUpdate(actionID, status, message string) error {
 	mem.lock.Lock()
@@ -263,6 +520,48 @@ func (mem *Store) ActionListForDevice(orgID, clientID string) ([]datastore.Actio
 	return actions, nil
 }
 
+// ActionGet fetches an action by its action ID
+func (mem *Store) ActionGet(actionID string) (datastore.Action, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	for _, a := range mem.Actions {
+		if a.ActionID == actionID {
+			return a, nil
+		}
+	}
+	return datastore.Action{}, fmt.Errorf("action with ID `%s` not found", actionID)
+}
+
+// ActionListFollowUp links the snap list action sent after an action, if it has not been already
+func (mem *Store) ActionListFollowUp(actionID, listActionID string) (bool, error) {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for i := range mem.Actions {
+		a := &mem.Actions[i]
+		if a.ActionID == actionID && a.ListOnComplete && len(a.ListActionID) == 0 {
+			a.ListActionID = listActionID
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ActionListAwaitingFollowUp lists the actions created before a time that still need a snap list sent after them
+func (mem *Store) ActionListAwaitingFollowUp(before time.Time) ([]datastore.Action, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	actions := []datastore.Action{}
+	for _, a := range mem.Actions {
+		if a.ListOnComplete && len(a.ListActionID) == 0 && a.CreatedAt.Before(before) {
+			actions = append(actions, a)
+		}
+	}
+	return actions, nil
+}
+
 // DeviceVersionGet gets the OS details for a device
 func (mem *Store) DeviceVersionGet(deviceID int64) (datastore.DeviceVersion, error) {
 	mem.lock.RLock()
@@ -491,3 +790,39 @@ func (mem *Store) GroupGetExcludedDevices(orgID, name string) ([]datastore.Devic
 	}
 	return devices, nil
 }
+
+// GroupLinkListOrphaned lists the group links to devices that are deleted, missing or in another organization
+func (mem *Store) GroupLinkListOrphaned() ([]datastore.GroupDeviceLink, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	links := []datastore.GroupDeviceLink{}
+	for _, l := range mem.GroupLinks {
+		orphaned := true
+		for _, d := range mem.Devices {
+			if int64(d.ID) == l.DeviceID {
+				orphaned = d.IsDeleted() || d.OrganisationID != l.OrganisationID
+				break
+			}
+		}
+		if orphaned {
+			links = append(links, l)
+		}
+	}
+	return links, nil
+}
+
+// GroupLinkDelete deletes a group link
+func (mem *Store) GroupLinkDelete(id int64) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	links := []datastore.GroupDeviceLink{}
+	for _, l := range mem.GroupLinks {
+		if l.ID != id {
+			links = append(links, l)
+		}
+	}
+	mem.GroupLinks = links
+	return nil
+}
@@ -57,6 +57,33 @@ func TestStore_DeviceGet(t *testing.T) {
 	}
 }
 
+func TestStore_DeviceProtocolVersionUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []int
+		want     int
+	}{
+		{"first", []int{1}, 1},
+		{"raised", []int{1, 2}, 2},
+		{"never-lowered", []int{2, 1}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewStore()
+			for _, v := range tt.versions {
+				if err := mem.DeviceProtocolVersionUpdate("a111", v); err != nil {
+					t.Errorf("Store.DeviceProtocolVersionUpdate() error = %v", err)
+				}
+			}
+
+			got, _ := mem.DeviceGet("a111")
+			if got.ProtocolVersion != tt.want {
+				t.Errorf("Store.DeviceProtocolVersionUpdate() protocol version = %v, want %v", got.ProtocolVersion, tt.want)
+			}
+		})
+	}
+}
+
 func TestStore_DevicePing(t *testing.T) {
 	type args struct {
 		id      string
@@ -184,6 +211,37 @@ func TestStore_ActionWorkflow(t *testing.T) {
 	}
 }
 
+func TestStore_ActionListFollowUp(t *testing.T) {
+	mem := NewStore()
+	_, _ = mem.ActionCreate(datastore.Action{ActionID: "a1", Action: "install", DeviceID: "a111", ListOnComplete: true})
+	_, _ = mem.ActionCreate(datastore.Action{ActionID: "a2", Action: "conf", DeviceID: "a111"})
+
+	awaiting, err := mem.ActionListAwaitingFollowUp(time.Now().Add(time.Minute))
+	if err != nil || len(awaiting) != 1 || awaiting[0].ActionID != "a1" {
+		t.Errorf("Store.ActionListAwaitingFollowUp() = %v, %v, want only a1", awaiting, err)
+	}
+
+	if linked, _ := mem.ActionListFollowUp("a1", "l1"); !linked {
+		t.Errorf("Store.ActionListFollowUp() = false, want true")
+	}
+	if linked, _ := mem.ActionListFollowUp("a1", "l2"); linked {
+		t.Errorf("Store.ActionListFollowUp() second time = true, want false")
+	}
+	if linked, _ := mem.ActionListFollowUp("a2", "l3"); linked {
+		t.Errorf("Store.ActionListFollowUp() without list on complete = true, want false")
+	}
+
+	act, err := mem.ActionGet("a1")
+	if err != nil || act.ListActionID != "l1" {
+		t.Errorf("Store.ActionGet() list action ID = %v, %v, want l1", act.ListActionID, err)
+	}
+
+	awaiting, _ = mem.ActionListAwaitingFollowUp(time.Now().Add(time.Minute))
+	if len(awaiting) != 0 {
+		t.Errorf("Store.ActionListAwaitingFollowUp() = %v, want none", awaiting)
+	}
+}
+
 func TestStore_DeviceVersionWorkflow(t *testing.T) {
 	type args struct {
 		dv datastore.DeviceVersion
@@ -430,3 +488,153 @@ func TestStore_GroupGetExcludedDevices(t *testing.T) {
 		})
 	}
 }
+
+func TestStore_DeviceTransfer(t *testing.T) {
+	mem := NewStore()
+
+	if err := mem.DeviceTransfer("a111", "def"); err != nil {
+		t.Fatalf("Store.DeviceTransfer() error = %v", err)
+	}
+
+	got, _ := mem.DeviceGet("a111")
+	if got.OrganisationID != "def" {
+		t.Errorf("Store.DeviceTransfer() organization = %v, want %v", got.OrganisationID, "def")
+	}
+	for _, l := range mem.GroupLinks {
+		if l.DeviceID == int64(got.ID) {
+			t.Errorf("Store.DeviceTransfer() group link %d not removed", l.ID)
+		}
+	}
+
+	if err := mem.DeviceTransfer("c333", "def"); err != nil {
+		t.Fatalf("Store.DeviceTransfer() error = %v", err)
+	}
+	actions, _ := mem.ActionListForDevice("def", "c333")
+	if len(actions) != 2 {
+		t.Errorf("Store.DeviceTransfer() actions = %v, want %v", len(actions), 2)
+	}
+
+	if err := mem.DeviceTransfer("invalid", "def"); err == nil {
+		t.Error("Store.DeviceTransfer() expected error for an unknown device")
+	}
+}
+
+func TestStore_DeviceGroupsUnlink(t *testing.T) {
+	mem := NewStore()
+
+	got, err := mem.DeviceGroupsUnlink("a111")
+	if err != nil {
+		t.Fatalf("Store.DeviceGroupsUnlink() error = %v", err)
+	}
+	if len(got) != 1 || got[0] != "workshop" {
+		t.Errorf("Store.DeviceGroupsUnlink() = %v, want %v", got, []string{"workshop"})
+	}
+	if len(mem.GroupLinks) != 0 {
+		t.Errorf("Store.DeviceGroupsUnlink() group links = %v, want %v", len(mem.GroupLinks), 0)
+	}
+
+	if _, err := mem.DeviceGroupsUnlink("invalid"); err == nil {
+		t.Error("Store.DeviceGroupsUnlink() expected error for an unknown device")
+	}
+}
+
+func TestStore_DeviceRestore(t *testing.T) {
+	mem := NewStore()
+
+	if err := mem.DeviceDelete("a111"); err != nil {
+		t.Fatalf("Store.DeviceDelete() error = %v", err)
+	}
+	if _, err := mem.DeviceGet("a111"); err == nil {
+		t.Error("Store.DeviceDelete() device is not deleted")
+	}
+	if d, err := mem.Unscoped().DeviceGet("a111"); err != nil || !d.IsDeleted() {
+		t.Errorf("Store.Unscoped().DeviceGet() = %v, %v", d.IsDeleted(), err)
+	}
+	devices, _ := mem.DeviceList("abc")
+	deleted, _ := mem.DeviceListDeleted("abc")
+	if len(devices) != 2 || len(deleted) != 1 || deleted[0].DeviceID != "a111" {
+		t.Errorf("Store.DeviceListDeleted() = %v, devices %v", len(deleted), len(devices))
+	}
+
+	if err := mem.DeviceRestore("a111"); err != nil {
+		t.Fatalf("Store.DeviceRestore() error = %v", err)
+	}
+	if _, err := mem.DeviceGet("a111"); err != nil {
+		t.Errorf("Store.DeviceRestore() device is not restored: %v", err)
+	}
+	if err := mem.DeviceRestore("a111"); err == nil {
+		t.Error("Store.DeviceRestore() expected error for a device that is not deleted")
+	}
+}
+
+func TestStore_DevicePurge(t *testing.T) {
+	mem := NewStore()
+	if err := mem.DeviceDelete("a111"); err != nil {
+		t.Fatalf("Store.DeviceDelete() error = %v", err)
+	}
+
+	got, _ := mem.DevicePurge(time.Now().Add(-time.Hour), false)
+	if len(got) != 0 {
+		t.Errorf("Store.DevicePurge() = %v, want none within the grace period", got)
+	}
+
+	got, _ = mem.DevicePurge(time.Now(), true)
+	if len(got) != 1 || len(mem.Devices) != 3 {
+		t.Errorf("Store.DevicePurge() dry run = %v, devices %v", got, len(mem.Devices))
+	}
+
+	got, _ = mem.DevicePurge(time.Now(), false)
+	if len(got) != 1 || got[0] != "a111" {
+		t.Errorf("Store.DevicePurge() = %v, want %v", got, "a111")
+	}
+	if _, err := mem.Unscoped().DeviceGet("a111"); err == nil {
+		t.Error("Store.DevicePurge() device is not purged")
+	}
+	if len(mem.Devices) != 2 || len(mem.Snaps) != 0 || len(mem.GroupLinks) != 0 {
+		t.Errorf("Store.DevicePurge() devices %v, snaps %v, group links %v", len(mem.Devices), len(mem.Snaps), len(mem.GroupLinks))
+	}
+}
+
+func TestStore_ActionPurge(t *testing.T) {
+	mem := NewStore()
+	if _, err := mem.ActionCreate(datastore.Action{OrganizationID: "abc", DeviceID: "a111", ActionID: "new", Action: "list"}); err != nil {
+		t.Fatalf("Store.ActionCreate() error = %v", err)
+	}
+	before := time.Now().Add(-time.Hour)
+
+	// Only the old action that the device has responded to is purged, the other is still waiting on the device
+	mem.Actions[0].Status = datastore.ActionStatusComplete
+
+	if got, _ := mem.ActionPurge(before, true, true); got != 1 || len(mem.Actions) != 3 || len(mem.ArchivedActions) != 0 {
+		t.Errorf("Store.ActionPurge() dry run = %v, actions %v", got, len(mem.Actions))
+	}
+
+	if got, _ := mem.ActionPurge(before, true, false); got != 1 {
+		t.Errorf("Store.ActionPurge() = %v, want %v", got, 1)
+	}
+	if len(mem.Actions) != 2 || mem.Actions[0].ID != testID2 || mem.Actions[1].ActionID != "new" || len(mem.ArchivedActions) != 1 {
+		t.Errorf("Store.ActionPurge() actions %v, archived %v", len(mem.Actions), len(mem.ArchivedActions))
+	}
+}
+
+func TestStore_GroupLinkListOrphaned(t *testing.T) {
+	mem := NewStore()
+	if got, _ := mem.GroupLinkListOrphaned(); len(got) != 0 {
+		t.Errorf("Store.GroupLinkListOrphaned() = %v, want none", got)
+	}
+
+	if err := mem.DeviceDelete("a111"); err != nil {
+		t.Fatalf("Store.DeviceDelete() error = %v", err)
+	}
+	got, _ := mem.GroupLinkListOrphaned()
+	if len(got) != 1 || got[0].DeviceID != testID1 {
+		t.Fatalf("Store.GroupLinkListOrphaned() = %v, want the link to the deleted device", got)
+	}
+
+	if err := mem.GroupLinkDelete(got[0].ID); err != nil {
+		t.Fatalf("Store.GroupLinkDelete() error = %v", err)
+	}
+	if len(mem.GroupLinks) != 0 {
+		t.Errorf("Store.GroupLinkDelete() links = %v, want none", len(mem.GroupLinks))
+	}
+}
@@ -22,6 +22,8 @@ package postgres
 import (
 	"errors"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
 
 	"github.com/everactive/dmscore/iot-devicetwin/datastore"
 )
@@ -76,3 +78,73 @@ func (db *DataStore) ActionListForDevice(orgID, deviceID string) ([]datastore.Ac
 
 	return actions, nil
 }
+
+// ActionGet fetches an action by its action ID
+func (db *DataStore) ActionGet(actionID string) (datastore.Action, error) {
+	act := datastore.Action{}
+	res := db.gormDB.Where("action_id = ?", actionID).First(&act)
+	return act, res.Error
+}
+
+// ActionListFollowUp links the snap list action sent after an action completed or timed out. It returns false
+// if the action has already been followed up, so only one list is sent.
+func (db *DataStore) ActionListFollowUp(actionID, listActionID string) (bool, error) {
+	res := db.gormDB.Model(&datastore.Action{}).
+		Where("action_id = ? AND list_on_complete AND list_action_id = ''", actionID).
+		Update("list_action_id", listActionID)
+
+	if res.Error != nil {
+		log.Error(res.Error)
+		return false, res.Error
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+// ActionListAwaitingFollowUp lists the actions created before a time that still need a snap list sent after them
+func (db *DataStore) ActionListAwaitingFollowUp(before time.Time) ([]datastore.Action, error) {
+	actions := []datastore.Action{}
+	res := db.gormDB.Where("list_on_complete AND list_action_id = '' AND created_at < ?", before).Find(&actions)
+	if res.Error != nil {
+		log.Error(res.Error)
+		return actions, res.Error
+	}
+
+	return actions, nil
+}
+
+// actionArchiveColumns are the columns copied to the `action_archive` table. They are listed, rather than copying
+// the whole row, so that the archive does not break when a column is added to the `action` table.
+const actionArchiveColumns = "id, created_at, updated_at, deleted_at, org_id, device_id, action_id, action, status, message, list_on_complete, list_action_id"
+
+// ActionPurge deletes the actions created before a time that the device has responded to, returning the number of
+// actions. The actions are copied to the `action_archive` table first when they are archived. A dry run only counts
+// them. Actions still waiting on the device are kept.
+func (db *DataStore) ActionPurge(before time.Time, archive, dryRun bool) (int64, error) {
+	finished := []string{datastore.ActionStatusComplete, datastore.ActionStatusError}
+	if dryRun {
+		var count int64
+		res := db.gormDB.Unscoped().Model(&datastore.Action{}).Where("created_at < ? AND status IN ?", before, finished).Count(&count)
+		return count, res.Error
+	}
+
+	var count int64
+	err := db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if archive {
+			query := "insert into action_archive (" + actionArchiveColumns + ") select " + actionArchiveColumns +
+				" from action where created_at < ? and status in ?"
+			if err := tx.Exec(query, before, finished).Error; err != nil {
+				return err
+			}
+		}
+
+		res := tx.Unscoped().Where("created_at < ? AND status IN ?", before, finished).Delete(&datastore.Action{})
+		count = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	return count, nil
+}
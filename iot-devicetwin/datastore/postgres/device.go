@@ -69,6 +69,100 @@ func (db *DataStore) DevicePing(deviceID string, refresh time.Time) error {
 	return nil
 }
 
+// DeviceProtocolVersionUpdate records the protocol version for a device, only ever raising it
+func (db *DataStore) DeviceProtocolVersionUpdate(deviceID string, version int) error {
+	res := db.gormDB.Model(&datastore.Device{}).
+		Where("device_id = ? AND protocol_version < ?", deviceID, version).
+		Update("protocol_version", version)
+	if res.Error != nil {
+		log.Error(res.Error)
+		return res.Error
+	}
+	return nil
+}
+
+// DeviceTransfer moves a device and its actions to another organization. Group links
+// are removed as groups belong to the previous organization.
+func (db *DataStore) DeviceTransfer(deviceID, orgID string) error {
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		device := datastore.Device{}
+		res := tx.Where("device_id = ?", deviceID).First(&device)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		res = tx.Model(&device).Update("org_id", orgID)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		res = tx.Model(&datastore.Action{}).Where("device_id = ?", deviceID).Update("org_id", orgID)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		return tx.Exec("delete from group_device_link where device_id = ?", device.ID).Error
+	})
+}
+
+// DeviceGroupsUnlink removes the links of a device to its groups, returning the names of the groups.
+// A (soft) deleted device is unlinked too.
+func (db *DataStore) DeviceGroupsUnlink(deviceID string) ([]string, error) {
+	names := []string{}
+	err := db.gormDB.Transaction(func(tx *gorm.DB) error {
+		device := datastore.Device{}
+		res := tx.Unscoped().Where("device_id = ?", deviceID).First(&device)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		res = tx.Raw("select g.name from org_group g inner join group_device_link lnk on lnk.group_id=g.id where lnk.device_id = ? order by g.name", device.ID).Scan(&names)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		return tx.Exec("delete from group_device_link where device_id = ?", device.ID).Error
+	})
+	return names, err
+}
+
+// DeviceListDeleted fetches the soft deleted devices of an organization
+func (db *DataStore) DeviceListDeleted(orgID string) ([]datastore.Device, error) {
+	devices := []datastore.Device{}
+	res := db.gormDB.Unscoped().Where("org_id = ? AND deleted_at IS NOT NULL", orgID).Order("deleted_at desc").Find(&devices)
+	return devices, res.Error
+}
+
+// DeviceRestore restores a soft deleted device. Its snaps, their service statuses and its version are soft
+// deleted with the device, so the ones deleted since the device was are restored with it.
+func (db *DataStore) DeviceRestore(deviceID string) error {
+	device := datastore.Device{}
+	res := db.gormDB.Unscoped().Where("device_id = ? AND deleted_at IS NOT NULL", deviceID).First(&device)
+	if res.Error != nil {
+		return res.Error
+	}
+	deletedAt := device.DeletedAt.Time
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&datastore.Device{}).Where("id = ?", device.ID).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&datastore.DeviceVersion{}).
+			Where("device_id = ? AND deleted_at >= ?", device.ID, deletedAt).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&datastore.ServiceStatus{}).
+			Where("device_snap_id IN (SELECT id FROM device_snap WHERE device_id = ?) AND deleted_at >= ?", device.ID, deletedAt).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&datastore.DeviceSnap{}).
+			Where("device_id = ? AND deleted_at >= ?", device.ID, deletedAt).
+			Update("deleted_at", nil).Error
+	})
+}
+
 // DeviceDelete deletes the device
 func (db *DataStore) DeviceDelete(deviceID string) error {
 
@@ -86,6 +180,13 @@ func (db *DataStore) DeviceDelete(deviceID string) error {
 	return nil
 }
 
+// DeviceListAll fetches the devices of all the organizations from the database
+func (db *DataStore) DeviceListAll() ([]datastore.Device, error) {
+	devices := []datastore.Device{}
+	res := db.gormDB.Order("org_id, device_id").Find(&devices)
+	return devices, res.Error
+}
+
 // DeviceList fetches the devices for an organization from the database
 func (db *DataStore) DeviceList(orgID string) ([]datastore.Device, error) {
 	devices := []datastore.Device{}
@@ -98,3 +199,79 @@ func (db *DataStore) DeviceList(orgID string) ([]datastore.Device, error) {
 
 	return devices, nil
 }
+
+// DeviceListStale fetches the devices that have not been seen since a time
+func (db *DataStore) DeviceListStale(before time.Time) ([]datastore.Device, error) {
+	devices := []datastore.Device{}
+	res := db.gormDB.Where("lastrefresh < ?", before).Order("lastrefresh").Find(&devices)
+	return devices, res.Error
+}
+
+// DevicePurge hard deletes the devices soft deleted before a time, with their snaps, service statuses, version and
+// group links, returning the IDs of the devices. A dry run only lists the devices.
+func (db *DataStore) DevicePurge(deletedBefore time.Time, dryRun bool) ([]string, error) {
+	devices := []datastore.Device{}
+	res := db.gormDB.Unscoped().Where("deleted_at < ?", deletedBefore).Order("deleted_at").Find(&devices)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	deviceIDs := []string{}
+	ids := []uint{}
+	for _, d := range devices {
+		deviceIDs = append(deviceIDs, d.DeviceID)
+		ids = append(ids, d.ID)
+	}
+	if dryRun || len(ids) == 0 {
+		return deviceIDs, nil
+	}
+
+	// The hooks of the models soft delete, so the records are deleted directly
+	err := db.gormDB.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"delete from service_statuses where device_snap_id in (select id from device_snap where device_id in ?)",
+			"delete from device_snap where device_id in ?",
+			"delete from device_version where device_id in ?",
+			"delete from group_device_link where device_id in ?",
+			"delete from device where id in ?",
+		}
+		for _, stmt := range statements {
+			if err := tx.Exec(stmt, ids).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deviceIDs, nil
+}
+
+// DeviceRecordsPurge hard deletes the snaps, service statuses and versions soft deleted before a time, returning
+// the number of records. A dry run only counts them.
+func (db *DataStore) DeviceRecordsPurge(deletedBefore time.Time, dryRun bool) (int64, error) {
+	tables := []interface{}{&datastore.ServiceStatus{}, &datastore.DeviceSnap{}, &datastore.DeviceVersion{}}
+
+	var total int64
+	err := db.gormDB.Transaction(func(tx *gorm.DB) error {
+		for _, m := range tables {
+			if dryRun {
+				var count int64
+				if err := tx.Unscoped().Model(m).Where("deleted_at < ?", deletedBefore).Count(&count).Error; err != nil {
+					return err
+				}
+				total += count
+				continue
+			}
+
+			res := tx.Session(&gorm.Session{SkipHooks: true}).Unscoped().Where("deleted_at < ?", deletedBefore).Delete(m)
+			if res.Error != nil {
+				return res.Error
+			}
+			total += res.RowsAffected
+		}
+		return nil
+	})
+	return total, err
+}
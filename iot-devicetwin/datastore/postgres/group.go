@@ -155,3 +155,34 @@ func (db *DataStore) GroupGetDevices(orgID, name string) ([]datastore.Device, er
 func (db *DataStore) GroupGetExcludedDevices(orgID, name string) ([]datastore.Device, error) {
 	return db.getGroupDevices(listGroupDeviceExcludedLinkSQL, orgID, name)
 }
+
+// GroupLinkListOrphaned lists the group links to devices that are deleted, missing or in another organization
+func (db *DataStore) GroupLinkListOrphaned() ([]datastore.GroupDeviceLink, error) {
+	rows, err := db.Query(listOrphanedGroupDeviceLinkSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Printf("Error attempting to close rows: %+v", err)
+		}
+	}()
+
+	links := []datastore.GroupDeviceLink{}
+	for rows.Next() {
+		item := datastore.GroupDeviceLink{}
+		if err := rows.Scan(&item.ID, &item.Created, &item.OrganisationID, &item.GroupID, &item.DeviceID); err != nil {
+			return nil, err
+		}
+		links = append(links, item)
+	}
+
+	return links, rows.Err()
+}
+
+// GroupLinkDelete deletes a group link
+func (db *DataStore) GroupLinkDelete(id int64) error {
+	_, err := db.Exec(deleteGroupDeviceLinkByIDSQL, id)
+	return err
+}
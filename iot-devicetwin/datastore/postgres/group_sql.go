@@ -40,6 +40,16 @@ values ($1,$2,$3)`
 
 const deleteGroupDeviceLinkSQL = `delete from group_device_link where group_id=$1 and device_id=$2`
 
+const deleteGroupDeviceLinkByIDSQL = `delete from group_device_link where id=$1`
+
+const listOrphanedGroupDeviceLinkSQL = `
+select lnk.id, lnk.created, lnk.org_id, lnk.group_id, lnk.device_id
+from group_device_link lnk
+left join device d on d.id=lnk.device_id
+where d.id is null or d.deleted_at is not null or d.org_id<>lnk.org_id
+order by lnk.id
+`
+
 const listGroupDeviceLinkSQL = `
 select d.id, d.created_at, d.lastrefresh, d.org_id, d.device_id, d.brand, d.model, d.serial, d.store_id, d.device_key, d.active
 from device d
@@ -0,0 +1,2 @@
+ALTER TABLE device
+    DROP COLUMN protocol_version;
@@ -0,0 +1,4 @@
+-- 20230106150000_add_device_protocol_version.up.sql
+
+ALTER TABLE device
+    ADD protocol_version INTEGER NOT NULL DEFAULT 0;
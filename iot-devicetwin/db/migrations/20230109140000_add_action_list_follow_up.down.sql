@@ -0,0 +1,5 @@
+ALTER TABLE action
+    DROP COLUMN list_action_id;
+
+ALTER TABLE action
+    DROP COLUMN list_on_complete;
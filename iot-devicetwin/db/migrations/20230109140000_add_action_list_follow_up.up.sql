@@ -0,0 +1,7 @@
+-- 20230109140000_add_action_list_follow_up.up.sql
+
+ALTER TABLE action
+    ADD list_on_complete BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE action
+    ADD list_action_id character varying(200) NOT NULL DEFAULT '';
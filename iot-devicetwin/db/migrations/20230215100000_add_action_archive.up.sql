@@ -0,0 +1,6 @@
+-- 20230215100000_add_action_archive.up.sql
+
+-- The actions pruned by the retention service are archived here, when archiving is enabled
+CREATE TABLE IF NOT EXISTS action_archive (LIKE action INCLUDING DEFAULTS);
+
+CREATE INDEX IF NOT EXISTS action_archive_device_id_idx ON action_archive (device_id);
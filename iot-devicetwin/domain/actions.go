@@ -128,4 +128,6 @@ type Action struct {
 	Action         string    `json:"action"`
 	Status         string    `json:"status"`
 	Message        string    `json:"message"`
+	ListOnComplete bool      `json:"listOnComplete,omitempty"`
+	ListActionID   string    `json:"listActionId,omitempty"`
 }
@@ -0,0 +1,42 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Device Twin Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package domain
+
+import "time"
+
+// RetentionPolicy sets the device twin data that is purged. A zero time keeps the data.
+type RetentionPolicy struct {
+	// ActionsBefore deletes the actions created before it
+	ActionsBefore time.Time
+	// ArchiveActions copies the actions to the archive before they are deleted
+	ArchiveActions bool
+	// DeletedBefore hard deletes the devices, snaps and versions soft deleted before it
+	DeletedBefore time.Time
+	// StaleBefore soft deletes the devices that have not been seen since it
+	StaleBefore time.Time
+}
+
+// RetentionReport is the device twin data purged by a retention policy, or that would be on a dry run
+type RetentionReport struct {
+	Actions       int64    `json:"actions"`
+	DevicesPurged []string `json:"devicesPurged"`
+	RecordsPurged int64    `json:"recordsPurged"`
+	DevicesStale  []string `json:"devicesStale"`
+}
@@ -0,0 +1,36 @@
+package actions
+
+import "strconv"
+
+// UnversionedProtocolVersion is the protocol version of devices that only send and understand unversioned messages
+const UnversionedProtocolVersion = 1
+
+// Versions is the registry of the versioned messages: the message version, by action, that actions are sent with
+// and that the responses are handled for. Actions that are not listed are always unversioned.
+var Versions = map[string]int{
+	List: 2,
+}
+
+// Version picks the message version to send an action with, given the highest protocol version the device has
+// spoken. An empty version is an unversioned message.
+func Version(action string, deviceProtocolVersion int) string {
+	version := Versions[action]
+	if deviceProtocolVersion < version {
+		version = deviceProtocolVersion
+	}
+
+	if version <= UnversionedProtocolVersion {
+		return ""
+	}
+
+	return strconv.Itoa(version)
+}
+
+// ProtocolVersion converts the version of a message to the protocol version of the device that sent it
+func ProtocolVersion(version string) (int, error) {
+	if len(version) == 0 {
+		return UnversionedProtocolVersion, nil
+	}
+
+	return strconv.Atoi(version)
+}
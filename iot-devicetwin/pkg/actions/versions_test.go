@@ -0,0 +1,40 @@
+package actions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		name                  string
+		action                string
+		deviceProtocolVersion int
+		want                  string
+	}{
+		{"unknown-device", List, 0, ""},
+		{"unversioned-device", List, 1, ""},
+		{"v2-device", List, 2, "2"},
+		{"newer-device", List, 3, "2"},
+		{"unversioned-action", Install, 2, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Version(tt.action, tt.deviceProtocolVersion))
+		})
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	v, err := ProtocolVersion("")
+	assert.NoError(t, err)
+	assert.Equal(t, UnversionedProtocolVersion, v)
+
+	v, err = ProtocolVersion("2")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+
+	_, err = ProtocolVersion("two")
+	assert.Error(t, err)
+}
@@ -14,16 +14,17 @@ type IoTDeviceTwinToAgentSchemaDefinitions interface{}
 
 // Device
 type Device struct {
-	Brand       string         `json:"brand,omitempty"`
-	Created     time.Time      `json:"created,omitempty"`
-	DeviceId    string         `json:"deviceId,omitempty"`
-	DeviceKey   string         `json:"deviceKey,omitempty"`
-	LastRefresh time.Time      `json:"lastRefresh,omitempty"`
-	Model       string         `json:"model,omitempty"`
-	OrgId       string         `json:"orgId,omitempty"`
-	Serial      string         `json:"serial,omitempty"`
-	Store       string         `json:"store,omitempty"`
-	Version     *DeviceVersion `json:"version,omitempty"`
+	Brand           string         `json:"brand,omitempty"`
+	Created         time.Time      `json:"created,omitempty"`
+	DeviceId        string         `json:"deviceId,omitempty"`
+	DeviceKey       string         `json:"deviceKey,omitempty"`
+	LastRefresh     time.Time      `json:"lastRefresh,omitempty"`
+	Model           string         `json:"model,omitempty"`
+	OrgId           string         `json:"orgId,omitempty"`
+	ProtocolVersion int            `json:"protocolVersion,omitempty"`
+	Serial          string         `json:"serial,omitempty"`
+	Store           string         `json:"store,omitempty"`
+	Version         *DeviceVersion `json:"version,omitempty"`
 }
 
 // DeviceSnap
@@ -123,8 +124,9 @@ type ServiceStatus struct {
 
 // SubscribeAction
 type SubscribeAction struct {
-	Action string `json:"action,omitempty"`
-	Data   string `json:"data,omitempty"`
-	Id     string `json:"id,omitempty"`
-	Snap   string `json:"snap,omitempty"`
+	Action  string `json:"action,omitempty"`
+	Data    string `json:"data,omitempty"`
+	Id      string `json:"id,omitempty"`
+	Snap    string `json:"snap,omitempty"`
+	Version string `json:"version,omitempty"`
 }
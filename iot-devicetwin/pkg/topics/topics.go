@@ -0,0 +1,137 @@
+// Package topics describes the MQTT topic layout used to talk to devices. The same
+// layout is used to build subscription filters, parse incoming topics and build the
+// topics that commands are published on.
+//
+// Templates are slash separated and may contain the placeholders {org} and {device}.
+// For backwards compatibility a bare "+" segment is treated as {device}.
+package topics
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// OrgPlaceholder is replaced by the organization ID
+	OrgPlaceholder = "{org}"
+	// DevicePlaceholder is replaced by the device ID (or serial for required-install)
+	DevicePlaceholder = "{device}"
+
+	wildcard  = "+"
+	separator = "/"
+)
+
+// Default templates, matching the topics devices have always used
+const (
+	DefaultHealth          = "devices/health/{device}"
+	DefaultPub             = "devices/pub/{device}"
+	DefaultSub             = "devices/sub/{device}"
+	DefaultRequiredInstall = "devices/actions/{device}/required-install"
+)
+
+// Layout is the set of topic templates. An empty field falls back to its default.
+type Layout struct {
+	// Prefix is prepended to every topic, e.g. orgs/{org}
+	Prefix          string
+	Health          string
+	Pub             string
+	Sub             string
+	RequiredInstall string
+}
+
+// HealthFilter returns the subscription filter for device health messages
+func (l Layout) HealthFilter() string {
+	return filter(l.template(l.Health, DefaultHealth))
+}
+
+// PubFilter returns the subscription filter for device action responses
+func (l Layout) PubFilter() string {
+	return filter(l.template(l.Pub, DefaultPub))
+}
+
+// SubTopic returns the topic to publish actions for a device on
+func (l Layout) SubTopic(orgID, deviceID string) string {
+	return expand(l.template(l.Sub, DefaultSub), orgID, deviceID)
+}
+
+// RequiredInstallTopic returns the topic to publish required snap installs for a device on
+func (l Layout) RequiredInstallTopic(orgID, serial string) string {
+	return expand(l.template(l.RequiredInstall, DefaultRequiredInstall), orgID, serial)
+}
+
+// ParseHealth extracts the organization and device IDs from a health topic. The
+// organization ID is empty if the layout does not include it.
+func (l Layout) ParseHealth(topic string) (string, string, error) {
+	return parse(l.template(l.Health, DefaultHealth), topic)
+}
+
+// ParsePub extracts the organization and device IDs from an action response topic
+func (l Layout) ParsePub(topic string) (string, string, error) {
+	return parse(l.template(l.Pub, DefaultPub), topic)
+}
+
+func (l Layout) template(tmpl, def string) string {
+	if len(tmpl) == 0 {
+		tmpl = def
+	}
+
+	prefix := strings.Trim(l.Prefix, separator)
+	if len(prefix) == 0 {
+		return tmpl
+	}
+
+	return prefix + separator + strings.TrimPrefix(tmpl, separator)
+}
+
+func isDevice(segment string) bool {
+	return segment == DevicePlaceholder || segment == wildcard
+}
+
+func filter(tmpl string) string {
+	parts := strings.Split(tmpl, separator)
+	for i, p := range parts {
+		if p == OrgPlaceholder || p == DevicePlaceholder {
+			parts[i] = wildcard
+		}
+	}
+	return strings.Join(parts, separator)
+}
+
+func expand(tmpl, orgID, deviceID string) string {
+	parts := strings.Split(tmpl, separator)
+	for i, p := range parts {
+		switch {
+		case p == OrgPlaceholder:
+			parts[i] = orgID
+		case isDevice(p):
+			parts[i] = deviceID
+		}
+	}
+	return strings.Join(parts, separator)
+}
+
+// parse only looks at the placeholder positions; the broker only delivers topics
+// that match the subscription filter so the literal segments are not re-checked.
+func parse(tmpl, topic string) (string, string, error) {
+	tmplParts := strings.Split(tmpl, separator)
+	parts := strings.Split(topic, separator)
+	if len(parts) != len(tmplParts) {
+		return "", "", fmt.Errorf("topic %s: expected %d parts, got %d", topic, len(tmplParts), len(parts))
+	}
+
+	var orgID, deviceID string
+	for i, p := range tmplParts {
+		switch {
+		case p == OrgPlaceholder:
+			orgID = parts[i]
+		case isDevice(p):
+			deviceID = parts[i]
+		}
+	}
+
+	if len(deviceID) == 0 {
+		return "", "", fmt.Errorf("topic %s: no device ID found for template %s", topic, tmpl)
+	}
+
+	return orgID, deviceID, nil
+}
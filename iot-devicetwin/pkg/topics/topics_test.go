@@ -0,0 +1,75 @@
+package topics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayout_Filters(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout Layout
+		health string
+		pub    string
+	}{
+		{"defaults", Layout{}, "devices/health/+", "devices/pub/+"},
+		{"legacy-wildcard", Layout{Health: "devices/health/+", Pub: "devices/pub/+"}, "devices/health/+", "devices/pub/+"},
+		{"org-prefix", Layout{Prefix: "orgs/{org}/"}, "orgs/+/devices/health/+", "orgs/+/devices/pub/+"},
+		{"custom", Layout{Health: "{org}/hb/{device}", Pub: "{org}/resp/{device}"}, "+/hb/+", "+/resp/+"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.health, tt.layout.HealthFilter())
+			assert.Equal(t, tt.pub, tt.layout.PubFilter())
+		})
+	}
+}
+
+func TestLayout_PublishTopics(t *testing.T) {
+	tests := []struct {
+		name            string
+		layout          Layout
+		sub             string
+		requiredInstall string
+	}{
+		{"defaults", Layout{}, "devices/sub/d1", "devices/actions/d1/required-install"},
+		{"org-prefix", Layout{Prefix: "orgs/{org}"}, "orgs/abc/devices/sub/d1", "orgs/abc/devices/actions/d1/required-install"},
+		{"custom", Layout{Sub: "cmd/{org}/{device}", RequiredInstall: "install/{device}"}, "cmd/abc/d1", "install/d1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.sub, tt.layout.SubTopic("abc", "d1"))
+			assert.Equal(t, tt.requiredInstall, tt.layout.RequiredInstallTopic("abc", "d1"))
+		})
+	}
+}
+
+func TestLayout_Parse(t *testing.T) {
+	tests := []struct {
+		name     string
+		layout   Layout
+		topic    string
+		orgID    string
+		deviceID string
+		wantErr  bool
+	}{
+		{"defaults", Layout{}, "devices/health/d1", "", "d1", false},
+		{"org-prefix", Layout{Prefix: "orgs/{org}"}, "orgs/abc/devices/health/d1", "abc", "d1", false},
+		{"too-few-parts", Layout{}, "devices/d1", "", "", true},
+		{"prefix-missing", Layout{Prefix: "orgs/{org}"}, "devices/health/d1", "", "", true},
+		{"no-device-placeholder", Layout{Health: "devices/health"}, "devices/health", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orgID, deviceID, err := tt.layout.ParseHealth(tt.topic)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.orgID, orgID)
+			assert.Equal(t, tt.deviceID, deviceID)
+		})
+	}
+}
@@ -19,9 +19,84 @@
 
 package controller
 
-import "github.com/everactive/dmscore/iot-devicetwin/domain"
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/everactive/dmscore/iot-devicetwin/domain"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/actions"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+)
+
+const (
+	// actionFollowUpCheckInterval is how often actions that have timed out waiting on a response are checked for
+	actionFollowUpCheckInterval = 30 * time.Second
+)
 
 // ActionList gets the action log for a device
 func (srv *Service) ActionList(orgID, clientID string) ([]domain.Action, error) {
 	return srv.DeviceTwin.ActionList(orgID, clientID)
 }
+
+// ActionGet fetches an action by its action ID
+func (srv *Service) ActionGet(actionID string) (domain.Action, error) {
+	return srv.DeviceTwin.ActionGet(actionID)
+}
+
+// ActionResponded requests a snap list from the device if the action it has responded to was marked for one
+func (srv *Service) ActionResponded(clientID, actionID string) error {
+	act, err := srv.DeviceTwin.ActionGet(actionID)
+	if err != nil {
+		return fmt.Errorf("error getting action %s for %s: %w", actionID, clientID, err)
+	}
+
+	if !act.ListOnComplete || len(act.ListActionID) > 0 {
+		return nil
+	}
+
+	return srv.actionListFollowUp(act)
+}
+
+// actionTimeouts requests a snap list for the actions marked for one that have not had a response in time
+func (srv *Service) actionTimeouts() {
+	if srv.actionTimeout <= 0 {
+		return
+	}
+
+	acts, err := srv.DeviceTwin.ActionListAwaitingFollowUp(time.Now().Add(-srv.actionTimeout))
+	if err != nil {
+		log.Errorf("Error listing actions awaiting a snap list: %v", err)
+		return
+	}
+
+	for _, act := range acts {
+		log.Infof("Action %s (%s) on %s timed out, requesting snap list", act.ActionID, act.Action, act.DeviceID)
+		if err := srv.actionListFollowUp(act); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// actionListFollowUp reserves the list action ID on the action, so only one list is sent, then sends it
+func (srv *Service) actionListFollowUp(act domain.Action) error {
+	listActionID := generateKSUID().String()
+
+	linked, err := srv.DeviceTwin.ActionListFollowUp(act.ActionID, listActionID)
+	if err != nil {
+		return fmt.Errorf("error linking snap list to action %s: %w", act.ActionID, err)
+	}
+
+	if !linked {
+		// Already followed up
+		return nil
+	}
+
+	list := messages.SubscribeAction{
+		Id:     listActionID,
+		Action: actions.List,
+	}
+	_, err = srv.deviceSnapAction(act.OrganizationID, act.DeviceID, list)
+	return err
+}
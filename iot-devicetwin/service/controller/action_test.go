@@ -0,0 +1,113 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Device Twin Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/iot-devicetwin/domain"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/actions"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/iot-devicetwin/service/devicetwin"
+	"github.com/everactive/dmscore/iot-devicetwin/service/mqtt"
+	ksuid2 "github.com/segmentio/ksuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_ActionResponded(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   domain.Action
+		getErr   error
+		linked   bool
+		wantList bool
+		wantErr  bool
+	}{
+		{"list-on-complete", domain.Action{ActionID: "act1", Action: actions.Install, ListOnComplete: true}, nil, true, true, false},
+		{"already-followed-up", domain.Action{ActionID: "act1", Action: actions.Install, ListOnComplete: true}, nil, false, false, false},
+		{"already-linked", domain.Action{ActionID: "act1", Action: actions.Install, ListOnComplete: true, ListActionID: "list1"}, nil, false, false, false},
+		{"no-list", domain.Action{ActionID: "act1", Action: actions.Conf}, nil, false, false, false},
+		{"not-found", domain.Action{}, errors.New("not found"), false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.action.OrganizationID = "abc"
+			tt.action.DeviceID = "a111"
+
+			ksuid := ksuid2.New()
+			generateKSUID = func() ksuid2.KSUID {
+				return ksuid
+			}
+
+			list := messages.SubscribeAction{Id: ksuid.String(), Action: actions.List}
+
+			deviceTwin := &devicetwin.MockDeviceTwin{}
+			deviceTwin.On("ActionGet", tt.action.ActionID).Return(tt.action, tt.getErr)
+			deviceTwin.On("ActionListFollowUp", tt.action.ActionID, ksuid.String()).Return(tt.linked, nil)
+			deviceTwin.On("DeviceGet", "abc", "a111").Return(messages.Device{OrgId: "abc", DeviceId: "a111"}, nil)
+			deviceTwin.On("ActionCreate", "abc", "a111", list, false).Return(nil)
+
+			publishChan := make(chan mqtt.PublishMessage, 1)
+			srv := Service{DeviceTwin: deviceTwin, publishChan: publishChan}
+
+			err := srv.ActionResponded("a111", tt.action.ActionID)
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			if tt.wantList {
+				deviceTwin.AssertCalled(t, "ActionCreate", "abc", "a111", list, false)
+				assert.Len(t, publishChan, 1)
+			} else {
+				deviceTwin.AssertNotCalled(t, "ActionCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				assert.Len(t, publishChan, 0)
+			}
+		})
+	}
+}
+
+func TestService_actionTimeouts(t *testing.T) {
+	ksuid := ksuid2.New()
+	generateKSUID = func() ksuid2.KSUID {
+		return ksuid
+	}
+
+	timedOut := domain.Action{OrganizationID: "abc", DeviceID: "a111", ActionID: "act1", Action: actions.Install, ListOnComplete: true}
+	list := messages.SubscribeAction{Id: ksuid.String(), Action: actions.List}
+
+	deviceTwin := &devicetwin.MockDeviceTwin{}
+	deviceTwin.On("ActionListAwaitingFollowUp", mock.AnythingOfType("time.Time")).Return([]domain.Action{timedOut}, nil)
+	deviceTwin.On("ActionListFollowUp", "act1", ksuid.String()).Return(true, nil)
+	deviceTwin.On("DeviceGet", "abc", "a111").Return(messages.Device{OrgId: "abc", DeviceId: "a111"}, nil)
+	deviceTwin.On("ActionCreate", "abc", "a111", list, false).Return(nil)
+
+	publishChan := make(chan mqtt.PublishMessage, 1)
+
+	// No timeout configured, nothing is checked
+	srv := Service{DeviceTwin: deviceTwin, publishChan: publishChan}
+	srv.actionTimeouts()
+	deviceTwin.AssertNotCalled(t, "ActionListAwaitingFollowUp", mock.Anything)
+
+	srv.actionTimeout = time.Minute
+	srv.actionTimeouts()
+	deviceTwin.AssertCalled(t, "ActionCreate", "abc", "a111", list, false)
+	assert.Len(t, publishChan, 1)
+}
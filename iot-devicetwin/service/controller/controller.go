@@ -24,7 +24,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"gorm.io/gorm"
-	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -32,6 +31,7 @@ import (
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/actions"
 
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/topics"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"github.com/everactive/dmscore/iot-devicetwin/domain"
@@ -55,8 +55,14 @@ type Controller interface {
 	DeviceSnaps(orgID, clientID string) ([]messages.DeviceSnap, error)
 	DeviceList(orgID string) ([]messages.Device, error)
 	DeviceDelete(deviceID string) error
+	DeviceTransfer(deviceID, orgID string) error
+	DeviceGroupsUnlink(deviceID string) ([]string, error)
+	DeviceListDeleted(orgID string) ([]messages.Device, error)
+	DeviceRestore(orgID, deviceID string) error
+
+	Purge(policy domain.RetentionPolicy, dryRun bool) (domain.RetentionReport, error)
 	DeviceGet(orgID, clientID string) (messages.Device, error)
-	DeviceLogs(orgID, clientID string, logData *messages.DeviceLogs) error
+	DeviceLogs(orgID, clientID string, logData *messages.DeviceLogs) (string, error)
 	GroupCreate(orgID, name string) error
 	GroupList(orgID string) ([]domain.Group, error)
 	GroupGet(orgID, name string) (domain.Group, error)
@@ -66,24 +72,23 @@ type Controller interface {
 	GroupGetExcludedDevices(orgID, name string) ([]messages.Device, error)
 
 	// Actions on a device
-	DeviceSnapList(orgID, clientID string) error
-	DeviceSnapInstall(orgID, clientID, snap string) error
-	DeviceSnapServiceAction(orgID, clientID, snap, action string, services *messages.SnapService) error
-	DeviceSnapRemove(orgID, clientID, snap string) error
-	DeviceSnapUpdate(orgID, clientID, snap, action string, snapUpdate *messages.SnapUpdate) error
-	DeviceSnapConf(orgID, clientID, snap, settings string) error
-	DeviceSnapSnapshot(orgID, clientID, snap string, s3data *messages.SnapSnapshot) error
+	DeviceSnapList(orgID, clientID string) (string, error)
+	DeviceSnapInstall(orgID, clientID, snap string) (string, error)
+	DeviceSnapServiceAction(orgID, clientID, snap, action string, services *messages.SnapService) (string, error)
+	DeviceSnapRemove(orgID, clientID, snap string) (string, error)
+	DeviceSnapUpdate(orgID, clientID, snap, action string, snapUpdate *messages.SnapUpdate) (string, error)
+	DeviceSnapConf(orgID, clientID, snap, settings string) (string, error)
+	DeviceSnapSnapshot(orgID, clientID, snap string, s3data *messages.SnapSnapshot) (string, error)
+	DeviceUnregister(orgID, clientID string) (string, error)
 	ActionList(orgID, clientID string) ([]domain.Action, error)
-	User(orgID, clientID string, user messages.DeviceUser) error
+	ActionGet(actionID string) (domain.Action, error)
+	ActionResponded(clientID, actionID string) error
+	User(orgID, clientID string, user messages.DeviceUser) (string, error)
 }
 
-const (
-	clientIDMQTTTopicPartsCount = 4
-)
-
 // Unscoped gets an Unscoped instance of the service for accessing (soft) deleted data
 func (srv *Service) Unscoped() UnscopedController {
-	return &Service{DeviceTwin: srv.DeviceTwin, unscoped: true}
+	return &Service{DeviceTwin: srv.DeviceTwin, unscoped: true, topics: srv.topics, actionTimeout: srv.actionTimeout}
 }
 
 // Service implementation of the devicetwin service use cases
@@ -93,15 +98,20 @@ type Service struct {
 	healthChan  <-chan MQTT.Message
 	actionChan  <-chan MQTT.Message
 	publishChan chan<- mqtt.PublishMessage
+	topics      topics.Layout
+	// actionTimeout is how long to wait on a response to an action before following up with a snap list
+	actionTimeout time.Duration
 }
 
 // NewService creates an implementation of the devicetwin use cases
-func NewService(healthChan chan MQTT.Message, actionChan <-chan MQTT.Message, publishChan chan<- mqtt.PublishMessage, twin devicetwin.DeviceTwin) *Service {
+func NewService(healthChan chan MQTT.Message, actionChan <-chan MQTT.Message, publishChan chan<- mqtt.PublishMessage, twin devicetwin.DeviceTwin, layout topics.Layout, actionTimeout time.Duration) *Service {
 	srv := &Service{
-		DeviceTwin:  twin,
-		healthChan:  healthChan,
-		actionChan:  actionChan,
-		publishChan: publishChan,
+		DeviceTwin:    twin,
+		healthChan:    healthChan,
+		actionChan:    actionChan,
+		publishChan:   publishChan,
+		topics:        layout,
+		actionTimeout: actionTimeout,
 	}
 
 	return srv
@@ -109,6 +119,7 @@ func NewService(healthChan chan MQTT.Message, actionChan <-chan MQTT.Message, pu
 
 func (srv *Service) Serve(ctx context.Context) error {
 	intervalTicker := time.NewTicker(60 * time.Second)
+	followUpTicker := time.NewTicker(actionFollowUpCheckInterval)
 
 	for {
 		select {
@@ -117,6 +128,8 @@ func (srv *Service) Serve(ctx context.Context) error {
 			return nil
 		case <-intervalTicker.C:
 			log.Infof("%s still ticking", "DeviceTwinControllerService")
+		case <-followUpTicker.C:
+			srv.actionTimeouts()
 		case a := <-srv.actionChan:
 			log.Infof("Processing action channel message: %s", string(a.Payload()))
 			srv.ActionHandler(a)
@@ -131,7 +144,7 @@ func (srv *Service) Serve(ctx context.Context) error {
 
 // ActionHandler is the handler for the main subscription topic
 func (srv *Service) ActionHandler(msg MQTT.Message) {
-	clientID := getClientID(msg)
+	_, clientID := getClientID(msg, srv.topics.ParsePub)
 	log.Printf("Action response from %s", clientID)
 
 	// Parse the body
@@ -155,7 +168,7 @@ func (srv *Service) ActionHandler(msg MQTT.Message) {
 
 // HealthHandler is the handler for the devices health messages
 func (srv *Service) HealthHandler(msg MQTT.Message) {
-	clientID := getClientID(msg)
+	orgID, clientID := getClientID(msg, srv.topics.ParseHealth)
 	log.Printf("Health update from %s", clientID)
 
 	// Parse the body
@@ -171,6 +184,12 @@ func (srv *Service) HealthHandler(msg MQTT.Message) {
 		return
 	}
 
+	// If the topic layout carries the organization, it has to match as well
+	if len(orgID) > 0 && orgID != h.OrgId {
+		log.Printf("Organization ID mismatch: %s and %s", orgID, h.OrgId)
+		return
+	}
+
 	// Check to make sure it's not a device we've deleted (soft)
 	// If it isn't then we can handle it even if we don't know about the device yet (expected)
 	device, isDeleted, err := srv.Unscoped().DeviceGetByID(clientID)
@@ -198,7 +217,7 @@ func (srv *Service) HealthHandler(msg MQTT.Message) {
 	act := messages.SubscribeAction{
 		Action: actions.Device,
 	}
-	if err := srv.triggerActionOnDevice(h.OrgId, h.DeviceId, act); err != nil {
+	if err := srv.triggerActionOnDevice(h.OrgId, h.DeviceId, act, false); err != nil {
 		log.Printf("Triggering action: %v", err)
 	}
 
@@ -206,28 +225,31 @@ func (srv *Service) HealthHandler(msg MQTT.Message) {
 	act = messages.SubscribeAction{
 		Action: actions.List,
 	}
-	if err := srv.triggerActionOnDevice(h.OrgId, h.DeviceId, act); err != nil {
+	if err := srv.triggerActionOnDevice(h.OrgId, h.DeviceId, act, false); err != nil {
 		log.Printf("Triggering action: %v", err)
 	}
 }
 
-// getClientID sets the client ID from the topic
-func getClientID(msg MQTT.Message) string {
-	parts := strings.Split(msg.Topic(), "/")
-	if len(parts) != clientIDMQTTTopicPartsCount-1 {
-		log.Printf("Error in health message: expected 4 parts, got %d", len(parts))
-		return ""
+// getClientID gets the organization (if the topic layout has one) and client ID from the topic
+func getClientID(msg MQTT.Message, parse func(string) (string, string, error)) (string, string) {
+	orgID, clientID, err := parse(msg.Topic())
+	if err != nil {
+		log.Printf("Error in message topic: %v", err)
+		return "", ""
 	}
-	return parts[2]
+	return orgID, clientID
 }
 
 var generateKSUID = ksuid.New
 
-// triggerActionOnDevice triggers an action on the device via MQTT
-func (srv *Service) triggerActionOnDevice(orgID, deviceID string, act messages.SubscribeAction) error {
-	// Generate a request ID
-	id := generateKSUID()
-	act.Id = id.String()
+// triggerActionOnDevice triggers an action on the device via MQTT, listOnComplete requests a snap list
+// from the device after it responds to the action
+func (srv *Service) triggerActionOnDevice(orgID, deviceID string, act messages.SubscribeAction, listOnComplete bool) error {
+	// Generate a request ID, unless one was already reserved for the action
+	if len(act.Id) == 0 {
+		id := generateKSUID()
+		act.Id = id.String()
+	}
 
 	// Serialize the action
 	data, err := serializePayload(act)
@@ -237,7 +259,7 @@ func (srv *Service) triggerActionOnDevice(orgID, deviceID string, act messages.S
 	}
 
 	// Publish the request
-	t := fmt.Sprintf("devices/sub/%s", deviceID)
+	t := srv.topics.SubTopic(orgID, deviceID)
 	pubMessage := mqtt.PublishMessage{Topic: t, Payload: string(data)}
 	log.Infof("Triggering action on device, sending pubMessage: %s", string(data))
 	srv.publishChan <- pubMessage
@@ -247,7 +269,7 @@ func (srv *Service) triggerActionOnDevice(orgID, deviceID string, act messages.S
 	}
 
 	// Log the request
-	return srv.DeviceTwin.ActionCreate(orgID, deviceID, act)
+	return srv.DeviceTwin.ActionCreate(orgID, deviceID, act, listOnComplete)
 }
 
 func serializePayload(act messages.SubscribeAction) ([]byte, error) {
@@ -26,6 +26,7 @@ import (
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/actions"
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/topics"
 	"github.com/everactive/dmscore/iot-devicetwin/service/devicetwin"
 	"github.com/everactive/dmscore/iot-devicetwin/service/mqtt"
 	ksuid2 "github.com/segmentio/ksuid"
@@ -135,7 +136,7 @@ func TestService_HealthHandler(t *testing.T) {
 			}
 
 			deviceTwin.On("HealthHandler", messages.Health{DeviceId: tt.args.deviceID, OrgId: tt.args.orgID}).Return(errors.New("some error"))
-			deviceTwin.On("ActionCreate", tt.args.orgID, tt.args.deviceID, act).Return(nil)
+			deviceTwin.On("ActionCreate", tt.args.orgID, tt.args.deviceID, act, false).Return(nil)
 
 			go func() {
 				srv.HealthHandler(tt.args.msg)
@@ -175,10 +176,11 @@ func Test_getClientID(t *testing.T) {
 		want string
 	}{
 		{"valid", args{&mqtt.ManualMockMessage{}}, "aa111"},
+		{"invalid", args{&mqtt.ManualMockMessage{TopicPath: "device/pub"}}, ""},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := getClientID(tt.args.msg); got != tt.want {
+			if _, got := getClientID(tt.args.msg, topics.Layout{}.ParsePub); got != tt.want {
 				t.Errorf("getClientID() = %v, want %v", got, tt.want)
 			}
 		})
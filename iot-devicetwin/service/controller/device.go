@@ -21,6 +21,7 @@ package controller
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/actions"
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
@@ -47,6 +48,54 @@ func (srv *Service) DeviceDelete(deviceID string) error {
 	return err
 }
 
+// DeviceTransfer moves a device to another organization
+func (srv *Service) DeviceTransfer(deviceID, orgID string) error {
+	return srv.DeviceTwin.DeviceTransfer(deviceID, orgID)
+}
+
+// DeviceGroupsUnlink removes the device from its groups, returning the names of the groups
+func (srv *Service) DeviceGroupsUnlink(deviceID string) ([]string, error) {
+	return srv.DeviceTwin.DeviceGroupsUnlink(deviceID)
+}
+
+// DeviceListDeleted gets the soft deleted devices of an organization
+func (srv *Service) DeviceListDeleted(orgID string) ([]messages.Device, error) {
+	return srv.DeviceTwin.DeviceListDeleted(orgID)
+}
+
+// DeviceRestore restores a soft deleted device, so that its messages are handled again. The device is asked
+// for its details and snaps, as they may have changed since it was deleted.
+func (srv *Service) DeviceRestore(orgID, deviceID string) error {
+	device, isDeleted, err := srv.DeviceTwin.Unscoped().DeviceGetByID(deviceID)
+	if err != nil || !isDeleted || device.OrgId != orgID {
+		return fmt.Errorf("cannot find deleted device `%s` in the organization", deviceID)
+	}
+
+	if err = srv.DeviceTwin.DeviceRestore(deviceID); err != nil {
+		return err
+	}
+
+	for _, a := range []string{actions.Device, actions.List} {
+		if err = srv.triggerActionOnDevice(device.OrgId, device.DeviceId, messages.SubscribeAction{Action: a}, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeviceUnregister asks the device to unregister from the service, returning the ID of the action
+// to follow its response
+func (srv *Service) DeviceUnregister(orgID, clientID string) (string, error) {
+	act := messages.SubscribeAction{
+		Id:     generateKSUID().String(),
+		Action: actions.Unregister,
+	}
+	if err := srv.deviceAction(orgID, clientID, act); err != nil {
+		return "", err
+	}
+	return act.Id, nil
+}
+
 // deviceSnapAction triggers a device action on a device
 func (srv *Service) deviceAction(orgID, clientID string, action messages.SubscribeAction) error {
 	// Validate the org and device ID
@@ -55,8 +104,9 @@ func (srv *Service) deviceAction(orgID, clientID string, action messages.Subscri
 		return err
 	}
 
-	// Trigger the action on the device
-	err = srv.triggerActionOnDevice(device.OrgId, device.DeviceId, action)
+	// Trigger the action on the device, in the newest message version it understands
+	action.Version = actions.Version(action.Action, device.ProtocolVersion)
+	err = srv.triggerActionOnDevice(device.OrgId, device.DeviceId, action, false)
 	if err != nil {
 		return err
 	}
@@ -64,10 +114,10 @@ func (srv *Service) deviceAction(orgID, clientID string, action messages.Subscri
 }
 
 // DeviceLogs triggers an upload of snapd logs to S3
-func (srv *Service) DeviceLogs(orgID, clientID string, logData *messages.DeviceLogs) error {
+func (srv *Service) DeviceLogs(orgID, clientID string, logData *messages.DeviceLogs) (string, error) {
 	jsonBytes, err := json.Marshal(logData)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	act := messages.SubscribeAction{
@@ -21,6 +21,7 @@ package controller
 
 import (
 	"github.com/everactive/dmscore/iot-devicetwin/service/mqtt"
+	"strings"
 	"sync"
 	"testing"
 
@@ -97,7 +98,7 @@ func TestService_DeviceLogs(t *testing.T) {
 	wg.Add(1)
 	var err error
 	go func() {
-		err = srv.DeviceLogs("abc", "a111", validLogData)
+		_, err = srv.DeviceLogs("abc", "a111", validLogData)
 		wg.Done()
 	}()
 
@@ -109,3 +110,87 @@ func TestService_DeviceLogs(t *testing.T) {
 		return
 	}
 }
+
+func TestService_DeviceUnregister(t *testing.T) {
+	publishChan := make(chan mqtt.PublishMessage)
+	srv := Service{DeviceTwin: &devicetwin.ManualMockDeviceTwin{}, publishChan: publishChan}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var (
+		actionID string
+		err      error
+	)
+	go func() {
+		actionID, err = srv.DeviceUnregister("abc", "a111")
+		wg.Done()
+	}()
+
+	msg := <-publishChan
+
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("Service.DeviceUnregister() got unexpected error = %v", err)
+	}
+	if len(actionID) == 0 || !strings.Contains(msg.Payload, actionID) {
+		t.Errorf("Service.DeviceUnregister() action ID `%s` not in the message: %s", actionID, msg.Payload)
+	}
+	if !strings.Contains(msg.Payload, `"action":"unregister"`) {
+		t.Errorf("Service.DeviceUnregister() message is not an unregister action: %s", msg.Payload)
+	}
+
+	if _, err = srv.DeviceUnregister("abc", "invalid"); err == nil {
+		t.Error("Service.DeviceUnregister() expected error for an unknown device")
+	}
+}
+
+func TestService_DeviceGroupsUnlink(t *testing.T) {
+	srv := Service{DeviceTwin: &devicetwin.ManualMockDeviceTwin{}}
+
+	got, err := srv.DeviceGroupsUnlink("a111")
+	if err != nil || len(got) != 1 {
+		t.Errorf("Service.DeviceGroupsUnlink() = %v, %v", got, err)
+	}
+	if _, err = srv.DeviceGroupsUnlink("invalid"); err == nil {
+		t.Error("Service.DeviceGroupsUnlink() expected error")
+	}
+}
+
+func TestService_DeviceRestore(t *testing.T) {
+	tests := []struct {
+		name      string
+		orgID     string
+		deviceID  string
+		isDeleted bool
+		wantErr   bool
+	}{
+		{"valid", "abc", "c333", true, false},
+		{"invalid-not-deleted", "abc", "c333", false, true},
+		{"invalid-organization", "def", "c333", true, true},
+		{"invalid-restore", "abc", "invalid", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publishChan := make(chan mqtt.PublishMessage, 2)
+			srv := Service{DeviceTwin: &devicetwin.ManualMockDeviceTwin{ReturnSoftDeletedDevice: tt.isDeleted}, publishChan: publishChan}
+
+			err := srv.DeviceRestore(tt.orgID, tt.deviceID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Service.DeviceRestore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(publishChan) != 0 {
+					t.Errorf("Service.DeviceRestore() sent %d actions, want none", len(publishChan))
+				}
+				return
+			}
+
+			for _, action := range []string{"device", "list"} {
+				msg := <-publishChan
+				if !strings.Contains(msg.Payload, `"action":"`+action+`"`) {
+					t.Errorf("Service.DeviceRestore() message is not a %s action: %s", action, msg.Payload)
+				}
+			}
+		})
+	}
+}
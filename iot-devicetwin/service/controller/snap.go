@@ -23,7 +23,6 @@ package controller
 import (
 	"encoding/json"
 	"fmt"
-	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -31,17 +30,13 @@ import (
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
 )
 
-const (
-	snapActionDelay = 10 * time.Second
-)
-
 // DeviceSnaps gets the device's snaps from the database cache
 func (srv *Service) DeviceSnaps(orgID, clientID string) ([]messages.DeviceSnap, error) {
 	return srv.DeviceTwin.DeviceSnaps(orgID, clientID)
 }
 
 // DeviceSnapList triggers listing snaps on a device
-func (srv *Service) DeviceSnapList(orgID, clientID string) error {
+func (srv *Service) DeviceSnapList(orgID, clientID string) (string, error) {
 	act := messages.SubscribeAction{
 		Action: actions.List,
 	}
@@ -49,16 +44,16 @@ func (srv *Service) DeviceSnapList(orgID, clientID string) error {
 }
 
 // DeviceSnapServiceAction triggers stop,`start, or restart for a snap on a device
-func (srv *Service) DeviceSnapServiceAction(orgID, clientID, snap, action string, services *messages.SnapService) error {
+func (srv *Service) DeviceSnapServiceAction(orgID, clientID, snap, action string, services *messages.SnapService) (string, error) {
 	switch action {
 	case actions.Start, actions.Stop, actions.Restart:
 	default:
-		return fmt.Errorf("invalid snap service action `%s`", action)
+		return "", fmt.Errorf("invalid snap service action `%s`", action)
 	}
 
 	jsonBytes, err := json.Marshal(services)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	act := messages.SubscribeAction{
@@ -70,10 +65,10 @@ func (srv *Service) DeviceSnapServiceAction(orgID, clientID, snap, action string
 }
 
 // DeviceSnapSnapshot triggers uploading a snapshot of a snap on a device to S3
-func (srv *Service) DeviceSnapSnapshot(orgID, clientID, snap string, snapshotData *messages.SnapSnapshot) error {
+func (srv *Service) DeviceSnapSnapshot(orgID, clientID, snap string, snapshotData *messages.SnapSnapshot) (string, error) {
 	jsonBytes, err := json.Marshal(snapshotData)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	act := messages.SubscribeAction{
@@ -86,7 +81,7 @@ func (srv *Service) DeviceSnapSnapshot(orgID, clientID, snap string, snapshotDat
 }
 
 // DeviceSnapInstall triggers installing a snap on a device
-func (srv *Service) DeviceSnapInstall(orgID, clientID, snap string) error {
+func (srv *Service) DeviceSnapInstall(orgID, clientID, snap string) (string, error) {
 	act := messages.SubscribeAction{
 		Action: actions.Install,
 		Snap:   snap,
@@ -95,7 +90,7 @@ func (srv *Service) DeviceSnapInstall(orgID, clientID, snap string) error {
 }
 
 // DeviceSnapRemove triggers uninstalling a snap on a device
-func (srv *Service) DeviceSnapRemove(orgID, clientID, snap string) error {
+func (srv *Service) DeviceSnapRemove(orgID, clientID, snap string) (string, error) {
 	act := messages.SubscribeAction{
 		Action: actions.Remove,
 		Snap:   snap,
@@ -104,14 +99,14 @@ func (srv *Service) DeviceSnapRemove(orgID, clientID, snap string) error {
 }
 
 // DeviceSnapUpdate triggers a snap update on a device
-func (srv *Service) DeviceSnapUpdate(orgID, clientID, snap, action string, snapUpdate *messages.SnapUpdate) error {
+func (srv *Service) DeviceSnapUpdate(orgID, clientID, snap, action string, snapUpdate *messages.SnapUpdate) (string, error) {
 
 	log.Tracef("Action: %s", action)
 
 	switch action {
 	case actions.Switch:
 		if snapUpdate == nil {
-			return fmt.Errorf("invalid update action `%s`, no channel specified", action)
+			return "", fmt.Errorf("invalid update action `%s`, no channel specified", action)
 		}
 
 		act := messages.SubscribeAction{
@@ -129,12 +124,12 @@ func (srv *Service) DeviceSnapUpdate(orgID, clientID, snap, action string, snapU
 
 		return srv.deviceSnapAction(orgID, clientID, act)
 	default:
-		return fmt.Errorf("invalid update action `%s`", action)
+		return "", fmt.Errorf("invalid update action `%s`", action)
 	}
 }
 
 // DeviceSnapConf triggers a snap settings update on a device
-func (srv *Service) DeviceSnapConf(orgID, clientID, snap, settings string) error {
+func (srv *Service) DeviceSnapConf(orgID, clientID, snap, settings string) (string, error) {
 	// Trigger the update settings action on the device
 	act := messages.SubscribeAction{
 		Action: actions.SetConf,
@@ -144,26 +139,24 @@ func (srv *Service) DeviceSnapConf(orgID, clientID, snap, settings string) error
 	return srv.deviceSnapAction(orgID, clientID, act)
 }
 
-// deviceSnapAction triggers a snap action on a device
-func (srv *Service) deviceSnapAction(orgID, clientID string, action messages.SubscribeAction) error {
+// deviceSnapAction triggers a snap action on a device, returning the ID of the action
+func (srv *Service) deviceSnapAction(orgID, clientID string, action messages.SubscribeAction) (string, error) {
 	// Validate the org and device ID
 	device, err := srv.DeviceTwin.DeviceGet(orgID, clientID)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	// Trigger the action on the device
-	err = srv.triggerActionOnDevice(device.OrgId, device.DeviceId, action)
-	if err != nil {
-		return err
+	if len(action.Id) == 0 {
+		action.Id = generateKSUID().String()
 	}
 
-	// State of the snaps has changed, so request a snap list
-	if action.Action != actions.List {
-		// Request the list action after a few seconds
-		time.AfterFunc(snapActionDelay, func() {
-			_ = srv.DeviceSnapList(orgID, clientID)
-		})
+	// Trigger the action on the device, in the newest message version it understands.
+	// If the state of the snaps will change, a snap list is requested once the device responds
+	// (or the action times out)
+	action.Version = actions.Version(action.Action, device.ProtocolVersion)
+	if err := srv.triggerActionOnDevice(device.OrgId, device.DeviceId, action, action.Action != actions.List); err != nil {
+		return "", err
 	}
-	return err
+	return action.Id, nil
 }
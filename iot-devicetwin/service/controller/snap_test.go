@@ -74,7 +74,7 @@ func TestService_DeviceSnapInstall(t *testing.T) {
 			publishChan := make(chan mqtt.PublishMessage)
 			srv := Service{DeviceTwin: &devicetwin.ManualMockDeviceTwin{}, publishChan: publishChan}
 			go func() {
-				if err := srv.DeviceSnapInstall(tt.args.orgID, tt.args.clientID, tt.args.snap); (err != nil) != tt.wantErr {
+				if _, err := srv.DeviceSnapInstall(tt.args.orgID, tt.args.clientID, tt.args.snap); (err != nil) != tt.wantErr {
 					t.Errorf("Service.DeviceSnapInstall() error = %v, wantErr %v", err, tt.wantErr)
 				}
 			}()
@@ -103,7 +103,7 @@ func TestService_DeviceSnapRemove(t *testing.T) {
 			srv := Service{DeviceTwin: &devicetwin.ManualMockDeviceTwin{}, publishChan: publishChan}
 
 			go func() {
-				if err := srv.DeviceSnapRemove(tt.args.orgID, tt.args.clientID, tt.args.snap); (err != nil) != tt.wantErr {
+				if _, err := srv.DeviceSnapRemove(tt.args.orgID, tt.args.clientID, tt.args.snap); (err != nil) != tt.wantErr {
 					t.Errorf("Service.DeviceSnapRemove() error = %v, wantErr %v", err, tt.wantErr)
 				}
 			}()
@@ -138,7 +138,7 @@ func TestService_DeviceSnapUpdate(t *testing.T) {
 			var wg sync.WaitGroup
 			wg.Add(1)
 			go func() {
-				if err := srv.DeviceSnapUpdate(tt.args.orgID, tt.args.clientID, tt.args.snap, tt.args.action, tt.args.snapUpdate); (err != nil) != tt.wantErr {
+				if _, err := srv.DeviceSnapUpdate(tt.args.orgID, tt.args.clientID, tt.args.snap, tt.args.action, tt.args.snapUpdate); (err != nil) != tt.wantErr {
 					t.Errorf("Service.DeviceSnapUpdate() error = %v, wantErr %v", err, tt.wantErr)
 				}
 				wg.Done()
@@ -173,7 +173,7 @@ func TestService_DeviceSnapConf(t *testing.T) {
 			srv := Service{DeviceTwin: &devicetwin.ManualMockDeviceTwin{}, publishChan: publishChan}
 
 			go func() {
-				if err := srv.DeviceSnapConf(tt.args.orgID, tt.args.clientID, tt.args.snap, tt.args.settings); (err != nil) != tt.wantErr {
+				if _, err := srv.DeviceSnapConf(tt.args.orgID, tt.args.clientID, tt.args.snap, tt.args.settings); (err != nil) != tt.wantErr {
 					t.Errorf("Service.DeviceSnapConf() error = %v, wantErr %v", err, tt.wantErr)
 				}
 			}()
@@ -201,7 +201,7 @@ func TestService_DeviceSnapList(t *testing.T) {
 			srv := Service{DeviceTwin: &devicetwin.ManualMockDeviceTwin{}, publishChan: publishChan}
 
 			go func() {
-				if err := srv.DeviceSnapList(tt.args.orgID, tt.args.clientID); (err != nil) != tt.wantErr {
+				if _, err := srv.DeviceSnapList(tt.args.orgID, tt.args.clientID); (err != nil) != tt.wantErr {
 					t.Errorf("Service.DeviceSnapList() error = %v, wantErr %v", err, tt.wantErr)
 				}
 			}()
@@ -240,7 +240,7 @@ func TestService_DeviceSnapServiceAction(t *testing.T) {
 			var wg sync.WaitGroup
 			wg.Add(1)
 			go func() {
-				if err := srv.DeviceSnapServiceAction(tt.args.orgID, tt.args.clientID, tt.args.snap, tt.args.action, tt.args.services); (err != nil) != tt.wantErr {
+				if _, err := srv.DeviceSnapServiceAction(tt.args.orgID, tt.args.clientID, tt.args.snap, tt.args.action, tt.args.services); (err != nil) != tt.wantErr {
 					t.Errorf("Service.DeviceSnapServiceAction() error = %v, wantErr %v", err, tt.wantErr)
 				}
 				wg.Done()
@@ -267,7 +267,7 @@ func TestService_DeviceSnapShot(t *testing.T) {
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
-		err = srv.DeviceSnapSnapshot("abc", "a111", "helloworld", validLogData)
+		_, err = srv.DeviceSnapSnapshot("abc", "a111", "helloworld", validLogData)
 		wg.Done()
 	}()
 
@@ -27,10 +27,10 @@ import (
 )
 
 // User sends a user action to the device, which will either add or remove a user.
-func (srv *Service) User(orgID, clientID string, user messages.DeviceUser) error {
+func (srv *Service) User(orgID, clientID string, user messages.DeviceUser) (string, error) {
 	jsonBytes, err := json.Marshal(user)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	act := messages.SubscribeAction{
@@ -55,7 +55,7 @@ func TestService_User(t *testing.T) {
 			var wg sync.WaitGroup
 			wg.Add(1)
 			go func() {
-				if err := srv.User(tt.args.orgID, tt.args.clientID, tt.args.user); (err != nil) != tt.wantErr {
+				if _, err := srv.User(tt.args.orgID, tt.args.clientID, tt.args.user); (err != nil) != tt.wantErr {
 					t.Errorf("Service.User() test: error = %v, wantErr %v", err, tt.wantErr)
 				}
 				wg.Done()
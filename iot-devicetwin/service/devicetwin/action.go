@@ -20,20 +20,23 @@
 package devicetwin
 
 import (
+	"time"
+
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
 
 	"github.com/everactive/dmscore/iot-devicetwin/datastore"
 	"github.com/everactive/dmscore/iot-devicetwin/domain"
 )
 
-// ActionCreate logs an action
-func (srv *Service) ActionCreate(orgID, deviceID string, action messages.SubscribeAction) error {
+// ActionCreate logs an action, listOnComplete marks it to be followed by a snap list
+func (srv *Service) ActionCreate(orgID, deviceID string, action messages.SubscribeAction, listOnComplete bool) error {
 	act := datastore.Action{
 		OrganizationID: orgID,
 		DeviceID:       deviceID,
 		ActionID:       action.Id,
 		Action:         action.Action,
 		Status:         "requested",
+		ListOnComplete: listOnComplete,
 	}
 	_, err := srv.DB.ActionCreate(act)
 	return err
@@ -54,17 +57,53 @@ func (srv *Service) ActionList(orgID, deviceID string) ([]domain.Action, error)
 
 	// Map the database item to the domain item
 	for _, act := range actions {
-		list = append(list, domain.Action{
-			Created:        act.CreatedAt,
-			Modified:       act.UpdatedAt,
-			OrganizationID: act.OrganizationID,
-			DeviceID:       act.DeviceID,
-			ActionID:       act.ActionID,
-			Action:         act.Action,
-			Status:         act.Status,
-			Message:        act.Message,
-		})
+		list = append(list, dataToDomainAction(act))
+	}
+
+	return list, nil
+}
+
+// ActionGet fetches an action by its action ID
+func (srv *Service) ActionGet(actionID string) (domain.Action, error) {
+	act, err := srv.DB.ActionGet(actionID)
+	if err != nil {
+		return domain.Action{}, err
+	}
+
+	return dataToDomainAction(act), nil
+}
+
+// ActionListFollowUp records the snap list action sent after an action, returning false if one already was
+func (srv *Service) ActionListFollowUp(actionID, listActionID string) (bool, error) {
+	return srv.DB.ActionListFollowUp(actionID, listActionID)
+}
+
+// ActionListAwaitingFollowUp lists the actions created before a time that still need a snap list sent after them
+func (srv *Service) ActionListAwaitingFollowUp(before time.Time) ([]domain.Action, error) {
+	list := []domain.Action{}
+	actions, err := srv.DB.ActionListAwaitingFollowUp(before)
+	if err != nil {
+		return list, err
+	}
+
+	for _, act := range actions {
+		list = append(list, dataToDomainAction(act))
 	}
 
 	return list, nil
 }
+
+func dataToDomainAction(act datastore.Action) domain.Action {
+	return domain.Action{
+		Created:        act.CreatedAt,
+		Modified:       act.UpdatedAt,
+		OrganizationID: act.OrganizationID,
+		DeviceID:       act.DeviceID,
+		ActionID:       act.ActionID,
+		Action:         act.Action,
+		Status:         act.Status,
+		Message:        act.Message,
+		ListOnComplete: act.ListOnComplete,
+		ListActionID:   act.ListActionID,
+	}
+}
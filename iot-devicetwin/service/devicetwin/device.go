@@ -71,6 +71,21 @@ func (srv *Service) DeviceGetByID(deviceID string) (*messages.Device, bool, erro
 	return &device, d.IsDeleted(), nil
 }
 
+// DeviceProtocolVersion records the protocol version a device has responded with
+func (srv *Service) DeviceProtocolVersion(clientID string, version int) error {
+	return srv.DB.DeviceProtocolVersionUpdate(clientID, version)
+}
+
+// DeviceTransfer moves the device and its action history to another organization
+func (srv *Service) DeviceTransfer(deviceID, orgID string) error {
+	return srv.DB.DeviceTransfer(deviceID, orgID)
+}
+
+// DeviceGroupsUnlink removes the device from its groups, returning the names of the groups
+func (srv *Service) DeviceGroupsUnlink(deviceID string) ([]string, error) {
+	return srv.DB.DeviceGroupsUnlink(deviceID)
+}
+
 // DeviceDelete deletes the device from the database
 func (srv *Service) DeviceDelete(deviceID string) (string, error) {
 	err := srv.DB.DeviceDelete(deviceID)
@@ -95,17 +110,37 @@ func (srv *Service) DeviceList(orgID string) ([]messages.Device, error) {
 	return devices, nil
 }
 
+// DeviceListDeleted fetches the soft deleted devices of an organization
+func (srv *Service) DeviceListDeleted(orgID string) ([]messages.Device, error) {
+	dd, err := srv.DB.DeviceListDeleted(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []messages.Device{}
+	for _, d := range dd {
+		devices = append(devices, dataToDomainDevice(d))
+	}
+	return devices, nil
+}
+
+// DeviceRestore restores a soft deleted device
+func (srv *Service) DeviceRestore(deviceID string) error {
+	return srv.DB.DeviceRestore(deviceID)
+}
+
 func dataToDomainDevice(d datastore.Device) messages.Device {
 	return messages.Device{
-		OrgId:       d.OrganisationID,
-		DeviceId:    d.DeviceID,
-		Brand:       d.Brand,
-		Model:       d.DeviceModel,
-		Serial:      d.SerialNumber,
-		Store:       d.StoreID,
-		DeviceKey:   d.DeviceKey,
-		Version:     &messages.DeviceVersion{},
-		Created:     d.CreatedAt,
-		LastRefresh: d.LastRefresh,
+		OrgId:           d.OrganisationID,
+		DeviceId:        d.DeviceID,
+		Brand:           d.Brand,
+		Model:           d.DeviceModel,
+		Serial:          d.SerialNumber,
+		Store:           d.StoreID,
+		DeviceKey:       d.DeviceKey,
+		Version:         &messages.DeviceVersion{},
+		Created:         d.CreatedAt,
+		LastRefresh:     d.LastRefresh,
+		ProtocolVersion: d.ProtocolVersion,
 	}
 }
@@ -89,3 +89,80 @@ func TestService_DeviceList(t *testing.T) {
 		})
 	}
 }
+
+func TestService_DeviceTransfer(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientID string
+		wantErr  bool
+	}{
+		{"valid", "a111", false},
+		{"invalid", "invalid", true},
+	}
+	for _, tt := range tests {
+		localtt := tt
+		t.Run(localtt.name, func(t *testing.T) {
+			srv := NewService(memory.NewStore(), &datastore.MockDataStore{})
+			err := srv.DeviceTransfer(localtt.clientID, "def")
+			if (err != nil) != localtt.wantErr {
+				t.Errorf("Service.DeviceTransfer() error = %v, wantErr %v", err, localtt.wantErr)
+				return
+			}
+			if localtt.wantErr {
+				return
+			}
+			if _, err := srv.DeviceGet("def", localtt.clientID); err != nil {
+				t.Errorf("Service.DeviceTransfer() device not in new organization: %v", err)
+			}
+		})
+	}
+}
+
+func TestService_DeviceGroupsUnlink(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientID string
+		want     int
+		wantErr  bool
+	}{
+		{"valid", "a111", 1, false},
+		{"invalid", "invalid", 0, true},
+	}
+	for _, tt := range tests {
+		localtt := tt
+		t.Run(localtt.name, func(t *testing.T) {
+			srv := NewService(memory.NewStore(), &datastore.MockDataStore{})
+			got, err := srv.DeviceGroupsUnlink(localtt.clientID)
+			if (err != nil) != localtt.wantErr {
+				t.Errorf("Service.DeviceGroupsUnlink() error = %v, wantErr %v", err, localtt.wantErr)
+				return
+			}
+			if len(got) != localtt.want {
+				t.Errorf("Service.DeviceGroupsUnlink() = %v, want %v", len(got), localtt.want)
+			}
+		})
+	}
+}
+
+func TestService_DeviceRestore(t *testing.T) {
+	db := memory.NewStore()
+	srv := NewService(db, &datastore.MockDataStore{})
+	if _, err := srv.DeviceDelete("a111"); err != nil {
+		t.Fatalf("Service.DeviceDelete() error = %v", err)
+	}
+
+	deleted, err := srv.DeviceListDeleted("abc")
+	if err != nil || len(deleted) != 1 || deleted[0].DeviceId != "a111" {
+		t.Errorf("Service.DeviceListDeleted() = %v, %v", deleted, err)
+	}
+
+	if err = srv.DeviceRestore("a111"); err != nil {
+		t.Fatalf("Service.DeviceRestore() error = %v", err)
+	}
+	if _, err = srv.DeviceGet("abc", "a111"); err != nil {
+		t.Errorf("Service.DeviceRestore() device is not restored: %v", err)
+	}
+	if err = srv.DeviceRestore("a111"); err == nil {
+		t.Error("Service.DeviceRestore() expected error for a device that is not deleted")
+	}
+}
@@ -22,6 +22,7 @@ package devicetwin
 import (
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"time"
 
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/actions"
 
@@ -43,15 +44,25 @@ type DeviceTwin interface {
 	HealthHandler(payload messages.Health) error
 	ActionResponse(clientID, actionID, action string, payload []byte) error // process a response from a device
 
-	ActionCreate(orgID, deviceID string, act messages.SubscribeAction) error
+	ActionCreate(orgID, deviceID string, act messages.SubscribeAction, listOnComplete bool) error
 	ActionUpdate(actionID, status, message string) error
 	ActionList(orgID, deviceID string) ([]domain.Action, error)
+	ActionGet(actionID string) (domain.Action, error)
+	ActionListFollowUp(actionID, listActionID string) (bool, error)
+	ActionListAwaitingFollowUp(before time.Time) ([]domain.Action, error)
 
 	DeviceSnaps(orgID, clientID string) ([]messages.DeviceSnap, error)
 
 	DeviceList(orgID string) ([]messages.Device, error)
 	DeviceGet(orgID, clientID string) (messages.Device, error)
 	DeviceDelete(deviceID string) (string, error)
+	DeviceProtocolVersion(clientID string, version int) error
+	DeviceTransfer(deviceID, orgID string) error
+	DeviceGroupsUnlink(deviceID string) ([]string, error)
+	DeviceListDeleted(orgID string) ([]messages.Device, error)
+	DeviceRestore(deviceID string) error
+
+	Purge(policy domain.RetentionPolicy, dryRun bool) (domain.RetentionReport, error)
 
 	GroupCreate(orgID, name string) error
 	GroupList(orgID string) ([]domain.Group, error)
@@ -99,7 +110,7 @@ func (srv *Service) HealthHandler(payload messages.Health) error {
 func (srv *Service) ActionResponse(clientID, actionID, action string, payload []byte) error {
 	var (
 		err     error
-		status  = "complete"
+		status  = datastore.ActionStatusComplete
 		message = ""
 	)
 
@@ -128,7 +139,7 @@ func (srv *Service) ActionResponse(clientID, actionID, action string, payload []
 
 	// Update the action status
 	if err != nil {
-		status = "error"
+		status = datastore.ActionStatusError
 		message = err.Error()
 	}
 	e := srv.ActionUpdate(actionID, status, message)
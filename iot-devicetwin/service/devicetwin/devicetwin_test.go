@@ -116,24 +116,35 @@ func TestService_ActionCreate(t *testing.T) {
 		Snap:   "helloworld",
 	}
 	type args struct {
-		orgID    string
-		deviceID string
-		action   messages.SubscribeAction
+		orgID          string
+		deviceID       string
+		action         messages.SubscribeAction
+		listOnComplete bool
 	}
 	tests := []struct {
 		name    string
 		args    args
 		wantErr bool
 	}{
-		{"valid", args{"abc", "a111", a1}, false},
+		{"valid", args{"abc", "a111", a1, false}, false},
+		{"valid-list-on-complete", args{"abc", "a111", a1, true}, false},
 	}
 	for _, tt := range tests {
 		localtt := tt
 		t.Run(localtt.name, func(t *testing.T) {
 			srv := NewService(memory.NewStore(), &datastore.MockDataStore{})
-			if err := srv.ActionCreate(localtt.args.orgID, localtt.args.deviceID, localtt.args.action); (err != nil) != localtt.wantErr {
+			if err := srv.ActionCreate(localtt.args.orgID, localtt.args.deviceID, localtt.args.action, localtt.args.listOnComplete); (err != nil) != localtt.wantErr {
 				t.Errorf("Service.ActionCreate() error = %v, wantErr %v", err, localtt.wantErr)
 			}
+
+			act, err := srv.ActionGet(localtt.args.action.Id)
+			if err != nil {
+				t.Errorf("Service.ActionGet() error = %v", err)
+				return
+			}
+			if act.ListOnComplete != localtt.args.listOnComplete {
+				t.Errorf("Service.ActionCreate() list on complete = %v, want %v", act.ListOnComplete, localtt.args.listOnComplete)
+			}
 		})
 	}
 }
@@ -0,0 +1,69 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Device Twin Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package devicetwin
+
+import (
+	"fmt"
+
+	"github.com/everactive/dmscore/iot-devicetwin/domain"
+)
+
+// Purge applies a retention policy to the device twin data. The stale devices are soft deleted after the soft
+// deleted devices are purged, so they have the grace period to be restored, and are removed from their groups,
+// like decommissioned devices. A dry run reports the data that would be purged, without changing it.
+func (srv *Service) Purge(policy domain.RetentionPolicy, dryRun bool) (domain.RetentionReport, error) {
+	report := domain.RetentionReport{DevicesPurged: []string{}, DevicesStale: []string{}}
+
+	var err error
+	if !policy.ActionsBefore.IsZero() {
+		if report.Actions, err = srv.DB.ActionPurge(policy.ActionsBefore, policy.ArchiveActions, dryRun); err != nil {
+			return report, fmt.Errorf("error purging the actions: %w", err)
+		}
+	}
+
+	if !policy.DeletedBefore.IsZero() {
+		if report.DevicesPurged, err = srv.DB.DevicePurge(policy.DeletedBefore, dryRun); err != nil {
+			return report, fmt.Errorf("error purging the deleted devices: %w", err)
+		}
+		if report.RecordsPurged, err = srv.DB.DeviceRecordsPurge(policy.DeletedBefore, dryRun); err != nil {
+			return report, fmt.Errorf("error purging the deleted device records: %w", err)
+		}
+	}
+
+	if !policy.StaleBefore.IsZero() {
+		stale, err := srv.DB.DeviceListStale(policy.StaleBefore)
+		if err != nil {
+			return report, fmt.Errorf("error listing the stale devices: %w", err)
+		}
+		for _, d := range stale {
+			if !dryRun {
+				if _, err = srv.DB.DeviceGroupsUnlink(d.DeviceID); err != nil {
+					return report, fmt.Errorf("error removing the stale device `%s` from its groups: %w", d.DeviceID, err)
+				}
+				if err = srv.DB.DeviceDelete(d.DeviceID); err != nil {
+					return report, fmt.Errorf("error deleting the stale device `%s`: %w", d.DeviceID, err)
+				}
+			}
+			report.DevicesStale = append(report.DevicesStale, d.DeviceID)
+		}
+	}
+
+	return report, nil
+}
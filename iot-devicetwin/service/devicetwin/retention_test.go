@@ -0,0 +1,106 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Device Twin Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package devicetwin
+
+import (
+	"testing"
+	"time"
+
+	dtdatastore "github.com/everactive/dmscore/iot-devicetwin/datastore"
+	"github.com/everactive/dmscore/iot-devicetwin/datastore/memory"
+	"github.com/everactive/dmscore/iot-devicetwin/domain"
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+func TestService_Purge(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		policy      domain.RetentionPolicy
+		dryRun      bool
+		wantActions int64
+		wantPurged  int
+		wantStale   int
+		wantDevices int
+	}{
+		{"keep", domain.RetentionPolicy{}, false, 0, 0, 0, 2},
+		{"actions", domain.RetentionPolicy{ActionsBefore: now}, false, 2, 0, 0, 2},
+		{"deleted", domain.RetentionPolicy{DeletedBefore: now.Add(time.Minute)}, false, 0, 1, 0, 2},
+		{"deleted-grace-period", domain.RetentionPolicy{DeletedBefore: now.Add(-time.Hour)}, false, 0, 0, 0, 2},
+		{"stale", domain.RetentionPolicy{StaleBefore: now.Add(time.Minute)}, false, 0, 0, 2, 0},
+		{"all", domain.RetentionPolicy{ActionsBefore: now, DeletedBefore: now.Add(time.Minute), StaleBefore: now.Add(time.Minute)}, false, 2, 1, 2, 0},
+		{"all-dry-run", domain.RetentionPolicy{ActionsBefore: now, DeletedBefore: now.Add(time.Minute), StaleBefore: now.Add(time.Minute)}, true, 2, 1, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewStore()
+			db.Actions[0].Status = dtdatastore.ActionStatusComplete
+			db.Actions[1].Status = dtdatastore.ActionStatusError
+			srv := NewService(db, &datastore.MockDataStore{})
+			if _, err := srv.DeviceDelete("a111"); err != nil {
+				t.Fatalf("Service.DeviceDelete() error = %v", err)
+			}
+
+			got, err := srv.Purge(tt.policy, tt.dryRun)
+			if err != nil {
+				t.Fatalf("Service.Purge() error = %v", err)
+			}
+			if got.Actions != tt.wantActions || len(got.DevicesPurged) != tt.wantPurged || len(got.DevicesStale) != tt.wantStale {
+				t.Errorf("Service.Purge() = %+v, want actions %v, purged %v, stale %v", got, tt.wantActions, tt.wantPurged, tt.wantStale)
+			}
+
+			devices, _ := srv.DeviceList("abc")
+			if len(devices) != tt.wantDevices {
+				t.Errorf("Service.Purge() devices = %v, want %v", len(devices), tt.wantDevices)
+			}
+		})
+	}
+}
+
+func TestService_PurgeWaitingActions(t *testing.T) {
+	db := memory.NewStore()
+	srv := NewService(db, &datastore.MockDataStore{})
+
+	// The device has not responded to the actions, so they are kept
+	got, err := srv.Purge(domain.RetentionPolicy{ActionsBefore: time.Now()}, false)
+	if err != nil {
+		t.Fatalf("Service.Purge() error = %v", err)
+	}
+	if got.Actions != 0 || len(db.Actions) != 2 {
+		t.Errorf("Service.Purge() actions = %v, kept %v, want 0 and 2", got.Actions, len(db.Actions))
+	}
+}
+
+func TestService_PurgeStaleGroups(t *testing.T) {
+	db := memory.NewStore()
+	srv := NewService(db, &datastore.MockDataStore{})
+	if len(db.GroupLinks) == 0 {
+		t.Fatal("the store has no group links")
+	}
+
+	// The stale devices are removed from their groups, like decommissioned devices
+	got, err := srv.Purge(domain.RetentionPolicy{StaleBefore: time.Now().Add(time.Minute)}, false)
+	if err != nil {
+		t.Fatalf("Service.Purge() error = %v", err)
+	}
+	if len(got.DevicesStale) != 3 || len(db.GroupLinks) != 0 {
+		t.Errorf("Service.Purge() stale = %v, group links %v, want 3 and 0", got.DevicesStale, len(db.GroupLinks))
+	}
+}
@@ -22,6 +22,7 @@ package devicetwin
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
 
@@ -81,7 +82,7 @@ func (twin *ManualMockDeviceTwin) DeviceSnaps(orgID, clientID string) ([]message
 }
 
 // ActionCreate mocks the action log creation
-func (twin *ManualMockDeviceTwin) ActionCreate(orgID, deviceID string, act messages.SubscribeAction) error {
+func (twin *ManualMockDeviceTwin) ActionCreate(orgID, deviceID string, act messages.SubscribeAction, listOnComplete bool) error {
 	if deviceID == invalidDeviceIDString {
 		return fmt.Errorf("MOCK action log create")
 	}
@@ -105,6 +106,21 @@ func (twin *ManualMockDeviceTwin) ActionList(orgID, clientID string) ([]domain.A
 	return []domain.Action{}, nil
 }
 
+// ActionGet mocks fetching an action
+func (twin *ManualMockDeviceTwin) ActionGet(actionID string) (domain.Action, error) {
+	return domain.Action{}, fmt.Errorf("MOCK action not found")
+}
+
+// ActionListFollowUp mocks linking a snap list action to an action
+func (twin *ManualMockDeviceTwin) ActionListFollowUp(actionID, listActionID string) (bool, error) {
+	return false, nil
+}
+
+// ActionListAwaitingFollowUp mocks listing the actions waiting on a snap list
+func (twin *ManualMockDeviceTwin) ActionListAwaitingFollowUp(before time.Time) ([]domain.Action, error) {
+	return []domain.Action{}, nil
+}
+
 // DeviceGet mocks fetching a device
 func (twin *ManualMockDeviceTwin) DeviceGet(orgID, clientID string) (messages.Device, error) {
 	if clientID == invalidDeviceIDString {
@@ -142,6 +158,49 @@ func (twin *ManualMockDeviceTwin) DeviceDelete(deviceID string) (string, error)
 	return "c333", nil
 }
 
+// DeviceProtocolVersion mocks recording the protocol version of a device
+func (twin *ManualMockDeviceTwin) DeviceProtocolVersion(clientID string, version int) error {
+	return nil
+}
+
+// DeviceTransfer mocks moving a device to another organization
+func (twin *ManualMockDeviceTwin) DeviceTransfer(deviceID, orgID string) error {
+	if deviceID == invalidDeviceIDString || orgID == invalidDeviceIDString {
+		return fmt.Errorf("MOCK error device transfer")
+	}
+	return nil
+}
+
+// DeviceGroupsUnlink mocks removing a device from its groups
+func (twin *ManualMockDeviceTwin) DeviceGroupsUnlink(deviceID string) ([]string, error) {
+	if deviceID == invalidDeviceIDString {
+		return nil, fmt.Errorf("MOCK error device groups unlink")
+	}
+	return []string{"workshop"}, nil
+}
+
+// DeviceListDeleted mocks listing the deleted devices
+func (twin *ManualMockDeviceTwin) DeviceListDeleted(orgID string) ([]messages.Device, error) {
+	if orgID == invalidDeviceIDString {
+		return nil, fmt.Errorf("MOCK error device list deleted")
+	}
+	d, _ := twin.DeviceGet(orgID, "c333")
+	return []messages.Device{d}, nil
+}
+
+// DeviceRestore mocks restoring a deleted device
+func (twin *ManualMockDeviceTwin) DeviceRestore(deviceID string) error {
+	if deviceID == invalidDeviceIDString {
+		return fmt.Errorf("MOCK error device restore")
+	}
+	return nil
+}
+
+// Purge mocks applying a retention policy
+func (twin *ManualMockDeviceTwin) Purge(policy domain.RetentionPolicy, dryRun bool) (domain.RetentionReport, error) {
+	return domain.RetentionReport{Actions: 1, DevicesPurged: []string{"c333"}, DevicesStale: []string{}}, nil
+}
+
 // GroupCreate mocks creating a group
 func (twin *ManualMockDeviceTwin) GroupCreate(orgID, name string) error {
 	if orgID == invalidDeviceIDString {
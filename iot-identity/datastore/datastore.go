@@ -21,6 +21,9 @@
 package datastore
 
 import (
+	"context"
+	"time"
+
 	"github.com/everactive/dmscore/iot-identity/domain"
 	"github.com/everactive/dmscore/iot-identity/models"
 	"github.com/segmentio/ksuid"
@@ -36,14 +39,54 @@ type DataStore interface {
 	OrganizationGet(id string) (*domain.Organization, error)
 	OrganizationGetByName(name string) (*domain.Organization, error)
 	OrganizationList() ([]domain.Organization, error)
+	OrganizationCAUpdate(id string, ca OrganizationCAUpdateRequest) error
 
 	DeviceNew(device DeviceNewRequest) (string, error)
+	DeviceNewBatch(devices []DeviceNewRequest) error
 	DeviceGet(brand, model, serial string) (*domain.Enrollment, error)
 	DeviceGetEnrollmentByID(deviceID string) (*domain.Enrollment, error)
 	DeviceEnroll(device DeviceEnrollRequest) (*domain.Enrollment, error)
 	DeviceList(orgID string) ([]domain.Enrollment, error)
+	DeviceListExpiring(orgID string, before time.Time) ([]domain.Enrollment, error)
 	DeviceUpdate(deviceID string, status models.Status, deviceData string) error
 	DeviceDelete(deviceID string) (string, error)
+	DeviceCredentialsUpdate(deviceID string, credentials domain.Credentials) error
+	DeviceTransfer(deviceID, orgID string, credentials domain.Credentials) error
+	DeviceListDeleted(orgID string) ([]domain.Enrollment, error)
+	DeviceRestore(deviceID string) error
+	DevicePurge(deletedBefore time.Time, dryRun bool) ([]string, error)
+	DeviceSummaryList() ([]DeviceSummary, error)
+	DeviceSummaryGet(deviceID string) (*DeviceSummary, error)
+
+	CertificateRevoke(revoked domain.RevokedCertificate) error
+	CertificateRevokedGet(issuer, serialNumber, deviceID string) (*domain.RevokedCertificate, error)
+	CertificateRevokedList() ([]domain.RevokedCertificate, error)
+
+	PrivateKeysRewrap(ctx context.Context) (int, error)
+
+	AccountKeyUpsert(key domain.AccountKey) error
+	AccountKeyRefreshFailed(signKeyID, source, refreshError string) error
+	AccountKeyList() ([]domain.AccountKey, error)
+	AccountKeyDelete(signKeyID, source string) error
+
+	AutoRegistrationRuleList() ([]domain.AutoRegistrationRule, error)
+	AutoRegistrationRuleGet(id uint) (*domain.AutoRegistrationRule, error)
+	AutoRegistrationRuleCreate(rule domain.AutoRegistrationRule) (uint, error)
+	AutoRegistrationRuleUpdate(rule domain.AutoRegistrationRule) error
+	AutoRegistrationRuleDelete(id uint) error
+	AutoRegistrationNew(registration domain.AutoRegistration) error
+	AutoRegistrationGet(deviceID string) (*domain.AutoRegistration, error)
+	AutoRegistrationGroupsApplied(deviceID string) error
+
+	NonceCreate(nonce string, expiresAt time.Time) error
+	NonceConsume(nonce string) error
+
+	EnrollmentRequestCreate(request domain.EnrollmentRequest) (uint, error)
+	EnrollmentRequestGet(id uint) (*domain.EnrollmentRequest, error)
+	EnrollmentRequestGetByDevice(brand, model, serial string) (*domain.EnrollmentRequest, error)
+	EnrollmentRequestList(status string) ([]domain.EnrollmentRequest, error)
+	EnrollmentRequestCount(status string) (int, error)
+	EnrollmentRequestUpdate(request domain.EnrollmentRequest) error
 }
 
 // OrganizationNewRequest is the request to create a new organization
@@ -54,6 +97,16 @@ type OrganizationNewRequest struct {
 	ServerCert  []byte
 }
 
+// OrganizationCAUpdateRequest is the request to replace the CA of an organization. The previous CA is kept
+// until PreviousExpiresAt.
+type OrganizationCAUpdateRequest struct {
+	RootCert          []byte
+	RootKey           []byte
+	PreviousRootCert  []byte
+	PreviousRootKey   []byte
+	PreviousExpiresAt *time.Time
+}
+
 // DeviceNewRequest is the request to create a new device
 type DeviceNewRequest struct {
 	ID             string
@@ -65,6 +118,29 @@ type DeviceNewRequest struct {
 	DeviceData     string
 }
 
+// DeviceBatchError is returned by DeviceNewBatch when a device cannot be created, so none of them are.
+// Index is the position of the device in the batch.
+type DeviceBatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *DeviceBatchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DeviceBatchError) Unwrap() error {
+	return e.Err
+}
+
+// DeviceSummary identifies a device registration, live or soft deleted, without its credentials
+type DeviceSummary struct {
+	ID             string
+	OrganizationID string
+	Status         models.Status
+	Deleted        bool
+}
+
 // DeviceEnrollRequest is the request to enroll a device.
 // The details come from the model and serial assertion
 type DeviceEnrollRequest struct {
@@ -21,8 +21,12 @@
 package memory
 
 import (
+	"context"
+	"sort"
 	"database/sql"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/everactive/dmscore/iot-identity/models"
 	"github.com/everactive/dmscore/iot-identity/datastore"
@@ -33,7 +37,24 @@ import (
 type Store struct {
 	Orgs     []domain.Organization
 	Roll     []domain.Enrollment
-	Settings map[string]string
+	Deleted  []domain.Enrollment
+	// DeletedAt is when each of the deleted devices was deleted, by device ID
+	DeletedAt map[string]time.Time
+	Revoked     []domain.RevokedCertificate
+	AccountKeys []domain.AccountKey
+	Settings    map[string]string
+
+	Nonces map[string]time.Time
+
+	Rules             []domain.AutoRegistrationRule
+	AutoRegistrations []domain.AutoRegistration
+	lastRuleID        uint
+
+	EnrollmentRequests    []domain.EnrollmentRequest
+	lastEnrollmentRequest uint
+
+	// lock guards the registered and the deleted devices
+	lock sync.RWMutex
 }
 
 // NewStore creates a new memory store
@@ -115,13 +136,69 @@ func (mem *Store) OrganizationGet(id string) (*domain.Organization, error) {
 	return nil, fmt.Errorf("cannot find organization with ID '%s'", id)
 }
 
-//nolint
+// OrganizationCAUpdate replaces the CA of an organization
+func (mem *Store) OrganizationCAUpdate(id string, ca datastore.OrganizationCAUpdateRequest) error {
+	for i := range mem.Orgs {
+		if mem.Orgs[i].ID == id {
+			mem.Orgs[i].RootCert = ca.RootCert
+			mem.Orgs[i].RootKey = ca.RootKey
+			mem.Orgs[i].PreviousRootCert = ca.PreviousRootCert
+			mem.Orgs[i].PreviousRootKey = ca.PreviousRootKey
+			mem.Orgs[i].PreviousRootExpiresAt = ca.PreviousExpiresAt
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find organization with ID '%s': %w", id, sql.ErrNoRows)
+}
+
+// PrivateKeysRewrap does nothing, the private keys aren't encrypted in memory
+func (mem *Store) PrivateKeysRewrap(_ context.Context) (int, error) {
+	return 0, nil
+}
+
+// DeviceDelete soft deletes a device registration, moving it to the deleted devices
 func (mem *Store) DeviceDelete(deviceID string) (string, error) {
-	return "", nil
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for i := range mem.Roll {
+		if mem.Roll[i].ID == deviceID {
+			if mem.DeletedAt == nil {
+				mem.DeletedAt = map[string]time.Time{}
+			}
+			mem.DeletedAt[deviceID] = time.Now()
+			mem.Deleted = append(mem.Deleted, mem.Roll[i])
+			mem.Roll = append(mem.Roll[:i], mem.Roll[i+1:]...)
+			return deviceID, nil
+		}
+	}
+	return deviceID, sql.ErrNoRows
+}
+
+// DeviceNewBatch creates device registrations, either all or none of them
+func (mem *Store) DeviceNewBatch(devices []datastore.DeviceNewRequest) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	roll := mem.Roll
+	for i, d := range devices {
+		if _, err := mem.deviceNew(d); err != nil {
+			mem.Roll = roll
+			return &datastore.DeviceBatchError{Index: i, Err: err}
+		}
+	}
+	return nil
 }
 
 // DeviceNew creates a new device registration
 func (mem *Store) DeviceNew(device datastore.DeviceNewRequest) (string, error) {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	return mem.deviceNew(device)
+}
+
+func (mem *Store) deviceNew(device datastore.DeviceNewRequest) (string, error) {
 	// Validate
 	if len(device.Brand) == 0 || len(device.Model) == 0 || len(device.SerialNumber) == 0 || len(device.OrganizationID) == 0 {
 		return "", fmt.Errorf("the provided device details are incomplete")
@@ -157,6 +234,7 @@ func (mem *Store) DeviceNew(device datastore.DeviceNewRequest) (string, error) {
 		Device:       d,
 		Credentials:  device.Credentials,
 		Status:       models.StatusWaiting,
+		DeviceData:   device.DeviceData,
 	}
 	mem.Roll = append(mem.Roll, e)
 	return deviceID, nil
@@ -168,7 +246,14 @@ func (mem *Store) OrganizationList() ([]domain.Organization, error) {
 }
 
 // DeviceGet fetches a device registration
-func (mem *Store) DeviceGet(brand, model, serial string) (*domain.Enrollment, error) { // Check for duplicate
+func (mem *Store) DeviceGet(brand, model, serial string) (*domain.Enrollment, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	return mem.deviceGet(brand, model, serial)
+}
+
+func (mem *Store) deviceGet(brand, model, serial string) (*domain.Enrollment, error) {
 	for _, en := range mem.Roll {
 		if en.Device.Brand == brand && en.Device.Model == model && en.Device.SerialNumber == serial {
 			return &en, nil
@@ -179,8 +264,11 @@ func (mem *Store) DeviceGet(brand, model, serial string) (*domain.Enrollment, er
 
 // DeviceEnroll enrolls a device with the IoT service
 func (mem *Store) DeviceEnroll(device datastore.DeviceEnrollRequest) (*domain.Enrollment, error) {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
 	// Get the registered device
-	reg, err := mem.DeviceGet(device.Brand, device.Model, device.SerialNumber)
+	reg, err := mem.deviceGet(device.Brand, device.Model, device.SerialNumber)
 	if err != nil {
 		return nil, err
 	}
@@ -189,13 +277,52 @@ func (mem *Store) DeviceEnroll(device datastore.DeviceEnrollRequest) (*domain.En
 	reg.Device.DeviceKey = device.DeviceKey
 	reg.Device.StoreID = device.StoreID
 	reg.Status = models.StatusEnrolled
+	for i := range mem.Roll {
+		if mem.Roll[i].ID == reg.ID {
+			mem.Roll[i] = *reg
+		}
+	}
 	return reg, nil
 }
 
 // DeviceList fetches the devices for an organization
 func (mem *Store) DeviceList(orgID string) ([]domain.Enrollment, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	devices := []domain.Enrollment{}
+	for _, en := range mem.Roll {
+		if en.Organization.ID == orgID {
+			devices = append(devices, en)
+		}
+	}
+	return devices, nil
+}
+
+// DeviceListExpiring fetches the devices for an organization with certificates expiring before a time
+func (mem *Store) DeviceListExpiring(orgID string, before time.Time) ([]domain.Enrollment, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
 	devices := []domain.Enrollment{}
 	for _, en := range mem.Roll {
+		if en.Organization.ID == orgID && en.Credentials.ExpiresAt != nil && en.Credentials.ExpiresAt.Before(before) {
+			devices = append(devices, en)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Credentials.ExpiresAt.Before(*devices[j].Credentials.ExpiresAt)
+	})
+	return devices, nil
+}
+
+// DeviceListDeleted lists the soft deleted devices of an organization
+func (mem *Store) DeviceListDeleted(orgID string) ([]domain.Enrollment, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	devices := []domain.Enrollment{}
+	for _, en := range mem.Deleted {
 		if en.Organization.ID == orgID {
 			devices = append(devices, en)
 		}
@@ -203,8 +330,84 @@ func (mem *Store) DeviceList(orgID string) ([]domain.Enrollment, error) {
 	return devices, nil
 }
 
+// DeviceRestore moves a soft deleted device back to the registered devices, unless its serial number has been
+// registered again
+func (mem *Store) DeviceRestore(deviceID string) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for i := range mem.Deleted {
+		if mem.Deleted[i].ID == deviceID {
+			d := mem.Deleted[i].Device
+			if _, err := mem.deviceGet(d.Brand, d.Model, d.SerialNumber); err == nil {
+				return fmt.Errorf("the device `%s/%s/%s` is already registered", d.Brand, d.Model, d.SerialNumber)
+			}
+			mem.Roll = append(mem.Roll, mem.Deleted[i])
+			mem.Deleted = append(mem.Deleted[:i], mem.Deleted[i+1:]...)
+			delete(mem.DeletedAt, deviceID)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// DevicePurge removes the devices soft deleted before a time, returning their IDs. A dry run only lists them.
+func (mem *Store) DevicePurge(deletedBefore time.Time, dryRun bool) ([]string, error) {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	deviceIDs := []string{}
+	kept := []domain.Enrollment{}
+	for _, en := range mem.Deleted {
+		if !mem.DeletedAt[en.ID].Before(deletedBefore) {
+			kept = append(kept, en)
+			continue
+		}
+		deviceIDs = append(deviceIDs, en.ID)
+	}
+	if !dryRun {
+		mem.Deleted = kept
+		for _, id := range deviceIDs {
+			delete(mem.DeletedAt, id)
+		}
+	}
+	return deviceIDs, nil
+}
+
+// DeviceSummaryList lists the device registrations of every organization, including the soft deleted ones
+func (mem *Store) DeviceSummaryList() ([]datastore.DeviceSummary, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	devices := []datastore.DeviceSummary{}
+	for _, en := range mem.Roll {
+		devices = append(devices, datastore.DeviceSummary{ID: en.ID, OrganizationID: en.Organization.ID, Status: en.Status})
+	}
+	for _, en := range mem.Deleted {
+		devices = append(devices, datastore.DeviceSummary{ID: en.ID, OrganizationID: en.Organization.ID, Status: en.Status, Deleted: true})
+	}
+	return devices, nil
+}
+
+// DeviceSummaryGet fetches a device registration, even when it is soft deleted
+func (mem *Store) DeviceSummaryGet(deviceID string) (*datastore.DeviceSummary, error) {
+	devices, err := mem.DeviceSummaryList()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range devices {
+		if d.ID == deviceID {
+			return &d, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
 // DeviceGetEnrollmentByID fetches a device by its ID
 func (mem *Store) DeviceGetEnrollmentByID(deviceID string) (*domain.Enrollment, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
 	for _, en := range mem.Roll {
 		if en.ID == deviceID {
 			return &en, nil
@@ -215,6 +418,9 @@ func (mem *Store) DeviceGetEnrollmentByID(deviceID string) (*domain.Enrollment,
 
 // DeviceUpdate update a device for selected fields
 func (mem *Store) DeviceUpdate(deviceID string, status models.Status, deviceData string) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
 	found := false
 	roll := []domain.Enrollment{}
 
@@ -222,6 +428,31 @@ func (mem *Store) DeviceUpdate(deviceID string, status models.Status, deviceData
 		if en.ID == deviceID {
 			found = true
 			en.Status = status
+			if len(deviceData) > 0 {
+				en.DeviceData = deviceData
+			}
+		}
+		roll = append(roll, en)
+	}
+	if !found {
+		return fmt.Errorf("the device `%s` is not registered", deviceID)
+	}
+	mem.Roll = roll
+	return nil
+}
+
+// DeviceCredentialsUpdate replaces the credentials of a device
+func (mem *Store) DeviceCredentialsUpdate(deviceID string, credentials domain.Credentials) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	found := false
+	roll := []domain.Enrollment{}
+
+	for _, en := range mem.Roll {
+		if en.ID == deviceID {
+			found = true
+			en.Credentials = credentials
 		}
 		roll = append(roll, en)
 	}
@@ -231,3 +462,273 @@ func (mem *Store) DeviceUpdate(deviceID string, status models.Status, deviceData
 	mem.Roll = roll
 	return nil
 }
+
+// DeviceTransfer moves a device to another organization with the credentials issued for it
+func (mem *Store) DeviceTransfer(deviceID, orgID string, credentials domain.Credentials) error {
+	org, err := mem.OrganizationGet(orgID)
+	if err != nil {
+		return err
+	}
+
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for i := range mem.Roll {
+		if mem.Roll[i].ID == deviceID {
+			mem.Roll[i].Organization = *org
+			mem.Roll[i].Credentials = credentials
+			return nil
+		}
+	}
+	return fmt.Errorf("the device `%s` is not registered", deviceID)
+}
+
+// CertificateRevoke records a revoked certificate, revoking an already revoked certificate is not an error
+func (mem *Store) CertificateRevoke(revoked domain.RevokedCertificate) error {
+	for _, r := range mem.Revoked {
+		if r.Issuer == revoked.Issuer && r.SerialNumber == revoked.SerialNumber && r.DeviceID == revoked.DeviceID {
+			return nil
+		}
+	}
+	mem.Revoked = append(mem.Revoked, revoked)
+	return nil
+}
+
+// CertificateRevokedGet fetches a revoked certificate by the key ID of its CA and its serial number, and of the
+// device when the device ID is given
+func (mem *Store) CertificateRevokedGet(issuer, serialNumber, deviceID string) (*domain.RevokedCertificate, error) {
+	for _, r := range mem.Revoked {
+		if r.Issuer == issuer && r.SerialNumber == serialNumber && (len(deviceID) == 0 || r.DeviceID == deviceID) {
+			return &r, nil
+		}
+	}
+	return nil, fmt.Errorf("the certificate `%s` is not revoked: %w", serialNumber, sql.ErrNoRows)
+}
+
+// CertificateRevokedList fetches the revoked certificates
+func (mem *Store) CertificateRevokedList() ([]domain.RevokedCertificate, error) {
+	return mem.Revoked, nil
+}
+
+// NonceCreate stores a nonce that can be used once until it expires
+func (mem *Store) NonceCreate(nonce string, expiresAt time.Time) error {
+	if mem.Nonces == nil {
+		mem.Nonces = map[string]time.Time{}
+	}
+	mem.Nonces[nonce] = expiresAt
+	return nil
+}
+
+// NonceConsume uses a nonce, it fails when the nonce is unknown, already used or expired
+func (mem *Store) NonceConsume(nonce string) error {
+	expiresAt, ok := mem.Nonces[nonce]
+	if !ok {
+		return fmt.Errorf("the nonce is unknown or already used")
+	}
+	delete(mem.Nonces, nonce)
+
+	if time.Now().After(expiresAt) {
+		return fmt.Errorf("the nonce has expired")
+	}
+	return nil
+}
+
+// AccountKeyUpsert stores an account-key assertion, replacing the one with the same sign key ID from the same source
+func (mem *Store) AccountKeyUpsert(key domain.AccountKey) error {
+	for i := range mem.AccountKeys {
+		if mem.AccountKeys[i].SignKeyID == key.SignKeyID && mem.AccountKeys[i].Source == key.Source {
+			mem.AccountKeys[i] = key
+			return nil
+		}
+	}
+	mem.AccountKeys = append(mem.AccountKeys, key)
+	return nil
+}
+
+// AccountKeyRefreshFailed records why an account key couldn't be loaded from its source
+func (mem *Store) AccountKeyRefreshFailed(signKeyID, source, refreshError string) error {
+	for i := range mem.AccountKeys {
+		if mem.AccountKeys[i].SignKeyID == signKeyID && mem.AccountKeys[i].Source == source {
+			mem.AccountKeys[i].RefreshError = refreshError
+			return nil
+		}
+	}
+	mem.AccountKeys = append(mem.AccountKeys, domain.AccountKey{SignKeyID: signKeyID, Source: source, RefreshError: refreshError})
+	return nil
+}
+
+// AccountKeyList fetches the account keys
+func (mem *Store) AccountKeyList() ([]domain.AccountKey, error) {
+	keys := append([]domain.AccountKey{}, mem.AccountKeys...)
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].SignKeyID != keys[j].SignKeyID {
+			return keys[i].SignKeyID < keys[j].SignKeyID
+		}
+		return keys[i].Source < keys[j].Source
+	})
+	return keys, nil
+}
+
+// AccountKeyDelete deletes an account key from a source, or from every source when the source is empty
+func (mem *Store) AccountKeyDelete(signKeyID, source string) error {
+	kept := []domain.AccountKey{}
+	for _, k := range mem.AccountKeys {
+		if k.SignKeyID != signKeyID || (len(source) > 0 && k.Source != source) {
+			kept = append(kept, k)
+		}
+	}
+	if len(kept) == len(mem.AccountKeys) {
+		return fmt.Errorf("cannot find account key '%s': %w", signKeyID, sql.ErrNoRows)
+	}
+	mem.AccountKeys = kept
+	return nil
+}
+
+// AutoRegistrationRuleList fetches the auto-registration rules in the order they are tried
+func (mem *Store) AutoRegistrationRuleList() ([]domain.AutoRegistrationRule, error) {
+	rules := append([]domain.AutoRegistrationRule{}, mem.Rules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority == rules[j].Priority {
+			return rules[i].ID < rules[j].ID
+		}
+		return rules[i].Priority < rules[j].Priority
+	})
+	return rules, nil
+}
+
+// AutoRegistrationRuleGet fetches an auto-registration rule
+func (mem *Store) AutoRegistrationRuleGet(id uint) (*domain.AutoRegistrationRule, error) {
+	for i := range mem.Rules {
+		if mem.Rules[i].ID == id {
+			rule := mem.Rules[i]
+			return &rule, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find auto-registration rule %d: %w", id, sql.ErrNoRows)
+}
+
+// AutoRegistrationRuleCreate creates an auto-registration rule
+func (mem *Store) AutoRegistrationRuleCreate(rule domain.AutoRegistrationRule) (uint, error) {
+	mem.lastRuleID++
+	rule.ID = mem.lastRuleID
+	mem.Rules = append(mem.Rules, rule)
+	return rule.ID, nil
+}
+
+// AutoRegistrationRuleUpdate replaces an auto-registration rule
+func (mem *Store) AutoRegistrationRuleUpdate(rule domain.AutoRegistrationRule) error {
+	for i := range mem.Rules {
+		if mem.Rules[i].ID == rule.ID {
+			mem.Rules[i] = rule
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find auto-registration rule %d: %w", rule.ID, sql.ErrNoRows)
+}
+
+// AutoRegistrationRuleDelete deletes an auto-registration rule
+func (mem *Store) AutoRegistrationRuleDelete(id uint) error {
+	for i := range mem.Rules {
+		if mem.Rules[i].ID == id {
+			mem.Rules = append(mem.Rules[:i], mem.Rules[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find auto-registration rule %d: %w", id, sql.ErrNoRows)
+}
+
+// AutoRegistrationNew records the rule that registered a device
+func (mem *Store) AutoRegistrationNew(registration domain.AutoRegistration) error {
+	mem.AutoRegistrations = append(mem.AutoRegistrations, registration)
+	return nil
+}
+
+// AutoRegistrationGet fetches the auto-registration of a device
+func (mem *Store) AutoRegistrationGet(deviceID string) (*domain.AutoRegistration, error) {
+	for i := range mem.AutoRegistrations {
+		if mem.AutoRegistrations[i].DeviceID == deviceID {
+			registration := mem.AutoRegistrations[i]
+			return &registration, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find the auto-registration of %s: %w", deviceID, sql.ErrNoRows)
+}
+
+// AutoRegistrationGroupsApplied records that a device was added to the groups of its auto-registration
+func (mem *Store) AutoRegistrationGroupsApplied(deviceID string) error {
+	for i := range mem.AutoRegistrations {
+		if mem.AutoRegistrations[i].DeviceID == deviceID {
+			mem.AutoRegistrations[i].GroupsApplied = true
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find the auto-registration of %s: %w", deviceID, sql.ErrNoRows)
+}
+
+// EnrollmentRequestCreate stores the first enrollment attempt of a device
+func (mem *Store) EnrollmentRequestCreate(request domain.EnrollmentRequest) (uint, error) {
+	if _, err := mem.EnrollmentRequestGetByDevice(request.Brand, request.Model, request.SerialNumber); err == nil {
+		return 0, fmt.Errorf("the enrollment request for `%s/%s/%s` already exists", request.Brand, request.Model, request.SerialNumber)
+	}
+
+	mem.lastEnrollmentRequest++
+	request.ID = mem.lastEnrollmentRequest
+	mem.EnrollmentRequests = append(mem.EnrollmentRequests, request)
+	return request.ID, nil
+}
+
+// EnrollmentRequestGet fetches an enrollment request
+func (mem *Store) EnrollmentRequestGet(id uint) (*domain.EnrollmentRequest, error) {
+	for i := range mem.EnrollmentRequests {
+		if mem.EnrollmentRequests[i].ID == id {
+			request := mem.EnrollmentRequests[i]
+			return &request, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find enrollment request %d: %w", id, sql.ErrNoRows)
+}
+
+// EnrollmentRequestGetByDevice fetches the enrollment request of a device
+func (mem *Store) EnrollmentRequestGetByDevice(brand, model, serial string) (*domain.EnrollmentRequest, error) {
+	for i := range mem.EnrollmentRequests {
+		r := mem.EnrollmentRequests[i]
+		if r.Brand == brand && r.Model == model && r.SerialNumber == serial {
+			return &r, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find the enrollment request of `%s/%s/%s`: %w", brand, model, serial, sql.ErrNoRows)
+}
+
+// EnrollmentRequestList fetches the enrollment requests with a status, or all of them, most recent attempt first
+func (mem *Store) EnrollmentRequestList(status string) ([]domain.EnrollmentRequest, error) {
+	requests := []domain.EnrollmentRequest{}
+	for _, r := range mem.EnrollmentRequests {
+		if len(status) == 0 || r.Status == status {
+			requests = append(requests, r)
+		}
+	}
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].LastAttemptAt.After(requests[j].LastAttemptAt) })
+	return requests, nil
+}
+
+// EnrollmentRequestCount counts the enrollment requests with a status
+func (mem *Store) EnrollmentRequestCount(status string) (int, error) {
+	count := 0
+	for _, r := range mem.EnrollmentRequests {
+		if r.Status == status {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// EnrollmentRequestUpdate replaces an enrollment request
+func (mem *Store) EnrollmentRequestUpdate(request domain.EnrollmentRequest) error {
+	for i := range mem.EnrollmentRequests {
+		if mem.EnrollmentRequests[i].ID == request.ID {
+			mem.EnrollmentRequests[i] = request
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find enrollment request %d: %w", request.ID, sql.ErrNoRows)
+}
@@ -20,9 +20,13 @@
 package memory
 
 import (
+	"database/sql"
+	"errors"
 	"github.com/everactive/dmscore/iot-identity/models"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/everactive/dmscore/iot-identity/datastore"
 	"github.com/everactive/dmscore/iot-identity/domain"
@@ -258,3 +262,430 @@ func TestStore_DeviceUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestStore_CertificateRevoke(t *testing.T) {
+	revoked := domain.RevokedCertificate{Issuer: "ca1", SerialNumber: "1a2b", DeviceID: "b222", OrganizationID: "abc", Reason: 5}
+	tests := []struct {
+		name     string
+		issuer   string
+		serial   string
+		deviceID string
+		count    int
+		wantErr  bool
+	}{
+		{"valid", "ca1", "1a2b", "b222", 1, false},
+		{"valid-any-device", "ca1", "1a2b", "", 1, false},
+		{"not-revoked", "ca1", "3c4d", "b222", 1, true},
+		{"other-issuer", "ca2", "1a2b", "b222", 1, true},
+		{"other-device", "ca1", "1a2b", "c333", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewStore()
+			if err := mem.CertificateRevoke(revoked); err != nil {
+				t.Errorf("Store.CertificateRevoke() error = %v", err)
+			}
+			// Revoking again is a no-op
+			if err := mem.CertificateRevoke(revoked); err != nil {
+				t.Errorf("Store.CertificateRevoke() error = %v", err)
+			}
+
+			got, err := mem.CertificateRevokedGet(tt.issuer, tt.serial, tt.deviceID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Store.CertificateRevokedGet() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(*got, revoked) {
+				t.Errorf("Store.CertificateRevokedGet() = %v, want %v", got, revoked)
+			}
+
+			list, _ := mem.CertificateRevokedList()
+			if len(list) != tt.count {
+				t.Errorf("Store.CertificateRevokedList() count = %v, want %v", len(list), tt.count)
+			}
+		})
+	}
+
+	// Another device with a certificate of the same serial number from the same CA is revoked on its own
+	mem := NewStore()
+	other := revoked
+	other.DeviceID = "c333"
+	_ = mem.CertificateRevoke(revoked)
+	_ = mem.CertificateRevoke(other)
+	if list, _ := mem.CertificateRevokedList(); len(list) != 2 {
+		t.Errorf("Store.CertificateRevokedList() count = %v, want 2", len(list))
+	}
+}
+
+func TestStore_DeviceCredentialsUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		deviceID string
+		wantErr  bool
+	}{
+		{"valid", "b222", false},
+		{"invalid", "invalid", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewStore()
+			creds := domain.Credentials{Certificate: []byte("CERT"), MQTTURL: "localhost", MQTTPort: "8883"}
+			if err := mem.DeviceCredentialsUpdate(tt.deviceID, creds); (err != nil) != tt.wantErr {
+				t.Errorf("Store.DeviceCredentialsUpdate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			en, _ := mem.DeviceGetEnrollmentByID(tt.deviceID)
+			if !reflect.DeepEqual(en.Credentials, creds) {
+				t.Errorf("Store.DeviceCredentialsUpdate() credentials = %v, want %v", en.Credentials, creds)
+			}
+		})
+	}
+}
+
+func TestStore_DeviceTransfer(t *testing.T) {
+	tests := []struct {
+		name     string
+		deviceID string
+		orgID    string
+		wantErr  bool
+	}{
+		{"valid", "b222", "def", false},
+		{"invalid-device", "invalid", "def", true},
+		{"invalid-organization", "b222", "invalid", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewStore()
+			mem.Orgs = append(mem.Orgs, domain.Organization{ID: "def", Name: "Other Inc"})
+			creds := domain.Credentials{Certificate: []byte("CERT"), MQTTURL: "localhost", MQTTPort: "8883"}
+			if err := mem.DeviceTransfer(tt.deviceID, tt.orgID, creds); (err != nil) != tt.wantErr {
+				t.Errorf("Store.DeviceTransfer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			en, _ := mem.DeviceGetEnrollmentByID(tt.deviceID)
+			if en.Organization.ID != tt.orgID {
+				t.Errorf("Store.DeviceTransfer() organization = %v, want %v", en.Organization.ID, tt.orgID)
+			}
+			if !reflect.DeepEqual(en.Credentials, creds) {
+				t.Errorf("Store.DeviceTransfer() credentials = %v, want %v", en.Credentials, creds)
+			}
+		})
+	}
+}
+
+func TestStore_DeviceDelete(t *testing.T) {
+	mem := NewStore()
+
+	if _, err := mem.DeviceDelete("b222"); err != nil {
+		t.Fatalf("Store.DeviceDelete() error = %v", err)
+	}
+	if _, err := mem.DeviceGetEnrollmentByID("b222"); err == nil {
+		t.Error("Store.DeviceDelete() device still registered")
+	}
+	if len(mem.Deleted) != 1 || mem.Deleted[0].ID != "b222" {
+		t.Errorf("Store.DeviceDelete() deleted = %v, want %v", mem.Deleted, "b222")
+	}
+
+	if _, err := mem.DeviceDelete("b222"); err == nil {
+		t.Error("Store.DeviceDelete() expected error for a deleted device")
+	}
+}
+
+func TestStore_DeviceRestore(t *testing.T) {
+	mem := NewStore()
+
+	if _, err := mem.DeviceDelete("b222"); err != nil {
+		t.Fatalf("Store.DeviceDelete() error = %v", err)
+	}
+	if got, _ := mem.DeviceListDeleted("abc"); len(got) != 1 {
+		t.Errorf("Store.DeviceListDeleted() = %v, want %v", len(got), 1)
+	}
+
+	if err := mem.DeviceRestore("b222"); err != nil {
+		t.Fatalf("Store.DeviceRestore() error = %v", err)
+	}
+	if _, err := mem.DeviceGetEnrollmentByID("b222"); err != nil {
+		t.Errorf("Store.DeviceRestore() device not registered: %v", err)
+	}
+	if got, _ := mem.DeviceListDeleted("abc"); len(got) != 0 {
+		t.Errorf("Store.DeviceListDeleted() = %v, want %v", len(got), 0)
+	}
+
+	if err := mem.DeviceRestore("b222"); err == nil {
+		t.Error("Store.DeviceRestore() expected error for a registered device")
+	}
+
+	// The serial number of a deleted device can be registered again, the deleted device is then not restored
+	if _, err := mem.DeviceDelete("b222"); err != nil {
+		t.Fatalf("Store.DeviceDelete() error = %v", err)
+	}
+	if _, err := mem.DeviceNew(datastore.DeviceNewRequest{OrganizationID: "abc", Brand: "example", Model: "drone-1000", SerialNumber: "DR1000B222"}); err != nil {
+		t.Fatalf("Store.DeviceNew() error = %v", err)
+	}
+	if err := mem.DeviceRestore("b222"); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Errorf("Store.DeviceRestore() error = %v, want already registered", err)
+	}
+}
+
+func TestStore_DevicePurge(t *testing.T) {
+	mem := NewStore()
+	if _, err := mem.DeviceDelete("b222"); err != nil {
+		t.Fatalf("Store.DeviceDelete() error = %v", err)
+	}
+
+	// A device deleted after the time is kept
+	if got, _ := mem.DevicePurge(time.Now().Add(-time.Hour), false); len(got) != 0 || len(mem.Deleted) != 1 {
+		t.Errorf("Store.DevicePurge() = %v, deleted %v, want none purged", got, len(mem.Deleted))
+	}
+
+	if got, _ := mem.DevicePurge(time.Now(), true); len(got) != 1 || len(mem.Deleted) != 1 {
+		t.Errorf("Store.DevicePurge() dry run = %v, deleted %v", got, len(mem.Deleted))
+	}
+	if got, _ := mem.DevicePurge(time.Now(), false); len(got) != 1 || got[0] != "b222" {
+		t.Errorf("Store.DevicePurge() = %v, want %v", got, "b222")
+	}
+	if got, _ := mem.DeviceListDeleted("abc"); len(got) != 0 {
+		t.Errorf("Store.DevicePurge() deleted = %v, want none", len(got))
+	}
+}
+
+func TestStore_DeviceListExpiring(t *testing.T) {
+	now := time.Now()
+	soon := now.Add(24 * time.Hour)
+	later := now.Add(90 * 24 * time.Hour)
+
+	mem := NewStore()
+	_ = mem.DeviceCredentialsUpdate("a111", domain.Credentials{SerialNumber: "a1", ExpiresAt: &later})
+	_ = mem.DeviceCredentialsUpdate("b222", domain.Credentials{SerialNumber: "b2", ExpiresAt: &soon})
+
+	tests := []struct {
+		name   string
+		orgID  string
+		before time.Time
+		want   []string
+	}{
+		{"within-week", "abc", now.Add(7 * 24 * time.Hour), []string{"b222"}},
+		{"within-year", "abc", now.Add(365 * 24 * time.Hour), []string{"b222", "a111"}},
+		{"none", "abc", now, []string{}},
+		{"other-org", "invalid", now.Add(365 * 24 * time.Hour), []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mem.DeviceListExpiring(tt.orgID, tt.before)
+			if err != nil {
+				t.Errorf("Store.DeviceListExpiring() error = %v", err)
+				return
+			}
+			ids := []string{}
+			for _, en := range got {
+				ids = append(ids, en.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Store.DeviceListExpiring() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestStore_Nonces(t *testing.T) {
+	mem := NewStore()
+	if err := mem.NonceCreate("abc123", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Store.NonceCreate() error = %v", err)
+	}
+	if err := mem.NonceCreate("expired", time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("Store.NonceCreate() error = %v", err)
+	}
+
+	if err := mem.NonceConsume("abc123"); err != nil {
+		t.Errorf("Store.NonceConsume() error = %v", err)
+	}
+	if err := mem.NonceConsume("abc123"); err == nil {
+		t.Error("Store.NonceConsume() expected error for a nonce that is already used")
+	}
+	if err := mem.NonceConsume("expired"); err == nil {
+		t.Error("Store.NonceConsume() expected error for an expired nonce")
+	}
+	if err := mem.NonceConsume("invalid"); err == nil {
+		t.Error("Store.NonceConsume() expected error for an unknown nonce")
+	}
+}
+
+func TestStore_OrganizationCAUpdate(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+	tests := []struct {
+		name    string
+		orgID   string
+		ca      datastore.OrganizationCAUpdateRequest
+		wantErr bool
+	}{
+		{"valid", "abc", datastore.OrganizationCAUpdateRequest{RootCert: []byte("CERT"), RootKey: []byte("KEY"), PreviousRootCert: []byte("OLDCERT"), PreviousRootKey: []byte("OLDKEY"), PreviousExpiresAt: &expires}, false},
+		{"valid-no-previous", "abc", datastore.OrganizationCAUpdateRequest{RootCert: []byte("CERT"), RootKey: []byte("KEY")}, false},
+		{"invalid", "invalid", datastore.OrganizationCAUpdateRequest{RootCert: []byte("CERT"), RootKey: []byte("KEY")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewStore()
+			if err := mem.OrganizationCAUpdate(tt.orgID, tt.ca); (err != nil) != tt.wantErr {
+				t.Errorf("Store.OrganizationCAUpdate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			org, _ := mem.OrganizationGet(tt.orgID)
+			got := datastore.OrganizationCAUpdateRequest{RootCert: org.RootCert, RootKey: org.RootKey, PreviousRootCert: org.PreviousRootCert, PreviousRootKey: org.PreviousRootKey, PreviousExpiresAt: org.PreviousRootExpiresAt}
+			if !reflect.DeepEqual(got, tt.ca) {
+				t.Errorf("Store.OrganizationCAUpdate() organization = %v, want %v", got, tt.ca)
+			}
+		})
+	}
+}
+
+func TestStore_AccountKeys(t *testing.T) {
+	mem := NewStore()
+
+	if err := mem.AccountKeyRefreshFailed("key1", domain.AccountKeySourceStore, "no network"); err != nil {
+		t.Fatalf("Store.AccountKeyRefreshFailed() error = %v", err)
+	}
+	key1 := domain.AccountKey{SignKeyID: "key1", Source: domain.AccountKeySourceStore, Assertion: []byte("ASSERTION")}
+	key2 := domain.AccountKey{SignKeyID: "key2", Source: domain.AccountKeySourceAPI, Assertion: []byte("ASSERTION")}
+	for _, k := range []domain.AccountKey{key2, key1} {
+		if err := mem.AccountKeyUpsert(k); err != nil {
+			t.Fatalf("Store.AccountKeyUpsert() error = %v", err)
+		}
+	}
+
+	// A failed refresh keeps the assertion
+	if err := mem.AccountKeyRefreshFailed("key1", domain.AccountKeySourceStore, "no network"); err != nil {
+		t.Fatalf("Store.AccountKeyRefreshFailed() error = %v", err)
+	}
+	key1.RefreshError = "no network"
+
+	got, _ := mem.AccountKeyList()
+	if want := []domain.AccountKey{key1, key2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Store.AccountKeyList() = %v, want %v", got, want)
+	}
+
+	// The same key from another source is stored separately, and deleted separately
+	uploaded := domain.AccountKey{SignKeyID: "key1", Source: domain.AccountKeySourceAPI, Assertion: []byte("UPLOADED")}
+	if err := mem.AccountKeyUpsert(uploaded); err != nil {
+		t.Fatalf("Store.AccountKeyUpsert() error = %v", err)
+	}
+	got, _ = mem.AccountKeyList()
+	if want := []domain.AccountKey{uploaded, key1, key2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Store.AccountKeyList() = %v, want %v", got, want)
+	}
+	if err := mem.AccountKeyDelete("key1", domain.AccountKeySourceStore); err != nil {
+		t.Errorf("Store.AccountKeyDelete() error = %v", err)
+	}
+	if got, _ := mem.AccountKeyList(); len(got) != 2 || got[0].Source != domain.AccountKeySourceAPI {
+		t.Errorf("Store.AccountKeyList() = %v, want the uploaded key1 and key2", got)
+	}
+
+	if err := mem.AccountKeyDelete("key1", ""); err != nil {
+		t.Errorf("Store.AccountKeyDelete() error = %v", err)
+	}
+	if err := mem.AccountKeyDelete("key1", ""); err == nil {
+		t.Error("Store.AccountKeyDelete() expected error for a deleted key")
+	}
+	if got, _ := mem.AccountKeyList(); len(got) != 1 {
+		t.Errorf("Store.AccountKeyList() = %v, want 1 key", got)
+	}
+}
+
+func TestStore_AutoRegistrationRules(t *testing.T) {
+	mem := NewStore()
+
+	for _, r := range []domain.AutoRegistrationRule{
+		{Name: "second", Priority: 2, OrganizationID: "abc"},
+		{Name: "first", Priority: 1, OrganizationID: "abc"},
+		{Name: "third", Priority: 2, OrganizationID: "abc"},
+	} {
+		if _, err := mem.AutoRegistrationRuleCreate(r); err != nil {
+			t.Fatalf("Store.AutoRegistrationRuleCreate() error = %v", err)
+		}
+	}
+
+	got, _ := mem.AutoRegistrationRuleList()
+	names := []string{}
+	for _, r := range got {
+		names = append(names, r.Name)
+	}
+	if want := []string{"first", "second", "third"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Store.AutoRegistrationRuleList() = %v, want %v", names, want)
+	}
+
+	if err := mem.AutoRegistrationRuleDelete(2); err != nil {
+		t.Errorf("Store.AutoRegistrationRuleDelete() error = %v", err)
+	}
+	if _, err := mem.AutoRegistrationRuleGet(2); err == nil {
+		t.Error("Store.AutoRegistrationRuleGet() expected error for a deleted rule")
+	}
+
+	registration := domain.AutoRegistration{DeviceID: "a111", RuleID: 1, OrganizationID: "abc", Groups: []string{"drones"}}
+	if err := mem.AutoRegistrationNew(registration); err != nil {
+		t.Fatalf("Store.AutoRegistrationNew() error = %v", err)
+	}
+	if err := mem.AutoRegistrationGroupsApplied("a111"); err != nil {
+		t.Errorf("Store.AutoRegistrationGroupsApplied() error = %v", err)
+	}
+	registration.GroupsApplied = true
+	if got, _ := mem.AutoRegistrationGet("a111"); !reflect.DeepEqual(*got, registration) {
+		t.Errorf("Store.AutoRegistrationGet() = %v, want %v", *got, registration)
+	}
+	if _, err := mem.AutoRegistrationGet("invalid"); err == nil {
+		t.Error("Store.AutoRegistrationGet() expected error for an unknown device")
+	}
+}
+
+func TestStore_EnrollmentRequests(t *testing.T) {
+	mem := NewStore()
+	now := time.Now()
+
+	first := domain.EnrollmentRequest{Brand: "example", Model: "drone-1000", SerialNumber: "DR1000C333", Status: domain.EnrollmentRequestPending, Attempts: 1, LastAttemptAt: now.Add(-time.Hour)}
+	second := domain.EnrollmentRequest{Brand: "example", Model: "drone-1000", SerialNumber: "DR1000D444", Status: domain.EnrollmentRequestRejected, Attempts: 1, LastAttemptAt: now}
+	for _, r := range []domain.EnrollmentRequest{first, second} {
+		if _, err := mem.EnrollmentRequestCreate(r); err != nil {
+			t.Fatalf("Store.EnrollmentRequestCreate() error = %v", err)
+		}
+	}
+	if _, err := mem.EnrollmentRequestCreate(first); err == nil {
+		t.Error("Store.EnrollmentRequestCreate() expected error for a duplicate device")
+	}
+
+	got, _ := mem.EnrollmentRequestList("")
+	if len(got) != 2 || got[0].SerialNumber != "DR1000D444" {
+		t.Errorf("Store.EnrollmentRequestList() = %v, want the most recent attempt first", got)
+	}
+	if got, _ := mem.EnrollmentRequestList(domain.EnrollmentRequestPending); len(got) != 1 || got[0].SerialNumber != "DR1000C333" {
+		t.Errorf("Store.EnrollmentRequestList() = %v, want the pending request", got)
+	}
+	if count, _ := mem.EnrollmentRequestCount(domain.EnrollmentRequestPending); count != 1 {
+		t.Errorf("Store.EnrollmentRequestCount() = %d, want 1", count)
+	}
+
+	r, err := mem.EnrollmentRequestGetByDevice("example", "drone-1000", "DR1000C333")
+	if err != nil {
+		t.Fatalf("Store.EnrollmentRequestGetByDevice() error = %v", err)
+	}
+	r.Attempts = 2
+	if err := mem.EnrollmentRequestUpdate(*r); err != nil {
+		t.Errorf("Store.EnrollmentRequestUpdate() error = %v", err)
+	}
+	if got, _ := mem.EnrollmentRequestGet(r.ID); got.Attempts != 2 {
+		t.Errorf("Store.EnrollmentRequestGet() attempts = %d, want 2", got.Attempts)
+	}
+
+	if _, err := mem.EnrollmentRequestGet(99); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Store.EnrollmentRequestGet() error = %v, want sql.ErrNoRows", err)
+	}
+	if err := mem.EnrollmentRequestUpdate(domain.EnrollmentRequest{ID: 99}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Store.EnrollmentRequestUpdate() error = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,114 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/models"
+	"gorm.io/gorm/clause"
+)
+
+// AccountKeyUpsert stores an account-key assertion, replacing the one with the same sign key ID from the same source
+func (s *Store) AccountKeyUpsert(key domain.AccountKey) error {
+	res := s.gormDB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sign_key_id"}, {Name: "source"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "account_id", "name", "assertion", "since", "until", "refreshed_at", "refresh_error"}),
+	}).Create(&models.AccountKey{
+		SignKeyID:    key.SignKeyID,
+		AccountID:    key.AccountID,
+		Name:         key.Name,
+		Source:       key.Source,
+		Assertion:    string(key.Assertion),
+		Since:        key.Since,
+		Until:        key.Until,
+		RefreshedAt:  key.RefreshedAt,
+		RefreshError: key.RefreshError,
+	})
+	if res.Error != nil {
+		return fmt.Errorf("error storing account key %s: %w", key.SignKeyID, res.Error)
+	}
+
+	return nil
+}
+
+// AccountKeyRefreshFailed records why an account key couldn't be loaded from its source, keeping any assertion
+// loaded before
+func (s *Store) AccountKeyRefreshFailed(signKeyID, source, refreshError string) error {
+	res := s.gormDB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "sign_key_id"}, {Name: "source"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "refresh_error"}),
+	}).Create(&models.AccountKey{
+		SignKeyID:    signKeyID,
+		Source:       source,
+		RefreshError: refreshError,
+	})
+	if res.Error != nil {
+		return fmt.Errorf("error storing account key %s status: %w", signKeyID, res.Error)
+	}
+
+	return nil
+}
+
+// AccountKeyList fetches the account keys
+func (s *Store) AccountKeyList() ([]domain.AccountKey, error) {
+	var list []models.AccountKey
+	res := s.gormDB.Order("sign_key_id, source").Find(&list)
+	if res.Error != nil {
+		return nil, fmt.Errorf("error retrieving account keys: %w", res.Error)
+	}
+
+	keys := make([]domain.AccountKey, 0, len(list))
+	for _, k := range list {
+		keys = append(keys, domain.AccountKey{
+			SignKeyID:    k.SignKeyID,
+			AccountID:    k.AccountID,
+			Name:         k.Name,
+			Source:       k.Source,
+			Assertion:    []byte(k.Assertion),
+			Since:        k.Since,
+			Until:        k.Until,
+			RefreshedAt:  k.RefreshedAt,
+			RefreshError: k.RefreshError,
+		})
+	}
+
+	return keys, nil
+}
+
+// AccountKeyDelete deletes an account key from a source, or from every source when the source is empty
+func (s *Store) AccountKeyDelete(signKeyID, source string) error {
+	// The sign key ID is unique for a source, so deleted keys aren't kept
+	query := s.gormDB.Unscoped().Where("sign_key_id = ?", signKeyID)
+	if len(source) > 0 {
+		query = query.Where("source = ?", source)
+	}
+	res := query.Delete(&models.AccountKey{})
+	if res.Error != nil {
+		return fmt.Errorf("error deleting account key %s: %w", signKeyID, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
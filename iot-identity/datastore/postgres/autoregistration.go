@@ -0,0 +1,201 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/models"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// AutoRegistrationRuleList fetches the auto-registration rules in the order they are tried
+func (s *Store) AutoRegistrationRuleList() ([]domain.AutoRegistrationRule, error) {
+	var list []models.AutoRegistrationRule
+	res := s.gormDB.Order("priority").Order("id").Find(&list)
+	if res.Error != nil {
+		return nil, fmt.Errorf("error retrieving auto-registration rules: %w", res.Error)
+	}
+
+	rules := make([]domain.AutoRegistrationRule, 0, len(list))
+	for _, r := range list {
+		rules = append(rules, autoRegistrationRuleFromModel(r))
+	}
+	return rules, nil
+}
+
+// AutoRegistrationRuleGet fetches an auto-registration rule
+func (s *Store) AutoRegistrationRuleGet(id uint) (*domain.AutoRegistrationRule, error) {
+	var r models.AutoRegistrationRule
+	res := s.gormDB.First(&r, id)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, sql.ErrNoRows
+	}
+	if res.Error != nil {
+		return nil, fmt.Errorf("error retrieving auto-registration rule %d: %w", id, res.Error)
+	}
+
+	rule := autoRegistrationRuleFromModel(r)
+	return &rule, nil
+}
+
+// AutoRegistrationRuleCreate creates an auto-registration rule
+func (s *Store) AutoRegistrationRuleCreate(rule domain.AutoRegistrationRule) (uint, error) {
+	r := autoRegistrationRuleToModel(rule)
+	r.ID = 0
+	if res := s.gormDB.Create(&r); res.Error != nil {
+		return 0, fmt.Errorf("error creating auto-registration rule: %w", res.Error)
+	}
+	return r.ID, nil
+}
+
+// AutoRegistrationRuleUpdate replaces an auto-registration rule
+func (s *Store) AutoRegistrationRuleUpdate(rule domain.AutoRegistrationRule) error {
+	r := autoRegistrationRuleToModel(rule)
+	res := s.gormDB.Model(&r).
+		Select("name", "priority", "brand", "model", "sign_key_id", "serial_pattern", "store_id", "organization_id", "device_groups", "device_data", "pending_approval").
+		Updates(&r)
+	if res.Error != nil {
+		return fmt.Errorf("error updating auto-registration rule %d: %w", rule.ID, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AutoRegistrationRuleDelete deletes an auto-registration rule
+func (s *Store) AutoRegistrationRuleDelete(id uint) error {
+	res := s.gormDB.Delete(&models.AutoRegistrationRule{}, id)
+	if res.Error != nil {
+		return fmt.Errorf("error deleting auto-registration rule %d: %w", id, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AutoRegistrationNew records the rule that registered a device
+func (s *Store) AutoRegistrationNew(registration domain.AutoRegistration) error {
+	res := s.gormDB.Create(&models.AutoRegistration{
+		DeviceID:       registration.DeviceID,
+		RuleID:         registration.RuleID,
+		OrganizationID: registration.OrganizationID,
+		DeviceGroups:   encodeGroups(registration.Groups),
+		GroupsApplied:  registration.GroupsApplied,
+	})
+	if res.Error != nil {
+		return fmt.Errorf("error storing the auto-registration of %s: %w", registration.DeviceID, res.Error)
+	}
+	return nil
+}
+
+// AutoRegistrationGet fetches the auto-registration of a device
+func (s *Store) AutoRegistrationGet(deviceID string) (*domain.AutoRegistration, error) {
+	var r models.AutoRegistration
+	res := s.gormDB.Where("device_id = ?", deviceID).First(&r)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, sql.ErrNoRows
+	}
+	if res.Error != nil {
+		return nil, fmt.Errorf("error retrieving the auto-registration of %s: %w", deviceID, res.Error)
+	}
+
+	return &domain.AutoRegistration{
+		DeviceID:       r.DeviceID,
+		RuleID:         r.RuleID,
+		OrganizationID: r.OrganizationID,
+		Groups:         decodeGroups(r.DeviceGroups),
+		GroupsApplied:  r.GroupsApplied,
+	}, nil
+}
+
+// AutoRegistrationGroupsApplied records that a device was added to the groups of its auto-registration
+func (s *Store) AutoRegistrationGroupsApplied(deviceID string) error {
+	res := s.gormDB.Model(&models.AutoRegistration{}).Where("device_id = ?", deviceID).Update("groups_applied", true)
+	if res.Error != nil {
+		return fmt.Errorf("error updating the auto-registration of %s: %w", deviceID, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func autoRegistrationRuleFromModel(r models.AutoRegistrationRule) domain.AutoRegistrationRule {
+	return domain.AutoRegistrationRule{
+		ID:              r.ID,
+		Name:            r.Name,
+		Priority:        r.Priority,
+		Brand:           r.Brand,
+		Model:           r.DeviceModel,
+		SignKeyID:       r.SignKeyID,
+		SerialPattern:   r.SerialPattern,
+		StoreID:         r.StoreID,
+		OrganizationID:  r.OrganizationID,
+		Groups:          decodeGroups(r.DeviceGroups),
+		DeviceData:      r.DeviceData,
+		PendingApproval: r.PendingApproval,
+	}
+}
+
+func autoRegistrationRuleToModel(rule domain.AutoRegistrationRule) models.AutoRegistrationRule {
+	r := models.AutoRegistrationRule{
+		Name:            rule.Name,
+		Priority:        rule.Priority,
+		Brand:           rule.Brand,
+		DeviceModel:     rule.Model,
+		SignKeyID:       rule.SignKeyID,
+		SerialPattern:   rule.SerialPattern,
+		StoreID:         rule.StoreID,
+		OrganizationID:  rule.OrganizationID,
+		DeviceGroups:    encodeGroups(rule.Groups),
+		DeviceData:      rule.DeviceData,
+		PendingApproval: rule.PendingApproval,
+	}
+	r.ID = rule.ID
+	return r
+}
+
+// encodeGroups stores a list of group names as a JSON array
+func encodeGroups(groups []string) string {
+	if len(groups) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(groups)
+	return string(b)
+}
+
+func decodeGroups(value string) []string {
+	groups := []string{}
+	if len(value) == 0 {
+		return groups
+	}
+	if err := json.Unmarshal([]byte(value), &groups); err != nil {
+		log.Errorf("Cannot decode the stored device groups %q: %v", value, err)
+	}
+	return groups
+}
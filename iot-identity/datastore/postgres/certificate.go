@@ -0,0 +1,96 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/models"
+	"gorm.io/gorm/clause"
+)
+
+// CertificateRevoke records a revoked certificate, revoking an already revoked certificate is not an error
+func (s *Store) CertificateRevoke(revoked domain.RevokedCertificate) error {
+	res := s.gormDB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "issuer"}, {Name: "serial_number"}, {Name: "device_id"}},
+		DoNothing: true,
+	}).Create(&models.RevokedCertificate{
+		Issuer:       revoked.Issuer,
+		SerialNumber: revoked.SerialNumber,
+		DeviceID:     revoked.DeviceID,
+		OrgID:        revoked.OrganizationID,
+		Reason:       revoked.Reason,
+		RevokedAt:    revoked.RevokedAt,
+	})
+	if res.Error != nil {
+		return fmt.Errorf("error revoking certificate %s: %w", revoked.SerialNumber, res.Error)
+	}
+
+	return nil
+}
+
+// CertificateRevokedGet fetches a revoked certificate by the key ID of its CA and its serial number, and of the
+// device when the device ID is given
+func (s *Store) CertificateRevokedGet(issuer, serialNumber, deviceID string) (*domain.RevokedCertificate, error) {
+	revoked := models.RevokedCertificate{}
+	query := s.gormDB.Where("issuer = ? AND serial_number = ?", issuer, serialNumber)
+	if len(deviceID) > 0 {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	res := query.Order("revoked_at").Limit(1).Find(&revoked)
+	if res.Error != nil {
+		return nil, fmt.Errorf("error retrieving revoked certificate: %w", res.Error)
+	}
+
+	if res.RowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return revokedCertificateFromModel(&revoked), nil
+}
+
+// CertificateRevokedList fetches all the revoked certificates
+func (s *Store) CertificateRevokedList() ([]domain.RevokedCertificate, error) {
+	var list []models.RevokedCertificate
+	res := s.gormDB.Order("revoked_at").Find(&list)
+	if res.Error != nil {
+		return nil, fmt.Errorf("error retrieving revoked certificates: %w", res.Error)
+	}
+
+	revoked := make([]domain.RevokedCertificate, 0, len(list))
+	for i := range list {
+		revoked = append(revoked, *revokedCertificateFromModel(&list[i]))
+	}
+
+	return revoked, nil
+}
+
+func revokedCertificateFromModel(m *models.RevokedCertificate) *domain.RevokedCertificate {
+	return &domain.RevokedCertificate{
+		Issuer:         m.Issuer,
+		SerialNumber:   m.SerialNumber,
+		DeviceID:       m.DeviceID,
+		OrganizationID: m.OrgID,
+		Reason:         m.Reason,
+		RevokedAt:      m.RevokedAt,
+	}
+}
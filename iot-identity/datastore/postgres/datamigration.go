@@ -0,0 +1,59 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/iot-identity/datastore"
+	"github.com/everactive/dmscore/iot-identity/models"
+)
+
+// Names of the one-off migrations of the stored data
+const (
+	dataMigrationCredentialDetails  = "credential-details"
+	dataMigrationEncryptPrivateKeys = "encrypt-private-keys"
+)
+
+// runDataMigration runs a one-off migration of the stored data, unless it has completed before. A migration that
+// fails is run again on the next start.
+func (s *Store) runDataMigration(name string, migrate func() error) error {
+	completed := models.DataMigration{}
+	res := s.gormDB.Where("name = ?", name).Limit(1).Find(&completed)
+	if res.Error != nil {
+		return fmt.Errorf("error retrieving data migration %s: %w", name, res.Error)
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+
+	datastore.Logger.Infof("Running data migration %s", name)
+	if err := migrate(); err != nil {
+		return err
+	}
+
+	res = s.gormDB.Create(&models.DataMigration{Name: name, CompletedAt: time.Now()})
+	if res.Error != nil {
+		return fmt.Errorf("error recording data migration %s: %w", name, res.Error)
+	}
+
+	return nil
+}
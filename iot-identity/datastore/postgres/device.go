@@ -20,18 +20,61 @@
 package postgres
 
 import (
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"time"
+
 	"github.com/everactive/dmscore/iot-identity/datastore"
 	"github.com/everactive/dmscore/iot-identity/domain"
 	"github.com/everactive/dmscore/iot-identity/models"
+	"gorm.io/gorm"
 )
 
 // DeviceNew creates a new device registration
 func (s *Store) DeviceNew(d datastore.DeviceNewRequest) (string, error) {
+	return s.deviceNew(s.DB, d)
+}
+
+// DeviceNewBatch creates device registrations in a transaction, so either all or none of them are created
+func (s *Store) DeviceNewBatch(devices []datastore.DeviceNewRequest) error {
+	tx, err := s.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting device registration transaction: %w", err)
+	}
+
+	for i, d := range devices {
+		if _, err := s.deviceNew(tx, d); err != nil {
+			if errRollback := tx.Rollback(); errRollback != nil {
+				datastore.Logger.Error("Error rolling back device registrations: ", errRollback)
+			}
+			return &datastore.DeviceBatchError{Index: i, Err: fmt.Errorf("error creating device `%s/%s/%s`: %w", d.Brand, d.Model, d.SerialNumber, err)}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// rowQuerier is a database connection or transaction
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (s *Store) deviceNew(q rowQuerier, d datastore.DeviceNewRequest) (string, error) {
 	var id int64
-	var deviceID = datastore.GenerateID()
+	var deviceID = d.ID
+	if len(deviceID) == 0 {
+		deviceID = datastore.GenerateID()
+	}
 
-	err := s.QueryRow(createDeviceSQL, deviceID, d.OrganizationID, d.Brand, d.Model, d.SerialNumber, d.Credentials.PrivateKey, d.Credentials.Certificate, d.Credentials.MQTTURL, d.Credentials.MQTTPort, d.DeviceData).Scan(&id)
+	privateKey, err := s.encrypt(d.Credentials.PrivateKey, deviceKeyData(deviceID))
+	if err != nil {
+		return deviceID, fmt.Errorf("error encrypting device key: %w", err)
+	}
+
+	err = q.QueryRow(createDeviceSQL, deviceID, d.OrganizationID, d.Brand, d.Model, d.SerialNumber, privateKey, d.Credentials.Certificate, d.Credentials.MQTTURL, d.Credentials.MQTTPort, d.DeviceData, d.Credentials.SerialNumber, d.Credentials.ExpiresAt).Scan(&id)
 	if err != nil {
 		datastore.Logger.Error("Error creating device: ", err)
 	}
@@ -39,13 +82,16 @@ func (s *Store) DeviceNew(d datastore.DeviceNewRequest) (string, error) {
 	return deviceID, err
 }
 
-// DeviceDelete deletes a device from the database
+// DeviceDelete soft deletes a device from the database, so that its registration can be restored
 func (s *Store) DeviceDelete(deviceID string) (string, error) {
 	datastore.Logger.Tracef("Deleting device: %s", deviceID)
-	_, err := s.Exec(deleteDeviceByID, deviceID)
-	if err != nil {
-		datastore.Logger.Error("Error deleting device: ", err)
-		return deviceID, fmt.Errorf("error deleting device: %w", err)
+	res := s.gormDB.Where("device_id = ?", deviceID).Delete(&models.RegisteredDevice{})
+	if res.Error != nil {
+		datastore.Logger.Error("Error deleting device: ", res.Error)
+		return deviceID, fmt.Errorf("error deleting device: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return deviceID, sql.ErrNoRows
 	}
 
 	return deviceID, nil
@@ -62,11 +108,14 @@ func (s *Store) DeviceGet(brand, model, serial string) (*domain.Enrollment, erro
 	err := s.QueryRow(getDeviceSQL, brand, model, serial).Scan(
 		&d.ID, &d.Organization.ID, &d.Device.Brand, &d.Device.Model, &d.Device.SerialNumber,
 		&d.Credentials.PrivateKey, &d.Credentials.Certificate, &d.Credentials.MQTTURL, &d.Credentials.MQTTPort,
-		&d.Device.StoreID, &d.Device.DeviceKey, &d.Status, &d.DeviceData)
+		&d.Device.StoreID, &d.Device.DeviceKey, &d.Status, &d.DeviceData, &d.Credentials.SerialNumber, &d.Credentials.ExpiresAt)
 	if err != nil {
 		datastore.Logger.Error("Error retrieving device:", err)
 		return &d, fmt.Errorf("error retrieving device: %w", err)
 	}
+	if err = s.decryptCredentials(d.ID, &d.Credentials); err != nil {
+		return &d, err
+	}
 
 	// Get the organization details for the device
 	org, err := s.OrganizationGet(d.Organization.ID)
@@ -94,6 +143,9 @@ func (s *Store) DeviceGetEnrollmentByID(deviceID string) (*domain.Enrollment, er
 	}
 
 	domain.Enrollment{}.FromRegisteredDeviceModel(&registeredDevice, &d)
+	if err := s.decryptCredentials(d.ID, &d.Credentials); err != nil {
+		return &d, err
+	}
 
 	// Get the organization details for the device
 	org, err := s.OrganizationGet(d.Organization.ID)
@@ -144,6 +196,9 @@ func (s *Store) DeviceList(orgID string) ([]domain.Enrollment, error) {
 	for _, d := range dbDevices {
 		device := domain.Enrollment{}
 		domain.Enrollment{}.FromRegisteredDeviceModel(&d, &device)
+		if err := s.decryptCredentials(device.ID, &device.Credentials); err != nil {
+			return devices, err
+		}
 		devices = append(devices, device)
 	}
 
@@ -162,3 +217,247 @@ func (s *Store) DeviceUpdate(deviceID string, status models.Status, deviceData s
 
 	return res.Error
 }
+
+// DeviceCredentialsUpdate replaces the credentials of a device registration
+func (s *Store) DeviceCredentialsUpdate(deviceID string, credentials domain.Credentials) error {
+	privateKey, err := s.encrypt(credentials.PrivateKey, deviceKeyData(deviceID))
+	if err != nil {
+		return fmt.Errorf("error encrypting device key: %w", err)
+	}
+
+	// The fields are selected so that an empty private key, for a certificate signed from a CSR, is stored too
+	res := s.gormDB.Model(&models.RegisteredDevice{}).
+		Where("device_id = ?", deviceID).
+		Select("PrivateKey", "Certificate", "CertificateSerial", "CertificateExpiresAt", "MQTTURL", "MQTTPort").
+		Updates(&models.RegisteredDevice{
+			PrivateKey:           privateKey,
+			Certificate:          credentials.Certificate,
+			CertificateSerial:    credentials.SerialNumber,
+			CertificateExpiresAt: credentials.ExpiresAt,
+			MQTTURL:              credentials.MQTTURL,
+			MQTTPort:             credentials.MQTTPort,
+		})
+	if res.Error != nil {
+		return fmt.Errorf("error updating device credentials: %w", res.Error)
+	}
+
+	return nil
+}
+
+// DeviceTransfer moves a device registration to another organization and replaces its credentials,
+// which are issued for the new organization
+func (s *Store) DeviceTransfer(deviceID, orgID string, credentials domain.Credentials) error {
+	privateKey, err := s.encrypt(credentials.PrivateKey, deviceKeyData(deviceID))
+	if err != nil {
+		return fmt.Errorf("error encrypting device key: %w", err)
+	}
+
+	res := s.gormDB.Model(&models.RegisteredDevice{}).
+		Where("device_id = ?", deviceID).
+		Select("OrgID", "PrivateKey", "Certificate", "CertificateSerial", "CertificateExpiresAt", "MQTTURL", "MQTTPort").
+		Updates(&models.RegisteredDevice{
+			OrgID:                orgID,
+			PrivateKey:           privateKey,
+			Certificate:          credentials.Certificate,
+			CertificateSerial:    credentials.SerialNumber,
+			CertificateExpiresAt: credentials.ExpiresAt,
+			MQTTURL:              credentials.MQTTURL,
+			MQTTPort:             credentials.MQTTPort,
+		})
+	if res.Error != nil {
+		return fmt.Errorf("error transferring device: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeviceListExpiring fetches the device registrations of an organization with certificates expiring before a time
+func (s *Store) DeviceListExpiring(orgID string, before time.Time) ([]domain.Enrollment, error) {
+	devices := []domain.Enrollment{}
+
+	dbDevices := []models.RegisteredDevice{}
+	res := s.gormDB.Model(&models.RegisteredDevice{}).
+		Where("org_id = ? AND cred_expires_at < ?", orgID, before).
+		Order("cred_expires_at").
+		Find(&dbDevices)
+	if res.Error != nil {
+		return devices, fmt.Errorf("error listing expiring devices: %w", res.Error)
+	}
+
+	for _, d := range dbDevices {
+		device := domain.Enrollment{}
+		domain.Enrollment{}.FromRegisteredDeviceModel(&d, &device)
+		if err := s.decryptCredentials(device.ID, &device.Credentials); err != nil {
+			return devices, err
+		}
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// DeviceListDeleted lists the soft deleted devices of an organization, most recently deleted first
+func (s *Store) DeviceListDeleted(orgID string) ([]domain.Enrollment, error) {
+	devices := []domain.Enrollment{}
+
+	dbDevices := []models.RegisteredDevice{}
+	res := s.gormDB.Unscoped().Model(&models.RegisteredDevice{}).
+		Where("org_id = ? AND deleted_at IS NOT NULL", orgID).
+		Order("deleted_at desc").
+		Find(&dbDevices)
+	if res.Error != nil {
+		return devices, fmt.Errorf("error listing deleted devices: %w", res.Error)
+	}
+
+	for _, d := range dbDevices {
+		device := domain.Enrollment{}
+		domain.Enrollment{}.FromRegisteredDeviceModel(&d, &device)
+		if err := s.decryptCredentials(device.ID, &device.Credentials); err != nil {
+			return devices, err
+		}
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// DeviceSummaryList lists the device registrations of every organization, including the soft deleted ones. The
+// credentials are not read, so that the private keys are not decrypted.
+func (s *Store) DeviceSummaryList() ([]datastore.DeviceSummary, error) {
+	dbDevices := []models.RegisteredDevice{}
+	res := s.gormDB.Unscoped().Select("device_id", "org_id", "status", "deleted_at").Order("id").Find(&dbDevices)
+	if res.Error != nil {
+		return nil, fmt.Errorf("error listing devices: %w", res.Error)
+	}
+
+	devices := []datastore.DeviceSummary{}
+	for _, d := range dbDevices {
+		devices = append(devices, deviceSummary(d))
+	}
+	return devices, nil
+}
+
+// DeviceSummaryGet fetches a device registration, even when it is soft deleted, without its credentials
+func (s *Store) DeviceSummaryGet(deviceID string) (*datastore.DeviceSummary, error) {
+	d := models.RegisteredDevice{}
+	res := s.gormDB.Unscoped().Select("device_id", "org_id", "status", "deleted_at").Where("device_id = ?", deviceID).First(&d)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, sql.ErrNoRows
+	}
+	if res.Error != nil {
+		return nil, fmt.Errorf("error fetching device: %w", res.Error)
+	}
+
+	summary := deviceSummary(d)
+	return &summary, nil
+}
+
+func deviceSummary(d models.RegisteredDevice) datastore.DeviceSummary {
+	return datastore.DeviceSummary{
+		ID:             d.DeviceID,
+		OrganizationID: d.OrgID,
+		Status:         d.Status,
+		Deleted:        d.DeletedAt.Valid,
+	}
+}
+
+// DeviceRestore restores a soft deleted device, unless its serial number has been registered again
+func (s *Store) DeviceRestore(deviceID string) error {
+	return s.gormDB.Transaction(func(tx *gorm.DB) error {
+		deleted := models.RegisteredDevice{}
+		res := tx.Unscoped().Select("brand", "model", "serial_number").
+			Where("device_id = ? AND deleted_at IS NOT NULL", deviceID).
+			First(&deleted)
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return sql.ErrNoRows
+		}
+		if res.Error != nil {
+			return fmt.Errorf("error restoring device: %w", res.Error)
+		}
+
+		var live int64
+		res = tx.Model(&models.RegisteredDevice{}).
+			Where("brand = ? AND model = ? AND serial_number = ?", deleted.Brand, deleted.DeviceModel, deleted.SerialNumber).
+			Count(&live)
+		if res.Error != nil {
+			return fmt.Errorf("error restoring device: %w", res.Error)
+		}
+		if live > 0 {
+			return fmt.Errorf("the device `%s/%s/%s` is already registered", deleted.Brand, deleted.DeviceModel, deleted.SerialNumber)
+		}
+
+		res = tx.Unscoped().Model(&models.RegisteredDevice{}).
+			Where("device_id = ? AND deleted_at IS NOT NULL", deviceID).
+			Update("deleted_at", nil)
+		if res.Error != nil {
+			return fmt.Errorf("error restoring device: %w", res.Error)
+		}
+		return nil
+	})
+}
+
+// DevicePurge hard deletes the devices soft deleted before a time, returning their IDs. A dry run only lists them.
+// The revoked certificates of the devices are kept, for the revocation list.
+func (s *Store) DevicePurge(deletedBefore time.Time, dryRun bool) ([]string, error) {
+	deviceIDs := []string{}
+	res := s.gormDB.Unscoped().Model(&models.RegisteredDevice{}).
+		Where("deleted_at < ?", deletedBefore).
+		Order("deleted_at").
+		Pluck("device_id", &deviceIDs)
+	if res.Error != nil {
+		return nil, fmt.Errorf("error listing deleted devices: %w", res.Error)
+	}
+	if dryRun || len(deviceIDs) == 0 {
+		return deviceIDs, nil
+	}
+
+	res = s.gormDB.Unscoped().Where("device_id IN ?", deviceIDs).Delete(&models.RegisteredDevice{})
+	if res.Error != nil {
+		return nil, fmt.Errorf("error purging deleted devices: %w", res.Error)
+	}
+	return deviceIDs, nil
+}
+
+// backfillCredentialDetails stores the serial number and expiry of certificates issued before they were recorded
+func (s *Store) backfillCredentialDetails() error {
+	dbDevices := []models.RegisteredDevice{}
+	res := s.gormDB.Where("cred_serial = '' AND cred_cert <> ''").Find(&dbDevices)
+	if res.Error != nil {
+		return fmt.Errorf("error finding devices without certificate details: %w", res.Error)
+	}
+
+	for _, d := range dbDevices {
+		serialNumber, expiresAt, err := certificateDetails(d.Certificate)
+		if err != nil {
+			datastore.Logger.Errorf("Cannot read the certificate of device %s: %v", d.DeviceID, err)
+			continue
+		}
+
+		res = s.gormDB.Model(&models.RegisteredDevice{}).
+			Where("device_id = ?", d.DeviceID).
+			Updates(&models.RegisteredDevice{CertificateSerial: serialNumber, CertificateExpiresAt: &expiresAt})
+		if res.Error != nil {
+			return fmt.Errorf("error storing certificate details of device %s: %w", d.DeviceID, res.Error)
+		}
+	}
+
+	return nil
+}
+
+// certificateDetails returns the serial number, in hex, and the expiry of a PEM encoded certificate
+func certificateDetails(certPEM []byte) (string, time.Time, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse certificate PEM")
+	}
+
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return c.SerialNumber.Text(16), c.NotAfter, nil
+}
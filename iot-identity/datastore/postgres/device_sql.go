@@ -20,22 +20,18 @@
 package postgres
 
 const createDeviceSQL = `
-insert into device (device_id, org_id, brand, model, serial_number, cred_key, cred_cert, cred_mqtt, cred_port, device_data)
-values ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING id`
+insert into device (device_id, org_id, brand, model, serial_number, cred_key, cred_cert, cred_mqtt, cred_port, device_data, cred_serial, cred_expires_at)
+values ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) RETURNING id`
 
 const getDeviceSQL = `
-select device_id, org_id, brand, model, serial_number, cred_key, cred_cert, cred_mqtt, cred_port, store_id, device_key, status, device_data
+select device_id, org_id, brand, model, serial_number, cred_key, cred_cert, cred_mqtt, cred_port, store_id, device_key, status, device_data, cred_serial, cred_expires_at
 from device
-where brand=$1 and model=$2 and serial_number=$3`
-
-const deleteDeviceByID = `
-delete from device where device_id=$1
-`
+where brand=$1 and model=$2 and serial_number=$3 and deleted_at is null`
 
 const enrollDeviceSQL = `
 update device
 set store_id=$4, device_key=$5, status=$6
-where brand=$1 and model=$2 and serial_number=$3
+where brand=$1 and model=$2 and serial_number=$3 and deleted_at is null
 `
 
 const listDeviceSQL = `
@@ -0,0 +1,182 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/models"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// EnrollmentRequestCreate stores the first enrollment attempt of a device
+func (s *Store) EnrollmentRequestCreate(request domain.EnrollmentRequest) (uint, error) {
+	r := enrollmentRequestToModel(request)
+	r.ID = 0
+	if res := s.gormDB.Create(&r); res.Error != nil {
+		return 0, fmt.Errorf("error storing enrollment request: %w", res.Error)
+	}
+	return r.ID, nil
+}
+
+// EnrollmentRequestGet fetches an enrollment request
+func (s *Store) EnrollmentRequestGet(id uint) (*domain.EnrollmentRequest, error) {
+	return s.enrollmentRequestFind(s.gormDB.Where("id = ?", id))
+}
+
+// EnrollmentRequestGetByDevice fetches the enrollment request of a device
+func (s *Store) EnrollmentRequestGetByDevice(brand, model, serial string) (*domain.EnrollmentRequest, error) {
+	return s.enrollmentRequestFind(s.gormDB.Where("brand = ? AND model = ? AND serial_number = ?", brand, model, serial))
+}
+
+func (s *Store) enrollmentRequestFind(query *gorm.DB) (*domain.EnrollmentRequest, error) {
+	var r models.EnrollmentRequest
+	res := query.First(&r)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, sql.ErrNoRows
+	}
+	if res.Error != nil {
+		return nil, fmt.Errorf("error retrieving enrollment request: %w", res.Error)
+	}
+
+	request := enrollmentRequestFromModel(r)
+	return &request, nil
+}
+
+// EnrollmentRequestList fetches the enrollment requests with a status, or all of them, most recent attempt first
+func (s *Store) EnrollmentRequestList(status string) ([]domain.EnrollmentRequest, error) {
+	query := s.gormDB.Order("last_attempt_at desc")
+	if len(status) > 0 {
+		query = query.Where("status = ?", status)
+	}
+
+	var list []models.EnrollmentRequest
+	if res := query.Find(&list); res.Error != nil {
+		return nil, fmt.Errorf("error retrieving enrollment requests: %w", res.Error)
+	}
+
+	requests := make([]domain.EnrollmentRequest, 0, len(list))
+	for _, r := range list {
+		requests = append(requests, enrollmentRequestFromModel(r))
+	}
+	return requests, nil
+}
+
+// EnrollmentRequestCount counts the enrollment requests with a status
+func (s *Store) EnrollmentRequestCount(status string) (int, error) {
+	var count int64
+	if res := s.gormDB.Model(&models.EnrollmentRequest{}).Where("status = ?", status).Count(&count); res.Error != nil {
+		return 0, fmt.Errorf("error counting enrollment requests: %w", res.Error)
+	}
+	return int(count), nil
+}
+
+// EnrollmentRequestUpdate replaces an enrollment request
+func (s *Store) EnrollmentRequestUpdate(request domain.EnrollmentRequest) error {
+	r := enrollmentRequestToModel(request)
+	res := s.gormDB.Model(&r).
+		Select("store_id", "device_key", "model_headers", "serial_headers", "source_ip", "reason", "status", "attempts",
+			"last_attempt_at", "organization_id", "device_id", "decided_by", "decided_at", "enrolled_at").
+		Updates(&r)
+	if res.Error != nil {
+		return fmt.Errorf("error updating enrollment request %d: %w", request.ID, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func enrollmentRequestFromModel(r models.EnrollmentRequest) domain.EnrollmentRequest {
+	return domain.EnrollmentRequest{
+		ID:             r.ID,
+		Brand:          r.Brand,
+		Model:          r.DeviceModel,
+		SerialNumber:   r.SerialNumber,
+		StoreID:        r.StoreID,
+		DeviceKey:      r.DeviceKey,
+		ModelHeaders:   decodeHeaders(r.ModelHeaders),
+		SerialHeaders:  decodeHeaders(r.SerialHeaders),
+		SourceIP:       r.SourceIP,
+		Reason:         r.Reason,
+		Status:         r.Status,
+		Attempts:       r.Attempts,
+		FirstAttemptAt: r.CreatedAt,
+		LastAttemptAt:  r.LastAttemptAt,
+		OrganizationID: r.OrganizationID,
+		DeviceID:       r.DeviceID,
+		DecidedBy:      r.DecidedBy,
+		DecidedAt:      r.DecidedAt,
+		EnrolledAt:     r.EnrolledAt,
+	}
+}
+
+func enrollmentRequestToModel(request domain.EnrollmentRequest) models.EnrollmentRequest {
+	r := models.EnrollmentRequest{
+		Brand:          request.Brand,
+		DeviceModel:    request.Model,
+		SerialNumber:   request.SerialNumber,
+		StoreID:        request.StoreID,
+		DeviceKey:      request.DeviceKey,
+		ModelHeaders:   encodeHeaders(request.ModelHeaders),
+		SerialHeaders:  encodeHeaders(request.SerialHeaders),
+		SourceIP:       request.SourceIP,
+		Reason:         request.Reason,
+		Status:         request.Status,
+		Attempts:       request.Attempts,
+		LastAttemptAt:  request.LastAttemptAt,
+		OrganizationID: request.OrganizationID,
+		DeviceID:       request.DeviceID,
+		DecidedBy:      request.DecidedBy,
+		DecidedAt:      request.DecidedAt,
+		EnrolledAt:     request.EnrolledAt,
+	}
+	r.ID = request.ID
+	return r
+}
+
+// encodeHeaders stores the headers of an assertion as JSON
+func encodeHeaders(headers map[string]interface{}) string {
+	if len(headers) == 0 {
+		return ""
+	}
+	b, err := json.Marshal(headers)
+	if err != nil {
+		log.Errorf("Cannot encode assertion headers: %v", err)
+		return ""
+	}
+	return string(b)
+}
+
+func decodeHeaders(value string) map[string]interface{} {
+	headers := map[string]interface{}{}
+	if len(value) == 0 {
+		return headers
+	}
+	if err := json.Unmarshal([]byte(value), &headers); err != nil {
+		log.Errorf("Cannot decode the stored assertion headers: %v", err)
+	}
+	return headers
+}
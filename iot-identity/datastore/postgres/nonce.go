@@ -0,0 +1,57 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/iot-identity/models"
+)
+
+// NonceCreate stores a nonce that can be used once until it expires, and deletes the nonces that have expired
+func (s *Store) NonceCreate(nonce string, expiresAt time.Time) error {
+	res := s.gormDB.Where("expires_at < ?", time.Now()).Delete(&models.Nonce{})
+	if res.Error != nil {
+		return fmt.Errorf("error deleting expired nonces: %w", res.Error)
+	}
+
+	res = s.gormDB.Create(&models.Nonce{Nonce: nonce, ExpiresAt: expiresAt})
+	if res.Error != nil {
+		return fmt.Errorf("error creating nonce: %w", res.Error)
+	}
+
+	return nil
+}
+
+// NonceConsume uses a nonce, it fails when the nonce is unknown, already used or expired. The nonce is deleted in
+// the same statement that checks it, so concurrent requests can't both use it.
+func (s *Store) NonceConsume(nonce string) error {
+	res := s.gormDB.Where("nonce = ? AND expires_at >= ?", nonce, time.Now()).Delete(&models.Nonce{})
+	if res.Error != nil {
+		return fmt.Errorf("error using nonce: %w", res.Error)
+	}
+
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("the nonce is unknown, already used or expired")
+	}
+
+	return nil
+}
@@ -21,6 +21,8 @@ package postgres
 
 import (
 	"database/sql"
+	"fmt"
+
 	"github.com/everactive/dmscore/iot-identity/datastore"
 	"github.com/everactive/dmscore/iot-identity/domain"
 	"github.com/everactive/dmscore/iot-identity/models"
@@ -30,12 +32,17 @@ import (
 func (s *Store) OrganizationNew(org datastore.OrganizationNewRequest) (string, error) {
 	// var id int64
 	var orgID = datastore.GenerateID()
+	rootKey, err := s.encrypt(org.ServerKey, organizationKeyData(orgID, rootKeyColumn))
+	if err != nil {
+		return "", fmt.Errorf("error encrypting organization key: %w", err)
+	}
+
 	res := s.gormDB.Create(&models.Organization{
 		OrgId:       orgID,
 		Name:        org.Name,
 		CountryName: org.CountryName,
 		RootCert:    string(org.ServerCert),
-		RootKey:     string(org.ServerKey),
+		RootKey:     string(rootKey),
 	})
 
 	if res.Error != nil {
@@ -79,11 +86,12 @@ func (s *Store) OrganizationGet(orgID string) (*domain.Organization, error) {
 	var countryName string
 	org := domain.Organization{}
 
-	err := s.QueryRow(getOrganizationSQL, orgID).Scan(&id, &org.ID, &org.Name, &countryName, &org.RootCert, &org.RootKey)
+	err := s.QueryRow(getOrganizationSQL, orgID).Scan(&id, &org.ID, &org.Name, &countryName, &org.RootCert, &org.RootKey, &org.PreviousRootCert, &org.PreviousRootKey, &org.PreviousRootExpiresAt)
 	if err != nil {
 		datastore.Logger.Errorf("Error retrieving organization %v: %v\n", orgID, err)
+		return &org, err
 	}
-	return &org, err
+	return &org, s.decryptOrganization(&org)
 }
 
 // OrganizationGetByName fetches an organization by name
@@ -92,9 +100,41 @@ func (s *Store) OrganizationGetByName(name string) (*domain.Organization, error)
 	var countryName string
 	org := domain.Organization{}
 
-	err := s.QueryRow(getOrganizationByNameSQL, name).Scan(&id, &org.ID, &org.Name, &countryName, &org.RootCert, &org.RootKey)
+	err := s.QueryRow(getOrganizationByNameSQL, name).Scan(&id, &org.ID, &org.Name, &countryName, &org.RootCert, &org.RootKey, &org.PreviousRootCert, &org.PreviousRootKey, &org.PreviousRootExpiresAt)
 	if err != nil {
 		datastore.Logger.Errorf("Error retrieving organization `%v`: %v\n", name, err)
+		return &org, err
+	}
+	return &org, s.decryptOrganization(&org)
+}
+
+// OrganizationCAUpdate replaces the CA of an organization
+func (s *Store) OrganizationCAUpdate(orgID string, ca datastore.OrganizationCAUpdateRequest) error {
+	rootKey, err := s.encrypt(ca.RootKey, organizationKeyData(orgID, rootKeyColumn))
+	if err != nil {
+		return fmt.Errorf("error encrypting organization key: %w", err)
 	}
-	return &org, err
+	previousRootKey, err := s.encrypt(ca.PreviousRootKey, organizationKeyData(orgID, previousRootKeyColumn))
+	if err != nil {
+		return fmt.Errorf("error encrypting organization key: %w", err)
+	}
+
+	res := s.gormDB.Model(&models.Organization{}).
+		Where("org_id = ?", orgID).
+		Select("RootCert", "RootKey", "PreviousRootCert", "PreviousRootKey", "PreviousRootExpiresAt").
+		Updates(&models.Organization{
+			RootCert:              string(ca.RootCert),
+			RootKey:               string(rootKey),
+			PreviousRootCert:      string(ca.PreviousRootCert),
+			PreviousRootKey:       string(previousRootKey),
+			PreviousRootExpiresAt: ca.PreviousExpiresAt,
+		})
+	if res.Error != nil {
+		return fmt.Errorf("error updating organization CA: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
 }
@@ -24,11 +24,11 @@ select id, org_id, name, root_cert
 from organization`
 
 const getOrganizationSQL = `
-select id, org_id, name, country_name, root_cert, root_key
+select id, org_id, name, country_name, root_cert, root_key, previous_root_cert, previous_root_key, previous_root_expires_at
 from organization
 where org_id=$1`
 
 const getOrganizationByNameSQL = `
-select id, org_id, name, country_name, root_cert, root_key
+select id, org_id, name, country_name, root_cert, root_key, previous_root_cert, previous_root_key, previous_root_expires_at
 from organization
 where name=$1`
@@ -24,6 +24,7 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/kek"
 	"github.com/everactive/dmscore/pkg/migrate"
 	"github.com/spf13/viper"
 
@@ -39,6 +40,7 @@ type Store struct {
 	driver string
 	*sql.DB
 	gormDB *gorm.DB
+	cipher *kek.Cipher
 }
 
 var pgStore *Store
@@ -80,9 +82,32 @@ func openDatabase(driver, dataSource string) *Store {
 		log.Fatalf("Error during migrations, need to manually intervene: %s", err.Error())
 	}
 
-	return &Store{
+	cipher, err := kek.CipherFromConfig(keys.KEK, keys.KEKPrevious)
+	if err != nil {
+		log.Fatalf("Error loading the key encryption key: %v", err)
+	}
+	if !cipher.Enabled() {
+		log.Warnf("No key encryption key is configured, private keys are stored in plaintext")
+	}
+
+	store := &Store{
 		driver: driver,
 		DB:     sqlDB,
 		gormDB: db,
+		cipher: cipher,
 	}
+
+	if err := store.runDataMigration(dataMigrationCredentialDetails, store.backfillCredentialDetails); err != nil {
+		log.Errorf("Error storing certificate details of existing devices: %v", err)
+	}
+
+	// Keys stored while encryption is disabled are encrypted by rotate-kek, so the migration only runs, and is only
+	// recorded, once encryption is enabled
+	if cipher.Enabled() {
+		if err := store.runDataMigration(dataMigrationEncryptPrivateKeys, store.encryptPrivateKeys); err != nil {
+			log.Errorf("Error encrypting the private keys of existing organizations and devices: %v", err)
+		}
+	}
+
+	return store
 }
@@ -0,0 +1,177 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/datastore"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/kek"
+	"github.com/everactive/dmscore/iot-identity/models"
+	"github.com/spf13/viper"
+)
+
+// Columns of the encrypted private keys, which the encrypted values are bound to with their row
+const (
+	rootKeyColumn         = "root_key"
+	previousRootKeyColumn = "previous_root_key"
+	credKeyColumn         = "cred_key"
+)
+
+// organizationKeyData is the additional data a key of an organization is encrypted with, so that it can't be
+// decrypted when it is copied to another organization or column
+func organizationKeyData(orgID, column string) []byte {
+	return []byte("organization/" + orgID + "/" + column)
+}
+
+// deviceKeyData is the additional data the key of a device is encrypted with
+func deviceKeyData(deviceID string) []byte {
+	return []byte("registered_device/" + deviceID + "/" + credKeyColumn)
+}
+
+// kekContext bounds a call to the key encryption key provider
+func kekContext(parent context.Context) (context.Context, context.CancelFunc) {
+	timeout := viper.GetDuration(keys.KEKTimeout)
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+func (s *Store) encrypt(plaintext, additionalData []byte) ([]byte, error) {
+	ctx, cancel := kekContext(context.Background())
+	defer cancel()
+	return s.cipher.Encrypt(ctx, plaintext, additionalData)
+}
+
+func (s *Store) decrypt(value, additionalData []byte) ([]byte, error) {
+	ctx, cancel := kekContext(context.Background())
+	defer cancel()
+	return s.cipher.Decrypt(ctx, value, additionalData)
+}
+
+func (s *Store) rewrap(ctx context.Context, value, additionalData []byte) ([]byte, bool, error) {
+	ctx, cancel := kekContext(ctx)
+	defer cancel()
+	return s.cipher.Rewrap(ctx, value, additionalData)
+}
+
+// PrivateKeysRewrap encrypts the private keys of organizations and devices with the current key encryption key,
+// rewrapping the data keys of values encrypted with a previous one. It can be run again if it is interrupted.
+func (s *Store) PrivateKeysRewrap(ctx context.Context) (int, error) {
+	if !s.cipher.Enabled() {
+		return 0, fmt.Errorf("no key encryption key is configured")
+	}
+	return s.rewrapPrivateKeys(ctx, s.cipher.CurrentPrefix())
+}
+
+// encryptPrivateKeys encrypts the private keys that are stored in plaintext, from before encryption was enabled,
+// and binds the ones encrypted before the additional data was added to their row and column
+func (s *Store) encryptPrivateKeys() error {
+	count, err := s.rewrapPrivateKeys(context.Background(), kek.Prefix)
+	if count > 0 {
+		datastore.Logger.Infof("Encrypted %d private keys", count)
+	}
+	return err
+}
+
+// rewrapPrivateKeys rewraps the private keys that don't start with prefix
+func (s *Store) rewrapPrivateKeys(ctx context.Context, prefix string) (int, error) {
+	count := 0
+
+	orgs := []models.Organization{}
+	res := s.gormDB.Where("(root_key <> '' AND NOT starts_with(root_key, ?)) OR (previous_root_key <> '' AND NOT starts_with(previous_root_key, ?))", prefix, prefix).
+		Find(&orgs)
+	if res.Error != nil {
+		return count, fmt.Errorf("error finding organization keys: %w", res.Error)
+	}
+
+	for _, o := range orgs {
+		rootKey, changed, err := s.rewrap(ctx, []byte(o.RootKey), organizationKeyData(o.OrgId, rootKeyColumn))
+		if err != nil {
+			return count, fmt.Errorf("error encrypting the key of organization %s: %w", o.OrgId, err)
+		}
+		previousRootKey, previousChanged, err := s.rewrap(ctx, []byte(o.PreviousRootKey), organizationKeyData(o.OrgId, previousRootKeyColumn))
+		if err != nil {
+			return count, fmt.Errorf("error encrypting the previous key of organization %s: %w", o.OrgId, err)
+		}
+		res = s.gormDB.Model(&models.Organization{}).
+			Where("org_id = ?", o.OrgId).
+			Select("RootKey", "PreviousRootKey").
+			Updates(&models.Organization{RootKey: string(rootKey), PreviousRootKey: string(previousRootKey)})
+		if res.Error != nil {
+			return count, fmt.Errorf("error storing the keys of organization %s: %w", o.OrgId, res.Error)
+		}
+		if changed {
+			count++
+		}
+		if previousChanged {
+			count++
+		}
+	}
+
+	devices := []models.RegisteredDevice{}
+	res = s.gormDB.Where("cred_key <> '' AND NOT starts_with(cred_key, ?)", prefix).Find(&devices)
+	if res.Error != nil {
+		return count, fmt.Errorf("error finding device keys: %w", res.Error)
+	}
+
+	for _, d := range devices {
+		privateKey, changed, err := s.rewrap(ctx, d.PrivateKey, deviceKeyData(d.DeviceID))
+		if err != nil {
+			return count, fmt.Errorf("error encrypting the key of device %s: %w", d.DeviceID, err)
+		}
+		if !changed {
+			continue
+		}
+
+		res = s.gormDB.Model(&models.RegisteredDevice{}).
+			Where("device_id = ?", d.DeviceID).
+			Update("PrivateKey", privateKey)
+		if res.Error != nil {
+			return count, fmt.Errorf("error storing the key of device %s: %w", d.DeviceID, res.Error)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func (s *Store) decryptOrganization(org *domain.Organization) error {
+	var err error
+	if org.RootKey, err = s.decrypt(org.RootKey, organizationKeyData(org.ID, rootKeyColumn)); err != nil {
+		return fmt.Errorf("error decrypting the key of organization %s: %w", org.ID, err)
+	}
+	if org.PreviousRootKey, err = s.decrypt(org.PreviousRootKey, organizationKeyData(org.ID, previousRootKeyColumn)); err != nil {
+		return fmt.Errorf("error decrypting the previous key of organization %s: %w", org.ID, err)
+	}
+	return nil
+}
+
+func (s *Store) decryptCredentials(deviceID string, credentials *domain.Credentials) error {
+	var err error
+	if credentials.PrivateKey, err = s.decrypt(credentials.PrivateKey, deviceKeyData(deviceID)); err != nil {
+		return fmt.Errorf("error decrypting the key of device %s: %w", deviceID, err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS revoked_certificate (
+    id                serial primary key not null,
+    created_at        TIMESTAMP WITH TIME ZONE,
+    updated_at        TIMESTAMP WITH TIME ZONE,
+    deleted_at        TIMESTAMP WITH TIME ZONE,
+    issuer            varchar(200) not null,
+    serial_number     varchar(200) not null,
+    device_id         varchar(200) not null,
+    org_id            varchar(200) not null,
+    reason            int not null default 0,
+    revoked_at        TIMESTAMP WITH TIME ZONE not null,
+
+    UNIQUE (issuer, serial_number, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS revoked_certificate_device_id_idx ON revoked_certificate (device_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS device_cred_expires_at_idx;
+
+ALTER TABLE device
+    DROP COLUMN cred_expires_at;
+
+ALTER TABLE device
+    DROP COLUMN cred_serial;
@@ -0,0 +1,7 @@
+ALTER TABLE device
+    ADD cred_serial varchar(200) NOT NULL DEFAULT '';
+
+ALTER TABLE device
+    ADD cred_expires_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS device_cred_expires_at_idx ON device (cred_expires_at);
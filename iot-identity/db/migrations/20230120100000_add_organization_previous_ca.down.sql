@@ -0,0 +1,8 @@
+ALTER TABLE organization
+    DROP COLUMN previous_root_expires_at;
+
+ALTER TABLE organization
+    DROP COLUMN previous_root_key;
+
+ALTER TABLE organization
+    DROP COLUMN previous_root_cert;
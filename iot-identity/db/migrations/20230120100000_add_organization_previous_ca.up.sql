@@ -0,0 +1,8 @@
+ALTER TABLE organization
+    ADD previous_root_cert text NOT NULL DEFAULT '';
+
+ALTER TABLE organization
+    ADD previous_root_key text NOT NULL DEFAULT '';
+
+ALTER TABLE organization
+    ADD previous_root_expires_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS account_key (
+    id                serial primary key not null,
+    created_at        TIMESTAMP WITH TIME ZONE,
+    updated_at        TIMESTAMP WITH TIME ZONE,
+    deleted_at        TIMESTAMP WITH TIME ZONE,
+    sign_key_id       varchar(200) not null,
+    account_id        varchar(200) not null default '',
+    name              varchar(200) not null default '',
+    source            varchar(20) not null,
+    assertion         text not null default '',
+    since             TIMESTAMP WITH TIME ZONE,
+    until             TIMESTAMP WITH TIME ZONE,
+    refreshed_at      TIMESTAMP WITH TIME ZONE,
+    refresh_error     text not null default '',
+
+    UNIQUE (sign_key_id)
+);
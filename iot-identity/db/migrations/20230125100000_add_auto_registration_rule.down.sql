@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS auto_registration;
+DROP TABLE IF EXISTS auto_registration_rule;
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS auto_registration_rule (
+    id                serial primary key not null,
+    created_at        TIMESTAMP WITH TIME ZONE,
+    updated_at        TIMESTAMP WITH TIME ZONE,
+    deleted_at        TIMESTAMP WITH TIME ZONE,
+    name              varchar(200) not null default '',
+    priority          int not null default 0,
+    brand             varchar(200) not null default '',
+    model             varchar(200) not null default '',
+    sign_key_id       varchar(200) not null default '',
+    serial_pattern    varchar(200) not null default '',
+    store_id          varchar(200) not null default '',
+    organization_id   varchar(200) not null default '',
+    device_groups     text not null default '',
+    device_data       text not null default '',
+    pending_approval  bool not null default false
+);
+
+CREATE TABLE IF NOT EXISTS auto_registration (
+    id                serial primary key not null,
+    created_at        TIMESTAMP WITH TIME ZONE,
+    updated_at        TIMESTAMP WITH TIME ZONE,
+    deleted_at        TIMESTAMP WITH TIME ZONE,
+    device_id         varchar(200) not null,
+    rule_id           int not null default 0,
+    organization_id   varchar(200) not null,
+    device_groups     text not null default '',
+    groups_applied    bool not null default false,
+
+    UNIQUE (device_id)
+);
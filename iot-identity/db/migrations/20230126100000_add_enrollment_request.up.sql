@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS enrollment_request (
+    id                serial primary key not null,
+    created_at        TIMESTAMP WITH TIME ZONE,
+    updated_at        TIMESTAMP WITH TIME ZONE,
+    deleted_at        TIMESTAMP WITH TIME ZONE,
+    brand             varchar(200) not null,
+    model             varchar(200) not null,
+    serial_number     varchar(200) not null,
+    store_id          varchar(200) not null default '',
+    device_key        text not null default '',
+    model_headers     text not null default '',
+    serial_headers    text not null default '',
+    source_ip         varchar(200) not null default '',
+    reason            text not null default '',
+    status            varchar(20) not null,
+    attempts          int not null default 0,
+    last_attempt_at   TIMESTAMP WITH TIME ZONE,
+    organization_id   varchar(200) not null default '',
+    device_id         varchar(200) not null default '',
+    decided_by        varchar(200) not null default '',
+    decided_at        TIMESTAMP WITH TIME ZONE,
+
+    UNIQUE (brand, model, serial_number)
+);
+
+CREATE INDEX IF NOT EXISTS enrollment_request_status_idx ON enrollment_request (status);
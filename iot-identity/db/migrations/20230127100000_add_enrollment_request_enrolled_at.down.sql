@@ -0,0 +1,2 @@
+ALTER TABLE enrollment_request
+    DROP COLUMN enrolled_at;
@@ -0,0 +1,2 @@
+ALTER TABLE enrollment_request
+    ADD enrolled_at TIMESTAMP WITH TIME ZONE;
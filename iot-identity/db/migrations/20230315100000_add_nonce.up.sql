@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS nonce (
+    nonce             varchar(200) primary key not null,
+    expires_at        TIMESTAMP WITH TIME ZONE not null
+);
+
+CREATE INDEX IF NOT EXISTS nonce_expires_at_idx ON nonce (expires_at);
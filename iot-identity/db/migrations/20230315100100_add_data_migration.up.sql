@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS data_migration (
+    name              varchar(200) primary key not null,
+    completed_at      TIMESTAMP WITH TIME ZONE not null
+);
@@ -0,0 +1,3 @@
+ALTER TABLE account_key DROP CONSTRAINT IF EXISTS account_key_sign_key_id_source_key;
+DELETE FROM account_key a USING account_key b WHERE a.sign_key_id = b.sign_key_id AND a.id > b.id;
+ALTER TABLE account_key ADD CONSTRAINT account_key_sign_key_id_key UNIQUE (sign_key_id);
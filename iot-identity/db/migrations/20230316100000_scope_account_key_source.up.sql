@@ -0,0 +1,3 @@
+-- The same account key can come from the files, the store and the API, each source keeps its own assertion
+ALTER TABLE account_key DROP CONSTRAINT IF EXISTS account_key_sign_key_id_key;
+ALTER TABLE account_key ADD CONSTRAINT account_key_sign_key_id_source_key UNIQUE (sign_key_id, source);
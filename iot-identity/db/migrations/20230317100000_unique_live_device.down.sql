@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS device_brand_model_serial_number_live_idx;
+DELETE FROM device a USING device b WHERE a.brand = b.brand AND a.model = b.model AND a.serial_number = b.serial_number AND a.deleted_at IS NOT NULL AND a.id <> b.id;
+ALTER TABLE device ADD CONSTRAINT device_brand_model_serial_number_key UNIQUE (brand, model, serial_number);
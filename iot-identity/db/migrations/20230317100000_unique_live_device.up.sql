@@ -0,0 +1,3 @@
+-- A soft deleted device does not stop its serial number being registered again
+ALTER TABLE device DROP CONSTRAINT IF EXISTS device_brand_model_serial_number_key;
+CREATE UNIQUE INDEX IF NOT EXISTS device_brand_model_serial_number_live_idx ON device (brand, model, serial_number) WHERE deleted_at IS NULL;
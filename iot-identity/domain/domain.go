@@ -21,6 +21,8 @@
 package domain
 
 import (
+	"time"
+
 	"github.com/everactive/dmscore/iot-identity/models"
 )
 
@@ -30,6 +32,10 @@ type Organization struct {
 	Name     string `json:"name"`
 	RootCert []byte `json:"rootcert"`
 	RootKey  []byte `json:"-,omitempty"`
+	// The previous CA is kept after a rotation, until it expires, so certificates it signed stay valid meanwhile
+	PreviousRootCert      []byte     `json:"previousRootCert,omitempty"`
+	PreviousRootKey       []byte     `json:"-"`
+	PreviousRootExpiresAt *time.Time `json:"previousRootExpiresAt,omitempty"`
 }
 
 // Device details
@@ -43,10 +49,12 @@ type Device struct {
 
 // Credentials for accessing the MQTT broker
 type Credentials struct {
-	PrivateKey  []byte `json:"privateKey,omitempty"`
-	Certificate []byte `json:"certificate"`
-	MQTTURL     string `json:"mqttUrl"`
-	MQTTPort    string `json:"mqttPort"`
+	PrivateKey   []byte     `json:"privateKey,omitempty"`
+	Certificate  []byte     `json:"certificate"`
+	SerialNumber string     `json:"serialNumber,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	MQTTURL      string     `json:"mqttUrl"`
+	MQTTPort     string     `json:"mqttPort"`
 }
 
 // Enrollment details for a device
@@ -59,6 +67,134 @@ type Enrollment struct {
 	DeviceData   string        `json:"deviceData"`
 }
 
+// RevokedCertificate details of a revoked device certificate. The certificate is identified by the key ID of the CA
+// that issued it, its serial number and the device, as older serial numbers aren't unique. Reason is the RFC 5280 CRL
+// reason code.
+type RevokedCertificate struct {
+	Issuer         string    `json:"issuer"`
+	SerialNumber   string    `json:"serialNumber"`
+	DeviceID       string    `json:"deviceId"`
+	OrganizationID string    `json:"orgId"`
+	Reason         int       `json:"reason"`
+	RevokedAt      time.Time `json:"revokedAt"`
+}
+
+// Sources of account-key assertions
+const (
+	AccountKeySourceStore = "store"
+	AccountKeySourceFile  = "file"
+	AccountKeySourceAPI   = "api"
+)
+
+// AccountKey details of an account-key assertion trusted for auto-registration. Assertion is empty when the key
+// couldn't be loaded from its source, and RefreshError says why.
+type AccountKey struct {
+	SignKeyID    string     `json:"signKeyId"`
+	AccountID    string     `json:"accountId"`
+	Name         string     `json:"name"`
+	Source       string     `json:"source"`
+	Assertion    []byte     `json:"-"`
+	Since        *time.Time `json:"since,omitempty"`
+	Until        *time.Time `json:"until,omitempty"`
+	RefreshedAt  *time.Time `json:"refreshedAt,omitempty"`
+	RefreshError string     `json:"refreshError,omitempty"`
+	// Active is true when the key is currently trusted
+	Active bool `json:"active"`
+}
+
+// AutoRegistrationRule routes devices that auto-register. The empty match fields match any device, SerialPattern
+// is a regular expression that has to match the whole serial number, and SignKeyID is the key that signed the
+// serial assertion. The rules are tried in Priority order, lowest first.
+type AutoRegistrationRule struct {
+	ID              uint     `json:"id"`
+	Name            string   `json:"name"`
+	Priority        int      `json:"priority"`
+	Brand           string   `json:"brand"`
+	Model           string   `json:"model"`
+	SignKeyID       string   `json:"signKeyId"`
+	SerialPattern   string   `json:"serialPattern"`
+	StoreID         string   `json:"storeId"`
+	OrganizationID  string   `json:"orgid"`
+	Groups          []string `json:"groups"`
+	DeviceData      string   `json:"deviceData"`
+	PendingApproval bool     `json:"pendingApproval"`
+}
+
+// AutoRegistration records the rule that registered a device, and the groups it is to be added to when the device
+// twin first hears from it
+type AutoRegistration struct {
+	DeviceID       string   `json:"deviceId"`
+	RuleID         uint     `json:"ruleId"`
+	OrganizationID string   `json:"orgid"`
+	Groups         []string `json:"groups"`
+	GroupsApplied  bool     `json:"groupsApplied"`
+}
+
+// AutoRegistrationEvaluation is the outcome of the auto-registration rules for a model and serial assertion.
+// Rule is nil when the device goes to the default organization.
+type AutoRegistrationEvaluation struct {
+	Eligible        bool                  `json:"eligible"`
+	Reason          string                `json:"reason,omitempty"`
+	Rule            *AutoRegistrationRule `json:"rule,omitempty"`
+	OrganizationID  string                `json:"orgid,omitempty"`
+	Groups          []string              `json:"groups,omitempty"`
+	DeviceData      string                `json:"deviceData,omitempty"`
+	PendingApproval bool                  `json:"pendingApproval"`
+}
+
+// Status of an enrollment request
+const (
+	EnrollmentRequestPending  = "pending"
+	EnrollmentRequestApproved = "approved"
+	EnrollmentRequestRejected = "rejected"
+)
+
+// EnrollmentRequest is an enrollment attempt by a device that isn't registered and couldn't auto-register, or that
+// is already enrolled and needs approval to re-enroll. Reason says why the device couldn't enroll. EnrolledAt is
+// when the device enrolled with the approval, which is then used up.
+type EnrollmentRequest struct {
+	ID             uint                   `json:"id"`
+	Brand          string                 `json:"brand"`
+	Model          string                 `json:"model"`
+	SerialNumber   string                 `json:"serial"`
+	StoreID        string                 `json:"storeId"`
+	DeviceKey      string                 `json:"deviceKey"`
+	ModelHeaders   map[string]interface{} `json:"modelHeaders"`
+	SerialHeaders  map[string]interface{} `json:"serialHeaders"`
+	SourceIP       string                 `json:"sourceIp"`
+	Reason         string                 `json:"reason"`
+	Status         string                 `json:"status"`
+	Attempts       int                    `json:"attempts"`
+	FirstAttemptAt time.Time              `json:"firstAttemptAt"`
+	LastAttemptAt  time.Time              `json:"lastAttemptAt"`
+	OrganizationID string                 `json:"orgid,omitempty"`
+	DeviceID       string                 `json:"deviceId,omitempty"`
+	DecidedBy      string                 `json:"decidedBy,omitempty"`
+	DecidedAt      *time.Time             `json:"decidedAt,omitempty"`
+	EnrolledAt     *time.Time             `json:"enrolledAt,omitempty"`
+}
+
+// Status of a device in a bulk registration
+const (
+	DeviceRegistrationRegistered = "registered"
+	DeviceRegistrationExists     = "exists"
+	DeviceRegistrationInvalid    = "invalid"
+	DeviceRegistrationFailed     = "failed"
+	DeviceRegistrationSkipped    = "skipped"
+)
+
+// DeviceRegistrationResult is the outcome for one device of a bulk registration. Line is the line of the device in
+// the upload.
+type DeviceRegistrationResult struct {
+	Line         int    `json:"line"`
+	Brand        string `json:"brand"`
+	Model        string `json:"model"`
+	SerialNumber string `json:"serial"`
+	ID           string `json:"id,omitempty"`
+	Status       string `json:"status"`
+	Error        string `json:"error,omitempty"`
+}
+
 func (Device) FromRegisteredDeviceModel(m *models.RegisteredDevice, d *Device) *Device {
 	d.DeviceKey = m.DeviceKey
 	d.Model = m.DeviceModel
@@ -72,6 +208,8 @@ func (Credentials) FromRegisteredDeviceModel(m *models.RegisteredDevice, c *Cred
 	c.MQTTURL = m.MQTTURL
 	c.Certificate = m.Certificate
 	c.PrivateKey = m.PrivateKey
+	c.SerialNumber = m.CertificateSerial
+	c.ExpiresAt = m.CertificateExpiresAt
 	c.MQTTPort = m.MQTTPort
 	return c
 }
@@ -0,0 +1,338 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package kek encrypts the private keys stored in the identity database with envelope encryption. Each value is
+// encrypted with its own data key, and the data key is wrapped by a key encryption key (KEK) from a Provider, so
+// rotating the KEK only rewraps the data keys.
+package kek
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// Prefix starts every encrypted value. The value is bound to additional data, such as the row and column it is
+// stored in, so that it can't be decrypted anywhere else.
+const Prefix = "enc:v2:"
+
+// prefixV1 starts the values encrypted before they were bound to additional data. They are still decrypted, and
+// Rewrap encrypts them again with Prefix. Values with neither prefix are stored in plaintext.
+const prefixV1 = "enc:v1:"
+
+// Settings of a key encryption key, relative to its configuration prefix
+const (
+	// ProviderSetting is the name of the provider of the key encryption key
+	ProviderSetting = "provider"
+	// IDSetting identifies the key encryption key in encrypted values, it cannot contain ':'
+	IDSetting = "id"
+)
+
+const dataKeySize = 32
+
+// Provider wraps data keys with a key encryption key. KMS backends implement it by encrypting the data key with a
+// key that never leaves the KMS, the context bounds the call to the KMS.
+type Provider interface {
+	// ID identifies the key encryption key, it is stored with every data key it wraps
+	ID() string
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, error)
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// Factory creates a provider from the settings under a configuration prefix, e.g. identity.kek
+type Factory func(prefix string) (Provider, error)
+
+var (
+	factoriesLock sync.RWMutex
+	factories     = map[string]Factory{
+		LocalProvider: newLocalFromConfig,
+	}
+)
+
+// Register adds a provider that can be selected with the provider setting
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	factories[name] = factory
+}
+
+// FromConfig creates the provider configured under a prefix. It returns nil when no provider is configured.
+func FromConfig(prefix string) (Provider, error) {
+	name := viper.GetString(prefix + "." + ProviderSetting)
+	if len(name) == 0 {
+		return nil, nil
+	}
+
+	factoriesLock.RLock()
+	factory, ok := factories[name]
+	factoriesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown key encryption key provider '%s'", name)
+	}
+
+	p, err := factory(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("error creating key encryption key provider '%s': %w", name, err)
+	}
+	if len(p.ID()) == 0 || strings.Contains(p.ID(), ":") {
+		return nil, fmt.Errorf("invalid key encryption key ID '%s'", p.ID())
+	}
+	return p, nil
+}
+
+// Cipher encrypts values with the current key encryption key, and decrypts values encrypted with any of its keys
+type Cipher struct {
+	current   Provider
+	providers map[string]Provider
+}
+
+// NewCipher creates a cipher that encrypts with current, which may be nil to store values in plaintext. The
+// previous providers are only used to decrypt values, while the key encryption key is rotated.
+func NewCipher(current Provider, previous ...Provider) *Cipher {
+	c := &Cipher{current: current, providers: map[string]Provider{}}
+	for _, p := range append(previous, current) {
+		if p != nil {
+			c.providers[p.ID()] = p
+		}
+	}
+	return c
+}
+
+// Enabled is true when new values are encrypted
+func (c *Cipher) Enabled() bool {
+	return c.current != nil
+}
+
+// CurrentPrefix starts the values encrypted with the current key encryption key
+func (c *Cipher) CurrentPrefix() string {
+	if c.current == nil {
+		return ""
+	}
+	return Prefix + c.current.ID() + ":"
+}
+
+// Encrypt encrypts a value with a new data key, bound to the additional data. Empty values, and all values when no
+// key encryption key is configured, are returned as they are.
+func (c *Cipher) Encrypt(ctx context.Context, plaintext, additionalData []byte) ([]byte, error) {
+	if len(plaintext) == 0 || c.current == nil {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	sealed, err := seal(dataKey, plaintext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := c.current.Wrap(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("error wrapping data key: %w", err)
+	}
+
+	return format(c.current.ID(), wrapped, sealed), nil
+}
+
+// Decrypt decrypts a value from Encrypt, with the additional data it was encrypted with. Values that aren't
+// encrypted are returned as they are.
+func (c *Cipher) Decrypt(ctx context.Context, value, additionalData []byte) ([]byte, error) {
+	if !Encrypted(value) {
+		return value, nil
+	}
+
+	v, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := c.unwrap(ctx, v.id, v.wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if v.legacy {
+		return open(dataKey, v.sealed, nil)
+	}
+	return open(dataKey, v.sealed, additionalData)
+}
+
+// Rewrap encrypts a value with the current key encryption key. An encrypted value keeps its data key, which is
+// rewrapped, and plaintext values are encrypted. Values encrypted without additional data are sealed again, bound
+// to the additional data. It returns false when the value is unchanged.
+func (c *Cipher) Rewrap(ctx context.Context, value, additionalData []byte) ([]byte, bool, error) {
+	if len(value) == 0 || c.current == nil {
+		return value, false, nil
+	}
+	if !Encrypted(value) {
+		encrypted, err := c.Encrypt(ctx, value, additionalData)
+		return encrypted, err == nil, err
+	}
+
+	v, err := parse(value)
+	if err != nil {
+		return nil, false, err
+	}
+	if !v.legacy && v.id == c.current.ID() {
+		return value, false, nil
+	}
+
+	dataKey, err := c.unwrap(ctx, v.id, v.wrapped)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if v.legacy {
+		plaintext, err := open(dataKey, v.sealed, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		if v.sealed, err = seal(dataKey, plaintext, additionalData); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if v.id != c.current.ID() {
+		if v.wrapped, err = c.current.Wrap(ctx, dataKey); err != nil {
+			return nil, false, fmt.Errorf("error wrapping data key: %w", err)
+		}
+	}
+	return format(c.current.ID(), v.wrapped, v.sealed), true, nil
+}
+
+// Encrypted is true when a value was encrypted by a Cipher
+func Encrypted(value []byte) bool {
+	return strings.HasPrefix(string(value), Prefix) || strings.HasPrefix(string(value), prefixV1)
+}
+
+func (c *Cipher) unwrap(ctx context.Context, id string, wrapped []byte) ([]byte, error) {
+	p, ok := c.providers[id]
+	if !ok {
+		return nil, fmt.Errorf("key encryption key '%s' is not configured", id)
+	}
+
+	dataKey, err := p.Unwrap(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key with key encryption key '%s': %w", id, err)
+	}
+	return dataKey, nil
+}
+
+// format encodes an encrypted value as enc:v2:{KEK ID}:{wrapped data key}:{nonce and ciphertext}
+func format(id string, wrapped, sealed []byte) []byte {
+	return []byte(Prefix + id + ":" + base64.StdEncoding.EncodeToString(wrapped) + ":" + base64.StdEncoding.EncodeToString(sealed))
+}
+
+// encryptedValue is a parsed encrypted value, legacy values are not bound to additional data
+type encryptedValue struct {
+	legacy  bool
+	id      string
+	wrapped []byte
+	sealed  []byte
+}
+
+func parse(value []byte) (*encryptedValue, error) {
+	v := &encryptedValue{legacy: strings.HasPrefix(string(value), prefixV1)}
+	encoded := strings.TrimPrefix(string(value), Prefix)
+	if v.legacy {
+		encoded = strings.TrimPrefix(string(value), prefixV1)
+	}
+
+	parts := strings.Split(encoded, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid encrypted value")
+	}
+	v.id = parts[0]
+
+	var err error
+	if v.wrapped, err = base64.StdEncoding.DecodeString(parts[1]); err != nil {
+		return nil, fmt.Errorf("invalid encrypted data key: %w", err)
+	}
+	if v.sealed, err = base64.StdEncoding.DecodeString(parts[2]); err != nil {
+		return nil, fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	return v, nil
+}
+
+// seal encrypts with AES-256-GCM, the random nonce is prepended to the ciphertext
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting value: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// CipherFromConfig creates a cipher from the key encryption key configured under prefix, and the one being rotated
+// out under previousPrefix
+func CipherFromConfig(prefix, previousPrefix string) (*Cipher, error) {
+	current, err := FromConfig(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := FromConfig(previousPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return NewCipher(current), nil
+	}
+	if current == nil {
+		return nil, fmt.Errorf("a previous key encryption key is configured without a current one")
+	}
+	return NewCipher(current, previous), nil
+}
@@ -0,0 +1,110 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package kek
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/scrypt"
+)
+
+// LocalProvider is the name of the provider that holds the key encryption key in memory
+const LocalProvider = "local"
+
+// Settings of the local provider, relative to the configuration prefix
+const (
+	// KeyFileSetting is the path of a file with a 32 byte key, raw or base64 encoded
+	KeyFileSetting = "key.file"
+	// PassphraseSetting is a passphrase the key is derived from, when there is no key file
+	PassphraseSetting = "passphrase"
+)
+
+// scrypt parameters for deriving a key from a passphrase
+const (
+	scryptN = 32768
+	scryptR = 8
+	scryptP = 1
+)
+
+// Local wraps data keys with AES-256-GCM, using a key read from a file or derived from a passphrase
+type Local struct {
+	id  string
+	key []byte
+}
+
+// NewLocal creates a local provider from a 32 byte key
+func NewLocal(id string, key []byte) (*Local, error) {
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("the key encryption key must be %d bytes", dataKeySize)
+	}
+	return &Local{id: id, key: key}, nil
+}
+
+// NewLocalFromPassphrase creates a local provider with a key derived from a passphrase. The ID is the salt, so
+// the same passphrase gives a different key for each ID.
+func NewLocalFromPassphrase(id, passphrase string) (*Local, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("the passphrase must not be empty")
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), []byte("dmscore-kek:"+id), scryptN, scryptR, scryptP, dataKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocal(id, key)
+}
+
+// ID identifies the key encryption key
+func (l *Local) ID() string {
+	return l.id
+}
+
+// Wrap encrypts a data key
+func (l *Local) Wrap(_ context.Context, dataKey []byte) ([]byte, error) {
+	return seal(l.key, dataKey, nil)
+}
+
+// Unwrap decrypts a data key
+func (l *Local) Unwrap(_ context.Context, wrapped []byte) ([]byte, error) {
+	return open(l.key, wrapped, nil)
+}
+
+func newLocalFromConfig(prefix string) (Provider, error) {
+	id := viper.GetString(prefix + "." + IDSetting)
+
+	keyFile := viper.GetString(prefix + "." + KeyFileSetting)
+	if len(keyFile) == 0 {
+		return NewLocalFromPassphrase(id, viper.GetString(prefix+"."+PassphraseSetting))
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the key file: %w", err)
+	}
+	if key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil && len(key) == dataKeySize {
+		return NewLocal(id, key)
+	}
+	return NewLocal(id, data)
+}
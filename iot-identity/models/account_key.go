@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccountKey is an account-key assertion for a key that signs the model and serial assertions of devices that can
+// auto-register
+type AccountKey struct {
+	gorm.Model
+	// SignKeyID is the SHA3-384 ID of the public key
+	SignKeyID string
+	AccountID string
+	Name      string
+	// Source is where the assertion comes from: store, file or api
+	Source    string
+	Assertion string
+	Since     *time.Time
+	Until     *time.Time
+	// RefreshedAt is when the assertion was last loaded from its source, and RefreshError why it last failed
+	RefreshedAt  *time.Time
+	RefreshError string
+}
+
+func (AccountKey) TableName() string {
+	return "account_key"
+}
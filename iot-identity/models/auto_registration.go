@@ -0,0 +1,40 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// AutoRegistrationRule chooses the organization, groups and device data of devices that auto-register
+type AutoRegistrationRule struct {
+	gorm.Model
+	Name          string
+	Priority      int
+	Brand         string
+	DeviceModel   string `gorm:"column:model"`
+	SignKeyID     string
+	SerialPattern string
+	StoreID       string
+	// OrganizationID is empty when the rule holds the devices for approval
+	OrganizationID  string
+	DeviceGroups    string
+	DeviceData      string
+	PendingApproval bool
+}
+
+func (AutoRegistrationRule) TableName() string {
+	return "auto_registration_rule"
+}
+
+// AutoRegistration records the rule that registered a device
+type AutoRegistration struct {
+	gorm.Model
+	DeviceID       string
+	RuleID         uint
+	OrganizationID string
+	DeviceGroups   string
+	GroupsApplied  bool
+}
+
+func (AutoRegistration) TableName() string {
+	return "auto_registration"
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RevokedCertificate is a device certificate that must no longer be accepted
+type RevokedCertificate struct {
+	gorm.Model
+	// Issuer is the key ID of the CA that issued the certificate, serial numbers are only unique per CA
+	Issuer string
+	// SerialNumber is the certificate serial number, in hex
+	SerialNumber string
+	DeviceID     string
+	OrgID        string
+	Reason       int
+	RevokedAt    time.Time
+}
+
+func (RevokedCertificate) TableName() string {
+	return "revoked_certificate"
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// DataMigration records a one-off migration of the stored data that has completed, so that it isn't run again
+type DataMigration struct {
+	Name        string `gorm:"primaryKey"`
+	CompletedAt time.Time
+}
+
+func (DataMigration) TableName() string {
+	return "data_migration"
+}
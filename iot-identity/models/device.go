@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -29,6 +31,9 @@ type RegisteredDevice struct {
 	Status       Status
 	DeviceData   string
 	DeviceID     string
+	// CertificateSerial is the serial number, in hex, of Certificate
+	CertificateSerial    string     `gorm:"column:cred_serial"`
+	CertificateExpiresAt *time.Time `gorm:"column:cred_expires_at"`
 }
 
 func (rd RegisteredDevice) TableName() string {
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EnrollmentRequest is an enrollment attempt by a device that isn't registered and couldn't auto-register, or that
+// needs approval to re-enroll
+type EnrollmentRequest struct {
+	gorm.Model
+	Brand        string
+	DeviceModel  string `gorm:"column:model"`
+	SerialNumber string
+	StoreID      string
+	DeviceKey    string
+	// ModelHeaders and SerialHeaders are the headers of the assertions, as JSON
+	ModelHeaders  string
+	SerialHeaders string
+	SourceIP      string
+	Reason        string
+	// Status is pending, approved or rejected
+	Status         string
+	Attempts       int
+	LastAttemptAt  time.Time
+	OrganizationID string
+	DeviceID       string
+	DecidedBy      string
+	DecidedAt      *time.Time
+	EnrolledAt     *time.Time
+}
+
+func (EnrollmentRequest) TableName() string {
+	return "enrollment_request"
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Nonce is a single use value issued for a device to sign, so that a signed request can't be replayed
+type Nonce struct {
+	Nonce     string `gorm:"primaryKey"`
+	ExpiresAt time.Time
+}
+
+func (Nonce) TableName() string {
+	return "nonce"
+}
@@ -1,14 +1,21 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Organization struct {
 	gorm.Model
-	OrgId       string `gorm:"unique"`
-	Name        string
-	CountryName string
-	RootCert    string
-	RootKey     string
+	OrgId                 string `gorm:"unique"`
+	Name                  string
+	CountryName           string
+	RootCert              string
+	RootKey               string
+	PreviousRootCert      string
+	PreviousRootKey       string
+	PreviousRootExpiresAt *time.Time
 }
 
 func (Organization) TableName() string {
@@ -0,0 +1,370 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/go-resty/resty/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/spf13/viper"
+)
+
+// accountKeyring holds the public keys trusted to sign the model and serial assertions of devices that
+// auto-register. It is shared by the copies of the IdentityService.
+type accountKeyring struct {
+	lock sync.RWMutex
+	keys map[string][]trustedAccountKey
+}
+
+// trustedAccountKey is the public key of an account-key assertion and the period the assertion is valid for
+type trustedAccountKey struct {
+	publicKey asserts.PublicKey
+	since     *time.Time
+	until     *time.Time
+}
+
+// validAt checks whether an account key is valid at a time
+func validAt(since, until *time.Time, at time.Time) bool {
+	return (since == nil || !at.Before(*since)) && (until == nil || at.Before(*until))
+}
+
+// publicKeys returns the trusted keys that are valid at a time, so that a key stops being trusted when its
+// assertion expires rather than at the next refresh
+func (k *accountKeyring) publicKeys(at time.Time) map[string]asserts.PublicKey {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	valid := map[string]asserts.PublicKey{}
+	for signKeyID, trusted := range k.keys {
+		for _, t := range trusted {
+			if validAt(t.since, t.until, at) {
+				valid[signKeyID] = t.publicKey
+				break
+			}
+		}
+	}
+	return valid
+}
+
+func (k *accountKeyring) set(keys map[string][]trustedAccountKey) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.keys = keys
+}
+
+var fetchAccountKey = storeAccountKey
+
+func storeAccountKey(signKeyID string) ([]byte, error) {
+	resp, err := resty.New().SetTimeout(viper.GetDuration(keys.AccountKeysStoreTimeout)).NewRequest().
+		SetHeader("Accept", "application/x.ubuntu.assertion").
+		Get(AccountKeyGetURL + signKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("the store returned %s", resp.Status())
+	}
+	return resp.Body(), nil
+}
+
+// AccountKeyList fetches the account keys for auto-registration, with the status of their last refresh
+func (id IdentityService) AccountKeyList() ([]domain.AccountKey, error) {
+	list, err := id.DB.AccountKeyList()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	trusted := id.signKeys.publicKeys(now)
+	for i := range list {
+		_, active := trusted[list[i].SignKeyID]
+		list[i].Active = active && len(list[i].Assertion) > 0 && validAt(list[i].Since, list[i].Until, now)
+	}
+	return list, nil
+}
+
+// AccountKeyAdd stores uploaded account-key assertions and trusts them for auto-registration
+func (id IdentityService) AccountKeyAdd(assertions []byte) ([]domain.AccountKey, error) {
+	list, err := parseAccountKeys(assertions, domain.AccountKeySourceAPI)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("no account-key assertions supplied")
+	}
+
+	for _, k := range list {
+		if err := id.DB.AccountKeyUpsert(k); err != nil {
+			return nil, err
+		}
+	}
+	return list, id.loadAccountKeys()
+}
+
+// AccountKeyDelete stops trusting an account key, from every source. Keys from the files or the store are loaded
+// again on the next refresh, unless they are removed from there too.
+func (id IdentityService) AccountKeyDelete(signKeyID string) error {
+	if err := id.DB.AccountKeyDelete(signKeyID, ""); err != nil {
+		return err
+	}
+	return id.loadAccountKeys()
+}
+
+// RefreshAccountKeys reloads the account-key assertions from the files and the store. A key that can't be loaded
+// keeps the assertion it had, and the failure is recorded in its status. Keys that were removed from the files or
+// the configuration are deleted.
+func (id IdentityService) RefreshAccountKeys() error {
+	stored, err := id.DB.AccountKeyList()
+	if err != nil {
+		return err
+	}
+
+	errs := id.refreshFileAccountKeys(stored)
+	errs = append(errs, id.refreshStoreAccountKeys(stored)...)
+
+	if err := id.loadAccountKeys(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("refreshing account keys: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (id IdentityService) refreshFileAccountKeys(stored []domain.AccountKey) []string {
+	errs := []string{}
+	seen := map[string]bool{}
+
+	files, err := accountKeyFiles(viper.GetString(keys.AccountKeysPath))
+	if err != nil {
+		// Without the list of files, the keys loaded from them before are kept
+		return []string{err.Error()}
+	}
+
+	now := time.Now()
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		list, err := parseAccountKeys(data, domain.AccountKeySourceFile)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", f, err))
+			continue
+		}
+
+		for _, k := range list {
+			k.RefreshedAt = &now
+			if err := id.DB.AccountKeyUpsert(k); err != nil {
+				errs = append(errs, err.Error())
+			}
+			seen[k.SignKeyID] = true
+		}
+	}
+
+	// A file that couldn't be read may still have the keys
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for _, k := range stored {
+		if k.Source == domain.AccountKeySourceFile && !seen[k.SignKeyID] {
+			log.Infof("Account key %s was removed from the files, deleting it", k.SignKeyID)
+			if err := id.DB.AccountKeyDelete(k.SignKeyID, domain.AccountKeySourceFile); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	return errs
+}
+
+func (id IdentityService) refreshStoreAccountKeys(stored []domain.AccountKey) []string {
+	errs := []string{}
+	configured := map[string]bool{}
+
+	now := time.Now()
+	for _, signKeyID := range viper.GetStringSlice(keys.ValidSHA384Keys) {
+		configured[signKeyID] = true
+
+		k, err := storeAccountKeyGet(signKeyID)
+		if err != nil {
+			log.Errorf("Cannot retrieve account key assertion for %s, devices signed by it can't auto-register unless it was retrieved before: %v", signKeyID, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", signKeyID, err))
+			if err := id.DB.AccountKeyRefreshFailed(signKeyID, domain.AccountKeySourceStore, err.Error()); err != nil {
+				errs = append(errs, err.Error())
+			}
+			continue
+		}
+
+		k.RefreshedAt = &now
+		if err := id.DB.AccountKeyUpsert(*k); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	for _, k := range stored {
+		if k.Source == domain.AccountKeySourceStore && !configured[k.SignKeyID] {
+			log.Infof("Account key %s was removed from %s, deleting it", k.SignKeyID, keys.ValidSHA384Keys)
+			if err := id.DB.AccountKeyDelete(k.SignKeyID, domain.AccountKeySourceStore); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	return errs
+}
+
+func storeAccountKeyGet(signKeyID string) (*domain.AccountKey, error) {
+	data, err := fetchAccountKey(signKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := parseAccountKeys(data, domain.AccountKeySourceStore)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range list {
+		if k.SignKeyID == signKeyID {
+			return &k, nil
+		}
+	}
+	return nil, fmt.Errorf("the store didn't return the account-key assertion")
+}
+
+// loadAccountKeys trusts the public keys of the stored account-key assertions. Each key is only trusted while its
+// assertion is valid, which is checked when an assertion signed by it is verified.
+func (id IdentityService) loadAccountKeys() error {
+	list, err := id.DB.AccountKeyList()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	trusted := map[string][]trustedAccountKey{}
+	for _, k := range list {
+		if len(k.Assertion) == 0 {
+			continue
+		}
+		if k.Until != nil && !now.Before(*k.Until) {
+			log.Warnf("Account key %s has expired, devices signed by it can't auto-register", k.SignKeyID)
+			continue
+		}
+		if k.Since != nil && now.Before(*k.Since) {
+			log.Warnf("Account key %s is not valid yet, devices signed by it can't auto-register before %s", k.SignKeyID, k.Since)
+		}
+
+		a, err := asserts.Decode(k.Assertion)
+		if err != nil {
+			log.Errorf("Cannot decode the stored account key assertion for %s: %v", k.SignKeyID, err)
+			continue
+		}
+		pubKey, err := asserts.DecodePublicKey(a.Body())
+		if err != nil {
+			log.Errorf("Cannot decode the public key of account key %s: %v", k.SignKeyID, err)
+			continue
+		}
+		trusted[k.SignKeyID] = append(trusted[k.SignKeyID], trustedAccountKey{publicKey: pubKey, since: k.Since, until: k.Until})
+	}
+
+	id.signKeys.set(trusted)
+	return nil
+}
+
+// parseAccountKeys decodes a stream of account-key assertions
+func parseAccountKeys(data []byte, source string) ([]domain.AccountKey, error) {
+	list := []domain.AccountKey{}
+
+	decoder := asserts.NewDecoder(bytes.NewReader(data))
+	for {
+		a, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode account-key assertion: %w", err)
+		}
+
+		ak, ok := a.(*asserts.AccountKey)
+		if !ok {
+			return nil, fmt.Errorf("expected an account-key assertion, got %s", a.Type().Name)
+		}
+		if _, err := asserts.DecodePublicKey(ak.Body()); err != nil {
+			return nil, fmt.Errorf("cannot decode the public key of account key %s: %w", ak.PublicKeyID(), err)
+		}
+
+		k := domain.AccountKey{
+			SignKeyID: ak.PublicKeyID(),
+			AccountID: ak.AccountID(),
+			Name:      ak.Name(),
+			Source:    source,
+			Assertion: asserts.Encode(ak),
+		}
+		since := ak.Since()
+		k.Since = &since
+		if until := ak.Until(); !until.IsZero() {
+			k.Until = &until
+		}
+		list = append(list, k)
+	}
+
+	return list, nil
+}
+
+// accountKeyFiles lists the files of account-key assertions at a path, either a file or a directory of files
+func accountKeyFiles(path string) ([]string, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read account key assertions: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read account key assertions: %w", err)
+	}
+
+	files := []string{}
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,274 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/datastore/memory"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAccountKey is a brand's account key, signed by a test root, and an assertion signed by the brand's key
+type testAccountKey struct {
+	signKeyID string
+	assertion []byte
+	signed    asserts.Assertion
+}
+
+func newTestAccountKey(t *testing.T, headers map[string]interface{}) testAccountKey {
+	rootKey, _ := assertstest.GenerateKey(752)
+	brandKey, _ := assertstest.GenerateKey(752)
+	rootDB := assertstest.NewSigningDB("canonical", rootKey)
+	brandDB := assertstest.NewSigningDB("example", brandKey)
+
+	account := assertstest.NewAccount(rootDB, "example", map[string]interface{}{"account-id": "example"}, "")
+	accountKey := assertstest.NewAccountKey(rootDB, account, headers, brandKey.PublicKey(), "")
+	return testAccountKey{
+		signKeyID: accountKey.PublicKeyID(),
+		assertion: asserts.Encode(accountKey),
+		signed:    assertstest.NewAccount(brandDB, "device", nil, ""),
+	}
+}
+
+func newTestAccountKeyService(t *testing.T) (*IdentityService, *memory.Store) {
+	checkSignature = signatureCheck
+	isKeyAllowed = isSignKeyAllowed
+	viper.Set(keys.ValidSHA384Keys, []string{})
+	viper.Set(keys.AccountKeysPath, "")
+	t.Cleanup(func() { fetchAccountKey = storeAccountKey })
+
+	db := memory.NewStore()
+	return NewIdentityService(db), db
+}
+
+func TestIdentityService_AccountKeyAdd(t *testing.T) {
+	key1 := newTestAccountKey(t, nil)
+	key2 := newTestAccountKey(t, nil)
+	expired := newTestAccountKey(t, map[string]interface{}{
+		"since": time.Now().Add(-48 * time.Hour).Format(time.RFC3339),
+		"until": time.Now().Add(-24 * time.Hour).Format(time.RFC3339),
+	})
+	model, _ := asserts.Decode([]byte(model3))
+
+	tests := []struct {
+		name       string
+		assertions []byte
+		wantKeys   int
+		wantActive bool
+		wantErr    bool
+	}{
+		{"valid", key1.assertion, 1, true, false},
+		{"valid-many", []byte(string(key1.assertion) + "\n" + string(key2.assertion) + "\n"), 2, true, false},
+		{"expired", expired.assertion, 1, false, false},
+		{"not-account-key", asserts.Encode(model), 0, false, true},
+		{"invalid", []byte("not an assertion"), 0, false, true},
+		{"empty", []byte{}, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, _ := newTestAccountKeyService(t)
+
+			got, err := id.AccountKeyAdd(tt.assertions)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IdentityService.AccountKeyAdd() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			assert.Len(t, got, tt.wantKeys)
+			assert.Equal(t, domain.AccountKeySourceAPI, got[0].Source)
+
+			list, err := id.AccountKeyList()
+			assert.NoError(t, err)
+			assert.Len(t, list, tt.wantKeys)
+			for _, k := range list {
+				assert.Equal(t, tt.wantActive, k.Active)
+			}
+
+			// Assertions signed by a trusted key pass the auto-registration check
+			signed := key1.signed
+			if tt.name == "expired" {
+				signed = expired.signed
+			}
+			assert.Equal(t, tt.wantActive, id.checkKey(signed))
+		})
+	}
+}
+
+func TestIdentityService_AccountKeyDelete(t *testing.T) {
+	key := newTestAccountKey(t, nil)
+	id, _ := newTestAccountKeyService(t)
+	_, err := id.AccountKeyAdd(key.assertion)
+	assert.NoError(t, err)
+	assert.True(t, id.checkKey(key.signed))
+
+	assert.NoError(t, id.AccountKeyDelete(key.signKeyID))
+	assert.False(t, id.checkKey(key.signed))
+	assert.Error(t, id.AccountKeyDelete(key.signKeyID))
+}
+
+func TestIdentityService_RefreshAccountKeysStore(t *testing.T) {
+	key1 := newTestAccountKey(t, nil)
+	key2 := newTestAccountKey(t, nil)
+	id, db := newTestAccountKeyService(t)
+
+	// A failure to fetch the first key doesn't stop the others being fetched
+	viper.Set(keys.ValidSHA384Keys, []string{"unavailable", key1.signKeyID, key2.signKeyID})
+	fetchAccountKey = func(signKeyID string) ([]byte, error) {
+		switch signKeyID {
+		case key1.signKeyID:
+			return key1.assertion, nil
+		case key2.signKeyID:
+			return key2.assertion, nil
+		}
+		return nil, errors.New("the store returned 404 Not Found")
+	}
+
+	err := id.RefreshAccountKeys()
+	assert.Error(t, err)
+	assert.True(t, id.checkKey(key1.signed))
+	assert.True(t, id.checkKey(key2.signed))
+
+	list, _ := id.AccountKeyList()
+	if assert.Len(t, list, 3) {
+		for _, k := range list {
+			assert.Equal(t, domain.AccountKeySourceStore, k.Source)
+			if k.SignKeyID == "unavailable" {
+				assert.False(t, k.Active)
+				assert.Contains(t, k.RefreshError, "404")
+			} else {
+				assert.True(t, k.Active)
+				assert.NotNil(t, k.RefreshedAt)
+			}
+		}
+	}
+
+	// A key that can't be fetched any more keeps its assertion
+	fetchAccountKey = func(signKeyID string) ([]byte, error) {
+		return nil, errors.New("no network")
+	}
+	viper.Set(keys.ValidSHA384Keys, []string{key1.signKeyID})
+	assert.Error(t, id.RefreshAccountKeys())
+	assert.True(t, id.checkKey(key1.signed))
+
+	// Keys removed from the configuration are deleted
+	assert.False(t, id.checkKey(key2.signed))
+	assert.Len(t, db.AccountKeys, 1)
+	assert.Equal(t, "no network", db.AccountKeys[0].RefreshError)
+}
+
+func TestIdentityService_RefreshAccountKeysFiles(t *testing.T) {
+	key1 := newTestAccountKey(t, nil)
+	key2 := newTestAccountKey(t, nil)
+	id, _ := newTestAccountKeyService(t)
+
+	dir := t.TempDir()
+	_ = os.WriteFile(path.Join(dir, "key1.assertion"), key1.assertion, 0600)
+	_ = os.WriteFile(path.Join(dir, "key2.assertion"), key2.assertion, 0600)
+	viper.Set(keys.AccountKeysPath, dir)
+
+	assert.NoError(t, id.RefreshAccountKeys())
+	assert.True(t, id.checkKey(key1.signed))
+	assert.True(t, id.checkKey(key2.signed))
+
+	// Keys uploaded through the API aren't affected by the files
+	uploaded := newTestAccountKey(t, nil)
+	_, err := id.AccountKeyAdd(uploaded.assertion)
+	assert.NoError(t, err)
+
+	// An invalid file stops keys from being removed, as it may hold them
+	_ = os.Remove(path.Join(dir, "key2.assertion"))
+	_ = os.WriteFile(path.Join(dir, "invalid.assertion"), []byte("not an assertion"), 0600)
+	assert.Error(t, id.RefreshAccountKeys())
+	assert.True(t, id.checkKey(key2.signed))
+
+	_ = os.Remove(path.Join(dir, "invalid.assertion"))
+	assert.NoError(t, id.RefreshAccountKeys())
+	assert.True(t, id.checkKey(key1.signed))
+	assert.False(t, id.checkKey(key2.signed))
+	assert.True(t, id.checkKey(uploaded.signed))
+
+	// A single file works too
+	viper.Set(keys.AccountKeysPath, path.Join(dir, "key1.assertion"))
+	assert.NoError(t, id.RefreshAccountKeys())
+	assert.True(t, id.checkKey(key1.signed))
+
+	viper.Set(keys.AccountKeysPath, path.Join(dir, "missing"))
+	assert.Error(t, id.RefreshAccountKeys())
+	assert.True(t, id.checkKey(key1.signed))
+}
+
+func TestIdentityService_AccountKeyExpiresAtVerification(t *testing.T) {
+	until := time.Now().Add(time.Hour)
+	key := newTestAccountKey(t, map[string]interface{}{
+		"since": time.Now().Add(-time.Hour).Format(time.RFC3339),
+		"until": until.Format(time.RFC3339),
+	})
+	id, _ := newTestAccountKeyService(t)
+	_, err := id.AccountKeyAdd(key.assertion)
+	assert.NoError(t, err)
+	assert.True(t, id.checkKey(key.signed))
+
+	// The key stops being trusted when its assertion expires, without waiting for a refresh
+	_, ok := id.signKeys.publicKeys(until.Add(-time.Minute))[key.signKeyID]
+	assert.True(t, ok)
+	_, ok = id.signKeys.publicKeys(until.Add(time.Minute))[key.signKeyID]
+	assert.False(t, ok)
+}
+
+func TestIdentityService_AccountKeySources(t *testing.T) {
+	key := newTestAccountKey(t, nil)
+	id, db := newTestAccountKeyService(t)
+
+	dir := t.TempDir()
+	_ = os.WriteFile(path.Join(dir, "key.assertion"), key.assertion, 0600)
+	viper.Set(keys.AccountKeysPath, dir)
+	assert.NoError(t, id.RefreshAccountKeys())
+
+	// Uploading the same key doesn't take over the key from the files
+	_, err := id.AccountKeyAdd(key.assertion)
+	assert.NoError(t, err)
+	if assert.Len(t, db.AccountKeys, 2) {
+		assert.NotEqual(t, db.AccountKeys[0].Source, db.AccountKeys[1].Source)
+	}
+
+	// Removing the key from the files keeps the uploaded key
+	_ = os.Remove(path.Join(dir, "key.assertion"))
+	assert.NoError(t, id.RefreshAccountKeys())
+	if assert.Len(t, db.AccountKeys, 1) {
+		assert.Equal(t, domain.AccountKeySourceAPI, db.AccountKeys[0].Source)
+	}
+	assert.True(t, id.checkKey(key.signed))
+
+	// Deleting the key through the API deletes it from every source
+	assert.NoError(t, id.AccountKeyDelete(key.signKeyID))
+	assert.Len(t, db.AccountKeys, 0)
+	assert.False(t, id.checkKey(key.signed))
+}
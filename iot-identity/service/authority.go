@@ -0,0 +1,143 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/datastore"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/spf13/viper"
+)
+
+// OrganizationCABundle returns the PEM encoded CA certificates that brokers need to trust the device certificates
+// of an organization: its CA, its previous CA during a rotation, and the root CA that signed devices before
+// organizations had their own CA
+func (id IdentityService) OrganizationCABundle(orgID string) ([]byte, error) {
+	org, err := id.DB.OrganizationGet(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	authorities, err := organizationAuthorities(org)
+	if err != nil {
+		return nil, err
+	}
+
+	return cert.Bundle(authorities...), nil
+}
+
+// RotateOrganizationCA replaces the CA of an organization with a generated or imported one. The current CA stays
+// valid for the overlap period, so devices can renew their credentials before it stops being trusted.
+func (id IdentityService) RotateOrganizationCA(orgID string, req *RotateOrganizationCARequest) error {
+	org, err := id.DB.OrganizationGet(orgID)
+	if err != nil {
+		return err
+	}
+
+	overlap := viper.GetDuration(keys.CARotationOverlap)
+	if len(req.Overlap) > 0 {
+		if overlap, err = time.ParseDuration(req.Overlap); err != nil {
+			return fmt.Errorf("invalid overlap: %w", err)
+		}
+	}
+
+	rootKey, rootCert, err := organizationCA(org.Name, req.RootCert, req.RootKey)
+	if err != nil {
+		return err
+	}
+
+	update := datastore.OrganizationCAUpdateRequest{
+		RootCert: rootCert,
+		RootKey:  rootKey,
+	}
+
+	// Organizations created before they had their own CA have no CA to keep, their devices stay signed by the root CA
+	current, err := cert.OrganizationAuthority(org)
+	if err != nil {
+		return err
+	}
+	if current != nil && overlap > 0 {
+		expiresAt := time.Now().Add(overlap)
+		update.PreviousRootCert = org.RootCert
+		update.PreviousRootKey = org.RootKey
+		update.PreviousExpiresAt = &expiresAt
+	}
+
+	Logger.Infof("Rotating the CA of organization %s, the previous CA is valid until %v", orgID, update.PreviousExpiresAt)
+
+	if err := id.DB.OrganizationCAUpdate(orgID, update); err != nil {
+		return err
+	}
+
+	id.ocspResponders.invalidate()
+	return nil
+}
+
+// organizationCA returns the PEM encoded key and certificate of the CA for a new organization CA, which is
+// imported when a certificate is given and generated otherwise
+func organizationCA(name, certPEM, keyPEM string) ([]byte, []byte, error) {
+	if len(certPEM) > 0 || len(keyPEM) > 0 {
+		if _, err := cert.ParseAuthority([]byte(certPEM), []byte(keyPEM)); err != nil {
+			return nil, nil, fmt.Errorf("importing organization CA: %w", err)
+		}
+		return []byte(keyPEM), []byte(certPEM), nil
+	}
+
+	rootCertsDir := viper.GetString(keys.GetIdentityKey(keys.CertificatesPath))
+	return cert.CreateOrganizationCert(rootCertsDir, name)
+}
+
+// organizationAuthorities returns the CAs that the certificates of an organization's devices may be signed by
+func organizationAuthorities(org *domain.Organization) ([]*cert.Authority, error) {
+	rootCertsDir := viper.GetString(keys.GetIdentityKey(keys.CertificatesPath))
+	root, err := cert.RootAuthority(rootCertsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	authorities := []*cert.Authority{}
+
+	current, err := cert.OrganizationAuthority(org)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		authorities = append(authorities, current)
+	}
+
+	previous, err := cert.PreviousOrganizationAuthority(org, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		authorities = append(authorities, previous)
+	}
+
+	return append(authorities, root), nil
+}
+
+// deviceOrganization fetches the organization of a device, with its CA
+func (id IdentityService) deviceOrganization(device *domain.Enrollment) (*domain.Organization, error) {
+	return id.DB.OrganizationGet(device.Organization.ID)
+}
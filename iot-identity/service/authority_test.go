@@ -0,0 +1,203 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/datastore/memory"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func countPEMBlocks(data []byte) int {
+	count := 0
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		count++
+	}
+	return count
+}
+
+func TestIdentityService_RegisterOrganizationCA(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	importKey, importCert, _ := cert.CreateOrganizationCert("../datastore/test_data", "Imported Ltd")
+	_, clientCert, _ := cert.CreateClientCert(&domain.Organization{Name: "Example PLC"}, "../datastore/test_data", "abc123")
+
+	tests := []struct {
+		name     string
+		req      *RegisterOrganizationRequest
+		wantCert []byte
+		wantErr  bool
+	}{
+		{"generated", &RegisterOrganizationRequest{Name: "Generated Ltd"}, nil, false},
+		{"imported", &RegisterOrganizationRequest{Name: "Imported Ltd", RootCert: string(importCert), RootKey: string(importKey)}, importCert, false},
+		{"not-a-ca", &RegisterOrganizationRequest{Name: "Imported Ltd", RootCert: string(clientCert), RootKey: string(importKey)}, nil, true},
+		{"no-key", &RegisterOrganizationRequest{Name: "Imported Ltd", RootCert: string(importCert)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewStore()
+			id := NewIdentityService(db)
+
+			orgID, err := id.RegisterOrganization(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IdentityService.RegisterOrganization() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			org, _ := db.OrganizationGet(orgID)
+			authority, err := cert.OrganizationAuthority(org)
+			assert.NoError(t, err)
+			assert.NotNil(t, authority)
+			if tt.wantCert != nil {
+				assert.Equal(t, tt.wantCert, org.RootCert)
+			}
+
+			// Devices of the organization are signed by its CA
+			deviceID, err := id.RegisterDevice(&RegisterDeviceRequest{OrganizationID: orgID, Brand: "example", Model: "drone-2000", SerialNumber: "DR2000Z999"})
+			assert.NoError(t, err)
+			device, _ := db.DeviceGetEnrollmentByID(deviceID)
+			c, err := x509.ParseCertificate(pemBlockBytes(t, device.Credentials.Certificate))
+			if assert.NoError(t, err) {
+				assert.NoError(t, c.CheckSignatureFrom(authority.Certificate))
+			}
+		})
+	}
+}
+
+func TestIdentityService_RotateOrganizationCA(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	viper.Set(keys.CARotationOverlap, "720h")
+	importKey, importCert, _ := cert.CreateOrganizationCert("../datastore/test_data", "Example Ltd")
+
+	tests := []struct {
+		name         string
+		req          *RotateOrganizationCARequest
+		wantPrevious bool
+		wantErr      bool
+	}{
+		{"generated", &RotateOrganizationCARequest{}, true, false},
+		{"imported", &RotateOrganizationCARequest{RootCert: string(importCert), RootKey: string(importKey), Overlap: "1h"}, true, false},
+		{"no-overlap", &RotateOrganizationCARequest{Overlap: "0s"}, false, false},
+		{"invalid-overlap", &RotateOrganizationCARequest{Overlap: "soon"}, false, true},
+		{"invalid-ca", &RotateOrganizationCARequest{RootCert: string(importCert)}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewStore()
+			id := NewIdentityService(db)
+			orgID, err := id.RegisterOrganization(&RegisterOrganizationRequest{Name: "Example Ltd"})
+			if err != nil {
+				t.Fatalf("RegisterOrganization() error = %v", err)
+			}
+			before, _ := db.OrganizationGet(orgID)
+			deviceID, _ := id.RegisterDevice(&RegisterDeviceRequest{OrganizationID: orgID, Brand: "example", Model: "drone-2000", SerialNumber: "DR2000Z999"})
+			device, _ := db.DeviceGetEnrollmentByID(deviceID)
+
+			err = id.RotateOrganizationCA(orgID, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IdentityService.RotateOrganizationCA() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			after, _ := db.OrganizationGet(orgID)
+			assert.NotEqual(t, before.RootCert, after.RootCert)
+
+			bundle, err := id.OrganizationCABundle(orgID)
+			assert.NoError(t, err)
+
+			// The certificate from before the rotation is only trusted while the CAs overlap
+			authorities, err := organizationAuthorities(after)
+			assert.NoError(t, err)
+			verifyErr := cert.VerifyClientCert(authorities, parseTestCertificate(t, device.Credentials.Certificate))
+			if tt.wantPrevious {
+				assert.Equal(t, before.RootCert, after.PreviousRootCert)
+				assert.NotNil(t, after.PreviousRootExpiresAt)
+				assert.Equal(t, 3, countPEMBlocks(bundle))
+				assert.NoError(t, verifyErr)
+			} else {
+				assert.Empty(t, after.PreviousRootCert)
+				assert.Equal(t, 2, countPEMBlocks(bundle))
+				assert.Error(t, verifyErr)
+			}
+		})
+	}
+}
+
+func TestIdentityService_RotateOrganizationCALegacy(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	db := memory.NewStore()
+	id := NewIdentityService(db)
+
+	// The test organization has a server certificate rather than a CA, so there's no previous CA to keep
+	assert.NoError(t, id.RotateOrganizationCA("abc", &RotateOrganizationCARequest{}))
+	org, _ := db.OrganizationGet("abc")
+	assert.Empty(t, org.PreviousRootCert)
+
+	_, err := id.OrganizationCABundle("invalid")
+	assert.Error(t, err)
+	assert.Error(t, id.RotateOrganizationCA("invalid", &RotateOrganizationCARequest{}))
+}
+
+func TestIdentityService_OrganizationCRL(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	db := memory.NewStore()
+	id := NewIdentityService(db)
+	orgID, _ := id.RegisterOrganization(&RegisterOrganizationRequest{Name: "Example Ltd"})
+	deviceID, _ := id.RegisterDevice(&RegisterDeviceRequest{OrganizationID: orgID, Brand: "example", Model: "drone-2000", SerialNumber: "DR2000Z999"})
+	assert.NoError(t, id.RevokeDevice(deviceID, cert.ReasonUnspecified))
+
+	// Another organization's revocations aren't listed
+	otherID := registerTestDevice(t, id)
+	assert.NoError(t, id.RevokeDevice(otherID, cert.ReasonUnspecified))
+
+	got, err := id.CRL(orgID)
+	assert.NoError(t, err)
+
+	// One list from the organization CA and one from the root CA, each of the certificates it issued
+	org, _ := db.OrganizationGet(orgID)
+	authorities, _ := organizationAuthorities(org)
+	wantRevoked := []int{1, 0}
+	rest := got
+	for i, a := range authorities {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if !assert.NotNil(t, block) {
+			return
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if assert.NoError(t, err) {
+			assert.NoError(t, crl.CheckSignatureFrom(a.Certificate))
+			assert.Len(t, crl.RevokedCertificates, wantRevoked[i])
+		}
+	}
+	assert.Empty(t, rest)
+}
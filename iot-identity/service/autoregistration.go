@@ -0,0 +1,246 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/datastore"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/spf13/viper"
+)
+
+// AutoRegistrationRuleList fetches the auto-registration rules in the order they are tried
+func (id IdentityService) AutoRegistrationRuleList() ([]domain.AutoRegistrationRule, error) {
+	return id.DB.AutoRegistrationRuleList()
+}
+
+// AutoRegistrationRuleCreate adds an auto-registration rule
+func (id IdentityService) AutoRegistrationRuleCreate(rule domain.AutoRegistrationRule) (uint, error) {
+	if err := id.validateAutoRegistrationRule(&rule); err != nil {
+		return 0, err
+	}
+	return id.DB.AutoRegistrationRuleCreate(rule)
+}
+
+// AutoRegistrationRuleUpdate replaces an auto-registration rule
+func (id IdentityService) AutoRegistrationRuleUpdate(rule domain.AutoRegistrationRule) error {
+	if _, err := id.DB.AutoRegistrationRuleGet(rule.ID); err != nil {
+		return err
+	}
+	if err := id.validateAutoRegistrationRule(&rule); err != nil {
+		return err
+	}
+	return id.DB.AutoRegistrationRuleUpdate(rule)
+}
+
+// AutoRegistrationRuleDelete deletes an auto-registration rule
+func (id IdentityService) AutoRegistrationRuleDelete(ruleID uint) error {
+	return id.DB.AutoRegistrationRuleDelete(ruleID)
+}
+
+// AutoRegistrationEvaluate is a dry-run of auto-registration for a model and serial assertion, showing the rule
+// the device would hit. Nothing is registered.
+func (id IdentityService) AutoRegistrationEvaluate(assertions []byte) (*domain.AutoRegistrationEvaluation, error) {
+	model, serial, err := parseModelAndSerial(assertions)
+	if err != nil {
+		return nil, err
+	}
+
+	enroll := enrollRequestFromAssertions(model, serial)
+	ev, err := id.autoRegistrationTarget(enroll, serial)
+	if err != nil {
+		ev = &domain.AutoRegistrationEvaluation{Reason: err.Error()}
+	}
+
+	switch {
+	case !viper.GetBool(keys.AutoRegistrationEnabled):
+		ev.Reason = "auto-registration is disabled"
+	case !id.checkAutoRegistrationEligibility(model, serial):
+		ev.Reason = "the model or serial assertion is not signed by a trusted account key"
+	case err == nil:
+		ev.Eligible = true
+	}
+	return ev, nil
+}
+
+// AutoRegistrationGroups fetches the organization an auto-registered device was placed in and the groups in it
+// the device is still to be added to
+func (id IdentityService) AutoRegistrationGroups(deviceID string) (string, []string, error) {
+	registration, err := id.DB.AutoRegistrationGet(deviceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", []string{}, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if registration.GroupsApplied {
+		return registration.OrganizationID, []string{}, nil
+	}
+	return registration.OrganizationID, registration.Groups, nil
+}
+
+// AutoRegistrationGroupsApplied records that an auto-registered device was added to its groups
+func (id IdentityService) AutoRegistrationGroupsApplied(deviceID string) error {
+	return id.DB.AutoRegistrationGroupsApplied(deviceID)
+}
+
+// autoRegistrationTarget chooses where a device that auto-registers goes: the first rule that matches it or,
+// when no rule does, the default organization
+func (id IdentityService) autoRegistrationTarget(enroll *datastore.DeviceEnrollRequest, serial asserts.Assertion) (*domain.AutoRegistrationEvaluation, error) {
+	rules, err := id.DB.AutoRegistrationRuleList()
+	if err != nil {
+		return nil, fmt.Errorf("getting auto-registration rules: %w", err)
+	}
+
+	for i := range rules {
+		rule := rules[i]
+		matched, err := autoRegistrationRuleMatches(rule, enroll, serial.SignKeyID())
+		if err != nil {
+			// A rule that was stored can't be broken, but it mustn't send devices to the wrong place either
+			return nil, fmt.Errorf("evaluating auto-registration rule %d: %w", rule.ID, err)
+		}
+		if !matched {
+			continue
+		}
+
+		return &domain.AutoRegistrationEvaluation{
+			Rule:            &rule,
+			OrganizationID:  rule.OrganizationID,
+			Groups:          rule.Groups,
+			DeviceData:      rule.DeviceData,
+			PendingApproval: rule.PendingApproval,
+		}, nil
+	}
+
+	orgID, err := id.getDefaultOrgID()
+	if err != nil {
+		return nil, fmt.Errorf("getting default org ID: %w", err)
+	}
+	return &domain.AutoRegistrationEvaluation{OrganizationID: orgID}, nil
+}
+
+func autoRegistrationRuleMatches(rule domain.AutoRegistrationRule, enroll *datastore.DeviceEnrollRequest, signKeyID string) (bool, error) {
+	for _, f := range []struct{ want, got string }{
+		{rule.Brand, enroll.Brand},
+		{rule.Model, enroll.Model},
+		{rule.SignKeyID, signKeyID},
+		{rule.StoreID, enroll.StoreID},
+	} {
+		if len(f.want) > 0 && f.want != f.got {
+			return false, nil
+		}
+	}
+
+	if len(rule.SerialPattern) == 0 {
+		return true, nil
+	}
+	pattern, err := compileSerialPattern(rule.SerialPattern)
+	if err != nil {
+		return false, err
+	}
+	return pattern.MatchString(enroll.SerialNumber), nil
+}
+
+// compileSerialPattern compiles a serial pattern so it has to match the whole serial number
+func compileSerialPattern(serialPattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + serialPattern + ")$")
+}
+
+func (id IdentityService) validateAutoRegistrationRule(rule *domain.AutoRegistrationRule) error {
+	if len(rule.SerialPattern) > 0 {
+		if _, err := compileSerialPattern(rule.SerialPattern); err != nil {
+			return fmt.Errorf("invalid serial pattern: %w", err)
+		}
+	}
+
+	for _, g := range rule.Groups {
+		if err := validateNotEmpty("group name", g); err != nil {
+			return err
+		}
+	}
+
+	if rule.PendingApproval {
+		// The device is placed when it is approved
+		rule.OrganizationID = ""
+		rule.Groups = nil
+		rule.DeviceData = ""
+		return nil
+	}
+
+	if err := validateNotEmpty("organization ID", rule.OrganizationID); err != nil {
+		return err
+	}
+	if _, err := id.DB.OrganizationGet(rule.OrganizationID); err != nil {
+		return fmt.Errorf("cannot find organization %s: %w", rule.OrganizationID, err)
+	}
+	return nil
+}
+
+// parseModelAndSerial decodes a model and a serial assertion, in either order
+func parseModelAndSerial(data []byte) (asserts.Assertion, asserts.Assertion, error) {
+	var model, serial asserts.Assertion
+
+	decoder := asserts.NewDecoder(bytes.NewReader(bytes.TrimLeft(data, " \t\r\n")))
+	for {
+		a, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot decode assertion: %w", err)
+		}
+
+		switch a.Type().Name {
+		case asserts.ModelType.Name:
+			model = a
+		case asserts.SerialType.Name:
+			serial = a
+		default:
+			return nil, nil, fmt.Errorf("expected a model or serial assertion, got %s", a.Type().Name)
+		}
+	}
+
+	if model == nil || serial == nil {
+		return nil, nil, fmt.Errorf("a model and serial assertion is required")
+	}
+	if model.Header("brand-id") != serial.Header("brand-id") || model.Header("model") != serial.Header("model") {
+		return nil, nil, fmt.Errorf("the model and serial assertion are for different models")
+	}
+	return model, serial, nil
+}
+
+// enrollRequestFromAssertions builds the enrollment request from the device's model and serial assertion
+func enrollRequestFromAssertions(model, serial asserts.Assertion) *datastore.DeviceEnrollRequest {
+	return &datastore.DeviceEnrollRequest{
+		Brand:        model.HeaderString("brand-id"),
+		Model:        model.HeaderString("model"),
+		SerialNumber: serial.HeaderString("serial"),
+		DeviceKey:    serial.HeaderString("device-key"),
+		StoreID:      model.HeaderString("store"),
+	}
+}
@@ -0,0 +1,220 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/config/configkey"
+	"github.com/everactive/dmscore/iot-identity/datastore"
+	"github.com/everactive/dmscore/iot-identity/datastore/memory"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAutoRegistrationService(t *testing.T) (*IdentityService, *memory.Store) {
+	viper.Set(configkey.MQTTCertificatePath, "../datastore/test_data")
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../../testing/certs")
+	viper.Set(keys.DefaultOrganization, "Example Inc")
+	viper.Set(keys.AutoRegistrationEnabled, true)
+	t.Cleanup(func() { viper.Set(keys.AutoRegistrationEnabled, false) })
+
+	checkSignature = func(assert asserts.Assertion, pubKey asserts.PublicKey) error {
+		return nil
+	}
+	isKeyAllowed = func(signKeyID string, allowedKeys map[string]asserts.PublicKey) (asserts.PublicKey, bool) {
+		return nil, true
+	}
+
+	db := memory.NewStore()
+	db.Orgs = append(db.Orgs, domain.Organization{ID: "def", Name: "Other Inc", RootKey: db.Orgs[0].RootKey, RootCert: db.Orgs[0].RootCert})
+	return &IdentityService{DB: db, signKeys: &accountKeyring{}, ocspResponders: &ocspResponderCache{}}, db
+}
+
+func TestIdentityService_AutoRegistrationRuleCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    domain.AutoRegistrationRule
+		want    domain.AutoRegistrationRule
+		wantErr string
+	}{
+		{"valid", domain.AutoRegistrationRule{Brand: "example", SerialPattern: "DR1000[AB].*", OrganizationID: "def", Groups: []string{"drones"}},
+			domain.AutoRegistrationRule{ID: 1, Brand: "example", SerialPattern: "DR1000[AB].*", OrganizationID: "def", Groups: []string{"drones"}}, ""},
+		{"valid-pending", domain.AutoRegistrationRule{Brand: "example", OrganizationID: "def", Groups: []string{"drones"}, PendingApproval: true},
+			domain.AutoRegistrationRule{ID: 1, Brand: "example", PendingApproval: true}, ""},
+		{"invalid-no-org", domain.AutoRegistrationRule{Brand: "example"}, domain.AutoRegistrationRule{}, "organization ID must not be empty"},
+		{"invalid-org", domain.AutoRegistrationRule{Brand: "example", OrganizationID: "invalid"}, domain.AutoRegistrationRule{}, "cannot find organization invalid"},
+		{"invalid-pattern", domain.AutoRegistrationRule{SerialPattern: "DR(", OrganizationID: "def"}, domain.AutoRegistrationRule{}, "invalid serial pattern"},
+		{"invalid-group", domain.AutoRegistrationRule{OrganizationID: "def", Groups: []string{" "}}, domain.AutoRegistrationRule{}, "group name must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, db := newTestAutoRegistrationService(t)
+
+			ruleID, err := id.AutoRegistrationRuleCreate(tt.rule)
+			if len(tt.wantErr) > 0 {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Empty(t, db.Rules)
+				return
+			}
+			assert.NoError(t, err)
+
+			got, err := db.AutoRegistrationRuleGet(ruleID)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, *got)
+		})
+	}
+}
+
+func TestIdentityService_AutoRegistrationRuleUpdateDelete(t *testing.T) {
+	id, db := newTestAutoRegistrationService(t)
+
+	ruleID, err := id.AutoRegistrationRuleCreate(domain.AutoRegistrationRule{Brand: "example", OrganizationID: "abc"})
+	assert.NoError(t, err)
+
+	err = id.AutoRegistrationRuleUpdate(domain.AutoRegistrationRule{ID: ruleID, Brand: "example", OrganizationID: "def", Priority: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.AutoRegistrationRule{{ID: ruleID, Brand: "example", OrganizationID: "def", Priority: 5}}, db.Rules)
+
+	err = id.AutoRegistrationRuleUpdate(domain.AutoRegistrationRule{ID: ruleID, Brand: "example", OrganizationID: "invalid"})
+	assert.Error(t, err)
+	err = id.AutoRegistrationRuleUpdate(domain.AutoRegistrationRule{ID: 99, Brand: "example", OrganizationID: "def"})
+	assert.Error(t, err)
+
+	assert.NoError(t, id.AutoRegistrationRuleDelete(ruleID))
+	assert.Empty(t, db.Rules)
+	assert.Error(t, id.AutoRegistrationRuleDelete(ruleID))
+}
+
+func TestIdentityService_EnrollAutoRegistrationRules(t *testing.T) {
+	serial1Assertion, _ := asserts.Decode([]byte(serial1))
+	model3Assertion, _ := asserts.Decode([]byte(model3))
+
+	rules := []domain.AutoRegistrationRule{
+		{Name: "held", Priority: 1, Brand: "example", SerialPattern: "HOLD.*", PendingApproval: true},
+		{Name: "other-store", Priority: 2, Brand: "example", StoreID: "other-store", OrganizationID: "abc"},
+		{Name: "other-key", Priority: 2, Brand: "example", SignKeyID: "other-key", OrganizationID: "abc"},
+		{Name: "drones", Priority: 3, Brand: "example", Model: "drone-1000", SerialPattern: "DR[0-9]+", SignKeyID: serial1Assertion.SignKeyID(),
+			StoreID: "example-store", OrganizationID: "def", Groups: []string{"drones", "field"}, DeviceData: "ZGF0YQ=="},
+	}
+
+	tests := []struct {
+		name       string
+		serial     string
+		wantOrg    string
+		wantData   string
+		wantGroups []string
+		wantErr    string
+	}{
+		{"rule", "DR1000", "def", "ZGF0YQ==", []string{"drones", "field"}, ""},
+		{"default", "DR1000A", "abc", "", nil, ""},
+		{"pending", "HOLD1", "", "", nil, "pending approval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, db := newTestAutoRegistrationService(t)
+			for _, r := range rules {
+				_, err := id.AutoRegistrationRuleCreate(r)
+				assert.NoError(t, err)
+			}
+
+			req := datastore.DeviceEnrollRequest{Brand: "example", Model: "drone-1000", SerialNumber: tt.serial, StoreID: "example-store", DeviceKey: "AAAAAAAA"}
+			got, _, err := id.enroll(&req, &EnrollDeviceRequest{Model: model3Assertion, Serial: serial1Assertion})
+			if len(tt.wantErr) > 0 {
+				assert.ErrorContains(t, err, tt.wantErr)
+				_, err = db.DeviceGet(req.Brand, req.Model, req.SerialNumber)
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantOrg, got.Organization.ID)
+			assert.Equal(t, tt.wantData, got.DeviceData)
+
+			orgID, groups, err := id.AutoRegistrationGroups(got.ID)
+			assert.NoError(t, err)
+			if tt.wantGroups == nil {
+				assert.Empty(t, groups)
+				return
+			}
+			assert.Equal(t, tt.wantGroups, groups)
+			assert.Equal(t, tt.wantOrg, orgID)
+
+			assert.NoError(t, id.AutoRegistrationGroupsApplied(got.ID))
+			_, groups, err = id.AutoRegistrationGroups(got.ID)
+			assert.NoError(t, err)
+			assert.Empty(t, groups)
+		})
+	}
+}
+
+func TestIdentityService_AutoRegistrationEvaluate(t *testing.T) {
+	assertions := []byte(model1 + "\n\n" + serial1)
+
+	tests := []struct {
+		name         string
+		rules        []domain.AutoRegistrationRule
+		data         []byte
+		enabled      bool
+		wantRule     string
+		wantOrg      string
+		wantEligible bool
+		wantPending  bool
+		wantErr      bool
+	}{
+		{"valid-rule", []domain.AutoRegistrationRule{{Name: "core", Brand: "canonical", SerialPattern: "d75f7300-.*", OrganizationID: "def"}}, assertions, true, "core", "def", true, false, false},
+		{"valid-pending", []domain.AutoRegistrationRule{{Name: "hold", Model: "ubuntu-core-18-amd64", PendingApproval: true}}, assertions, true, "hold", "", true, true, false},
+		{"valid-default", []domain.AutoRegistrationRule{{Name: "other", Brand: "other", OrganizationID: "def"}}, assertions, true, "", "abc", true, false, false},
+		{"valid-disabled", nil, assertions, false, "", "abc", false, false, false},
+		{"invalid-serial-only", nil, []byte(serial1), true, "", "", false, false, true},
+		{"invalid-mismatch", nil, []byte(model2 + "\n\n" + serial1), true, "", "", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, _ := newTestAutoRegistrationService(t)
+			viper.Set(keys.AutoRegistrationEnabled, tt.enabled)
+			for _, r := range tt.rules {
+				_, err := id.AutoRegistrationRuleCreate(r)
+				assert.NoError(t, err)
+			}
+
+			got, err := id.AutoRegistrationEvaluate(tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantEligible, got.Eligible, got.Reason)
+			assert.Equal(t, tt.wantOrg, got.OrganizationID)
+			assert.Equal(t, tt.wantPending, got.PendingApproval)
+			if len(tt.wantRule) == 0 {
+				assert.Nil(t, got.Rule)
+			} else if assert.NotNil(t, got.Rule) {
+				assert.Equal(t, tt.wantRule, got.Rule.Name)
+			}
+			if !tt.enabled {
+				assert.True(t, strings.Contains(got.Reason, "disabled"))
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/datastore"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/spf13/viper"
+)
+
+// Formats of a bulk registration upload
+const (
+	RegistrationFormatCSV       = "csv"
+	RegistrationFormatJSONLines = "jsonl"
+)
+
+const (
+	maxBulkRegistrationDevices   = 10000
+	maxBulkRegistrationLineBytes = 1024 * 1024
+)
+
+// deviceRegistrationRow is a device read from a bulk registration upload
+type deviceRegistrationRow struct {
+	line   int
+	device RegisterDeviceRequest
+	err    error
+}
+
+// RegisterDevices registers devices in bulk, and reports the outcome for each of them.
+// An existing registration of a device is kept, as with RegisterDevice.
+func (id IdentityService) RegisterDevices(req *RegisterDevicesRequest) ([]domain.DeviceRegistrationResult, error) {
+	if err := validateNotEmpty("organization ID", req.OrganizationID); err != nil {
+		return nil, err
+	}
+	org, err := id.DB.OrganizationGet(req.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := parseDeviceRegistrations(req.Format, req.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no devices to register")
+	}
+	if len(rows) > maxBulkRegistrationDevices {
+		return nil, fmt.Errorf("%d devices is more than the limit of %d in one upload", len(rows), maxBulkRegistrationDevices)
+	}
+
+	// Check every device before any is registered
+	results := make([]domain.DeviceRegistrationResult, len(rows))
+	newRows := []int{}
+	seen := map[string]int{}
+	failed := false
+	for i, row := range rows {
+		r := &results[i]
+		r.Line = row.line
+		r.Brand, r.Model, r.SerialNumber = row.device.Brand, row.device.Model, row.device.SerialNumber
+
+		if err := id.checkDeviceRegistration(row, seen); err != nil {
+			r.Status, r.Error = domain.DeviceRegistrationInvalid, err.Error()
+			failed = true
+			continue
+		}
+
+		device, err := id.DB.DeviceGet(r.Brand, r.Model, r.SerialNumber)
+		switch {
+		case err == nil:
+			r.Status, r.ID = domain.DeviceRegistrationExists, device.ID
+		case errors.Is(err, sql.ErrNoRows):
+			newRows = append(newRows, i)
+		default:
+			r.Status, r.Error = domain.DeviceRegistrationFailed, err.Error()
+			failed = true
+		}
+	}
+
+	if failed && !req.BestEffort {
+		skipDeviceRegistrations(results, newRows, "another device could not be registered")
+		return results, nil
+	}
+
+	// The CA is loaded once for all the certificates
+	authority, err := cert.IssuingAuthority(org, viper.GetString(keys.GetIdentityKey(keys.CertificatesPath)))
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []datastore.DeviceNewRequest{}
+	for n, i := range newRows {
+		r := &results[i]
+		deviceID := datastore.GenerateID()
+		credentials, err := newCredentialsWith(authority, org, deviceID)
+		if err != nil {
+			r.Status, r.Error = domain.DeviceRegistrationFailed, err.Error()
+			if !req.BestEffort {
+				skipDeviceRegistrations(results, append(newRows[:n:n], newRows[n+1:]...), "another device could not be registered")
+				return results, nil
+			}
+			continue
+		}
+
+		d := datastore.DeviceNewRequest{
+			ID:             deviceID,
+			OrganizationID: req.OrganizationID,
+			Brand:          r.Brand,
+			Model:          r.Model,
+			SerialNumber:   r.SerialNumber,
+			Credentials:    credentials,
+			DeviceData:     rows[i].device.DeviceData,
+		}
+		r.ID = deviceID
+
+		if !req.BestEffort {
+			devices = append(devices, d)
+			continue
+		}
+		if _, err := id.DB.DeviceNew(d); err != nil {
+			r.ID, r.Status, r.Error = "", domain.DeviceRegistrationFailed, err.Error()
+			continue
+		}
+		r.Status = domain.DeviceRegistrationRegistered
+	}
+
+	if req.BestEffort {
+		return results, nil
+	}
+
+	if err := id.DB.DeviceNewBatch(devices); err != nil {
+		// The device that failed is reported when it is known, the others were not registered because of it
+		var batchErr *datastore.DeviceBatchError
+		if errors.As(err, &batchErr) && batchErr.Index >= 0 && batchErr.Index < len(newRows) {
+			failedRow := newRows[batchErr.Index]
+			skipDeviceRegistrations(results, append(newRows[:batchErr.Index:batchErr.Index], newRows[batchErr.Index+1:]...), "another device could not be registered")
+			results[failedRow].ID, results[failedRow].Status, results[failedRow].Error = "", domain.DeviceRegistrationFailed, err.Error()
+			return results, nil
+		}
+		for _, i := range newRows {
+			results[i].ID, results[i].Status, results[i].Error = "", domain.DeviceRegistrationFailed, err.Error()
+		}
+		return results, nil
+	}
+	for _, i := range newRows {
+		results[i].Status = domain.DeviceRegistrationRegistered
+	}
+
+	Logger.Infof("Registered %d devices in organization %s", len(newRows), req.OrganizationID)
+	return results, nil
+}
+
+// checkDeviceRegistration validates a device of a bulk registration, that is not a duplicate of an earlier one
+func (id IdentityService) checkDeviceRegistration(row deviceRegistrationRow, seen map[string]int) error {
+	if row.err != nil {
+		return row.err
+	}
+
+	for k, v := range map[string]string{
+		"brand":         row.device.Brand,
+		"model name":    row.device.Model,
+		"serial number": row.device.SerialNumber,
+	} {
+		if err := validateNotEmpty(k, v); err != nil {
+			return err
+		}
+	}
+
+	key := strings.Join([]string{row.device.Brand, row.device.Model, row.device.SerialNumber}, "/")
+	if line, ok := seen[key]; ok {
+		return fmt.Errorf("the device is a duplicate of line %d", line)
+	}
+	seen[key] = row.line
+	return nil
+}
+
+func skipDeviceRegistrations(results []domain.DeviceRegistrationResult, rows []int, reason string) {
+	for _, i := range rows {
+		results[i].ID, results[i].Status, results[i].Error = "", domain.DeviceRegistrationSkipped, reason
+	}
+}
+
+// parseDeviceRegistrations reads the devices of a bulk registration upload
+func parseDeviceRegistrations(format string, data []byte) ([]deviceRegistrationRow, error) {
+	switch format {
+	case RegistrationFormatCSV:
+		return parseDeviceRegistrationsCSV(data)
+	case RegistrationFormatJSONLines:
+		return parseDeviceRegistrationsJSONLines(data)
+	default:
+		return nil, fmt.Errorf("invalid registration format `%s`", format)
+	}
+}
+
+// parseDeviceRegistrationsCSV reads devices from CSV, with the columns brand, model, serial and, optionally, device
+// data. A header row, starting with brand, names the columns so they can be in any order.
+func parseDeviceRegistrationsCSV(data []byte) ([]deviceRegistrationRow, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	columns := map[string]int{"brand": 0, "model": 1, "serial": 2, "devicedata": 3}
+	rows := []deviceRegistrationRow{}
+	first := true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, deviceRegistrationRow{line: parseErr.Line, err: parseErr.Err})
+			first = false
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV: %w", err)
+		}
+
+		line, _ := r.FieldPos(0)
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "brand") {
+			columns = csvColumns(record)
+			first = false
+			continue
+		}
+		first = false
+
+		row := deviceRegistrationRow{line: line}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row.device = RegisterDeviceRequest{
+			Brand:        field("brand"),
+			Model:        field("model"),
+			SerialNumber: field("serial"),
+			DeviceData:   field("devicedata"),
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// csvColumns maps the column names of a CSV header row to their positions
+func csvColumns(header []string) map[string]int {
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(name))
+		if name == "serialnumber" {
+			name = "serial"
+		}
+		columns[name] = i
+	}
+	return columns
+}
+
+// parseDeviceRegistrationsJSONLines reads devices from JSON lines, with the fields of a single registration
+func parseDeviceRegistrationsJSONLines(data []byte) ([]deviceRegistrationRow, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBulkRegistrationLineBytes)
+
+	rows := []deviceRegistrationRow{}
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		row := deviceRegistrationRow{line: line}
+		if err := json.Unmarshal(scanner.Bytes(), &row.device); err != nil {
+			row.err = fmt.Errorf("invalid JSON: %w", err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading JSON lines: %w", err)
+	}
+	return rows, nil
+}
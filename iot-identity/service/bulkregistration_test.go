@@ -0,0 +1,128 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/everactive/dmscore/iot-identity/datastore"
+	"github.com/everactive/dmscore/iot-identity/datastore/memory"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentityService_RegisterDevices(t *testing.T) {
+	csvValid := "brand,serial,model,device-data\nexample,DR2000A1,drone-2000,ZGF0YQ==\nexample,DR1000A111,drone-1000,\n"
+	csvInvalid := "example,drone-2000,DR2000A1\nexample,drone-2000\nexample,drone-2000,DR2000A1\n"
+	jsonValid := "{\"brand\":\"example\",\"model\":\"drone-2000\",\"serial\":\"DR2000A1\",\"deviceData\":\"ZGF0YQ==\"}\n\n{\"brand\":\"example\",\"model\":\"drone-2000\",\"serial\":\"DR2000A2\"}\n"
+	jsonInvalid := "{\"brand\":\"example\",\"model\":\"drone-2000\",\"serial\":\"DR2000A1\"}\n\\u1000\n"
+
+	tests := []struct {
+		name       string
+		req        RegisterDevicesRequest
+		wantStatus []string
+		wantLines  []int
+		wantNew    int
+		wantErr    string
+	}{
+		{"valid-csv", RegisterDevicesRequest{OrganizationID: "abc", Format: RegistrationFormatCSV, Data: []byte(csvValid)},
+			[]string{domain.DeviceRegistrationRegistered, domain.DeviceRegistrationExists}, []int{2, 3}, 1, ""},
+		{"valid-json-lines", RegisterDevicesRequest{OrganizationID: "abc", Format: RegistrationFormatJSONLines, Data: []byte(jsonValid)},
+			[]string{domain.DeviceRegistrationRegistered, domain.DeviceRegistrationRegistered}, []int{1, 3}, 2, ""},
+		{"invalid-csv-transaction", RegisterDevicesRequest{OrganizationID: "abc", Format: RegistrationFormatCSV, Data: []byte(csvInvalid)},
+			[]string{domain.DeviceRegistrationSkipped, domain.DeviceRegistrationInvalid, domain.DeviceRegistrationInvalid}, []int{1, 2, 3}, 0, ""},
+		{"invalid-csv-best-effort", RegisterDevicesRequest{OrganizationID: "abc", Format: RegistrationFormatCSV, Data: []byte(csvInvalid), BestEffort: true},
+			[]string{domain.DeviceRegistrationRegistered, domain.DeviceRegistrationInvalid, domain.DeviceRegistrationInvalid}, []int{1, 2, 3}, 1, ""},
+		{"invalid-json-lines-transaction", RegisterDevicesRequest{OrganizationID: "abc", Format: RegistrationFormatJSONLines, Data: []byte(jsonInvalid)},
+			[]string{domain.DeviceRegistrationSkipped, domain.DeviceRegistrationInvalid}, []int{1, 2}, 0, ""},
+		{"invalid-org", RegisterDevicesRequest{OrganizationID: "invalid", Format: RegistrationFormatCSV, Data: []byte(csvValid)}, nil, nil, 0, "invalid"},
+		{"invalid-format", RegisterDevicesRequest{OrganizationID: "abc", Format: "xml", Data: []byte(csvValid)}, nil, nil, 0, "invalid registration format `xml`"},
+		{"invalid-empty", RegisterDevicesRequest{OrganizationID: "abc", Format: RegistrationFormatCSV, Data: []byte("brand,model,serial\n")}, nil, nil, 0, "no devices to register"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, db := newTestAutoRegistrationService(t)
+			before := len(db.Roll)
+
+			got, err := id.RegisterDevices(&tt.req)
+			if len(tt.wantErr) > 0 {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+
+			status, lines := []string{}, []int{}
+			for _, r := range got {
+				status = append(status, r.Status)
+				lines = append(lines, r.Line)
+				if r.Status == domain.DeviceRegistrationRegistered || r.Status == domain.DeviceRegistrationExists {
+					assert.NotEmpty(t, r.ID)
+				}
+			}
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantLines, lines)
+			assert.Equal(t, before+tt.wantNew, len(db.Roll))
+		})
+	}
+}
+
+// failingBatchStore fails to store the second device of a batch
+type failingBatchStore struct {
+	*memory.Store
+}
+
+func (s failingBatchStore) DeviceNewBatch(devices []datastore.DeviceNewRequest) error {
+	return &datastore.DeviceBatchError{Index: 1, Err: errors.New("MOCK error storing device")}
+}
+
+func TestIdentityService_RegisterDevicesBatchError(t *testing.T) {
+	id, db := newTestAutoRegistrationService(t)
+	id.DB = failingBatchStore{db}
+
+	got, err := id.RegisterDevices(&RegisterDevicesRequest{OrganizationID: "abc", Format: RegistrationFormatCSV, Data: []byte("example,drone-2000,DR2000A1\nexample,drone-2000,DR2000A2\nexample,drone-2000,DR2000A3\n")})
+	assert.NoError(t, err)
+
+	// Only the device that failed is reported as failed
+	status := []string{}
+	for _, r := range got {
+		status = append(status, r.Status)
+		assert.Empty(t, r.ID)
+	}
+	assert.Equal(t, []string{domain.DeviceRegistrationSkipped, domain.DeviceRegistrationFailed, domain.DeviceRegistrationSkipped}, status)
+	assert.Equal(t, "MOCK error storing device", got[1].Error)
+}
+
+func TestIdentityService_RegisterDevicesDeviceData(t *testing.T) {
+	id, db := newTestAutoRegistrationService(t)
+
+	got, err := id.RegisterDevices(&RegisterDevicesRequest{OrganizationID: "def", Format: RegistrationFormatCSV, Data: []byte("example,drone-2000,DR2000A1,ZGF0YQ==\n")})
+	assert.NoError(t, err)
+	if !assert.Len(t, got, 1) {
+		return
+	}
+
+	device, err := db.DeviceGet("example", "drone-2000", "DR2000A1")
+	assert.NoError(t, err)
+	assert.Equal(t, got[0].ID, device.ID)
+	assert.Equal(t, "def", device.Organization.ID)
+	assert.Equal(t, "ZGF0YQ==", device.DeviceData)
+	assert.NotEmpty(t, device.Credentials.Certificate)
+}
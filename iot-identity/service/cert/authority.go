@@ -0,0 +1,147 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/iot-identity/domain"
+)
+
+// Authority is a certificate authority that signs device certificates and their revocation information
+type Authority struct {
+	Certificate *x509.Certificate
+	Signer      crypto.Signer
+}
+
+// RootAuthority loads the root CA from the filesystem
+func RootAuthority(certsPath string) (*Authority, error) {
+	caKeyPair, caTemplate, err := getCertificateAuthority(certsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAuthority(caKeyPair, caTemplate)
+}
+
+// ParseAuthority parses a PEM encoded CA certificate and private key, checking that they match and that the
+// certificate can sign certificates
+func ParseAuthority(certPEM, keyPEM []byte) (*Authority, error) {
+	keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CA: %w", err)
+	}
+
+	c, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CA: %w", err)
+	}
+
+	if !isAuthority(c) {
+		return nil, fmt.Errorf("the certificate is not a CA that can sign certificates")
+	}
+
+	return newAuthority(keyPair, c)
+}
+
+// OrganizationAuthority returns the CA of an organization. Organizations created before they had their own CA
+// have a server certificate instead, for those it returns nil and their devices are signed by the root CA.
+func OrganizationAuthority(org *domain.Organization) (*Authority, error) {
+	return organizationAuthority(org.RootCert, org.RootKey)
+}
+
+// PreviousOrganizationAuthority returns the CA an organization rotated from, while it is in its overlap period
+func PreviousOrganizationAuthority(org *domain.Organization, now time.Time) (*Authority, error) {
+	if org.PreviousRootExpiresAt == nil || now.After(*org.PreviousRootExpiresAt) {
+		return nil, nil
+	}
+
+	return organizationAuthority(org.PreviousRootCert, org.PreviousRootKey)
+}
+
+// IssuingAuthority returns the CA that signs the device certificates of an organization, which is its own CA if it
+// has one, or otherwise the root CA
+func IssuingAuthority(org *domain.Organization, certsPath string) (*Authority, error) {
+	authority, err := OrganizationAuthority(org)
+	if err != nil || authority != nil {
+		return authority, err
+	}
+
+	return RootAuthority(certsPath)
+}
+
+// Bundle returns the PEM encoded certificates of the authorities
+func Bundle(authorities ...*Authority) []byte {
+	bundle := []byte{}
+	for _, a := range authorities {
+		bundle = append(bundle, certToPEM(a.Certificate.Raw)...)
+	}
+	return bundle
+}
+
+// chainPEM appends the issuing authority to a PEM encoded client certificate when it is an intermediate CA, so
+// devices present the chain up to the root CA to brokers that only trust the root
+func chainPEM(certPEM []byte, authority *Authority) []byte {
+	if bytes.Equal(authority.Certificate.RawIssuer, authority.Certificate.RawSubject) {
+		return certPEM
+	}
+	return append(certPEM, Bundle(authority)...)
+}
+
+func organizationAuthority(certPEM, keyPEM []byte) (*Authority, error) {
+	if len(certPEM) == 0 {
+		return nil, nil
+	}
+
+	c, err := parseRootCertificate(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read organization CA: %w", err)
+	}
+	if !isAuthority(c) {
+		return nil, nil
+	}
+
+	return ParseAuthority(certPEM, keyPEM)
+}
+
+func newAuthority(keyPair tls.Certificate, c *x509.Certificate) (*Authority, error) {
+	signer, ok := keyPair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("the CA key cannot be used for signing")
+	}
+
+	return &Authority{Certificate: c, Signer: signer}, nil
+}
+
+func isAuthority(c *x509.Certificate) bool {
+	return c.BasicConstraintsValid && c.IsCA && c.KeyUsage&x509.KeyUsageCertSign != 0
+}
+
+// capValidity keeps a certificate from outliving the CA that signs it
+func capValidity(template, parent *x509.Certificate) {
+	if template.NotAfter.After(parent.NotAfter) {
+		template.NotAfter = parent.NotAfter
+	}
+}
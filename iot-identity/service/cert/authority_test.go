@@ -0,0 +1,200 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/iot-identity/domain"
+)
+
+// testOrganization returns an organization with its own CA, signed by the test root CA
+func testOrganization(t *testing.T) *domain.Organization {
+	keyPEM, certPEM, err := CreateOrganizationCert(testCertsPath, "Example PLC")
+	if err != nil {
+		t.Fatalf("CreateOrganizationCert() error = %v", err)
+	}
+	return &domain.Organization{ID: "abc", Name: "Example PLC", RootCert: certPEM, RootKey: keyPEM}
+}
+
+func TestParseAuthority(t *testing.T) {
+	org := testOrganization(t)
+	rootCert, _ := os.ReadFile(path.Join(testCertsPath, rootCA))
+	rootKey, _ := os.ReadFile(path.Join(testCertsPath, rootCAKey))
+	clientKey, clientCert, _ := CreateClientCert(org, testCertsPath, "abc123")
+
+	tests := []struct {
+		name    string
+		certPEM []byte
+		keyPEM  []byte
+		wantErr bool
+	}{
+		{"organization-ca", org.RootCert, org.RootKey, false},
+		{"root-ca", rootCert, rootKey, false},
+		{"not-a-ca", clientCert, clientKey, true},
+		{"mismatched-key", org.RootCert, rootKey, true},
+		{"invalid", []byte("not a certificate"), []byte("not a key"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAuthority(tt.certPEM, tt.keyPEM)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseAuthority() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && (got.Certificate == nil || got.Signer == nil) {
+				t.Errorf("ParseAuthority() = %v, want certificate and signer", got)
+			}
+		})
+	}
+}
+
+func TestOrganizationAuthority(t *testing.T) {
+	org := testOrganization(t)
+	serverKey, serverCert, _ := CreateClientCert(&domain.Organization{Name: "Example PLC"}, testCertsPath, "server")
+
+	tests := []struct {
+		name    string
+		org     *domain.Organization
+		wantNil bool
+		wantErr bool
+	}{
+		{"organization-ca", org, false, false},
+		{"server-certificate", &domain.Organization{RootCert: serverCert, RootKey: serverKey}, true, false},
+		{"no-certificate", &domain.Organization{}, true, false},
+		{"mismatched-key", &domain.Organization{RootCert: org.RootCert, RootKey: serverKey}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := OrganizationAuthority(tt.org)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OrganizationAuthority() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("OrganizationAuthority() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestPreviousOrganizationAuthority(t *testing.T) {
+	now := time.Now()
+	previous := testOrganization(t)
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		wantNil   bool
+	}{
+		{"overlapping", &future, false},
+		{"expired", &past, true},
+		{"none", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			org := &domain.Organization{PreviousRootCert: previous.RootCert, PreviousRootKey: previous.RootKey, PreviousRootExpiresAt: tt.expiresAt}
+			got, err := PreviousOrganizationAuthority(org, now)
+			if err != nil {
+				t.Errorf("PreviousOrganizationAuthority() error = %v", err)
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("PreviousOrganizationAuthority() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestIssuingAuthority(t *testing.T) {
+	org := testOrganization(t)
+	root, _ := RootAuthority(testCertsPath)
+
+	// Device certificates of an organization with a CA chain through it to the root CA
+	_, certPEM, err := CreateClientCert(org, testCertsPath, "abc123")
+	if err != nil {
+		t.Fatalf("CreateClientCert() error = %v", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	c, _ := x509.ParseCertificate(block.Bytes)
+
+	orgCA, _ := OrganizationAuthority(org)
+	if c.Issuer.String() != orgCA.Certificate.Subject.String() {
+		t.Errorf("CreateClientCert() issuer = %v, want %v", c.Issuer, orgCA.Certificate.Subject)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Certificate)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(orgCA.Certificate)
+	if _, err := c.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("CreateClientCert() certificate does not chain to the root CA: %v", err)
+	}
+
+	// Organizations without a CA are signed by the root CA
+	got, err := IssuingAuthority(&domain.Organization{Name: "Example PLC"}, testCertsPath)
+	if err != nil {
+		t.Fatalf("IssuingAuthority() error = %v", err)
+	}
+	if !got.Certificate.Equal(root.Certificate) {
+		t.Errorf("IssuingAuthority() = %v, want the root CA", got.Certificate.Subject)
+	}
+}
+
+func TestCreateClientCertChain(t *testing.T) {
+	tests := []struct {
+		name       string
+		org        *domain.Organization
+		wantBlocks int
+	}{
+		{"organization-ca", testOrganization(t), 2},
+		{"root-ca", &domain.Organization{ID: "abc", Name: "Example PLC"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, certPEM, err := CreateClientCert(tt.org, testCertsPath, "abc123")
+			if err != nil {
+				t.Fatalf("CreateClientCert() error = %v", err)
+			}
+
+			var certs []*x509.Certificate
+			for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+				c, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					t.Fatalf("ParseCertificate() error = %v", err)
+				}
+				certs = append(certs, c)
+			}
+			if len(certs) != tt.wantBlocks {
+				t.Fatalf("CreateClientCert() certificates = %d, want %d", len(certs), tt.wantBlocks)
+			}
+			if certs[0].IsCA {
+				t.Errorf("CreateClientCert() the client certificate must come first")
+			}
+		})
+	}
+}
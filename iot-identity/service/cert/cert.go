@@ -33,9 +33,10 @@ import (
 )
 
 const (
-	rootCA      = "ca.crt"
-	rootCAKey   = "ca.key"
-	largeNumber = 8594
+	rootCA    = "ca.crt"
+	rootCAKey = "ca.key"
+	// serialNumberBits is the size of certificate serial numbers, they must be unique for revocation to work
+	serialNumberBits = 128
 )
 
 // getCertificateAuthority loads the root certificate and key from the filesystem
@@ -58,7 +59,7 @@ func getCertificateAuthority(certsPath string) (tls.Certificate, *x509.Certifica
 }
 
 func randomNumber() (*big.Int, error) {
-	return rand.Int(rand.Reader, big.NewInt(largeNumber))
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
 }
 
 func parseRootCertificate(rootCert []byte) (*x509.Certificate, error) {
@@ -20,11 +20,13 @@
 package cert
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -34,21 +36,27 @@ import (
 
 const (
 	certificateBitSize = 2048
+	csrPEMType         = "CERTIFICATE REQUEST"
 )
 
-// CreateClientCert creates a signed client certificate
+// CreateClientCert creates a client certificate, signed by the CA of the organization or by the root CA
+// for organizations that don't have their own
 func CreateClientCert(org *domain.Organization, certsPath, deviceID string) ([]byte, []byte, error) {
-	// Get the parsed CA from the filesystem
-	caKeyPair, caTemplate, err := getCertificateAuthority(certsPath)
+	authority, err := IssuingAuthority(org, certsPath)
 	if err != nil {
 		return nil, nil, err
 	}
+	return CreateClientCertWith(authority, org, deviceID)
+}
 
+// CreateClientCertWith creates a client certificate signed by a CA that is already loaded, e.g. for many devices
+func CreateClientCertWith(authority *Authority, org *domain.Organization, deviceID string) ([]byte, []byte, error) {
 	template := clientTemplate(org.Name, deviceID)
-	privateKey, cert, err := createCertificate(template, caTemplate, caKeyPair)
+	capValidity(template, authority.Certificate)
+	privateKey, cert, err := createCertificate(template, authority.Certificate, authority.Signer)
 
 	// Create plain text PEM for certificate
-	certPEM := certToPEM(cert)
+	certPEM := chainPEM(certToPEM(cert), authority)
 
 	// Create plain text PEM for key
 	keyPEM := keyToPEM(privateKey)
@@ -56,7 +64,81 @@ func CreateClientCert(org *domain.Organization, certsPath, deviceID string) ([]b
 	return keyPEM, certPEM, err
 }
 
-func createCertificate(template, parentTemplate *x509.Certificate, keyPair tls.Certificate) (*rsa.PrivateKey, []byte, error) {
+// CreateClientCertFromCSR creates a signed client certificate for the public key of a certificate signing request.
+// Only the public key is taken from the request, the subject and extensions are the same as for CreateClientCert.
+func CreateClientCertFromCSR(org *domain.Organization, certsPath, deviceID string, csr *x509.CertificateRequest) ([]byte, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid certificate signing request signature: %w", err)
+	}
+
+	return CreateClientCertForKey(org, certsPath, deviceID, csr.PublicKey)
+}
+
+// CreateClientCertForKey creates a signed client certificate for a public key the device already holds the private
+// key of, e.g. the key of its current certificate
+func CreateClientCertForKey(org *domain.Organization, certsPath, deviceID string, publicKey crypto.PublicKey) ([]byte, error) {
+	authority, err := IssuingAuthority(org, certsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	template := clientTemplate(org.Name, deviceID)
+	capValidity(template, authority.Certificate)
+	cert, err := x509.CreateCertificate(rand.Reader, template, authority.Certificate, publicKey, authority.Signer)
+	if err != nil {
+		log.Errorf("Error creating client certificate: %s", err)
+		return nil, err
+	}
+
+	return chainPEM(certToPEM(cert), authority), nil
+}
+
+// PublicKey returns the public key of a PEM encoded certificate
+func PublicKey(certPEM []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse certificate PEM")
+	}
+
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return c.PublicKey, nil
+}
+
+// ParseCSR parses a PEM encoded certificate signing request
+func ParseCSR(csrPEM []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != csrPEMType {
+		return nil, fmt.Errorf("failed to parse certificate signing request PEM")
+	}
+
+	return x509.ParseCertificateRequest(block.Bytes)
+}
+
+// VerifyClientCert checks that a client certificate was issued by one of the CAs and is currently valid
+func VerifyClientCert(authorities []*Authority, c *x509.Certificate) error {
+	issued := false
+	for _, a := range authorities {
+		if c.CheckSignatureFrom(a.Certificate) == nil {
+			issued = true
+			break
+		}
+	}
+	if !issued {
+		return fmt.Errorf("the certificate was not issued by a CA of the organization")
+	}
+
+	now := time.Now()
+	if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+		return fmt.Errorf("the certificate is not valid at %s", now.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func createCertificate(template, parentTemplate *x509.Certificate, signer crypto.Signer) (*rsa.PrivateKey, []byte, error) {
 	// Generate a private key
 	privateKey, err := rsa.GenerateKey(rand.Reader, certificateBitSize)
 	if err != nil {
@@ -66,7 +148,7 @@ func createCertificate(template, parentTemplate *x509.Certificate, keyPair tls.C
 	pub := &privateKey.PublicKey
 
 	// Sign the certificate
-	cert, err := x509.CreateCertificate(rand.Reader, template, parentTemplate, pub, keyPair.PrivateKey)
+	cert, err := x509.CreateCertificate(rand.Reader, template, parentTemplate, pub, signer)
 	if err != nil {
 		log.Errorf("Error creating client certificate: %s", err)
 		return nil, nil, err
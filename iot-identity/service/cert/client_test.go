@@ -20,7 +20,14 @@
 package cert
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/everactive/dmscore/iot-identity/domain"
 )
@@ -55,3 +62,128 @@ func TestCreateClientCert(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyClientCert(t *testing.T) {
+	_, certPEM, err := CreateClientCert(&domain.Organization{Name: "Example PLC"}, testCertsPath, "abc123")
+	if err != nil {
+		t.Fatalf("CreateClientCert() error = %v", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	valid, _ := x509.ParseCertificate(block.Bytes)
+
+	caKeyPair, caTemplate, err := getCertificateAuthority(testCertsPath)
+	if err != nil {
+		t.Fatalf("getCertificateAuthority() error = %v", err)
+	}
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "abc123"},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-24 * time.Hour),
+	}
+
+	expiredDER, _ := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKeyPair.PrivateKey)
+	expired, _ := x509.ParseCertificate(expiredDER)
+
+	template.NotAfter = time.Now().Add(24 * time.Hour)
+	selfSignedDER, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	selfSigned, _ := x509.ParseCertificate(selfSignedDER)
+
+	root, _ := RootAuthority(testCertsPath)
+	org := testOrganization(t)
+	orgCA, _ := OrganizationAuthority(org)
+	_, orgCertPEM, _ := CreateClientCert(org, testCertsPath, "abc123")
+	orgBlock, _ := pem.Decode(orgCertPEM)
+	orgIssued, _ := x509.ParseCertificate(orgBlock.Bytes)
+
+	tests := []struct {
+		name        string
+		authorities []*Authority
+		cert        *x509.Certificate
+		wantErr     bool
+	}{
+		{"valid", []*Authority{root}, valid, false},
+		{"expired", []*Authority{root}, expired, true},
+		{"other-issuer", []*Authority{root}, selfSigned, true},
+		{"organization-ca", []*Authority{root, orgCA}, orgIssued, false},
+		{"other-organization-ca", []*Authority{orgCA}, valid, true},
+		{"no-authorities", nil, valid, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyClientCert(tt.authorities, tt.cert); (err != nil) != tt.wantErr {
+				t.Errorf("VerifyClientCert() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateClientCertFromCSR(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "ignored"}}, key)
+	if err != nil {
+		t.Fatalf("CreateCertificateRequest() error = %v", err)
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+
+	csr, err := ParseCSR(csrPEM)
+	if err != nil {
+		t.Fatalf("ParseCSR() error = %v", err)
+	}
+	tampered, _ := ParseCSR(csrPEM)
+	tampered.Signature = []byte("invalid")
+
+	tests := []struct {
+		name      string
+		certsPath string
+		csr       *x509.CertificateRequest
+		wantErr   bool
+	}{
+		{"valid", testCertsPath, csr, false},
+		{"invalid-signature", testCertsPath, tampered, true},
+		{"invalid-path", "invalid", csr, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certPEM, err := CreateClientCertFromCSR(&domain.Organization{Name: "Example PLC"}, tt.certsPath, "abc123", tt.csr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateClientCertFromCSR() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			block, _ := pem.Decode(certPEM)
+			c, _ := x509.ParseCertificate(block.Bytes)
+			if c.Subject.CommonName != "abc123" {
+				t.Errorf("CreateClientCertFromCSR() common name = %v, want abc123", c.Subject.CommonName)
+			}
+			if !key.PublicKey.Equal(c.PublicKey) {
+				t.Error("CreateClientCertFromCSR() certificate is not for the public key of the CSR")
+			}
+		})
+	}
+}
+
+func TestParseCSR(t *testing.T) {
+	_, certPEM, _ := CreateClientCert(&domain.Organization{Name: "Example PLC"}, testCertsPath, "abc123")
+
+	tests := []struct {
+		name    string
+		csrPEM  []byte
+		wantErr bool
+	}{
+		{"not-pem", []byte("not a CSR"), true},
+		{"certificate", certPEM, true},
+		{"bad-der", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: []byte("CSR")}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCSR(tt.csrPEM); (err != nil) != tt.wantErr {
+				t.Errorf("ParseCSR() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -32,16 +32,17 @@ const (
 
 var organizationCertificateDuration = time.Now().AddDate(organizationCertificateYearsLength, 0, 0)
 
-// CreateOrganizationCert creates a signed organization certificate
+// CreateOrganizationCert creates the CA of an organization, which signs the certificates of its devices.
+// It is signed by the root CA, so device certificates chain to both.
 func CreateOrganizationCert(certsPath, orgName string) ([]byte, []byte, error) {
-	// Get the parsed CA from the filesystem
-	caKeyPair, caTemplate, err := getCertificateAuthority(certsPath)
+	root, err := RootAuthority(certsPath)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	template := orgTemplate(orgName)
-	privateKey, cert, err := createCertificate(template, caTemplate, caKeyPair)
+	capValidity(template, root.Certificate)
+	privateKey, cert, err := createCertificate(template, root.Certificate, root.Signer)
 	if err != nil {
 		return nil, nil, fmt.Errorf("cannot create certificate: %v", err)
 	}
@@ -61,16 +62,19 @@ func orgTemplate(name string) *x509.Certificate {
 		return nil
 	}
 
-	// Prepare certificate
+	// Prepare certificate, the subject key ID is generated so each organization CA has its own
 	return &x509.Certificate{
 		SerialNumber: serial,
 		Subject: pkix.Name{
+			CommonName:   name + " Device CA",
 			Organization: []string{name},
 		},
-		NotBefore:    time.Now(),
-		NotAfter:     organizationCertificateDuration,
-		SubjectKeyId: []byte{1, 2, 3},
-		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:     x509.KeyUsageDigitalSignature,
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(organizationCertificateYearsLength, 0, 0),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
 	}
 }
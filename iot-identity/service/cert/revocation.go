@@ -0,0 +1,279 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cert
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/everactive/dmscore/iot-identity/domain"
+)
+
+// Revocation reason codes (RFC 5280)
+const (
+	ReasonUnspecified          = ocsp.Unspecified
+	ReasonKeyCompromise        = ocsp.KeyCompromise
+	ReasonAffiliationChanged   = ocsp.AffiliationChanged
+	ReasonSuperseded           = ocsp.Superseded
+	ReasonCessationOfOperation = ocsp.CessationOfOperation
+	ReasonPrivilegeWithdrawn   = ocsp.PrivilegeWithdrawn
+)
+
+var oidExtensionReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// ErrMalformedOCSPRequest is returned when an OCSP request cannot be parsed
+var ErrMalformedOCSPRequest = errors.New("malformed OCSP request")
+
+// ValidReason checks that a revocation reason is one of the RFC 5280 reason codes
+func ValidReason(reason int) bool {
+	// 7 is not used
+	return reason >= ocsp.Unspecified && reason <= ocsp.AACompromise && reason != 7
+}
+
+// SerialNumber returns the serial number, in hex, of a PEM encoded certificate
+func SerialNumber(certPEM []byte) (string, error) {
+	serialNumber, _, err := Details(certPEM)
+	return serialNumber, err
+}
+
+// Details returns the serial number, in hex, and the expiry of a PEM encoded certificate
+func Details(certPEM []byte) (string, time.Time, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse certificate PEM")
+	}
+
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return c.SerialNumber.Text(16), c.NotAfter, nil
+}
+
+// KeyID identifies a CA by the SHA-1 hash of its public key, in hex, the way key identifiers and OCSP requests do
+func KeyID(ca *x509.Certificate) (string, error) {
+	publicKey, err := subjectPublicKey(ca)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha1.Sum(publicKey)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// RevocationKey returns what a PEM encoded certificate is revoked by: the key ID of the CA that issued it, one of
+// the authorities, and its serial number, in hex
+func RevocationKey(certPEM []byte, authorities []*Authority) (string, string, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return "", "", fmt.Errorf("failed to parse certificate PEM")
+	}
+
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	issuer, err := IssuerKeyID(c, authorities)
+	if err != nil {
+		return "", "", err
+	}
+	return issuer, c.SerialNumber.Text(16), nil
+}
+
+// IssuerKeyID returns the key ID of the CA, of the authorities, that signed a certificate. A certificate signed by
+// none of them, such as by a CA rotated out, is identified by its authority key identifier.
+func IssuerKeyID(c *x509.Certificate, authorities []*Authority) (string, error) {
+	for _, a := range authorities {
+		if c.CheckSignatureFrom(a.Certificate) == nil {
+			return KeyID(a.Certificate)
+		}
+	}
+
+	if len(c.AuthorityKeyId) > 0 {
+		return hex.EncodeToString(c.AuthorityKeyId), nil
+	}
+	return "", fmt.Errorf("cannot find the CA that issued certificate %s", c.SerialNumber.Text(16))
+}
+
+// CreateCRL creates a PEM encoded certificate revocation list of the revoked certificates, signed by the CA
+func CreateCRL(authority *Authority, revoked []domain.RevokedCertificate, validity time.Duration) ([]byte, error) {
+	entries := make([]pkix.RevokedCertificate, 0, len(revoked))
+	for _, r := range revoked {
+		serial, ok := new(big.Int).SetString(r.SerialNumber, 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid serial number %s for device %s", r.SerialNumber, r.DeviceID)
+		}
+
+		entry := pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: r.RevokedAt.UTC()}
+		if r.Reason != ReasonUnspecified {
+			value, err := asn1.Marshal(asn1.Enumerated(r.Reason))
+			if err != nil {
+				return nil, err
+			}
+			entry.Extensions = []pkix.Extension{{Id: oidExtensionReasonCode, Value: value}}
+		}
+		entries = append(entries, entry)
+	}
+
+	now := time.Now()
+	template := &x509.RevocationList{
+		RevokedCertificates: entries,
+		// The time keeps the CRL number increasing between generated lists
+		Number:     big.NewInt(now.Unix()),
+		ThisUpdate: now,
+		NextUpdate: now.Add(validity),
+	}
+
+	crl, err := x509.CreateRevocationList(rand.Reader, template, authority.Certificate, authority.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create CRL: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl}), nil
+}
+
+// OCSPResponders are the CAs that answer OCSP requests, indexed by their key ID. The first CA answers the requests
+// for certificates that none of them issued.
+type OCSPResponders struct {
+	authorities []*Authority
+	byKeyID     map[string]*Authority
+}
+
+// NewOCSPResponders indexes the CAs that answer OCSP requests by their key ID
+func NewOCSPResponders(authorities []*Authority) (*OCSPResponders, error) {
+	if len(authorities) == 0 {
+		return nil, fmt.Errorf("no CA to answer OCSP requests")
+	}
+
+	r := &OCSPResponders{authorities: authorities, byKeyID: map[string]*Authority{}}
+	for _, a := range authorities {
+		keyID, err := KeyID(a.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := r.byKeyID[keyID]; !ok {
+			r.byKeyID[keyID] = a
+		}
+	}
+	return r, nil
+}
+
+// issuer finds the CA that issued the certificate of a request, and its key ID. It is nil when none of them did.
+func (r *OCSPResponders) issuer(req *ocsp.Request) (*Authority, string, error) {
+	// The key ID is the SHA-1 hash of the public key, so SHA-1 requests are looked up directly
+	if req.HashAlgorithm == crypto.SHA1 {
+		keyID := hex.EncodeToString(req.IssuerKeyHash)
+		return r.byKeyID[keyID], keyID, nil
+	}
+
+	for keyID, a := range r.byKeyID {
+		issued, err := issuedBy(req, a.Certificate)
+		if err != nil {
+			return nil, "", err
+		}
+		if issued {
+			return a, keyID, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// CreateOCSPResponse answers a DER encoded OCSP request for a certificate issued by one of the CAs, signing the
+// response with that CA. Requests for other issuers are answered as unknown by the first CA.
+// The lookup returns the revocation of a serial number (in hex) issued by the CA with the key ID, or nil if not revoked.
+func CreateOCSPResponse(responders *OCSPResponders, request []byte, validity time.Duration, lookup func(issuer, serialNumber string) (*domain.RevokedCertificate, error)) ([]byte, error) {
+	req, err := ocsp.ParseRequest(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedOCSPRequest, err)
+	}
+
+	now := time.Now()
+	template := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(validity),
+	}
+
+	issuer, issuerKeyID, err := responders.issuer(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if issuer == nil {
+		issuer = responders.authorities[0]
+		template.Status = ocsp.Unknown
+	} else {
+		revoked, err := lookup(issuerKeyID, req.SerialNumber.Text(16))
+		if err != nil {
+			return nil, err
+		}
+		if revoked != nil {
+			template.Status = ocsp.Revoked
+			template.RevokedAt = revoked.RevokedAt
+			template.RevocationReason = revoked.Reason
+		}
+	}
+
+	return ocsp.CreateResponse(issuer.Certificate, issuer.Certificate, template, issuer.Signer)
+}
+
+// issuedBy checks the request is for a certificate issued by the CA, using the hash of its public key
+func issuedBy(req *ocsp.Request, ca *x509.Certificate) (bool, error) {
+	if !req.HashAlgorithm.Available() {
+		return false, fmt.Errorf("unsupported OCSP hash algorithm")
+	}
+
+	publicKey, err := subjectPublicKey(ca)
+	if err != nil {
+		return false, err
+	}
+
+	h := req.HashAlgorithm.New()
+	h.Write(publicKey)
+
+	return string(h.Sum(nil)) == string(req.IssuerKeyHash), nil
+}
+
+// subjectPublicKey returns the bits of the public key of a CA, which its key is identified by the hash of
+func subjectPublicKey(ca *x509.Certificate) ([]byte, error) {
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(ca.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return nil, fmt.Errorf("cannot parse CA public key: %w", err)
+	}
+	return publicKeyInfo.PublicKey.RightAlign(), nil
+}
@@ -0,0 +1,269 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package cert
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/everactive/dmscore/iot-identity/domain"
+)
+
+const testCertsPath = "../../datastore/test_data"
+
+func TestSerialNumber(t *testing.T) {
+	_, certPEM, err := CreateClientCert(&domain.Organization{Name: "Example PLC"}, testCertsPath, "abc123")
+	if err != nil {
+		t.Fatalf("CreateClientCert() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		certPEM []byte
+		wantErr bool
+	}{
+		{"valid", certPEM, false},
+		{"invalid-pem", []byte("not a certificate"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SerialNumber(tt.certPEM)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SerialNumber() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && len(got) == 0 {
+				t.Error("SerialNumber() = empty serial number")
+			}
+		})
+	}
+}
+
+func TestDetails(t *testing.T) {
+	_, certPEM, err := CreateClientCert(&domain.Organization{Name: "Example PLC"}, testCertsPath, "abc123")
+	if err != nil {
+		t.Fatalf("CreateClientCert() error = %v", err)
+	}
+
+	serialNumber, notAfter, err := Details(certPEM)
+	if err != nil {
+		t.Fatalf("Details() error = %v", err)
+	}
+	if want, _ := SerialNumber(certPEM); serialNumber != want {
+		t.Errorf("Details() serial number = %v, want %v", serialNumber, want)
+	}
+	if notAfter.Before(time.Now()) {
+		t.Errorf("Details() expiry = %v, want a time in the future", notAfter)
+	}
+
+	if _, _, err = Details([]byte("not a certificate")); err == nil {
+		t.Error("Details() expected error for invalid PEM")
+	}
+}
+
+func TestCreateCRL(t *testing.T) {
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	root, err := RootAuthority(testCertsPath)
+	if err != nil {
+		t.Fatalf("RootAuthority() error = %v", err)
+	}
+	orgCA, _ := OrganizationAuthority(testOrganization(t))
+
+	tests := []struct {
+		name      string
+		authority *Authority
+		revoked   []domain.RevokedCertificate
+		wantErr   bool
+	}{
+		{"valid", root, []domain.RevokedCertificate{{SerialNumber: "1a2b", RevokedAt: revokedAt, Reason: ReasonCessationOfOperation}, {SerialNumber: "3c4d", RevokedAt: revokedAt}}, false},
+		{"empty", root, nil, false},
+		{"organization-ca", orgCA, []domain.RevokedCertificate{{SerialNumber: "1a2b", RevokedAt: revokedAt}}, false},
+		{"invalid-serial", root, []domain.RevokedCertificate{{SerialNumber: "xyz"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CreateCRL(tt.authority, tt.revoked, time.Hour)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CreateCRL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			block, _ := pem.Decode(got)
+			if block == nil || block.Type != "X509 CRL" {
+				t.Fatalf("CreateCRL() = not a PEM CRL")
+			}
+			crl, err := x509.ParseRevocationList(block.Bytes)
+			if err != nil {
+				t.Fatalf("CreateCRL() parse error = %v", err)
+			}
+
+			if err := crl.CheckSignatureFrom(tt.authority.Certificate); err != nil {
+				t.Errorf("CreateCRL() signature error = %v", err)
+			}
+			if len(crl.RevokedCertificates) != len(tt.revoked) {
+				t.Errorf("CreateCRL() revoked = %d, want %d", len(crl.RevokedCertificates), len(tt.revoked))
+			}
+			for i, r := range crl.RevokedCertificates {
+				if r.SerialNumber.Text(16) != tt.revoked[i].SerialNumber || !r.RevocationTime.Equal(revokedAt) {
+					t.Errorf("CreateCRL() entry = %v, want %v", r, tt.revoked[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateOCSPResponse(t *testing.T) {
+	root, err := RootAuthority(testCertsPath)
+	if err != nil {
+		t.Fatalf("RootAuthority() error = %v", err)
+	}
+	ca := root.Certificate
+	orgCA, _ := OrganizationAuthority(testOrganization(t))
+
+	_, certPEM, err := CreateClientCert(&domain.Organization{Name: "Example PLC"}, testCertsPath, "abc123")
+	if err != nil {
+		t.Fatalf("CreateClientCert() error = %v", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	client, _ := x509.ParseCertificate(block.Bytes)
+
+	// A certificate from another issuer
+	otherCAPEM, _ := os.ReadFile("../../../testing/certs/ca.crt")
+	otherBlock, _ := pem.Decode(otherCAPEM)
+	otherCA, _ := x509.ParseCertificate(otherBlock.Bytes)
+
+	rootKeyID, err := KeyID(ca)
+	if err != nil {
+		t.Fatalf("KeyID() error = %v", err)
+	}
+
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	revoked := map[string]*domain.RevokedCertificate{
+		rootKeyID + "/" + client.SerialNumber.Text(16): {Issuer: rootKeyID, SerialNumber: client.SerialNumber.Text(16), RevokedAt: revokedAt, Reason: ReasonPrivilegeWithdrawn},
+	}
+	lookup := func(issuer, serial string) (*domain.RevokedCertificate, error) {
+		return revoked[issuer+"/"+serial], nil
+	}
+
+	goodCert := &x509.Certificate{SerialNumber: big.NewInt(12345)}
+	// The serial numbers are only unique per CA
+	sameSerialCert := &x509.Certificate{SerialNumber: client.SerialNumber}
+
+	responders, err := NewOCSPResponders([]*Authority{root, orgCA})
+	if err != nil {
+		t.Fatalf("NewOCSPResponders() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		cert       *x509.Certificate
+		issuer     *x509.Certificate
+		hash       crypto.Hash
+		wantStatus int
+	}{
+		{"good", goodCert, ca, crypto.SHA1, ocsp.Good},
+		{"revoked", client, ca, crypto.SHA1, ocsp.Revoked},
+		{"revoked-sha256", client, ca, crypto.SHA256, ocsp.Revoked},
+		{"organization-ca", goodCert, orgCA.Certificate, crypto.SHA1, ocsp.Good},
+		{"organization-ca-sha256", goodCert, orgCA.Certificate, crypto.SHA256, ocsp.Good},
+		{"same-serial-organization-ca", sameSerialCert, orgCA.Certificate, crypto.SHA1, ocsp.Good},
+		{"other-issuer", goodCert, otherCA, crypto.SHA1, ocsp.Unknown},
+		{"other-issuer-sha256", goodCert, otherCA, crypto.SHA256, ocsp.Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := ocsp.CreateRequest(tt.cert, tt.issuer, &ocsp.RequestOptions{Hash: tt.hash})
+			if err != nil {
+				t.Fatalf("ocsp.CreateRequest() error = %v", err)
+			}
+
+			got, err := CreateOCSPResponse(responders, req, time.Hour, lookup)
+			if err != nil {
+				t.Fatalf("CreateOCSPResponse() error = %v", err)
+			}
+
+			// Unknown issuers are answered by the first CA
+			responder := tt.issuer
+			if tt.wantStatus == ocsp.Unknown {
+				responder = ca
+			}
+			resp, err := ocsp.ParseResponseForCert(got, tt.cert, responder)
+			if err != nil {
+				t.Fatalf("ocsp.ParseResponse() error = %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("CreateOCSPResponse() status = %v, want %v", resp.Status, tt.wantStatus)
+			}
+			if tt.wantStatus == ocsp.Revoked && (!resp.RevokedAt.Equal(revokedAt) || resp.RevocationReason != ReasonPrivilegeWithdrawn) {
+				t.Errorf("CreateOCSPResponse() revocation = %v %v", resp.RevokedAt, resp.RevocationReason)
+			}
+		})
+	}
+
+	if _, err := CreateOCSPResponse(responders, []byte("invalid"), time.Hour, lookup); err == nil {
+		t.Error("CreateOCSPResponse() expected error for an invalid request")
+	}
+
+	if _, err := NewOCSPResponders(nil); err == nil {
+		t.Error("NewOCSPResponders() expected error without CAs")
+	}
+}
+
+func TestRevocationKey(t *testing.T) {
+	root, err := RootAuthority(testCertsPath)
+	if err != nil {
+		t.Fatalf("RootAuthority() error = %v", err)
+	}
+	orgCA, _ := OrganizationAuthority(testOrganization(t))
+
+	_, certPEM, err := CreateClientCert(&domain.Organization{Name: "Example PLC"}, testCertsPath, "abc123")
+	if err != nil {
+		t.Fatalf("CreateClientCert() error = %v", err)
+	}
+	serialNumber, _ := SerialNumber(certPEM)
+	rootKeyID, _ := KeyID(root.Certificate)
+
+	issuer, serial, err := RevocationKey(certPEM, []*Authority{orgCA, root})
+	if err != nil {
+		t.Fatalf("RevocationKey() error = %v", err)
+	}
+	if issuer != rootKeyID || serial != serialNumber {
+		t.Errorf("RevocationKey() = %s %s, want %s %s", issuer, serial, rootKeyID, serialNumber)
+	}
+
+	// A certificate of a CA that is not one of the authorities is identified by its authority key identifier
+	issuer, _, err = RevocationKey(certPEM, []*Authority{orgCA})
+	if err != nil || issuer != rootKeyID {
+		t.Errorf("RevocationKey() = %s, %v, want %s", issuer, err, rootKeyID)
+	}
+	if _, _, err := RevocationKey([]byte("invalid"), []*Authority{root}); err == nil {
+		t.Error("RevocationKey() expected error for an invalid certificate")
+	}
+}
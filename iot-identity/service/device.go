@@ -20,10 +20,12 @@
 package service
 
 import (
+	"crypto/x509"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"time"
 
 	"github.com/everactive/dmscore/config/keys"
 	"github.com/everactive/dmscore/iot-identity/models"
@@ -45,11 +47,56 @@ func (id IdentityService) DeviceGet(orgID, deviceID string) (*domain.Enrollment,
 	return id.DB.DeviceGetEnrollmentByID(deviceID)
 }
 
-// DeleteDevice deletes a device already in the service
+// DeleteDevice deletes a device already in the service, revoking its certificate
 func (id IdentityService) DeleteDevice(deviceID string) (string, error) {
+	device, err := id.DB.DeviceGetEnrollmentByID(deviceID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := id.revokeCredentials(device, cert.ReasonCessationOfOperation); err != nil {
+		return "", err
+	}
+
 	return id.DB.DeviceDelete(deviceID)
 }
 
+// DeviceListDeleted lists the soft deleted device registrations of an organization
+func (id IdentityService) DeviceListDeleted(orgID string) ([]domain.Enrollment, error) {
+	return id.DB.DeviceListDeleted(orgID)
+}
+
+// RestoreDevice restores a soft deleted device registration. The certificate of a deleted device is revoked,
+// so the device is issued new credentials, which it picks up by enrolling again.
+func (id IdentityService) RestoreDevice(deviceID string) (*domain.Enrollment, error) {
+	if err := id.DB.DeviceRestore(deviceID); err != nil {
+		return nil, err
+	}
+
+	device, err := id.DB.DeviceGetEnrollmentByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := id.credentialsRevoked(device)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		if err = id.reissueCredentials(device); err != nil {
+			return nil, err
+		}
+	}
+
+	return id.DB.DeviceGetEnrollmentByID(deviceID)
+}
+
+// PurgeDevices hard deletes the device registrations soft deleted before a time, returning their IDs. A dry run
+// only lists them.
+func (id IdentityService) PurgeDevices(deletedBefore time.Time, dryRun bool) ([]string, error) {
+	return id.DB.DevicePurge(deletedBefore, dryRun)
+}
+
 // RegisterDevice registers a new device with the service
 func (id IdentityService) RegisterDevice(req *RegisterDeviceRequest) (string, error) {
 	// Validate fields
@@ -82,20 +129,15 @@ func (id IdentityService) RegisterDevice(req *RegisterDeviceRequest) (string, er
 		return "", fmt.Errorf("getting registration for `%s/%s/%s`: %w", req.Brand, req.Model, req.SerialNumber, err)
 	}
 
-	rootCertsDir := viper.GetString(keys.GetIdentityKey(keys.CertificatesPath))
-
 	// Create a signed certificate
 	deviceID := datastore.GenerateID()
-	keyPEM, certPEM, err := cert.CreateClientCert(org, rootCertsDir, deviceID)
+	credentials, err := newCredentials(org, deviceID)
 	if err != nil {
 		return "", err
 	}
 
 	logrus.Infof("created new device ID for %s/%s/%s: %s", req.Brand, req.Model, req.SerialNumber, deviceID)
 
-	MQTTURL := viper.GetString(configkey.MQTTHostAddress)
-	MQTTPort := viper.GetString(configkey.MQTTHostPort)
-
 	// Create registration
 	d := datastore.DeviceNewRequest{
 		ID:             deviceID,
@@ -103,17 +145,101 @@ func (id IdentityService) RegisterDevice(req *RegisterDeviceRequest) (string, er
 		Brand:          req.Brand,
 		Model:          req.Model,
 		SerialNumber:   req.SerialNumber,
-		Credentials: domain.Credentials{
-			PrivateKey:  keyPEM,
-			Certificate: certPEM,
-			MQTTURL:     MQTTURL, // Using a default URL for all devices
-			MQTTPort:    MQTTPort,
-		},
-		DeviceData: req.DeviceData,
+		Credentials:    credentials,
+		DeviceData:     req.DeviceData,
 	}
 	return id.DB.DeviceNew(d)
 }
 
+// newCredentials creates the broker credentials for a device, with a newly signed certificate
+func newCredentials(org *domain.Organization, deviceID string) (domain.Credentials, error) {
+	authority, err := cert.IssuingAuthority(org, viper.GetString(keys.GetIdentityKey(keys.CertificatesPath)))
+	if err != nil {
+		return domain.Credentials{}, err
+	}
+	return newCredentialsWith(authority, org, deviceID)
+}
+
+// newCredentialsWith creates the broker credentials for a device, signed by a CA that is already loaded
+func newCredentialsWith(authority *cert.Authority, org *domain.Organization, deviceID string) (domain.Credentials, error) {
+	keyPEM, certPEM, err := cert.CreateClientCertWith(authority, org, deviceID)
+	if err != nil {
+		return domain.Credentials{}, err
+	}
+
+	serialNumber, expiresAt, err := cert.Details(certPEM)
+	if err != nil {
+		return domain.Credentials{}, err
+	}
+
+	return domain.Credentials{
+		PrivateKey:   keyPEM,
+		Certificate:  certPEM,
+		SerialNumber: serialNumber,
+		ExpiresAt:    &expiresAt,
+		MQTTURL:      viper.GetString(configkey.MQTTHostAddress), // Using a default URL for all devices
+		MQTTPort:     viper.GetString(configkey.MQTTHostPort),
+	}, nil
+}
+
+// newCredentialsFromCSR creates the broker credentials for a device, with a certificate signed for the public key
+// of the certificate signing request. The private key stays on the device so none is stored.
+func newCredentialsFromCSR(org *domain.Organization, deviceID string, csr *x509.CertificateRequest) (domain.Credentials, error) {
+	rootCertsDir := viper.GetString(keys.GetIdentityKey(keys.CertificatesPath))
+	certPEM, err := cert.CreateClientCertFromCSR(org, rootCertsDir, deviceID, csr)
+	if err != nil {
+		return domain.Credentials{}, err
+	}
+	return credentialsForCertificate(certPEM)
+}
+
+// newCredentialsForKey creates the broker credentials for a device, with a certificate signed for the public key of
+// its current certificate, for a device whose private key is only on the device
+func newCredentialsForKey(org *domain.Organization, device *domain.Enrollment) (domain.Credentials, error) {
+	publicKey, err := cert.PublicKey(device.Credentials.Certificate)
+	if err != nil {
+		return domain.Credentials{}, err
+	}
+
+	rootCertsDir := viper.GetString(keys.GetIdentityKey(keys.CertificatesPath))
+	certPEM, err := cert.CreateClientCertForKey(org, rootCertsDir, device.ID, publicKey)
+	if err != nil {
+		return domain.Credentials{}, err
+	}
+	return credentialsForCertificate(certPEM)
+}
+
+// credentialsForCertificate are the broker credentials for a certificate whose private key stays on the device
+func credentialsForCertificate(certPEM []byte) (domain.Credentials, error) {
+	serialNumber, expiresAt, err := cert.Details(certPEM)
+	if err != nil {
+		return domain.Credentials{}, err
+	}
+
+	return domain.Credentials{
+		Certificate:  certPEM,
+		SerialNumber: serialNumber,
+		ExpiresAt:    &expiresAt,
+		MQTTURL:      viper.GetString(configkey.MQTTHostAddress),
+		MQTTPort:     viper.GetString(configkey.MQTTHostPort),
+	}, nil
+}
+
+// usesCSR checks whether the certificate of a device was signed from a CSR, so its private key is only on the device
+func usesCSR(device *domain.Enrollment) bool {
+	return len(device.Credentials.Certificate) > 0 && len(device.Credentials.PrivateKey) == 0
+}
+
+// DeviceDataUpdate replaces the device data of a device, leaving its status unchanged
+func (id IdentityService) DeviceDataUpdate(deviceID, deviceData string) error {
+	device, err := id.DB.DeviceGetEnrollmentByID(deviceID)
+	if err != nil {
+		return err
+	}
+
+	return id.DB.DeviceUpdate(device.ID, device.Status, deviceData)
+}
+
 // DeviceUpdate updates an existing device with the service
 // Status changes are limited, depending on whether the device has enrolled with the service. If it has, then it
 // already has credentials.
@@ -121,8 +247,9 @@ func (id IdentityService) RegisterDevice(req *RegisterDeviceRequest) (string, er
 // - Waiting => Disabled
 // - Disabled => Waiting
 // If a device has enrolled:
-// - Enrolled => Disabled (TODO: needs to trigger the removal of credentials from MQTT broker or device or both)
+// - Enrolled => Disabled
 // - Enrolled => Waiting
+// Disabling a device revokes its certificate, re-enabling it issues new credentials.
 func (id IdentityService) DeviceUpdate(orgID, deviceID string, req *DeviceUpdateRequest) error {
 	// Get the device and check the current status
 	device, err := id.DB.DeviceGetEnrollmentByID(deviceID)
@@ -149,14 +276,28 @@ func (id IdentityService) DeviceUpdate(orgID, deviceID string, req *DeviceUpdate
 		device.Status = models.StatusWaiting
 	case models.StatusEnrolled:
 		if req.Status == int(models.StatusDisabled) {
-			//nolint:godox
-			// TODO: trigger the removal of credentials from MQTT broker or device or both
-			// -- from original code before linting
 			device.Status = models.StatusDisabled
 		} else {
 			device.Status = models.StatusWaiting
 		}
 	}
 
+	if device.Status == models.StatusDisabled {
+		// The credentials may have been downloaded even if the device never enrolled
+		if err := id.revokeCredentials(device, cert.ReasonPrivilegeWithdrawn); err != nil {
+			return err
+		}
+	} else {
+		revoked, err := id.credentialsRevoked(device)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			if err := id.reissueCredentials(device); err != nil {
+				return err
+			}
+		}
+	}
+
 	return id.DB.DeviceUpdate(deviceID, device.Status, req.DeviceData)
 }
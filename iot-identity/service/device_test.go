@@ -23,6 +23,7 @@ import (
 	"testing"
 
 	"github.com/everactive/dmscore/iot-identity/config/configkey"
+	"github.com/everactive/dmscore/iot-identity/models"
 	"github.com/spf13/viper"
 
 	"github.com/everactive/dmscore/iot-identity/datastore/memory"
@@ -119,3 +120,31 @@ func TestIdentityService_DeviceUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestIdentityService_DeviceDataUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		deviceID string
+		wantErr  bool
+	}{
+		{"valid", "b222", false},
+		{"invalid-device", "invalid", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewStore()
+			id := NewIdentityService(db)
+			if err := id.DeviceDataUpdate(tt.deviceID, "ZGF0YQ=="); (err != nil) != tt.wantErr {
+				t.Errorf("IdentityService.DeviceDataUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got, _ := db.DeviceGetEnrollmentByID(tt.deviceID)
+			if got.DeviceData != "ZGF0YQ==" || got.Status != models.StatusEnrolled {
+				t.Errorf("IdentityService.DeviceDataUpdate() = %v, %v", got.DeviceData, got.Status)
+			}
+		})
+	}
+}
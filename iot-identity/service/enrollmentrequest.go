@@ -0,0 +1,203 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/datastore"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/spf13/viper"
+)
+
+// approvalRequiredError is returned by enroll when the device can only enroll once an admin approves it: it is not
+// registered and cannot be auto-registered, or it is already enrolled with a different device key
+type approvalRequiredError struct {
+	reason string
+}
+
+func (e *approvalRequiredError) Error() string {
+	return e.reason
+}
+
+// EnrollmentRequestList fetches the enrollment attempts of unregistered devices with a status, or all of them
+func (id IdentityService) EnrollmentRequestList(status string) ([]domain.EnrollmentRequest, error) {
+	switch status {
+	case "", domain.EnrollmentRequestPending, domain.EnrollmentRequestApproved, domain.EnrollmentRequestRejected:
+		return id.DB.EnrollmentRequestList(status)
+	default:
+		return nil, fmt.Errorf("invalid enrollment request status `%s`", status)
+	}
+}
+
+// EnrollmentRequestApprove registers the device of an enrollment request in an organization, so the device's
+// next enrollment attempt succeeds. The approval is for the device key of the request, which the approver confirms
+// as a later attempt may have replaced it: the device may only enroll, or re-enroll when it is already registered,
+// with that key.
+func (id IdentityService) EnrollmentRequestApprove(requestID uint, req *ApproveEnrollmentRequest) (string, error) {
+	request, err := id.DB.EnrollmentRequestGet(requestID)
+	if err != nil {
+		return "", err
+	}
+	if request.Status == domain.EnrollmentRequestApproved {
+		return "", fmt.Errorf("enrollment request %d is already approved", requestID)
+	}
+	if len(req.DeviceKey) == 0 {
+		return "", fmt.Errorf("the device key of enrollment request %d must be given to approve it", requestID)
+	}
+	if req.DeviceKey != request.DeviceKey {
+		return "", fmt.Errorf("the device key of enrollment request %d has changed, check the request again", requestID)
+	}
+
+	device, err := id.DB.DeviceGet(request.Brand, request.Model, request.SerialNumber)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("getting device: %w", err)
+	}
+
+	var deviceID, orgID string
+	if device != nil {
+		deviceID, orgID = device.ID, device.Organization.ID
+	} else {
+		deviceID, err = id.RegisterDevice(&RegisterDeviceRequest{
+			OrganizationID: req.OrganizationID,
+			Brand:          request.Brand,
+			Model:          request.Model,
+			SerialNumber:   request.SerialNumber,
+			DeviceData:     req.DeviceData,
+		})
+		if err != nil {
+			return "", err
+		}
+		orgID = req.OrganizationID
+	}
+
+	now := time.Now()
+	request.Status = domain.EnrollmentRequestApproved
+	request.OrganizationID = orgID
+	request.DeviceID = deviceID
+	request.DecidedBy = req.Username
+	request.DecidedAt = &now
+	if err := id.DB.EnrollmentRequestUpdate(*request); err != nil {
+		return "", fmt.Errorf("device %s is registered, but the enrollment request could not be updated: %w", deviceID, err)
+	}
+	return deviceID, nil
+}
+
+// EnrollmentRequestReject rejects an enrollment request. Later attempts of the device are still counted, but the
+// request stays rejected.
+func (id IdentityService) EnrollmentRequestReject(requestID uint, username string) error {
+	request, err := id.DB.EnrollmentRequestGet(requestID)
+	if err != nil {
+		return err
+	}
+	if request.Status != domain.EnrollmentRequestPending {
+		return fmt.Errorf("enrollment request %d is %s, only pending requests can be rejected", requestID, request.Status)
+	}
+
+	now := time.Now()
+	request.Status = domain.EnrollmentRequestRejected
+	request.DecidedBy = username
+	request.DecidedAt = &now
+	return id.DB.EnrollmentRequestUpdate(*request)
+}
+
+// checkApprovedEnrollment checks that a registered device whose enrollment request was approved enrolls with the
+// device key that was approved
+func (id IdentityService) checkApprovedEnrollment(device *domain.Enrollment, enroll *datastore.DeviceEnrollRequest) error {
+	request, err := id.DB.EnrollmentRequestGetByDevice(enroll.Brand, enroll.Model, enroll.SerialNumber)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting enrollment request: %w", err)
+	}
+	if request.Status != domain.EnrollmentRequestApproved || request.EnrolledAt != nil || request.DeviceID != device.ID ||
+		request.DeviceKey == enroll.DeviceKey {
+		return nil
+	}
+	return &approvalRequiredError{reason: fmt.Sprintf("`%s/%s/%s` is approved for a different device key", enroll.Brand, enroll.Model, enroll.SerialNumber)}
+}
+
+// queueEnrollmentRequest records the enrollment attempt of a device that is not registered. Any client can reach
+// the enroll endpoint, so only attempts with assertions signed by a trusted account key are recorded, and new
+// devices are not recorded once there are too many pending requests.
+func (id IdentityService) queueEnrollmentRequest(req *EnrollDeviceRequest, enroll *datastore.DeviceEnrollRequest, reason string) error {
+	if !id.checkKey(req.Model) || !id.checkKey(req.Serial) {
+		return fmt.Errorf("the assertions of `%s/%s/%s` are not signed by a trusted account key", enroll.Brand, enroll.Model, enroll.SerialNumber)
+	}
+
+	now := time.Now()
+
+	request, err := id.DB.EnrollmentRequestGetByDevice(enroll.Brand, enroll.Model, enroll.SerialNumber)
+	if errors.Is(err, sql.ErrNoRows) {
+		pending, err := id.DB.EnrollmentRequestCount(domain.EnrollmentRequestPending)
+		if err != nil {
+			return err
+		}
+		if limit := viper.GetInt(keys.EnrollmentRequestsMaxPending); limit > 0 && pending >= limit {
+			return fmt.Errorf("there are %d pending enrollment requests, `%s/%s/%s` is not recorded", pending, enroll.Brand, enroll.Model, enroll.SerialNumber)
+		}
+
+		_, err = id.DB.EnrollmentRequestCreate(domain.EnrollmentRequest{
+			Brand:          enroll.Brand,
+			Model:          enroll.Model,
+			SerialNumber:   enroll.SerialNumber,
+			StoreID:        enroll.StoreID,
+			DeviceKey:      enroll.DeviceKey,
+			ModelHeaders:   req.Model.Headers(),
+			SerialHeaders:  req.Serial.Headers(),
+			SourceIP:       req.SourceIP,
+			Reason:         reason,
+			Status:         domain.EnrollmentRequestPending,
+			Attempts:       1,
+			FirstAttemptAt: now,
+			LastAttemptAt:  now,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	request.StoreID = enroll.StoreID
+	request.DeviceKey = enroll.DeviceKey
+	request.ModelHeaders = req.Model.Headers()
+	request.SerialHeaders = req.Serial.Headers()
+	request.SourceIP = req.SourceIP
+	request.Reason = reason
+	request.Attempts++
+	request.LastAttemptAt = now
+
+	// An approval is used up by the enrollment it allowed. A device that fails again, e.g. it was deleted or is
+	// re-enrolling with a new device key, needs a new decision.
+	if request.Status == domain.EnrollmentRequestApproved {
+		request.Status = domain.EnrollmentRequestPending
+		request.OrganizationID = ""
+		request.DeviceID = ""
+		request.DecidedBy = ""
+		request.DecidedAt = nil
+		request.EnrolledAt = nil
+	}
+	return id.DB.EnrollmentRequestUpdate(*request)
+}
@@ -0,0 +1,187 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEnrollDeviceRequest(t *testing.T) *EnrollDeviceRequest {
+	m, err := asserts.Decode([]byte(model1))
+	assert.NoError(t, err)
+	s, err := asserts.Decode([]byte(serial1))
+	assert.NoError(t, err)
+	return &EnrollDeviceRequest{Model: m, Serial: s, SourceIP: "192.0.2.10"}
+}
+
+func TestIdentityService_EnrollDeviceQueuesRequest(t *testing.T) {
+	id, db := newTestAutoRegistrationService(t)
+	viper.Set(keys.AutoRegistrationEnabled, false)
+	// The test device is not registered
+	db.Roll = db.Roll[:2]
+
+	req := newTestEnrollDeviceRequest(t)
+	for i := 0; i < 2; i++ {
+		_, err := id.EnrollDevice(req)
+		assert.EqualError(t, err, "`canonical/ubuntu-core-18-amd64/d75f7300-abbf-4c11-bf0a-8b7103038490` is not registered")
+	}
+
+	requests, err := id.EnrollmentRequestList(domain.EnrollmentRequestPending)
+	assert.NoError(t, err)
+	if assert.Len(t, requests, 1) {
+		r := requests[0]
+		assert.Equal(t, "canonical", r.Brand)
+		assert.Equal(t, "ubuntu-core-18-amd64", r.Model)
+		assert.Equal(t, "d75f7300-abbf-4c11-bf0a-8b7103038490", r.SerialNumber)
+		assert.Equal(t, "192.0.2.10", r.SourceIP)
+		assert.Equal(t, 2, r.Attempts)
+		assert.Equal(t, "ubuntu-core-18-amd64", r.ModelHeaders["model"])
+		assert.Equal(t, "d75f7300-abbf-4c11-bf0a-8b7103038490", r.SerialHeaders["serial"])
+		assert.NotEmpty(t, r.DeviceKey)
+	}
+
+	// The approval is for the device key the approver checked
+	_, err = id.EnrollmentRequestApprove(requests[0].ID, &ApproveEnrollmentRequest{OrganizationID: "def", Username: "jamesj"})
+	assert.EqualError(t, err, "the device key of enrollment request 1 must be given to approve it")
+	_, err = id.EnrollmentRequestApprove(requests[0].ID, &ApproveEnrollmentRequest{OrganizationID: "def", DeviceKey: "OTHER", Username: "jamesj"})
+	assert.EqualError(t, err, "the device key of enrollment request 1 has changed, check the request again")
+
+	deviceID, err := id.EnrollmentRequestApprove(requests[0].ID, &ApproveEnrollmentRequest{OrganizationID: "def", DeviceKey: requests[0].DeviceKey, Username: "jamesj"})
+	assert.NoError(t, err)
+
+	approved, err := db.EnrollmentRequestGet(requests[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.EnrollmentRequestApproved, approved.Status)
+	assert.Equal(t, deviceID, approved.DeviceID)
+	assert.Equal(t, "def", approved.OrganizationID)
+	assert.Equal(t, "jamesj", approved.DecidedBy)
+	assert.NotNil(t, approved.DecidedAt)
+
+	// The next attempt of the device enrolls it
+	en, err := id.EnrollDevice(req)
+	assert.NoError(t, err)
+	if assert.NotNil(t, en) {
+		assert.Equal(t, deviceID, en.ID)
+		assert.Equal(t, "def", en.Organization.ID)
+	}
+
+	_, err = id.EnrollmentRequestApprove(requests[0].ID, &ApproveEnrollmentRequest{OrganizationID: "def", DeviceKey: requests[0].DeviceKey})
+	assert.EqualError(t, err, "enrollment request 1 is already approved")
+}
+
+func TestIdentityService_EnrollDeviceApprovedKey(t *testing.T) {
+	id, db := newTestAutoRegistrationService(t)
+	viper.Set(keys.AutoRegistrationEnabled, false)
+	db.Roll = db.Roll[:2]
+
+	req := newTestEnrollDeviceRequest(t)
+	_, err := id.EnrollDevice(req)
+	assert.Error(t, err)
+
+	requests, err := id.EnrollmentRequestList(domain.EnrollmentRequestPending)
+	assert.NoError(t, err)
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	_, err = id.EnrollmentRequestApprove(requests[0].ID, &ApproveEnrollmentRequest{OrganizationID: "def", DeviceKey: requests[0].DeviceKey, Username: "jamesj"})
+	assert.NoError(t, err)
+
+	// A device with the same serial number, but another key than the approved one, cannot use the approval
+	approved := db.EnrollmentRequests[0]
+	db.EnrollmentRequests[0].DeviceKey = "OTHER"
+	_, err = id.EnrollDevice(req)
+	assert.EqualError(t, err, "`canonical/ubuntu-core-18-amd64/d75f7300-abbf-4c11-bf0a-8b7103038490` is approved for a different device key")
+
+	// The attempt needs a new decision
+	request, err := db.EnrollmentRequestGet(approved.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.EnrollmentRequestPending, request.Status)
+	assert.Equal(t, approved.DeviceKey, request.DeviceKey)
+}
+
+func TestIdentityService_EnrollDeviceQueueLimits(t *testing.T) {
+	id, db := newTestAutoRegistrationService(t)
+	viper.Set(keys.AutoRegistrationEnabled, false)
+	t.Cleanup(func() { viper.Set(keys.EnrollmentRequestsMaxPending, 1000) })
+	db.Roll = db.Roll[:2]
+	req := newTestEnrollDeviceRequest(t)
+
+	// Assertions that aren't signed by a trusted account key are not recorded
+	checkSignature = func(assert asserts.Assertion, pubKey asserts.PublicKey) error {
+		return errors.New("MOCK signature error")
+	}
+	_, err := id.EnrollDevice(req)
+	assert.Error(t, err)
+	assert.Empty(t, db.EnrollmentRequests)
+
+	checkSignature = func(assert asserts.Assertion, pubKey asserts.PublicKey) error {
+		return nil
+	}
+
+	// New devices are not recorded once there are too many pending requests, known devices are still counted
+	viper.Set(keys.EnrollmentRequestsMaxPending, 1)
+	db.EnrollmentRequests = []domain.EnrollmentRequest{{ID: 1, Brand: "example", Model: "drone-1000", SerialNumber: "DR1000C333", Status: domain.EnrollmentRequestPending, Attempts: 1}}
+	_, err = id.EnrollDevice(req)
+	assert.Error(t, err)
+	assert.Len(t, db.EnrollmentRequests, 1)
+
+	db.EnrollmentRequests[0].Status = domain.EnrollmentRequestRejected
+	_, err = id.EnrollDevice(req)
+	assert.Error(t, err)
+	assert.Len(t, db.EnrollmentRequests, 2)
+}
+
+func TestIdentityService_EnrollmentRequestReject(t *testing.T) {
+	id, db := newTestAutoRegistrationService(t)
+	viper.Set(keys.AutoRegistrationEnabled, false)
+	db.Roll = db.Roll[:2]
+
+	req := newTestEnrollDeviceRequest(t)
+	_, err := id.EnrollDevice(req)
+	assert.Error(t, err)
+
+	assert.NoError(t, id.EnrollmentRequestReject(1, "jamesj"))
+	assert.EqualError(t, id.EnrollmentRequestReject(1, "jamesj"), "enrollment request 1 is rejected, only pending requests can be rejected")
+	assert.Error(t, id.EnrollmentRequestReject(2, "jamesj"))
+
+	// Later attempts are counted, but the request stays rejected
+	_, err = id.EnrollDevice(req)
+	assert.Error(t, err)
+
+	rejected, err := id.EnrollmentRequestList(domain.EnrollmentRequestRejected)
+	assert.NoError(t, err)
+	if assert.Len(t, rejected, 1) {
+		assert.Equal(t, 2, rejected[0].Attempts)
+		assert.Equal(t, "jamesj", rejected[0].DecidedBy)
+	}
+
+	_, err = id.EnrollmentRequestList("invalid")
+	assert.Error(t, err)
+
+	_, err = id.EnrollmentRequestApprove(1, &ApproveEnrollmentRequest{OrganizationID: "invalid"})
+	assert.Error(t, err)
+}
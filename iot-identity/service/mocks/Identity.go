@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	time "time"
+
 	domain "github.com/everactive/dmscore/iot-identity/domain"
 	mock "github.com/stretchr/testify/mock"
 
@@ -14,6 +16,228 @@ type Identity struct {
 	mock.Mock
 }
 
+// AccountKeyAdd provides a mock function with given fields: assertions
+func (_m *Identity) AccountKeyAdd(assertions []byte) ([]domain.AccountKey, error) {
+	ret := _m.Called(assertions)
+
+	var r0 []domain.AccountKey
+	if rf, ok := ret.Get(0).(func([]byte) []domain.AccountKey); ok {
+		r0 = rf(assertions)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.AccountKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]byte) error); ok {
+		r1 = rf(assertions)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AccountKeyDelete provides a mock function with given fields: signKeyID
+func (_m *Identity) AccountKeyDelete(signKeyID string) error {
+	ret := _m.Called(signKeyID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(signKeyID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AccountKeyList provides a mock function with given fields:
+func (_m *Identity) AccountKeyList() ([]domain.AccountKey, error) {
+	ret := _m.Called()
+
+	var r0 []domain.AccountKey
+	if rf, ok := ret.Get(0).(func() []domain.AccountKey); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.AccountKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AutoRegistrationEvaluate provides a mock function with given fields: assertions
+func (_m *Identity) AutoRegistrationEvaluate(assertions []byte) (*domain.AutoRegistrationEvaluation, error) {
+	ret := _m.Called(assertions)
+
+	var r0 *domain.AutoRegistrationEvaluation
+	if rf, ok := ret.Get(0).(func([]byte) *domain.AutoRegistrationEvaluation); ok {
+		r0 = rf(assertions)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.AutoRegistrationEvaluation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]byte) error); ok {
+		r1 = rf(assertions)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AutoRegistrationGroups provides a mock function with given fields: deviceID
+func (_m *Identity) AutoRegistrationGroups(deviceID string) (string, []string, error) {
+	ret := _m.Called(deviceID)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(deviceID)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 []string
+	if rf, ok := ret.Get(1).(func(string) []string); ok {
+		r1 = rf(deviceID)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]string)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(string) error); ok {
+		r2 = rf(deviceID)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// AutoRegistrationGroupsApplied provides a mock function with given fields: deviceID
+func (_m *Identity) AutoRegistrationGroupsApplied(deviceID string) error {
+	ret := _m.Called(deviceID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(deviceID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AutoRegistrationRuleCreate provides a mock function with given fields: rule
+func (_m *Identity) AutoRegistrationRuleCreate(rule domain.AutoRegistrationRule) (uint, error) {
+	ret := _m.Called(rule)
+
+	var r0 uint
+	if rf, ok := ret.Get(0).(func(domain.AutoRegistrationRule) uint); ok {
+		r0 = rf(rule)
+	} else {
+		r0 = ret.Get(0).(uint)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(domain.AutoRegistrationRule) error); ok {
+		r1 = rf(rule)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AutoRegistrationRuleDelete provides a mock function with given fields: ruleID
+func (_m *Identity) AutoRegistrationRuleDelete(ruleID uint) error {
+	ret := _m.Called(ruleID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(uint) error); ok {
+		r0 = rf(ruleID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AutoRegistrationRuleList provides a mock function with given fields:
+func (_m *Identity) AutoRegistrationRuleList() ([]domain.AutoRegistrationRule, error) {
+	ret := _m.Called()
+
+	var r0 []domain.AutoRegistrationRule
+	if rf, ok := ret.Get(0).(func() []domain.AutoRegistrationRule); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.AutoRegistrationRule)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AutoRegistrationRuleUpdate provides a mock function with given fields: rule
+func (_m *Identity) AutoRegistrationRuleUpdate(rule domain.AutoRegistrationRule) error {
+	ret := _m.Called(rule)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(domain.AutoRegistrationRule) error); ok {
+		r0 = rf(rule)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CRL provides a mock function with given fields: orgID
+func (_m *Identity) CRL(orgID string) ([]byte, error) {
+	ret := _m.Called(orgID)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(string) []byte); ok {
+		r0 = rf(orgID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(orgID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteDevice provides a mock function with given fields: deviceID
 func (_m *Identity) DeleteDevice(deviceID string) (string, error) {
 	ret := _m.Called(deviceID)
@@ -35,6 +259,43 @@ func (_m *Identity) DeleteDevice(deviceID string) (string, error) {
 	return r0, r1
 }
 
+// DeviceCertificatesExpiring provides a mock function with given fields: orgID, within
+func (_m *Identity) DeviceCertificatesExpiring(orgID string, within time.Duration) ([]domain.Enrollment, error) {
+	ret := _m.Called(orgID, within)
+
+	var r0 []domain.Enrollment
+	if rf, ok := ret.Get(0).(func(string, time.Duration) []domain.Enrollment); ok {
+		r0 = rf(orgID, within)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.Enrollment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, time.Duration) error); ok {
+		r1 = rf(orgID, within)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeviceDataUpdate provides a mock function with given fields: deviceID, deviceData
+func (_m *Identity) DeviceDataUpdate(deviceID string, deviceData string) error {
+	ret := _m.Called(deviceID, deviceData)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(deviceID, deviceData)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DeviceGet provides a mock function with given fields: orgID, deviceID
 func (_m *Identity) DeviceGet(orgID string, deviceID string) (*domain.Enrollment, error) {
 	ret := _m.Called(orgID, deviceID)
@@ -81,6 +342,29 @@ func (_m *Identity) DeviceList(orgID string) ([]domain.Enrollment, error) {
 	return r0, r1
 }
 
+// DeviceListDeleted provides a mock function with given fields: orgID
+func (_m *Identity) DeviceListDeleted(orgID string) ([]domain.Enrollment, error) {
+	ret := _m.Called(orgID)
+
+	var r0 []domain.Enrollment
+	if rf, ok := ret.Get(0).(func(string) []domain.Enrollment); ok {
+		r0 = rf(orgID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.Enrollment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(orgID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeviceUpdate provides a mock function with given fields: orgID, deviceID, req
 func (_m *Identity) DeviceUpdate(orgID string, deviceID string, req *service.DeviceUpdateRequest) error {
 	ret := _m.Called(orgID, deviceID, req)
@@ -118,6 +402,131 @@ func (_m *Identity) EnrollDevice(req *service.EnrollDeviceRequest) (*domain.Enro
 	return r0, r1
 }
 
+// NonceNew provides a mock function with given fields:
+func (_m *Identity) NonceNew() (string, error) {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// EnrollmentRequestApprove provides a mock function with given fields: requestID, req
+func (_m *Identity) EnrollmentRequestApprove(requestID uint, req *service.ApproveEnrollmentRequest) (string, error) {
+	ret := _m.Called(requestID, req)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(uint, *service.ApproveEnrollmentRequest) string); ok {
+		r0 = rf(requestID, req)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(uint, *service.ApproveEnrollmentRequest) error); ok {
+		r1 = rf(requestID, req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// EnrollmentRequestList provides a mock function with given fields: status
+func (_m *Identity) EnrollmentRequestList(status string) ([]domain.EnrollmentRequest, error) {
+	ret := _m.Called(status)
+
+	var r0 []domain.EnrollmentRequest
+	if rf, ok := ret.Get(0).(func(string) []domain.EnrollmentRequest); ok {
+		r0 = rf(status)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.EnrollmentRequest)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(status)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// EnrollmentRequestReject provides a mock function with given fields: requestID, username
+func (_m *Identity) EnrollmentRequestReject(requestID uint, username string) error {
+	ret := _m.Called(requestID, username)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(uint, string) error); ok {
+		r0 = rf(requestID, username)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// OCSP provides a mock function with given fields: request
+func (_m *Identity) OCSP(request []byte) ([]byte, error) {
+	ret := _m.Called(request)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func([]byte) []byte); ok {
+		r0 = rf(request)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func([]byte) error); ok {
+		r1 = rf(request)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// OrganizationCABundle provides a mock function with given fields: orgID
+func (_m *Identity) OrganizationCABundle(orgID string) ([]byte, error) {
+	ret := _m.Called(orgID)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(string) []byte); ok {
+		r0 = rf(orgID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(orgID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // OrganizationList provides a mock function with given fields:
 func (_m *Identity) OrganizationList() ([]domain.Organization, error) {
 	ret := _m.Called()
@@ -141,6 +550,43 @@ func (_m *Identity) OrganizationList() ([]domain.Organization, error) {
 	return r0, r1
 }
 
+// PurgeDevices provides a mock function with given fields: deletedBefore, dryRun
+func (_m *Identity) PurgeDevices(deletedBefore time.Time, dryRun bool) ([]string, error) {
+	ret := _m.Called(deletedBefore, dryRun)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(time.Time, bool) []string); ok {
+		r0 = rf(deletedBefore, dryRun)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(time.Time, bool) error); ok {
+		r1 = rf(deletedBefore, dryRun)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RefreshAccountKeys provides a mock function with given fields:
+func (_m *Identity) RefreshAccountKeys() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // RegisterDevice provides a mock function with given fields: req
 func (_m *Identity) RegisterDevice(req *service.RegisterDeviceRequest) (string, error) {
 	ret := _m.Called(req)
@@ -162,6 +608,29 @@ func (_m *Identity) RegisterDevice(req *service.RegisterDeviceRequest) (string,
 	return r0, r1
 }
 
+// RegisterDevices provides a mock function with given fields: req
+func (_m *Identity) RegisterDevices(req *service.RegisterDevicesRequest) ([]domain.DeviceRegistrationResult, error) {
+	ret := _m.Called(req)
+
+	var r0 []domain.DeviceRegistrationResult
+	if rf, ok := ret.Get(0).(func(*service.RegisterDevicesRequest) []domain.DeviceRegistrationResult); ok {
+		r0 = rf(req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]domain.DeviceRegistrationResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*service.RegisterDevicesRequest) error); ok {
+		r1 = rf(req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // RegisterOrganization provides a mock function with given fields: req
 func (_m *Identity) RegisterOrganization(req *service.RegisterOrganizationRequest) (string, error) {
 	ret := _m.Called(req)
@@ -183,6 +652,103 @@ func (_m *Identity) RegisterOrganization(req *service.RegisterOrganizationReques
 	return r0, r1
 }
 
+// RenewDevice provides a mock function with given fields: req
+func (_m *Identity) RenewDevice(req *service.RenewDeviceRequest) (*domain.Enrollment, error) {
+	ret := _m.Called(req)
+
+	var r0 *domain.Enrollment
+	if rf, ok := ret.Get(0).(func(*service.RenewDeviceRequest) *domain.Enrollment); ok {
+		r0 = rf(req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Enrollment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*service.RenewDeviceRequest) error); ok {
+		r1 = rf(req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreDevice provides a mock function with given fields: deviceID
+func (_m *Identity) RestoreDevice(deviceID string) (*domain.Enrollment, error) {
+	ret := _m.Called(deviceID)
+
+	var r0 *domain.Enrollment
+	if rf, ok := ret.Get(0).(func(string) *domain.Enrollment); ok {
+		r0 = rf(deviceID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Enrollment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(deviceID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeDevice provides a mock function with given fields: deviceID, reason
+func (_m *Identity) RevokeDevice(deviceID string, reason int) error {
+	ret := _m.Called(deviceID, reason)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, int) error); ok {
+		r0 = rf(deviceID, reason)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RotateOrganizationCA provides a mock function with given fields: orgID, req
+func (_m *Identity) RotateOrganizationCA(orgID string, req *service.RotateOrganizationCARequest) error {
+	ret := _m.Called(orgID, req)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, *service.RotateOrganizationCARequest) error); ok {
+		r0 = rf(orgID, req)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// TransferDevice provides a mock function with given fields: deviceID, orgID
+func (_m *Identity) TransferDevice(deviceID string, orgID string) (*domain.Enrollment, error) {
+	ret := _m.Called(deviceID, orgID)
+
+	var r0 *domain.Enrollment
+	if rf, ok := ret.Get(0).(func(string, string) *domain.Enrollment); ok {
+		r0 = rf(deviceID, orgID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*domain.Enrollment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(deviceID, orgID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 type mockConstructorTestingTNewIdentity interface {
 	mock.TestingT
 	Cleanup(func())
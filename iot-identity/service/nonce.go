@@ -0,0 +1,49 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/spf13/viper"
+)
+
+// nonceSize is the number of random bytes of a nonce
+const nonceSize = 32
+
+// NonceNew issues a nonce for a device to sign in a request, such as a device-session-request. Each nonce can
+// only be used once, before it expires.
+func (id IdentityService) NonceNew() (string, error) {
+	b := make([]byte, nonceSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := id.DB.NonceCreate(nonce, time.Now().Add(viper.GetDuration(keys.NonceValidity))); err != nil {
+		return "", err
+	}
+
+	return nonce, nil
+}
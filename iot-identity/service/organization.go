@@ -21,12 +21,9 @@ package service
 
 import (
 	"fmt"
-	"github.com/everactive/dmscore/config/keys"
 
 	"github.com/everactive/dmscore/iot-identity/datastore"
 	"github.com/everactive/dmscore/iot-identity/domain"
-	"github.com/everactive/dmscore/iot-identity/service/cert"
-	"github.com/spf13/viper"
 )
 
 // RegisterOrganization registers a new organization with the service
@@ -41,10 +38,8 @@ func (id IdentityService) RegisterOrganization(req *RegisterOrganizationRequest)
 		return "", fmt.Errorf("the organization '%s' has already been registered", req.Name)
 	}
 
-	rootCertsDir := viper.GetString(keys.GetIdentityKey(keys.CertificatesPath))
-
-	// Create server certificate for the organization
-	serverPEM, serverCA, err := cert.CreateOrganizationCert(rootCertsDir, req.Name)
+	// Create or import the CA of the organization
+	serverPEM, serverCA, err := organizationCA(req.Name, req.RootCert, req.RootKey)
 	if err != nil {
 		return "", err
 	}
@@ -58,7 +53,13 @@ func (id IdentityService) RegisterOrganization(req *RegisterOrganizationRequest)
 	}
 
 	// Register the organization
-	return id.DB.OrganizationNew(o)
+	orgID, err := id.DB.OrganizationNew(o)
+	if err != nil {
+		return "", err
+	}
+
+	id.ocspResponders.invalidate()
+	return orgID, nil
 }
 
 // OrganizationList fetches the existing organizations
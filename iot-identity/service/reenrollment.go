@@ -0,0 +1,111 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"crypto/rsa"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/datastore"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	log "github.com/sirupsen/logrus"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/spf13/viper"
+)
+
+// checkReEnrollment checks whether an enrolled device may enroll again, e.g. after a factory reset lost its
+// credentials. The serial assertion is public, so its assertions must be signed by a trusted account key and the
+// device must show it holds the device key of its serial assertion. It may then re-enroll when an admin approved its
+// enrollment request for that device key or, unless approval is required, when it is the key it enrolled with.
+func (id IdentityService) checkReEnrollment(device *domain.Enrollment, enroll *datastore.DeviceEnrollRequest, req *EnrollDeviceRequest) error {
+	if !id.checkKey(req.Model) || !id.checkKey(req.Serial) {
+		return fmt.Errorf("`%s/%s/%s` is already enrolled and its assertions are not signed by a trusted account key", enroll.Brand, enroll.Model, enroll.SerialNumber)
+	}
+	if err := id.checkDeviceKeyPossession(req); err != nil {
+		return fmt.Errorf("`%s/%s/%s` is already enrolled: %w", enroll.Brand, enroll.Model, enroll.SerialNumber, err)
+	}
+
+	sameKey := len(device.Device.DeviceKey) > 0 && device.Device.DeviceKey == enroll.DeviceKey
+	if sameKey && !viper.GetBool(keys.ReEnrollmentApprovalRequired) {
+		return nil
+	}
+
+	request, err := id.DB.EnrollmentRequestGetByDevice(enroll.Brand, enroll.Model, enroll.SerialNumber)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("getting enrollment request: %w", err)
+	}
+	if err == nil && request.Status == domain.EnrollmentRequestApproved && request.EnrolledAt == nil &&
+		request.DeviceID == device.ID && request.DeviceKey == enroll.DeviceKey {
+		return nil
+	}
+
+	reason := "with a different device key"
+	if sameKey {
+		reason = "and re-enrollment needs approval"
+	}
+	return &approvalRequiredError{reason: fmt.Sprintf("`%s/%s/%s` is already enrolled %s", enroll.Brand, enroll.Model, enroll.SerialNumber, reason)}
+}
+
+// checkDeviceKeyPossession checks that an enrolling device holds the private part of the device key in its serial
+// assertion: it signs a device-session-request for a nonce issued by NonceNew, or sends a CSR for the device key
+func (id IdentityService) checkDeviceKeyPossession(req *EnrollDeviceRequest) error {
+	serial, ok := req.Serial.(*asserts.Serial)
+	if !ok {
+		return fmt.Errorf("the serial assertion is an unexpected type")
+	}
+
+	// The signature of the CSR was checked before enrolling
+	if req.CSR != nil {
+		if csrKey, ok := req.CSR.PublicKey.(*rsa.PublicKey); ok && asserts.RSAPublicKey(csrKey).ID() == serial.DeviceKey().ID() {
+			return nil
+		}
+	}
+
+	if req.SessionRequest == nil {
+		return fmt.Errorf("a device-session-request signed with the device key, or a CSR for the device key, is required")
+	}
+	sessionRequest, ok := req.SessionRequest.(*asserts.DeviceSessionRequest)
+	if !ok {
+		return fmt.Errorf("the device-session-request is an unexpected type")
+	}
+	if sessionRequest.BrandID() != serial.BrandID() || sessionRequest.Model() != serial.Model() || sessionRequest.Serial() != serial.Serial() {
+		return fmt.Errorf("the device-session-request is for another device")
+	}
+	return id.checkSessionRequest(sessionRequest, serial.DeviceKey())
+}
+
+// useEnrollmentApproval marks the approved enrollment request of a device that enrolled as used, so a later
+// re-enrollment needs a new approval
+func (id IdentityService) useEnrollmentApproval(en *domain.Enrollment) {
+	request, err := id.DB.EnrollmentRequestGetByDevice(en.Device.Brand, en.Device.Model, en.Device.SerialNumber)
+	if err != nil || request.Status != domain.EnrollmentRequestApproved || request.EnrolledAt != nil {
+		return
+	}
+
+	now := time.Now()
+	request.EnrolledAt = &now
+	if err := id.DB.EnrollmentRequestUpdate(*request); err != nil {
+		log.Errorf("Error marking the enrollment request of device %s as used: %v", en.ID, err)
+	}
+}
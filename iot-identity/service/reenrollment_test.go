@@ -0,0 +1,158 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// reEnrollRequest builds the enroll request of the test device, with model and serial assertions signed by the brand
+// for a device key, and a device-session-request signed with the key when there is a nonce
+func reEnrollRequest(t *testing.T, brand *assertstest.SigningDB, deviceKey asserts.PrivateKey, nonce string) *EnrollDeviceRequest {
+	model, err := brand.Sign(asserts.ModelType, map[string]interface{}{
+		"series":       "16",
+		"brand-id":     "example",
+		"model":        "drone-2000",
+		"architecture": "amd64",
+		"gadget":       "pc",
+		"kernel":       "pc-kernel",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	assert.NoError(t, err)
+
+	encodedKey, err := asserts.EncodePublicKey(deviceKey.PublicKey())
+	assert.NoError(t, err)
+	serial, err := brand.Sign(asserts.SerialType, map[string]interface{}{
+		"brand-id":            "example",
+		"model":               "drone-2000",
+		"serial":              "DR2000A111",
+		"device-key":          string(encodedKey),
+		"device-key-sha3-384": deviceKey.PublicKey().ID(),
+		"timestamp":           time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	assert.NoError(t, err)
+
+	req := &EnrollDeviceRequest{Model: model, Serial: serial}
+	if len(nonce) > 0 {
+		req.SessionRequest = sessionRequest(t, deviceKey, "DR2000A111", nonce, time.Now())
+	}
+	return req
+}
+
+func TestIdentityService_EnrollDeviceReEnrollment(t *testing.T) {
+	id, db := newTestAutoRegistrationService(t)
+	viper.Set(keys.AutoRegistrationEnabled, false)
+	viper.Set(keys.RenewalMaxClockSkew, "5m")
+	viper.Set(keys.ReEnrollmentApprovalRequired, false)
+	t.Cleanup(func() { viper.Set(keys.ReEnrollmentApprovalRequired, true) })
+
+	brandKey, _ := assertstest.GenerateKey(752)
+	brand := assertstest.NewSigningDB("example", brandKey)
+	checkSignature = signatureCheck
+	isKeyAllowed = func(signKeyID string, allowedKeys map[string]asserts.PublicKey) (asserts.PublicKey, bool) {
+		return brandKey.PublicKey(), signKeyID == brandKey.PublicKey().ID()
+	}
+	deviceRSAKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	deviceKey := asserts.RSAPrivateKey(deviceRSAKey)
+	newKey, _ := assertstest.GenerateKey(752)
+	for _, nonce := range []string{"n1", "n2", "n3", "n4", "n5"} {
+		assert.NoError(t, db.NonceCreate(nonce, time.Now().Add(time.Minute)))
+	}
+
+	deviceID := registerTestDevice(t, id)
+	first, err := id.EnrollDevice(reEnrollRequest(t, brand, deviceKey, ""))
+	assert.NoError(t, err)
+
+	// The serial assertion is public, a factory reset device shows it holds the device key
+	_, err = id.EnrollDevice(reEnrollRequest(t, brand, deviceKey, ""))
+	assert.EqualError(t, err, "`example/drone-2000/DR2000A111` is already enrolled: a device-session-request signed with the device key, or a CSR for the device key, is required")
+	forged := reEnrollRequest(t, brand, deviceKey, "")
+	forged.SessionRequest = sessionRequest(t, newKey, "DR2000A111", "n1", time.Now())
+	_, err = id.EnrollDevice(forged)
+	assert.Error(t, err)
+
+	second, err := id.EnrollDevice(reEnrollRequest(t, brand, deviceKey, "n1"))
+	assert.NoError(t, err)
+	assert.Equal(t, deviceID, second.ID)
+	assert.NotEmpty(t, second.Credentials.PrivateKey)
+	assert.NotEqual(t, first.Credentials.SerialNumber, second.Credentials.SerialNumber)
+
+	issuer, serialNumber, err := id.credentialsRevocationKey(first)
+	assert.NoError(t, err)
+	revoked, err := db.CertificateRevokedGet(issuer, serialNumber, first.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, cert.ReasonSuperseded, revoked.Reason)
+
+	// The nonce is used up
+	_, err = id.EnrollDevice(reEnrollRequest(t, brand, deviceKey, "n1"))
+	assert.Error(t, err)
+
+	// A CSR for the device key shows the device holds it too
+	csr := reEnrollRequest(t, brand, deviceKey, "")
+	csr.CSR = newTestCSR(t, deviceRSAKey)
+	_, err = id.EnrollDevice(csr)
+	assert.NoError(t, err)
+
+	// Assertions that aren't signed by a trusted account key are refused, and not recorded
+	other, _ := assertstest.GenerateKey(752)
+	_, err = id.EnrollDevice(reEnrollRequest(t, assertstest.NewSigningDB("example", other), deviceKey, "n2"))
+	assert.EqualError(t, err, "`example/drone-2000/DR2000A111` is already enrolled and its assertions are not signed by a trusted account key")
+	assert.Empty(t, db.EnrollmentRequests)
+
+	// A different device key needs approval
+	_, err = id.EnrollDevice(reEnrollRequest(t, brand, newKey, "n2"))
+	assert.EqualError(t, err, "`example/drone-2000/DR2000A111` is already enrolled with a different device key")
+
+	requests, err := id.EnrollmentRequestList(domain.EnrollmentRequestPending)
+	assert.NoError(t, err)
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+	approvedID, err := id.EnrollmentRequestApprove(requests[0].ID, &ApproveEnrollmentRequest{DeviceKey: requests[0].DeviceKey, Username: "jamesj"})
+	assert.NoError(t, err)
+	assert.Equal(t, deviceID, approvedID)
+
+	third, err := id.EnrollDevice(reEnrollRequest(t, brand, newKey, "n3"))
+	assert.NoError(t, err)
+	assert.Equal(t, deviceID, third.ID)
+	assert.Equal(t, "abc", third.Organization.ID)
+	assert.NotEqual(t, second.Credentials.SerialNumber, third.Credentials.SerialNumber)
+
+	// The approval is used up, and by default the same device key needs approval
+	viper.Set(keys.ReEnrollmentApprovalRequired, true)
+	_, err = id.EnrollDevice(reEnrollRequest(t, brand, newKey, "n4"))
+	assert.EqualError(t, err, "`example/drone-2000/DR2000A111` is already enrolled and re-enrollment needs approval")
+
+	request, err := db.EnrollmentRequestGet(requests[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.EnrollmentRequestPending, request.Status)
+	assert.Nil(t, request.EnrolledAt)
+}
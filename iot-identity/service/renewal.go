@@ -0,0 +1,187 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/models"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/spf13/viper"
+)
+
+// RenewDevice issues new credentials for an enrolled device and revokes the certificate they replace.
+// The device proves its identity with its current client certificate or with a device-session-request
+// assertion signed by the device key from its serial assertion, for a nonce issued by NonceNew.
+func (id IdentityService) RenewDevice(req *RenewDeviceRequest) (*domain.Enrollment, error) {
+	var device *domain.Enrollment
+	var err error
+
+	switch {
+	case req.ClientCertificate != nil:
+		device, err = id.renewalDeviceFromCertificate(req)
+	case req.SessionRequest != nil:
+		device, err = id.renewalDeviceFromSessionRequest(req)
+	default:
+		return nil, fmt.Errorf("a client certificate or a signed device-session-request is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if device.Status != models.StatusEnrolled {
+		return nil, fmt.Errorf("device %s is not enrolled", device.ID)
+	}
+
+	org, err := id.deviceOrganization(device)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials domain.Credentials
+	switch {
+	case req.CSR != nil:
+		credentials, err = newCredentialsFromCSR(org, device.ID, req.CSR)
+	case usesCSR(device):
+		return nil, fmt.Errorf("device %s enrolled with a certificate signing request and must renew with one", device.ID)
+	default:
+		credentials, err = newCredentials(org, device.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	Logger.Infof("Renewing credentials for device %s, certificate %s expires at %s", device.ID, credentials.SerialNumber, credentials.ExpiresAt)
+
+	return id.replaceCredentials(device, credentials)
+}
+
+// replaceCredentials stores new credentials for a device and revokes the certificate they replace
+func (id IdentityService) replaceCredentials(device *domain.Enrollment, credentials domain.Credentials) (*domain.Enrollment, error) {
+	if err := id.DB.DeviceCredentialsUpdate(device.ID, credentials); err != nil {
+		return nil, err
+	}
+
+	// The new credentials are already stored, so failing to revoke the old certificate does not fail the request
+	if err := id.revokeCredentials(device, cert.ReasonSuperseded); err != nil {
+		Logger.Errorf("Failed to revoke superseded certificate of device %s: %s", device.ID, err)
+	}
+
+	return id.DB.DeviceGetEnrollmentByID(device.ID)
+}
+
+// DeviceCertificatesExpiring lists the devices of an organization whose certificate expires within the duration
+func (id IdentityService) DeviceCertificatesExpiring(orgID string, within time.Duration) ([]domain.Enrollment, error) {
+	return id.DB.DeviceListExpiring(orgID, time.Now().Add(within))
+}
+
+func (id IdentityService) renewalDeviceFromCertificate(req *RenewDeviceRequest) (*domain.Enrollment, error) {
+	// The common name of a device certificate is the device ID
+	device, err := id.DB.DeviceGetEnrollmentByID(req.ClientCertificate.Subject.CommonName)
+	if err != nil {
+		return nil, fmt.Errorf("finding device for client certificate: %w", err)
+	}
+
+	org, err := id.deviceOrganization(device)
+	if err != nil {
+		return nil, err
+	}
+
+	authorities, err := organizationAuthorities(org)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cert.VerifyClientCert(authorities, req.ClientCertificate); err != nil {
+		return nil, fmt.Errorf("verifying client certificate: %w", err)
+	}
+
+	issuer, err := cert.IssuerKeyID(req.ClientCertificate, authorities)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber := req.ClientCertificate.SerialNumber.Text(16)
+	revoked, err := id.revokedCertificate(issuer, serialNumber, device.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked != nil {
+		return nil, fmt.Errorf("client certificate %s is revoked", serialNumber)
+	}
+
+	if device.Credentials.SerialNumber != serialNumber {
+		return nil, fmt.Errorf("client certificate %s is not the current certificate of device %s", serialNumber, device.ID)
+	}
+
+	return device, nil
+}
+
+func (id IdentityService) renewalDeviceFromSessionRequest(req *RenewDeviceRequest) (*domain.Enrollment, error) {
+	sessionRequest, ok := req.SessionRequest.(*asserts.DeviceSessionRequest)
+	if !ok {
+		return nil, fmt.Errorf("the renewal assertion is an unexpected type")
+	}
+
+	device, err := id.DB.DeviceGet(sessionRequest.BrandID(), sessionRequest.Model(), sessionRequest.Serial())
+	if err != nil {
+		return nil, fmt.Errorf("finding device for device-session-request: %w", err)
+	}
+
+	if device.Device.DeviceKey == "" {
+		return nil, fmt.Errorf("device %s has no device key", device.ID)
+	}
+
+	pubKey, err := asserts.DecodePublicKey([]byte(device.Device.DeviceKey))
+	if err != nil {
+		return nil, fmt.Errorf("decoding device key: %w", err)
+	}
+
+	if err = id.checkSessionRequest(sessionRequest, pubKey); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// checkSessionRequest checks that a device-session-request is recent, signed with the device key, and for a nonce
+// issued by NonceNew that is then used up
+func (id IdentityService) checkSessionRequest(sessionRequest *asserts.DeviceSessionRequest, deviceKey asserts.PublicKey) error {
+	skew := time.Since(sessionRequest.Timestamp())
+	if skew < 0 {
+		skew = -skew
+	}
+	if maxSkew := viper.GetDuration(keys.RenewalMaxClockSkew); skew > maxSkew {
+		return fmt.Errorf("the device-session-request timestamp is more than %s from the current time", maxSkew)
+	}
+
+	if err := checkSignature(sessionRequest, deviceKey); err != nil {
+		return fmt.Errorf("checking device-session-request signature: %w", err)
+	}
+
+	// The nonce is only used once the signature is verified, so nobody else can use up the nonce of a device
+	if err := id.DB.NonceConsume(sessionRequest.Nonce()); err != nil {
+		return fmt.Errorf("checking device-session-request nonce: %w", err)
+	}
+	return nil
+}
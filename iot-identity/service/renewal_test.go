@@ -0,0 +1,251 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/datastore/memory"
+	"github.com/everactive/dmscore/iot-identity/models"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// enrollTestDevice registers a device and marks it enrolled with the public part of the device key
+func enrollTestDevice(t *testing.T, db *memory.Store, id *IdentityService, deviceKey asserts.PrivateKey) string {
+	deviceID := registerTestDevice(t, id)
+
+	encodedKey, err := asserts.EncodePublicKey(deviceKey.PublicKey())
+	if err != nil {
+		t.Fatalf("EncodePublicKey() error = %v", err)
+	}
+
+	for i := range db.Roll {
+		if db.Roll[i].ID == deviceID {
+			db.Roll[i].Status = models.StatusEnrolled
+			db.Roll[i].Device.DeviceKey = string(encodedKey)
+		}
+	}
+	return deviceID
+}
+
+func sessionRequest(t *testing.T, deviceKey asserts.PrivateKey, serial, nonce string, timestamp time.Time) asserts.Assertion {
+	a, err := asserts.SignWithoutAuthority(asserts.DeviceSessionRequestType, map[string]interface{}{
+		"brand-id":  "example",
+		"model":     "drone-2000",
+		"serial":    serial,
+		"nonce":     nonce,
+		"timestamp": timestamp.UTC().Format(time.RFC3339),
+	}, nil, deviceKey)
+	if err != nil {
+		t.Fatalf("SignWithoutAuthority() error = %v", err)
+	}
+	return a
+}
+
+func pemBlockBytes(t *testing.T, data []byte) []byte {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("pem.Decode() found no PEM data")
+	}
+	return block.Bytes
+}
+
+func parseTestCertificate(t *testing.T, certPEM []byte) *x509.Certificate {
+	c, err := x509.ParseCertificate(pemBlockBytes(t, certPEM))
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	return c
+}
+
+func TestIdentityService_RenewDevice(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	viper.Set(keys.RenewalMaxClockSkew, "5m")
+	checkSignature = signatureCheck
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	deviceKey := asserts.RSAPrivateKey(rsaKey)
+	otherRSAKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherKey := asserts.RSAPrivateKey(otherRSAKey)
+
+	tests := []struct {
+		name     string
+		enrolled bool
+		request  func(current *x509.Certificate) *RenewDeviceRequest
+		wantErr  bool
+	}{
+		{"certificate", true, func(current *x509.Certificate) *RenewDeviceRequest {
+			return &RenewDeviceRequest{ClientCertificate: current}
+		}, false},
+		{"device-key", true, func(current *x509.Certificate) *RenewDeviceRequest {
+			return &RenewDeviceRequest{SessionRequest: sessionRequest(t, deviceKey, "DR2000A111", "abc123", time.Now())}
+		}, false},
+		{"unknown-nonce", true, func(current *x509.Certificate) *RenewDeviceRequest {
+			return &RenewDeviceRequest{SessionRequest: sessionRequest(t, deviceKey, "DR2000A111", "invalid", time.Now())}
+		}, true},
+		{"stale-timestamp", true, func(current *x509.Certificate) *RenewDeviceRequest {
+			return &RenewDeviceRequest{SessionRequest: sessionRequest(t, deviceKey, "DR2000A111", "abc123", time.Now().Add(-time.Hour))}
+		}, true},
+		{"wrong-device-key", true, func(current *x509.Certificate) *RenewDeviceRequest {
+			return &RenewDeviceRequest{SessionRequest: sessionRequest(t, otherKey, "DR2000A111", "abc123", time.Now())}
+		}, true},
+		{"unknown-device", true, func(current *x509.Certificate) *RenewDeviceRequest {
+			return &RenewDeviceRequest{SessionRequest: sessionRequest(t, deviceKey, "invalid", "abc123", time.Now())}
+		}, true},
+		{"not-enrolled", false, func(current *x509.Certificate) *RenewDeviceRequest {
+			return &RenewDeviceRequest{ClientCertificate: current}
+		}, true},
+		{"no-authentication", true, func(current *x509.Certificate) *RenewDeviceRequest {
+			return &RenewDeviceRequest{}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewStore()
+			id := NewIdentityService(db)
+			_ = db.NonceCreate("abc123", time.Now().Add(time.Minute))
+			var deviceID string
+			if tt.enrolled {
+				deviceID = enrollTestDevice(t, db, id, deviceKey)
+			} else {
+				deviceID = registerTestDevice(t, id)
+			}
+			before, _ := db.DeviceGetEnrollmentByID(deviceID)
+
+			got, err := id.RenewDevice(tt.request(parseTestCertificate(t, before.Credentials.Certificate)))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IdentityService.RenewDevice() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.Len(t, db.Revoked, 0)
+				return
+			}
+
+			assert.Equal(t, deviceID, got.ID)
+			assert.NotEqual(t, before.Credentials.SerialNumber, got.Credentials.SerialNumber)
+			assert.NotNil(t, got.Credentials.ExpiresAt)
+			assert.Len(t, db.Revoked, 1)
+			assert.Equal(t, before.Credentials.SerialNumber, db.Revoked[0].SerialNumber)
+			assert.Equal(t, cert.ReasonSuperseded, db.Revoked[0].Reason)
+		})
+	}
+}
+
+func TestIdentityService_RenewDeviceSupersededCertificate(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	db := memory.NewStore()
+	id := NewIdentityService(db)
+	deviceID := enrollTestDevice(t, db, id, asserts.RSAPrivateKey(rsaKey))
+	before, _ := db.DeviceGetEnrollmentByID(deviceID)
+	previous := parseTestCertificate(t, before.Credentials.Certificate)
+
+	_, err := id.RenewDevice(&RenewDeviceRequest{ClientCertificate: previous})
+	assert.NoError(t, err)
+
+	// The superseded certificate can't be used to renew again
+	_, err = id.RenewDevice(&RenewDeviceRequest{ClientCertificate: previous})
+	assert.Error(t, err)
+}
+
+func TestIdentityService_RenewDeviceNonce(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	viper.Set(keys.RenewalMaxClockSkew, "5m")
+	viper.Set(keys.NonceValidity, "5m")
+	checkSignature = signatureCheck
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	deviceKey := asserts.RSAPrivateKey(rsaKey)
+
+	db := memory.NewStore()
+	id := NewIdentityService(db)
+	enrollTestDevice(t, db, id, deviceKey)
+
+	nonce, err := id.NonceNew()
+	assert.NoError(t, err)
+	req := &RenewDeviceRequest{SessionRequest: sessionRequest(t, deviceKey, "DR2000A111", nonce, time.Now())}
+
+	_, err = id.RenewDevice(req)
+	assert.NoError(t, err)
+
+	// A device-session-request can't be replayed, even within the clock skew
+	_, err = id.RenewDevice(req)
+	assert.Error(t, err)
+
+	// An expired nonce can't be used
+	assert.NoError(t, db.NonceCreate("expired", time.Now().Add(-time.Second)))
+	_, err = id.RenewDevice(&RenewDeviceRequest{SessionRequest: sessionRequest(t, deviceKey, "DR2000A111", "expired", time.Now())})
+	assert.Error(t, err)
+}
+
+func TestIdentityService_DeviceCertificatesExpiring(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	db := memory.NewStore()
+	id := NewIdentityService(db)
+	deviceID := registerTestDevice(t, id)
+
+	got, err := id.DeviceCertificatesExpiring("abc", 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Len(t, got, 0)
+
+	// Client certificates are valid for years, so a long enough window includes the device
+	got, err = id.DeviceCertificatesExpiring("abc", 100*365*24*time.Hour)
+	assert.NoError(t, err)
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, deviceID, got[0].ID)
+	}
+}
+
+func TestIdentityService_RenewDeviceCSR(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	db := memory.NewStore()
+	id := NewIdentityService(db)
+	deviceID := enrollTestDevice(t, db, id, asserts.RSAPrivateKey(rsaKey))
+	before, _ := db.DeviceGetEnrollmentByID(deviceID)
+
+	// Renewing with a CSR switches a device to keeping its own private key
+	got, err := id.RenewDevice(&RenewDeviceRequest{ClientCertificate: parseTestCertificate(t, before.Credentials.Certificate), CSR: newTestCSR(t, rsaKey)})
+	assert.NoError(t, err)
+	assert.Empty(t, got.Credentials.PrivateKey)
+	assert.True(t, rsaKey.PublicKey.Equal(parseTestCertificate(t, got.Credentials.Certificate).PublicKey))
+
+	// After which server generated credentials can't be used
+	_, err = id.RenewDevice(&RenewDeviceRequest{ClientCertificate: parseTestCertificate(t, got.Credentials.Certificate)})
+	assert.Error(t, err)
+
+	// Disabling and re-enabling doesn't generate a private key either
+	assert.NoError(t, id.DeviceUpdate("abc", deviceID, &DeviceUpdateRequest{Status: int(models.StatusDisabled)}))
+	assert.NoError(t, id.DeviceUpdate("abc", deviceID, &DeviceUpdateRequest{Status: int(models.StatusWaiting)}))
+	after, _ := db.DeviceGetEnrollmentByID(deviceID)
+	assert.Empty(t, after.Credentials.PrivateKey)
+	assert.Equal(t, got.Credentials.Certificate, after.Credentials.Certificate)
+}
@@ -19,12 +19,28 @@
 
 package service
 
-import "github.com/snapcore/snapd/asserts"
+import (
+	"crypto/x509"
 
-// RegisterOrganizationRequest is the request to create a new organization
+	"github.com/snapcore/snapd/asserts"
+)
+
+// RegisterOrganizationRequest is the request to create a new organization.
+// The organization's CA is imported from RootCert and RootKey when they are given, and generated otherwise.
 type RegisterOrganizationRequest struct {
 	Name        string `json:"name"`
 	CountryName string `json:"country"`
+	RootCert    string `json:"rootCert,omitempty"`
+	RootKey     string `json:"rootKey,omitempty"`
+}
+
+// RotateOrganizationCARequest is the request to replace the CA of an organization. The CA is imported from
+// RootCert and RootKey when they are given, and generated otherwise. Overlap is how long the current CA stays
+// valid, as a duration such as "720h".
+type RotateOrganizationCARequest struct {
+	RootCert string `json:"rootCert,omitempty"`
+	RootKey  string `json:"rootKey,omitempty"`
+	Overlap  string `json:"overlap,omitempty"`
 }
 
 // RegisterDeviceRequest is the request to create a new device
@@ -36,16 +52,31 @@ type RegisterDeviceRequest struct {
 	DeviceData     string `json:"deviceData"`
 }
 
+// RegisterDevicesRequest is the request to register devices in bulk. Data is CSV or JSON lines, as given by Format,
+// of the brand, model, serial and device data of each device. In best-effort mode every valid device is registered,
+// otherwise the devices are registered in a transaction and none are if any device fails.
+type RegisterDevicesRequest struct {
+	OrganizationID string
+	Format         string
+	Data           []byte
+	BestEffort     bool
+}
+
 // DeleteDeviceRequest is the request to delete a device
 type DeleteDeviceRequest struct {
 	OrganizationID string `json:"orgid"`
 	DeviceID       string `json:"deviceID"`
 }
 
-// EnrollDeviceRequest is the request to enroll a device via assertions
+// EnrollDeviceRequest is the request to enroll a device via assertions.
+// When a CSR is given, the device certificate is signed for its public key and no private key is stored.
 type EnrollDeviceRequest struct {
 	Model  asserts.Assertion
 	Serial asserts.Assertion
+	// SessionRequest is a device-session-request signed with the device key, for a device that re-enrolls
+	SessionRequest asserts.Assertion
+	CSR            *x509.CertificateRequest
+	SourceIP       string
 }
 
 // DeviceUpdateRequest holds request to update a device registration
@@ -53,3 +84,25 @@ type DeviceUpdateRequest struct {
 	DeviceData string `json:"deviceData"`
 	Status     int    `json:"status"`
 }
+
+// DeviceRevokeRequest holds the request to revoke the certificate of a device
+type DeviceRevokeRequest struct {
+	Reason int `json:"reason"`
+}
+
+// RenewDeviceRequest is the request to renew the credentials of a device. It is authenticated either by the
+// current client certificate or by a device-session-request assertion signed with the device key.
+// Devices that enrolled with a CSR must renew with a CSR.
+type RenewDeviceRequest struct {
+	ClientCertificate *x509.Certificate
+	SessionRequest    asserts.Assertion
+	CSR               *x509.CertificateRequest
+}
+
+// ApproveEnrollmentRequest is the request to register a device from its enrollment attempts
+type ApproveEnrollmentRequest struct {
+	OrganizationID string `json:"orgid"`
+	DeviceKey      string `json:"deviceKey"`
+	DeviceData     string `json:"deviceData"`
+	Username       string `json:"-"`
+}
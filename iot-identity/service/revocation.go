@@ -0,0 +1,288 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/spf13/viper"
+)
+
+// RevokeDevice revokes the certificate of a device so brokers stop accepting it
+func (id IdentityService) RevokeDevice(deviceID string, reason int) error {
+	if !cert.ValidReason(reason) {
+		return fmt.Errorf("invalid revocation reason %d", reason)
+	}
+
+	device, err := id.DB.DeviceGetEnrollmentByID(deviceID)
+	if err != nil {
+		return err
+	}
+
+	return id.revokeCredentials(device, reason)
+}
+
+// CRL returns the PEM encoded certificate revocation list for the device certificates, signed by the root CA.
+// For an organization, it returns a list from each of the CAs of the organization, of its revoked certificates.
+func (id IdentityService) CRL(orgID string) ([]byte, error) {
+	revoked, err := id.DB.CertificateRevokedList()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(orgID) == 0 {
+		rootCertsDir := viper.GetString(keys.GetIdentityKey(keys.CertificatesPath))
+		root, err := cert.RootAuthority(rootCertsDir)
+		if err != nil {
+			return nil, err
+		}
+		rootRevoked, err := issuedRevocations(root, revoked)
+		if err != nil {
+			return nil, err
+		}
+		return cert.CreateCRL(root, rootRevoked, viper.GetDuration(keys.CRLValidity))
+	}
+
+	org, err := id.DB.OrganizationGet(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	authorities, err := organizationAuthorities(org)
+	if err != nil {
+		return nil, err
+	}
+
+	orgRevoked := []domain.RevokedCertificate{}
+	for _, r := range revoked {
+		if r.OrganizationID == orgID {
+			orgRevoked = append(orgRevoked, r)
+		}
+	}
+
+	crls := []byte{}
+	for _, a := range authorities {
+		issued, err := issuedRevocations(a, orgRevoked)
+		if err != nil {
+			return nil, err
+		}
+		crl, err := cert.CreateCRL(a, issued, viper.GetDuration(keys.CRLValidity))
+		if err != nil {
+			return nil, err
+		}
+		crls = append(crls, crl...)
+	}
+	return crls, nil
+}
+
+// OCSP answers a DER encoded OCSP request for the status of a device certificate, issued by the root CA or the CA
+// of an organization
+func (id IdentityService) OCSP(request []byte) ([]byte, error) {
+	responders, err := id.ocspResponders.get(id.loadOCSPResponders)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := func(issuer, serialNumber string) (*domain.RevokedCertificate, error) {
+		return id.revokedCertificate(issuer, serialNumber, "")
+	}
+	return cert.CreateOCSPResponse(responders, request, viper.GetDuration(keys.CRLValidity), lookup)
+}
+
+// loadOCSPResponders loads the root CA and the CAs of every organization
+func (id IdentityService) loadOCSPResponders() (*cert.OCSPResponders, error) {
+	rootCertsDir := viper.GetString(keys.GetIdentityKey(keys.CertificatesPath))
+	root, err := cert.RootAuthority(rootCertsDir)
+	if err != nil {
+		return nil, err
+	}
+	authorities := []*cert.Authority{root}
+
+	orgs, err := id.DB.OrganizationList()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range orgs {
+		org, err := id.DB.OrganizationGet(o.ID)
+		if err != nil {
+			return nil, err
+		}
+		orgAuthorities, err := organizationAuthorities(org)
+		if err != nil {
+			Logger.Errorf("Skipping the CA of organization %s for OCSP: %s", o.ID, err)
+			continue
+		}
+		// The root CA is last and already included
+		authorities = append(authorities, orgAuthorities[:len(orgAuthorities)-1]...)
+	}
+
+	return cert.NewOCSPResponders(authorities)
+}
+
+// ocspResponderCache keeps the CAs that answer OCSP requests, so that a request doesn't load and decrypt the CA of
+// every organization. They are loaded again once they are older than identity.ocsp.responders.refresh, or when the
+// CAs of the organizations change.
+type ocspResponderCache struct {
+	lock       sync.Mutex
+	responders *cert.OCSPResponders
+	loadedAt   time.Time
+}
+
+// get returns the cached CAs, loading them when they are missing or too old. The lock is held while they are
+// loaded, so that concurrent requests load them once.
+func (c *ocspResponderCache) get(load func() (*cert.OCSPResponders, error)) (*cert.OCSPResponders, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.responders != nil && time.Since(c.loadedAt) < viper.GetDuration(keys.OCSPRespondersRefresh) {
+		return c.responders, nil
+	}
+
+	responders, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.responders = responders
+	c.loadedAt = time.Now()
+	return responders, nil
+}
+
+// invalidate drops the cached CAs, so that the next request loads them again
+func (c *ocspResponderCache) invalidate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.responders = nil
+}
+
+// issuedRevocations filters the revoked certificates that were issued by a CA
+func issuedRevocations(authority *cert.Authority, revoked []domain.RevokedCertificate) ([]domain.RevokedCertificate, error) {
+	issuer, err := cert.KeyID(authority.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := []domain.RevokedCertificate{}
+	for _, r := range revoked {
+		if r.Issuer == issuer {
+			issued = append(issued, r)
+		}
+	}
+	return issued, nil
+}
+
+// revokedCertificate looks up the revocation of a certificate, of any device when the device ID is empty
+func (id IdentityService) revokedCertificate(issuer, serialNumber, deviceID string) (*domain.RevokedCertificate, error) {
+	revoked, err := id.DB.CertificateRevokedGet(issuer, serialNumber, deviceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return revoked, err
+}
+
+// revokeCredentials revokes the current certificate of a device, if it has one and it is not already revoked
+func (id IdentityService) revokeCredentials(device *domain.Enrollment, reason int) error {
+	if len(device.Credentials.Certificate) == 0 {
+		return nil
+	}
+
+	issuer, serialNumber, err := id.credentialsRevocationKey(device)
+	if err != nil {
+		return fmt.Errorf("revoking certificate of device %s: %w", device.ID, err)
+	}
+
+	// e.g. decommissioning revokes the certificate before deleting the device, which would revoke it again
+	revoked, err := id.revokedCertificate(issuer, serialNumber, device.ID)
+	if err != nil || revoked != nil {
+		return err
+	}
+
+	Logger.Infof("Revoking certificate %s of device %s, issued by %s, reason %d", serialNumber, device.ID, issuer, reason)
+
+	return id.DB.CertificateRevoke(domain.RevokedCertificate{
+		Issuer:         issuer,
+		SerialNumber:   serialNumber,
+		DeviceID:       device.ID,
+		OrganizationID: device.Organization.ID,
+		Reason:         reason,
+		RevokedAt:      time.Now(),
+	})
+}
+
+// credentialsRevoked checks whether the current certificate of a device is revoked. A certificate that shares its
+// serial number with the revoked certificate of another device from the same CA is in the CRL too, so it counts.
+func (id IdentityService) credentialsRevoked(device *domain.Enrollment) (bool, error) {
+	if len(device.Credentials.Certificate) == 0 {
+		return false, nil
+	}
+
+	issuer, serialNumber, err := id.credentialsRevocationKey(device)
+	if err != nil {
+		return false, err
+	}
+
+	revoked, err := id.revokedCertificate(issuer, serialNumber, "")
+	return revoked != nil, err
+}
+
+// credentialsRevocationKey returns the key ID of the CA that issued the current certificate of a device, one of
+// the CAs of its organization, and the serial number of the certificate
+func (id IdentityService) credentialsRevocationKey(device *domain.Enrollment) (string, string, error) {
+	org, err := id.deviceOrganization(device)
+	if err != nil {
+		return "", "", err
+	}
+
+	authorities, err := organizationAuthorities(org)
+	if err != nil {
+		return "", "", err
+	}
+
+	return cert.RevocationKey(device.Credentials.Certificate, authorities)
+}
+
+// reissueCredentials replaces the credentials of a device with a newly signed certificate
+// Devices that enrolled with a CSR keep the revoked certificate, they renew with a new CSR signed by the device key.
+func (id IdentityService) reissueCredentials(device *domain.Enrollment) error {
+	if usesCSR(device) {
+		Logger.Infof("Device %s enrolled with a certificate signing request, it needs to renew its credentials", device.ID)
+		return nil
+	}
+
+	org, err := id.deviceOrganization(device)
+	if err != nil {
+		return err
+	}
+
+	credentials, err := newCredentials(org, device.ID)
+	if err != nil {
+		return err
+	}
+
+	Logger.Infof("Issued new credentials for device %s", device.ID)
+
+	return id.DB.DeviceCredentialsUpdate(device.ID, credentials)
+}
@@ -0,0 +1,250 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/datastore/memory"
+	"github.com/everactive/dmscore/iot-identity/models"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+func registerTestDevice(t *testing.T, id *IdentityService) string {
+	deviceID, err := id.RegisterDevice(&RegisterDeviceRequest{OrganizationID: "abc", Brand: "example", Model: "drone-2000", SerialNumber: "DR2000A111"})
+	if err != nil {
+		t.Fatalf("RegisterDevice() error = %v", err)
+	}
+	return deviceID
+}
+
+func TestIdentityService_RevokeDevice(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+
+	tests := []struct {
+		name     string
+		deviceID string
+		reason   int
+		revoked  int
+		wantErr  bool
+	}{
+		{"valid", "", cert.ReasonKeyCompromise, 1, false},
+		{"no-credentials", "a111", cert.ReasonKeyCompromise, 0, false},
+		{"invalid-device", "invalid", cert.ReasonKeyCompromise, 0, true},
+		{"invalid-reason", "", 7, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewStore()
+			id := NewIdentityService(db)
+			deviceID := tt.deviceID
+			if len(deviceID) == 0 {
+				deviceID = registerTestDevice(t, id)
+			}
+
+			err := id.RevokeDevice(deviceID, tt.reason)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IdentityService.RevokeDevice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Len(t, db.Revoked, tt.revoked)
+			if tt.revoked > 0 {
+				assert.Equal(t, deviceID, db.Revoked[0].DeviceID)
+				assert.Equal(t, tt.reason, db.Revoked[0].Reason)
+			}
+		})
+	}
+}
+
+func TestIdentityService_DeviceUpdateRevocation(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	db := memory.NewStore()
+	id := NewIdentityService(db)
+	deviceID := registerTestDevice(t, id)
+
+	before, _ := db.DeviceGetEnrollmentByID(deviceID)
+
+	// Disabling revokes the certificate
+	err := id.DeviceUpdate("abc", deviceID, &DeviceUpdateRequest{Status: int(models.StatusDisabled)})
+	assert.NoError(t, err)
+	assert.Len(t, db.Revoked, 1)
+	assert.Equal(t, cert.ReasonPrivilegeWithdrawn, db.Revoked[0].Reason)
+
+	// Re-enabling issues new credentials that aren't revoked
+	err = id.DeviceUpdate("abc", deviceID, &DeviceUpdateRequest{Status: int(models.StatusWaiting)})
+	assert.NoError(t, err)
+
+	after, _ := db.DeviceGetEnrollmentByID(deviceID)
+	assert.NotEqual(t, before.Credentials.Certificate, after.Credentials.Certificate)
+	revoked, err := id.credentialsRevoked(after)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestIdentityService_DeleteDeviceRevocation(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	db := memory.NewStore()
+	id := NewIdentityService(db)
+	deviceID := registerTestDevice(t, id)
+
+	_, err := id.DeleteDevice(deviceID)
+	assert.NoError(t, err)
+	assert.Len(t, db.Revoked, 1)
+	assert.Equal(t, cert.ReasonCessationOfOperation, db.Revoked[0].Reason)
+
+	_, err = id.DeleteDevice("invalid")
+	assert.Error(t, err)
+
+	// A certificate that is already revoked is not revoked again when the device is deleted
+	deviceID, err = id.RegisterDevice(&RegisterDeviceRequest{OrganizationID: "abc", Brand: "example", Model: "drone-2000", SerialNumber: "DR2000B222"})
+	assert.NoError(t, err)
+	assert.NoError(t, id.RevokeDevice(deviceID, cert.ReasonKeyCompromise))
+	_, err = id.DeleteDevice(deviceID)
+	assert.NoError(t, err)
+	assert.Len(t, db.Revoked, 2)
+	assert.Equal(t, cert.ReasonKeyCompromise, db.Revoked[1].Reason)
+}
+
+func TestIdentityService_RestoreDevice(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	db := memory.NewStore()
+	id := NewIdentityService(db)
+	deviceID := registerTestDevice(t, id)
+	before, _ := db.DeviceGetEnrollmentByID(deviceID)
+
+	_, err := id.DeleteDevice(deviceID)
+	assert.NoError(t, err)
+
+	deleted, err := id.DeviceListDeleted("abc")
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 1)
+
+	got, err := id.RestoreDevice(deviceID)
+	assert.NoError(t, err)
+	assert.Equal(t, deviceID, got.ID)
+	assert.NotEqual(t, before.Credentials.Certificate, got.Credentials.Certificate)
+
+	revoked, err := id.credentialsRevoked(got)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	deleted, err = id.DeviceListDeleted("abc")
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 0)
+
+	_, err = id.RestoreDevice(deviceID)
+	assert.Error(t, err)
+}
+
+func TestIdentityService_CRL(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	db := memory.NewStore()
+	id := NewIdentityService(db)
+	deviceID := registerTestDevice(t, id)
+	assert.NoError(t, id.RevokeDevice(deviceID, cert.ReasonUnspecified))
+
+	got, err := id.CRL("")
+	assert.NoError(t, err)
+
+	block, _ := pem.Decode(got)
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	assert.NoError(t, err)
+	assert.Len(t, crl.RevokedCertificates, 1)
+	assert.Equal(t, db.Revoked[0].SerialNumber, crl.RevokedCertificates[0].SerialNumber.Text(16))
+}
+
+func Test_ocspResponderCache(t *testing.T) {
+	viper.Set(keys.OCSPRespondersRefresh, "1h")
+	defer viper.Set(keys.OCSPRespondersRefresh, "5m")
+
+	loads := 0
+	load := func() (*cert.OCSPResponders, error) {
+		loads++
+		return &cert.OCSPResponders{}, nil
+	}
+
+	c := &ocspResponderCache{}
+	_, err := c.get(load)
+	assert.NoError(t, err)
+	_, err = c.get(load)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, loads, "the CAs are loaded once")
+
+	c.invalidate()
+	_, _ = c.get(load)
+	assert.Equal(t, 2, loads, "the CAs are loaded again once invalidated")
+
+	viper.Set(keys.OCSPRespondersRefresh, "0s")
+	_, _ = c.get(load)
+	assert.Equal(t, 3, loads, "the CAs are loaded again once too old")
+
+	c.invalidate()
+	_, err = c.get(func() (*cert.OCSPResponders, error) { return nil, fmt.Errorf("MOCK error") })
+	assert.Error(t, err)
+	assert.Nil(t, c.responders, "a failed load is not cached")
+}
+
+func TestIdentityService_OCSPRotatedCA(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	viper.Set(keys.OCSPRespondersRefresh, "1h")
+	defer viper.Set(keys.OCSPRespondersRefresh, "5m")
+
+	db := memory.NewStore()
+	id := NewIdentityService(db)
+	orgID, err := id.RegisterOrganization(&RegisterOrganizationRequest{Name: "Test Org", CountryName: "GB"})
+	assert.NoError(t, err)
+
+	ocspRequest := func() []byte {
+		org, _ := db.OrganizationGet(orgID)
+		ca, err := cert.OrganizationAuthority(org)
+		if err != nil || ca == nil {
+			t.Fatalf("OrganizationAuthority() error = %v", err)
+		}
+		req, err := ocsp.CreateRequest(&x509.Certificate{SerialNumber: big.NewInt(12345)}, ca.Certificate, nil)
+		if err != nil {
+			t.Fatalf("ocsp.CreateRequest() error = %v", err)
+		}
+		return req
+	}
+	status := func(response []byte) int {
+		resp, err := ocsp.ParseResponse(response, nil)
+		if err != nil {
+			t.Fatalf("ocsp.ParseResponse() error = %v", err)
+		}
+		return resp.Status
+	}
+
+	got, err := id.OCSP(ocspRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Good, status(got))
+
+	// The cached CAs are replaced when a CA is rotated, so the new CA answers straight away
+	assert.NoError(t, id.RotateOrganizationCA(orgID, &RotateOrganizationCARequest{}))
+	got, err = id.OCSP(ocspRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Good, status(got))
+}
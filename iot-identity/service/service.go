@@ -24,9 +24,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
+
 	"github.com/everactive/dmscore/config/keys"
 	"github.com/everactive/dmscore/iot-identity/models"
-	"github.com/go-resty/resty/v2"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
@@ -46,26 +47,56 @@ var Logger = log.StandardLogger()
 type Identity interface {
 	RegisterOrganization(req *RegisterOrganizationRequest) (string, error)
 	RegisterDevice(req *RegisterDeviceRequest) (string, error)
+	RegisterDevices(req *RegisterDevicesRequest) ([]domain.DeviceRegistrationResult, error)
 	DeleteDevice(deviceID string) (string, error)
 	OrganizationList() ([]domain.Organization, error)
 	DeviceList(orgID string) ([]domain.Enrollment, error)
 	DeviceGet(orgID, deviceID string) (*domain.Enrollment, error)
 	DeviceUpdate(orgID, deviceID string, req *DeviceUpdateRequest) error
+	DeviceDataUpdate(deviceID, deviceData string) error
+	RevokeDevice(deviceID string, reason int) error
+	TransferDevice(deviceID, orgID string) (*domain.Enrollment, error)
+	DeviceListDeleted(orgID string) ([]domain.Enrollment, error)
+	RestoreDevice(deviceID string) (*domain.Enrollment, error)
+	PurgeDevices(deletedBefore time.Time, dryRun bool) ([]string, error)
+	DeviceCertificatesExpiring(orgID string, within time.Duration) ([]domain.Enrollment, error)
+	CRL(orgID string) ([]byte, error)
+	OCSP(request []byte) ([]byte, error)
+	OrganizationCABundle(orgID string) ([]byte, error)
+	RotateOrganizationCA(orgID string, req *RotateOrganizationCARequest) error
+	AccountKeyList() ([]domain.AccountKey, error)
+	AccountKeyAdd(assertions []byte) ([]domain.AccountKey, error)
+	AccountKeyDelete(signKeyID string) error
+	RefreshAccountKeys() error
+	AutoRegistrationRuleList() ([]domain.AutoRegistrationRule, error)
+	AutoRegistrationRuleCreate(rule domain.AutoRegistrationRule) (uint, error)
+	AutoRegistrationRuleUpdate(rule domain.AutoRegistrationRule) error
+	AutoRegistrationRuleDelete(ruleID uint) error
+	AutoRegistrationEvaluate(assertions []byte) (*domain.AutoRegistrationEvaluation, error)
+	AutoRegistrationGroups(deviceID string) (string, []string, error)
+	AutoRegistrationGroupsApplied(deviceID string) error
+	EnrollmentRequestList(status string) ([]domain.EnrollmentRequest, error)
+	EnrollmentRequestApprove(requestID uint, req *ApproveEnrollmentRequest) (string, error)
+	EnrollmentRequestReject(requestID uint, username string) error
 
 	EnrollDevice(req *EnrollDeviceRequest) (*domain.Enrollment, error)
+	RenewDevice(req *RenewDeviceRequest) (*domain.Enrollment, error)
+	NonceNew() (string, error)
 }
 
 // IdentityService implementation of the identity use cases
 type IdentityService struct {
-	DB                       datastore.DataStore
-	allowedSignKeyIDs        []string
-	allowedSignKeyPublicKeys map[string]asserts.PublicKey
+	DB                datastore.DataStore
+	allowedSignKeyIDs []string
+	signKeys          *accountKeyring
+	ocspResponders    *ocspResponderCache
 }
 
 // NewIdentityService creates an implementation of the identity use cases
 func NewIdentityService(db datastore.DataStore) *IdentityService {
 	ids := &IdentityService{
-		DB: db,
+		DB:             db,
+		ocspResponders: &ocspResponderCache{},
 	}
 
 	allowedSignKeyIDs := viper.GetStringSlice(keys.ValidSHA384Keys)
@@ -78,31 +109,10 @@ func NewIdentityService(db datastore.DataStore) *IdentityService {
 		}
 	}
 
-	ids.allowedSignKeyPublicKeys = make(map[string]asserts.PublicKey)
-
-	for _, key := range allowedSignKeyIDs {
-		restyClient := resty.New()
-		req := restyClient.NewRequest()
-		req.SetHeader("Accept", "application/x.ubuntu.assertion")
-		resp, err := req.Get(AccountKeyGetURL + key)
-		if err != nil {
-			log.Errorf("Cannot retrieve account key assertion for: %s cannot continue, will not be able to accept devices for that key", key)
-			break
-		}
-
-		accountKeyAssertion, err := asserts.Decode(resp.Body())
-		if err != nil {
-			log.Errorf("Cannot decode account key assertion for: %s cannot continue, will not be able to accept devices for that key", key)
-			break
-		}
-
-		pubKey, err := asserts.DecodePublicKey(accountKeyAssertion.Body())
-		if err != nil {
-			log.Errorf("Cannot decode public key assertion for: %s cannot continue, will not be able to accept devices for that key", key)
-			break
-		}
-
-		ids.allowedSignKeyPublicKeys[key] = pubKey
+	// Keys that can't be refreshed keep the assertion stored before
+	ids.signKeys = &accountKeyring{}
+	if err := ids.RefreshAccountKeys(); err != nil {
+		log.Errorf("Error refreshing account keys: %v", err)
 	}
 
 	return ids
@@ -126,21 +136,58 @@ func (id IdentityService) EnrollDevice(req *EnrollDeviceRequest) (*domain.Enroll
 	}
 
 	// Create the enrollment request
-	enroll := datastore.DeviceEnrollRequest{
-		Brand:        req.Model.Header("brand-id").(string),
-		Model:        req.Model.Header("model").(string),
-		SerialNumber: req.Serial.Header("serial").(string),
-		DeviceKey:    req.Serial.Header("device-key").(string),
+	enroll := enrollRequestFromAssertions(req.Model, req.Serial)
+
+	// Check the CSR before enrolling, so a bad request doesn't leave the device enrolled with generated credentials
+	if req.CSR != nil {
+		if err := req.CSR.CheckSignature(); err != nil {
+			return nil, fmt.Errorf("invalid certificate signing request signature: %w", err)
+		}
 	}
-	if req.Model.Header("store") != nil {
-		enroll.StoreID = req.Model.Header("store").(string)
+
+	en, reEnrolled, err := id.enroll(enroll, req)
+	var approvalRequired *approvalRequiredError
+	if errors.As(err, &approvalRequired) {
+		// The attempt is kept so an admin can approve the device, and its next retry succeeds
+		if errQueue := id.queueEnrollmentRequest(req, enroll, approvalRequired.reason); errQueue != nil {
+			log.Errorf("Error queueing the enrollment request: %v", errQueue)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	id.useEnrollmentApproval(en)
+	if req.CSR == nil && !reEnrolled {
+		return en, nil
+	}
+
+	// The credentials generated when the device was registered are replaced by ones for the device's own key.
+	// A re-enrolled device lost its credentials, so it gets new ones and the old certificate is revoked.
+	org, err := id.deviceOrganization(en)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials domain.Credentials
+	if req.CSR != nil {
+		credentials, err = newCredentialsFromCSR(org, en.ID, req.CSR)
+		if err != nil {
+			return nil, fmt.Errorf("signing certificate signing request: %w", err)
+		}
+	} else {
+		credentials, err = newCredentials(org, en.ID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return id.enroll(&enroll, req.Model, req.Serial)
+	return id.replaceCredentials(en, credentials)
 }
 
-// Enroll connects an IoT device with the service
-func (id IdentityService) enroll(enroll *datastore.DeviceEnrollRequest, model asserts.Assertion, serial asserts.Assertion) (*domain.Enrollment, error) {
+// Enroll connects an IoT device with the service. An enrolled device that enrolls again, e.g. after a factory reset,
+// is re-enrolled: it keeps its device ID and needs new credentials.
+func (id IdentityService) enroll(enroll *datastore.DeviceEnrollRequest, req *EnrollDeviceRequest) (*domain.Enrollment, bool, error) {
 	autoRegistrationEnabled := viper.GetBool(keys.AutoRegistrationEnabled)
 
 	log.Infof("Auto-registration is enabled = %t", autoRegistrationEnabled)
@@ -150,39 +197,29 @@ func (id IdentityService) enroll(enroll *datastore.DeviceEnrollRequest, model as
 	dev, err := id.DB.DeviceGet(enroll.Brand, enroll.Model, enroll.SerialNumber)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		log.Error("Trying to get device: ", err)
-		return nil, fmt.Errorf("getting device: %w", err)
+		return nil, false, fmt.Errorf("getting device: %w", err)
 	}
 
 	// We know it's a sql.ErrNoRows error and should be handled like this
 	if err != nil {
 		log.Tracef("Not an existing device, check if auto-registration is enabled and if so, try to register")
-		if errors.Is(err, sql.ErrNoRows) && autoRegistrationEnabled {
-			log.Tracef("Checking device auto-registration eligibility")
-			canAutoRegister := id.checkAutoRegistrationEligibility(model, serial)
-			if !canAutoRegister {
-				return nil, fmt.Errorf("`%s/%s/%s` is not eligible for auto-registration and an existing registration was not found, please manually register this device", enroll.Brand, enroll.Model, enroll.SerialNumber)
-			}
-
-			// if we couldn't find the partial enrollment (registration data) AND
-			// auto-registration is enabled, then we will register the device and then enroll it
-			orgID, err := id.getDefaultOrgID()
-			if err != nil {
-				return nil, fmt.Errorf("getting default org ID: %w", err)
-			}
-
-			register := &RegisterDeviceRequest{
-				OrganizationID: orgID,
-				Brand:          enroll.Brand,
-				Model:          enroll.Model,
-				SerialNumber:   enroll.SerialNumber,
-			}
+		if !autoRegistrationEnabled {
+			return nil, false, &approvalRequiredError{reason: fmt.Sprintf("`%s/%s/%s` is not registered", enroll.Brand, enroll.Model, enroll.SerialNumber)}
+		}
 
-			if _, err := id.RegisterDevice(register); err != nil {
-				return nil, fmt.Errorf("auto-registering device in enrollment: %w", err)
-			}
+		log.Tracef("Checking device auto-registration eligibility")
+		canAutoRegister := id.checkAutoRegistrationEligibility(req.Model, req.Serial)
+		if !canAutoRegister {
+			return nil, false, &approvalRequiredError{reason: fmt.Sprintf("`%s/%s/%s` is not eligible for auto-registration and an existing registration was not found, please manually register this device", enroll.Brand, enroll.Model, enroll.SerialNumber)}
+		}
 
-			// Now that the device is registered without error, it will be created below
+		// if we couldn't find the partial enrollment (registration data) AND
+		// auto-registration is enabled, then we will register the device and then enroll it
+		if err := id.autoRegister(enroll, req.Serial); err != nil {
+			return nil, false, err
 		}
+
+		// Now that the device is registered without error, it will be created below
 	}
 
 	if dev != nil {
@@ -193,20 +230,68 @@ func (id IdentityService) enroll(enroll *datastore.DeviceEnrollRequest, model as
 		switch dev.Status {
 		case models.StatusWaiting:
 			// this will result in the device being created before function returns
-			break
+			if err := id.checkApprovedEnrollment(dev, enroll); err != nil {
+				return nil, false, err
+			}
 		case models.StatusEnrolled:
-			return nil, fmt.Errorf("`%s/%s/%s` is already enrolled", enroll.Brand, enroll.Model, enroll.SerialNumber)
+			if err := id.checkReEnrollment(dev, enroll, req); err != nil {
+				return nil, false, err
+			}
+			log.Infof("Re-enrolling device %s", dev.ID)
+			en, err := id.DB.DeviceEnroll(*enroll)
+			return en, err == nil, err
 		case models.StatusDisabled:
-			return nil, fmt.Errorf("`%s/%s/%s` is disabled", enroll.Brand, enroll.Model, enroll.SerialNumber)
+			return nil, false, fmt.Errorf("`%s/%s/%s` is disabled", enroll.Brand, enroll.Model, enroll.SerialNumber)
 		default:
-			return nil, fmt.Errorf("unexpected status for `%s/%s/%s` where status = %d", enroll.Brand, enroll.Model, enroll.SerialNumber, dev.Status)
+			return nil, false, fmt.Errorf("unexpected status for `%s/%s/%s` where status = %d", enroll.Brand, enroll.Model, enroll.SerialNumber, dev.Status)
 		}
 	}
 
 	// Enroll the device, this should happen for one of two reasons:
 	// 1. a device is registered (partially enrolled) and is in the waiting state
 	// 2. a device is not registered but autoregistration is enabled AND it satisfies the auto-registration criteria
-	return id.DB.DeviceEnroll(*enroll)
+	en, err := id.DB.DeviceEnroll(*enroll)
+	return en, false, err
+}
+
+// autoRegister registers a device where the auto-registration rules send it
+func (id IdentityService) autoRegister(enroll *datastore.DeviceEnrollRequest, serial asserts.Assertion) error {
+	target, err := id.autoRegistrationTarget(enroll, serial)
+	if err != nil {
+		return err
+	}
+	if target.PendingApproval {
+		return &approvalRequiredError{reason: fmt.Sprintf("`%s/%s/%s` is pending approval for auto-registration", enroll.Brand, enroll.Model, enroll.SerialNumber)}
+	}
+
+	register := &RegisterDeviceRequest{
+		OrganizationID: target.OrganizationID,
+		Brand:          enroll.Brand,
+		Model:          enroll.Model,
+		SerialNumber:   enroll.SerialNumber,
+		DeviceData:     target.DeviceData,
+	}
+
+	deviceID, err := id.RegisterDevice(register)
+	if err != nil {
+		return fmt.Errorf("auto-registering device in enrollment: %w", err)
+	}
+
+	if target.Rule == nil {
+		return nil
+	}
+
+	// The groups are linked when the device twin first hears from the device
+	registration := domain.AutoRegistration{
+		DeviceID:       deviceID,
+		RuleID:         target.Rule.ID,
+		OrganizationID: target.OrganizationID,
+		Groups:         target.Groups,
+	}
+	if err := id.DB.AutoRegistrationNew(registration); err != nil {
+		return fmt.Errorf("recording auto-registration: %w", err)
+	}
+	return nil
 }
 
 func (id IdentityService) checkAutoRegistrationEligibility(model asserts.Assertion, serial asserts.Assertion) bool {
@@ -232,7 +317,7 @@ func isSignKeyAllowed(signKeyID string, allowedKeys map[string]asserts.PublicKey
 }
 
 func (id IdentityService) checkKey(asrt asserts.Assertion) bool {
-	if pk, ok := isKeyAllowed(asrt.SignKeyID(), id.allowedSignKeyPublicKeys); ok {
+	if pk, ok := isKeyAllowed(asrt.SignKeyID(), id.signKeys.publicKeys(time.Now())); ok {
 		err := checkSignature(asrt, pk)
 		if err != nil {
 			log.Error("Failed signature check: ", err)
@@ -20,9 +20,15 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"github.com/everactive/dmscore/config/keys"
 	"testing"
 
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/stretchr/testify/assert"
+
 	"github.com/everactive/dmscore/iot-identity/config/configkey"
 	"github.com/spf13/viper"
 
@@ -316,7 +322,7 @@ func TestIdentityService_Enroll(t *testing.T) {
 				return nil, true
 			}
 
-			got, err := id.enroll(&tt.args.req, tt.args.model, tt.args.serial)
+			got, _, err := id.enroll(&tt.args.req, &EnrollDeviceRequest{Model: tt.args.model, Serial: tt.args.serial})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("IdentityService.Enroll() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -391,3 +397,71 @@ func TestIdentityService_EnrollDevice(t *testing.T) {
 		})
 	}
 }
+
+func newTestCSR(t *testing.T, key *rsa.PrivateKey) *x509.CertificateRequest {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		t.Fatalf("CreateCertificateRequest() error = %v", err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatalf("ParseCertificateRequest() error = %v", err)
+	}
+	return csr
+}
+
+func TestIdentityService_EnrollDeviceCSR(t *testing.T) {
+	viper.Set(keys.GetIdentityKey(keys.CertificatesPath), "../datastore/test_data")
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	tampered := newTestCSR(t, key)
+	tampered.Signature = []byte("invalid")
+
+	tests := []struct {
+		name    string
+		csr     *x509.CertificateRequest
+		wantErr bool
+	}{
+		{"valid", newTestCSR(t, key), false},
+		{"invalid-signature", tampered, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewStore()
+			id := NewIdentityService(db)
+			deviceID, err := id.RegisterDevice(&RegisterDeviceRequest{OrganizationID: "abc", Brand: "canonical", Model: "ubuntu-core-18-amd64", SerialNumber: "d75f7300-abbf-4c11-bf0a-8b7103038490"})
+			if err != nil {
+				t.Fatalf("RegisterDevice() error = %v", err)
+			}
+			// The registration in the test store has placeholder credentials, replace them with real ones
+			registered, _ := db.DeviceGetEnrollmentByID(deviceID)
+			registered.Credentials, _ = newCredentials(&registered.Organization, deviceID)
+			_ = db.DeviceCredentialsUpdate(deviceID, registered.Credentials)
+
+			m, _ := asserts.Decode([]byte(model1))
+			s, _ := asserts.Decode([]byte(serial1))
+			got, err := id.EnrollDevice(&EnrollDeviceRequest{Model: m, Serial: s, CSR: tt.csr})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("IdentityService.EnrollDevice() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.Len(t, db.Revoked, 0)
+				return
+			}
+
+			// The certificate is for the device's key and no private key is kept
+			assert.Empty(t, got.Credentials.PrivateKey)
+			c, err := x509.ParseCertificate(pemBlockBytes(t, got.Credentials.Certificate))
+			if assert.NoError(t, err) {
+				assert.True(t, key.PublicKey.Equal(c.PublicKey))
+				assert.Equal(t, deviceID, c.Subject.CommonName)
+			}
+
+			// The certificate generated at registration is superseded
+			if assert.Len(t, db.Revoked, 1) {
+				assert.Equal(t, registered.Credentials.SerialNumber, db.Revoked[0].SerialNumber)
+				assert.Equal(t, cert.ReasonSuperseded, db.Revoked[0].Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"fmt"
+
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+)
+
+// TransferDevice moves a device registration to another organization. The certificate subject names the
+// organization, so the device is issued new credentials from the CA of the new organization and its current
+// certificate is revoked. The device picks up the new credentials by enrolling again.
+// Devices that enrolled with a CSR are issued a certificate for the public key of their current certificate.
+func (id IdentityService) TransferDevice(deviceID, orgID string) (*domain.Enrollment, error) {
+	device, err := id.DB.DeviceGetEnrollmentByID(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if device.Organization.ID == orgID {
+		return nil, fmt.Errorf("device %s already belongs to organization %s", deviceID, orgID)
+	}
+
+	org, err := id.DB.OrganizationGet(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials domain.Credentials
+	if usesCSR(device) {
+		credentials, err = newCredentialsForKey(org, device)
+	} else {
+		credentials, err = newCredentials(org, device.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = id.DB.DeviceTransfer(device.ID, org.ID, credentials); err != nil {
+		return nil, err
+	}
+
+	Logger.Infof("Transferred device %s from organization %s to %s", device.ID, device.Organization.ID, org.ID)
+
+	// The device is already transferred, so failing to revoke the old certificate does not fail the request
+	if err = id.revokeCredentials(device, cert.ReasonAffiliationChanged); err != nil {
+		Logger.Errorf("Failed to revoke certificate of transferred device %s: %s", device.ID, err)
+	}
+
+	return id.DB.DeviceGetEnrollmentByID(device.ID)
+}
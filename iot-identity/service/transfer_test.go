@@ -0,0 +1,102 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentityService_TransferDevice(t *testing.T) {
+	tests := []struct {
+		name     string
+		deviceID string
+		orgID    string
+		revoked  int
+		wantErr  bool
+	}{
+		{"valid", "", "def", 1, false},
+		{"same-organization", "", "abc", 0, true},
+		{"invalid-organization", "", "invalid", 0, true},
+		{"invalid-device", "invalid", "def", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, db := newTestAutoRegistrationService(t)
+			deviceID := tt.deviceID
+			if len(deviceID) == 0 {
+				deviceID = registerTestDevice(t, id)
+			}
+			before, _ := db.DeviceGetEnrollmentByID(deviceID)
+
+			got, err := id.TransferDevice(deviceID, tt.orgID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("IdentityService.TransferDevice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Len(t, db.Revoked, tt.revoked)
+			if tt.wantErr {
+				return
+			}
+
+			assert.Equal(t, tt.orgID, got.Organization.ID)
+			assert.NotEqual(t, before.Credentials.Certificate, got.Credentials.Certificate)
+			assert.Equal(t, before.Organization.ID, db.Revoked[0].OrganizationID)
+			assert.Equal(t, cert.ReasonAffiliationChanged, db.Revoked[0].Reason)
+
+			block, _ := pem.Decode(got.Credentials.Certificate)
+			c, err := x509.ParseCertificate(block.Bytes)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Other Inc"}, c.Subject.Organization)
+
+			revoked, err := id.credentialsRevoked(got)
+			assert.NoError(t, err)
+			assert.False(t, revoked)
+		})
+	}
+}
+
+func TestIdentityService_TransferDeviceCSR(t *testing.T) {
+	id, db := newTestAutoRegistrationService(t)
+	deviceID := registerTestDevice(t, id)
+
+	// The device keeps its own private key, so it is issued a certificate for the same public key
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	org, err := db.OrganizationGet("abc")
+	assert.NoError(t, err)
+	credentials, err := newCredentialsFromCSR(org, deviceID, newTestCSR(t, rsaKey))
+	assert.NoError(t, err)
+	assert.NoError(t, db.DeviceCredentialsUpdate(deviceID, credentials))
+
+	got, err := id.TransferDevice(deviceID, "def")
+	assert.NoError(t, err)
+	assert.Empty(t, got.Credentials.PrivateKey)
+	assert.NotEqual(t, credentials.Certificate, got.Credentials.Certificate)
+
+	c := parseTestCertificate(t, got.Credentials.Certificate)
+	assert.True(t, rsaKey.PublicKey.Equal(c.PublicKey))
+	assert.Equal(t, []string{"Other Inc"}, c.Subject.Organization)
+	assert.Len(t, db.Revoked, 1)
+}
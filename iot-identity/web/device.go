@@ -20,44 +20,43 @@
 package web
 
 import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 
+	"github.com/everactive/dmscore/config/keys"
 	"github.com/everactive/dmscore/iot-identity/service"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"github.com/snapcore/snapd/asserts"
+	"github.com/spf13/viper"
 )
 
-// EnrollDevice connects an IoT device with the identity service
+// EnrollDevice connects an IoT device with the identity service. A device that re-enrolls also sends a
+// device-session-request assertion signed with its device key.
 func (i IdentityService) EnrollDevice(c *gin.Context) {
-	// Decode the assertions from the request
-	assertion1, assertion2, err := decodeEnrollRequest(c.Request)
+	// A device that keeps its private key sends a PEM CSR ahead of the assertions
+	csr, body, err := decodeCSR(c.Request.Body)
 	if err != nil {
 		formatStandardResponse("EnrollDevice", err.Error(), c.Writer)
 		return
 	}
-	if assertion1 == nil || assertion2 == nil {
-		formatStandardResponse("EnrollDevice", "A model and serial assertion is required", c.Writer)
+
+	req := service.EnrollDeviceRequest{CSR: csr, SourceIP: c.ClientIP()}
+
+	// Decode the assertions from the request
+	if err := decodeEnrollRequest(body, &req); err != nil {
+		formatStandardResponse("EnrollDevice", err.Error(), c.Writer)
 		return
 	}
 
 	log.Tracef("Model and serial asertions decoded")
 
-	req := service.EnrollDeviceRequest{}
-
-	if assertion1.Type().Name == asserts.ModelType.Name && assertion2.Type().Name == asserts.SerialType.Name {
-		req.Model = assertion1
-		req.Serial = assertion2
-	} else if assertion1.Type().Name == asserts.SerialType.Name && assertion2.Type().Name == asserts.ModelType.Name {
-		req.Model = assertion2
-		req.Serial = assertion1
-	}
-	if req.Model == nil || req.Serial == nil {
-		log.Println("A model and serial assertion must be provided")
-	}
-
 	log.Tracef("Attempting to enroll device")
 
 	en, err := i.Identity.EnrollDevice(&req)
@@ -70,31 +69,180 @@ func (i IdentityService) EnrollDevice(c *gin.Context) {
 	formatEnrollResponse(*en, c.Writer)
 }
 
-func decodeEnrollRequest(r *http.Request) (asserts.Assertion, asserts.Assertion, error) {
-	// Use snapd assertion module to decode the assertions in the request stream
-	dec := asserts.NewDecoder(r.Body)
-	assertion1, err := dec.Decode()
-	if err == io.EOF {
-		return nil, nil, fmt.Errorf("no data supplied")
+// RenewDevice issues new credentials for an enrolled device. The request is authenticated by the current
+// client certificate, either from the TLS connection or from the configured proxy header, or otherwise by
+// a device-session-request assertion in the body that is signed with the device key. As for enrollment,
+// the body can start with a PEM CSR.
+func (i IdentityService) RenewDevice(c *gin.Context) {
+	csr, body, err := decodeCSR(c.Request.Body)
+	if err != nil {
+		formatStandardResponse("RenewDevice", err.Error(), c.Writer)
+		return
 	}
+
+	req := service.RenewDeviceRequest{CSR: csr}
+
+	clientCert, err := renewalClientCertificate(c.Request)
 	if err != nil {
-		return nil, nil, err
+		formatStandardResponse("RenewDevice", err.Error(), c.Writer)
+		return
 	}
 
-	// Decode the second assertion
-	assertion2, err := dec.Decode()
-	if err != nil && err != io.EOF {
-		return nil, nil, err
+	if clientCert != nil {
+		req.ClientCertificate = clientCert
+	} else {
+		assertion, err := asserts.NewDecoder(body).Decode()
+		if err == io.EOF {
+			formatStandardResponse("RenewDevice", "A client certificate or a device-session-request assertion is required", c.Writer)
+			return
+		}
+		if err != nil {
+			formatStandardResponse("RenewDevice", err.Error(), c.Writer)
+			return
+		}
+		req.SessionRequest = assertion
+	}
+
+	en, err := i.Identity.RenewDevice(&req)
+	if err != nil {
+		log.Error("renewing device: ", err)
+		formatStandardResponse("RenewDevice", err.Error(), c.Writer)
+		return
+	}
+
+	formatEnrollResponse(*en, c.Writer)
+}
+
+func renewalClientCertificate(r *http.Request) (*x509.Certificate, error) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0], nil
+	}
+
+	// The header is only accepted from the TLS terminating proxies, any client could set it
+	header := viper.GetString(keys.RenewalClientCertHeader)
+	if header == "" || r.Header.Get(header) == "" || !fromTrustedProxy(r) {
+		return nil, nil
+	}
+
+	certPEM, err := url.QueryUnescape(r.Header.Get(header))
+	if err != nil {
+		return nil, fmt.Errorf("decoding client certificate header: %w", err)
+	}
+
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse client certificate PEM")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// fromTrustedProxy checks whether a request comes from one of the configured proxies
+func fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
 	}
 
-	// Stream must be ended now
-	_, err = dec.Decode()
-	if err != io.EOF {
-		if err == nil {
-			return nil, nil, fmt.Errorf("unexpected assertion in the request stream")
+	for _, proxy := range viper.GetStringSlice(keys.EnrollTrustedProxies) {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(ip) {
+			return true
 		}
+	}
+
+	return false
+}
+
+// NonceNew issues a nonce for a device to sign in its device-session-request
+func (i IdentityService) NonceNew(c *gin.Context) {
+	nonce, err := i.Identity.NonceNew()
+	if err != nil {
+		log.Error("issuing nonce: ", err)
+		formatStandardResponse("NonceNew", err.Error(), c.Writer)
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", JSONHeader)
+	encodeResponse(c.Writer, NonceResponse{Nonce: nonce})
+}
+
+const csrPEMPrefix = "-----BEGIN CERTIFICATE REQUEST-----"
+
+// maxDeviceRequestBytes bounds the body of an enroll or renew request, which only has a few assertions and a CSR
+const maxDeviceRequestBytes = 1024 * 1024
+
+// decodeCSR decodes the PEM certificate signing request at the start of a request body, if there is one,
+// and returns the rest of the body
+func decodeCSR(r io.Reader) (*x509.CertificateRequest, io.Reader, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxDeviceRequestBytes+1))
+	if err != nil {
 		return nil, nil, err
 	}
+	if len(data) > maxDeviceRequestBytes {
+		return nil, nil, fmt.Errorf("the request is larger than %d bytes", maxDeviceRequestBytes)
+	}
 
-	return assertion1, assertion2, nil
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte(csrPEMPrefix)) {
+		return nil, bytes.NewReader(data), nil
+	}
+
+	block, rest := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("failed to parse certificate signing request PEM")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse certificate signing request: %w", err)
+	}
+
+	// The assertion decoder doesn't accept blank lines ahead of the first assertion
+	return csr, bytes.NewReader(bytes.TrimLeft(rest, " \t\r\n")), nil
+}
+
+func decodeEnrollRequest(r io.Reader, req *service.EnrollDeviceRequest) error {
+	// Use snapd assertion module to decode the assertions in the request stream
+	dec := asserts.NewDecoder(r)
+	for count := 0; ; count++ {
+		assertion, err := dec.Decode()
+		if err == io.EOF {
+			if count == 0 {
+				return fmt.Errorf("no data supplied")
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// Each assertion can be sent once, the device-session-request is only needed to re-enroll
+		var field *asserts.Assertion
+		switch assertion.Type().Name {
+		case asserts.ModelType.Name:
+			field = &req.Model
+		case asserts.SerialType.Name:
+			field = &req.Serial
+		case asserts.DeviceSessionRequestType.Name:
+			field = &req.SessionRequest
+		}
+		if field == nil || *field != nil {
+			return fmt.Errorf("unexpected assertion in the request stream")
+		}
+		*field = assertion
+	}
+
+	if req.Model == nil || req.Serial == nil {
+		return fmt.Errorf("a model and serial assertion is required")
+	}
+	return nil
 }
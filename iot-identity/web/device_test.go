@@ -21,11 +21,26 @@ package web
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
 	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
 	"github.com/everactive/dmscore/iot-identity/service/mocks"
+	"github.com/snapcore/snapd/asserts"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/mock"
-	"testing"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -93,6 +108,16 @@ func TestIdentityService_EnrollDevice(t *testing.T) {
 	req5 := []byte(fmt.Sprintf("%s\n\n%s", serial1, model1))
 	req6 := []byte(serial1)
 	req7 := []byte(fmt.Sprintf("%s\n\nbad-data", serial1))
+	deviceKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	sessionRequest, _ := asserts.SignWithoutAuthority(asserts.DeviceSessionRequestType, map[string]interface{}{
+		"brand-id":  "canonical",
+		"model":     "ubuntu-core-18-amd64",
+		"serial":    "d75f7300-abbf-4c11-bf0a-8b7103038490",
+		"nonce":     "abc123",
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}, nil, asserts.RSAPrivateKey(deviceKey))
+	req8 := []byte(fmt.Sprintf("%s\n\n%s\n\n%s", model1, serial1, asserts.Encode(sessionRequest)))
+	req9 := []byte(fmt.Sprintf("%s\n\n%s\n\n%s", model1, asserts.Encode(sessionRequest), asserts.Encode(sessionRequest)))
 
 	type args struct {
 		req []byte
@@ -110,6 +135,9 @@ func TestIdentityService_EnrollDevice(t *testing.T) {
 		{"valid2", args{req5}, 200, ""},
 		{"one-assert", args{req6}, 400, "EnrollDevice"},
 		{"one-assert-bad", args{req7}, 400, "EnrollDevice"},
+		{"valid-session-request", args{req8}, 200, ""},
+		{"no-serial", args{req9}, 400, "EnrollDevice"},
+		{"too-large", args{bytes.Repeat([]byte("a"), maxDeviceRequestBytes+1)}, 400, "EnrollDevice"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -130,3 +158,175 @@ func TestIdentityService_EnrollDevice(t *testing.T) {
 		})
 	}
 }
+
+func TestIdentityService_EnrollDeviceSourceIP(t *testing.T) {
+	viper.Set(keys.EnrollTrustedProxies, []string{"10.0.0.0/8"})
+	defer viper.Set(keys.EnrollTrustedProxies, []string{})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       string
+	}{
+		{"valid-proxy", "10.1.2.3:4000", "192.0.2.10"},
+		{"valid-untrusted", "198.51.100.1:4000", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("EnrollDevice", mock.MatchedBy(func(req *service.EnrollDeviceRequest) bool {
+				return req.SourceIP == tt.want
+			})).Return(&domain.Enrollment{}, nil)
+			wb := NewIdentityService(identityMock, log.StandardLogger())
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/v1/device/enroll", bytes.NewReader([]byte(fmt.Sprintf("%s\n\n%s", model1, serial1))))
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "192.0.2.10")
+			wb.enrollRouter.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Errorf("Web.EnrollDevice() got = %v, want %v", w.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestIdentityService_RenewDevice(t *testing.T) {
+	const header = "X-Client-Cert"
+	viper.Set(keys.RenewalClientCertHeader, header)
+	defer viper.Set(keys.RenewalClientCertHeader, "")
+	viper.Set(keys.EnrollTrustedProxies, []string{"10.0.0.0/8", "192.0.2.10"})
+	defer viper.Set(keys.EnrollTrustedProxies, []string{})
+
+	_, certPEM, err := cert.CreateClientCert(&domain.Organization{Name: "Example PLC"}, "../datastore/test_data", "abc123")
+	if err != nil {
+		t.Fatalf("CreateClientCert() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		header      string
+		body        []byte
+		withCert    bool
+		withSession bool
+		err         error
+		code        int
+		result      string
+	}{
+		{"client-certificate", "10.1.2.3:40000", url.QueryEscape(string(certPEM)), nil, true, false, nil, 200, ""},
+		{"client-certificate-proxy-ip", "192.0.2.10:40000", url.QueryEscape(string(certPEM)), nil, true, false, nil, 200, ""},
+		{"untrusted-proxy", "192.0.2.11:40000", url.QueryEscape(string(certPEM)), nil, false, false, nil, 400, "RenewDevice"},
+		{"session-request", "192.0.2.11:40000", "", []byte(serial1), false, true, nil, 200, ""},
+		{"no-data", "10.1.2.3:40000", "", nil, false, false, nil, 400, "RenewDevice"},
+		{"bad-header", "10.1.2.3:40000", "not a certificate", nil, false, false, nil, 400, "RenewDevice"},
+		{"bad-data", "10.1.2.3:40000", "", []byte(`\u000`), false, false, nil, 400, "RenewDevice"},
+		{"renew-error", "10.1.2.3:40000", url.QueryEscape(string(certPEM)), nil, true, false, fmt.Errorf("MOCK error"), 400, "RenewDevice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("RenewDevice", mock.MatchedBy(func(req *service.RenewDeviceRequest) bool {
+				return (req.ClientCertificate != nil) == tt.withCert && (req.SessionRequest != nil) == tt.withSession
+			})).Return(&domain.Enrollment{ID: "abc123"}, tt.err)
+			wb := NewIdentityService(identityMock, log.StandardLogger())
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/v1/device/renew", bytes.NewReader(tt.body))
+			req.RemoteAddr = tt.remoteAddr
+			if len(tt.header) > 0 {
+				req.Header.Set(header, tt.header)
+			}
+			wb.enrollRouter.ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Errorf("Web.RenewDevice() got = %v, want %v", w.Code, tt.code)
+			}
+			resp, err := parseEnrollResponse(w.Body)
+			if err != nil {
+				t.Errorf("Web.RenewDevice() got = %v", err)
+			}
+			if resp.Code != tt.result {
+				t.Errorf("Web.RenewDevice() got = %v, want %v", resp.Code, tt.result)
+			}
+		})
+	}
+}
+
+func TestIdentityService_NonceNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		nonce  string
+		err    error
+		code   int
+		result string
+	}{
+		{"valid", "abc123", nil, 200, ""},
+		{"nonce-error", "", fmt.Errorf("MOCK error"), 400, "NonceNew"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("NonceNew").Return(tt.nonce, tt.err)
+			wb := NewIdentityService(identityMock, log.StandardLogger())
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/v1/device/nonce", nil)
+			wb.enrollRouter.ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Errorf("Web.NonceNew() got = %v, want %v", w.Code, tt.code)
+			}
+			resp := NonceResponse{}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Errorf("Web.NonceNew() got = %v", err)
+			}
+			if resp.Code != tt.result {
+				t.Errorf("Web.NonceNew() got = %v, want %v", resp.Code, tt.result)
+			}
+			if resp.Nonce != tt.nonce {
+				t.Errorf("Web.NonceNew() nonce = %v, want %v", resp.Nonce, tt.nonce)
+			}
+		})
+	}
+}
+
+func TestIdentityService_EnrollDeviceCSR(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	csrDER, _ := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+	badCSR := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: []byte("CSR")})
+
+	tests := []struct {
+		name    string
+		req     []byte
+		withCSR bool
+		code    int
+		result  string
+	}{
+		{"valid", []byte(fmt.Sprintf("%s\n%s\n\n%s", csrPEM, model1, serial1)), true, 200, ""},
+		{"no-csr", []byte(fmt.Sprintf("%s\n\n%s", model1, serial1)), false, 200, ""},
+		{"bad-csr", []byte(fmt.Sprintf("%s\n%s\n\n%s", badCSR, model1, serial1)), false, 400, "EnrollDevice"},
+		{"csr-only", csrPEM, true, 400, "EnrollDevice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("EnrollDevice", mock.MatchedBy(func(req *service.EnrollDeviceRequest) bool {
+				return (req.CSR != nil) == tt.withCSR
+			})).Return(&domain.Enrollment{}, nil)
+			wb := NewIdentityService(identityMock, log.StandardLogger())
+			w := sendEnrollRequest("POST", "/v1/device/enroll", bytes.NewReader(tt.req), wb)
+			if w.Code != tt.code {
+				t.Errorf("Web.EnrollDevice() got = %v, want %v", w.Code, tt.code)
+			}
+			resp, err := parseEnrollResponse(w.Body)
+			if err != nil {
+				t.Errorf("Web.EnrollDevice() got = %v", err)
+			}
+			if resp.Code != tt.result {
+				t.Errorf("Web.EnrollDevice() got = %v, want %v", resp.Code, tt.result)
+			}
+		})
+	}
+}
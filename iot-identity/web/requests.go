@@ -48,6 +48,20 @@ type RegisterResponse struct {
 	ID string `json:"id"`
 }
 
+// NonceResponse is the JSON response from the nonce API method
+type NonceResponse struct {
+	StandardResponse
+	Nonce string `json:"nonce"`
+}
+
+// RegisterDevicesResponse is the JSON response from a bulk registration API method. A large upload is registered
+// by a background job instead, JobID, and the results are those of the job.
+type RegisterDevicesResponse struct {
+	StandardResponse
+	Results []domain.DeviceRegistrationResult `json:"results"`
+	JobID   int64                             `json:"jobId,omitempty"`
+}
+
 // EnrollResponse is the JSON response from an enrollment API method
 type EnrollResponse struct {
 	StandardResponse
@@ -0,0 +1,104 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	crlPEMContentType       = "application/x-pem-file"
+	crlDERContentType       = "application/pkix-crl"
+	ocspResponseContentType = "application/ocsp-response"
+	ocspRequestMaxSize      = 10 * 1024
+)
+
+// CRL returns the certificate revocation list for device certificates, PEM encoded or DER with ?format=der.
+// With ?org= it returns the lists for the CAs of the organization, which are only available PEM encoded.
+func (i IdentityService) CRL(c *gin.Context) {
+	crlPEM, err := i.Identity.CRL(c.Query("org"))
+	if err != nil {
+		log.Error("creating CRL: ", err)
+		c.JSON(http.StatusInternalServerError, StandardResponse{Code: "CRL", Message: err.Error()})
+		return
+	}
+
+	if c.Query("format") == "der" {
+		block, rest := pem.Decode(crlPEM)
+		if block == nil {
+			log.Error("creating CRL: not PEM encoded")
+			c.JSON(http.StatusInternalServerError, StandardResponse{Code: "CRL", Message: "the CRL is not PEM encoded"})
+			return
+		}
+		if len(rest) > 0 {
+			c.JSON(http.StatusBadRequest, StandardResponse{Code: "CRL", Message: "there is more than one CRL, which can only be PEM encoded"})
+			return
+		}
+		c.Data(http.StatusOK, crlDERContentType, block.Bytes)
+		return
+	}
+
+	c.Data(http.StatusOK, crlPEMContentType, crlPEM)
+}
+
+// OCSP answers OCSP requests (RFC 6960) for device certificates, either POSTed or base64 encoded in the path
+func (i IdentityService) OCSP(c *gin.Context) {
+	var request []byte
+	var err error
+
+	if c.Request.Method == http.MethodGet {
+		var encoded string
+		encoded, err = url.PathUnescape(strings.TrimPrefix(c.Param("request"), "/"))
+		if err == nil {
+			request, err = base64.StdEncoding.DecodeString(encoded)
+		}
+	} else {
+		request, err = io.ReadAll(io.LimitReader(c.Request.Body, ocspRequestMaxSize))
+	}
+
+	if err != nil {
+		c.Data(http.StatusOK, ocspResponseContentType, ocsp.MalformedRequestErrorResponse)
+		return
+	}
+
+	response, err := i.Identity.OCSP(request)
+	if err != nil {
+		log.Error("answering OCSP request: ", err)
+		if errors.Is(err, cert.ErrMalformedOCSPRequest) {
+			c.Data(http.StatusOK, ocspResponseContentType, ocsp.MalformedRequestErrorResponse)
+		} else {
+			c.Data(http.StatusOK, ocspResponseContentType, ocsp.InternalErrorErrorResponse)
+		}
+		return
+	}
+
+	c.Data(http.StatusOK, ocspResponseContentType, response)
+}
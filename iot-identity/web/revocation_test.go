@@ -0,0 +1,113 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Identity Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/everactive/dmscore/iot-identity/service/mocks"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestIdentityService_CRL(t *testing.T) {
+	crlPEM := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: []byte("CRL")})
+	orgCRLPEM := append(append([]byte{}, crlPEM...), crlPEM...)
+
+	tests := []struct {
+		name        string
+		url         string
+		orgID       string
+		err         error
+		code        int
+		contentType string
+		body        []byte
+	}{
+		{"pem", "/v1/crl", "", nil, 200, crlPEMContentType, crlPEM},
+		{"der", "/v1/crl?format=der", "", nil, 200, crlDERContentType, []byte("CRL")},
+		{"org-pem", "/v1/crl?org=abc", "abc", nil, 200, crlPEMContentType, orgCRLPEM},
+		{"org-der", "/v1/crl?org=abc&format=der", "abc", nil, 400, "application/json; charset=utf-8", nil},
+		{"error", "/v1/crl", "", fmt.Errorf("MOCK error"), 500, "application/json; charset=utf-8", nil},
+		{"der-not-pem", "/v1/crl?format=der", "not-pem", nil, 500, "application/json; charset=utf-8", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			switch {
+			case tt.orgID == "not-pem":
+				identityMock.On("CRL", "").Return([]byte("CRL"), tt.err)
+			case len(tt.orgID) > 0:
+				identityMock.On("CRL", tt.orgID).Return(orgCRLPEM, tt.err)
+			default:
+				identityMock.On("CRL", "").Return(crlPEM, tt.err)
+			}
+			wb := NewIdentityService(identityMock, log.StandardLogger())
+			w := sendEnrollRequest("GET", tt.url, nil, wb)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			if tt.body != nil {
+				assert.Equal(t, tt.body, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestIdentityService_OCSP(t *testing.T) {
+	viper.Set(keys.OCSPEnabled, true)
+	defer viper.Set(keys.OCSPEnabled, false)
+
+	request := []byte("OCSP request")
+	response := []byte("OCSP response")
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   []byte
+		err    error
+		want   []byte
+	}{
+		{"post", "POST", "/v1/ocsp", request, nil, response},
+		{"get", "GET", "/v1/ocsp/" + url.PathEscape(base64.StdEncoding.EncodeToString(request)), nil, nil, response},
+		{"get-bad-encoding", "GET", "/v1/ocsp/not-base64!", nil, nil, ocsp.MalformedRequestErrorResponse},
+		{"malformed", "POST", "/v1/ocsp", request, fmt.Errorf("MOCK %w", cert.ErrMalformedOCSPRequest), ocsp.MalformedRequestErrorResponse},
+		{"internal-error", "POST", "/v1/ocsp", request, fmt.Errorf("MOCK error"), ocsp.InternalErrorErrorResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("OCSP", request).Return(response, tt.err)
+			wb := NewIdentityService(identityMock, log.StandardLogger())
+			w := sendEnrollRequest(tt.method, tt.url, bytes.NewReader(tt.body), wb)
+			assert.Equal(t, 200, w.Code)
+			assert.Equal(t, ocspResponseContentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.want, w.Body.Bytes())
+		})
+	}
+}
@@ -48,6 +48,11 @@ type IdentityService struct {
 func NewIdentityService(id service.Identity, l *log.Logger) *IdentityService {
 	enrollRouter := gin.New()
 	gin.SetMode(gin.ReleaseMode)
+	// The client address is recorded with enrollment requests, only the configured proxies may forward it
+	if err := enrollRouter.SetTrustedProxies(viper.GetStringSlice(keys.EnrollTrustedProxies)); err != nil {
+		log.Errorf("Error setting the trusted proxies of the enroll service, forwarded client addresses are ignored: %v", err)
+		_ = enrollRouter.SetTrustedProxies(nil)
+	}
 	logFormat := os.Getenv("LOG_FORMAT")
 	if strings.ToUpper(logFormat) == "JSON" {
 		log.Infof("Setting up JSON log format for logger middleware")
@@ -67,6 +72,13 @@ func NewIdentityService(id service.Identity, l *log.Logger) *IdentityService {
 	}
 
 	enrollRouter.POST("/v1/device/enroll", i.EnrollDevice)
+	enrollRouter.POST("/v1/device/renew", i.RenewDevice)
+	enrollRouter.POST("/v1/device/nonce", i.NonceNew)
+	enrollRouter.GET("/v1/crl", i.CRL)
+	if viper.GetBool(keys.OCSPEnabled) {
+		enrollRouter.POST("/v1/ocsp", i.OCSP)
+		enrollRouter.GET("/v1/ocsp/*request", i.OCSP)
+	}
 
 	enrollPort := viper.GetString(keys.GetIdentityKey(keys.ServicePortEnroll))
 	log.Info("Starting service (enroll) on port : ", enrollPort)
@@ -83,6 +95,14 @@ func NewIdentityService(id service.Identity, l *log.Logger) *IdentityService {
 func (i *IdentityService) Serve(ctx context.Context) error {
 	intervalTicker := time.NewTicker(60 * time.Second)
 
+	// The account keys are refreshed periodically unless the interval is zero
+	var refreshAccountKeys <-chan time.Time
+	if interval := viper.GetDuration(keys.AccountKeysRefreshInterval); interval > 0 {
+		refreshTicker := time.NewTicker(interval)
+		defer refreshTicker.Stop()
+		refreshAccountKeys = refreshTicker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -90,6 +110,10 @@ func (i *IdentityService) Serve(ctx context.Context) error {
 			return i.runErr
 		case <-intervalTicker.C:
 			log.Infof("%s still ticking", "DeviceTwinService")
+		case <-refreshAccountKeys:
+			if err := i.Identity.RefreshAccountKeys(); err != nil {
+				log.Errorf("Error refreshing account keys: %v", err)
+			}
 		}
 	}
 }
@@ -7,6 +7,8 @@ import (
 	"github.com/everactive/dmscore/config/keys"
 	"github.com/everactive/dmscore/iot-management/service/manage"
 	"net/url"
+	"sync"
+	"time"
 
 	"github.com/everactive/dmscore/iot-management/datastore"
 	"github.com/everactive/dmscore/iot-management/domain"
@@ -59,7 +61,7 @@ func CreateServiceClientUser(ms manage.Manage, clientName string) {
 	user, err := ms.GetUser(clientName)
 	if err != nil {
 		log.Infof("%s does not exist, creating", clientName)
-		err := ms.CreateUser(domain.User{Username: clientName, Role: datastore.Superuser})
+		err := ms.CreateUser(manage.AuditSystemUser, domain.User{Username: clientName, Role: datastore.Superuser})
 		if err != nil {
 			panic(err)
 		} else {
@@ -70,51 +72,78 @@ func CreateServiceClientUser(ms manage.Manage, clientName string) {
 	}
 }
 
-// VerifyKeycloakTokenWithAuth takes the Authorization string from the header and validates token and user, creating if necessary for service-accounts
-func VerifyKeycloakTokenWithAuth(a *ginkeycloak.Auth) func(authorizationToken string, wb web.Service) (datastore.User, error) {
+// roleSyncInterval is how long the synced roles of a user are trusted before they are synced again
+const roleSyncInterval = time.Minute
+
+type roleSync struct {
+	fingerprint string
+	synced      time.Time
+}
+
+// VerifyKeycloakToken takes the Authorization string from the header and introspects the token. The user of a valid
+// token is given the roles of the mappings that match it, and is created if necessary. Tokens that are not active,
+// do not have the required scope or match no mapping are rejected.
+func VerifyKeycloakToken(in *Introspector, mappings []RoleMapping) func(authorizationToken string, wb web.Service) (datastore.User, error) {
+	var lock sync.Mutex
+	synced := map[string]roleSync{}
+
 	return func(authorizationToken string, wb web.Service) (datastore.User, error) {
-		valid, clientDetails, err := a.VerifyTokenFromHeader(authorizationToken)
+		td, err := in.Introspect(authorizationToken)
 		if err != nil {
 			log.Error(err)
 			return datastore.User{}, err
 		}
 
-		if valid && clientDetails != nil {
-			_, err := wb.Manage.GetUser(clientDetails.ClientID)
-
-			// User for this client exists, done and return
-			if err == nil {
-				return datastore.User{
-					Username: clientDetails.ClientID,
-					Role:     datastore.Superuser,
-				}, nil
-			}
+		username := td.User()
+		if username == "" {
+			return datastore.User{}, ErrInactiveToken
+		}
 
-			// If user doesn't exist, try to create one
-			log.Error(err)
+		role, orgRoles, err := ResolveRoles(mappings, td)
+		if err != nil {
+			log.Errorf("rejecting the token of %s: %v", username, err)
+			return datastore.User{}, err
+		}
 
-			err = wb.Manage.CreateUser(domain.User{
-				Username: clientDetails.ClientID,
-				Name:     clientDetails.ClientID,
-				Role:     datastore.Superuser,
-			})
+		user := domain.User{
+			Username: username,
+			Name:     td.Name,
+			Email:    td.Email,
+			Role:     role,
+		}
+		if user.Name == "" {
+			user.Name = username
+		}
 
-			if err != nil {
+		// The roles follow the token, they are only written when they change. The lock only guards the map, the
+		// requests of other users do not wait for the sync
+		fingerprint := fmt.Sprint(user, orgRoles)
+		lock.Lock()
+		s, ok := synced[username]
+		lock.Unlock()
+		if !ok || s.fingerprint != fingerprint || time.Since(s.synced) > roleSyncInterval {
+			if err = wb.Manage.UserSync(datastore.UserProviderKeycloak, user, orgRoles); err != nil {
 				log.Error(err)
 				return datastore.User{}, err
 			}
 
-			// We were able to create the user and they are valid and authorized
-			return datastore.User{
-				Username: clientDetails.ClientID,
-				Role:     datastore.Superuser,
-			}, nil
+			now := time.Now()
+			lock.Lock()
+			// Drop the users whose sync is no longer trusted, they are synced again on their next request
+			for name, s := range synced {
+				if now.Sub(s.synced) > roleSyncInterval {
+					delete(synced, name)
+				}
+			}
+			synced[username] = roleSync{fingerprint: fingerprint, synced: now}
+			lock.Unlock()
 		}
 
-		// We were able to create the user and they are valid and authorized
 		return datastore.User{
-			Username: clientDetails.ClientID,
-			Role:     datastore.Superuser,
+			Username: username,
+			Name:     user.Name,
+			Email:    user.Email,
+			Role:     role,
 		}, nil
 	}
 }
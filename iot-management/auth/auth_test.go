@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/everactive/dmscore/iot-management/service/manage"
+	"github.com/everactive/dmscore/iot-management/web"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	testClientID     = "management"
+	testClientSecret = "secret"
+	testScope        = "dms"
+)
+
+// fakeIntrospectionServer answers token introspection requests with the claims of the known tokens
+func fakeIntrospectionServer(t *testing.T, tokens map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != testClientID || secret != testClientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("error parsing the introspection request: %v", err)
+		}
+
+		claims, ok := tokens[r.PostForm.Get("token")]
+		if !ok {
+			claims = map[string]interface{}{"active": false}
+		}
+		_ = json.NewEncoder(w).Encode(claims)
+	}))
+}
+
+func newTestIntrospector(server *httptest.Server) *Introspector {
+	u, _ := url.Parse(server.URL)
+	return NewIntrospector(testClientID, testClientSecret, u.Hostname(), u.Port(), u.Scheme, testScope, "/introspect")
+}
+
+var testMappings = []RoleMapping{
+	{Scope: "dms-superuser", Role: "superuser"},
+	{RealmRole: "dms-admin", Role: "admin"},
+	{Group: "/acme/operators", Organizations: []OrganizationRole{{ID: "abc", Role: datastore.OrgOperator}}},
+	{Group: "/acme/viewers", Organizations: []OrganizationRole{{ID: "abc", Role: datastore.OrgViewer}, {ID: "def", Role: datastore.OrgViewer}}},
+}
+
+func TestVerifyKeycloakToken(t *testing.T) {
+	server := fakeIntrospectionServer(t, map[string]interface{}{
+		"service-token": map[string]interface{}{"active": true, "scope": "dms dms-superuser", "clientId": "ci"},
+		"admin-token": map[string]interface{}{
+			"active": true, "scope": "dms profile", "preferred_username": "jamesj", "name": "JJ",
+			"realm_access": map[string]interface{}{"roles": []string{"dms-admin"}},
+			"groups":       []string{"/acme/viewers", "/acme/operators"},
+		},
+		"viewer-token":   map[string]interface{}{"active": true, "scope": "dms", "preferred_username": "sarahj", "groups": []string{"/acme/viewers"}},
+		"unmapped-token": map[string]interface{}{"active": true, "scope": "dms", "preferred_username": "unmapped"},
+		"scope-token":    map[string]interface{}{"active": true, "scope": "dms-superuser", "clientId": "ci"},
+		"inactive-token": map[string]interface{}{"active": false, "scope": "dms dms-superuser", "clientId": "ci"},
+	})
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		header       string
+		wantUser     string
+		wantRole     int
+		wantOrgRoles map[string]string
+		wantErr      error
+	}{
+		{"valid-service-account", "Bearer service-token", "ci", datastore.Superuser, map[string]string{}, nil},
+		{"valid-highest-roles", "Bearer admin-token", "jamesj", datastore.Admin, map[string]string{"abc": datastore.OrgOperator, "def": datastore.OrgViewer}, nil},
+		{"valid-group", "Bearer viewer-token", "sarahj", datastore.Standard, map[string]string{"abc": datastore.OrgViewer, "def": datastore.OrgViewer}, nil},
+		{"invalid-no-mapping", "Bearer unmapped-token", "", 0, nil, ErrNoRoleMapping},
+		{"invalid-scope", "Bearer scope-token", "", 0, nil, ErrMissingScope},
+		{"invalid-inactive", "Bearer inactive-token", "", 0, nil, ErrInactiveToken},
+		{"invalid-unknown", "Bearer unknown-token", "", 0, nil, ErrInactiveToken},
+		{"invalid-header", "Basic service-token", "", 0, nil, ErrInvalidAuthorizationHeader},
+		{"invalid-empty", "", "", 0, nil, ErrInvalidAuthorizationHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manageMock := &manage.MockManage{}
+			manageMock.On("UserSync", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			verify := VerifyKeycloakToken(newTestIntrospector(server), testMappings)
+			user, err := verify(tt.header, web.Service{Manage: manageMock})
+			assert.Equal(t, tt.wantErr, err)
+			if tt.wantErr != nil {
+				manageMock.AssertNotCalled(t, "UserSync", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+
+			assert.Equal(t, tt.wantUser, user.Username)
+			assert.Equal(t, tt.wantRole, user.Role)
+			manageMock.AssertCalled(t, "UserSync", datastore.UserProviderKeycloak, mock.MatchedBy(func(u domain.User) bool {
+				return u.Username == tt.wantUser && u.Role == tt.wantRole
+			}), tt.wantOrgRoles)
+
+			// The roles are not synced again while they do not change
+			_, err = verify(tt.header, web.Service{Manage: manageMock})
+			assert.Nil(t, err)
+			manageMock.AssertNumberOfCalls(t, "UserSync", 1)
+		})
+	}
+}
+
+func TestVerifyKeycloakToken_IntrospectionError(t *testing.T) {
+	server := fakeIntrospectionServer(t, nil)
+	defer server.Close()
+
+	in := newTestIntrospector(server)
+	in.ClientSecret = "invalid"
+
+	manageMock := &manage.MockManage{}
+	_, err := VerifyKeycloakToken(in, testMappings)("Bearer service-token", web.Service{Manage: manageMock})
+	assert.NotNil(t, err)
+	manageMock.AssertNotCalled(t, "UserSync", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestLoadRoleMappings(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    int
+		wantErr bool
+	}{
+		{"valid-none", nil, 0, false},
+		{"valid-json", `[{"scope":"dms-superuser","role":"superuser"},{"group":"/acme","organizations":[{"id":"abc","role":"operator"}]}]`, 2, false},
+		{"valid-config", []interface{}{map[string]interface{}{"realmRole": "dms-admin", "role": "admin"}}, 1, false},
+		{"invalid-json", `[{"scope":`, 0, true},
+		{"invalid-role", `[{"scope":"dms","role":"owner"}]`, 0, true},
+		{"invalid-org-role", `[{"scope":"dms","organizations":[{"id":"abc","role":"owner"}]}]`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set(keys.OAuth2RoleMappings, tt.value)
+			defer viper.Set(keys.OAuth2RoleMappings, nil)
+
+			got, err := LoadRoleMappings()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadRoleMappings() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Len(t, got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidAuthorizationHeader is returned when the Authorization header is not a bearer token
+	ErrInvalidAuthorizationHeader = errors.New("authorization header incorrect or invalid")
+	// ErrInactiveToken is returned when the introspected token is expired, revoked or unknown
+	ErrInactiveToken = errors.New("the token is not active")
+	// ErrMissingScope is returned when the token does not have the required scope
+	ErrMissingScope = errors.New("the token does not have the required scope")
+)
+
+const introspectTimeout = 30 * time.Second
+
+// TokenDetails are the claims of an introspected token that are used to authorize the client
+type TokenDetails struct {
+	Active   bool   `json:"active"`
+	Scope    string `json:"scope"`
+	ClientID string `json:"clientId"`
+	Username string `json:"preferred_username"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+
+	RealmAccess struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+	Groups []string `json:"groups"`
+}
+
+// Scopes returns the scopes of the token
+func (td TokenDetails) Scopes() []string {
+	return strings.Fields(td.Scope)
+}
+
+// User returns the name of the user of the token. Service accounts are named after their client.
+func (td TokenDetails) User() string {
+	if td.ClientID != "" {
+		return td.ClientID
+	}
+	return td.Username
+}
+
+// Introspector verifies tokens with the token introspection endpoint of Keycloak
+type Introspector struct {
+	URL           string
+	ClientID      string
+	ClientSecret  string
+	RequiredScope string
+	Client        *http.Client
+}
+
+// NewIntrospector creates an introspector for the auth provider, using https on port 443 by default
+func NewIntrospector(clientID, secret, host, port, scheme, requiredScope, tokenIntrospectPath string) *Introspector {
+	if scheme == "" {
+		scheme = "https"
+	}
+	if port == "" {
+		port = "443"
+	}
+
+	introspectURL := url.URL{
+		Scheme: scheme,
+		Host:   fmt.Sprintf("%s:%s", host, port),
+		Path:   tokenIntrospectPath,
+	}
+
+	return &Introspector{
+		URL:           introspectURL.String(),
+		ClientID:      clientID,
+		ClientSecret:  secret,
+		RequiredScope: requiredScope,
+		Client:        &http.Client{Timeout: introspectTimeout},
+	}
+}
+
+// Introspect verifies the bearer token of an Authorization header and returns its details. Only active tokens
+// with the required scope are valid.
+func (in *Introspector) Introspect(authorizationHeader string) (*TokenDetails, error) {
+	parts := strings.Split(authorizationHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" || parts[1] == "" {
+		return nil, ErrInvalidAuthorizationHeader
+	}
+
+	form := url.Values{"token": {parts[1]}}
+	req, err := http.NewRequest(http.MethodPost, in.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(in.ClientID, in.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := in.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error introspecting the token: %s", resp.Status)
+	}
+
+	td := TokenDetails{}
+	if err = json.NewDecoder(resp.Body).Decode(&td); err != nil {
+		return nil, fmt.Errorf("error decoding the introspected token: %v", err)
+	}
+
+	if !td.Active {
+		return nil, ErrInactiveToken
+	}
+	if in.RequiredScope != "" && !contains(td.Scopes(), in.RequiredScope) {
+		return nil, ErrMissingScope
+	}
+	return &td, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/service/manage"
+	"github.com/spf13/viper"
+)
+
+// ErrNoRoleMapping is returned when none of the role mappings match a valid token
+var ErrNoRoleMapping = errors.New("no role mapping matches the token")
+
+// userRoles are the names of the user roles in the role mappings
+var userRoles = map[string]int{
+	"standard":  datastore.Standard,
+	"admin":     datastore.Admin,
+	"superuser": datastore.Superuser,
+}
+
+// orgRoleRank orders the organization roles, a user that is mapped to several roles in an organization gets the highest
+var orgRoleRank = map[string]int{
+	datastore.OrgViewer:   1,
+	datastore.OrgOperator: 2,
+	datastore.OrgAdmin:    3,
+}
+
+// OrganizationRole is a role in an organization granted by a role mapping
+type OrganizationRole struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+}
+
+// RoleMapping grants a user role and organization roles to the tokens that have the scope, realm role or group.
+// A mapping that sets none of them matches no token.
+type RoleMapping struct {
+	Scope         string             `json:"scope"`
+	RealmRole     string             `json:"realmRole"`
+	Group         string             `json:"group"`
+	Role          string             `json:"role"`
+	Organizations []OrganizationRole `json:"organizations"`
+}
+
+// LoadRoleMappings reads and validates the role mappings of the configuration
+func LoadRoleMappings() ([]RoleMapping, error) {
+	mappings := []RoleMapping{}
+
+	// Environment variables can only hold the list as JSON
+	if raw, ok := viper.Get(keys.OAuth2RoleMappings).(string); ok {
+		if raw != "" {
+			if err := json.Unmarshal([]byte(raw), &mappings); err != nil {
+				return nil, fmt.Errorf("error parsing the role mappings: %v", err)
+			}
+		}
+	} else if err := viper.UnmarshalKey(keys.OAuth2RoleMappings, &mappings); err != nil {
+		return nil, fmt.Errorf("error parsing the role mappings: %v", err)
+	}
+
+	for _, m := range mappings {
+		if _, ok := userRoles[m.Role]; m.Role != "" && !ok {
+			return nil, fmt.Errorf("invalid role `%s` in the role mappings", m.Role)
+		}
+		for _, o := range m.Organizations {
+			if !manage.ValidOrgRole(o.Role) {
+				return nil, fmt.Errorf("invalid organization role `%s` in the role mappings", o.Role)
+			}
+		}
+	}
+	return mappings, nil
+}
+
+func (m RoleMapping) matches(td *TokenDetails) bool {
+	return (m.Scope != "" && contains(td.Scopes(), m.Scope)) ||
+		(m.RealmRole != "" && contains(td.RealmAccess.Roles, m.RealmRole)) ||
+		(m.Group != "" && contains(td.Groups, m.Group))
+}
+
+// ResolveRoles returns the highest user role and organization roles of the mappings that match the token.
+// A match that sets no user role grants the standard role.
+func ResolveRoles(mappings []RoleMapping, td *TokenDetails) (int, map[string]string, error) {
+	role := datastore.Invalid
+	orgRoles := map[string]string{}
+
+	for _, m := range mappings {
+		if !m.matches(td) {
+			continue
+		}
+
+		if r := userRoles[m.Role]; r > role {
+			role = r
+		} else if role == datastore.Invalid {
+			role = datastore.Standard
+		}
+
+		for _, o := range m.Organizations {
+			if orgRoleRank[o.Role] > orgRoleRank[orgRoles[o.ID]] {
+				orgRoles[o.ID] = o.Role
+			}
+		}
+	}
+
+	if role == datastore.Invalid {
+		return role, nil, ErrNoRoleMapping
+	}
+	return role, orgRoles, nil
+}
@@ -21,6 +21,8 @@
 package datastore
 
 import (
+	"time"
+
 	"github.com/everactive/dmscore/iot-management/datastore/models"
 	"github.com/juju/usso/openid"
 )
@@ -37,10 +39,30 @@ type DataStore interface {
 	OrgUserAccess(orgID, username string, role int) bool
 	OrganizationsForUser(username string) ([]Organization, error)
 	OrganizationForUserToggle(orgID, username string) error
+	OrgUserRole(orgID, username string) (string, error)
+	OrgUserRoleList(orgID string) ([]OrganizationUser, error)
+	OrgUserRoleSet(orgID, username, orgRole string) error
+	OrgUserRoleDelete(orgID, username string) error
 	OrganizationGet(orgIDOrName string) (Organization, error)
+	OrganizationList() ([]Organization, error)
 	OrganizationCreate(org Organization) error
 	OrganizationUpdate(org Organization) error
 
+	JobCreate(job Job) (int64, error)
+	JobGet(id int64) (Job, error)
+	JobList(orgID, status string) ([]Job, error)
+	JobUpdate(job Job) error
+
+	APITokenCreate(token APIToken) (int64, error)
+	APITokenGet(id int64) (APIToken, error)
+	APITokenGetByHash(tokenHash string) (APIToken, error)
+	APITokenList(owner string) ([]APIToken, error)
+	APITokenUsed(id int64, used time.Time) error
+	APITokenRevoke(id int64, revoked time.Time) error
+
+	AuditCreate(entry AuditEntry) (int64, error)
+	AuditList(filter AuditFilter) ([]AuditEntry, error)
+
 	GetSettings() ([]models.Setting, error)
 	Set(key string, value string) error
 }
@@ -41,8 +41,18 @@ type User struct {
 	Name     string
 	Email    string
 	Role     int
+	// Provider is what created the user. It is empty for the users created before it was recorded, and an empty
+	// provider leaves the provider of an updated user as it is.
+	Provider string
 }
 
+// The providers of users
+const (
+	UserProviderLocal    = "local"
+	UserProviderKeycloak = "keycloak"
+	UserProviderAPIToken = "api-token"
+)
+
 // OpenidNonceMaxAge is the maximum age of stored nonces. Any nonces older
 // than this will automatically be rejected. Stored nonces older
 // than this will periodically be purged from the database.
@@ -65,8 +75,144 @@ type Organization struct {
 	Name           string
 }
 
-// OrganizationUser holds links a user and organization
+// Available organization roles, bound to a user for each organization they are a member of:
+//
+// * OrgViewer:		role for users that can only view the devices of the organization
+// * OrgOperator:	role for users that can also manage the snaps on the devices
+// * OrgAdmin:		role for users that can also register, delete and move devices, and assign roles
+const (
+	OrgViewer   = "viewer"
+	OrgOperator = "operator"
+	OrgAdmin    = "org-admin"
+)
+
+// OrganizationUser holds links a user and organization, with the role of the user in the organization
 type OrganizationUser struct {
 	OrganizationID string
 	Username       string
+	Role           string
+}
+
+// Job is a multi-step operation on a device. Parameters holds the JSON encoded request that started it.
+type Job struct {
+	ID             int64
+	Created        time.Time
+	Modified       time.Time
+	Kind           string
+	OrganizationID string
+	DeviceID       string
+	Username       string
+	Status         string
+	Parameters     string
+	Steps          []JobStep
+}
+
+// JobStep is a step of a job, the steps run in order of their position
+type JobStep struct {
+	ID       int64
+	JobID    int64
+	Position int
+	Name     string
+	Status   string
+	Message  string
+	Started  *time.Time
+	Finished *time.Time
+	// Attempts is the number of times the step has failed and been retried
+	Attempts int
+	// RetryAt is when a failed step is retried
+	RetryAt *time.Time
+}
+
+// Available API token kinds: personal tokens act for the user that owns them and never have more permissions than
+// them, service tokens are created by superusers for automation
+const (
+	APITokenPersonal = "personal"
+	APITokenService  = "service"
+)
+
+// APIToken is a personal or service API token. Only the hash of the token is stored, the prefix identifies it.
+// The token acts as its own user, Username, with the role and the organization roles, by organization ID, it is
+// scoped to.
+type APIToken struct {
+	ID            int64
+	Created       time.Time
+	Name          string
+	Kind          string
+	Owner         string
+	Username      string
+	Prefix        string
+	TokenHash     string
+	Role          int
+	Organizations map[string]string
+	Expires       *time.Time
+	LastUsed      *time.Time
+	Revoked       *time.Time
+}
+
+// Available audit entry results
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// Available audit entry target types, the target is either a device or another entity the change is made to
+const (
+	AuditTargetDevice       = "device"
+	AuditTargetGroup        = "group"
+	AuditTargetOrganization = "organization"
+	AuditTargetUser         = "user"
+	AuditTargetToken        = "token"
+	AuditTargetAccountKey   = "account-key"
+	AuditTargetRule         = "rule"
+	AuditTargetEnrollment   = "enrollment-request"
+	AuditTargetModel        = "model"
+	AuditTargetJob          = "job"
+)
+
+// AuditEntry is an entry of the append-only audit log, recording a change requested by a user, the
+// organization and target of the change, a summary of the request with the secrets redacted, its result and
+// the ID of the action sent to the device, if any
+type AuditEntry struct {
+	ID             int64
+	Created        time.Time
+	Username       string
+	OrganizationID string
+	TargetType     string
+	Target         string
+	Action         string
+	Payload        string
+	Result         string
+	Message        string
+	ActionID       string
+}
+
+// AuditFilter selects audit entries, empty fields match any entry. Created is within From and To, when set, and
+// at most Limit entries are selected, when set, after skipping the first Offset of them
+type AuditFilter struct {
+	Username       string
+	OrganizationID string
+	TargetType     string
+	Target         string
+	Action         string
+	Result         string
+	From           time.Time
+	To             time.Time
+	Limit          int
+	Offset         int
+}
+
+// Matches checks if the audit entry is selected by the filter, ignoring the limit and offset
+func (f AuditFilter) Matches(entry AuditEntry) bool {
+	switch {
+	case len(f.Username) > 0 && entry.Username != f.Username,
+		len(f.OrganizationID) > 0 && entry.OrganizationID != f.OrganizationID,
+		len(f.TargetType) > 0 && entry.TargetType != f.TargetType,
+		len(f.Target) > 0 && entry.Target != f.Target,
+		len(f.Action) > 0 && entry.Action != f.Action,
+		len(f.Result) > 0 && entry.Result != f.Result,
+		!f.From.IsZero() && entry.Created.Before(f.From),
+		!f.To.IsZero() && entry.Created.After(f.To):
+		return false
+	}
+	return true
 }
@@ -0,0 +1,113 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package memory
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+// APITokenCreate stores an API token
+func (mem *Store) APITokenCreate(token datastore.APIToken) (int64, error) {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for _, t := range mem.APITokens {
+		if t.TokenHash == token.TokenHash || t.Username == token.Username {
+			return 0, fmt.Errorf("API token `%s` already exists", token.Prefix)
+		}
+	}
+
+	token.ID = int64(len(mem.APITokens) + 1)
+	token.Created = time.Now()
+	mem.APITokens = append(mem.APITokens, token)
+	return token.ID, nil
+}
+
+// APITokenGet fetches an API token
+func (mem *Store) APITokenGet(id int64) (datastore.APIToken, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	for _, t := range mem.APITokens {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return datastore.APIToken{}, fmt.Errorf("cannot find API token with ID `%d`", id)
+}
+
+// APITokenGetByHash fetches the API token with the hash
+func (mem *Store) APITokenGetByHash(tokenHash string) (datastore.APIToken, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	for _, t := range mem.APITokens {
+		if t.TokenHash == tokenHash {
+			return t, nil
+		}
+	}
+	return datastore.APIToken{}, fmt.Errorf("cannot find API token")
+}
+
+// APITokenList lists the API tokens, most recent first, optionally of an owner
+func (mem *Store) APITokenList(owner string) ([]datastore.APIToken, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	tokens := []datastore.APIToken{}
+	for i := len(mem.APITokens) - 1; i >= 0; i-- {
+		if len(owner) > 0 && mem.APITokens[i].Owner != owner {
+			continue
+		}
+		tokens = append(tokens, mem.APITokens[i])
+	}
+	return tokens, nil
+}
+
+// APITokenUsed records when an API token was last used
+func (mem *Store) APITokenUsed(id int64, used time.Time) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for i := range mem.APITokens {
+		if mem.APITokens[i].ID == id {
+			mem.APITokens[i].LastUsed = &used
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find API token with ID `%d`", id)
+}
+
+// APITokenRevoke revokes an API token, it is kept to show when it was revoked
+func (mem *Store) APITokenRevoke(id int64, revoked time.Time) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for i := range mem.APITokens {
+		if mem.APITokens[i].ID == id && mem.APITokens[i].Revoked == nil {
+			mem.APITokens[i].Revoked = &revoked
+			return nil
+		}
+	}
+	return fmt.Errorf("API token %d not found or already revoked", id)
+}
@@ -0,0 +1,71 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+func TestStore_APITokens(t *testing.T) {
+	mem := NewStore()
+
+	id, err := mem.APITokenCreate(datastore.APIToken{Name: "ci", Owner: "jamesj", Username: "token:a", TokenHash: "hash-a"})
+	if err != nil {
+		t.Fatalf("Store.APITokenCreate() error = %v", err)
+	}
+	_, _ = mem.APITokenCreate(datastore.APIToken{Name: "other", Owner: "sarahj", Username: "token:b", TokenHash: "hash-b"})
+	if _, err := mem.APITokenCreate(datastore.APIToken{Name: "copy", Owner: "jamesj", Username: "token:c", TokenHash: "hash-a"}); err == nil {
+		t.Error("Store.APITokenCreate() expected error for a duplicate hash")
+	}
+
+	got, err := mem.APITokenGetByHash("hash-a")
+	if err != nil || got.ID != id {
+		t.Errorf("Store.APITokenGetByHash() = %v, %v", got.ID, err)
+	}
+	if _, err := mem.APITokenGetByHash("invalid"); err == nil {
+		t.Error("Store.APITokenGetByHash() expected error for an unknown hash")
+	}
+
+	if tokens, _ := mem.APITokenList("jamesj"); len(tokens) != 1 {
+		t.Errorf("Store.APITokenList() = %v, want 1", len(tokens))
+	}
+	if tokens, _ := mem.APITokenList(""); len(tokens) != 2 || tokens[0].Name != "other" {
+		t.Errorf("Store.APITokenList() = %v, want 2 most recent first", tokens)
+	}
+
+	now := time.Now()
+	if err := mem.APITokenUsed(id, now); err != nil {
+		t.Errorf("Store.APITokenUsed() error = %v", err)
+	}
+	if err := mem.APITokenRevoke(id, now); err != nil {
+		t.Errorf("Store.APITokenRevoke() error = %v", err)
+	}
+	if err := mem.APITokenRevoke(id, now); err == nil {
+		t.Error("Store.APITokenRevoke() expected error for a revoked token")
+	}
+
+	got, _ = mem.APITokenGet(id)
+	if got.LastUsed == nil || got.Revoked == nil {
+		t.Errorf("Store.APITokenGet() = %v", got)
+	}
+}
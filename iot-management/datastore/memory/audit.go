@@ -0,0 +1,60 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package memory
+
+import (
+	"time"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+// AuditCreate appends an entry to the audit log
+func (mem *Store) AuditCreate(entry datastore.AuditEntry) (int64, error) {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	entry.ID = int64(len(mem.Audit) + 1)
+	entry.Created = time.Now()
+	mem.Audit = append(mem.Audit, entry)
+	return entry.ID, nil
+}
+
+// AuditList lists the audit entries selected by the filter, most recent first
+func (mem *Store) AuditList(filter datastore.AuditFilter) ([]datastore.AuditEntry, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	entries := []datastore.AuditEntry{}
+	skipped := 0
+	for i := len(mem.Audit) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) >= filter.Limit {
+			break
+		}
+		if !filter.Matches(mem.Audit[i]) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		entries = append(entries, mem.Audit[i])
+	}
+	return entries, nil
+}
@@ -0,0 +1,79 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+func TestStore_Audit(t *testing.T) {
+	mem := NewStore()
+
+	entries := []datastore.AuditEntry{
+		{Username: "jamesj", OrganizationID: "abc", TargetType: datastore.AuditTargetDevice, Target: "a111", Action: "snap.install", Result: datastore.AuditSuccess},
+		{Username: "jamesj", OrganizationID: "abc", TargetType: datastore.AuditTargetDevice, Target: "b222", Action: "device.delete", Result: datastore.AuditFailure},
+		{Username: "sarahj", OrganizationID: "def", TargetType: datastore.AuditTargetDevice, Target: "c333", Action: "snap.install", Result: datastore.AuditSuccess},
+	}
+	for _, e := range entries {
+		if _, err := mem.AuditCreate(e); err != nil {
+			t.Fatalf("Store.AuditCreate() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter datastore.AuditFilter
+		want   []string
+	}{
+		{"all", datastore.AuditFilter{}, []string{"c333", "b222", "a111"}},
+		{"user", datastore.AuditFilter{Username: "jamesj"}, []string{"b222", "a111"}},
+		{"organization and action", datastore.AuditFilter{OrganizationID: "abc", Action: "snap.install"}, []string{"a111"}},
+		{"device", datastore.AuditFilter{TargetType: datastore.AuditTargetDevice, Target: "c333"}, []string{"c333"}},
+		{"result", datastore.AuditFilter{Result: datastore.AuditFailure}, []string{"b222"}},
+		{"limit", datastore.AuditFilter{Limit: 2}, []string{"c333", "b222"}},
+		{"offset", datastore.AuditFilter{Limit: 1, Offset: 1}, []string{"b222"}},
+		{"offset filtered", datastore.AuditFilter{Username: "jamesj", Offset: 1}, []string{"a111"}},
+		{"from", datastore.AuditFilter{From: time.Now().Add(time.Hour)}, []string{}},
+		{"to", datastore.AuditFilter{To: time.Now().Add(-time.Hour)}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mem.AuditList(tt.filter)
+			if err != nil {
+				t.Fatalf("Store.AuditList() error = %v", err)
+			}
+			targets := []string{}
+			for _, e := range got {
+				targets = append(targets, e.Target)
+			}
+			if len(targets) != len(tt.want) {
+				t.Fatalf("Store.AuditList() = %v, want %v", targets, tt.want)
+			}
+			for i := range targets {
+				if targets[i] != tt.want[i] {
+					t.Errorf("Store.AuditList() = %v, want %v", targets, tt.want)
+				}
+			}
+		})
+	}
+}
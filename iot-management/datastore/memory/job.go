@@ -0,0 +1,114 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package memory
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+// JobCreate creates a job with its steps
+func (mem *Store) JobCreate(job datastore.Job) (int64, error) {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	job.ID = int64(len(mem.Jobs) + 1)
+	job.Created = time.Now()
+	job.Modified = job.Created
+
+	steps := []datastore.JobStep{}
+	for _, st := range job.Steps {
+		mem.lastJobStep++
+		st.ID = mem.lastJobStep
+		st.JobID = job.ID
+		steps = append(steps, st)
+	}
+	job.Steps = steps
+
+	mem.Jobs = append(mem.Jobs, job)
+	return job.ID, nil
+}
+
+// JobGet fetches a job with its steps
+func (mem *Store) JobGet(id int64) (datastore.Job, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	for _, j := range mem.Jobs {
+		if j.ID == id {
+			return copyJob(j), nil
+		}
+	}
+	return datastore.Job{}, fmt.Errorf("cannot find job with ID `%d`", id)
+}
+
+// JobList lists the jobs, most recent first, optionally of an organization and with a status
+func (mem *Store) JobList(orgID, status string) ([]datastore.Job, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	jobs := []datastore.Job{}
+	for i := len(mem.Jobs) - 1; i >= 0; i-- {
+		j := mem.Jobs[i]
+		if (len(orgID) > 0 && j.OrganizationID != orgID) || (len(status) > 0 && j.Status != status) {
+			continue
+		}
+		jobs = append(jobs, copyJob(j))
+	}
+	return jobs, nil
+}
+
+// JobUpdate stores the status and parameters of a job and the progress of its steps
+func (mem *Store) JobUpdate(job datastore.Job) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for i := range mem.Jobs {
+		if mem.Jobs[i].ID != job.ID {
+			continue
+		}
+
+		mem.Jobs[i].Status = job.Status
+		mem.Jobs[i].Parameters = job.Parameters
+		mem.Jobs[i].Modified = time.Now()
+		for _, st := range job.Steps {
+			for k := range mem.Jobs[i].Steps {
+				if mem.Jobs[i].Steps[k].ID == st.ID {
+					mem.Jobs[i].Steps[k].Status = st.Status
+					mem.Jobs[i].Steps[k].Message = st.Message
+					mem.Jobs[i].Steps[k].Started = st.Started
+					mem.Jobs[i].Steps[k].Finished = st.Finished
+					mem.Jobs[i].Steps[k].Attempts = st.Attempts
+					mem.Jobs[i].Steps[k].RetryAt = st.RetryAt
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("cannot find job with ID `%d`", job.ID)
+}
+
+// copyJob copies a job so that changes to its steps are not stored until the job is updated
+func copyJob(job datastore.Job) datastore.Job {
+	job.Steps = append([]datastore.JobStep{}, job.Steps...)
+	return job
+}
@@ -0,0 +1,98 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+func TestStore_Jobs(t *testing.T) {
+	mem := NewStore()
+
+	job := datastore.Job{Kind: "replace", OrganizationID: "abc", DeviceID: "a111", Status: "running", Steps: []datastore.JobStep{
+		{Position: 1, Name: "first", Status: "pending"},
+		{Position: 2, Name: "second", Status: "pending"},
+	}}
+	id, err := mem.JobCreate(job)
+	if err != nil {
+		t.Fatalf("Store.JobCreate() error = %v", err)
+	}
+	_, _ = mem.JobCreate(datastore.Job{Kind: "replace", OrganizationID: "def", Status: "waiting"})
+
+	got, err := mem.JobGet(id)
+	if err != nil {
+		t.Fatalf("Store.JobGet() error = %v", err)
+	}
+	if len(got.Steps) != 2 || got.Steps[0].JobID != id {
+		t.Fatalf("Store.JobGet() steps = %v", got.Steps)
+	}
+
+	// Changes are only stored by an update
+	now := time.Now()
+	got.Status = "waiting"
+	got.Parameters = `{"actionId":"1"}`
+	got.Steps[0].Status = "done"
+	got.Steps[0].Finished = &now
+	stored, _ := mem.JobGet(id)
+	if stored.Steps[0].Status != "pending" {
+		t.Errorf("Store.JobGet() step changed before the update = %v", stored.Steps[0].Status)
+	}
+
+	if err = mem.JobUpdate(got); err != nil {
+		t.Fatalf("Store.JobUpdate() error = %v", err)
+	}
+	stored, _ = mem.JobGet(id)
+	if stored.Status != "waiting" || stored.Parameters != got.Parameters || stored.Steps[0].Status != "done" || stored.Steps[0].Finished == nil {
+		t.Errorf("Store.JobUpdate() = %v, %v", stored.Status, stored.Steps[0])
+	}
+
+	tests := []struct {
+		name   string
+		orgID  string
+		status string
+		want   int
+	}{
+		{"all", "", "", 2},
+		{"organization", "abc", "", 1},
+		{"status", "", "waiting", 2},
+		{"organization-status", "def", "running", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := mem.JobList(tt.orgID, tt.status)
+			if err != nil {
+				t.Errorf("Store.JobList() error = %v", err)
+			}
+			if len(list) != tt.want {
+				t.Errorf("Store.JobList() = %v, want %v", len(list), tt.want)
+			}
+		})
+	}
+
+	if _, err = mem.JobGet(99); err == nil {
+		t.Error("Store.JobGet() expected error for an unknown job")
+	}
+	if err = mem.JobUpdate(datastore.Job{ID: 99}); err == nil {
+		t.Error("Store.JobUpdate() expected error for an unknown job")
+	}
+}
@@ -35,11 +35,16 @@ const (
 
 // Store implements an in-memory store for testing
 type Store struct {
-	lock     sync.RWMutex
-	Users    []datastore.User
-	Orgs     []datastore.Organization
-	OrgUsers []datastore.OrganizationUser
-	Settings map[string]string
+	lock      sync.RWMutex
+	Users     []datastore.User
+	Orgs      []datastore.Organization
+	OrgUsers  []datastore.OrganizationUser
+	Settings  map[string]string
+	Jobs      []datastore.Job
+	APITokens []datastore.APIToken
+	Audit     []datastore.AuditEntry
+
+	lastJobStep int64
 }
 
 // GetSettings gets all the settings from the DataStore
@@ -68,7 +73,7 @@ func NewStore() *Store {
 			{Username: "jamesj", Name: "JJ", Role: testRole},
 		},
 		Orgs:     []datastore.Organization{{OrganizationID: "abc", Name: "Example Org"}},
-		OrgUsers: []datastore.OrganizationUser{{OrganizationID: "abc", Username: "jamesj"}},
+		OrgUsers: []datastore.OrganizationUser{{OrganizationID: "abc", Username: "jamesj", Role: datastore.OrgAdmin}},
 		Settings: make(map[string]string),
 	}
 }
@@ -46,7 +46,7 @@ func (mem *Store) OrgUserAccess(orgID, username string, role int) bool {
 // OrganizationsForUser returns the organizations a user can access
 func (mem *Store) OrganizationsForUser(username string) ([]datastore.Organization, error) {
 	mem.lock.RLock()
-	defer mem.lock.RLock()
+	defer mem.lock.RUnlock()
 
 	orgs := []datastore.Organization{}
 
@@ -77,6 +77,14 @@ func (mem *Store) OrganizationGet(orgID string) (datastore.Organization, error)
 	return mem.organizationGet(orgID)
 }
 
+// OrganizationList lists all the organizations
+func (mem *Store) OrganizationList() ([]datastore.Organization, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	return append([]datastore.Organization{}, mem.Orgs...), nil
+}
+
 // organizationGet returns an organization without locking the store
 func (mem *Store) organizationGet(orgID string) (datastore.Organization, error) {
 	for _, o := range mem.Orgs {
@@ -165,6 +173,59 @@ func (mem *Store) addOrgUserAccess(orgID, username string) error {
 	mem.OrgUsers = append(mem.OrgUsers, datastore.OrganizationUser{
 		OrganizationID: orgID,
 		Username:       username,
+		Role:           datastore.OrgViewer,
 	})
 	return nil
 }
+
+// OrgUserRole fetches the role of a user in an organization
+func (mem *Store) OrgUserRole(orgID, username string) (string, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	for _, ou := range mem.OrgUsers {
+		if ou.OrganizationID == orgID && ou.Username == username {
+			return ou.Role, nil
+		}
+	}
+	return "", fmt.Errorf("user `%s` is not a member of the organization", username)
+}
+
+// OrgUserRoleList lists the members of an organization with their roles
+func (mem *Store) OrgUserRoleList(orgID string) ([]datastore.OrganizationUser, error) {
+	mem.lock.RLock()
+	defer mem.lock.RUnlock()
+
+	oo := []datastore.OrganizationUser{}
+	for _, ou := range mem.OrgUsers {
+		if ou.OrganizationID == orgID {
+			oo = append(oo, ou)
+		}
+	}
+	return oo, nil
+}
+
+// OrgUserRoleSet sets the role of a user in an organization, making them a member if they are not one
+func (mem *Store) OrgUserRoleSet(orgID, username, orgRole string) error {
+	mem.lock.Lock()
+	defer mem.lock.Unlock()
+
+	for i := range mem.OrgUsers {
+		if mem.OrgUsers[i].OrganizationID == orgID && mem.OrgUsers[i].Username == username {
+			mem.OrgUsers[i].Role = orgRole
+			return nil
+		}
+	}
+
+	mem.OrgUsers = append(mem.OrgUsers, datastore.OrganizationUser{
+		OrganizationID: orgID,
+		Username:       username,
+		Role:           orgRole,
+	})
+	return nil
+}
+
+// OrgUserRoleDelete removes a user from an organization
+func (mem *Store) OrgUserRoleDelete(orgID, username string) error {
+	return mem.removeOrgUserAccess(orgID, username)
+}
@@ -20,6 +20,7 @@
 package memory
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/everactive/dmscore/iot-management/datastore"
@@ -195,3 +196,45 @@ func TestStore_OrganizationForUserToggle(t *testing.T) {
 		})
 	}
 }
+
+func TestStore_OrgUserRole(t *testing.T) {
+	mem := NewStore()
+
+	orgRole, err := mem.OrgUserRole("abc", "jamesj")
+	if err != nil || orgRole != datastore.OrgAdmin {
+		t.Errorf("Store.OrgUserRole() = %v, %v, want %v", orgRole, err, datastore.OrgAdmin)
+	}
+	if _, err := mem.OrgUserRole("abc", "sarahj"); err == nil {
+		t.Error("Store.OrgUserRole() expected error for a user that is not a member")
+	}
+
+	// Setting the role of a user that is not a member adds them to the organization
+	if err := mem.OrgUserRoleSet("abc", "sarahj", datastore.OrgOperator); err != nil {
+		t.Fatalf("Store.OrgUserRoleSet() error = %v", err)
+	}
+	if err := mem.OrgUserRoleSet("abc", "jamesj", datastore.OrgViewer); err != nil {
+		t.Fatalf("Store.OrgUserRoleSet() error = %v", err)
+	}
+
+	members, err := mem.OrgUserRoleList("abc")
+	if err != nil {
+		t.Fatalf("Store.OrgUserRoleList() error = %v", err)
+	}
+	want := []datastore.OrganizationUser{
+		{OrganizationID: "abc", Username: "jamesj", Role: datastore.OrgViewer},
+		{OrganizationID: "abc", Username: "sarahj", Role: datastore.OrgOperator},
+	}
+	if !reflect.DeepEqual(members, want) {
+		t.Errorf("Store.OrgUserRoleList() = %v, want %v", members, want)
+	}
+
+	if err := mem.OrgUserRoleDelete("abc", "sarahj"); err != nil {
+		t.Errorf("Store.OrgUserRoleDelete() error = %v", err)
+	}
+	if err := mem.OrgUserRoleDelete("abc", "sarahj"); err == nil {
+		t.Error("Store.OrgUserRoleDelete() expected error for a user that is not a member")
+	}
+	if mem.OrgUserAccess("abc", "sarahj", datastore.Admin) {
+		t.Error("Store.OrgUserRoleDelete() the user can still access the organization")
+	}
+}
@@ -67,6 +67,9 @@ func (mem *Store) UserUpdate(user datastore.User) error {
 	for i, u := range mem.Users {
 		if u.Username == user.Username {
 			user.ID = u.ID
+			if len(user.Provider) == 0 {
+				user.Provider = u.Provider
+			}
 			index = i
 			break
 		}
@@ -0,0 +1,142 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package postgres
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/models"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+// APITokenCreate stores an API token
+func (s *Store) APITokenCreate(token datastore.APIToken) (int64, error) {
+	orgs, err := json.Marshal(token.Organizations)
+	if err != nil {
+		return 0, err
+	}
+
+	row := models.APIToken{
+		Name:          token.Name,
+		Kind:          token.Kind,
+		Owner:         token.Owner,
+		Username:      token.Username,
+		Prefix:        token.Prefix,
+		TokenHash:     token.TokenHash,
+		Role:          token.Role,
+		Organizations: string(orgs),
+		ExpiresAt:     token.Expires,
+	}
+	res := s.gormDB.Create(&row)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return int64(row.ID), nil
+}
+
+// APITokenGet fetches an API token
+func (s *Store) APITokenGet(id int64) (datastore.APIToken, error) {
+	row := models.APIToken{}
+	res := s.gormDB.First(&row, id)
+	if res.Error != nil {
+		return datastore.APIToken{}, res.Error
+	}
+	return apiTokenFromModel(row)
+}
+
+// APITokenGetByHash fetches the API token with the hash
+func (s *Store) APITokenGetByHash(tokenHash string) (datastore.APIToken, error) {
+	row := models.APIToken{}
+	res := s.gormDB.Where("token_hash = ?", tokenHash).First(&row)
+	if res.Error != nil {
+		return datastore.APIToken{}, res.Error
+	}
+	return apiTokenFromModel(row)
+}
+
+// APITokenList lists the API tokens, most recent first, optionally of an owner
+func (s *Store) APITokenList(owner string) ([]datastore.APIToken, error) {
+	tx := s.gormDB
+	if len(owner) > 0 {
+		tx = tx.Where("owner = ?", owner)
+	}
+
+	rows := []models.APIToken{}
+	res := tx.Order("created_at desc").Find(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	tokens := []datastore.APIToken{}
+	for _, r := range rows {
+		t, err := apiTokenFromModel(r)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// APITokenUsed records when an API token was last used
+func (s *Store) APITokenUsed(id int64, used time.Time) error {
+	res := s.gormDB.Model(&models.APIToken{}).Where("id = ?", id).Update("last_used_at", used)
+	return res.Error
+}
+
+// APITokenRevoke revokes an API token, it is kept to show when it was revoked
+func (s *Store) APITokenRevoke(id int64, revoked time.Time) error {
+	res := s.gormDB.Model(&models.APIToken{}).Where("id = ? and revoked_at is null", id).Update("revoked_at", revoked)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("API token %d not found or already revoked", id)
+	}
+	return nil
+}
+
+func apiTokenFromModel(row models.APIToken) (datastore.APIToken, error) {
+	orgs := map[string]string{}
+	if len(row.Organizations) > 0 {
+		if err := json.Unmarshal([]byte(row.Organizations), &orgs); err != nil {
+			return datastore.APIToken{}, err
+		}
+	}
+
+	return datastore.APIToken{
+		ID:            int64(row.ID),
+		Created:       row.CreatedAt,
+		Name:          row.Name,
+		Kind:          row.Kind,
+		Owner:         row.Owner,
+		Username:      row.Username,
+		Prefix:        row.Prefix,
+		TokenHash:     row.TokenHash,
+		Role:          row.Role,
+		Organizations: orgs,
+		Expires:       row.ExpiresAt,
+		LastUsed:      row.LastUsedAt,
+		Revoked:       row.RevokedAt,
+	}, nil
+}
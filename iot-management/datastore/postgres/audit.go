@@ -0,0 +1,99 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package postgres
+
+import (
+	"github.com/everactive/dmscore/models"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+// AuditCreate appends an entry to the audit log
+func (s *Store) AuditCreate(entry datastore.AuditEntry) (int64, error) {
+	row := models.AuditEntry{
+		Username:   entry.Username,
+		OrgID:      entry.OrganizationID,
+		TargetType: entry.TargetType,
+		Target:     entry.Target,
+		Action:     entry.Action,
+		Payload:    entry.Payload,
+		Result:     entry.Result,
+		Message:    entry.Message,
+		ActionID:   entry.ActionID,
+	}
+	res := s.gormDB.Create(&row)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return int64(row.ID), nil
+}
+
+// AuditList lists the audit entries selected by the filter, most recent first
+func (s *Store) AuditList(filter datastore.AuditFilter) ([]datastore.AuditEntry, error) {
+	tx := s.gormDB.Model(&models.AuditEntry{})
+	for column, value := range map[string]string{
+		"username":    filter.Username,
+		"org_id":      filter.OrganizationID,
+		"target_type": filter.TargetType,
+		"target":      filter.Target,
+		"action":      filter.Action,
+		"result":      filter.Result,
+	} {
+		if len(value) > 0 {
+			tx = tx.Where(column+" = ?", value)
+		}
+	}
+	if !filter.From.IsZero() {
+		tx = tx.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		tx = tx.Where("created_at <= ?", filter.To)
+	}
+	if filter.Limit > 0 {
+		tx = tx.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		tx = tx.Offset(filter.Offset)
+	}
+
+	rows := []models.AuditEntry{}
+	res := tx.Order("created_at desc, id desc").Find(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	entries := []datastore.AuditEntry{}
+	for _, r := range rows {
+		entries = append(entries, datastore.AuditEntry{
+			ID:             int64(r.ID),
+			Created:        r.CreatedAt,
+			Username:       r.Username,
+			OrganizationID: r.OrgID,
+			TargetType:     r.TargetType,
+			Target:         r.Target,
+			Action:         r.Action,
+			Payload:        r.Payload,
+			Result:         r.Result,
+			Message:        r.Message,
+			ActionID:       r.ActionID,
+		})
+	}
+	return entries, nil
+}
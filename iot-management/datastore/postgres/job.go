@@ -0,0 +1,152 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package postgres
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/everactive/dmscore/models"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+// JobCreate creates a job with its steps
+func (s *Store) JobCreate(job datastore.Job) (int64, error) {
+	row := models.Job{
+		Kind:       job.Kind,
+		OrgID:      job.OrganizationID,
+		DeviceID:   job.DeviceID,
+		Username:   job.Username,
+		Status:     job.Status,
+		Parameters: job.Parameters,
+	}
+	for _, st := range job.Steps {
+		row.Steps = append(row.Steps, models.JobStep{
+			Position: st.Position,
+			Name:     st.Name,
+			Status:   st.Status,
+			Message:  st.Message,
+		})
+	}
+
+	res := s.gormDB.Create(&row)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return int64(row.ID), nil
+}
+
+// JobGet fetches a job with its steps
+func (s *Store) JobGet(id int64) (datastore.Job, error) {
+	row := models.Job{}
+	res := s.gormDB.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).First(&row, id)
+	if res.Error != nil {
+		return datastore.Job{}, res.Error
+	}
+	return jobFromModel(row), nil
+}
+
+// JobList lists the jobs, most recent first, optionally of an organization and with a status
+func (s *Store) JobList(orgID, status string) ([]datastore.Job, error) {
+	tx := s.gormDB.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	})
+	if len(orgID) > 0 {
+		tx = tx.Where("org_id = ?", orgID)
+	}
+	if len(status) > 0 {
+		tx = tx.Where("status = ?", status)
+	}
+
+	rows := []models.Job{}
+	res := tx.Order("created_at desc").Find(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	jobs := []datastore.Job{}
+	for _, r := range rows {
+		jobs = append(jobs, jobFromModel(r))
+	}
+	return jobs, nil
+}
+
+// JobUpdate stores the status and parameters of a job and the progress of its steps
+func (s *Store) JobUpdate(job datastore.Job) error {
+	return s.gormDB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+			"status":     job.Status,
+			"parameters": job.Parameters,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+
+		for _, st := range job.Steps {
+			// The fields are selected so that a cleared message or time is stored too
+			res = tx.Model(&models.JobStep{}).
+				Where("id = ? AND job_id = ?", st.ID, job.ID).
+				Select("Status", "Message", "StartedAt", "FinishedAt", "Attempts", "RetryAt").
+				Updates(&models.JobStep{
+					Status:     st.Status,
+					Message:    st.Message,
+					StartedAt:  st.Started,
+					FinishedAt: st.Finished,
+					Attempts:   st.Attempts,
+					RetryAt:    st.RetryAt,
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+		return nil
+	})
+}
+
+func jobFromModel(row models.Job) datastore.Job {
+	job := datastore.Job{
+		ID:             int64(row.ID),
+		Created:        row.CreatedAt,
+		Modified:       row.UpdatedAt,
+		Kind:           row.Kind,
+		OrganizationID: row.OrgID,
+		DeviceID:       row.DeviceID,
+		Username:       row.Username,
+		Status:         row.Status,
+		Parameters:     row.Parameters,
+	}
+	for _, st := range row.Steps {
+		job.Steps = append(job.Steps, datastore.JobStep{
+			ID:       int64(st.ID),
+			JobID:    int64(st.JobID),
+			Position: st.Position,
+			Name:     st.Name,
+			Status:   st.Status,
+			Message:  st.Message,
+			Started:  st.StartedAt,
+			Finished: st.FinishedAt,
+			Attempts: st.Attempts,
+			RetryAt:  st.RetryAt,
+		})
+	}
+	return job
+}
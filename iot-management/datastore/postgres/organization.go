@@ -42,6 +42,24 @@ func (s *Store) OrganizationGet(orgIDOrName string) (datastore.Organization, err
 	}, nil
 }
 
+// OrganizationList lists all the organizations
+func (s *Store) OrganizationList() ([]datastore.Organization, error) {
+	orgs := []models.Organization{}
+	res := s.gormDB.Order("name").Find(&orgs)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	list := []datastore.Organization{}
+	for _, o := range orgs {
+		list = append(list, datastore.Organization{
+			OrganizationID: o.OrganizationID,
+			Name:           o.Name,
+		})
+	}
+	return list, nil
+}
+
 // OrgUserAccess checks if the user has permissions to access the organization
 func (s *Store) OrgUserAccess(orgID, username string, role int) bool {
 	// Superusers can access all accounts
@@ -115,6 +133,63 @@ func (s *Store) OrganizationForUserToggle(orgID, username string) error {
 	return nil
 }
 
+// OrgUserRole fetches the role of a user in an organization
+func (s *Store) OrgUserRole(orgID, username string) (string, error) {
+	var orgRole string
+	err := s.QueryRow(organizationUserRoleSQL, orgID, username).Scan(&orgRole)
+	if err != nil {
+		return "", fmt.Errorf("error finding the role of user `%s`: %v", username, err)
+	}
+	return orgRole, nil
+}
+
+// OrgUserRoleList lists the members of an organization with their roles
+func (s *Store) OrgUserRoleList(orgID string) ([]datastore.OrganizationUser, error) {
+	rows, err := s.Query(listOrganizationUserRolesSQL, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Error(err)
+		}
+	}()
+
+	oo := []datastore.OrganizationUser{}
+	for rows.Next() {
+		ou := datastore.OrganizationUser{}
+		if err := rows.Scan(&ou.OrganizationID, &ou.Username, &ou.Role); err != nil {
+			return nil, err
+		}
+		oo = append(oo, ou)
+	}
+	return oo, rows.Err()
+}
+
+// OrgUserRoleSet sets the role of a user in an organization, making them a member if they are not one
+func (s *Store) OrgUserRoleSet(orgID, username, orgRole string) error {
+	_, err := s.Exec(upsertOrganizationUserRoleSQL, orgID, username, orgRole)
+	return err
+}
+
+// OrgUserRoleDelete removes a user from an organization
+func (s *Store) OrgUserRoleDelete(orgID, username string) error {
+	result, err := s.Exec(deleteOrganizationUserAccessSQL, orgID, username)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("user `%s` is not a member of the organization", username)
+	}
+	return nil
+}
+
 func rowsToOrganizations(rows *sql.Rows) ([]datastore.Organization, error) {
 	orgs := []datastore.Organization{}
 
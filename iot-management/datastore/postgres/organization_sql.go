@@ -53,3 +53,21 @@ const createOrganizationUserAccessSQL = `
 	insert into organization_user (org_id, username)
 	values ($1, $2)
 `
+
+const organizationUserRoleSQL = `
+	select role from organization_user
+	where org_id=$1 and username=$2
+`
+
+const listOrganizationUserRolesSQL = `
+	select org_id, username, role
+	from organization_user
+	where org_id=$1
+	order by username
+`
+
+const upsertOrganizationUserRoleSQL = `
+	insert into organization_user (org_id, username, role)
+	values ($1, $2, $3)
+	on conflict (org_id, username) do update set role=$3
+`
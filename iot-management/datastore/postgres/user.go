@@ -31,7 +31,7 @@ import (
 func (s *Store) CreateUser(user datastore.User) (int64, error) {
 	var createdUserID int64
 
-	err := s.QueryRow(createUserSQL, user.Username, user.Name, user.Email, user.Role).Scan(&createdUserID)
+	err := s.QueryRow(createUserSQL, user.Username, user.Name, user.Email, user.Role, user.Provider).Scan(&createdUserID)
 	if err != nil {
 		log.Printf("Error creating user `%s`: %v\n", user.Username, err)
 	}
@@ -41,7 +41,7 @@ func (s *Store) CreateUser(user datastore.User) (int64, error) {
 
 // UserUpdate updates a user
 func (s *Store) UserUpdate(user datastore.User) error {
-	_, err := s.Exec(updateUserSQL, user.Username, user.Name, user.Email, user.Role)
+	_, err := s.Exec(updateUserSQL, user.Username, user.Name, user.Email, user.Role, user.Provider)
 	return err
 }
 
@@ -81,7 +81,7 @@ func (s *Store) GetUser(username string) (datastore.User, error) {
 
 func (s *Store) rowToUser(row *sql.Row) (datastore.User, error) {
 	user := datastore.User{}
-	err := row.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role)
+	err := row.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.Provider)
 	if err != nil {
 		return datastore.User{}, err
 	}
@@ -91,7 +91,7 @@ func (s *Store) rowToUser(row *sql.Row) (datastore.User, error) {
 
 func (s *Store) rowsToUser(rows *sql.Rows) (datastore.User, error) {
 	user := datastore.User{}
-	err := rows.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role)
+	err := rows.Scan(&user.ID, &user.Username, &user.Name, &user.Email, &user.Role, &user.Provider)
 	if err != nil {
 		return datastore.User{}, err
 	}
@@ -20,11 +20,11 @@
 // Package postgres provides the postgres based DataStore implementation
 package postgres
 
-const createUserSQL = "insert into userinfo (username, name, email, user_role) values ($1,$2,$3,$4) returning id"
-const listUsersSQL = "select id, username, name, email, user_role from userinfo order by username"
-const getUserSQL = "select id, username, name, email, user_role from userinfo where username=$1"
+const createUserSQL = "insert into userinfo (username, name, email, user_role, provider) values ($1,$2,$3,$4,$5) returning id"
+const listUsersSQL = "select id, username, name, email, user_role, provider from userinfo order by username"
+const getUserSQL = "select id, username, name, email, user_role, provider from userinfo where username=$1"
 const updateUserSQL = `
 update userinfo
-set name=$2, email=$3, user_role=$4
+set name=$2, email=$3, user_role=$4, provider=coalesce(nullif($5, ''), provider)
 where username=$1`
 const deleteUserSQL = "delete from userinfo where username=$1"
@@ -20,6 +20,11 @@
 // Package domain provides types specific to the management service
 package domain
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // User holds user personal, authentication and authorization info
 type User struct {
 	ID       int64  `json:"id"`
@@ -35,8 +40,173 @@ type Organization struct {
 	Name           string `json:"name"`
 }
 
+// OrganizationRole is the role of a user in an organization
+type OrganizationRole struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
 // OrganizationCreate holds details of the organization creation request
 type OrganizationCreate struct {
-	Name    string `json:"name"`
-	Country string `json:"country"`
+	Name     string `json:"name"`
+	Country  string `json:"country"`
+	RootCert string `json:"rootCert,omitempty"`
+	RootKey  string `json:"rootKey,omitempty"`
+}
+
+// DeviceTransferRequest is the request to move a device to another organization
+type DeviceTransferRequest struct {
+	OrganizationID string `json:"orgid"`
+}
+
+// DeviceTransfer is the record of a device moved between organizations, from the audit log, with the job that
+// moved it
+type DeviceTransfer struct {
+	ID                 int64     `json:"id"`
+	Created            time.Time `json:"created"`
+	DeviceID           string    `json:"deviceId"`
+	FromOrganizationID string    `json:"fromOrgId"`
+	ToOrganizationID   string    `json:"toOrgId"`
+	Username           string    `json:"username"`
+	JobID              int64     `json:"jobId"`
+}
+
+// DeletedDevice is a soft deleted device that can be restored. The groups are those the device was removed
+// from when it was decommissioned, and that it is linked to again when it is restored.
+type DeletedDevice struct {
+	DeviceID     string   `json:"deviceId"`
+	Brand        string   `json:"brand"`
+	Model        string   `json:"model"`
+	SerialNumber string   `json:"serial"`
+	Registration bool     `json:"registration"`
+	DeviceTwin   bool     `json:"deviceTwin"`
+	Groups       []string `json:"groups,omitempty"`
+}
+
+// RetentionReport is the data purged by the retention service, or that would be on a dry run. The device twins
+// and registrations are the soft deleted devices that are hard deleted, the device records are their snaps, service
+// statuses and versions, and the stale devices are the devices that are soft deleted.
+type RetentionReport struct {
+	DryRun          bool      `json:"dryRun"`
+	Created         time.Time `json:"created"`
+	Actions         int64     `json:"actions"`
+	ActionsArchived bool      `json:"actionsArchived"`
+	DeviceTwins     []string  `json:"deviceTwins"`
+	DeviceRecords   int64     `json:"deviceRecords"`
+	Registrations   []string  `json:"registrations"`
+	StaleDevices    []string  `json:"staleDevices"`
+}
+
+// Job kinds
+const (
+	JobKindReplace      = "replace"
+	JobKindDecommission = "decommission"
+	JobKindRegistration = "registration"
+	JobKindTransfer     = "transfer"
+)
+
+// Job and job step statuses
+const (
+	JobStatusRunning   = "running"
+	JobStatusWaiting   = "waiting"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+
+	JobStepPending = "pending"
+	JobStepWaiting = "waiting"
+	JobStepDone    = "done"
+	JobStepFailed  = "failed"
+	JobStepSkipped = "skipped"
+)
+
+// Job is a multi-step operation on a device, with the progress of each step. Result is the outcome of a job that
+// reports one, e.g. the devices of a bulk registration.
+type Job struct {
+	ID             int64           `json:"id"`
+	Created        time.Time       `json:"created"`
+	Modified       time.Time       `json:"modified"`
+	Kind           string          `json:"kind"`
+	OrganizationID string          `json:"orgid"`
+	DeviceID       string          `json:"deviceId"`
+	Username       string          `json:"username"`
+	Status         string          `json:"status"`
+	Steps          []JobStep       `json:"steps"`
+	Result         json.RawMessage `json:"result,omitempty"`
+}
+
+// JobStep is a step of a job
+type JobStep struct {
+	Name     string     `json:"name"`
+	Status   string     `json:"status"`
+	Message  string     `json:"message,omitempty"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Attempts int        `json:"attempts,omitempty"`
+	RetryAt  *time.Time `json:"retryAt,omitempty"`
+}
+
+// DeviceReplaceRequest is the request to replace a device with a new unit
+type DeviceReplaceRequest struct {
+	DeviceID string `json:"deviceId"`
+}
+
+// APITokenOrganization is an organization an API token is scoped to, with its role in the organization
+type APITokenOrganization struct {
+	OrganizationID string `json:"orgid"`
+	Role           string `json:"role"`
+}
+
+// APITokenRequest is the request to create an API token. A zero role is the role of the user that creates it, up
+// to admin, and zero expiry days use the configured expiry.
+type APITokenRequest struct {
+	Name          string                 `json:"name"`
+	Kind          string                 `json:"kind"`
+	Role          int                    `json:"role"`
+	Organizations []APITokenOrganization `json:"organizations"`
+	ExpiresDays   int                    `json:"expiresDays"`
+}
+
+// APIToken is a personal or service API token. The token itself is only returned when it is created.
+type APIToken struct {
+	ID            int64                  `json:"id"`
+	Created       time.Time              `json:"created"`
+	Name          string                 `json:"name"`
+	Kind          string                 `json:"kind"`
+	Owner         string                 `json:"owner"`
+	Username      string                 `json:"username"`
+	Prefix        string                 `json:"prefix"`
+	Role          int                    `json:"role"`
+	Organizations []APITokenOrganization `json:"organizations"`
+	Expires       *time.Time             `json:"expires,omitempty"`
+	LastUsed      *time.Time             `json:"lastUsed,omitempty"`
+	Revoked       *time.Time             `json:"revoked,omitempty"`
+}
+
+// AuditEntry is an entry of the audit log of the changes requested by users
+type AuditEntry struct {
+	ID             int64     `json:"id"`
+	Created        time.Time `json:"created"`
+	Username       string    `json:"username"`
+	OrganizationID string    `json:"orgid"`
+	TargetType     string    `json:"targetType"`
+	Target         string    `json:"target"`
+	Action         string    `json:"action"`
+	Payload        string    `json:"payload"`
+	Result         string    `json:"result"`
+	Message        string    `json:"message,omitempty"`
+	ActionID       string    `json:"actionId,omitempty"`
+}
+
+// AuditFilter selects the audit entries to list, empty fields match any entry
+type AuditFilter struct {
+	Username       string
+	OrganizationID string
+	TargetType     string
+	Target         string
+	Action         string
+	Result         string
+	From           time.Time
+	To             time.Time
+	Limit          int
+	Offset         int
 }
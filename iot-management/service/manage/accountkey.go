@@ -0,0 +1,58 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+// AccountKeyList fetches the account keys trusted for auto-registration, with their refresh status
+func (srv *Management) AccountKeyList() ([]iddomain.AccountKey, error) {
+	return srv.Identity.AccountKeyList()
+}
+
+// AccountKeyAdd uploads account-key assertions to trust for auto-registration
+func (srv *Management) AccountKeyAdd(username string, assertions []byte) ([]iddomain.AccountKey, error) {
+	accountKeys, err := srv.Identity.AccountKeyAdd(assertions)
+
+	signKeyIDs := []string{}
+	for _, k := range accountKeys {
+		signKeyIDs = append(signKeyIDs, k.SignKeyID)
+	}
+	entry := auditEntry(username, "", datastore.AuditTargetAccountKey, "", "account-key.add")
+	srv.audit(entry, map[string]interface{}{"bytes": len(assertions), "signKeyIds": signKeyIDs}, err)
+
+	return accountKeys, err
+}
+
+// AccountKeyDelete stops trusting an account key for auto-registration
+func (srv *Management) AccountKeyDelete(username, signKeyID string) error {
+	err := srv.Identity.AccountKeyDelete(signKeyID)
+	srv.audit(auditEntry(username, "", datastore.AuditTargetAccountKey, signKeyID, "account-key.delete"), nil, err)
+	return err
+}
+
+// AccountKeysRefresh reloads the account keys from the files and the store
+func (srv *Management) AccountKeysRefresh(username string) error {
+	err := srv.Identity.RefreshAccountKeys()
+	srv.audit(auditEntry(username, "", datastore.AuditTargetAccountKey, "", "account-key.refresh"), nil, err)
+	return err
+}
@@ -0,0 +1,127 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"errors"
+	"testing"
+
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service/mocks"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+)
+
+func TestManagement_AccountKeyList(t *testing.T) {
+	tests := []struct {
+		name        string
+		identityErr error
+		want        int
+		wantErr     bool
+	}{
+		{"valid", nil, 1, false},
+		{"invalid", errors.New("MOCK error list"), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			var keys []iddomain.AccountKey
+			if tt.identityErr == nil {
+				keys = []iddomain.AccountKey{{SignKeyID: "key1", AccountID: "acc1", Source: iddomain.AccountKeySourceAPI, Active: true}}
+			}
+			identityMock.On("AccountKeyList").Return(keys, tt.identityErr)
+
+			srv := Management{DS: memory.NewStore(), Identity: identityMock}
+			got, err := srv.AccountKeyList()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Management.AccountKeyList() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.want {
+				t.Errorf("Management.AccountKeyList() = %v, want %v", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestManagement_AccountKeyAdd(t *testing.T) {
+	tests := []struct {
+		name        string
+		identityErr error
+		wantErr     bool
+	}{
+		{"valid", nil, false},
+		{"invalid", errors.New("MOCK error add"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("AccountKeyAdd", []byte("ASSERTIONS")).Return([]iddomain.AccountKey{}, tt.identityErr)
+
+			srv := Management{DS: memory.NewStore(), Identity: identityMock}
+			if _, err := srv.AccountKeyAdd("jamesj", []byte("ASSERTIONS")); (err != nil) != tt.wantErr {
+				t.Errorf("Management.AccountKeyAdd() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagement_AccountKeyDelete(t *testing.T) {
+	tests := []struct {
+		name        string
+		identityErr error
+		wantErr     bool
+	}{
+		{"valid", nil, false},
+		{"invalid", errors.New("MOCK error delete"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("AccountKeyDelete", "key1").Return(tt.identityErr)
+
+			srv := Management{DS: memory.NewStore(), Identity: identityMock}
+			if err := srv.AccountKeyDelete("jamesj", "key1"); (err != nil) != tt.wantErr {
+				t.Errorf("Management.AccountKeyDelete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagement_AccountKeysRefresh(t *testing.T) {
+	tests := []struct {
+		name        string
+		identityErr error
+		wantErr     bool
+	}{
+		{"valid", nil, false},
+		{"invalid", errors.New("MOCK error refresh"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("RefreshAccountKeys").Return(tt.identityErr)
+
+			srv := Management{DS: memory.NewStore(), Identity: identityMock}
+			if err := srv.AccountKeysRefresh("jamesj"); (err != nil) != tt.wantErr {
+				t.Errorf("Management.AccountKeysRefresh() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/spf13/viper"
+)
+
+const (
+	// apiTokenPrefix starts every API token, so they are recognizable e.g. by secret scanners
+	apiTokenPrefix = "dms_"
+	// apiTokenUserPrefix starts the name of the user an API token acts as
+	apiTokenUserPrefix = "token:"
+	apiTokenBytes      = 20
+	apiTokenPrefixLen  = 12
+	// apiTokenSyncInterval is how often the last use and the roles of the user of an API token are updated
+	apiTokenSyncInterval = time.Minute
+)
+
+// ErrInvalidAPIToken is returned for API tokens that are unknown, expired or revoked
+var ErrInvalidAPIToken = errors.New("the API token is invalid, expired or revoked")
+
+// APITokenList lists the API tokens of a user, superusers see all of them
+func (srv *Management) APITokenList(username string, role int) ([]domain.APIToken, error) {
+	owner := username
+	if role == datastore.Superuser {
+		owner = ""
+	}
+
+	tokens, err := srv.DS.APITokenList(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []domain.APIToken{}
+	for _, t := range tokens {
+		list = append(list, apiTokenToDomain(t))
+	}
+	return list, nil
+}
+
+// APITokenCreate creates a personal or service API token scoped to a role and organization roles. Personal
+// tokens cannot have more permissions than the user that creates them, and only superusers create service tokens.
+// The token is only returned here, only its hash is stored.
+func (srv *Management) APITokenCreate(username string, role int, req domain.APITokenRequest) (result domain.APIToken, secret string, err error) {
+	entry := auditEntry(username, "", datastore.AuditTargetToken, "", "token.create")
+	defer func() {
+		if result.ID > 0 {
+			entry.Target = strconv.FormatInt(result.ID, 10)
+		}
+		srv.audit(entry, req, err)
+	}()
+
+	// API tokens cannot create other tokens
+	if strings.HasPrefix(username, apiTokenUserPrefix) {
+		return domain.APIToken{}, "", NotAuthorizedErr
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return domain.APIToken{}, "", fmt.Errorf("the name of the API token is required")
+	}
+
+	switch req.Kind {
+	case "", datastore.APITokenPersonal:
+		req.Kind = datastore.APITokenPersonal
+	case datastore.APITokenService:
+		if role != datastore.Superuser {
+			return domain.APIToken{}, "", NotAuthorizedErr
+		}
+	default:
+		return domain.APIToken{}, "", fmt.Errorf("invalid API token kind `%s`", req.Kind)
+	}
+
+	if req.Role == 0 {
+		req.Role = role
+		if req.Role > datastore.Admin {
+			req.Role = datastore.Admin
+		}
+	}
+	if req.Role != datastore.Standard && req.Role != datastore.Admin && req.Role != datastore.Superuser {
+		return domain.APIToken{}, "", fmt.Errorf("invalid API token role `%d`", req.Role)
+	}
+	if req.Role > role {
+		return domain.APIToken{}, "", NotAuthorizedErr
+	}
+
+	orgRoles, err := srv.apiTokenOrganizations(username, role, req.Organizations)
+	if err != nil {
+		return domain.APIToken{}, "", err
+	}
+
+	days := req.ExpiresDays
+	if days == 0 {
+		days = viper.GetInt(keys.APITokenExpiryDays)
+	}
+	if days < 0 {
+		return domain.APIToken{}, "", fmt.Errorf("invalid API token expiry `%d` days", days)
+	}
+
+	secret, err = generateAPIToken()
+	if err != nil {
+		return domain.APIToken{}, "", err
+	}
+	prefix := secret[:len(apiTokenPrefix)+apiTokenPrefixLen]
+
+	token := datastore.APIToken{
+		Name:          req.Name,
+		Kind:          req.Kind,
+		Owner:         username,
+		Username:      apiTokenUserPrefix + strings.TrimPrefix(prefix, apiTokenPrefix),
+		Prefix:        prefix,
+		TokenHash:     hashAPIToken(secret),
+		Role:          req.Role,
+		Organizations: orgRoles,
+	}
+	if days > 0 {
+		expires := time.Now().AddDate(0, 0, days)
+		token.Expires = &expires
+	}
+
+	// The user of the token is created with its roles when it is first used
+	if token.ID, err = srv.DS.APITokenCreate(token); err != nil {
+		return domain.APIToken{}, "", err
+	}
+	token.Created = time.Now()
+	return apiTokenToDomain(token), secret, nil
+}
+
+// APITokenRevoke revokes an API token of the user, superusers can revoke any of them. The user of the token
+// is removed.
+func (srv *Management) APITokenRevoke(username string, role int, id int64) (err error) {
+	entry := auditEntry(username, "", datastore.AuditTargetToken, strconv.FormatInt(id, 10), "token.revoke")
+	defer func() { srv.audit(entry, nil, err) }()
+
+	token, err := srv.DS.APITokenGet(id)
+	if err != nil {
+		return err
+	}
+	if token.Owner != username && role != datastore.Superuser {
+		return NotAuthorizedErr
+	}
+
+	if err = srv.DS.APITokenRevoke(id, time.Now()); err != nil {
+		return err
+	}
+
+	// Drop the organization roles of the user of the token before removing it
+	if err = srv.UserSync(datastore.UserProviderAPIToken, domain.User{Username: token.Username, Name: token.Name, Role: datastore.Invalid}, nil); err != nil {
+		return err
+	}
+	return srv.DS.UserDelete(token.Username)
+}
+
+// APITokenVerify checks an API token and returns the user it acts as, with the role it is scoped to. The roles of
+// a personal token are capped by the current roles of its owner.
+func (srv *Management) APITokenVerify(secret string) (domain.User, error) {
+	if !strings.HasPrefix(secret, apiTokenPrefix) {
+		return domain.User{}, ErrInvalidAPIToken
+	}
+
+	token, err := srv.DS.APITokenGetByHash(hashAPIToken(secret))
+	if err != nil {
+		return domain.User{}, ErrInvalidAPIToken
+	}
+
+	now := time.Now()
+	if token.Revoked != nil || (token.Expires != nil && now.After(*token.Expires)) {
+		return domain.User{}, ErrInvalidAPIToken
+	}
+
+	user := domain.User{Username: token.Username, Name: token.Name, Role: token.Role}
+	orgRoles := token.Organizations
+	if token.Kind == datastore.APITokenPersonal {
+		if user.Role, orgRoles, err = srv.personalAPITokenRoles(token); err != nil {
+			return domain.User{}, ErrInvalidAPIToken
+		}
+	}
+
+	if token.LastUsed == nil || now.Sub(*token.LastUsed) > apiTokenSyncInterval {
+		if err = srv.UserSync(datastore.UserProviderAPIToken, user, orgRoles); err != nil {
+			return domain.User{}, err
+		}
+		if err = srv.DS.APITokenUsed(token.ID, now); err != nil {
+			return domain.User{}, err
+		}
+	}
+	return user, nil
+}
+
+// apiTokenOrganizations checks the organization roles of a new API token. Users other than superusers can only
+// give a personal token the roles they have themselves.
+func (srv *Management) apiTokenOrganizations(username string, role int, orgs []domain.APITokenOrganization) (map[string]string, error) {
+	orgRoles := map[string]string{}
+	for _, o := range orgs {
+		if !ValidOrgRole(o.Role) {
+			return nil, fmt.Errorf("invalid organization role `%s`", o.Role)
+		}
+
+		org, err := srv.DS.OrganizationGet(o.OrganizationID)
+		if err != nil || org.OrganizationID != o.OrganizationID {
+			return nil, fmt.Errorf("organization not found: %s", o.OrganizationID)
+		}
+
+		if role != datastore.Superuser {
+			userRole, err := srv.DS.OrgUserRole(o.OrganizationID, username)
+			if err != nil || !orgRoleCovers(userRole, o.Role) {
+				return nil, NotAuthorizedErr
+			}
+		}
+		orgRoles[o.OrganizationID] = o.Role
+	}
+	return orgRoles, nil
+}
+
+// personalAPITokenRoles returns the roles of a personal token, lowered to the current roles of its owner
+func (srv *Management) personalAPITokenRoles(token datastore.APIToken) (int, map[string]string, error) {
+	owner, err := srv.DS.GetUser(token.Owner)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	role := token.Role
+	if owner.Role < role {
+		role = owner.Role
+	}
+
+	orgRoles := map[string]string{}
+	for orgID, orgRole := range token.Organizations {
+		if owner.Role == datastore.Superuser {
+			orgRoles[orgID] = orgRole
+			continue
+		}
+
+		ownerRole, err := srv.DS.OrgUserRole(orgID, token.Owner)
+		if err != nil {
+			continue
+		}
+		if orgRoleCovers(ownerRole, orgRole) {
+			orgRoles[orgID] = orgRole
+		} else {
+			orgRoles[orgID] = ownerRole
+		}
+	}
+	return role, orgRoles, nil
+}
+
+func generateAPIToken() (string, error) {
+	b := make([]byte, apiTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + hex.EncodeToString(b), nil
+}
+
+func hashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func apiTokenToDomain(token datastore.APIToken) domain.APIToken {
+	t := domain.APIToken{
+		ID:            token.ID,
+		Created:       token.Created,
+		Name:          token.Name,
+		Kind:          token.Kind,
+		Owner:         token.Owner,
+		Username:      token.Username,
+		Prefix:        token.Prefix,
+		Role:          token.Role,
+		Organizations: []domain.APITokenOrganization{},
+		Expires:       token.Expires,
+		LastUsed:      token.LastUsed,
+		Revoked:       token.Revoked,
+	}
+	for orgID, orgRole := range token.Organizations {
+		t.Organizations = append(t.Organizations, domain.APITokenOrganization{OrganizationID: orgID, Role: orgRole})
+	}
+	sort.Slice(t.Organizations, func(i, j int) bool {
+		return t.Organizations[i].OrganizationID < t.Organizations[j].OrganizationID
+	})
+	return t
+}
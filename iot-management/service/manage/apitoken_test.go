@@ -0,0 +1,168 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManagement_APITokenCreate(t *testing.T) {
+	type args struct {
+		username string
+		role     int
+		req      domain.APITokenRequest
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantRole int
+		wantErr  bool
+	}{
+		{"valid-personal", args{"jamesj", datastore.Admin, domain.APITokenRequest{Name: "laptop", Organizations: []domain.APITokenOrganization{{OrganizationID: "abc", Role: datastore.OrgOperator}}}}, datastore.Admin, false},
+		{"valid-personal-superuser", args{"jamesj", datastore.Superuser, domain.APITokenRequest{Name: "laptop"}}, datastore.Admin, false},
+		{"valid-service", args{"jamesj", datastore.Superuser, domain.APITokenRequest{Name: "ci", Kind: "service", Role: datastore.Superuser, ExpiresDays: 30}}, datastore.Superuser, false},
+		{"invalid-name", args{"jamesj", datastore.Admin, domain.APITokenRequest{}}, 0, true},
+		{"invalid-kind", args{"jamesj", datastore.Admin, domain.APITokenRequest{Name: "ci", Kind: "robot"}}, 0, true},
+		{"invalid-service", args{"jamesj", datastore.Admin, domain.APITokenRequest{Name: "ci", Kind: "service"}}, 0, true},
+		{"invalid-role", args{"jamesj", datastore.Admin, domain.APITokenRequest{Name: "ci", Role: 150}}, 0, true},
+		{"invalid-role-higher", args{"jamesj", datastore.Admin, domain.APITokenRequest{Name: "ci", Role: datastore.Superuser}}, 0, true},
+		{"invalid-org", args{"jamesj", datastore.Admin, domain.APITokenRequest{Name: "ci", Organizations: []domain.APITokenOrganization{{OrganizationID: "invalid", Role: datastore.OrgViewer}}}}, 0, true},
+		{"invalid-org-role", args{"jamesj", datastore.Admin, domain.APITokenRequest{Name: "ci", Organizations: []domain.APITokenOrganization{{OrganizationID: "abc", Role: "owner"}}}}, 0, true},
+		{"invalid-org-access", args{"sarahj", datastore.Admin, domain.APITokenRequest{Name: "ci", Organizations: []domain.APITokenOrganization{{OrganizationID: "abc", Role: datastore.OrgViewer}}}}, 0, true},
+		{"invalid-expiry", args{"jamesj", datastore.Admin, domain.APITokenRequest{Name: "ci", ExpiresDays: -1}}, 0, true},
+		{"invalid-token-user", args{"token:abc", datastore.Admin, domain.APITokenRequest{Name: "ci"}}, 0, true},
+	}
+	viper.Set(keys.APITokenExpiryDays, 90)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewStore()
+			srv := Management{DS: db}
+
+			got, secret, err := srv.APITokenCreate(tt.args.username, tt.args.role, tt.args.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Management.APITokenCreate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			assert.Equal(t, tt.wantRole, got.Role)
+			assert.True(t, strings.HasPrefix(secret, got.Prefix))
+			assert.Len(t, got.Organizations, len(tt.args.req.Organizations))
+			assert.NotNil(t, got.Expires)
+
+			// Only the hash of the token is stored
+			stored, _ := db.APITokenGet(got.ID)
+			assert.NotEqual(t, secret, stored.TokenHash)
+			assert.Equal(t, hashAPIToken(secret), stored.TokenHash)
+		})
+	}
+}
+
+func TestManagement_APITokenVerify(t *testing.T) {
+	db := memory.NewStore()
+	srv := Management{DS: db}
+
+	token, secret, err := srv.APITokenCreate("jamesj", datastore.Superuser, domain.APITokenRequest{
+		Name:          "laptop",
+		Role:          datastore.Admin,
+		Organizations: []domain.APITokenOrganization{{OrganizationID: "abc", Role: datastore.OrgAdmin}},
+	})
+	if err != nil {
+		t.Fatalf("Management.APITokenCreate() error = %v", err)
+	}
+
+	user, err := srv.APITokenVerify(secret)
+	assert.Nil(t, err)
+	assert.Equal(t, token.Username, user.Username)
+	assert.Equal(t, datastore.Admin, user.Role)
+
+	// The token acts as its own user, scoped to its organization roles
+	assert.True(t, srv.orgAccess("abc", user.Username, user.Role, PermissionAdminister))
+	stored, _ := db.APITokenGet(token.ID)
+	assert.NotNil(t, stored.LastUsed)
+
+	// A personal token is capped by the current roles of its owner
+	_ = db.UserUpdate(datastore.User{Username: "jamesj", Name: "JJ", Role: datastore.Standard})
+	_ = db.OrgUserRoleSet("abc", "jamesj", datastore.OrgViewer)
+	_ = db.APITokenUsed(token.ID, time.Now().Add(-2*apiTokenSyncInterval))
+	user, err = srv.APITokenVerify(secret)
+	assert.Nil(t, err)
+	assert.Equal(t, datastore.Standard, user.Role)
+	assert.False(t, srv.orgAccess("abc", user.Username, user.Role, PermissionOperate))
+	assert.True(t, srv.orgAccess("abc", user.Username, user.Role, PermissionView))
+
+	_, err = srv.APITokenVerify("dms_unknown")
+	assert.Equal(t, ErrInvalidAPIToken, err)
+	_, err = srv.APITokenVerify(strings.TrimPrefix(secret, apiTokenPrefix))
+	assert.Equal(t, ErrInvalidAPIToken, err)
+
+	// Expired tokens are rejected
+	expired, _ := db.APITokenGet(token.ID)
+	past := time.Now().Add(-time.Hour)
+	expired.Expires = &past
+	expired.TokenHash = hashAPIToken("dms_expired")
+	expired.Username = "token:expired"
+	_, _ = db.APITokenCreate(expired)
+	_, err = srv.APITokenVerify("dms_expired")
+	assert.Equal(t, ErrInvalidAPIToken, err)
+}
+
+func TestManagement_APITokenRevoke(t *testing.T) {
+	db := memory.NewStore()
+	srv := Management{DS: db}
+
+	token, secret, err := srv.APITokenCreate("jamesj", datastore.Admin, domain.APITokenRequest{
+		Name:          "laptop",
+		Organizations: []domain.APITokenOrganization{{OrganizationID: "abc", Role: datastore.OrgViewer}},
+	})
+	if err != nil {
+		t.Fatalf("Management.APITokenCreate() error = %v", err)
+	}
+	_, _ = srv.APITokenVerify(secret)
+
+	assert.Equal(t, NotAuthorizedErr, srv.APITokenRevoke("sarahj", datastore.Admin, token.ID))
+	assert.Nil(t, srv.APITokenRevoke("jamesj", datastore.Admin, token.ID))
+	assert.NotNil(t, srv.APITokenRevoke("jamesj", datastore.Admin, token.ID))
+
+	_, err = srv.APITokenVerify(secret)
+	assert.Equal(t, ErrInvalidAPIToken, err)
+	assert.False(t, db.OrgUserAccess("abc", token.Username, datastore.Admin))
+	_, err = db.GetUser(token.Username)
+	assert.NotNil(t, err)
+
+	tokens, _ := srv.APITokenList("jamesj", datastore.Admin)
+	assert.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].Revoked)
+	tokens, _ = srv.APITokenList("sarahj", datastore.Admin)
+	assert.Len(t, tokens, 0)
+	tokens, _ = srv.APITokenList("sarahj", datastore.Superuser)
+	assert.Len(t, tokens, 1)
+}
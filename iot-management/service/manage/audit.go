@@ -0,0 +1,269 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	log "github.com/sirupsen/logrus"
+)
+
+// AuditSystemUser is the user of the changes the service makes itself, like purging old data
+const AuditSystemUser = "system"
+
+const (
+	auditRedacted = "[REDACTED]"
+	// auditMaxValue and auditMaxPayload are the lengths the values and the payload summary are truncated to
+	auditMaxValue   = 256
+	auditMaxPayload = 4096
+	// auditListLimit is the most audit entries listed at once
+	auditListLimit = 10000
+)
+
+// auditSecretKeys are the parts of the payload keys, lower case and without separators, with a secret value
+var auditSecretKeys = []string{"password", "passwd", "passphrase", "secret", "token", "credential", "key", "auth", "signature"}
+
+// AuditList lists the audit entries selected by the filter, most recent first. Superusers see all the entries,
+// other users the entries of an organization they administer.
+func (srv *Management) AuditList(username string, role int, filter domain.AuditFilter) ([]domain.AuditEntry, error) {
+	if role != datastore.Superuser {
+		if len(filter.OrganizationID) == 0 || !srv.orgAccess(filter.OrganizationID, username, role, PermissionAdminister) {
+			return nil, NotAuthorizedErr
+		}
+	}
+
+	if filter.Limit <= 0 || filter.Limit > auditListLimit {
+		filter.Limit = auditListLimit
+	}
+
+	entries, err := srv.DS.AuditList(datastore.AuditFilter{
+		Username:       filter.Username,
+		OrganizationID: filter.OrganizationID,
+		TargetType:     filter.TargetType,
+		Target:         filter.Target,
+		Action:         filter.Action,
+		Result:         filter.Result,
+		From:           filter.From,
+		To:             filter.To,
+		Limit:          filter.Limit,
+		Offset:         filter.Offset,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := []domain.AuditEntry{}
+	for _, e := range entries {
+		list = append(list, domain.AuditEntry{
+			ID:             e.ID,
+			Created:        e.Created,
+			Username:       e.Username,
+			OrganizationID: e.OrganizationID,
+			TargetType:     e.TargetType,
+			Target:         e.Target,
+			Action:         e.Action,
+			Payload:        e.Payload,
+			Result:         e.Result,
+			Message:        e.Message,
+			ActionID:       e.ActionID,
+		})
+	}
+	return list, nil
+}
+
+// auditEntry starts the audit entry of a change requested by a user to a target in an organization
+func auditEntry(username, orgID, targetType, target, action string) datastore.AuditEntry {
+	return datastore.AuditEntry{
+		Username:       username,
+		OrganizationID: orgID,
+		TargetType:     targetType,
+		Target:         target,
+		Action:         action,
+	}
+}
+
+// deviceAudit starts the audit entry of a change requested by a user to a device
+func deviceAudit(username, orgID, deviceID, action string) datastore.AuditEntry {
+	return auditEntry(username, orgID, datastore.AuditTargetDevice, deviceID, action)
+}
+
+// snapAuditPayload is the payload of a change to a snap on a device: the snap and the request body
+func snapAuditPayload(snap string, body []byte) map[string]interface{} {
+	payload := map[string]interface{}{"snap": snap}
+	if len(body) > 0 {
+		payload["request"] = json.RawMessage(body)
+		if !json.Valid(body) {
+			payload["request"] = map[string]int{"bytes": len(body)}
+		}
+	}
+	return payload
+}
+
+// snapConfigAuditPayload is the payload of a change to the config of a snap on a device: the snap and the keys
+// that are set. Snap config often holds credentials under keys of any name, so the values are always redacted.
+func snapConfigAuditPayload(snap string, config []byte) map[string]interface{} {
+	payload := snapAuditPayload(snap, config)
+
+	var values map[string]interface{}
+	if err := json.Unmarshal(config, &values); err == nil {
+		for k := range values {
+			values[k] = auditRedacted
+		}
+		payload["request"] = values
+	}
+	return payload
+}
+
+// jobAuditPayload is the payload of a change made by a job: the ID of the job, once it is created, and the
+// request body
+func jobAuditPayload(job domain.Job, body []byte) map[string]interface{} {
+	payload := map[string]interface{}{}
+	if job.ID > 0 {
+		payload["job"] = job.ID
+	}
+	if len(body) > 0 && json.Valid(body) {
+		payload["request"] = json.RawMessage(body)
+	}
+	return payload
+}
+
+// audit records a change requested by a user in the audit log, with a summary of the payload and the result of
+// the change from the error. The change is done by then, so a failure to record it is only logged.
+func (srv *Management) audit(entry datastore.AuditEntry, payload interface{}, err error) {
+	entry.Payload = auditPayload(payload)
+	entry.Result = datastore.AuditSuccess
+	if err != nil {
+		entry.Result = datastore.AuditFailure
+		entry.Message = err.Error()
+	}
+
+	if _, errAudit := srv.DS.AuditCreate(entry); errAudit != nil {
+		log.Errorf("Error recording %s by %s in the audit log: %v", entry.Action, entry.Username, errAudit)
+	}
+}
+
+// responseError is the error of a standard response, nil when the response has no error code
+func responseError(code, message string) error {
+	if len(code) == 0 {
+		return nil
+	}
+	if len(message) == 0 {
+		return errors.New(code)
+	}
+	return fmt.Errorf("%s: %s", code, message)
+}
+
+// auditPayload summarizes a payload as JSON, with the secrets redacted. Request bodies that are not JSON, like
+// assertions or CSV files, are summarized by their size. A summary that is too long is kept as valid JSON: it is
+// replaced by its start, as a string, and its size.
+func auditPayload(payload interface{}) string {
+	var value interface{}
+	switch p := payload.(type) {
+	case nil:
+		return ""
+	case []byte:
+		if len(p) == 0 {
+			return ""
+		}
+		if err := json.Unmarshal(p, &value); err != nil {
+			value = map[string]interface{}{"bytes": len(p)}
+		}
+	default:
+		b, err := json.Marshal(p)
+		if err != nil {
+			return ""
+		}
+		_ = json.Unmarshal(b, &value)
+	}
+
+	b, err := json.Marshal(redact("", value))
+	if err != nil {
+		return ""
+	}
+	if len(b) > auditMaxPayload {
+		b, err = json.Marshal(map[string]interface{}{"truncated": truncate(string(b), auditMaxPayload), "bytes": len(b)})
+		if err != nil {
+			return ""
+		}
+	}
+	return string(b)
+}
+
+// redact replaces the values of the secret keys and the credentials and query of URLs, which can hold a secret,
+// and truncates long values
+func redact(key string, value interface{}) interface{} {
+	if isSecretKey(key) {
+		return auditRedacted
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = redact(k, e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = redact(key, e)
+		}
+	case string:
+		if u, err := url.Parse(v); err == nil && len(u.Scheme) > 0 && len(u.Host) > 0 {
+			if u.User != nil {
+				u.User = url.User(auditRedacted)
+			}
+			if len(u.RawQuery) > 0 {
+				u.RawQuery = auditRedacted
+			}
+			v = u.String()
+		}
+		if len(v) > auditMaxValue {
+			return truncate(v, auditMaxValue) + "..."
+		}
+		return v
+	}
+	return value
+}
+
+func isSecretKey(key string) bool {
+	key = strings.NewReplacer("-", "", "_", "", ".", "").Replace(strings.ToLower(key))
+	for _, s := range auditSecretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate cuts a string to at most n bytes, without splitting a rune
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,167 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/everactive/dmscore/iot-devicetwin/service/controller"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload interface{}
+		want    string
+	}{
+		{"nil", nil, ""},
+		{"empty-body", []byte{}, ""},
+		{"body", []byte(`{"orgid":"def"}`), `{"orgid":"def"}`},
+		{"not-json", []byte("assertions"), `{"bytes":10}`},
+		{"secret-keys", []byte(`{"title":"hi","password":"pw","api_token":"t","nested":{"client-secret":"s"}}`), `{"api_token":"[REDACTED]","nested":{"client-secret":"[REDACTED]"},"password":"[REDACTED]","title":"hi"}`},
+		{"struct", domain.OrganizationCreate{Name: "Test Org", RootKey: "KEY"}, `{"country":"","name":"Test Org","rootKey":"[REDACTED]"}`},
+		{"url-query", map[string]string{"url": "https://user:pw@example.com/snapshot?X-Amz-Signature=abc"}, `{"url":"https://%5BREDACTED%5D@example.com/snapshot?[REDACTED]"}`},
+		{"list", []byte(`[{"token":"t"},"x"]`), `[{"token":"[REDACTED]"},"x"]`},
+		{"key-and-auth", []byte(`{"apikey":"k","api-key":"k","basic-auth":"a","name":"n"}`), `{"api-key":"[REDACTED]","apikey":"[REDACTED]","basic-auth":"[REDACTED]","name":"n"}`},
+		{"snap-config", snapConfigAuditPayload("helloworld", []byte(`{"title":"hi","endpoint":"https://example.com"}`)), `{"request":{"endpoint":"[REDACTED]","title":"[REDACTED]"},"snap":"helloworld"}`},
+		{"snap-config-not-json", snapConfigAuditPayload("helloworld", []byte("title")), `{"request":{"bytes":5},"snap":"helloworld"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, auditPayload(tt.payload))
+		})
+	}
+
+	long := auditPayload(map[string]string{"data": strings.Repeat("a", 2*auditMaxValue)})
+	assert.Len(t, long, len(`{"data":"..."}`)+auditMaxValue)
+
+	// Values are not cut in the middle of a rune
+	runes := auditPayload(map[string]string{"data": "a" + strings.Repeat("é", auditMaxValue)})
+	assert.True(t, utf8.ValidString(runes))
+	assert.Len(t, runes, len(`{"data":"a..."}`)+auditMaxValue-2)
+
+	// A payload that is too long is still valid JSON
+	values := map[string]string{}
+	for i := 0; i < 2*auditMaxPayload/auditMaxValue; i++ {
+		values[fmt.Sprint("data", i)] = strings.Repeat("é", auditMaxValue)
+	}
+	var summary struct {
+		Truncated string
+		Bytes     int
+	}
+	assert.NoError(t, json.Unmarshal([]byte(auditPayload(values)), &summary))
+	assert.True(t, utf8.ValidString(summary.Truncated))
+	assert.LessOrEqual(t, len(summary.Truncated), auditMaxPayload)
+	assert.Greater(t, summary.Bytes, auditMaxPayload)
+}
+
+func TestManagement_AuditSnapInstall(t *testing.T) {
+	db := memory.NewStore()
+	twinMock := &controller.MockController{}
+	twinMock.On("DeviceSnapInstall", "abc", "a111", "helloworld").Return("act-1", nil)
+	twinMock.On("DeviceSnapInstall", "abc", "a111", "invalid").Return("", errors.New("MOCK error"))
+	srv := Management{DS: db, DeviceTwinController: twinMock}
+
+	_ = srv.SnapInstall("abc", "jamesj", datastore.Admin, "a111", "helloworld")
+	_ = srv.SnapInstall("abc", "jamesj", datastore.Admin, "a111", "invalid")
+	_ = srv.SnapInstall("abc", "sarahj", datastore.Admin, "a111", "helloworld")
+
+	entries, err := db.AuditList(datastore.AuditFilter{})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, "sarahj", entries[0].Username)
+		assert.Equal(t, datastore.AuditFailure, entries[0].Result)
+		assert.Contains(t, entries[0].Message, "SnapAuth")
+
+		assert.Equal(t, datastore.AuditFailure, entries[1].Result)
+		assert.Equal(t, "SnapInstall: MOCK error", entries[1].Message)
+
+		assert.Equal(t, datastore.AuditEntry{
+			ID:             1,
+			Created:        entries[2].Created,
+			Username:       "jamesj",
+			OrganizationID: "abc",
+			TargetType:     datastore.AuditTargetDevice,
+			Target:         "a111",
+			Action:         "snap.install",
+			Payload:        `{"snap":"helloworld"}`,
+			Result:         datastore.AuditSuccess,
+			ActionID:       "act-1",
+		}, entries[2])
+	}
+}
+
+func TestManagement_AuditList(t *testing.T) {
+	db := memory.NewStore()
+	_, _ = db.AuditCreate(datastore.AuditEntry{Username: "jamesj", OrganizationID: "abc", Action: "snap.install", Result: datastore.AuditSuccess})
+	_, _ = db.AuditCreate(datastore.AuditEntry{Username: "jamesj", OrganizationID: "def", Action: "snap.remove", Result: datastore.AuditSuccess})
+	_, _ = db.AuditCreate(datastore.AuditEntry{Username: "jamesj", Action: "user.create", Result: datastore.AuditSuccess})
+	srv := Management{DS: db}
+
+	tests := []struct {
+		name     string
+		username string
+		role     int
+		filter   domain.AuditFilter
+		want     int
+		wantErr  bool
+	}{
+		{"valid-superuser", "jamesj", datastore.Superuser, domain.AuditFilter{}, 3, false},
+		{"valid-superuser-filter", "jamesj", datastore.Superuser, domain.AuditFilter{Action: "user.create"}, 1, false},
+		{"valid-superuser-limit", "jamesj", datastore.Superuser, domain.AuditFilter{Limit: 2}, 2, false},
+		{"valid-superuser-offset", "jamesj", datastore.Superuser, domain.AuditFilter{Limit: 2, Offset: 2}, 1, false},
+		{"valid-org-admin", "jamesj", datastore.Admin, domain.AuditFilter{OrganizationID: "abc"}, 1, false},
+		{"invalid-no-org", "jamesj", datastore.Admin, domain.AuditFilter{}, 0, true},
+		{"invalid-not-member", "sarahj", datastore.Admin, domain.AuditFilter{OrganizationID: "abc"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := srv.AuditList(tt.username, tt.role, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Management.AuditList() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Len(t, got, tt.want)
+		})
+	}
+}
+
+func TestManagement_AuditUserSync(t *testing.T) {
+	db := memory.NewStore()
+	srv := Management{DS: db}
+
+	user := domain.User{Username: "sync", Name: "Sync", Role: datastore.Standard}
+	orgRoles := map[string]string{"abc": datastore.OrgViewer}
+	assert.NoError(t, srv.UserSync(datastore.UserProviderKeycloak, user, orgRoles))
+	assert.NoError(t, srv.UserSync(datastore.UserProviderKeycloak, user, orgRoles))
+
+	// Only the sync that changed the user is audited
+	entries, _ := db.AuditList(datastore.AuditFilter{Action: "user.sync"})
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,63 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"strconv"
+
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+// AutoRegistrationRuleList fetches the auto-registration rules in the order they are tried
+func (srv *Management) AutoRegistrationRuleList() ([]iddomain.AutoRegistrationRule, error) {
+	return srv.Identity.AutoRegistrationRuleList()
+}
+
+// AutoRegistrationRuleCreate adds an auto-registration rule
+func (srv *Management) AutoRegistrationRuleCreate(username string, rule iddomain.AutoRegistrationRule) (uint, error) {
+	ruleID, err := srv.Identity.AutoRegistrationRuleCreate(rule)
+	srv.audit(ruleAudit(username, rule.OrganizationID, ruleID, "auto-registration.rule-create"), rule, err)
+	return ruleID, err
+}
+
+// AutoRegistrationRuleUpdate replaces an auto-registration rule
+func (srv *Management) AutoRegistrationRuleUpdate(username string, rule iddomain.AutoRegistrationRule) error {
+	err := srv.Identity.AutoRegistrationRuleUpdate(rule)
+	srv.audit(ruleAudit(username, rule.OrganizationID, rule.ID, "auto-registration.rule-update"), rule, err)
+	return err
+}
+
+// AutoRegistrationRuleDelete deletes an auto-registration rule
+func (srv *Management) AutoRegistrationRuleDelete(username string, ruleID uint) error {
+	err := srv.Identity.AutoRegistrationRuleDelete(ruleID)
+	srv.audit(ruleAudit(username, "", ruleID, "auto-registration.rule-delete"), nil, err)
+	return err
+}
+
+// AutoRegistrationEvaluate shows the rule a model and serial assertion would hit, without registering the device
+func (srv *Management) AutoRegistrationEvaluate(assertions []byte) (*iddomain.AutoRegistrationEvaluation, error) {
+	return srv.Identity.AutoRegistrationEvaluate(assertions)
+}
+
+// ruleAudit starts the audit entry of a change to an auto-registration rule
+func ruleAudit(username, orgID string, ruleID uint, action string) datastore.AuditEntry {
+	return auditEntry(username, orgID, datastore.AuditTargetRule, strconv.FormatUint(uint64(ruleID), 10), action)
+}
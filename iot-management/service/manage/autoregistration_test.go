@@ -0,0 +1,87 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"errors"
+	"testing"
+
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service/mocks"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+)
+
+func TestManagement_AutoRegistrationRules(t *testing.T) {
+	rule := iddomain.AutoRegistrationRule{ID: 1, Brand: "example", OrganizationID: "abc"}
+
+	tests := []struct {
+		name        string
+		identityErr error
+		wantErr     bool
+	}{
+		{"valid", nil, false},
+		{"invalid", errors.New("MOCK error rule"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("AutoRegistrationRuleList").Return([]iddomain.AutoRegistrationRule{rule}, tt.identityErr)
+			identityMock.On("AutoRegistrationRuleCreate", rule).Return(uint(1), tt.identityErr)
+			identityMock.On("AutoRegistrationRuleUpdate", rule).Return(tt.identityErr)
+			identityMock.On("AutoRegistrationRuleDelete", uint(1)).Return(tt.identityErr)
+
+			srv := Management{DS: memory.NewStore(), Identity: identityMock}
+			if _, err := srv.AutoRegistrationRuleList(); (err != nil) != tt.wantErr {
+				t.Errorf("Management.AutoRegistrationRuleList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := srv.AutoRegistrationRuleCreate("jamesj", rule); (err != nil) != tt.wantErr {
+				t.Errorf("Management.AutoRegistrationRuleCreate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := srv.AutoRegistrationRuleUpdate("jamesj", rule); (err != nil) != tt.wantErr {
+				t.Errorf("Management.AutoRegistrationRuleUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := srv.AutoRegistrationRuleDelete("jamesj", 1); (err != nil) != tt.wantErr {
+				t.Errorf("Management.AutoRegistrationRuleDelete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagement_AutoRegistrationEvaluate(t *testing.T) {
+	tests := []struct {
+		name        string
+		identityErr error
+		wantErr     bool
+	}{
+		{"valid", nil, false},
+		{"invalid", errors.New("MOCK error evaluate"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("AutoRegistrationEvaluate", []byte("ASSERTIONS")).Return(&iddomain.AutoRegistrationEvaluation{Eligible: true}, tt.identityErr)
+
+			srv := Management{DS: memory.NewStore(), Identity: identityMock}
+			if _, err := srv.AutoRegistrationEvaluate([]byte("ASSERTIONS")); (err != nil) != tt.wantErr {
+				t.Errorf("Management.AutoRegistrationEvaluate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	twindatastore "github.com/everactive/dmscore/iot-devicetwin/datastore"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/spf13/viper"
+)
+
+// Steps of a device decommissioning job
+const (
+	decommissionStepUnregister   = "unregister"
+	decommissionStepWaitResponse = "wait-response"
+	decommissionStepRevoke       = "revoke"
+	decommissionStepDelete       = "delete"
+	decommissionStepGroups       = "groups"
+)
+
+var decommissionStepOrder = []string{
+	decommissionStepUnregister,
+	decommissionStepWaitResponse,
+	decommissionStepRevoke,
+	decommissionStepDelete,
+	decommissionStepGroups,
+}
+
+var decommissionSteps = map[string]jobStepFunc{
+	decommissionStepUnregister:   decommissionUnregister,
+	decommissionStepWaitResponse: decommissionWaitResponse,
+	decommissionStepRevoke:       decommissionRevoke,
+	decommissionStepDelete:       decommissionDelete,
+	decommissionStepGroups:       decommissionGroups,
+}
+
+// decommissionParams is the progress of a decommissioning job that the later steps depend on
+type decommissionParams struct {
+	// HasTwin is whether the device had connected, and so has a device twin
+	HasTwin bool `json:"hasTwin"`
+	// ActionID is the ID of the unregister action sent to the device
+	ActionID string `json:"actionId,omitempty"`
+	// Groups are the groups the device was removed from
+	Groups []string `json:"groups,omitempty"`
+}
+
+// DeviceDelete starts a job that decommissions a device. The device is asked to unregister and, once it has
+// responded or the response has timed out, its credentials are revoked, its device twin and registration are
+// soft deleted and it is removed from its groups. Each step is recorded, and a failed job can be resumed.
+func (srv *Management) DeviceDelete(orgID, username string, role int, deviceID string) (result domain.Job, err error) {
+	entry := deviceAudit(username, orgID, deviceID, "device.delete")
+	defer func() { srv.audit(entry, jobAuditPayload(result, nil), err) }()
+
+	newOrgID, err := getUserOrgIDIfOrgName(srv, username, orgID)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	orgID = newOrgID
+	entry.OrganizationID = orgID
+
+	if !srv.orgAccess(orgID, username, role, PermissionAdminister) {
+		return domain.Job{}, NotAuthorizedErr
+	}
+
+	enroll, idErr := srv.Identity.DeviceGet(orgID, deviceID)
+	_, twinErr := srv.DeviceTwinController.DeviceGet(orgID, deviceID)
+	if (idErr != nil || enroll.Organization.ID != orgID) && twinErr != nil {
+		return domain.Job{}, fmt.Errorf("the device `%s` does not belong to the organization", deviceID)
+	}
+
+	active, err := srv.activeJob(orgID, domain.JobKindDecommission, deviceID)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	if active != nil {
+		return domain.Job{}, fmt.Errorf("the device is already being decommissioned by job %d", active.ID)
+	}
+
+	job, err := srv.newJob(decommissionJob(orgID, username, deviceID), decommissionStepOrder, nil)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	return jobToDomain(job), nil
+}
+
+func decommissionJob(orgID, username, deviceID string) datastore.Job {
+	return datastore.Job{
+		Kind:           domain.JobKindDecommission,
+		OrganizationID: orgID,
+		DeviceID:       deviceID,
+		Username:       username,
+		Parameters:     "{}",
+	}
+}
+
+func decommissionParameters(job *datastore.Job) (decommissionParams, error) {
+	params := decommissionParams{}
+	err := json.Unmarshal([]byte(job.Parameters), &params)
+	return params, err
+}
+
+func setDecommissionParameters(job *datastore.Job, params decommissionParams) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	job.Parameters = string(b)
+	return nil
+}
+
+// decommissionUnregister sends the unregister action to the device, if it has connected
+func decommissionUnregister(srv *Management, job *datastore.Job, step *datastore.JobStep) error {
+	params, err := decommissionParameters(job)
+	if err != nil {
+		return err
+	}
+
+	params.ActionID = ""
+	_, err = srv.DeviceTwinController.DeviceGet(job.OrganizationID, job.DeviceID)
+	params.HasTwin = err == nil
+	if params.HasTwin {
+		if params.ActionID, err = srv.DeviceTwinController.DeviceUnregister(job.OrganizationID, job.DeviceID); err != nil {
+			return err
+		}
+	} else {
+		step.Message = "the device has not connected, it is not sent the unregister action"
+	}
+
+	return setDecommissionParameters(job, params)
+}
+
+// decommissionWaitResponse waits for the device to respond to the unregister action, or for the response to
+// time out
+func decommissionWaitResponse(srv *Management, job *datastore.Job, step *datastore.JobStep) error {
+	params, err := decommissionParameters(job)
+	if err != nil || len(params.ActionID) == 0 {
+		return err
+	}
+
+	act, err := srv.DeviceTwinController.ActionGet(params.ActionID)
+	if err != nil {
+		return err
+	}
+
+	switch act.Status {
+	case twindatastore.ActionStatusComplete:
+		return nil
+	case twindatastore.ActionStatusError:
+		step.Message = fmt.Sprintf("the device responded with an error: %s", act.Message)
+		return nil
+	}
+
+	timeout := viper.GetDuration(keys.DecommissionResponseTimeout)
+	if timeout > 0 && step.Started != nil && time.Since(*step.Started) > timeout {
+		step.Message = fmt.Sprintf("the device did not respond within %v", timeout)
+		return nil
+	}
+	return fmt.Errorf("%w for the device to respond to the unregister action", errStepWaiting)
+}
+
+// decommissionRevoke revokes the certificate of the device
+func decommissionRevoke(srv *Management, job *datastore.Job, step *datastore.JobStep) error {
+	if _, err := srv.Identity.DeviceGet(job.OrganizationID, job.DeviceID); err != nil {
+		step.Message = "the device is not registered"
+		return nil
+	}
+	return srv.Identity.RevokeDevice(job.DeviceID, cert.ReasonCessationOfOperation)
+}
+
+// decommissionDelete soft deletes the device twin and the registration of the device. The device twin is
+// already deleted when the device has responded to the unregister action. The certificate was revoked by the
+// previous step, so deleting the registration does not revoke it again.
+func decommissionDelete(srv *Management, job *datastore.Job, _ *datastore.JobStep) error {
+	if _, err := srv.DeviceTwinController.DeviceGet(job.OrganizationID, job.DeviceID); err == nil {
+		if err = srv.DeviceTwinController.DeviceDelete(job.DeviceID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := srv.Identity.DeviceGet(job.OrganizationID, job.DeviceID); err != nil {
+		return nil
+	}
+	_, err := srv.Identity.DeleteDevice(job.DeviceID)
+	return err
+}
+
+// decommissionGroups removes the device from its groups, recording them so that they can be restored
+func decommissionGroups(srv *Management, job *datastore.Job, step *datastore.JobStep) error {
+	params, err := decommissionParameters(job)
+	if err != nil || !params.HasTwin {
+		return err
+	}
+
+	groups, err := srv.DeviceTwinController.DeviceGroupsUnlink(job.DeviceID)
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	params.Groups = groups
+	step.Message = fmt.Sprintf("removed from the groups: %s", strings.Join(params.Groups, ", "))
+	return setDecommissionParameters(job, params)
+}
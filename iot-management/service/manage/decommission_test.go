@@ -0,0 +1,244 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-devicetwin/domain"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/iot-devicetwin/service/controller"
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service/cert"
+	"github.com/everactive/dmscore/iot-identity/service/mocks"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+	mgdomain "github.com/everactive/dmscore/iot-management/domain"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func decommissionIdentityMock(registered bool, revokeErr error) *mocks.Identity {
+	identityMock := &mocks.Identity{}
+	if registered {
+		identityMock.On("DeviceGet", mock.Anything, "a111").Return(&iddomain.Enrollment{ID: "a111", Organization: iddomain.Organization{ID: "abc"}}, nil)
+	} else {
+		identityMock.On("DeviceGet", mock.Anything, "a111").Return(nil, errors.New("MOCK not found"))
+	}
+	identityMock.On("RevokeDevice", "a111", cert.ReasonCessationOfOperation).Return(revokeErr)
+	identityMock.On("DeleteDevice", "a111").Return("a111", nil)
+	return identityMock
+}
+
+func decommissionTwinMock(hasTwin bool, actionStatus string) *controller.MockController {
+	twinMock := &controller.MockController{}
+	if hasTwin {
+		twinMock.On("DeviceGet", "abc", "a111").Return(messages.Device{DeviceId: "a111"}, nil)
+	} else {
+		twinMock.On("DeviceGet", "abc", "a111").Return(messages.Device{}, errors.New("MOCK not found"))
+	}
+	twinMock.On("DeviceUnregister", "abc", "a111").Return("act1", nil)
+	twinMock.On("ActionGet", "act1").Return(domain.Action{ActionID: "act1", Status: actionStatus, Message: "MOCK failed"}, nil)
+	twinMock.On("DeviceDelete", "a111").Return(nil)
+	twinMock.On("DeviceGroupsUnlink", "a111").Return([]string{"workshop", "outdoor"}, nil)
+	return twinMock
+}
+
+func TestManagement_DeviceDelete(t *testing.T) {
+	tests := []struct {
+		name         string
+		username     string
+		registered   bool
+		hasTwin      bool
+		actionStatus string
+		want         string
+		wantSteps    []string
+		wantErr      string
+	}{
+		{"valid-responded", "jamesj", true, true, "complete", mgdomain.JobStatusCompleted, []string{"done", "done", "done", "done", "done"}, ""},
+		{"valid-response-error", "jamesj", true, true, "error", mgdomain.JobStatusCompleted, []string{"done", "done", "done", "done", "done"}, ""},
+		{"valid-waiting", "jamesj", true, true, "requested", mgdomain.JobStatusWaiting, []string{"done", "waiting", "pending", "pending", "pending"}, ""},
+		{"valid-not-connected", "jamesj", true, false, "", mgdomain.JobStatusCompleted, []string{"done", "done", "done", "done", "done"}, ""},
+		{"valid-not-registered", "jamesj", false, true, "complete", mgdomain.JobStatusCompleted, []string{"done", "done", "done", "done", "done"}, ""},
+		{"invalid-user", "sarahj", true, true, "complete", "", nil, "not authorized"},
+		{"invalid-device", "jamesj", false, false, "", "", nil, "does not belong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := decommissionIdentityMock(tt.registered, nil)
+			twinMock := decommissionTwinMock(tt.hasTwin, tt.actionStatus)
+			srv := Management{DS: memory.NewStore(), DeviceTwinController: twinMock, Identity: identityMock}
+
+			got, err := srv.DeviceDelete("abc", tt.username, 200, "a111")
+			if len(tt.wantErr) > 0 {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, mgdomain.JobKindDecommission, got.Kind)
+			assert.Equal(t, tt.want, got.Status)
+			statuses := []string{}
+			for _, st := range got.Steps {
+				statuses = append(statuses, st.Status)
+			}
+			assert.Equal(t, tt.wantSteps, statuses)
+
+			if tt.want == mgdomain.JobStatusWaiting {
+				assert.Contains(t, got.Steps[1].Message, "for the device to respond")
+				identityMock.AssertNotCalled(t, "RevokeDevice", mock.Anything, mock.Anything)
+				return
+			}
+
+			if tt.hasTwin {
+				twinMock.AssertCalled(t, "DeviceUnregister", "abc", "a111")
+				twinMock.AssertCalled(t, "DeviceDelete", "a111")
+				assert.Equal(t, "removed from the groups: workshop, outdoor", got.Steps[4].Message)
+			} else {
+				twinMock.AssertNotCalled(t, "DeviceUnregister", mock.Anything, mock.Anything)
+				twinMock.AssertNotCalled(t, "DeviceGroupsUnlink", mock.Anything)
+				assert.Contains(t, got.Steps[0].Message, "has not connected")
+			}
+			if tt.actionStatus == "error" {
+				assert.Equal(t, "the device responded with an error: MOCK failed", got.Steps[1].Message)
+			}
+			if tt.registered {
+				identityMock.AssertCalled(t, "RevokeDevice", "a111", cert.ReasonCessationOfOperation)
+				identityMock.AssertCalled(t, "DeleteDevice", "a111")
+			} else {
+				identityMock.AssertNotCalled(t, "DeleteDevice", mock.Anything)
+			}
+		})
+	}
+}
+
+func TestManagement_DeviceDeleteInProgress(t *testing.T) {
+	srv := Management{DS: memory.NewStore(), DeviceTwinController: decommissionTwinMock(true, "requested"), Identity: decommissionIdentityMock(true, nil)}
+
+	job, err := srv.DeviceDelete("abc", "jamesj", 200, "a111")
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusWaiting, job.Status)
+
+	_, err = srv.DeviceDelete("abc", "jamesj", 200, "a111")
+	assert.ErrorContains(t, err, "already being decommissioned")
+}
+
+func TestManagement_DeviceDeleteResponseTimeout(t *testing.T) {
+	viper.Set(keys.DecommissionResponseTimeout, "1h")
+	defer viper.Set(keys.DecommissionResponseTimeout, "")
+
+	db := memory.NewStore()
+	srv := Management{DS: db, DeviceTwinController: decommissionTwinMock(true, "requested"), Identity: decommissionIdentityMock(true, nil)}
+
+	job, err := srv.DeviceDelete("abc", "jamesj", 200, "a111")
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusWaiting, job.Status)
+
+	// The device has not responded in time
+	stored, _ := db.JobGet(job.ID)
+	started := time.Now().Add(-2 * time.Hour)
+	stored.Steps[1].Started = &started
+	assert.NoError(t, db.JobUpdate(stored))
+
+	assert.NoError(t, srv.RunWaitingJobs())
+	got, err := srv.JobGet("abc", "jamesj", 200, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusCompleted, got.Status)
+	assert.Equal(t, "the device did not respond within 1h0m0s", got.Steps[1].Message)
+}
+
+func TestManagement_DeviceDeleteResume(t *testing.T) {
+	db := memory.NewStore()
+	twinMock := decommissionTwinMock(true, "complete")
+	srv := Management{DS: db, DeviceTwinController: twinMock, Identity: decommissionIdentityMock(true, errors.New("MOCK revoke"))}
+
+	job, err := srv.DeviceDelete("abc", "jamesj", 200, "a111")
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusFailed, job.Status)
+	assert.Equal(t, mgdomain.JobStepFailed, job.Steps[2].Status)
+	assert.Equal(t, "MOCK revoke", job.Steps[2].Message)
+
+	// The job carries on from the failed step, the device is not sent the unregister action again
+	srv.Identity = decommissionIdentityMock(true, nil)
+	got, err := srv.JobResume("abc", "jamesj", 200, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusCompleted, got.Status)
+	twinMock.AssertNumberOfCalls(t, "DeviceUnregister", 1)
+
+	stored, _ := db.JobGet(job.ID)
+	assert.JSONEq(t, `{"hasTwin":true,"actionId":"act1","groups":["workshop","outdoor"]}`, stored.Parameters)
+}
+
+func TestManagement_DeviceDeleteRetry(t *testing.T) {
+	viper.Set(keys.DecommissionRetries, 2)
+	viper.Set(keys.JobRetryBackoff, "1m")
+	defer viper.Set(keys.DecommissionRetries, 0)
+	defer viper.Set(keys.JobRetryBackoff, "")
+
+	db := memory.NewStore()
+	identityMock := decommissionIdentityMock(true, errors.New("MOCK revoke"))
+	srv := Management{DS: db, DeviceTwinController: decommissionTwinMock(true, "complete"), Identity: identityMock}
+
+	// A failed step waits to be retried
+	job, err := srv.DeviceDelete("abc", "jamesj", 200, "a111")
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusWaiting, job.Status)
+	assert.Equal(t, mgdomain.JobStepWaiting, job.Steps[2].Status)
+	assert.Equal(t, 1, job.Steps[2].Attempts)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), *job.Steps[2].RetryAt, 5*time.Second)
+	assert.Contains(t, job.Steps[2].Message, "MOCK revoke")
+
+	// The step is not run again until it is due
+	assert.NoError(t, srv.RunWaitingJobs())
+	identityMock.AssertNumberOfCalls(t, "RevokeDevice", 1)
+
+	retryDue := func() {
+		stored, _ := db.JobGet(job.ID)
+		past := time.Now().Add(-time.Second)
+		stored.Steps[2].RetryAt = &past
+		assert.NoError(t, db.JobUpdate(stored))
+		assert.NoError(t, srv.RunWaitingJobs())
+	}
+
+	// The time before the next retry doubles
+	retryDue()
+	got, _ := srv.JobGet("abc", "jamesj", 200, job.ID)
+	assert.Equal(t, mgdomain.JobStatusWaiting, got.Status)
+	assert.Equal(t, 2, got.Steps[2].Attempts)
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), *got.Steps[2].RetryAt, 5*time.Second)
+
+	// The job fails once the retries are used up
+	retryDue()
+	got, _ = srv.JobGet("abc", "jamesj", 200, job.ID)
+	assert.Equal(t, mgdomain.JobStatusFailed, got.Status)
+	assert.Equal(t, mgdomain.JobStepFailed, got.Steps[2].Status)
+	assert.Equal(t, "MOCK revoke", got.Steps[2].Message)
+	identityMock.AssertNumberOfCalls(t, "RevokeDevice", 3)
+
+	// Resuming the job runs the step again, with its retries
+	srv.Identity = decommissionIdentityMock(true, nil)
+	got, err = srv.JobResume("abc", "jamesj", 200, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusCompleted, got.Status)
+	assert.Equal(t, 0, got.Steps[2].Attempts)
+}
@@ -20,7 +20,6 @@
 package manage
 
 import (
-	"fmt"
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
 	"github.com/everactive/dmscore/iot-devicetwin/web"
 )
@@ -55,7 +54,7 @@ func (srv *Management) DeviceList(orgID, username string, role int) web.DevicesR
 
 	orgID = newOrgID
 
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionView)
 	if !hasAccess {
 		return web.DevicesResponse{
 			StandardResponse: web.StandardResponse{
@@ -95,7 +94,7 @@ func (srv *Management) DeviceGet(orgID, username string, role int, deviceID stri
 
 	orgID = newOrgID
 
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionView)
 	if !hasAccess {
 		return web.DeviceResponse{
 			StandardResponse: web.StandardResponse{
@@ -121,44 +120,11 @@ func (srv *Management) DeviceGet(orgID, username string, role int, deviceID stri
 	}
 }
 
-// DeviceDelete deletes the device from an organization
-func (srv *Management) DeviceDelete(orgID, username string, role int, deviceID string) web.StandardResponse {
-	newOrgID, err := getUserOrgIDIfOrgName(srv, username, orgID)
-	if err != nil {
-		return web.StandardResponse{
-			Code:    "Error",
-			Message: err.Error(),
-		}
-	}
-
-	orgID = newOrgID
-
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
-	if !hasAccess {
-		return web.StandardResponse{
-			Code:    "DeviceAuth",
-			Message: "the user does not have permissions for the organization",
-		}
-	}
-
-	twinAPIMessage := "device deleted"
-	identityAPIMessage := "device deleted"
-
-	err = srv.DeviceTwinController.DeviceDelete(deviceID)
-	if err != nil {
-		twinAPIMessage = err.Error()
-	}
-	_, err = srv.Identity.DeleteDevice(deviceID)
-	if err != nil {
-		identityAPIMessage = err.Error()
-	}
-
-	message := fmt.Sprintf("twinapi: %s, identity: %s", twinAPIMessage, identityAPIMessage)
-	return web.StandardResponse{Message: message}
-}
-
 // DeviceLogs requests from the DeviceTwin API that logs for a device be sent
-func (srv *Management) DeviceLogs(orgID, username string, role int, deviceID string, logs *messages.DeviceLogs) web.StandardResponse {
+func (srv *Management) DeviceLogs(orgID, username string, role int, deviceID string, logs *messages.DeviceLogs) (response web.StandardResponse) {
+	entry := deviceAudit(username, orgID, deviceID, "device.logs")
+	defer func() { srv.audit(entry, logs, responseError(response.Code, response.Message)) }()
+
 	newOrgID, err := getUserOrgIDIfOrgName(srv, username, orgID)
 	if err != nil {
 		return web.StandardResponse{
@@ -168,8 +134,9 @@ func (srv *Management) DeviceLogs(orgID, username string, role int, deviceID str
 	}
 
 	orgID = newOrgID
+	entry.OrganizationID = orgID
 
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionOperate)
 	if !hasAccess {
 		return web.StandardResponse{
 			Code:    "DeviceAuth",
@@ -177,7 +144,7 @@ func (srv *Management) DeviceLogs(orgID, username string, role int, deviceID str
 		}
 	}
 
-	err = srv.DeviceTwinController.DeviceLogs(orgID, deviceID, logs)
+	entry.ActionID, err = srv.DeviceTwinController.DeviceLogs(orgID, deviceID, logs)
 	if err != nil {
 		return web.StandardResponse{
 			Code:    "Error",
@@ -189,7 +156,10 @@ func (srv *Management) DeviceLogs(orgID, username string, role int, deviceID str
 }
 
 // DeviceUsersAction requests from the DeviceTwin API that a user action be performed on the device
-func (srv *Management) DeviceUsersAction(orgID, username string, role int, deviceID string, deviceUser messages.DeviceUser) web.StandardResponse {
+func (srv *Management) DeviceUsersAction(orgID, username string, role int, deviceID string, deviceUser messages.DeviceUser) (response web.StandardResponse) {
+	entry := deviceAudit(username, orgID, deviceID, "device.users")
+	defer func() { srv.audit(entry, deviceUser, responseError(response.Code, response.Message)) }()
+
 	newOrgID, err := getUserOrgIDIfOrgName(srv, username, orgID)
 	if err != nil {
 		return web.StandardResponse{
@@ -199,8 +169,9 @@ func (srv *Management) DeviceUsersAction(orgID, username string, role int, devic
 	}
 
 	orgID = newOrgID
+	entry.OrganizationID = orgID
 
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionAdminister)
 	if !hasAccess {
 		return web.StandardResponse{
 			Code:    "DeviceAuth",
@@ -208,7 +179,7 @@ func (srv *Management) DeviceUsersAction(orgID, username string, role int, devic
 		}
 	}
 
-	err = srv.DeviceTwinController.User(orgID, deviceID, deviceUser)
+	entry.ActionID, err = srv.DeviceTwinController.User(orgID, deviceID, deviceUser)
 	if err != nil {
 		return web.StandardResponse{
 			Code:    "Error",
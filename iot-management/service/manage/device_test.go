@@ -49,8 +49,10 @@ func TestManagement_DeviceList(t *testing.T) {
 
 			if tt.wantErr == "DevicesAuth" {
 				manageDataStore.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(false)
+				manageDataStore.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
 			} else {
 				manageDataStore.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(true)
+				manageDataStore.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
 			}
 
 			deviceTwinController := &controller.MockController{}
@@ -110,6 +112,7 @@ func TestManagement_DeviceGet(t *testing.T) {
 			hasAccess = true
 		}
 		manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(hasAccess)
+		manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
 
 		deviceTwinControllerMock.On("DeviceGet", mock.Anything, mock.Anything).Return(messages.Device{Serial: tt.wantSerial}, nil)
 
@@ -153,6 +156,7 @@ func TestManagement_DeviceLogs(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			manageDataStoreMock := &datastore.MockDataStore{}
+			manageDataStoreMock.On("AuditCreate", mock.Anything).Return(int64(1), nil)
 			deviceTwinControllerMock := &controller.MockController{}
 			manageDataStoreMock.On("OrganizationsForUser", mock.Anything).Return([]datastore.Organization{}, nil)
 
@@ -161,8 +165,9 @@ func TestManagement_DeviceLogs(t *testing.T) {
 				hasAccess = true
 			}
 			manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(hasAccess)
+			manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
 
-			deviceTwinControllerMock.On("DeviceLogs", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			deviceTwinControllerMock.On("DeviceLogs", mock.Anything, mock.Anything, mock.Anything).Return("", nil)
 
 			srv := Management{
 				DS:                   manageDataStoreMock,
@@ -199,6 +204,7 @@ func TestManagement_DeviceUsersAction(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			manageDataStoreMock := &datastore.MockDataStore{}
+			manageDataStoreMock.On("AuditCreate", mock.Anything).Return(int64(1), nil)
 			deviceTwinControllerMock := &controller.MockController{}
 			manageDataStoreMock.On("OrganizationsForUser", mock.Anything).Return([]datastore.Organization{}, nil)
 
@@ -207,8 +213,9 @@ func TestManagement_DeviceUsersAction(t *testing.T) {
 				hasAccess = true
 			}
 			manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(hasAccess)
+			manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
 
-			deviceTwinControllerMock.On("User", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			deviceTwinControllerMock.On("User", mock.Anything, mock.Anything, mock.Anything).Return("", nil)
 
 			srv := Management{
 				DS:                   manageDataStoreMock,
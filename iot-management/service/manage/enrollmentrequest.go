@@ -0,0 +1,50 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"strconv"
+
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service"
+	"github.com/everactive/dmscore/iot-management/datastore"
+)
+
+// EnrollmentRequestList fetches the enrollment attempts of unregistered devices with a status, or all of them
+func (srv *Management) EnrollmentRequestList(status string) ([]iddomain.EnrollmentRequest, error) {
+	return srv.Identity.EnrollmentRequestList(status)
+}
+
+// EnrollmentRequestApprove registers the device of an enrollment request in an organization
+func (srv *Management) EnrollmentRequestApprove(requestID uint, username string, req service.ApproveEnrollmentRequest) (string, error) {
+	req.Username = username
+	deviceID, err := srv.Identity.EnrollmentRequestApprove(requestID, &req)
+
+	entry := auditEntry(username, req.OrganizationID, datastore.AuditTargetEnrollment, strconv.FormatUint(uint64(requestID), 10), "enrollment-request.approve")
+	srv.audit(entry, map[string]string{"deviceId": deviceID}, err)
+	return deviceID, err
+}
+
+// EnrollmentRequestReject rejects an enrollment request
+func (srv *Management) EnrollmentRequestReject(requestID uint, username string) error {
+	err := srv.Identity.EnrollmentRequestReject(requestID, username)
+	srv.audit(auditEntry(username, "", datastore.AuditTargetEnrollment, strconv.FormatUint(uint64(requestID), 10), "enrollment-request.reject"), nil, err)
+	return err
+}
@@ -0,0 +1,60 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"errors"
+	"testing"
+
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service"
+	"github.com/everactive/dmscore/iot-identity/service/mocks"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+)
+
+func TestManagement_EnrollmentRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		identityErr error
+		wantErr     bool
+	}{
+		{"valid", nil, false},
+		{"invalid", errors.New("MOCK error enrollment request"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("EnrollmentRequestList", "pending").Return([]iddomain.EnrollmentRequest{{ID: 1, Status: "pending"}}, tt.identityErr)
+			identityMock.On("EnrollmentRequestApprove", uint(1), &service.ApproveEnrollmentRequest{OrganizationID: "abc", Username: "jamesj"}).Return("a111", tt.identityErr)
+			identityMock.On("EnrollmentRequestReject", uint(1), "jamesj").Return(tt.identityErr)
+
+			srv := Management{DS: memory.NewStore(), Identity: identityMock}
+			if _, err := srv.EnrollmentRequestList("pending"); (err != nil) != tt.wantErr {
+				t.Errorf("Management.EnrollmentRequestList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := srv.EnrollmentRequestApprove(1, "jamesj", service.ApproveEnrollmentRequest{OrganizationID: "abc"}); (err != nil) != tt.wantErr {
+				t.Errorf("Management.EnrollmentRequestApprove() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := srv.EnrollmentRequestReject(1, "jamesj"); (err != nil) != tt.wantErr {
+				t.Errorf("Management.EnrollmentRequestReject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// errStepWaiting is returned by a job step that waits on the device. The step runs again on the next run of the job.
+var errStepWaiting = errors.New("waiting")
+
+// ErrJobNotFound is returned when a job does not exist in the organization
+var ErrJobNotFound = errors.New("job not found")
+
+// jobStepFunc runs a step of a job. A message set on the step is kept once it is done.
+type jobStepFunc func(srv *Management, job *datastore.Job, step *datastore.JobStep) error
+
+// jobSteps are the steps of each kind of job, by name
+var jobSteps = map[string]map[string]jobStepFunc{
+	domain.JobKindReplace:      replaceSteps,
+	domain.JobKindDecommission: decommissionSteps,
+	domain.JobKindRegistration: registrationSteps,
+	domain.JobKindTransfer:     transferSteps,
+}
+
+// jobRetries are the keys of the number of times a failed step is retried, of the kinds of job that are retried
+var jobRetries = map[string]string{
+	domain.JobKindDecommission: keys.DecommissionRetries,
+}
+
+// maxJobRetryBackoff is the longest time between the retries of a failed step
+const maxJobRetryBackoff = time.Hour
+
+// jobLocks stop a job running from the job runner and a request at the same time. Each job has its own lock, so a
+// long job, like a large bulk registration, does not hold up the others.
+var jobLocks = struct {
+	sync.Mutex
+	jobs map[int64]*jobLock
+}{jobs: map[int64]*jobLock{}}
+
+// jobLock is the lock of a job, dropped once no one holds or waits for it
+type jobLock struct {
+	sync.Mutex
+	users int
+}
+
+// lockJob locks a job and returns the function that unlocks it
+func lockJob(jobID int64) func() {
+	jobLocks.Lock()
+	l, ok := jobLocks.jobs[jobID]
+	if !ok {
+		l = &jobLock{}
+		jobLocks.jobs[jobID] = l
+	}
+	l.users++
+	jobLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		jobLocks.Lock()
+		defer jobLocks.Unlock()
+		l.users--
+		if l.users == 0 {
+			delete(jobLocks.jobs, jobID)
+		}
+	}
+}
+
+// newJob creates a job with its steps pending, and runs it
+func (srv *Management) newJob(job datastore.Job, steps []string, skipped map[string]bool) (datastore.Job, error) {
+	job.Status = domain.JobStatusRunning
+	job, err := srv.createJob(job, steps, skipped)
+	if err != nil {
+		return datastore.Job{}, err
+	}
+
+	err = srv.runJob(&job)
+	return job, err
+}
+
+// createJob stores a job with its steps pending, without running it
+func (srv *Management) createJob(job datastore.Job, steps []string, skipped map[string]bool) (datastore.Job, error) {
+	for i, name := range steps {
+		step := datastore.JobStep{Position: i + 1, Name: name, Status: domain.JobStepPending}
+		if skipped[name] {
+			step.Status = domain.JobStepSkipped
+		}
+		job.Steps = append(job.Steps, step)
+	}
+
+	id, err := srv.DS.JobCreate(job)
+	if err != nil {
+		return datastore.Job{}, err
+	}
+
+	return srv.DS.JobGet(id)
+}
+
+// runJob runs the steps of a job in order, from the first that is not done. The job stops at a step that waits
+// on the device or fails, storing the progress of each step as it goes.
+func (srv *Management) runJob(job *datastore.Job) error {
+	defer lockJob(job.ID)()
+	return srv.runJobSteps(job)
+}
+
+// runWaitingJob runs a job if it is still waiting, as it may have been run since it was listed
+func (srv *Management) runWaitingJob(jobID int64) error {
+	defer lockJob(jobID)()
+
+	job, err := srv.DS.JobGet(jobID)
+	if err != nil || job.Status != domain.JobStatusWaiting {
+		return err
+	}
+	return srv.runJobSteps(&job)
+}
+
+func (srv *Management) runJobSteps(job *datastore.Job) error {
+	job.Status = domain.JobStatusRunning
+	for i := range job.Steps {
+		step := &job.Steps[i]
+		if step.Status == domain.JobStepDone || step.Status == domain.JobStepSkipped {
+			continue
+		}
+
+		now := time.Now()
+		if step.RetryAt != nil {
+			if now.Before(*step.RetryAt) {
+				return nil
+			}
+			step.RetryAt = nil
+		}
+		if step.Started == nil {
+			step.Started = &now
+		}
+
+		run, ok := jobSteps[job.Kind][step.Name]
+		if !ok {
+			return srv.jobStepFailed(job, step, fmt.Errorf("unknown step `%s` of a %s job", step.Name, job.Kind))
+		}
+
+		step.Message = ""
+		err := run(srv, job, step)
+		if errors.Is(err, errStepWaiting) {
+			timeout := viper.GetDuration(keys.JobStepTimeout)
+			if timeout > 0 && now.Sub(*step.Started) > timeout {
+				return srv.jobStepFailed(job, step, fmt.Errorf("timed out %v", err))
+			}
+			step.Status = domain.JobStepWaiting
+			step.Message = err.Error()
+			job.Status = domain.JobStatusWaiting
+			return srv.DS.JobUpdate(*job)
+		}
+		if err != nil {
+			if srv.retryJobStep(job, step) {
+				step.Message = fmt.Sprintf("retrying at %s: %v", step.RetryAt.Format(time.RFC3339), err)
+				return srv.DS.JobUpdate(*job)
+			}
+			return srv.jobStepFailed(job, step, err)
+		}
+
+		step.Status = domain.JobStepDone
+		step.Finished = &now
+		if err = srv.DS.JobUpdate(*job); err != nil {
+			return err
+		}
+	}
+
+	job.Status = domain.JobStatusCompleted
+	return srv.DS.JobUpdate(*job)
+}
+
+// retryJobStep schedules a failed step to run again, backing off with each attempt, if the kind of job is retried
+// and the step has attempts left
+func (srv *Management) retryJobStep(job *datastore.Job, step *datastore.JobStep) bool {
+	key, ok := jobRetries[job.Kind]
+	if !ok || step.Attempts >= viper.GetInt(key) {
+		return false
+	}
+
+	backoff := viper.GetDuration(keys.JobRetryBackoff)
+	for i := 0; i < step.Attempts && backoff < maxJobRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxJobRetryBackoff {
+		backoff = maxJobRetryBackoff
+	}
+
+	retryAt := time.Now().Add(backoff)
+	step.Attempts++
+	step.RetryAt = &retryAt
+	step.Status = domain.JobStepWaiting
+	job.Status = domain.JobStatusWaiting
+	return true
+}
+
+func (srv *Management) jobStepFailed(job *datastore.Job, step *datastore.JobStep, err error) error {
+	step.Status = domain.JobStepFailed
+	step.Message = err.Error()
+	job.Status = domain.JobStatusFailed
+	return srv.DS.JobUpdate(*job)
+}
+
+// RunWaitingJobs runs the jobs that are waiting on a device. A job that cannot run is logged, it does not stop the
+// jobs after it.
+func (srv *Management) RunWaitingJobs() error {
+	jobs, err := srv.DS.JobList("", domain.JobStatusWaiting)
+	if err != nil {
+		return err
+	}
+
+	for _, j := range jobs {
+		if err = srv.runWaitingJob(j.ID); err != nil {
+			log.Errorf("Error running %s job %d: %v", j.Kind, j.ID, err)
+		}
+	}
+	return nil
+}
+
+// JobList lists the jobs of an organization, most recent first
+func (srv *Management) JobList(orgID, username string, role int) ([]domain.Job, error) {
+	if !srv.orgAccess(orgID, username, role, PermissionView) {
+		return nil, NotAuthorizedErr
+	}
+
+	jobs, err := srv.DS.JobList(orgID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	list := []domain.Job{}
+	for _, j := range jobs {
+		list = append(list, jobToDomain(j))
+	}
+	return list, nil
+}
+
+// JobGet fetches a job of an organization
+func (srv *Management) JobGet(orgID, username string, role int, jobID int64) (domain.Job, error) {
+	job, err := srv.organizationJob(orgID, username, role, PermissionView, jobID)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	return jobToDomain(job), nil
+}
+
+// JobResume runs a failed or waiting job again, from the step it stopped at
+func (srv *Management) JobResume(orgID, username string, role int, jobID int64) (result domain.Job, err error) {
+	entry := auditEntry(username, orgID, datastore.AuditTargetJob, strconv.FormatInt(jobID, 10), "job.resume")
+	defer func() { srv.audit(entry, nil, err) }()
+
+	job, err := srv.organizationJob(orgID, username, role, PermissionAdminister, jobID)
+	if err != nil {
+		return domain.Job{}, err
+	}
+
+	// The job is loaded again under the lock, as the job runner may have run it since
+	defer lockJob(job.ID)()
+	if job, err = srv.DS.JobGet(job.ID); err != nil {
+		return domain.Job{}, err
+	}
+
+	if job.Status != domain.JobStatusFailed && job.Status != domain.JobStatusWaiting {
+		return domain.Job{}, fmt.Errorf("a %s job cannot be resumed", job.Status)
+	}
+
+	// The failed step is run as new, so it waits on the device and is retried for as long again. A step waiting
+	// to be retried runs now.
+	for i := range job.Steps {
+		if job.Steps[i].Status == domain.JobStepFailed {
+			job.Steps[i].Status = domain.JobStepPending
+			job.Steps[i].Message = ""
+			job.Steps[i].Started = nil
+			job.Steps[i].Attempts = 0
+		}
+		job.Steps[i].RetryAt = nil
+	}
+
+	err = srv.runJobSteps(&job)
+	return jobToDomain(job), err
+}
+
+// activeJob finds the job of a kind on a device that has not completed, if there is one
+func (srv *Management) activeJob(orgID, kind, deviceID string) (*datastore.Job, error) {
+	jobs, err := srv.DS.JobList(orgID, "")
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		if jobs[i].Kind == kind && jobs[i].DeviceID == deviceID && jobs[i].Status != domain.JobStatusCompleted {
+			return &jobs[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (srv *Management) organizationJob(orgID, username string, role int, permission Permission, jobID int64) (datastore.Job, error) {
+	if !srv.orgAccess(orgID, username, role, permission) {
+		return datastore.Job{}, NotAuthorizedErr
+	}
+
+	job, err := srv.DS.JobGet(jobID)
+	if err != nil || job.OrganizationID != orgID {
+		return datastore.Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+func jobToDomain(job datastore.Job) domain.Job {
+	j := domain.Job{
+		ID:             job.ID,
+		Created:        job.Created,
+		Modified:       job.Modified,
+		Kind:           job.Kind,
+		OrganizationID: job.OrganizationID,
+		DeviceID:       job.DeviceID,
+		Username:       job.Username,
+		Status:         job.Status,
+		Steps:          []domain.JobStep{},
+	}
+	for _, st := range job.Steps {
+		j.Steps = append(j.Steps, domain.JobStep{
+			Name:     st.Name,
+			Status:   st.Status,
+			Message:  st.Message,
+			Started:  st.Started,
+			Finished: st.Finished,
+			Attempts: st.Attempts,
+			RetryAt:  st.RetryAt,
+		})
+	}
+	if job.Kind == domain.JobKindRegistration {
+		j.Result = registrationResult(job)
+	}
+	return j
+}
@@ -0,0 +1,259 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service"
+	"github.com/everactive/dmscore/iot-identity/service/mocks"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// testJob creates a job with a step that fails, waits or succeeds as it is told
+func testJob(t *testing.T, srv *Management, orgID string, result *error) datastore.Job {
+	jobSteps["test"] = map[string]jobStepFunc{
+		"first":  func(srv *Management, job *datastore.Job, step *datastore.JobStep) error { return nil },
+		"second": func(srv *Management, job *datastore.Job, step *datastore.JobStep) error { return *result },
+	}
+	t.Cleanup(func() { delete(jobSteps, "test") })
+
+	job, err := srv.newJob(datastore.Job{Kind: "test", OrganizationID: orgID, DeviceID: "a111", Username: "jamesj"}, []string{"first", "second"}, nil)
+	assert.NoError(t, err)
+	return job
+}
+
+func TestManagement_JobList(t *testing.T) {
+	srv := Management{DS: memory.NewStore()}
+	var result error
+	testJob(t, &srv, "abc", &result)
+	testJob(t, &srv, "def", &result)
+
+	got, err := srv.JobList("abc", "jamesj", 200)
+	assert.NoError(t, err)
+	assert.Len(t, got, 1)
+	assert.Equal(t, domain.JobStatusCompleted, got[0].Status)
+	assert.Equal(t, "second", got[0].Steps[1].Name)
+	assert.NotNil(t, got[0].Steps[1].Finished)
+
+	_, err = srv.JobList("abc", "invalid", 200)
+	assert.Equal(t, NotAuthorizedErr, err)
+}
+
+func TestManagement_JobGet(t *testing.T) {
+	srv := Management{DS: memory.NewStore()}
+	var result error
+	abc := testJob(t, &srv, "abc", &result)
+	def := testJob(t, &srv, "def", &result)
+
+	got, err := srv.JobGet("abc", "jamesj", 200, abc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, abc.ID, got.ID)
+
+	_, err = srv.JobGet("abc", "jamesj", 200, def.ID)
+	assert.Equal(t, ErrJobNotFound, err)
+	_, err = srv.JobGet("abc", "jamesj", 200, 99)
+	assert.Equal(t, ErrJobNotFound, err)
+	_, err = srv.JobGet("abc", "invalid", 200, abc.ID)
+	assert.Equal(t, NotAuthorizedErr, err)
+}
+
+func TestManagement_JobResume(t *testing.T) {
+	srv := Management{DS: memory.NewStore()}
+	result := errors.New("MOCK error")
+	job := testJob(t, &srv, "abc", &result)
+	assert.Equal(t, domain.JobStatusFailed, job.Status)
+	assert.Equal(t, domain.JobStepDone, job.Steps[0].Status)
+	assert.Equal(t, domain.JobStepFailed, job.Steps[1].Status)
+	assert.Equal(t, "MOCK error", job.Steps[1].Message)
+
+	// The step that failed is run again, the steps that are done are not
+	result = fmt.Errorf("%w for the MOCK", errStepWaiting)
+	got, err := srv.JobResume("abc", "jamesj", 200, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.JobStatusWaiting, got.Status)
+	assert.Equal(t, domain.JobStepWaiting, got.Steps[1].Status)
+	assert.Equal(t, job.Steps[0].Finished, got.Steps[0].Finished)
+
+	result = nil
+	got, err = srv.JobResume("abc", "jamesj", 200, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.JobStatusCompleted, got.Status)
+	assert.Empty(t, got.Steps[1].Message)
+
+	_, err = srv.JobResume("abc", "jamesj", 200, job.ID)
+	assert.EqualError(t, err, "a completed job cannot be resumed")
+	_, err = srv.JobResume("abc", "invalid", 200, job.ID)
+	assert.Equal(t, NotAuthorizedErr, err)
+}
+
+func TestManagement_RunWaitingJobsTimeout(t *testing.T) {
+	viper.Set(keys.JobStepTimeout, "1h")
+	defer viper.Set(keys.JobStepTimeout, "")
+
+	db := memory.NewStore()
+	srv := Management{DS: db}
+	result := fmt.Errorf("%w for the MOCK", errStepWaiting)
+	job := testJob(t, &srv, "abc", &result)
+
+	assert.NoError(t, srv.RunWaitingJobs())
+	got, _ := db.JobGet(job.ID)
+	assert.Equal(t, domain.JobStatusWaiting, got.Status)
+
+	// The step has waited for longer than the timeout
+	started := time.Now().Add(-2 * time.Hour)
+	got.Steps[1].Started = &started
+	assert.NoError(t, db.JobUpdate(got))
+
+	assert.NoError(t, srv.RunWaitingJobs())
+	got, _ = db.JobGet(job.ID)
+	assert.Equal(t, domain.JobStatusFailed, got.Status)
+	assert.Equal(t, domain.JobStepFailed, got.Steps[1].Status)
+	assert.Equal(t, "timed out waiting for the MOCK", got.Steps[1].Message)
+}
+
+// failingJobStore fails to update one of the jobs
+type failingJobStore struct {
+	*memory.Store
+	jobID int64
+}
+
+func (s failingJobStore) JobUpdate(job datastore.Job) error {
+	if job.ID == s.jobID {
+		return errors.New("MOCK error")
+	}
+	return s.Store.JobUpdate(job)
+}
+
+func TestManagement_RunWaitingJobsError(t *testing.T) {
+	db := memory.NewStore()
+	srv := Management{DS: db}
+	result := fmt.Errorf("%w for the MOCK", errStepWaiting)
+	first := testJob(t, &srv, "abc", &result)
+	second := testJob(t, &srv, "abc", &result)
+
+	// A job that cannot run does not stop the others
+	srv.DS = failingJobStore{Store: db, jobID: first.ID}
+	result = nil
+	assert.NoError(t, srv.RunWaitingJobs())
+
+	got, _ := db.JobGet(first.ID)
+	assert.Equal(t, domain.JobStatusWaiting, got.Status)
+	got, _ = db.JobGet(second.ID)
+	assert.Equal(t, domain.JobStatusCompleted, got.Status)
+}
+
+func TestManagement_RunWaitingJobLock(t *testing.T) {
+	db := memory.NewStore()
+	srv := Management{DS: db}
+	result := fmt.Errorf("%w for the MOCK", errStepWaiting)
+	first := testJob(t, &srv, "abc", &result)
+	second := testJob(t, &srv, "abc", &result)
+	result = nil
+
+	// A job that is running does not hold up the others
+	unlock := lockJob(first.ID)
+	done := make(chan error)
+	go func() { done <- srv.runWaitingJob(second.ID) }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Management.runWaitingJob() waited for another job")
+	}
+
+	// The job itself waits until it is unlocked
+	go func() { done <- srv.runWaitingJob(first.ID) }()
+	select {
+	case <-done:
+		t.Fatal("Management.runWaitingJob() ran a locked job")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	assert.NoError(t, <-done)
+
+	got, _ := db.JobGet(first.ID)
+	assert.Equal(t, domain.JobStatusCompleted, got.Status)
+	assert.Empty(t, jobLocks.jobs)
+}
+
+func TestManagement_RegisterDevicesJob(t *testing.T) {
+	viper.Set(keys.RegistrationJobThreshold, 2)
+	t.Cleanup(func() { viper.Set(keys.RegistrationJobThreshold, 0) })
+
+	data := []byte("example,drone-1000,DR1000A1\nexample,drone-1000,DR1000A2\nexample,drone-1000,DR1000A3\n")
+	invalid := []iddomain.DeviceRegistrationResult{
+		{Line: 1, Status: iddomain.DeviceRegistrationSkipped},
+		{Line: 2, Status: iddomain.DeviceRegistrationFailed},
+		{Line: 3, Status: iddomain.DeviceRegistrationSkipped},
+	}
+	registered := []iddomain.DeviceRegistrationResult{
+		{Line: 1, Status: iddomain.DeviceRegistrationRegistered},
+		{Line: 2, Status: iddomain.DeviceRegistrationRegistered},
+		{Line: 3, Status: iddomain.DeviceRegistrationExists},
+	}
+
+	identityMock := &mocks.Identity{}
+	identityMock.On("RegisterDevices", mock.MatchedBy(func(req *service.RegisterDevicesRequest) bool {
+		return req.OrganizationID == "abc" && req.Format == "csv" && string(req.Data) == string(data)
+	})).Return(invalid, nil).Once()
+	identityMock.On("RegisterDevices", mock.Anything).Return(registered, nil).Once()
+	srv := Management{DS: memory.NewStore(), Identity: identityMock}
+
+	got := srv.RegisterDevices("abc", "jamesj", 200, "csv", false, data)
+	assert.Empty(t, got.Code)
+	assert.Empty(t, got.Results)
+	assert.NotZero(t, got.JobID)
+
+	var job domain.Job
+	assert.Eventually(t, func() bool {
+		job, _ = srv.JobGet("abc", "jamesj", 200, got.JobID)
+		return job.Status != domain.JobStatusWaiting
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, domain.JobKindRegistration, job.Kind)
+	assert.Equal(t, domain.JobStatusFailed, job.Status)
+	assert.Equal(t, "no devices were registered, 3 of 3 devices could not be registered", job.Steps[0].Message)
+	var results []iddomain.DeviceRegistrationResult
+	assert.NoError(t, json.Unmarshal(job.Result, &results))
+	assert.Equal(t, invalid, results)
+
+	// The upload is kept until it is registered, so the job can be resumed
+	job, err := srv.JobResume("abc", "jamesj", 200, got.JobID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.JobStatusCompleted, job.Status)
+	assert.Equal(t, "2 registered, 1 already registered", job.Steps[0].Message)
+	assert.NoError(t, json.Unmarshal(job.Result, &results))
+	assert.Equal(t, registered, results)
+
+	stored, err := srv.DS.JobGet(got.JobID)
+	assert.NoError(t, err)
+	assert.NotContains(t, stored.Parameters, "DR1000A1")
+}
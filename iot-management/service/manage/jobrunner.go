@@ -0,0 +1,60 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"context"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// JobRunner is a supervised service that periodically runs the jobs waiting on a device
+type JobRunner struct {
+	srv *Management
+}
+
+// NewJobRunner creates the service that runs the waiting jobs of the management service
+func NewJobRunner(srv *Management) *JobRunner {
+	return &JobRunner{srv: srv}
+}
+
+// Serve runs the waiting jobs every interval until the context is done
+func (r *JobRunner) Serve(ctx context.Context) error {
+	interval := viper.GetDuration(keys.JobsInterval)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := r.srv.RunWaitingJobs(); err != nil {
+				log.Errorf("Error running the waiting jobs: %v", err)
+			}
+		}
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
 	"github.com/everactive/dmscore/iot-devicetwin/service/controller"
 	"github.com/everactive/dmscore/iot-devicetwin/web"
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
 	"github.com/everactive/dmscore/iot-identity/service"
 	idweb "github.com/everactive/dmscore/iot-identity/web"
 	"github.com/everactive/dmscore/iot-management/datastore"
@@ -39,20 +40,34 @@ import (
 // Manage interface for the service
 type Manage interface {
 	OpenIDNonceStore() openid.NonceStore
-	CreateUser(user domain.User) error
+	CreateUser(username string, user domain.User) error
 	GetUser(username string) (domain.User, error)
 	UserList() ([]domain.User, error)
-	UserUpdate(user domain.User) error
-	UserDelete(username string) error
+	UserUpdate(username string, user domain.User) error
+	UserDelete(username, target string) error
+	UserSync(provider string, user domain.User, orgRoles map[string]string) error
+
+	APITokenList(username string, role int) ([]domain.APIToken, error)
+	APITokenCreate(username string, role int, req domain.APITokenRequest) (domain.APIToken, string, error)
+	APITokenRevoke(username string, role int, id int64) error
+	APITokenVerify(secret string) (domain.User, error)
 
 	RegDeviceList(orgID, username string, role int) idweb.DevicesResponse
 	RegisterDevice(orgID, username string, role int, body []byte) idweb.RegisterResponse
+	RegisterDevices(orgID, username string, role int, format string, bestEffort bool, body []byte) idweb.RegisterDevicesResponse
 	RegDeviceGet(orgID, username string, role int, deviceID string) idweb.EnrollResponse
 	RegDeviceUpdate(orgID, username string, role int, deviceID string, body []byte) idweb.StandardResponse
+	RegDeviceRevoke(orgID, username string, role int, deviceID string, body []byte) idweb.StandardResponse
+	RegDeviceExpiring(orgID, username string, role int, days int) idweb.DevicesResponse
 
 	DeviceList(orgID, username string, role int) web.DevicesResponse
 	DeviceGet(orgID, username string, role int, deviceID string) web.DeviceResponse
-	DeviceDelete(orgID, username string, role int, deviceID string) web.StandardResponse
+	DeviceDelete(orgID, username string, role int, deviceID string) (domain.Job, error)
+	DeviceTransfer(orgID, username string, role int, deviceID string, body []byte) (domain.Job, error)
+	DeviceTransferList(orgID, username string, role int, deviceID string) ([]domain.DeviceTransfer, error)
+	DeviceReplace(orgID, username string, role int, deviceID string, body []byte) (domain.Job, error)
+	DeviceDeletedList(orgID, username string, role int) ([]domain.DeletedDevice, error)
+	DeviceRestore(orgID, username string, role int, deviceID string) (domain.DeletedDevice, error)
 	DeviceLogs(orgID, username string, role int, deviceID string, logs *messages.DeviceLogs) web.StandardResponse
 	DeviceUsersAction(orgID, username string, role int, deviceID string, deviceUser messages.DeviceUser) web.StandardResponse
 	ActionList(orgID, username string, role int, deviceID string) web.ActionsResponse
@@ -74,14 +89,44 @@ type Manage interface {
 	//GroupDeviceUnlink(orgID, username string, role int, name, deviceID string) web.StandardResponse
 
 	OrganizationsForUser(username string) ([]domain.Organization, error)
-	OrganizationForUserToggle(orgID, username string) error
+	OrganizationForUserToggle(orgID, username, member string) error
 	OrganizationGet(orgID string) (domain.Organization, error)
-	OrganizationCreate(org domain.OrganizationCreate) error
-	OrganizationUpdate(org domain.Organization) error
+	OrganizationCreate(username string, org domain.OrganizationCreate) error
+	OrganizationUpdate(username string, org domain.Organization) error
+	OrganizationCABundle(orgID, username string, role int) ([]byte, error)
+	OrganizationRoleList(orgID, username string, role int) ([]domain.OrganizationRole, error)
+	OrganizationRoleSet(orgID, username string, role int, member, orgRole string) error
+	OrganizationRoleDelete(orgID, username string, role int, member string) error
+	OrganizationCARotate(orgID, username string, req service.RotateOrganizationCARequest) error
+
+	AccountKeyList() ([]iddomain.AccountKey, error)
+	AccountKeyAdd(username string, assertions []byte) ([]iddomain.AccountKey, error)
+	AccountKeyDelete(username, signKeyID string) error
+	AccountKeysRefresh(username string) error
+
+	AutoRegistrationRuleList() ([]iddomain.AutoRegistrationRule, error)
+	AutoRegistrationRuleCreate(username string, rule iddomain.AutoRegistrationRule) (uint, error)
+	AutoRegistrationRuleUpdate(username string, rule iddomain.AutoRegistrationRule) error
+	AutoRegistrationRuleDelete(username string, ruleID uint) error
+	AutoRegistrationEvaluate(assertions []byte) (*iddomain.AutoRegistrationEvaluation, error)
+
+	EnrollmentRequestList(status string) ([]iddomain.EnrollmentRequest, error)
+	EnrollmentRequestApprove(requestID uint, username string, req service.ApproveEnrollmentRequest) (string, error)
+	EnrollmentRequestReject(requestID uint, username string) error
 
 	AddModelRequiredSnap(orgID, username, modelName, snapName string, role int) (*models.DeviceModelRequiredSnap, error)
 	GetModelRequiredSnaps(orgID, username, modelName string, role int) (*models.DeviceModel, error)
 	DeleteModelRequiredSnap(orgID, username, modelName, snapName string, role int) error
+
+	DriftedDevices(orgID, username string, role int) ([]models.HealthHash, error)
+
+	JobList(orgID, username string, role int) ([]domain.Job, error)
+	JobGet(orgID, username string, role int, jobID int64) (domain.Job, error)
+	JobResume(orgID, username string, role int, jobID int64) (domain.Job, error)
+
+	RetentionReport() (domain.RetentionReport, error)
+
+	AuditList(username string, role int, filter domain.AuditFilter) ([]domain.AuditEntry, error)
 }
 
 // Management implementation of the management service use cases
@@ -100,6 +145,7 @@ func NewManagement(dss *datastores.DataStores, api twinapi.Client, id identityap
 	return &Management{
 		DSS:                  dss,
 		DS:                   dss.ManagementStore,
+		DB:                   dss.GetDatabase(),
 		TwinAPI:              api,
 		IdentityAPI:          id,
 		DeviceTwinController: dtc,
@@ -20,6 +20,8 @@
 package manage
 
 import (
+	"fmt"
+
 	"github.com/everactive/dmscore/iot-identity/service"
 
 	"github.com/everactive/dmscore/iot-management/datastore"
@@ -43,9 +45,93 @@ func (srv *Management) OrganizationsForUser(username string) ([]domain.Organizat
 	return oo, nil
 }
 
-// OrganizationForUserToggle toggles organization access for a user
-func (srv *Management) OrganizationForUserToggle(orgID, username string) error {
-	return srv.DS.OrganizationForUserToggle(orgID, username)
+// OrganizationForUserToggle toggles organization access for a member
+func (srv *Management) OrganizationForUserToggle(orgID, username, member string) error {
+	err := srv.DS.OrganizationForUserToggle(orgID, member)
+	srv.audit(auditEntry(username, orgID, datastore.AuditTargetUser, member, "organization.member-toggle"), nil, err)
+	return err
+}
+
+// OrganizationRoleList lists the members of an organization with their roles
+func (srv *Management) OrganizationRoleList(orgID, username string, role int) ([]domain.OrganizationRole, error) {
+	if !srv.orgAccess(orgID, username, role, PermissionAdminister) {
+		return nil, NotAuthorizedErr
+	}
+
+	members, err := srv.DS.OrgUserRoleList(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []domain.OrganizationRole{}
+	for _, m := range members {
+		roles = append(roles, domain.OrganizationRole{Username: m.Username, Role: m.Role})
+	}
+	return roles, nil
+}
+
+// OrganizationRoleSet assigns a role to a user in an organization, making them a member if they are not one
+func (srv *Management) OrganizationRoleSet(orgID, username string, role int, member, orgRole string) (err error) {
+	entry := auditEntry(username, orgID, datastore.AuditTargetUser, member, "organization.role-set")
+	defer func() { srv.audit(entry, map[string]string{"role": orgRole}, err) }()
+
+	if !srv.orgAccess(orgID, username, role, PermissionAdminister) {
+		return NotAuthorizedErr
+	}
+	if !ValidOrgRole(orgRole) {
+		return fmt.Errorf("invalid organization role `%s`", orgRole)
+	}
+
+	org, err := srv.DS.OrganizationGet(orgID)
+	if err != nil || org.OrganizationID != orgID {
+		return fmt.Errorf("organization not found: %s", orgID)
+	}
+	if _, err := srv.DS.GetUser(member); err != nil {
+		return fmt.Errorf("user not found: %s", member)
+	}
+	if orgRole != datastore.OrgAdmin {
+		if err := srv.checkNotLastOrgAdmin(orgID, member); err != nil {
+			return err
+		}
+	}
+
+	return srv.DS.OrgUserRoleSet(orgID, member, orgRole)
+}
+
+// OrganizationRoleDelete removes a user from an organization
+func (srv *Management) OrganizationRoleDelete(orgID, username string, role int, member string) (err error) {
+	entry := auditEntry(username, orgID, datastore.AuditTargetUser, member, "organization.role-delete")
+	defer func() { srv.audit(entry, nil, err) }()
+
+	if !srv.orgAccess(orgID, username, role, PermissionAdminister) {
+		return NotAuthorizedErr
+	}
+	if err := srv.checkNotLastOrgAdmin(orgID, member); err != nil {
+		return err
+	}
+	return srv.DS.OrgUserRoleDelete(orgID, member)
+}
+
+// checkNotLastOrgAdmin stops the last org-admin of an organization being removed or given another role, which would
+// leave the organization without a member that can manage it
+func (srv *Management) checkNotLastOrgAdmin(orgID, member string) error {
+	members, err := srv.DS.OrgUserRoleList(orgID)
+	if err != nil {
+		return err
+	}
+
+	isAdmin := false
+	admins := 0
+	for _, m := range members {
+		if m.Role == datastore.OrgAdmin {
+			admins++
+			isAdmin = isAdmin || m.Username == member
+		}
+	}
+	if isAdmin && admins == 1 {
+		return fmt.Errorf("`%s` is the last org-admin of the organization", member)
+	}
+	return nil
 }
 
 // OrganizationGet fetches an organization
@@ -61,15 +147,22 @@ func (srv *Management) OrganizationGet(orgID string) (domain.Organization, error
 }
 
 // OrganizationCreate creates a new organization
-func (srv *Management) OrganizationCreate(org domain.OrganizationCreate) error {
+func (srv *Management) OrganizationCreate(username string, org domain.OrganizationCreate) (err error) {
+	entry := auditEntry(username, "", datastore.AuditTargetOrganization, "", "organization.create")
+	defer func() { srv.audit(entry, org, err) }()
+
 	organizationID, err := srv.Identity.RegisterOrganization(&service.RegisterOrganizationRequest{
 		Name:        org.Name,
 		CountryName: org.Country,
+		RootCert:    org.RootCert,
+		RootKey:     org.RootKey,
 	})
 	if err != nil {
 		return err
 	}
 
+	entry.OrganizationID, entry.Target = organizationID, organizationID
+
 	// Create the organization in the local database with the generated ID
 	o := datastore.Organization{
 		OrganizationID: organizationID,
@@ -79,11 +172,28 @@ func (srv *Management) OrganizationCreate(org domain.OrganizationCreate) error {
 }
 
 // OrganizationUpdate updates an organization
-func (srv *Management) OrganizationUpdate(org domain.Organization) error {
+func (srv *Management) OrganizationUpdate(username string, org domain.Organization) error {
 	o := datastore.Organization{
 		OrganizationID: org.OrganizationID,
 		Name:           org.Name,
 	}
 
-	return srv.DS.OrganizationUpdate(o)
+	err := srv.DS.OrganizationUpdate(o)
+	srv.audit(auditEntry(username, org.OrganizationID, datastore.AuditTargetOrganization, org.OrganizationID, "organization.update"), org, err)
+	return err
+}
+
+// OrganizationCABundle fetches the PEM bundle of the CAs that issue an organization's device certificates
+func (srv *Management) OrganizationCABundle(orgID, username string, role int) ([]byte, error) {
+	if !srv.orgAccess(orgID, username, role, PermissionView) {
+		return nil, fmt.Errorf("the user does not have permissions for the organization")
+	}
+	return srv.Identity.OrganizationCABundle(orgID)
+}
+
+// OrganizationCARotate replaces the CA of an organization, keeping the current one trusted for the overlap period
+func (srv *Management) OrganizationCARotate(orgID, username string, req service.RotateOrganizationCARequest) error {
+	err := srv.Identity.RotateOrganizationCA(orgID, &req)
+	srv.audit(auditEntry(username, orgID, datastore.AuditTargetOrganization, orgID, "organization.ca-rotate"), req, err)
+	return err
 }
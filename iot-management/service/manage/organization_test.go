@@ -21,10 +21,13 @@ package manage
 
 import (
 	"errors"
+	"github.com/everactive/dmscore/iot-identity/service"
 	"github.com/everactive/dmscore/iot-identity/service/mocks"
 	"github.com/stretchr/testify/mock"
+	"strings"
 	"testing"
 
+	"github.com/everactive/dmscore/iot-management/datastore"
 	"github.com/everactive/dmscore/iot-management/datastore/memory"
 	"github.com/everactive/dmscore/iot-management/domain"
 )
@@ -130,7 +133,7 @@ func TestManagement_OrganizationCreate(t *testing.T) {
 				DeviceTwinController: nil,
 				Identity:             identityMock,
 			}
-			if err := srv.OrganizationCreate(tt.args.org); (err != nil) != tt.wantErr {
+			if err := srv.OrganizationCreate("jamesj", tt.args.org); (err != nil) != tt.wantErr {
 				t.Errorf("Management.OrganizationCreate() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -158,7 +161,7 @@ func TestManagement_OrganizationUpdate(t *testing.T) {
 				DeviceTwinController: nil,
 				Identity:             nil,
 			}
-			if err := srv.OrganizationUpdate(tt.args.org); (err != nil) != tt.wantErr {
+			if err := srv.OrganizationUpdate("jamesj", tt.args.org); (err != nil) != tt.wantErr {
 				t.Errorf("Management.OrganizationUpdate() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -187,9 +190,154 @@ func TestManagement_OrganizationForUserToggle(t *testing.T) {
 				DeviceTwinController: nil,
 				Identity:             nil,
 			}
-			if err := srv.OrganizationForUserToggle(tt.args.orgID, tt.args.username); (err != nil) != tt.wantErr {
+			if err := srv.OrganizationForUserToggle(tt.args.orgID, "jamesj", tt.args.username); (err != nil) != tt.wantErr {
 				t.Errorf("Management.OrganizationForUserToggle() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestManagement_OrganizationCABundle(t *testing.T) {
+	type args struct {
+		orgID    string
+		username string
+		role     int
+	}
+	tests := []struct {
+		name        string
+		args        args
+		identityErr error
+		wantErr     bool
+	}{
+		{"valid", args{"abc", "jamesj", 200}, nil, false},
+		{"valid-superuser", args{"def", "invalid", 300}, nil, false},
+		{"invalid-user", args{"abc", "invalid", 200}, nil, true},
+		{"invalid-org", args{"invalid", "jamesj", 300}, errors.New("organization not found"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("OrganizationCABundle", tt.args.orgID).Return([]byte("BUNDLE"), tt.identityErr)
+
+			srv := Management{
+				DS:       memory.NewStore(),
+				Identity: identityMock,
+			}
+			got, err := srv.OrganizationCABundle(tt.args.orgID, tt.args.username, tt.args.role)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Management.OrganizationCABundle() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && string(got) != "BUNDLE" {
+				t.Errorf("Management.OrganizationCABundle() = %s, want BUNDLE", got)
+			}
+		})
+	}
+}
+
+func TestManagement_OrganizationCARotate(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         service.RotateOrganizationCARequest
+		identityErr error
+		wantErr     bool
+	}{
+		{"valid", service.RotateOrganizationCARequest{Overlap: "24h"}, nil, false},
+		{"invalid", service.RotateOrganizationCARequest{Overlap: "soon"}, errors.New("invalid overlap"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			identityMock.On("RotateOrganizationCA", "abc", &tt.req).Return(tt.identityErr)
+
+			srv := Management{
+				DS:       memory.NewStore(),
+				Identity: identityMock,
+			}
+			if err := srv.OrganizationCARotate("abc", "jamesj", tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("Management.OrganizationCARotate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagement_OrganizationRoles(t *testing.T) {
+	type args struct {
+		orgID   string
+		role    int
+		member  string
+		orgRole string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    int
+		wantErr bool
+	}{
+		{"valid", args{"abc", 200, "jamesj", datastore.OrgOperator}, 2, false},
+		{"valid-superuser", args{"abc", 300, "jamesj", datastore.OrgViewer}, 2, false},
+		{"invalid-role", args{"abc", 200, "jamesj", "owner"}, 2, true},
+		{"invalid-member", args{"abc", 200, "unknown", datastore.OrgViewer}, 2, true},
+		{"invalid-org", args{"invalid", 300, "jamesj", datastore.OrgViewer}, 0, true},
+		{"invalid-permissions", args{"invalid", 200, "jamesj", datastore.OrgViewer}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := Management{DS: newOrgAdminsStore()}
+
+			err := srv.OrganizationRoleSet(tt.args.orgID, "jamesj", tt.args.role, tt.args.member, tt.args.orgRole)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Management.OrganizationRoleSet() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			roles, _ := srv.OrganizationRoleList(tt.args.orgID, "jamesj", datastore.Superuser)
+			if len(roles) != tt.want {
+				t.Errorf("Management.OrganizationRoleList() = %v, want %v", len(roles), tt.want)
+			}
+			if !tt.wantErr && roles[0].Role != tt.args.orgRole {
+				t.Errorf("Management.OrganizationRoleList() role = %v, want %v", roles[0].Role, tt.args.orgRole)
+			}
+		})
+	}
+}
+
+// newOrgAdminsStore creates a store where jamesj is not the last org-admin of the organization
+func newOrgAdminsStore() *memory.Store {
+	db := memory.NewStore()
+	db.OrgUsers = append(db.OrgUsers, datastore.OrganizationUser{OrganizationID: "abc", Username: "maryj", Role: datastore.OrgAdmin})
+	return db
+}
+
+func TestManagement_OrganizationRoleDelete(t *testing.T) {
+	srv := Management{DS: newOrgAdminsStore()}
+
+	if err := srv.OrganizationRoleDelete("abc", "sarahj", 200, "jamesj"); err != NotAuthorizedErr {
+		t.Errorf("Management.OrganizationRoleDelete() error = %v, want %v", err, NotAuthorizedErr)
+	}
+	if err := srv.OrganizationRoleDelete("abc", "jamesj", 200, "jamesj"); err != nil {
+		t.Errorf("Management.OrganizationRoleDelete() error = %v", err)
+	}
+	if srv.DS.OrgUserAccess("abc", "jamesj", 200) {
+		t.Error("Management.OrganizationRoleDelete() the user is still a member of the organization")
+	}
+}
+
+func TestManagement_OrganizationRoleLastAdmin(t *testing.T) {
+	srv := Management{DS: memory.NewStore()}
+
+	if err := srv.OrganizationRoleSet("abc", "jamesj", 200, "jamesj", datastore.OrgViewer); err == nil || !strings.Contains(err.Error(), "last org-admin") {
+		t.Errorf("Management.OrganizationRoleSet() error = %v, want the last org-admin", err)
+	}
+	if err := srv.OrganizationRoleDelete("abc", "jamesj", 200, "jamesj"); err == nil || !strings.Contains(err.Error(), "last org-admin") {
+		t.Errorf("Management.OrganizationRoleDelete() error = %v, want the last org-admin", err)
+	}
+	if err := srv.OrganizationRoleSet("abc", "jamesj", 200, "jamesj", datastore.OrgAdmin); err != nil {
+		t.Errorf("Management.OrganizationRoleSet() error = %v", err)
+	}
+
+	role, _ := srv.DS.OrgUserRole("abc", "jamesj")
+	if role != datastore.OrgAdmin {
+		t.Errorf("Management.OrganizationRoleSet() role = %v, want %v", role, datastore.OrgAdmin)
+	}
+}
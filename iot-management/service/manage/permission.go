@@ -0,0 +1,90 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"github.com/everactive/dmscore/iot-management/datastore"
+	log "github.com/sirupsen/logrus"
+)
+
+// Permission is a set of use cases a user can be granted in an organization
+type Permission string
+
+// Available permissions
+const (
+	// PermissionView allows listing and fetching the devices, registrations, snaps, actions and jobs
+	PermissionView Permission = "view"
+	// PermissionOperate allows installing, removing, updating and configuring snaps, and requesting logs and snapshots
+	PermissionOperate Permission = "operate"
+	// PermissionAdminister allows registering, deleting, transferring, replacing and restoring devices, managing
+	// device users and required snaps, resuming jobs and assigning the roles of the organization
+	PermissionAdminister Permission = "administer"
+)
+
+// rolePermissions is the permission matrix of the organization roles
+var rolePermissions = map[string][]Permission{
+	datastore.OrgViewer:   {PermissionView},
+	datastore.OrgOperator: {PermissionView, PermissionOperate},
+	datastore.OrgAdmin:    {PermissionView, PermissionOperate, PermissionAdminister},
+}
+
+// ValidOrgRole checks that the organization role is one of the available roles
+func ValidOrgRole(orgRole string) bool {
+	_, ok := rolePermissions[orgRole]
+	return ok
+}
+
+// orgAccess checks that the user is a member of the organization with a role that has the permission.
+// Superusers have all the permissions in every organization.
+func (srv *Management) orgAccess(orgID, username string, role int, permission Permission) bool {
+	if !srv.DS.OrgUserAccess(orgID, username, role) {
+		return false
+	}
+	if role == datastore.Superuser {
+		return true
+	}
+
+	orgRole, err := srv.DS.OrgUserRole(orgID, username)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+
+	return hasPermission(orgRole, permission)
+}
+
+func hasPermission(orgRole string, permission Permission) bool {
+	for _, p := range rolePermissions[orgRole] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// orgRoleCovers checks that an organization role has all the permissions of another
+func orgRoleCovers(orgRole, other string) bool {
+	for _, p := range rolePermissions[other] {
+		if !hasPermission(orgRole, p) {
+			return false
+		}
+	}
+	return true
+}
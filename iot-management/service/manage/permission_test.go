@@ -0,0 +1,83 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"testing"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+)
+
+func TestManagement_orgAccess(t *testing.T) {
+	type args struct {
+		orgRole    string
+		role       int
+		permission Permission
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{"viewer-view", args{datastore.OrgViewer, datastore.Admin, PermissionView}, true},
+		{"viewer-operate", args{datastore.OrgViewer, datastore.Admin, PermissionOperate}, false},
+		{"viewer-administer", args{datastore.OrgViewer, datastore.Admin, PermissionAdminister}, false},
+		{"operator-view", args{datastore.OrgOperator, datastore.Admin, PermissionView}, true},
+		{"operator-operate", args{datastore.OrgOperator, datastore.Admin, PermissionOperate}, true},
+		{"operator-administer", args{datastore.OrgOperator, datastore.Admin, PermissionAdminister}, false},
+		{"org-admin-view", args{datastore.OrgAdmin, datastore.Standard, PermissionView}, true},
+		{"org-admin-operate", args{datastore.OrgAdmin, datastore.Standard, PermissionOperate}, true},
+		{"org-admin-administer", args{datastore.OrgAdmin, datastore.Standard, PermissionAdminister}, true},
+		{"superuser-viewer", args{datastore.OrgViewer, datastore.Superuser, PermissionAdminister}, true},
+		{"invalid-role", args{"invalid", datastore.Admin, PermissionView}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewStore()
+			_ = db.OrgUserRoleSet("abc", "jamesj", tt.args.orgRole)
+			srv := Management{DS: db}
+
+			if got := srv.orgAccess("abc", "jamesj", tt.args.role, tt.args.permission); got != tt.want {
+				t.Errorf("Management.orgAccess() = %v, want %v", got, tt.want)
+			}
+			if srv.orgAccess("abc", "sarahj", tt.args.role, tt.args.permission) && tt.args.role != datastore.Superuser {
+				t.Error("Management.orgAccess() a user that is not a member has access")
+			}
+		})
+	}
+}
+
+func TestManagement_orgAccessMethods(t *testing.T) {
+	db := memory.NewStore()
+	_ = db.OrgUserRoleSet("abc", "jamesj", datastore.OrgViewer)
+	srv := Management{DS: db}
+
+	// A viewer cannot change the devices, their snaps or the roles of the organization
+	if resp := srv.SnapConfigSet("abc", "jamesj", datastore.Admin, "a111", "helloworld", []byte("{}")); resp.Code != "SnapAuth" {
+		t.Errorf("Management.SnapConfigSet() = %v, want SnapAuth", resp.Code)
+	}
+	if _, err := srv.DeviceDelete("abc", "jamesj", datastore.Admin, "a111"); err != NotAuthorizedErr {
+		t.Errorf("Management.DeviceDelete() error = %v, want %v", err, NotAuthorizedErr)
+	}
+	if err := srv.OrganizationRoleSet("abc", "jamesj", datastore.Admin, "jamesj", datastore.OrgAdmin); err != NotAuthorizedErr {
+		t.Errorf("Management.OrganizationRoleSet() error = %v, want %v", err, NotAuthorizedErr)
+	}
+}
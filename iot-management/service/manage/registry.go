@@ -20,14 +20,25 @@
 package manage
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
 	"github.com/everactive/dmscore/iot-identity/service"
 	"github.com/everactive/dmscore/iot-identity/web"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
 // RegDeviceList gets the registered devices a user can access for an organization
 func (srv *Management) RegDeviceList(orgID, username string, role int) web.DevicesResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionView)
 	if !hasAccess {
 		return web.DevicesResponse{
 			StandardResponse: web.StandardResponse{
@@ -53,8 +64,14 @@ func (srv *Management) RegDeviceList(orgID, username string, role int) web.Devic
 }
 
 // RegisterDevice registers a new device
-func (srv *Management) RegisterDevice(orgID, username string, role int, body []byte) web.RegisterResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+func (srv *Management) RegisterDevice(orgID, username string, role int, body []byte) (response web.RegisterResponse) {
+	entry := deviceAudit(username, orgID, "", "registration.create")
+	defer func() {
+		entry.Target = response.ID
+		srv.audit(entry, body, responseError(response.Code, response.Message))
+	}()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionAdminister)
 	if !hasAccess {
 		return web.RegisterResponse{
 			StandardResponse: web.StandardResponse{
@@ -90,9 +107,81 @@ func (srv *Management) RegisterDevice(orgID, username string, role int, body []b
 	}
 }
 
+// RegisterDevices registers devices in bulk from CSV or JSON lines, and reports the outcome for each of them. An upload
+// of more lines than the job threshold is registered by a background job, and the response is the job ID.
+func (srv *Management) RegisterDevices(orgID, username string, role int, format string, bestEffort bool, body []byte) (response web.RegisterDevicesResponse) {
+	entry := auditEntry(username, orgID, "", "", "registration.bulk")
+	defer func() {
+		payload := map[string]interface{}{"format": format, "bestEffort": bestEffort, "bytes": len(body), "devices": len(response.Results)}
+		if response.JobID > 0 {
+			payload["job"] = response.JobID
+		}
+		srv.audit(entry, payload, responseError(response.Code, response.Message))
+	}()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionAdminister)
+	if !hasAccess {
+		return web.RegisterDevicesResponse{
+			StandardResponse: web.StandardResponse{
+				Code:    "RegDeviceAuth",
+				Message: "the user does not have permissions for the organization",
+			},
+		}
+	}
+
+	threshold := viper.GetInt(keys.RegistrationJobThreshold)
+	if threshold > 0 && bytes.Count(bytes.TrimSpace(body), []byte("\n"))+1 > threshold {
+		job, err := srv.registrationJob(orgID, username, format, bestEffort, body)
+		if err != nil {
+			return web.RegisterDevicesResponse{
+				StandardResponse: web.StandardResponse{
+					Code:    "RegDevices",
+					Message: err.Error(),
+				},
+			}
+		}
+		return web.RegisterDevicesResponse{Results: []iddomain.DeviceRegistrationResult{}, JobID: job.ID}
+	}
+
+	request := service.RegisterDevicesRequest{
+		OrganizationID: orgID,
+		Format:         format,
+		Data:           body,
+		BestEffort:     bestEffort,
+	}
+	results, err := srv.Identity.RegisterDevices(&request)
+	if err != nil {
+		return web.RegisterDevicesResponse{
+			StandardResponse: web.StandardResponse{
+				Code:    "RegDevices",
+				Message: err.Error(),
+			},
+		}
+	}
+
+	return registrationResponse(results, bestEffort)
+}
+
+// registrationResponse is the report of a bulk registration, which fails in transaction mode if any device
+// could not be registered
+func registrationResponse(results []iddomain.DeviceRegistrationResult, bestEffort bool) web.RegisterDevicesResponse {
+	response := web.RegisterDevicesResponse{Results: results}
+	failed := 0
+	for _, r := range results {
+		if r.Status != iddomain.DeviceRegistrationRegistered && r.Status != iddomain.DeviceRegistrationExists {
+			failed++
+		}
+	}
+	if failed > 0 && !bestEffort {
+		response.Code = "RegDevices"
+		response.Message = fmt.Sprintf("no devices were registered, %d of %d devices could not be registered", failed, len(results))
+	}
+	return response
+}
+
 // RegDeviceGet fetches a device registration
 func (srv *Management) RegDeviceGet(orgID, username string, role int, deviceID string) web.EnrollResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionView)
 	if !hasAccess {
 		return web.EnrollResponse{
 			StandardResponse: web.StandardResponse{
@@ -119,8 +208,11 @@ func (srv *Management) RegDeviceGet(orgID, username string, role int, deviceID s
 }
 
 // RegDeviceUpdate updates a device registration
-func (srv *Management) RegDeviceUpdate(orgID, username string, role int, deviceID string, body []byte) web.StandardResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+func (srv *Management) RegDeviceUpdate(orgID, username string, role int, deviceID string, body []byte) (response web.StandardResponse) {
+	entry := deviceAudit(username, orgID, deviceID, "registration.update")
+	defer func() { srv.audit(entry, body, responseError(response.Code, response.Message)) }()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionAdminister)
 	if !hasAccess {
 		return web.StandardResponse{
 			Code:    "RegDeviceAuth",
@@ -147,3 +239,173 @@ func (srv *Management) RegDeviceUpdate(orgID, username string, role int, deviceI
 
 	return web.StandardResponse{}
 }
+
+// RegDeviceRevoke revokes the certificate of a registered device
+func (srv *Management) RegDeviceRevoke(orgID, username string, role int, deviceID string, body []byte) (response web.StandardResponse) {
+	entry := deviceAudit(username, orgID, deviceID, "registration.revoke")
+	defer func() { srv.audit(entry, body, responseError(response.Code, response.Message)) }()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionAdminister)
+	if !hasAccess {
+		return web.StandardResponse{
+			Code:    "RegDeviceAuth",
+			Message: "the user does not have permissions for the organization",
+		}
+	}
+
+	request := service.DeviceRevokeRequest{}
+	if len(body) > 0 {
+		err := json.Unmarshal(body, &request)
+		if err != nil {
+			return web.StandardResponse{
+				Code:    "RegDeviceRevoke",
+				Message: err.Error(),
+			}
+		}
+	}
+
+	enroll, err := srv.Identity.DeviceGet(orgID, deviceID)
+	if err != nil || enroll.Organization.ID != orgID {
+		return web.StandardResponse{
+			Code:    "RegDeviceRevoke",
+			Message: "the device does not belong to the organization",
+		}
+	}
+
+	err = srv.Identity.RevokeDevice(deviceID, request.Reason)
+	if err != nil {
+		return web.StandardResponse{
+			Code:    "RegDeviceRevoke",
+			Message: err.Error(),
+		}
+	}
+
+	return web.StandardResponse{}
+}
+
+// RegDeviceExpiring lists the registered devices of an organization whose certificate expires within the number of days
+func (srv *Management) RegDeviceExpiring(orgID, username string, role int, days int) web.DevicesResponse {
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionView)
+	if !hasAccess {
+		return web.DevicesResponse{
+			StandardResponse: web.StandardResponse{
+				Code:    "RegDevicesAuth",
+				Message: "the user does not have permissions for the organization",
+			},
+		}
+	}
+
+	list, err := srv.Identity.DeviceCertificatesExpiring(orgID, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		return web.DevicesResponse{
+			StandardResponse: web.StandardResponse{
+				Code:    "RegDeviceExpiring",
+				Message: err.Error(),
+			},
+		}
+	}
+
+	return web.DevicesResponse{
+		Devices: list,
+	}
+}
+
+// registrationStepRegister is the step of a bulk registration job
+const registrationStepRegister = "register"
+
+var registrationSteps = map[string]jobStepFunc{
+	registrationStepRegister: registrationRegister,
+}
+
+// registrationParameters are the upload of a bulk registration job and, once it has run, the results. The upload is
+// dropped once the devices are registered.
+type registrationParameters struct {
+	Format     string                              `json:"format"`
+	BestEffort bool                                `json:"bestEffort"`
+	Data       string                              `json:"data,omitempty"`
+	Results    []iddomain.DeviceRegistrationResult `json:"results,omitempty"`
+}
+
+// registrationJob creates a job to register an upload in the background, and starts it
+func (srv *Management) registrationJob(orgID, username, format string, bestEffort bool, body []byte) (datastore.Job, error) {
+	params, err := json.Marshal(registrationParameters{Format: format, BestEffort: bestEffort, Data: string(body)})
+	if err != nil {
+		return datastore.Job{}, err
+	}
+
+	job := datastore.Job{
+		Kind:           domain.JobKindRegistration,
+		OrganizationID: orgID,
+		Username:       username,
+		Status:         domain.JobStatusWaiting,
+		Parameters:     string(params),
+	}
+	job, err = srv.createJob(job, []string{registrationStepRegister}, nil)
+	if err != nil {
+		return datastore.Job{}, err
+	}
+
+	// The job runner picks the job up if it doesn't run now, e.g. on a restart
+	go func() {
+		if err := srv.runWaitingJob(job.ID); err != nil {
+			log.Errorf("Error running bulk registration job %d: %v", job.ID, err)
+		}
+	}()
+	return job, nil
+}
+
+// registrationRegister registers the devices of the upload, keeping the results on the job
+func registrationRegister(srv *Management, job *datastore.Job, step *datastore.JobStep) error {
+	params := registrationParameters{}
+	if err := json.Unmarshal([]byte(job.Parameters), &params); err != nil {
+		return fmt.Errorf("invalid job parameters: %v", err)
+	}
+
+	results, err := srv.Identity.RegisterDevices(&service.RegisterDevicesRequest{
+		OrganizationID: job.OrganizationID,
+		Format:         params.Format,
+		Data:           []byte(params.Data),
+		BestEffort:     params.BestEffort,
+	})
+	if err != nil {
+		return err
+	}
+
+	response := registrationResponse(results, params.BestEffort)
+	params.Results = results
+	if len(response.Code) == 0 {
+		params.Data = ""
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	job.Parameters = string(b)
+
+	if len(response.Code) > 0 {
+		return errors.New(response.Message)
+	}
+
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	step.Message = fmt.Sprintf("%d registered, %d already registered", counts[iddomain.DeviceRegistrationRegistered], counts[iddomain.DeviceRegistrationExists])
+	if failed := len(results) - counts[iddomain.DeviceRegistrationRegistered] - counts[iddomain.DeviceRegistrationExists]; failed > 0 {
+		step.Message += fmt.Sprintf(", %d not registered", failed)
+	}
+	return nil
+}
+
+// registrationResult is the results of a bulk registration job, once it has run
+func registrationResult(job datastore.Job) json.RawMessage {
+	params := registrationParameters{}
+	if err := json.Unmarshal([]byte(job.Parameters), &params); err != nil || params.Results == nil {
+		return nil
+	}
+	b, err := json.Marshal(params.Results)
+	if err != nil {
+		return nil
+	}
+	return b
+}
@@ -22,10 +22,12 @@ package manage
 import (
 	"errors"
 	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service"
 	"github.com/everactive/dmscore/iot-identity/service/mocks"
 	"github.com/everactive/dmscore/iot-management/datastore"
 	"github.com/stretchr/testify/mock"
 	"testing"
+	"time"
 
 	"github.com/everactive/dmscore/iot-management/datastore/memory"
 )
@@ -52,8 +54,10 @@ func TestManagement_RegDeviceList(t *testing.T) {
 
 			if tt.wantErr {
 				manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(false)
+				manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
 			} else {
 				manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(true)
+				manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
 			}
 
 			identityMock.On("DeviceList", mock.Anything).Return([]domain.Enrollment{}, nil)
@@ -99,10 +103,13 @@ func TestManagement_RegisterDevice(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			manageDataStoreMock := &datastore.MockDataStore{}
+			manageDataStoreMock.On("AuditCreate", mock.Anything).Return(int64(1), nil)
 			identityMock := &mocks.Identity{}
 
 			manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(!tt.wantErr)
 
+			manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
+
 			identityMock.On("RegisterDevice", mock.Anything, mock.Anything).Return("", nil)
 
 			srv := Management{
@@ -121,6 +128,48 @@ func TestManagement_RegisterDevice(t *testing.T) {
 	}
 }
 
+func TestManagement_RegisterDevices(t *testing.T) {
+	registered := []domain.DeviceRegistrationResult{{Line: 1, Status: domain.DeviceRegistrationRegistered}, {Line: 2, Status: domain.DeviceRegistrationExists}}
+	invalid := []domain.DeviceRegistrationResult{{Line: 1, Status: domain.DeviceRegistrationSkipped}, {Line: 2, Status: domain.DeviceRegistrationInvalid}}
+	tests := []struct {
+		name        string
+		access      bool
+		bestEffort  bool
+		results     []domain.DeviceRegistrationResult
+		identityErr error
+		want        string
+	}{
+		{"valid", true, false, registered, nil, ""},
+		{"valid-best-effort", true, true, invalid, nil, ""},
+		{"invalid-transaction", true, false, invalid, nil, "RegDevices"},
+		{"invalid-upload", true, false, nil, errors.New("MOCK error format"), "RegDevices"},
+		{"invalid-permissions", false, false, nil, nil, "RegDeviceAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manageDataStoreMock := &datastore.MockDataStore{}
+			manageDataStoreMock.On("AuditCreate", mock.Anything).Return(int64(1), nil)
+			identityMock := &mocks.Identity{}
+
+			manageDataStoreMock.On("OrgUserAccess", "abc", "jamesj", 300).Return(tt.access)
+
+			manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
+			identityMock.On("RegisterDevices", mock.MatchedBy(func(req *service.RegisterDevicesRequest) bool {
+				return req.OrganizationID == "abc" && req.Format == "csv" && req.BestEffort == tt.bestEffort
+			})).Return(tt.results, tt.identityErr)
+
+			srv := Management{DS: manageDataStoreMock, Identity: identityMock}
+			got := srv.RegisterDevices("abc", "jamesj", 300, "csv", tt.bestEffort, []byte("example,drone-1000,DR1000A1"))
+			if got.Code != tt.want {
+				t.Errorf("Management.RegisterDevices() = %v, want %v", got.Code, tt.want)
+			}
+			if len(got.Results) != len(tt.results) {
+				t.Errorf("Management.RegisterDevices() got %d results, want %d", len(got.Results), len(tt.results))
+			}
+		})
+	}
+}
+
 func TestManagement_RegDeviceGet(t *testing.T) {
 	type args struct {
 		orgID    string
@@ -145,6 +194,8 @@ func TestManagement_RegDeviceGet(t *testing.T) {
 
 			manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(!tt.wantErr)
 
+			manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
+
 			identityMock.On("DeviceGet", mock.Anything, mock.Anything).Return(&domain.Enrollment{}, nil)
 
 			srv := Management{
@@ -208,3 +259,95 @@ func TestManagement_RegDeviceUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestManagement_RegDeviceRevoke(t *testing.T) {
+	d1 := []byte(`{"reason":1}`)
+	type args struct {
+		orgID    string
+		username string
+		role     int
+		deviceID string
+		body     []byte
+	}
+	tests := []struct {
+		name   string
+		args   args
+		reason int
+		want   string
+	}{
+		{"valid", args{"abc", "jamesj", 300, "a111", d1}, 1, ""},
+		{"valid-no-body", args{"abc", "jamesj", 300, "a111", nil}, 0, ""},
+		{"invalid-body", args{"abc", "jamesj", 300, "a111", []byte("{")}, 0, "RegDeviceRevoke"},
+		{"invalid-device", args{"abc", "jamesj", 300, "invalid", d1}, 1, "RegDeviceRevoke"},
+		{"invalid-other-org-device", args{"abc", "jamesj", 300, "b222", d1}, 1, "RegDeviceRevoke"},
+		{"invalid-permissions", args{"abc", "invalid", 100, "a111", d1}, 1, "RegDeviceAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			srv := Management{
+				DS:       memory.NewStore(),
+				Identity: identityMock,
+			}
+
+			enroll := &domain.Enrollment{ID: tt.args.deviceID, Organization: domain.Organization{ID: "abc"}}
+			if tt.args.deviceID == "b222" {
+				enroll.Organization.ID = "def"
+			}
+			identityMock.On("DeviceGet", tt.args.orgID, tt.args.deviceID).Return(enroll, nil)
+			if tt.args.deviceID == "invalid" {
+				identityMock.On("RevokeDevice", tt.args.deviceID, tt.reason).Return(errors.New("device not found"))
+			} else {
+				identityMock.On("RevokeDevice", tt.args.deviceID, tt.reason).Return(nil)
+			}
+
+			got := srv.RegDeviceRevoke(tt.args.orgID, tt.args.username, tt.args.role, tt.args.deviceID, tt.args.body)
+			if got.Code != tt.want {
+				t.Errorf("Management.RegDeviceRevoke() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagement_RegDeviceExpiring(t *testing.T) {
+	type args struct {
+		orgID    string
+		username string
+		role     int
+		days     int
+	}
+	tests := []struct {
+		name  string
+		args  args
+		count int
+		want  string
+	}{
+		{"valid", args{"abc", "jamesj", 300, 30}, 1, ""},
+		{"invalid-org", args{"invalid", "jamesj", 300, 30}, 0, "RegDeviceExpiring"},
+		{"invalid-permissions", args{"abc", "invalid", 100, 30}, 0, "RegDevicesAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := &mocks.Identity{}
+			srv := Management{
+				DS:       memory.NewStore(),
+				Identity: identityMock,
+			}
+
+			within := time.Duration(tt.args.days) * 24 * time.Hour
+			if tt.args.orgID == "invalid" {
+				identityMock.On("DeviceCertificatesExpiring", tt.args.orgID, within).Return(nil, errors.New("org not found"))
+			} else {
+				identityMock.On("DeviceCertificatesExpiring", tt.args.orgID, within).Return([]domain.Enrollment{{ID: "a111"}}, nil)
+			}
+
+			got := srv.RegDeviceExpiring(tt.args.orgID, tt.args.username, tt.args.role, tt.args.days)
+			if got.Code != tt.want {
+				t.Errorf("Management.RegDeviceExpiring() = %v, want %v", got, tt.want)
+			}
+			if len(got.Devices) != tt.count {
+				t.Errorf("Management.RegDeviceExpiring() count = %v, want %v", len(got.Devices), tt.count)
+			}
+		})
+	}
+}
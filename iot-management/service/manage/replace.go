@@ -0,0 +1,336 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	twindatastore "github.com/everactive/dmscore/iot-devicetwin/datastore"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+)
+
+// Steps of a device replacement job
+const (
+	replaceStepDeviceData    = "device-data"
+	replaceStepWaitConnected = "wait-connected"
+	replaceStepGroups        = "groups"
+	replaceStepSnaps         = "snaps"
+	replaceStepSnapConfig    = "snap-config"
+	replaceStepDecommission  = "decommission"
+)
+
+var replaceStepOrder = []string{
+	replaceStepDeviceData,
+	replaceStepWaitConnected,
+	replaceStepGroups,
+	replaceStepSnaps,
+	replaceStepSnapConfig,
+	replaceStepDecommission,
+}
+
+var replaceSteps = map[string]jobStepFunc{
+	replaceStepDeviceData:    replaceDeviceData,
+	replaceStepWaitConnected: replaceWaitConnected,
+	replaceStepGroups:        replaceGroups,
+	replaceStepSnaps:         replaceSnaps,
+	replaceStepSnapConfig:    replaceSnapConfig,
+	replaceStepDecommission:  replaceDecommission,
+}
+
+// DeviceReplace starts a job that replaces a device with a new one in the organization. The new device takes
+// the device data, group memberships, snaps and snap configuration of the old device, and the old device is
+// decommissioned. The steps that need the new device wait for it to connect, or to respond to the actions sent to
+// it, and are run again by the job runner.
+func (srv *Management) DeviceReplace(orgID, username string, role int, deviceID string, body []byte) (result domain.Job, err error) {
+	entry := deviceAudit(username, orgID, deviceID, "device.replace")
+	defer func() { srv.audit(entry, jobAuditPayload(result, body), err) }()
+
+	if !srv.orgAccess(orgID, username, role, PermissionAdminister) {
+		return domain.Job{}, NotAuthorizedErr
+	}
+
+	request := domain.DeviceReplaceRequest{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return domain.Job{}, err
+	}
+	if len(request.DeviceID) == 0 || request.DeviceID == deviceID {
+		return domain.Job{}, fmt.Errorf("a different device to replace the device with is required")
+	}
+
+	for _, id := range []string{deviceID, request.DeviceID} {
+		enroll, err := srv.Identity.DeviceGet(orgID, id)
+		if err != nil || enroll.Organization.ID != orgID {
+			return domain.Job{}, fmt.Errorf("the device `%s` does not belong to the organization", id)
+		}
+	}
+
+	params, err := json.Marshal(replaceParams{DeviceReplaceRequest: request})
+	if err != nil {
+		return domain.Job{}, err
+	}
+
+	job := datastore.Job{
+		Kind:           domain.JobKindReplace,
+		OrganizationID: orgID,
+		DeviceID:       deviceID,
+		Username:       username,
+		Parameters:     string(params),
+	}
+	job, err = srv.newJob(job, replaceStepOrder, nil)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	return jobToDomain(job), nil
+}
+
+// replaceParams is the request that started a replacement job, with the actions each step sent to the new device
+type replaceParams struct {
+	domain.DeviceReplaceRequest
+	Actions map[string][]string `json:"actions,omitempty"`
+}
+
+func replaceRequest(job *datastore.Job) (replaceParams, error) {
+	params := replaceParams{}
+	err := json.Unmarshal([]byte(job.Parameters), &params)
+	return params, err
+}
+
+func setReplaceParameters(job *datastore.Job, params replaceParams) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	job.Parameters = string(b)
+	return nil
+}
+
+// replaceActions sends the actions of a step to the new device, once, then waits for the device to respond to
+// them. The step fails if the device responds to one with an error, and sends them again when the job is resumed.
+func replaceActions(srv *Management, job *datastore.Job, step *datastore.JobStep, send func() ([]string, error)) error {
+	params, err := replaceRequest(job)
+	if err != nil {
+		return err
+	}
+
+	actionIDs, sent := params.Actions[step.Name]
+	if !sent {
+		if actionIDs, err = send(); err != nil {
+			return err
+		}
+		if params.Actions == nil {
+			params.Actions = map[string][]string{}
+		}
+		params.Actions[step.Name] = actionIDs
+		if err = setReplaceParameters(job, params); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range actionIDs {
+		act, err := srv.DeviceTwinController.ActionGet(id)
+		if err != nil {
+			return err
+		}
+
+		switch act.Status {
+		case twindatastore.ActionStatusComplete:
+			continue
+		case twindatastore.ActionStatusError:
+			delete(params.Actions, step.Name)
+			if err = setReplaceParameters(job, params); err != nil {
+				return err
+			}
+			return fmt.Errorf("the device responded to the %s action with an error: %s", act.Action, act.Message)
+		}
+		return fmt.Errorf("%w for the device to respond to the %s action", errStepWaiting, act.Action)
+	}
+	return nil
+}
+
+// replaceDeviceData copies the device data of the old registration to the new one
+func replaceDeviceData(srv *Management, job *datastore.Job, _ *datastore.JobStep) error {
+	request, err := replaceRequest(job)
+	if err != nil {
+		return err
+	}
+
+	enroll, err := srv.Identity.DeviceGet(job.OrganizationID, job.DeviceID)
+	if err != nil {
+		return err
+	}
+	if len(enroll.DeviceData) == 0 {
+		return nil
+	}
+	return srv.Identity.DeviceDataUpdate(request.DeviceID, enroll.DeviceData)
+}
+
+// replaceWaitConnected waits until the new device has connected and has a device twin
+func replaceWaitConnected(srv *Management, job *datastore.Job, _ *datastore.JobStep) error {
+	request, err := replaceRequest(job)
+	if err != nil {
+		return err
+	}
+
+	if _, err = srv.DeviceTwinController.DeviceGet(job.OrganizationID, request.DeviceID); err != nil {
+		return fmt.Errorf("%w for the device `%s` to connect", errStepWaiting, request.DeviceID)
+	}
+	return nil
+}
+
+// replaceGroups links the new device to the groups of the old device
+func replaceGroups(srv *Management, job *datastore.Job, _ *datastore.JobStep) error {
+	request, err := replaceRequest(job)
+	if err != nil {
+		return err
+	}
+
+	groups, err := srv.DeviceTwinController.GroupList(job.OrganizationID)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		devices, err := srv.DeviceTwinController.GroupGetDevices(job.OrganizationID, g.Name)
+		if err != nil {
+			return err
+		}
+		if !hasDevice(devices, job.DeviceID) || hasDevice(devices, request.DeviceID) {
+			continue
+		}
+		if err = srv.DeviceTwinController.GroupLinkDevice(job.OrganizationID, g.Name, request.DeviceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceSnaps installs the snaps of the old device that are missing on the new device, and waits for the
+// device to install them
+func replaceSnaps(srv *Management, job *datastore.Job, step *datastore.JobStep) error {
+	return replaceActions(srv, job, step, func() ([]string, error) {
+		request, oldSnaps, newSnaps, err := replaceDeviceSnaps(srv, job)
+		if err != nil {
+			return nil, err
+		}
+
+		actionIDs := []string{}
+		for _, s := range oldSnaps {
+			if _, ok := newSnaps[s.Name]; ok {
+				continue
+			}
+			actionID, err := srv.DeviceTwinController.DeviceSnapInstall(job.OrganizationID, request.DeviceID, s.Name)
+			if err != nil {
+				return nil, err
+			}
+			actionIDs = append(actionIDs, actionID)
+		}
+		return actionIDs, nil
+	})
+}
+
+// replaceSnapConfig sets the configuration of the snaps of the old device on the new device, once the
+// snaps are installed on it, and waits for the device to apply it
+func replaceSnapConfig(srv *Management, job *datastore.Job, step *datastore.JobStep) error {
+	return replaceActions(srv, job, step, func() ([]string, error) {
+		request, oldSnaps, newSnaps, err := replaceDeviceSnaps(srv, job)
+		if err != nil {
+			return nil, err
+		}
+
+		configs := map[string]string{}
+		for _, s := range oldSnaps {
+			if len(s.Config) == 0 {
+				continue
+			}
+			if _, ok := newSnaps[s.Name]; !ok {
+				return nil, fmt.Errorf("%w for the snap `%s` to be installed", errStepWaiting, s.Name)
+			}
+			configs[s.Name] = s.Config
+		}
+
+		actionIDs := []string{}
+		for name, config := range configs {
+			actionID, err := srv.DeviceTwinController.DeviceSnapConf(job.OrganizationID, request.DeviceID, name, config)
+			if err != nil {
+				return nil, err
+			}
+			actionIDs = append(actionIDs, actionID)
+		}
+		return actionIDs, nil
+	})
+}
+
+// replaceDecommission starts a job to decommission the old device, which the job runner runs. A job that is
+// already decommissioning the device is not started again.
+func replaceDecommission(srv *Management, job *datastore.Job, step *datastore.JobStep) error {
+	active, err := srv.activeJob(job.OrganizationID, domain.JobKindDecommission, job.DeviceID)
+	if err != nil {
+		return err
+	}
+
+	if active == nil {
+		decommission := decommissionJob(job.OrganizationID, job.Username, job.DeviceID)
+		decommission.Status = domain.JobStatusWaiting
+		created, err := srv.createJob(decommission, decommissionStepOrder, nil)
+		if err != nil {
+			return err
+		}
+		active = &created
+	}
+
+	step.Message = fmt.Sprintf("the device is decommissioned by job %d", active.ID)
+	return nil
+}
+
+// replaceDeviceSnaps fetches the snaps of the old device, and the snaps of the new device by name
+func replaceDeviceSnaps(srv *Management, job *datastore.Job) (replaceParams, []messages.DeviceSnap, map[string]messages.DeviceSnap, error) {
+	request, err := replaceRequest(job)
+	if err != nil {
+		return request, nil, nil, err
+	}
+
+	oldSnaps, err := srv.DeviceTwinController.DeviceSnaps(job.OrganizationID, job.DeviceID)
+	if err != nil {
+		return request, nil, nil, err
+	}
+
+	snaps, err := srv.DeviceTwinController.DeviceSnaps(job.OrganizationID, request.DeviceID)
+	if err != nil {
+		return request, nil, nil, err
+	}
+
+	newSnaps := map[string]messages.DeviceSnap{}
+	for _, s := range snaps {
+		newSnaps[s.Name] = s
+	}
+	return request, oldSnaps, newSnaps, nil
+}
+
+func hasDevice(devices []messages.Device, deviceID string) bool {
+	for _, d := range devices {
+		if d.DeviceId == deviceID {
+			return true
+		}
+	}
+	return false
+}
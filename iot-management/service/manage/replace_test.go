@@ -0,0 +1,200 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	twindatastore "github.com/everactive/dmscore/iot-devicetwin/datastore"
+	"github.com/everactive/dmscore/iot-devicetwin/domain"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/iot-devicetwin/service/controller"
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service/mocks"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+	mgdomain "github.com/everactive/dmscore/iot-management/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func replaceIdentityMock(newOrgID string) *mocks.Identity {
+	identityMock := &mocks.Identity{}
+	identityMock.On("DeviceGet", "abc", "a111").Return(&iddomain.Enrollment{ID: "a111", Organization: iddomain.Organization{ID: "abc"}, DeviceData: "DATA"}, nil)
+	identityMock.On("DeviceGet", "abc", "b222").Return(&iddomain.Enrollment{ID: "b222", Organization: iddomain.Organization{ID: newOrgID}}, nil)
+	identityMock.On("DeviceDataUpdate", "b222", "DATA").Return(nil)
+	return identityMock
+}
+
+func replaceTwinMock(connected bool) *controller.MockController {
+	twinMock := &controller.MockController{}
+	twinMock.On("DeviceGet", "abc", "a111").Return(messages.Device{DeviceId: "a111"}, nil)
+	if connected {
+		twinMock.On("DeviceGet", "abc", "b222").Return(messages.Device{DeviceId: "b222"}, nil)
+	} else {
+		twinMock.On("DeviceGet", "abc", "b222").Return(messages.Device{}, errors.New("MOCK not found"))
+	}
+	twinMock.On("GroupList", "abc").Return([]domain.Group{{Name: "workshop"}, {Name: "outdoor"}}, nil)
+	twinMock.On("GroupGetDevices", "abc", "workshop").Return([]messages.Device{{DeviceId: "a111"}}, nil)
+	twinMock.On("GroupGetDevices", "abc", "outdoor").Return([]messages.Device{{DeviceId: "c333"}}, nil)
+	twinMock.On("GroupLinkDevice", "abc", "workshop", "b222").Return(nil)
+	twinMock.On("DeviceSnaps", "abc", "a111").Return([]messages.DeviceSnap{{Name: "core"}, {Name: "helloworld", Config: `{"title":"hi"}`}}, nil)
+	twinMock.On("DeviceSnaps", "abc", "b222").Return([]messages.DeviceSnap{{Name: "core"}, {Name: "helloworld"}}, nil)
+	twinMock.On("DeviceSnapInstall", "abc", "b222", mock.Anything).Return("", nil)
+	twinMock.On("DeviceSnapConf", "abc", "b222", "helloworld", `{"title":"hi"}`).Return("conf1", nil)
+	twinMock.On("ActionGet", "conf1").Return(domain.Action{ActionID: "conf1", Action: "conf", Status: twindatastore.ActionStatusComplete}, nil)
+	return twinMock
+}
+
+func TestManagement_DeviceReplace(t *testing.T) {
+	type args struct {
+		username string
+		role     int
+		body     []byte
+	}
+	tests := []struct {
+		name    string
+		args    args
+		newOrg  string
+		want    string
+		wantErr string
+	}{
+		{"valid", args{"jamesj", 200, []byte(`{"deviceId":"b222"}`)}, "abc", mgdomain.JobStatusCompleted, ""},
+		{"invalid-user", args{"invalid", 200, []byte(`{"deviceId":"b222"}`)}, "abc", "", "not authorized"},
+		{"invalid-same-device", args{"jamesj", 200, []byte(`{"deviceId":"a111"}`)}, "abc", "", "a different device"},
+		{"invalid-no-device", args{"jamesj", 200, []byte(`{}`)}, "abc", "", "a different device"},
+		{"invalid-device-org", args{"jamesj", 200, []byte(`{"deviceId":"b222"}`)}, "def", "", "does not belong"},
+		{"invalid-body", args{"jamesj", 200, []byte(`\u1000`)}, "abc", "", "invalid character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := memory.NewStore()
+			identityMock := replaceIdentityMock(tt.newOrg)
+			twinMock := replaceTwinMock(true)
+			srv := Management{DS: db, DeviceTwinController: twinMock, Identity: identityMock}
+
+			got, err := srv.DeviceReplace("abc", tt.args.username, tt.args.role, "a111", tt.args.body)
+			if len(tt.wantErr) > 0 {
+				assert.ErrorContains(t, err, tt.wantErr)
+				jobs, _ := db.JobList("", "")
+				assert.Empty(t, jobs)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Status)
+			assert.Equal(t, mgdomain.JobKindReplace, got.Kind)
+			assert.Equal(t, "a111", got.DeviceID)
+			assert.Len(t, got.Steps, len(replaceStepOrder))
+
+			identityMock.AssertCalled(t, "DeviceDataUpdate", "b222", "DATA")
+			twinMock.AssertCalled(t, "GroupLinkDevice", "abc", "workshop", "b222")
+			twinMock.AssertNotCalled(t, "GroupLinkDevice", "abc", "outdoor", "b222")
+			twinMock.AssertNotCalled(t, "DeviceSnapInstall", mock.Anything, mock.Anything, mock.Anything)
+			twinMock.AssertCalled(t, "DeviceSnapConf", "abc", "b222", "helloworld", `{"title":"hi"}`)
+			twinMock.AssertCalled(t, "ActionGet", "conf1")
+
+			// The old device is decommissioned by a job of its own, that the job runner runs
+			jobs, _ := db.JobList("abc", mgdomain.JobStatusWaiting)
+			assert.Len(t, jobs, 1)
+			assert.Equal(t, mgdomain.JobKindDecommission, jobs[0].Kind)
+			assert.Equal(t, "a111", jobs[0].DeviceID)
+			assert.Equal(t, fmt.Sprintf("the device is decommissioned by job %d", jobs[0].ID), got.Steps[5].Message)
+			twinMock.AssertNotCalled(t, "DeviceDelete", mock.Anything)
+		})
+	}
+}
+
+func TestManagement_DeviceReplaceWaiting(t *testing.T) {
+	db := memory.NewStore()
+	identityMock := replaceIdentityMock("abc")
+	twinMock := replaceTwinMock(false)
+	srv := Management{DS: db, DeviceTwinController: twinMock, Identity: identityMock}
+
+	// The new device has not connected yet
+	got, err := srv.DeviceReplace("abc", "jamesj", 200, "a111", []byte(`{"deviceId":"b222"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusWaiting, got.Status)
+	assert.Equal(t, mgdomain.JobStepDone, got.Steps[0].Status)
+	assert.Equal(t, mgdomain.JobStepWaiting, got.Steps[1].Status)
+	assert.Contains(t, got.Steps[1].Message, "for the device `b222` to connect")
+	twinMock.AssertNotCalled(t, "DeviceDelete", mock.Anything)
+
+	// The job runner picks the job up once the device has connected, and installs its snaps
+	twinMock = &controller.MockController{}
+	twinMock.On("DeviceGet", "abc", mock.Anything).Return(messages.Device{}, nil)
+	twinMock.On("GroupList", "abc").Return([]domain.Group{}, nil)
+	twinMock.On("DeviceSnaps", "abc", "a111").Return([]messages.DeviceSnap{{Name: "helloworld", Config: `{"title":"hi"}`}}, nil)
+	twinMock.On("DeviceSnaps", "abc", "b222").Return([]messages.DeviceSnap{}, nil)
+	twinMock.On("DeviceSnapInstall", "abc", "b222", "helloworld").Return("install1", nil)
+	twinMock.On("ActionGet", "install1").Return(domain.Action{ActionID: "install1", Action: "install"}, nil).Once()
+	twinMock.On("ActionGet", "install1").Return(domain.Action{ActionID: "install1", Action: "install", Status: twindatastore.ActionStatusComplete}, nil)
+	srv.DeviceTwinController = twinMock
+
+	// The snaps step waits for the device to install them
+	assert.NoError(t, srv.RunWaitingJobs())
+
+	job, err := srv.JobGet("abc", "jamesj", 200, got.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusWaiting, job.Status)
+	assert.Equal(t, mgdomain.JobStepWaiting, job.Steps[3].Status)
+	assert.Contains(t, job.Steps[3].Message, "for the device to respond to the install action")
+
+	// The install is not sent again once the device has responded
+	assert.NoError(t, srv.RunWaitingJobs())
+
+	job, err = srv.JobGet("abc", "jamesj", 200, got.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusWaiting, job.Status)
+	assert.Equal(t, mgdomain.JobStepDone, job.Steps[3].Status)
+	assert.Equal(t, mgdomain.JobStepWaiting, job.Steps[4].Status)
+	assert.Contains(t, job.Steps[4].Message, "for the snap `helloworld` to be installed")
+	twinMock.AssertNumberOfCalls(t, "DeviceSnapInstall", 1)
+}
+
+func TestManagement_DeviceReplaceActionError(t *testing.T) {
+	db := memory.NewStore()
+	identityMock := replaceIdentityMock("abc")
+	twinMock := replaceTwinMock(true)
+	twinMock.ExpectedCalls = nil
+	twinMock.On("DeviceGet", "abc", mock.Anything).Return(messages.Device{}, nil)
+	twinMock.On("GroupList", "abc").Return([]domain.Group{}, nil)
+	twinMock.On("DeviceSnaps", "abc", "a111").Return([]messages.DeviceSnap{{Name: "helloworld"}}, nil)
+	twinMock.On("DeviceSnaps", "abc", "b222").Return([]messages.DeviceSnap{}, nil)
+	twinMock.On("DeviceSnapInstall", "abc", "b222", "helloworld").Return("install1", nil).Once()
+	twinMock.On("DeviceSnapInstall", "abc", "b222", "helloworld").Return("install2", nil)
+	twinMock.On("ActionGet", "install1").Return(domain.Action{ActionID: "install1", Action: "install", Status: twindatastore.ActionStatusError, Message: "MOCK no space"}, nil)
+	twinMock.On("ActionGet", "install2").Return(domain.Action{ActionID: "install2", Action: "install"}, nil)
+	srv := Management{DS: db, DeviceTwinController: twinMock, Identity: identityMock}
+
+	got, err := srv.DeviceReplace("abc", "jamesj", 200, "a111", []byte(`{"deviceId":"b222"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusFailed, got.Status)
+	assert.Equal(t, mgdomain.JobStepFailed, got.Steps[3].Status)
+	assert.Equal(t, "the device responded to the install action with an error: MOCK no space", got.Steps[3].Message)
+
+	// Resuming the job sends the install again
+	got, err = srv.JobResume("abc", "jamesj", 200, got.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, mgdomain.JobStatusWaiting, got.Status)
+	assert.Equal(t, mgdomain.JobStepWaiting, got.Steps[3].Status)
+	twinMock.AssertNumberOfCalls(t, "DeviceSnapInstall", 2)
+}
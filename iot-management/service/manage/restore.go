@@ -0,0 +1,176 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"fmt"
+
+	"github.com/everactive/dmscore/iot-management/domain"
+)
+
+// DeviceDeletedList lists the soft deleted devices of an organization, from their registrations and device twins
+func (srv *Management) DeviceDeletedList(orgID, username string, role int) ([]domain.DeletedDevice, error) {
+	newOrgID, err := getUserOrgIDIfOrgName(srv, username, orgID)
+	if err != nil {
+		return nil, err
+	}
+	orgID = newOrgID
+
+	if !srv.orgAccess(orgID, username, role, PermissionView) {
+		return nil, NotAuthorizedErr
+	}
+
+	return srv.deletedDevices(orgID)
+}
+
+// DeviceRestore restores a soft deleted device. Its registration is restored, with new credentials when its
+// certificate was revoked, then its device twin, with its snaps and version, and it is linked again to the groups
+// it was removed from. The device is then asked for its details and snaps, to refresh the device twin.
+func (srv *Management) DeviceRestore(orgID, username string, role int, deviceID string) (result domain.DeletedDevice, err error) {
+	entry := deviceAudit(username, orgID, deviceID, "device.restore")
+	defer func() { srv.audit(entry, nil, err) }()
+
+	newOrgID, err := getUserOrgIDIfOrgName(srv, username, orgID)
+	if err != nil {
+		return domain.DeletedDevice{}, err
+	}
+	orgID = newOrgID
+	entry.OrganizationID = orgID
+
+	if !srv.orgAccess(orgID, username, role, PermissionAdminister) {
+		return domain.DeletedDevice{}, NotAuthorizedErr
+	}
+
+	active, err := srv.activeJob(orgID, domain.JobKindDecommission, deviceID)
+	if err != nil {
+		return domain.DeletedDevice{}, err
+	}
+	if active != nil {
+		return domain.DeletedDevice{}, fmt.Errorf("the device is being decommissioned by job %d, it must complete before the device is restored", active.ID)
+	}
+
+	devices, err := srv.deletedDevices(orgID)
+	if err != nil {
+		return domain.DeletedDevice{}, err
+	}
+	var device *domain.DeletedDevice
+	for i := range devices {
+		if devices[i].DeviceID == deviceID {
+			device = &devices[i]
+			break
+		}
+	}
+	if device == nil {
+		return domain.DeletedDevice{}, fmt.Errorf("the device `%s` is not a deleted device of the organization", deviceID)
+	}
+
+	if device.Registration {
+		if _, err = srv.Identity.RestoreDevice(deviceID); err != nil {
+			return domain.DeletedDevice{}, err
+		}
+	}
+
+	if device.DeviceTwin {
+		if err = srv.DeviceTwinController.DeviceRestore(orgID, deviceID); err != nil {
+			return domain.DeletedDevice{}, err
+		}
+	}
+
+	for _, g := range device.Groups {
+		if err = srv.DeviceTwinController.GroupLinkDevice(orgID, g, deviceID); err != nil {
+			return domain.DeletedDevice{}, fmt.Errorf("error linking the device to the group `%s`: %w", g, err)
+		}
+	}
+
+	return *device, nil
+}
+
+// deletedDevices merges the soft deleted registrations and device twins of an organization
+func (srv *Management) deletedDevices(orgID string) ([]domain.DeletedDevice, error) {
+	enrolls, err := srv.Identity.DeviceListDeleted(orgID)
+	if err != nil {
+		return nil, err
+	}
+	twins, err := srv.DeviceTwinController.DeviceListDeleted(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []domain.DeletedDevice{}
+	index := map[string]int{}
+	for _, en := range enrolls {
+		index[en.ID] = len(devices)
+		devices = append(devices, domain.DeletedDevice{
+			DeviceID:     en.ID,
+			Brand:        en.Device.Brand,
+			Model:        en.Device.Model,
+			SerialNumber: en.Device.SerialNumber,
+			Registration: true,
+		})
+	}
+	for _, d := range twins {
+		if i, ok := index[d.DeviceId]; ok {
+			devices[i].DeviceTwin = true
+			continue
+		}
+		index[d.DeviceId] = len(devices)
+		devices = append(devices, domain.DeletedDevice{
+			DeviceID:     d.DeviceId,
+			Brand:        d.Brand,
+			Model:        d.Model,
+			SerialNumber: d.Serial,
+			DeviceTwin:   true,
+		})
+	}
+
+	groups, err := srv.decommissionedGroups(orgID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range devices {
+		devices[i].Groups = groups[devices[i].DeviceID]
+	}
+	return devices, nil
+}
+
+// decommissionedGroups finds the groups that the devices of an organization were removed from, by their most
+// recent completed decommissioning job
+func (srv *Management) decommissionedGroups(orgID string) (map[string][]string, error) {
+	jobs, err := srv.DS.JobList(orgID, domain.JobStatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string][]string{}
+	for i := range jobs {
+		if jobs[i].Kind != domain.JobKindDecommission {
+			continue
+		}
+		if _, ok := groups[jobs[i].DeviceID]; ok {
+			continue
+		}
+		params, err := decommissionParameters(&jobs[i])
+		if err != nil {
+			return nil, err
+		}
+		groups[jobs[i].DeviceID] = params.Groups
+	}
+	return groups, nil
+}
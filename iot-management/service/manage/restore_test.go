@@ -0,0 +1,96 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"testing"
+
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestManagement_DeviceRestore(t *testing.T) {
+	tests := []struct {
+		name         string
+		username     string
+		deviceID     string
+		registered   bool
+		actionStatus string
+		wantGroups   []string
+		wantErr      string
+	}{
+		{"valid", "jamesj", "a111", true, "complete", []string{"workshop", "outdoor"}, ""},
+		{"valid-not-registered", "jamesj", "a111", false, "complete", []string{"workshop", "outdoor"}, ""},
+		{"invalid-user", "sarahj", "a111", true, "complete", nil, "not authorized"},
+		{"invalid-device", "jamesj", "b222", true, "complete", nil, "is not a deleted device"},
+		{"invalid-decommissioning", "jamesj", "a111", true, "requested", nil, "is being decommissioned by job"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityMock := decommissionIdentityMock(tt.registered, nil)
+			twinMock := decommissionTwinMock(true, tt.actionStatus)
+			srv := Management{DS: memory.NewStore(), DeviceTwinController: twinMock, Identity: identityMock}
+			_, err := srv.DeviceDelete("abc", "jamesj", 200, "a111")
+			assert.NoError(t, err)
+
+			deletedEnrolls := []iddomain.Enrollment{}
+			if tt.registered {
+				deletedEnrolls = append(deletedEnrolls, iddomain.Enrollment{ID: "a111", Device: iddomain.Device{Brand: "example", Model: "drone-1000", SerialNumber: "DR1000A111"}})
+			}
+			identityMock.On("DeviceListDeleted", "abc").Return(deletedEnrolls, nil)
+			identityMock.On("RestoreDevice", "a111").Return(&iddomain.Enrollment{ID: "a111"}, nil)
+			twinMock.On("DeviceListDeleted", "abc").Return([]messages.Device{{DeviceId: "a111", Brand: "example", Model: "drone-1000", Serial: "DR1000A111"}}, nil)
+			twinMock.On("DeviceRestore", "abc", "a111").Return(nil)
+			twinMock.On("GroupLinkDevice", "abc", mock.Anything, "a111").Return(nil)
+
+			if len(tt.wantErr) == 0 {
+				deleted, err := srv.DeviceDeletedList("abc", tt.username, 200)
+				assert.NoError(t, err)
+				assert.Len(t, deleted, 1)
+				assert.Equal(t, tt.registered, deleted[0].Registration)
+				assert.True(t, deleted[0].DeviceTwin)
+				assert.Equal(t, tt.wantGroups, deleted[0].Groups)
+			}
+
+			got, err := srv.DeviceRestore("abc", tt.username, 200, tt.deviceID)
+			if len(tt.wantErr) > 0 {
+				assert.ErrorContains(t, err, tt.wantErr)
+				twinMock.AssertNotCalled(t, "DeviceRestore", mock.Anything, mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "a111", got.DeviceID)
+			assert.Equal(t, "DR1000A111", got.SerialNumber)
+			twinMock.AssertCalled(t, "DeviceRestore", "abc", "a111")
+			for _, g := range tt.wantGroups {
+				twinMock.AssertCalled(t, "GroupLinkDevice", "abc", g, "a111")
+			}
+			if tt.registered {
+				identityMock.AssertCalled(t, "RestoreDevice", "a111")
+			} else {
+				identityMock.AssertNotCalled(t, "RestoreDevice", mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	twindomain "github.com/everactive/dmscore/iot-devicetwin/domain"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/spf13/viper"
+)
+
+// RetentionReport reports the data that the retention service would purge now
+func (srv *Management) RetentionReport() (domain.RetentionReport, error) {
+	return srv.Purge(true)
+}
+
+// Purge applies the retention settings to the device twins and registrations. Old actions are deleted, or
+// archived, the devices soft deleted for longer than the grace period are hard deleted and the devices that have
+// not been seen for long are soft deleted. A dry run reports the data that would be purged, without changing it,
+// other runs are recorded in the audit log.
+func (srv *Management) Purge(dryRun bool) (report domain.RetentionReport, err error) {
+	if !dryRun {
+		defer func() { srv.audit(auditEntry(AuditSystemUser, "", "", "", "retention.purge"), report, err) }()
+	}
+
+	now := time.Now()
+	policy := twindomain.RetentionPolicy{
+		ActionsBefore:  daysBefore(now, keys.RetentionActionsDays),
+		ArchiveActions: viper.GetBool(keys.RetentionActionsArchive),
+		DeletedBefore:  daysBefore(now, keys.RetentionDeletedDays),
+		StaleBefore:    daysBefore(now, keys.RetentionStaleDays),
+	}
+
+	twinReport, err := srv.DeviceTwinController.Purge(policy, dryRun)
+	if err != nil {
+		return domain.RetentionReport{}, err
+	}
+
+	registrations := []string{}
+	if !policy.DeletedBefore.IsZero() {
+		if registrations, err = srv.Identity.PurgeDevices(policy.DeletedBefore, dryRun); err != nil {
+			return domain.RetentionReport{}, err
+		}
+	}
+
+	return domain.RetentionReport{
+		DryRun:          dryRun,
+		Created:         now,
+		Actions:         twinReport.Actions,
+		ActionsArchived: policy.ArchiveActions && twinReport.Actions > 0,
+		DeviceTwins:     twinReport.DevicesPurged,
+		DeviceRecords:   twinReport.RecordsPurged,
+		Registrations:   registrations,
+		StaleDevices:    twinReport.DevicesStale,
+	}, nil
+}
+
+// daysBefore is the time a number of days, from the settings, before now. Zero days is a zero time, that keeps
+// the data.
+func daysBefore(now time.Time, key string) time.Time {
+	days := viper.GetInt(key)
+	if days <= 0 {
+		return time.Time{}
+	}
+	return now.AddDate(0, 0, -days)
+}
@@ -0,0 +1,93 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	twindomain "github.com/everactive/dmscore/iot-devicetwin/domain"
+	"github.com/everactive/dmscore/iot-devicetwin/service/controller"
+	"github.com/everactive/dmscore/iot-identity/service/mocks"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestManagement_Purge(t *testing.T) {
+	tests := []struct {
+		name              string
+		actionsDays       int
+		deletedDays       int
+		staleDays         int
+		dryRun            bool
+		twinErr           error
+		wantRegistrations []string
+		wantErr           bool
+	}{
+		{"keep", 0, 0, 0, false, nil, []string{}, false},
+		{"all", 90, 30, 180, false, nil, []string{"a111"}, false},
+		{"all-dry-run", 90, 30, 180, true, nil, []string{"a111"}, false},
+		{"invalid-twin", 90, 30, 180, false, errors.New("MOCK error"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set(keys.RetentionActionsDays, tt.actionsDays)
+			viper.Set(keys.RetentionDeletedDays, tt.deletedDays)
+			viper.Set(keys.RetentionStaleDays, tt.staleDays)
+			defer func() {
+				viper.Set(keys.RetentionActionsDays, 0)
+				viper.Set(keys.RetentionDeletedDays, 0)
+				viper.Set(keys.RetentionStaleDays, 0)
+			}()
+
+			var policy twindomain.RetentionPolicy
+			twinMock := &controller.MockController{}
+			twinMock.On("Purge", mock.Anything, tt.dryRun).Run(func(args mock.Arguments) {
+				policy = args.Get(0).(twindomain.RetentionPolicy)
+			}).Return(twindomain.RetentionReport{Actions: 2, DevicesPurged: []string{"a111"}, DevicesStale: []string{"b222"}}, tt.twinErr)
+			identityMock := &mocks.Identity{}
+			identityMock.On("PurgeDevices", mock.Anything, tt.dryRun).Return([]string{"a111"}, nil)
+			srv := Management{DS: memory.NewStore(), DeviceTwinController: twinMock, Identity: identityMock}
+
+			got, err := srv.Purge(tt.dryRun)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.dryRun, got.DryRun)
+			assert.Equal(t, int64(2), got.Actions)
+			assert.Equal(t, tt.wantRegistrations, got.Registrations)
+			assert.Equal(t, tt.actionsDays == 0, policy.ActionsBefore.IsZero())
+			assert.Equal(t, tt.deletedDays == 0, policy.DeletedBefore.IsZero())
+			assert.Equal(t, tt.staleDays == 0, policy.StaleBefore.IsZero())
+			if tt.deletedDays > 0 {
+				assert.WithinDuration(t, time.Now().AddDate(0, 0, -tt.deletedDays), policy.DeletedBefore, time.Minute)
+			} else {
+				identityMock.AssertNotCalled(t, "PurgeDevices", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
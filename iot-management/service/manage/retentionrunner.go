@@ -0,0 +1,66 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"context"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// RetentionRunner is a supervised service that periodically purges the data older than the retention settings
+type RetentionRunner struct {
+	srv *Management
+}
+
+// NewRetentionRunner creates the service that applies the retention settings of the management service
+func NewRetentionRunner(srv *Management) *RetentionRunner {
+	return &RetentionRunner{srv: srv}
+}
+
+// Serve purges the data every interval until the context is done. A zero interval disables purging.
+func (r *RetentionRunner) Serve(ctx context.Context) error {
+	interval := viper.GetDuration(keys.RetentionInterval)
+	if interval <= 0 {
+		log.Info("The retention service is disabled")
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			report, err := r.srv.Purge(false)
+			if err != nil {
+				log.Errorf("Error purging the data: %v", err)
+				continue
+			}
+			log.Infof("Purged %d actions, %d device twins, %d device records and %d registrations, and deleted %d stale devices",
+				report.Actions, len(report.DeviceTwins), report.DeviceRecords, len(report.Registrations), len(report.StaleDevices))
+		}
+	}
+}
@@ -25,12 +25,13 @@ import (
 	"fmt"
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
 	"github.com/everactive/dmscore/iot-devicetwin/web"
+	"github.com/everactive/dmscore/iot-management/datastore"
 	"github.com/everactive/dmscore/models"
 )
 
 // SnapList lists the snaps for a device
 func (srv *Management) SnapList(orgID, username string, role int, deviceID string) web.SnapsResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionView)
 	if !hasAccess {
 		return web.SnapsResponse{
 			StandardResponse: web.StandardResponse{
@@ -77,8 +78,11 @@ func (srv *Management) verifyOrgMatches(orgID string, deviceID string) (error, w
 }
 
 // SnapListOnDevice lists snaps on a device
-func (srv *Management) SnapListOnDevice(orgID, username string, role int, deviceID string) web.StandardResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+func (srv *Management) SnapListOnDevice(orgID, username string, role int, deviceID string) (response web.StandardResponse) {
+	entry := deviceAudit(username, orgID, deviceID, "snap.list")
+	defer func() { srv.audit(entry, nil, responseError(response.Code, response.Message)) }()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionOperate)
 	if !hasAccess {
 		return web.StandardResponse{
 			Code:    "SnapAuth",
@@ -91,7 +95,7 @@ func (srv *Management) SnapListOnDevice(orgID, username string, role int, device
 		return response
 	}
 
-	err = srv.DeviceTwinController.DeviceSnapList(orgID, deviceID)
+	entry.ActionID, err = srv.DeviceTwinController.DeviceSnapList(orgID, deviceID)
 	if err != nil {
 		return web.StandardResponse{
 			Code:    "SnapListOnDevice",
@@ -103,8 +107,13 @@ func (srv *Management) SnapListOnDevice(orgID, username string, role int, device
 }
 
 // SnapInstall installs a snap on a device
-func (srv *Management) SnapInstall(orgID, username string, role int, deviceID, snap string) web.StandardResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+func (srv *Management) SnapInstall(orgID, username string, role int, deviceID, snap string) (response web.StandardResponse) {
+	entry := deviceAudit(username, orgID, deviceID, "snap.install")
+	defer func() {
+		srv.audit(entry, map[string]string{"snap": snap}, responseError(response.Code, response.Message))
+	}()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionOperate)
 	if !hasAccess {
 		return web.StandardResponse{
 			Code:    "SnapAuth",
@@ -112,7 +121,8 @@ func (srv *Management) SnapInstall(orgID, username string, role int, deviceID, s
 		}
 	}
 
-	err := srv.DeviceTwinController.DeviceSnapInstall(orgID, deviceID, snap)
+	var err error
+	entry.ActionID, err = srv.DeviceTwinController.DeviceSnapInstall(orgID, deviceID, snap)
 	if err != nil {
 		return web.StandardResponse{
 			Code:    "SnapInstall",
@@ -124,8 +134,13 @@ func (srv *Management) SnapInstall(orgID, username string, role int, deviceID, s
 }
 
 // SnapRemove uninstalls a snap on a device
-func (srv *Management) SnapRemove(orgID, username string, role int, deviceID, snap string) web.StandardResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+func (srv *Management) SnapRemove(orgID, username string, role int, deviceID, snap string) (response web.StandardResponse) {
+	entry := deviceAudit(username, orgID, deviceID, "snap.remove")
+	defer func() {
+		srv.audit(entry, map[string]string{"snap": snap}, responseError(response.Code, response.Message))
+	}()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionOperate)
 	if !hasAccess {
 		return web.StandardResponse{
 			Code:    "SnapAuth",
@@ -133,7 +148,8 @@ func (srv *Management) SnapRemove(orgID, username string, role int, deviceID, sn
 		}
 	}
 
-	err := srv.DeviceTwinController.DeviceSnapRemove(orgID, deviceID, snap)
+	var err error
+	entry.ActionID, err = srv.DeviceTwinController.DeviceSnapRemove(orgID, deviceID, snap)
 	if err != nil {
 		return web.StandardResponse{
 			Code:    "SnapRemove",
@@ -145,8 +161,13 @@ func (srv *Management) SnapRemove(orgID, username string, role int, deviceID, sn
 }
 
 // SnapUpdate enables/disables/refreshes/swtich a snap on a device
-func (srv *Management) SnapUpdate(orgID, username string, role int, deviceID, snap, action string, body []byte) web.StandardResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+func (srv *Management) SnapUpdate(orgID, username string, role int, deviceID, snap, action string, body []byte) (response web.StandardResponse) {
+	entry := deviceAudit(username, orgID, deviceID, "snap."+action)
+	defer func() {
+		srv.audit(entry, snapAuditPayload(snap, body), responseError(response.Code, response.Message))
+	}()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionOperate)
 	if !hasAccess {
 		return web.StandardResponse{
 			Code:    "SnapAuth",
@@ -157,7 +178,7 @@ func (srv *Management) SnapUpdate(orgID, username string, role int, deviceID, sn
 	snapUpdate := messages.SnapUpdate{}
 	err := json.Unmarshal(body, &snapUpdate)
 
-	err = srv.DeviceTwinController.DeviceSnapUpdate(orgID, deviceID, snap, action, &snapUpdate)
+	entry.ActionID, err = srv.DeviceTwinController.DeviceSnapUpdate(orgID, deviceID, snap, action, &snapUpdate)
 	if err != nil {
 		return web.StandardResponse{
 			Code:    "SnapUpdate",
@@ -169,8 +190,13 @@ func (srv *Management) SnapUpdate(orgID, username string, role int, deviceID, sn
 }
 
 // SnapConfigSet updates a snap config on a device
-func (srv *Management) SnapConfigSet(orgID, username string, role int, deviceID, snap string, config []byte) web.StandardResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+func (srv *Management) SnapConfigSet(orgID, username string, role int, deviceID, snap string, config []byte) (response web.StandardResponse) {
+	entry := deviceAudit(username, orgID, deviceID, "snap.config")
+	defer func() {
+		srv.audit(entry, snapConfigAuditPayload(snap, config), responseError(response.Code, response.Message))
+	}()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionOperate)
 	if !hasAccess {
 		return web.StandardResponse{
 			Code:    "SnapAuth",
@@ -178,7 +204,8 @@ func (srv *Management) SnapConfigSet(orgID, username string, role int, deviceID,
 		}
 	}
 
-	err := srv.DeviceTwinController.DeviceSnapConf(orgID, deviceID, snap, string(config))
+	var err error
+	entry.ActionID, err = srv.DeviceTwinController.DeviceSnapConf(orgID, deviceID, snap, string(config))
 	if err != nil {
 		return web.StandardResponse{
 			Code:    "SnapConfigSet",
@@ -190,8 +217,13 @@ func (srv *Management) SnapConfigSet(orgID, username string, role int, deviceID,
 }
 
 // SnapServiceAction requests from the DeviceTwin API that an action be performed on a snap service
-func (srv *Management) SnapServiceAction(orgID, username string, role int, deviceID, snap, action string, body []byte) web.StandardResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+func (srv *Management) SnapServiceAction(orgID, username string, role int, deviceID, snap, action string, body []byte) (response web.StandardResponse) {
+	entry := deviceAudit(username, orgID, deviceID, "snap.service-"+action)
+	defer func() {
+		srv.audit(entry, snapAuditPayload(snap, body), responseError(response.Code, response.Message))
+	}()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionOperate)
 	if !hasAccess {
 		return web.StandardResponse{
 			Code:    "SnapAuth",
@@ -208,7 +240,7 @@ func (srv *Management) SnapServiceAction(orgID, username string, role int, devic
 		}
 	}
 
-	err = srv.DeviceTwinController.DeviceSnapServiceAction(orgID, deviceID, snap, action, &services)
+	entry.ActionID, err = srv.DeviceTwinController.DeviceSnapServiceAction(orgID, deviceID, snap, action, &services)
 	if err != nil {
 		return web.StandardResponse{
 			Code:    "SnapServiceAction",
@@ -220,8 +252,13 @@ func (srv *Management) SnapServiceAction(orgID, username string, role int, devic
 }
 
 // SnapSnapshot requests from the DeviceTwin API that a snapshot be made of a given snap
-func (srv *Management) SnapSnapshot(orgID, username string, role int, deviceID, snap string, body []byte) web.StandardResponse {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+func (srv *Management) SnapSnapshot(orgID, username string, role int, deviceID, snap string, body []byte) (response web.StandardResponse) {
+	entry := deviceAudit(username, orgID, deviceID, "snap.snapshot")
+	defer func() {
+		srv.audit(entry, snapAuditPayload(snap, body), responseError(response.Code, response.Message))
+	}()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionOperate)
 	if !hasAccess {
 		return web.StandardResponse{
 			Code:    "SnapAuth",
@@ -238,7 +275,7 @@ func (srv *Management) SnapSnapshot(orgID, username string, role int, deviceID,
 		}
 	}
 
-	err = srv.DeviceTwinController.DeviceSnapSnapshot(orgID, deviceID, snap, &snapshot)
+	entry.ActionID, err = srv.DeviceTwinController.DeviceSnapSnapshot(orgID, deviceID, snap, &snapshot)
 	if err != nil {
 		return web.StandardResponse{
 			Code:    "SnapSnapshot",
@@ -252,7 +289,7 @@ func (srv *Management) SnapSnapshot(orgID, username string, role int, deviceID,
 var NotAuthorizedErr = errors.New("user is not authorized")
 
 func (srv *Management) GetModelRequiredSnaps(orgID, username, modelName string, role int) (*models.DeviceModel, error) {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionView)
 	if !hasAccess {
 		return nil, NotAuthorizedErr
 	}
@@ -269,8 +306,11 @@ func (srv *Management) GetModelRequiredSnaps(orgID, username, modelName string,
 var ErrModelNotFound = errors.New("model not found")
 var ErrRequiredSnapNotFound = errors.New("required snap not found")
 
-func (srv *Management) DeleteModelRequiredSnap(orgID, username, modelName, snapName string, role int) error {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+func (srv *Management) DeleteModelRequiredSnap(orgID, username, modelName, snapName string, role int) (err error) {
+	entry := auditEntry(username, orgID, datastore.AuditTargetModel, modelName, "model.required-snap-delete")
+	defer func() { srv.audit(entry, map[string]string{"snap": snapName}, err) }()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionAdminister)
 	if !hasAccess {
 		return NotAuthorizedErr
 	}
@@ -296,8 +336,11 @@ func (srv *Management) DeleteModelRequiredSnap(orgID, username, modelName, snapN
 	return nil
 }
 
-func (srv *Management) AddModelRequiredSnap(orgID, username, modelName, snapName string, role int) (*models.DeviceModelRequiredSnap, error) {
-	hasAccess := srv.DS.OrgUserAccess(orgID, username, role)
+func (srv *Management) AddModelRequiredSnap(orgID, username, modelName, snapName string, role int) (result *models.DeviceModelRequiredSnap, err error) {
+	entry := auditEntry(username, orgID, datastore.AuditTargetModel, modelName, "model.required-snap-add")
+	defer func() { srv.audit(entry, map[string]string{"snap": snapName}, err) }()
+
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionAdminister)
 	if !hasAccess {
 		return nil, NotAuthorizedErr
 	}
@@ -329,3 +372,19 @@ func (srv *Management) AddModelRequiredSnap(orgID, username, modelName, snapName
 
 	return requiredSnap, nil
 }
+
+// DriftedDevices lists the health hashes of the devices whose reported snaps don't match the device twin
+func (srv *Management) DriftedDevices(orgID, username string, role int) ([]models.HealthHash, error) {
+	hasAccess := srv.orgAccess(orgID, username, role, PermissionView)
+	if !hasAccess {
+		return nil, NotAuthorizedErr
+	}
+
+	var healthHashes []models.HealthHash
+	tx := srv.DB.Where("org_id = ? AND drifted = ?", orgID, true).Find(&healthHashes)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return healthHashes, nil
+}
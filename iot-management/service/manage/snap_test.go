@@ -61,6 +61,8 @@ func TestManagement_SnapList(t *testing.T) {
 			}
 
 			manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(tt.wantErr == "")
+
+			manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
 			identityMock.On("DeviceGet", mock.Anything, mock.Anything).Return(&domain.Enrollment{Organization: domain.Organization{ID: tt.args.orgID}}, nil)
 			deviceTwinController.On("DeviceSnaps", mock.Anything, mock.Anything).Return([]messages.DeviceSnap{{}}, nil)
 
@@ -94,6 +96,7 @@ func TestManagement_SnapInstall(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			manageDataStoreMock := &datastore.MockDataStore{}
+			manageDataStoreMock.On("AuditCreate", mock.Anything).Return(int64(1), nil)
 			identityMock := &mocks.Identity{}
 			deviceTwinController := &controller.MockController{}
 			srv := Management{
@@ -106,7 +109,9 @@ func TestManagement_SnapInstall(t *testing.T) {
 			}
 
 			manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(tt.wantErr == "")
-			deviceTwinController.On("DeviceSnapInstall", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
+			deviceTwinController.On("DeviceSnapInstall", mock.Anything, mock.Anything, mock.Anything).Return("", nil)
 
 			got := srv.SnapInstall(tt.args.orgID, tt.args.username, tt.args.role, tt.args.deviceID, tt.args.snap)
 			if got.Code != tt.wantErr {
@@ -135,6 +140,7 @@ func TestManagement_SnapRemove(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			manageDataStoreMock := &datastore.MockDataStore{}
+			manageDataStoreMock.On("AuditCreate", mock.Anything).Return(int64(1), nil)
 			identityMock := &mocks.Identity{}
 			deviceTwinController := &controller.MockController{}
 			srv := Management{
@@ -147,7 +153,9 @@ func TestManagement_SnapRemove(t *testing.T) {
 			}
 
 			manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(tt.wantErr == "")
-			deviceTwinController.On("DeviceSnapRemove", tt.args.orgID, tt.args.deviceID, tt.args.snap).Return(nil)
+
+			manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
+			deviceTwinController.On("DeviceSnapRemove", tt.args.orgID, tt.args.deviceID, tt.args.snap).Return("", nil)
 
 			got := srv.SnapRemove(tt.args.orgID, tt.args.username, tt.args.role, tt.args.deviceID, tt.args.snap)
 			if got.Code != tt.wantErr {
@@ -178,6 +186,7 @@ func TestManagement_SnapUpdate(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			manageDataStoreMock := &datastore.MockDataStore{}
+			manageDataStoreMock.On("AuditCreate", mock.Anything).Return(int64(1), nil)
 			identityMock := &mocks.Identity{}
 			deviceTwinController := &controller.MockController{}
 			srv := Management{
@@ -190,12 +199,14 @@ func TestManagement_SnapUpdate(t *testing.T) {
 			}
 
 			manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(tt.wantErr == "")
+
+			manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
 			var snapUpdate messages.SnapUpdate
 			err := json.Unmarshal(tt.args.body, &snapUpdate)
 			if err != nil {
 				t.Error(err)
 			}
-			deviceTwinController.On("DeviceSnapUpdate", tt.args.orgID, tt.args.deviceID, tt.args.snap, tt.args.action, &snapUpdate).Return(nil)
+			deviceTwinController.On("DeviceSnapUpdate", tt.args.orgID, tt.args.deviceID, tt.args.snap, tt.args.action, &snapUpdate).Return("", nil)
 
 			got := srv.SnapUpdate(tt.args.orgID, tt.args.username, tt.args.role, tt.args.deviceID, tt.args.snap, tt.args.action, tt.args.body)
 			if got.Code != tt.wantErr {
@@ -225,6 +236,7 @@ func TestManagement_SnapConfigSet(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			manageDataStoreMock := &datastore.MockDataStore{}
+			manageDataStoreMock.On("AuditCreate", mock.Anything).Return(int64(1), nil)
 			identityMock := &mocks.Identity{}
 			deviceTwinController := &controller.MockController{}
 			srv := Management{
@@ -237,7 +249,9 @@ func TestManagement_SnapConfigSet(t *testing.T) {
 			}
 
 			manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(tt.wantErr == "")
-			deviceTwinController.On("DeviceSnapConf", tt.args.orgID, tt.args.deviceID, tt.args.snap, string(tt.args.config)).Return(nil)
+
+			manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
+			deviceTwinController.On("DeviceSnapConf", tt.args.orgID, tt.args.deviceID, tt.args.snap, string(tt.args.config)).Return("", nil)
 
 			got := srv.SnapConfigSet(tt.args.orgID, tt.args.username, tt.args.role, tt.args.deviceID, tt.args.snap, tt.args.config)
 			if got.Code != tt.wantErr {
@@ -267,6 +281,7 @@ func TestManagement_SnapSnapshot(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			manageDataStoreMock := &datastore.MockDataStore{}
+			manageDataStoreMock.On("AuditCreate", mock.Anything).Return(int64(1), nil)
 			identityMock := &mocks.Identity{}
 			deviceTwinController := &controller.MockController{}
 			srv := Management{
@@ -279,12 +294,14 @@ func TestManagement_SnapSnapshot(t *testing.T) {
 			}
 
 			manageDataStoreMock.On("OrgUserAccess", mock.Anything, mock.Anything, mock.Anything).Return(tt.wantErr == "")
+
+			manageDataStoreMock.On("OrgUserRole", mock.Anything, mock.Anything).Return(datastore.OrgAdmin, nil)
 			var snapSnapshot messages.SnapSnapshot
 			err := json.Unmarshal(tt.args.body, &snapSnapshot)
 			if err != nil {
 				t.Error(err)
 			}
-			deviceTwinController.On("DeviceSnapSnapshot", tt.args.orgID, tt.args.deviceID, tt.args.snap, &snapSnapshot).Return(nil)
+			deviceTwinController.On("DeviceSnapSnapshot", tt.args.orgID, tt.args.deviceID, tt.args.snap, &snapSnapshot).Return("", nil)
 
 			got := srv.SnapSnapshot(tt.args.orgID, tt.args.username, tt.args.role, tt.args.deviceID, tt.args.snap, tt.args.body)
 			if got.Code != tt.wantErr {
@@ -0,0 +1,221 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+)
+
+// auditActionTransfer is the audit action of a device transfer, which the transfers of a device are listed from
+const auditActionTransfer = "device.transfer"
+
+// Steps of a device transfer job
+const (
+	transferStepIdentity   = "identity"
+	transferStepDeviceTwin = "device-twin"
+)
+
+var transferStepOrder = []string{
+	transferStepIdentity,
+	transferStepDeviceTwin,
+}
+
+var transferSteps = map[string]jobStepFunc{
+	transferStepIdentity:   transferIdentity,
+	transferStepDeviceTwin: transferDeviceTwin,
+}
+
+// transferParams is the organization a transfer job moves the device to
+type transferParams struct {
+	ToOrganizationID string `json:"toOrgId"`
+}
+
+// DeviceTransfer starts a job that moves a device to another organization. The user needs access to both
+// organizations. The identity registration is moved first, which reissues the device credentials from the CA of
+// the new organization and revokes the old certificate, then the device twin and its action history. Group links
+// are removed as the groups belong to the previous organization. A failed job can be resumed, each step picks up
+// where the transfer stopped.
+func (srv *Management) DeviceTransfer(orgID, username string, role int, deviceID string, body []byte) (result domain.Job, err error) {
+	entry := deviceAudit(username, orgID, deviceID, auditActionTransfer)
+	var toOrgID string
+	defer func() {
+		payload := jobAuditPayload(result, body)
+		payload["fromOrgId"] = orgID
+		payload["toOrgId"] = toOrgID
+		srv.audit(entry, payload, err)
+	}()
+
+	newOrgID, err := getUserOrgIDIfOrgName(srv, username, orgID)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	orgID = newOrgID
+	entry.OrganizationID = orgID
+
+	if !srv.orgAccess(orgID, username, role, PermissionAdminister) {
+		return domain.Job{}, NotAuthorizedErr
+	}
+
+	request := domain.DeviceTransferRequest{}
+	if err = json.Unmarshal(body, &request); err != nil {
+		return domain.Job{}, err
+	}
+
+	toOrgID, err = getUserOrgIDIfOrgName(srv, username, request.OrganizationID)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	if len(toOrgID) == 0 || toOrgID == orgID {
+		return domain.Job{}, fmt.Errorf("a different organization to transfer the device to is required")
+	}
+
+	if !srv.orgAccess(toOrgID, username, role, PermissionAdminister) {
+		return domain.Job{}, NotAuthorizedErr
+	}
+
+	org, err := srv.DS.OrganizationGet(toOrgID)
+	if err != nil || org.OrganizationID != toOrgID {
+		return domain.Job{}, fmt.Errorf("cannot find organization `%s`", toOrgID)
+	}
+
+	active, err := srv.activeJob(orgID, domain.JobKindTransfer, deviceID)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	if active != nil {
+		return domain.Job{}, fmt.Errorf("the device is already being transferred by job %d", active.ID)
+	}
+
+	enroll, err := srv.Identity.DeviceGet(orgID, deviceID)
+	if err != nil || enroll.Organization.ID != orgID {
+		return domain.Job{}, fmt.Errorf("the device `%s` does not belong to the organization", deviceID)
+	}
+
+	params, err := json.Marshal(transferParams{ToOrganizationID: toOrgID})
+	if err != nil {
+		return domain.Job{}, err
+	}
+
+	job := datastore.Job{
+		Kind:           domain.JobKindTransfer,
+		OrganizationID: orgID,
+		DeviceID:       enroll.ID,
+		Username:       username,
+		Parameters:     string(params),
+	}
+	job, err = srv.newJob(job, transferStepOrder, nil)
+	if err != nil {
+		return domain.Job{}, err
+	}
+	return jobToDomain(job), nil
+}
+
+func transferParameters(job *datastore.Job) (transferParams, error) {
+	params := transferParams{}
+	err := json.Unmarshal([]byte(job.Parameters), &params)
+	return params, err
+}
+
+// transferIdentity moves the identity registration, issuing the device credentials from the CA of the new
+// organization, unless it has already moved
+func transferIdentity(srv *Management, job *datastore.Job, step *datastore.JobStep) error {
+	params, err := transferParameters(job)
+	if err != nil {
+		return err
+	}
+
+	enroll, err := srv.Identity.DeviceGet(params.ToOrganizationID, job.DeviceID)
+	if err != nil {
+		return err
+	}
+	if enroll.Organization.ID != params.ToOrganizationID {
+		if _, err = srv.Identity.TransferDevice(job.DeviceID, params.ToOrganizationID); err != nil {
+			return err
+		}
+	}
+
+	step.Message = "the device must enroll again to fetch its new credentials"
+	return nil
+}
+
+// transferDeviceTwin moves the device twin and its action history, if the device has connected and so has a
+// device twin
+func transferDeviceTwin(srv *Management, job *datastore.Job, step *datastore.JobStep) error {
+	params, err := transferParameters(job)
+	if err != nil {
+		return err
+	}
+
+	if _, err = srv.DeviceTwinController.DeviceGet(job.OrganizationID, job.DeviceID); err == nil {
+		return srv.DeviceTwinController.DeviceTransfer(job.DeviceID, params.ToOrganizationID)
+	}
+	if _, err = srv.DeviceTwinController.DeviceGet(params.ToOrganizationID, job.DeviceID); err != nil {
+		step.Message = "the device has not connected, it has no device twin to transfer"
+	}
+	return nil
+}
+
+// DeviceTransferList lists the transfers between organizations of a device, most recent first, from the audit log
+func (srv *Management) DeviceTransferList(orgID, username string, role int, deviceID string) ([]domain.DeviceTransfer, error) {
+	if !srv.orgAccess(orgID, username, role, PermissionView) {
+		return nil, NotAuthorizedErr
+	}
+
+	entries, err := srv.DS.AuditList(datastore.AuditFilter{
+		TargetType: datastore.AuditTargetDevice,
+		Target:     deviceID,
+		Action:     auditActionTransfer,
+		Result:     datastore.AuditSuccess,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := []domain.DeviceTransfer{}
+	for _, e := range entries {
+		payload := struct {
+			Job                int64  `json:"job"`
+			FromOrganizationID string `json:"fromOrgId"`
+			ToOrganizationID   string `json:"toOrgId"`
+		}{}
+		if err = json.Unmarshal([]byte(e.Payload), &payload); err != nil {
+			continue
+		}
+
+		// Only the transfers into or out of the organization are visible to it
+		if payload.FromOrganizationID != orgID && payload.ToOrganizationID != orgID {
+			continue
+		}
+		list = append(list, domain.DeviceTransfer{
+			ID:                 e.ID,
+			Created:            e.Created,
+			DeviceID:           e.Target,
+			FromOrganizationID: payload.FromOrganizationID,
+			ToOrganizationID:   payload.ToOrganizationID,
+			Username:           e.Username,
+			JobID:              payload.Job,
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,176 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package manage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/iot-devicetwin/service/controller"
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service/mocks"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/datastore/memory"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTransferStore() *memory.Store {
+	db := memory.NewStore()
+	db.Orgs = append(db.Orgs, datastore.Organization{OrganizationID: "def", Name: "Other Org"}, datastore.Organization{OrganizationID: "ghi", Name: "Third Org"})
+	db.OrgUsers = append(db.OrgUsers, datastore.OrganizationUser{OrganizationID: "def", Username: "jamesj", Role: datastore.OrgAdmin})
+	return db
+}
+
+func TestManagement_DeviceTransfer(t *testing.T) {
+	toDef := []byte(`{"orgid":"def"}`)
+	type args struct {
+		username string
+		role     int
+		body     []byte
+	}
+	tests := []struct {
+		name        string
+		args        args
+		deviceOrg   string
+		hasTwin     bool
+		transferErr error
+		wantErr     bool
+		wantStatus  string
+	}{
+		{"valid", args{"jamesj", 200, toDef}, "abc", true, nil, false, domain.JobStatusCompleted},
+		{"valid-org-name", args{"jamesj", 200, []byte(`{"orgid":"Other Org"}`)}, "abc", true, nil, false, domain.JobStatusCompleted},
+		{"valid-no-twin", args{"jamesj", 200, toDef}, "abc", false, nil, false, domain.JobStatusCompleted},
+		{"invalid-transfer", args{"jamesj", 200, toDef}, "abc", true, errors.New("MOCK error"), false, domain.JobStatusFailed},
+		{"invalid-user", args{"sarahj", 200, toDef}, "abc", true, nil, true, ""},
+		{"invalid-target-access", args{"jamesj", 200, []byte(`{"orgid":"ghi"}`)}, "abc", true, nil, true, ""},
+		{"invalid-same-org", args{"jamesj", 200, []byte(`{"orgid":"abc"}`)}, "abc", true, nil, true, ""},
+		{"invalid-unknown-org", args{"jamesj", 300, []byte(`{"orgid":"xyz"}`)}, "abc", true, nil, true, ""},
+		{"invalid-device-org", args{"jamesj", 200, toDef}, "ghi", true, nil, true, ""},
+		{"invalid-body", args{"jamesj", 200, []byte(`\u1000`)}, "abc", true, nil, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTransferStore()
+			before := &iddomain.Enrollment{ID: "a111", Organization: iddomain.Organization{ID: tt.deviceOrg}}
+			after := &iddomain.Enrollment{ID: "a111", Organization: iddomain.Organization{ID: "def"}}
+
+			identityMock := &mocks.Identity{}
+			identityMock.On("DeviceGet", mock.Anything, "a111").Return(before, nil)
+			identityMock.On("TransferDevice", "a111", "def").Return(after, tt.transferErr)
+
+			twinMock := &controller.MockController{}
+			if tt.hasTwin {
+				twinMock.On("DeviceGet", "abc", "a111").Return(messages.Device{}, nil)
+			} else {
+				twinMock.On("DeviceGet", "abc", "a111").Return(messages.Device{}, errors.New("MOCK not found"))
+			}
+			twinMock.On("DeviceGet", "def", "a111").Return(messages.Device{}, errors.New("MOCK not found"))
+			twinMock.On("DeviceTransfer", "a111", "def").Return(nil)
+
+			srv := Management{DS: db, DeviceTwinController: twinMock, Identity: identityMock}
+
+			got, err := srv.DeviceTransfer("abc", tt.args.username, tt.args.role, "a111", tt.args.body)
+			if tt.wantErr {
+				assert.Error(t, err)
+				identityMock.AssertNotCalled(t, "TransferDevice", mock.Anything, mock.Anything)
+				twinMock.AssertNotCalled(t, "DeviceTransfer", mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, domain.JobKindTransfer, got.Kind)
+			assert.Equal(t, tt.wantStatus, got.Status)
+
+			transfers, err := srv.DeviceTransferList("def", "jamesj", 200, "a111")
+			assert.NoError(t, err)
+			assert.Len(t, transfers, 1)
+			assert.Equal(t, "abc", transfers[0].FromOrganizationID)
+			assert.Equal(t, "def", transfers[0].ToOrganizationID)
+			assert.Equal(t, tt.args.username, transfers[0].Username)
+			assert.Equal(t, got.ID, transfers[0].JobID)
+
+			if tt.hasTwin && tt.transferErr == nil {
+				twinMock.AssertCalled(t, "DeviceTransfer", "a111", "def")
+			} else {
+				twinMock.AssertNotCalled(t, "DeviceTransfer", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestManagement_DeviceTransferResume(t *testing.T) {
+	db := newTransferStore()
+	before := &iddomain.Enrollment{ID: "a111", Organization: iddomain.Organization{ID: "abc"}}
+	after := &iddomain.Enrollment{ID: "a111", Organization: iddomain.Organization{ID: "def"}}
+
+	identityMock := &mocks.Identity{}
+	identityMock.On("DeviceGet", mock.Anything, "a111").Return(before, nil).Twice()
+	identityMock.On("DeviceGet", mock.Anything, "a111").Return(after, nil)
+	identityMock.On("TransferDevice", "a111", "def").Return(after, nil).Once()
+
+	twinMock := &controller.MockController{}
+	twinMock.On("DeviceGet", "abc", "a111").Return(messages.Device{}, nil)
+	twinMock.On("DeviceTransfer", "a111", "def").Return(errors.New("MOCK error")).Once()
+	twinMock.On("DeviceTransfer", "a111", "def").Return(nil)
+
+	srv := Management{DS: db, DeviceTwinController: twinMock, Identity: identityMock}
+
+	// The registration is moved but the device twin is not
+	job, err := srv.DeviceTransfer("abc", "jamesj", 200, "a111", []byte(`{"orgid":"def"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, domain.JobStatusFailed, job.Status)
+	assert.Equal(t, domain.JobStepDone, job.Steps[0].Status)
+	assert.Equal(t, domain.JobStepFailed, job.Steps[1].Status)
+
+	_, err = srv.DeviceTransfer("abc", "jamesj", 200, "a111", []byte(`{"orgid":"def"}`))
+	assert.EqualError(t, err, "the device is already being transferred by job 1")
+
+	// Resuming moves the device twin, the registration is not moved again
+	job, err = srv.JobResume("abc", "jamesj", 200, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.JobStatusCompleted, job.Status)
+	identityMock.AssertNumberOfCalls(t, "TransferDevice", 1)
+	twinMock.AssertNumberOfCalls(t, "DeviceTransfer", 2)
+}
+
+func TestManagement_DeviceTransferList(t *testing.T) {
+	db := memory.NewStore()
+	transfer := func(orgID, payload string, result string) {
+		_, _ = db.AuditCreate(datastore.AuditEntry{OrganizationID: orgID, TargetType: datastore.AuditTargetDevice, Target: "a111", Action: auditActionTransfer, Payload: payload, Result: result})
+	}
+	transfer("abc", `{"job":1,"fromOrgId":"abc","toOrgId":"def"}`, datastore.AuditSuccess)
+	transfer("def", `{"job":2,"fromOrgId":"def","toOrgId":"ghi"}`, datastore.AuditSuccess)
+	transfer("abc", `{"fromOrgId":"abc","toOrgId":""}`, datastore.AuditFailure)
+	srv := Management{DS: db}
+
+	got, err := srv.DeviceTransferList("abc", "jamesj", 200, "a111")
+	assert.NoError(t, err)
+	assert.Len(t, got, 1)
+	assert.Equal(t, int64(1), got[0].JobID)
+
+	got, err = srv.DeviceTransferList("def", "jamesj", 300, "a111")
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+
+	_, err = srv.DeviceTransferList("def", "jamesj", 200, "a111")
+	assert.ErrorIs(t, err, NotAuthorizedErr)
+}
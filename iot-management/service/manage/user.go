@@ -20,6 +20,8 @@
 package manage
 
 import (
+	"fmt"
+
 	"github.com/everactive/dmscore/iot-management/datastore"
 	"github.com/everactive/dmscore/iot-management/domain"
 	"github.com/juju/usso/openid"
@@ -68,20 +70,22 @@ func (srv *Management) UserList() ([]domain.User, error) {
 }
 
 // CreateUser creates a new user
-func (srv *Management) CreateUser(user domain.User) error {
+func (srv *Management) CreateUser(username string, user domain.User) error {
 	u := datastore.User{
 		Username: user.Username,
 		Name:     user.Name,
 		Email:    user.Email,
 		Role:     user.Role,
+		Provider: datastore.UserProviderLocal,
 	}
 
 	_, err := srv.DS.CreateUser(u)
+	srv.audit(auditEntry(username, "", datastore.AuditTargetUser, user.Username, "user.create"), user, err)
 	return err
 }
 
 // UserUpdate updates a new user
-func (srv *Management) UserUpdate(user domain.User) error {
+func (srv *Management) UserUpdate(username string, user domain.User) error {
 	u := datastore.User{
 		ID:       user.ID,
 		Username: user.Username,
@@ -90,10 +94,83 @@ func (srv *Management) UserUpdate(user domain.User) error {
 		Role:     user.Role,
 	}
 
-	return srv.DS.UserUpdate(u)
+	err := srv.DS.UserUpdate(u)
+	srv.audit(auditEntry(username, "", datastore.AuditTargetUser, user.Username, "user.update"), user, err)
+	return err
+}
+
+// UserSync creates or updates a user authenticated by an external provider, and replaces their organization
+// roles with the ones given, by organization ID. The organizations of superusers are left as they are, they have
+// access to all of them. A user that was created by something else, locally or by another provider, is never
+// synced, so a provider cannot take over a user of the same name. The users created before the provider was
+// recorded were created by the providers, they are adopted by the first one that syncs them. Only the syncs that
+// change the user or their roles are audited.
+func (srv *Management) UserSync(provider string, user domain.User, orgRoles map[string]string) (err error) {
+	changed := false
+	defer func() {
+		if changed {
+			entry := auditEntry(user.Username, "", datastore.AuditTargetUser, user.Username, "user.sync")
+			srv.audit(entry, map[string]interface{}{"role": user.Role, "organizations": orgRoles}, err)
+		}
+	}()
+
+	u := datastore.User{
+		Username: user.Username,
+		Name:     user.Name,
+		Email:    user.Email,
+		Role:     user.Role,
+		Provider: provider,
+	}
+
+	existing, err := srv.DS.GetUser(user.Username)
+	if err != nil {
+		changed = true
+		if _, err = srv.DS.CreateUser(u); err != nil {
+			return err
+		}
+	} else if len(existing.Provider) > 0 && existing.Provider != provider {
+		changed = true
+		return fmt.Errorf("the user `%s` exists and was not created by %s", user.Username, provider)
+	} else if existing.Provider != provider || existing.Role != u.Role || existing.Name != u.Name || existing.Email != u.Email {
+		changed = true
+		if err = srv.DS.UserUpdate(u); err != nil {
+			return err
+		}
+	}
+
+	if user.Role == datastore.Superuser {
+		return nil
+	}
+
+	orgs, err := srv.DS.OrganizationsForUser(user.Username)
+	if err != nil {
+		return err
+	}
+	for _, o := range orgs {
+		if _, ok := orgRoles[o.OrganizationID]; ok {
+			continue
+		}
+		changed = true
+		if err = srv.DS.OrgUserRoleDelete(o.OrganizationID, user.Username); err != nil {
+			return err
+		}
+	}
+
+	for orgID, orgRole := range orgRoles {
+		if current, err := srv.DS.OrgUserRole(orgID, user.Username); err == nil && current == orgRole {
+			continue
+		}
+		changed = true
+		if err = srv.DS.OrgUserRoleSet(orgID, user.Username, orgRole); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // UserDelete removes a user
-func (srv *Management) UserDelete(username string) error {
-	return srv.DS.UserDelete(username)
+func (srv *Management) UserDelete(username, target string) error {
+	err := srv.DS.UserDelete(target)
+	srv.audit(auditEntry(username, "", datastore.AuditTargetUser, target, "user.delete"), nil, err)
+	return err
 }
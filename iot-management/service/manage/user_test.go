@@ -22,6 +22,7 @@ package manage
 import (
 	"testing"
 
+	"github.com/everactive/dmscore/iot-management/datastore"
 	"github.com/everactive/dmscore/iot-management/datastore/memory"
 	"github.com/everactive/dmscore/iot-management/domain"
 )
@@ -122,7 +123,7 @@ func TestManagement_CreateUser(t *testing.T) {
 				DeviceTwinController: nil,
 				Identity:             nil,
 			}
-			if err := srv.CreateUser(tt.args.user); (err != nil) != tt.wantErr {
+			if err := srv.CreateUser("jamesj", tt.args.user); (err != nil) != tt.wantErr {
 				t.Errorf("Management.CreateUser() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -151,7 +152,7 @@ func TestManagement_UserUpdate(t *testing.T) {
 				DeviceTwinController: nil,
 				Identity:             nil,
 			}
-			if err := srv.UserUpdate(tt.args.user); (err != nil) != tt.wantErr {
+			if err := srv.UserUpdate("jamesj", tt.args.user); (err != nil) != tt.wantErr {
 				t.Errorf("Management.UserUpdate() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -179,9 +180,100 @@ func TestManagement_UserDelete(t *testing.T) {
 				DeviceTwinController: nil,
 				Identity:             nil,
 			}
-			if err := srv.UserDelete(tt.args.username); (err != nil) != tt.wantErr {
+			if err := srv.UserDelete("jamesj", tt.args.username); (err != nil) != tt.wantErr {
 				t.Errorf("Management.UserDelete() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestManagement_UserSync(t *testing.T) {
+	db := memory.NewStore()
+	db.Orgs = append(db.Orgs, datastore.Organization{OrganizationID: "def", Name: "Other Org"})
+	srv := Management{DS: db}
+
+	// A new user is created with their organization roles
+	err := srv.UserSync(datastore.UserProviderKeycloak, domain.User{Username: "sarahj", Name: "SJ", Role: datastore.Standard}, map[string]string{"abc": datastore.OrgOperator})
+	if err != nil {
+		t.Fatalf("Management.UserSync() error = %v", err)
+	}
+	if u, _ := db.GetUser("sarahj"); u.Role != datastore.Standard || u.Name != "SJ" {
+		t.Errorf("Management.UserSync() user = %v", u)
+	}
+	if orgRole, _ := db.OrgUserRole("abc", "sarahj"); orgRole != datastore.OrgOperator {
+		t.Errorf("Management.UserSync() role = %v, want %v", orgRole, datastore.OrgOperator)
+	}
+
+	// The roles are replaced by the ones given
+	err = srv.UserSync(datastore.UserProviderKeycloak, domain.User{Username: "sarahj", Name: "SJ", Role: datastore.Admin}, map[string]string{"def": datastore.OrgAdmin})
+	if err != nil {
+		t.Fatalf("Management.UserSync() error = %v", err)
+	}
+	if u, _ := db.GetUser("sarahj"); u.Role != datastore.Admin {
+		t.Errorf("Management.UserSync() user role = %v, want %v", u.Role, datastore.Admin)
+	}
+	if db.OrgUserAccess("abc", "sarahj", datastore.Admin) {
+		t.Error("Management.UserSync() the user is still a member of the organization")
+	}
+	if orgRole, _ := db.OrgUserRole("def", "sarahj"); orgRole != datastore.OrgAdmin {
+		t.Errorf("Management.UserSync() role = %v, want %v", orgRole, datastore.OrgAdmin)
+	}
+
+	// Only the provider that created the user syncs it
+	err = srv.UserSync(datastore.UserProviderAPIToken, domain.User{Username: "sarahj", Role: datastore.Superuser}, nil)
+	if err == nil {
+		t.Error("Management.UserSync() expected an error syncing the user of another provider")
+	}
+	if u, _ := db.GetUser("sarahj"); u.Role != datastore.Admin || u.Provider != datastore.UserProviderKeycloak {
+		t.Errorf("Management.UserSync() user = %v", u)
+	}
+}
+
+func TestManagement_UserSyncLocalUser(t *testing.T) {
+	db := memory.NewStore()
+	srv := Management{DS: db}
+	if err := srv.CreateUser("jamesj", domain.User{Username: "localj", Name: "LJ", Role: datastore.Admin}); err != nil {
+		t.Fatalf("Management.CreateUser() error = %v", err)
+	}
+	_ = db.OrgUserRoleSet("abc", "localj", datastore.OrgAdmin)
+
+	// A local user is never synced, the provider cannot take it over
+	err := srv.UserSync(datastore.UserProviderKeycloak, domain.User{Username: "localj", Role: datastore.Standard}, map[string]string{"abc": datastore.OrgViewer})
+	if err == nil {
+		t.Fatal("Management.UserSync() expected an error syncing a local user")
+	}
+	if u, _ := db.GetUser("localj"); u.Role != datastore.Admin || u.Provider != datastore.UserProviderLocal {
+		t.Errorf("Management.UserSync() user = %v", u)
+	}
+	if orgRole, _ := db.OrgUserRole("abc", "localj"); orgRole != datastore.OrgAdmin {
+		t.Errorf("Management.UserSync() role = %v, want %v", orgRole, datastore.OrgAdmin)
+	}
+}
+
+func TestManagement_UserSyncExistingUser(t *testing.T) {
+	db := memory.NewStore()
+	srv := Management{DS: db}
+
+	// jamesj was created before the provider was recorded, like the users created by the earlier Keycloak login
+	if u, _ := db.GetUser("jamesj"); u.Provider != "" {
+		t.Fatalf("Store.GetUser() provider = %v, want none", u.Provider)
+	}
+
+	// The first provider that syncs the user adopts it
+	err := srv.UserSync(datastore.UserProviderKeycloak, domain.User{Username: "jamesj", Name: "JJ", Role: datastore.Standard}, map[string]string{"abc": datastore.OrgViewer})
+	if err != nil {
+		t.Fatalf("Management.UserSync() error = %v", err)
+	}
+	if u, _ := db.GetUser("jamesj"); u.Role != datastore.Standard || u.Provider != datastore.UserProviderKeycloak {
+		t.Errorf("Management.UserSync() user = %v", u)
+	}
+	if orgRole, _ := db.OrgUserRole("abc", "jamesj"); orgRole != datastore.OrgViewer {
+		t.Errorf("Management.UserSync() role = %v, want %v", orgRole, datastore.OrgViewer)
+	}
+
+	// It is then kept by that provider
+	err = srv.UserSync(datastore.UserProviderAPIToken, domain.User{Username: "jamesj", Role: datastore.Superuser}, nil)
+	if err == nil {
+		t.Error("Management.UserSync() expected an error syncing the user of another provider")
+	}
+}
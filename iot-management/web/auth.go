@@ -37,6 +37,9 @@ func (wb Service) checkIsStandardAndGetUserFromJWT(c *gin.Context) (datastore.Us
 	return wb.checkPermissionsAndGetUserFromJWT(c, datastore.Standard)
 }
 
+// APITokenAuthType is the Auth-Type header of the requests authorized with an API token
+const APITokenAuthType = "api-token"
+
 // VerifyTokenAndUser is a variable function to verify the token and extract the user based on the current provider
 var VerifyTokenAndUser = func(authorizationToken string, wb Service) (datastore.User, error) {
 	return datastore.User{}, errors.New("service account authorization not configured")
@@ -47,6 +50,11 @@ func (wb Service) checkPermissionsAndGetUserFromJWT(c *gin.Context, minimumAutho
 	authProvider := strings.ToLower(viper.GetString(keys.AuthProvider))
 	log.Tracef("Auth provider: %s, Auth-Type: %s", authProvider, authType)
 
+	// API tokens are accepted whatever the auth provider is
+	if authType == APITokenAuthType {
+		return wb.verifyAPIToken(c.GetHeader("Authorization"))
+	}
+
 	if (authProvider == "static-client" || authProvider == "keycloak") && (authType == "static-client" || authType == "keycloak") {
 		token := c.GetHeader("Authorization")
 		log.Tracef("Authorization token: %s", token)
@@ -64,6 +72,23 @@ func (wb Service) checkPermissionsAndGetUserFromJWT(c *gin.Context, minimumAutho
 	return user, nil
 }
 
+// verifyAPIToken checks the API token of the Authorization header and returns the user it acts as
+func (wb Service) verifyAPIToken(authorization string) (datastore.User, error) {
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return datastore.User{}, errors.New("the authorization header is not a bearer token")
+	}
+
+	user, err := wb.Manage.APITokenVerify(strings.TrimPrefix(authorization, "Bearer "))
+	if err != nil {
+		return datastore.User{}, err
+	}
+	return datastore.User{
+		Username: user.Username,
+		Name:     user.Name,
+		Role:     user.Role,
+	}, nil
+}
+
 func (wb Service) getUserFromJWT(c *gin.Context) (datastore.User, error) {
 	token, err := wb.JWTCheck(c)
 	if err != nil {
@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"io"
+	"net/http"
+
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/web"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/gin-gonic/gin"
+)
+
+// AccountKeysResponse defines the response to list or add account keys
+type AccountKeysResponse struct {
+	web.StandardResponse
+	AccountKeys []iddomain.AccountKey `json:"accountKeys"`
+}
+
+// AccountKeyListHandler lists the account keys trusted for auto-registration
+func (wb Service) AccountKeyListHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	accountKeys, err := wb.Manage.AccountKeyList()
+	if err != nil {
+		formatStandardResponse("AccountKeyList", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, AccountKeysResponse{AccountKeys: accountKeys})
+}
+
+// AccountKeyAddHandler uploads account-key assertions, sent as the request body
+func (wb Service) AccountKeyAddHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	assertions, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		formatStandardResponse("AccountKeyAdd", err.Error(), c)
+		return
+	}
+
+	accountKeys, err := wb.Manage.AccountKeyAdd(user.Username, assertions)
+	if err != nil {
+		formatStandardResponse("AccountKeyAdd", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, AccountKeysResponse{AccountKeys: accountKeys})
+}
+
+// AccountKeyDeleteHandler stops trusting an account key
+func (wb Service) AccountKeyDeleteHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	if err = wb.Manage.AccountKeyDelete(user.Username, c.Param("id")); err != nil {
+		formatStandardResponse("AccountKeyDelete", err.Error(), c)
+		return
+	}
+	formatStandardResponse("", "", c)
+}
+
+// AccountKeysRefreshHandler reloads the account keys from the files and the store
+func (wb Service) AccountKeysRefreshHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	if err = wb.Manage.AccountKeysRefresh(user.Username); err != nil {
+		formatStandardResponse("AccountKeyRefresh", err.Error(), c)
+		return
+	}
+	formatStandardResponse("", "", c)
+}
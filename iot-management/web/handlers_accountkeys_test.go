@@ -0,0 +1,182 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/everactive/dmscore/config/keys"
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-management/service/manage"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestService_AccountKeyListHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		manageErr   error
+		want        int
+		wantLen     int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, 1, ""},
+		{"invalid-permissions", 200, nil, http.StatusUnauthorized, 0, "UserAuth"},
+		{"invalid-list", 300, errors.New("MOCK error list"), http.StatusBadRequest, 0, "AccountKeyList"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("AccountKeyList").Return([]iddomain.AccountKey{{SignKeyID: "key1", AccountID: "acc1", Active: true}}, tt.manageErr)
+
+			w := sendRequest("GET", "/v1/account-keys", nil, wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			result := AccountKeysResponse{}
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Errorf("Error decoding the account keys response: %v", err)
+			}
+			if result.Code != tt.wantErr {
+				t.Errorf("Web.AccountKeyListHandler() got = %v, want %v", result.Code, tt.wantErr)
+			}
+			if len(result.AccountKeys) != tt.wantLen {
+				t.Errorf("Web.AccountKeyListHandler() got %v keys, want %v", len(result.AccountKeys), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestService_AccountKeyAddHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		manageErr   error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, ""},
+		{"invalid-permissions", 200, nil, http.StatusUnauthorized, "UserAuth"},
+		{"invalid-assertions", 300, errors.New("MOCK error add"), http.StatusBadRequest, "AccountKeyAdd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("AccountKeyAdd", "jamesj", []byte("ASSERTIONS")).Return([]iddomain.AccountKey{{SignKeyID: "key1"}}, tt.manageErr)
+
+			w := sendRequest("POST", "/v1/account-keys", bytes.NewReader([]byte("ASSERTIONS")), wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.AccountKeyAddHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_AccountKeyDeleteHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		manageErr   error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, ""},
+		{"invalid-permissions", 200, nil, http.StatusUnauthorized, "UserAuth"},
+		{"invalid-key", 300, errors.New("MOCK error delete"), http.StatusBadRequest, "AccountKeyDelete"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("AccountKeyDelete", "jamesj", "key1").Return(tt.manageErr)
+
+			w := sendRequest("DELETE", "/v1/account-keys/key1", nil, wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.AccountKeyDeleteHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_AccountKeysRefreshHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		manageErr   error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, ""},
+		{"invalid-permissions", 200, nil, http.StatusUnauthorized, "UserAuth"},
+		{"invalid-refresh", 300, errors.New("MOCK error refresh"), http.StatusBadRequest, "AccountKeyRefresh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("AccountKeysRefresh", "jamesj").Return(tt.manageErr)
+
+			w := sendRequest("POST", "/v1/account-keys/refresh", nil, wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.AccountKeysRefreshHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
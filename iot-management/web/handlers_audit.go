@@ -0,0 +1,162 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/everactive/dmscore/iot-devicetwin/web"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditFormatCSV is the format query parameter to export the audit log as CSV
+const AuditFormatCSV = "csv"
+
+// auditCSVHeader is the header row of the CSV export of the audit log
+var auditCSVHeader = []string{"id", "created", "username", "orgid", "targetType", "target", "action", "payload", "result", "message", "actionId"}
+
+// auditCSVFormulaPrefixes are the first characters of the values that spreadsheets run as formulas
+const auditCSVFormulaPrefixes = "=+-@\t\r"
+
+// AuditListResponse defines the response to list the audit log
+type AuditListResponse struct {
+	web.StandardResponse
+	Entries []domain.AuditEntry `json:"entries"`
+}
+
+// AuditListHandler is the API method to list the audit log, most recent first. The entries are filtered by the
+// user, orgid, device, targetType, target, action and result query parameters, from and to are RFC 3339 times,
+// limit is the most entries listed and offset the number of entries skipped. The log is exported as CSV when the
+// format query parameter is csv.
+func (wb Service) AuditListHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	format := c.Query("format")
+	if format != "" && format != "json" && format != AuditFormatCSV {
+		formatStandardResponse("AuditList", "format must be json or csv", c)
+		return
+	}
+
+	filter, err := auditFilter(c)
+	if err != nil {
+		formatStandardResponse("AuditList", err.Error(), c)
+		return
+	}
+
+	entries, err := wb.Manage.AuditList(user.Username, user.Role, filter)
+	if err != nil {
+		formatStandardResponse("AuditList", err.Error(), c)
+		return
+	}
+
+	if format != AuditFormatCSV {
+		c.JSON(http.StatusOK, AuditListResponse{Entries: entries})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", "attachment; filename=audit.csv")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write(auditCSVHeader)
+	for _, e := range entries {
+		_ = w.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.Created.Format(time.RFC3339),
+			auditCSVValue(e.Username),
+			auditCSVValue(e.OrganizationID),
+			auditCSVValue(e.TargetType),
+			auditCSVValue(e.Target),
+			auditCSVValue(e.Action),
+			auditCSVValue(e.Payload),
+			auditCSVValue(e.Result),
+			auditCSVValue(e.Message),
+			auditCSVValue(e.ActionID),
+		})
+	}
+	w.Flush()
+}
+
+// auditCSVValue escapes a value of the CSV export that a spreadsheet would run as a formula, by prefixing it with
+// a quote
+func auditCSVValue(value string) string {
+	if len(value) > 0 && strings.ContainsRune(auditCSVFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// auditFilter reads the filter of the audit log from the query parameters
+func auditFilter(c *gin.Context) (domain.AuditFilter, error) {
+	filter := domain.AuditFilter{
+		Username:       c.Query("user"),
+		OrganizationID: c.Query("orgid"),
+		TargetType:     c.Query("targetType"),
+		Target:         c.Query("target"),
+		Action:         c.Query("action"),
+		Result:         c.Query("result"),
+	}
+
+	if device := c.Query("device"); len(device) > 0 {
+		filter.TargetType = datastore.AuditTargetDevice
+		filter.Target = device
+	}
+
+	for param, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(param)
+		if len(value) == 0 {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 time", param)
+		}
+		*t = parsed
+	}
+
+	if l := c.Query("limit"); len(l) > 0 {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			return filter, fmt.Errorf("limit must be a non-negative number")
+		}
+		filter.Limit = limit
+	}
+
+	if o := c.Query("offset"); len(o) > 0 {
+		offset, err := strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			return filter, fmt.Errorf("offset must be a non-negative number")
+		}
+		filter.Offset = offset
+	}
+	return filter, nil
+}
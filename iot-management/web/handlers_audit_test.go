@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/everactive/dmscore/iot-management/service/manage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_AuditListHandler(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2023-03-01T00:00:00Z")
+	tests := []struct {
+		name        string
+		url         string
+		permissions int
+		filter      domain.AuditFilter
+		err         error
+		want        int
+		wantErr     string
+	}{
+		{"valid", "/v1/audit", 300, domain.AuditFilter{}, nil, http.StatusOK, ""},
+		{"valid-filter", "/v1/audit?orgid=abc&user=jamesj&action=snap.install&result=success&limit=10", 200, domain.AuditFilter{OrganizationID: "abc", Username: "jamesj", Action: "snap.install", Result: datastore.AuditSuccess, Limit: 10}, nil, http.StatusOK, ""},
+		{"valid-device", "/v1/audit?orgid=abc&device=a111&from=2023-03-01T00:00:00Z", 200, domain.AuditFilter{OrganizationID: "abc", TargetType: datastore.AuditTargetDevice, Target: "a111", From: from}, nil, http.StatusOK, ""},
+		{"invalid-from", "/v1/audit?from=yesterday", 300, domain.AuditFilter{}, nil, http.StatusBadRequest, "AuditList"},
+		{"valid-offset", "/v1/audit?limit=100&offset=200", 300, domain.AuditFilter{Limit: 100, Offset: 200}, nil, http.StatusOK, ""},
+		{"invalid-limit", "/v1/audit?limit=-1", 300, domain.AuditFilter{}, nil, http.StatusBadRequest, "AuditList"},
+		{"invalid-offset", "/v1/audit?offset=next", 300, domain.AuditFilter{}, nil, http.StatusBadRequest, "AuditList"},
+		{"invalid-format", "/v1/audit?format=xml", 300, domain.AuditFilter{}, nil, http.StatusBadRequest, "AuditList"},
+		{"invalid-list", "/v1/audit", 200, domain.AuditFilter{}, manage.NotAuthorizedErr, http.StatusBadRequest, "AuditList"},
+		{"invalid-permissions", "/v1/audit", 0, domain.AuditFilter{}, nil, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			manageMock.On("AuditList", "jamesj", tt.permissions, tt.filter).Return([]domain.AuditEntry{}, tt.err)
+
+			wb := NewService(manageMock, gin.Default())
+			w := sendRequest("GET", tt.url, nil, wb, "jamesj", secret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.AuditListHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_AuditListHandlerCSV(t *testing.T) {
+	secret := createAndSetJWTSecret(t)
+
+	created, _ := time.Parse(time.RFC3339, "2023-03-01T10:00:00Z")
+	entries := []domain.AuditEntry{
+		{ID: 2, Created: created, Username: "jamesj", OrganizationID: "abc", TargetType: "device", Target: "a111", Action: "snap.config", Payload: `{"snap":"helloworld","request":{"title":"hi, there"}}`, Result: "success", ActionID: "act-1"},
+		{ID: 1, Created: created, Username: "=cmd|' /C calc'!A0", OrganizationID: "abc", TargetType: "device", Target: "@SUM(1+1)", Action: "device.delete", Result: "failure", Message: "-1+1"},
+	}
+	manageMock := &manage.MockManage{}
+	manageMock.On("AuditList", "jamesj", 300, mock.Anything).Return(entries, nil)
+
+	wb := NewService(manageMock, gin.Default())
+	w := sendRequest("GET", "/v1/audit?format=csv", nil, wb, "jamesj", secret, 300)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		auditCSVHeader,
+		{"2", "2023-03-01T10:00:00Z", "jamesj", "abc", "device", "a111", "snap.config", `{"snap":"helloworld","request":{"title":"hi, there"}}`, "success", "", "act-1"},
+		{"1", "2023-03-01T10:00:00Z", "'=cmd|' /C calc'!A0", "abc", "device", "'@SUM(1+1)", "device.delete", "", "failure", "'-1+1", ""},
+	}, records)
+
+	manageMock = &manage.MockManage{}
+	manageMock.On("AuditList", "jamesj", 300, mock.Anything).Return(nil, errors.New("MOCK error"))
+	wb = NewService(manageMock, gin.Default())
+	w = sendRequest("GET", "/v1/audit?format=csv", nil, wb, "jamesj", secret, 300)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,179 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/web"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/gin-gonic/gin"
+)
+
+// AutoRegistrationRulesResponse defines the response to list auto-registration rules
+type AutoRegistrationRulesResponse struct {
+	web.StandardResponse
+	Rules []iddomain.AutoRegistrationRule `json:"rules"`
+}
+
+// AutoRegistrationRuleResponse defines the response to create an auto-registration rule
+type AutoRegistrationRuleResponse struct {
+	web.StandardResponse
+	Rule iddomain.AutoRegistrationRule `json:"rule"`
+}
+
+// AutoRegistrationEvaluationResponse defines the response to a dry-run of auto-registration
+type AutoRegistrationEvaluationResponse struct {
+	web.StandardResponse
+	Evaluation *iddomain.AutoRegistrationEvaluation `json:"evaluation"`
+}
+
+// AutoRegistrationRuleListHandler lists the auto-registration rules in the order they are tried
+func (wb Service) AutoRegistrationRuleListHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	rules, err := wb.Manage.AutoRegistrationRuleList()
+	if err != nil {
+		formatStandardResponse("AutoRegistrationRuleList", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, AutoRegistrationRulesResponse{Rules: rules})
+}
+
+// AutoRegistrationRuleCreateHandler adds an auto-registration rule
+func (wb Service) AutoRegistrationRuleCreateHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	rule := iddomain.AutoRegistrationRule{}
+	if err = json.NewDecoder(c.Request.Body).Decode(&rule); err != nil {
+		formatStandardResponse("AutoRegistrationRuleCreate", err.Error(), c)
+		return
+	}
+
+	rule.ID, err = wb.Manage.AutoRegistrationRuleCreate(user.Username, rule)
+	if err != nil {
+		formatStandardResponse("AutoRegistrationRuleCreate", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, AutoRegistrationRuleResponse{Rule: rule})
+}
+
+// AutoRegistrationRuleUpdateHandler replaces an auto-registration rule
+func (wb Service) AutoRegistrationRuleUpdateHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	ruleID, err := ruleIDParam(c)
+	if err != nil {
+		formatStandardResponse("AutoRegistrationRuleUpdate", err.Error(), c)
+		return
+	}
+
+	rule := iddomain.AutoRegistrationRule{}
+	if err = json.NewDecoder(c.Request.Body).Decode(&rule); err != nil {
+		formatStandardResponse("AutoRegistrationRuleUpdate", err.Error(), c)
+		return
+	}
+	rule.ID = ruleID
+
+	if err = wb.Manage.AutoRegistrationRuleUpdate(user.Username, rule); err != nil {
+		formatStandardResponse("AutoRegistrationRuleUpdate", err.Error(), c)
+		return
+	}
+	formatStandardResponse("", "", c)
+}
+
+// AutoRegistrationRuleDeleteHandler deletes an auto-registration rule
+func (wb Service) AutoRegistrationRuleDeleteHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	ruleID, err := ruleIDParam(c)
+	if err != nil {
+		formatStandardResponse("AutoRegistrationRuleDelete", err.Error(), c)
+		return
+	}
+
+	if err = wb.Manage.AutoRegistrationRuleDelete(user.Username, ruleID); err != nil {
+		formatStandardResponse("AutoRegistrationRuleDelete", err.Error(), c)
+		return
+	}
+	formatStandardResponse("", "", c)
+}
+
+// AutoRegistrationEvaluateHandler is a dry-run of auto-registration for the model and serial assertion sent as the
+// request body
+func (wb Service) AutoRegistrationEvaluateHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	assertions, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		formatStandardResponse("AutoRegistrationEvaluate", err.Error(), c)
+		return
+	}
+
+	evaluation, err := wb.Manage.AutoRegistrationEvaluate(assertions)
+	if err != nil {
+		formatStandardResponse("AutoRegistrationEvaluate", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, AutoRegistrationEvaluationResponse{Evaluation: evaluation})
+}
+
+func ruleIDParam(c *gin.Context) (uint, error) {
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rule ID: %s", c.Param("id"))
+	}
+	return uint(ruleID), nil
+}
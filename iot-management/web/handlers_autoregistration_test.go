@@ -0,0 +1,236 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/everactive/dmscore/config/keys"
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-management/service/manage"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_AutoRegistrationRuleListHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		manageErr   error
+		want        int
+		wantLen     int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, 1, ""},
+		{"invalid-permissions", 200, nil, http.StatusUnauthorized, 0, "UserAuth"},
+		{"invalid-list", 300, errors.New("MOCK error list"), http.StatusBadRequest, 0, "AutoRegistrationRuleList"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("AutoRegistrationRuleList").Return([]iddomain.AutoRegistrationRule{{ID: 1, OrganizationID: "abc"}}, tt.manageErr)
+
+			w := sendRequest("GET", "/v1/auto-registration/rules", nil, wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			result := AutoRegistrationRulesResponse{}
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Errorf("Error decoding the rules response: %v", err)
+			}
+			if result.Code != tt.wantErr {
+				t.Errorf("Web.AutoRegistrationRuleListHandler() got = %v, want %v", result.Code, tt.wantErr)
+			}
+			if len(result.Rules) != tt.wantLen {
+				t.Errorf("Web.AutoRegistrationRuleListHandler() got %v rules, want %v", len(result.Rules), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestService_AutoRegistrationRuleCreateHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		data        []byte
+		manageErr   error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, []byte(`{"brand":"example","orgid":"abc","groups":["drones"]}`), nil, http.StatusOK, ""},
+		{"invalid-permissions", 200, []byte(`{}`), nil, http.StatusUnauthorized, "UserAuth"},
+		{"invalid-data", 300, []byte(`\u1000`), nil, http.StatusBadRequest, "AutoRegistrationRuleCreate"},
+		{"invalid-rule", 300, []byte(`{"brand":"example"}`), errors.New("MOCK error create"), http.StatusBadRequest, "AutoRegistrationRuleCreate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("AutoRegistrationRuleCreate", "jamesj", mock.Anything).Return(uint(7), tt.manageErr)
+
+			w := sendRequest("POST", "/v1/auto-registration/rules", bytes.NewReader(tt.data), wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			result := AutoRegistrationRuleResponse{}
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Errorf("Error decoding the rule response: %v", err)
+			}
+			if result.Code != tt.wantErr {
+				t.Errorf("Web.AutoRegistrationRuleCreateHandler() got = %v, want %v", result.Code, tt.wantErr)
+			}
+			if tt.wantErr == "" && result.Rule.ID != 7 {
+				t.Errorf("Web.AutoRegistrationRuleCreateHandler() rule ID = %v, want 7", result.Rule.ID)
+			}
+		})
+	}
+}
+
+func TestService_AutoRegistrationRuleUpdateHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		permissions int
+		data        []byte
+		manageErr   error
+		want        int
+		wantErr     string
+	}{
+		{"valid", "/v1/auto-registration/rules/1", 300, []byte(`{"brand":"example","orgid":"abc"}`), nil, http.StatusOK, ""},
+		{"invalid-permissions", "/v1/auto-registration/rules/1", 200, []byte(`{}`), nil, http.StatusUnauthorized, "UserAuth"},
+		{"invalid-id", "/v1/auto-registration/rules/one", 300, []byte(`{}`), nil, http.StatusBadRequest, "AutoRegistrationRuleUpdate"},
+		{"invalid-data", "/v1/auto-registration/rules/1", 300, []byte(`\u1000`), nil, http.StatusBadRequest, "AutoRegistrationRuleUpdate"},
+		{"invalid-rule", "/v1/auto-registration/rules/1", 300, []byte(`{}`), errors.New("MOCK error update"), http.StatusBadRequest, "AutoRegistrationRuleUpdate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("AutoRegistrationRuleUpdate", "jamesj", mock.MatchedBy(func(rule iddomain.AutoRegistrationRule) bool {
+				return rule.ID == 1
+			})).Return(tt.manageErr)
+
+			w := sendRequest("PUT", tt.url, bytes.NewReader(tt.data), wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.AutoRegistrationRuleUpdateHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_AutoRegistrationRuleDeleteHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		permissions int
+		manageErr   error
+		want        int
+		wantErr     string
+	}{
+		{"valid", "/v1/auto-registration/rules/1", 300, nil, http.StatusOK, ""},
+		{"invalid-permissions", "/v1/auto-registration/rules/1", 200, nil, http.StatusUnauthorized, "UserAuth"},
+		{"invalid-id", "/v1/auto-registration/rules/-1", 300, nil, http.StatusBadRequest, "AutoRegistrationRuleDelete"},
+		{"invalid-rule", "/v1/auto-registration/rules/1", 300, errors.New("MOCK error delete"), http.StatusBadRequest, "AutoRegistrationRuleDelete"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("AutoRegistrationRuleDelete", "jamesj", uint(1)).Return(tt.manageErr)
+
+			w := sendRequest("DELETE", tt.url, nil, wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.AutoRegistrationRuleDeleteHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_AutoRegistrationEvaluateHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		manageErr   error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, ""},
+		{"invalid-permissions", 200, nil, http.StatusUnauthorized, "UserAuth"},
+		{"invalid-assertions", 300, errors.New("MOCK error evaluate"), http.StatusBadRequest, "AutoRegistrationEvaluate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			evaluation := &iddomain.AutoRegistrationEvaluation{Eligible: true, OrganizationID: "abc", Rule: &iddomain.AutoRegistrationRule{ID: 1}}
+			manageMock.On("AutoRegistrationEvaluate", []byte("ASSERTIONS")).Return(evaluation, tt.manageErr)
+
+			w := sendRequest("POST", "/v1/auto-registration/evaluate", bytes.NewReader([]byte("ASSERTIONS")), wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			result := AutoRegistrationEvaluationResponse{}
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Errorf("Error decoding the evaluation response: %v", err)
+			}
+			if result.Code != tt.wantErr {
+				t.Errorf("Web.AutoRegistrationEvaluateHandler() got = %v, want %v", result.Code, tt.wantErr)
+			}
+			if tt.wantErr == "" && (result.Evaluation == nil || result.Evaluation.Rule.ID != 1) {
+				t.Errorf("Web.AutoRegistrationEvaluateHandler() evaluation = %v, want rule 1", result.Evaluation)
+			}
+		})
+	}
+}
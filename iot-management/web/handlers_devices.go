@@ -23,8 +23,12 @@ import (
 	"encoding/json"
 	"github.com/everactive/dmscore/api"
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/iot-devicetwin/web"
+	"io/ioutil"
 	"net/http"
 
+	"github.com/everactive/dmscore/iot-management/domain"
+
 	"github.com/everactive/dmscore/iot-management/datastore"
 	"github.com/gin-gonic/gin"
 
@@ -67,19 +71,132 @@ func (wb Service) DevicesListHandler(c *gin.Context) {
 
 }
 
-// DeviceDeleteHandler is the API method to delete a registered device
+// DeviceDeleteHandler is the API method to start a job that decommissions a device
 func (wb Service) DeviceDeleteHandler(c *gin.Context) {
-	w := c.Writer
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	job, err := wb.Manage.DeviceDelete(c.Param("orgid"), user.Username, user.Role, c.Param("deviceid"))
+	if err != nil {
+		formatStandardResponse("DeviceDelete", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, JobResponse{Job: job})
+}
+
+// DeviceTransfersResponse defines the response to list the transfers of a device
+type DeviceTransfersResponse struct {
+	web.StandardResponse
+	Transfers []domain.DeviceTransfer `json:"transfers"`
+}
+
+// DeviceTransferHandler is the API method to start a job that moves a device to another organization
+func (wb Service) DeviceTransferHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
 
+	b, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		formatStandardResponse("DeviceTransfer", "error reading the request", c)
+		return
+	}
+
+	job, err := wb.Manage.DeviceTransfer(c.Param("orgid"), user.Username, user.Role, c.Param("deviceid"), b)
+	if err != nil {
+		formatStandardResponse("DeviceTransfer", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, JobResponse{Job: job})
+}
+
+// DeviceTransferListHandler is the API method to list the transfers of a device between organizations
+func (wb Service) DeviceTransferListHandler(c *gin.Context) {
+	w := c.Writer
 	w.Header().Set("Content-Type", JSONHeader)
-	user, err := getUserFromContextAndCheckPermissions(c, datastore.Admin)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
 	if user == nil || err != nil {
 		formatStandardResponse("UserAuth", "", c)
 		return
 	}
-	// Delete the device
-	response := wb.Manage.DeviceDelete(c.Param("orgid"), user.Username, user.Role, c.Param("deviceid"))
-	_ = encodeResponse(response, w)
+
+	transfers, err := wb.Manage.DeviceTransferList(c.Param("orgid"), user.Username, user.Role, c.Param("deviceid"))
+	if err != nil {
+		formatStandardResponse("DeviceTransferList", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, DeviceTransfersResponse{Transfers: transfers})
+}
+
+// DeviceReplaceHandler is the API method to start a job that replaces a device with a new one
+func (wb Service) DeviceReplaceHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	b, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		formatStandardResponse("DeviceReplace", "error reading the request", c)
+		return
+	}
+
+	job, err := wb.Manage.DeviceReplace(c.Param("orgid"), user.Username, user.Role, c.Param("deviceid"), b)
+	if err != nil {
+		formatStandardResponse("DeviceReplace", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, JobResponse{Job: job})
+}
+
+// DeletedDevicesResponse defines the response to list the soft deleted devices
+type DeletedDevicesResponse struct {
+	web.StandardResponse
+	Devices []domain.DeletedDevice `json:"devices"`
+}
+
+// DeletedDeviceResponse defines the response to restore a soft deleted device
+type DeletedDeviceResponse struct {
+	web.StandardResponse
+	Device domain.DeletedDevice `json:"device"`
+}
+
+// DeviceDeletedListHandler is the API method to list the soft deleted devices of an organization
+func (wb Service) DeviceDeletedListHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	devices, err := wb.Manage.DeviceDeletedList(c.Param("orgid"), user.Username, user.Role)
+	if err != nil {
+		formatStandardResponse("DeviceDeletedList", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, DeletedDevicesResponse{Devices: devices})
+}
+
+// DeviceRestoreHandler is the API method to restore a soft deleted device
+func (wb Service) DeviceRestoreHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	device, err := wb.Manage.DeviceRestore(c.Param("orgid"), user.Username, user.Role, c.Param("deviceid"))
+	if err != nil {
+		formatStandardResponse("DeviceRestore", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, DeletedDeviceResponse{Device: device})
 }
 
 // DeviceGetHandler is the API method to get a registered device
@@ -20,8 +20,11 @@
 package web
 
 import (
+	"bytes"
+	"errors"
 	"github.com/everactive/dmscore/config/keys"
 	"github.com/everactive/dmscore/iot-devicetwin/web"
+	"github.com/everactive/dmscore/iot-management/domain"
 	"github.com/everactive/dmscore/iot-management/service/manage"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/mock"
@@ -115,3 +118,227 @@ func TestService_ActionListHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestService_DeviceTransferHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		err         error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, ""},
+		{"invalid-transfer", 300, errors.New("MOCK error"), http.StatusBadRequest, "DeviceTransfer"},
+		{"valid-standard", 100, nil, http.StatusOK, ""},
+		{"invalid-permissions", 0, nil, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := createAndSetJWTSecret(t)
+
+			body := []byte(`{"orgid":"def"}`)
+			manageMock := &manage.MockManage{}
+			manageMock.On("DeviceTransfer", "abc", "jamesj", tt.permissions, "a111", body).Return(domain.Job{ID: 1, Kind: domain.JobKindTransfer}, tt.err)
+
+			wb := NewService(manageMock, gin.Default())
+			w := sendRequest("POST", "/v1/abc/devices/a111/transfer", bytes.NewReader(body), wb, "jamesj", secret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.DeviceTransferHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_DeviceTransferListHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		err         error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, ""},
+		{"invalid-list", 300, errors.New("MOCK error"), http.StatusBadRequest, "DeviceTransferList"},
+		{"valid-standard", 100, nil, http.StatusOK, ""},
+		{"invalid-permissions", 0, nil, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			manageMock.On("DeviceTransferList", "abc", "jamesj", tt.permissions, "a111").Return([]domain.DeviceTransfer{{DeviceID: "a111"}}, tt.err)
+
+			wb := NewService(manageMock, gin.Default())
+			w := sendRequest("GET", "/v1/abc/devices/a111/transfers", nil, wb, "jamesj", secret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.DeviceTransferListHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_DeviceReplaceHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		err         error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, ""},
+		{"invalid-replace", 300, errors.New("MOCK error"), http.StatusBadRequest, "DeviceReplace"},
+		{"valid-standard", 100, nil, http.StatusOK, ""},
+		{"invalid-permissions", 0, nil, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := createAndSetJWTSecret(t)
+
+			body := []byte(`{"deviceId":"b222"}`)
+			manageMock := &manage.MockManage{}
+			manageMock.On("DeviceReplace", "abc", "jamesj", tt.permissions, "a111", body).Return(domain.Job{ID: 1, Status: domain.JobStatusWaiting}, tt.err)
+
+			wb := NewService(manageMock, gin.Default())
+			w := sendRequest("POST", "/v1/abc/devices/a111/replace", bytes.NewReader(body), wb, "jamesj", secret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.DeviceReplaceHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_DeviceDeleteHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		err         error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, ""},
+		{"invalid-delete", 300, errors.New("MOCK error"), http.StatusBadRequest, "DeviceDelete"},
+		{"valid-standard", 100, nil, http.StatusOK, ""},
+		{"invalid-permissions", 0, nil, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			manageMock.On("DeviceDelete", "abc", "jamesj", tt.permissions, "a111").Return(domain.Job{ID: 1, Kind: domain.JobKindDecommission}, tt.err)
+
+			wb := NewService(manageMock, gin.Default())
+			w := sendRequest("DELETE", "/v1/abc/devices/a111", nil, wb, "jamesj", secret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.DeviceDeleteHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_DeviceDeletedListHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		err         error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, ""},
+		{"invalid-list", 300, errors.New("MOCK error"), http.StatusBadRequest, "DeviceDeletedList"},
+		{"valid-standard", 100, nil, http.StatusOK, ""},
+		{"invalid-permissions", 0, nil, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			manageMock.On("DeviceDeletedList", "abc", "jamesj", tt.permissions).Return([]domain.DeletedDevice{{DeviceID: "a111", DeviceTwin: true}}, tt.err)
+
+			wb := NewService(manageMock, gin.Default())
+			w := sendRequest("GET", "/v1/abc/devices/deleted", nil, wb, "jamesj", secret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.DeviceDeletedListHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_DeviceRestoreHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		err         error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, ""},
+		{"invalid-restore", 300, errors.New("MOCK error"), http.StatusBadRequest, "DeviceRestore"},
+		{"valid-standard", 100, nil, http.StatusOK, ""},
+		{"invalid-permissions", 0, nil, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			manageMock.On("DeviceRestore", "abc", "jamesj", tt.permissions, "a111").Return(domain.DeletedDevice{DeviceID: "a111", DeviceTwin: true}, tt.err)
+
+			wb := NewService(manageMock, gin.Default())
+			w := sendRequest("POST", "/v1/abc/devices/a111/restore", nil, wb, "jamesj", secret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.DeviceRestoreHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service"
+	"github.com/everactive/dmscore/iot-identity/web"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/gin-gonic/gin"
+)
+
+// EnrollmentRequestsResponse defines the response to list enrollment requests
+type EnrollmentRequestsResponse struct {
+	web.StandardResponse
+	EnrollmentRequests []iddomain.EnrollmentRequest `json:"enrollmentRequests"`
+}
+
+// EnrollmentRequestListHandler lists the enrollment attempts of unregistered devices, optionally by status
+func (wb Service) EnrollmentRequestListHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	requests, err := wb.Manage.EnrollmentRequestList(c.Query("status"))
+	if err != nil {
+		formatStandardResponse("EnrollmentRequestList", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, EnrollmentRequestsResponse{EnrollmentRequests: requests})
+}
+
+// EnrollmentRequestApproveHandler registers the device of an enrollment request in an organization, so the
+// device's next enrollment attempt succeeds
+func (wb Service) EnrollmentRequestApproveHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	requestID, err := enrollmentRequestIDParam(c)
+	if err != nil {
+		formatStandardResponse("EnrollmentRequestApprove", err.Error(), c)
+		return
+	}
+
+	req := service.ApproveEnrollmentRequest{}
+	if err = json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		formatStandardResponse("EnrollmentRequestApprove", err.Error(), c)
+		return
+	}
+
+	deviceID, err := wb.Manage.EnrollmentRequestApprove(requestID, user.Username, req)
+	if err != nil {
+		formatStandardResponse("EnrollmentRequestApprove", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, web.RegisterResponse{ID: deviceID})
+}
+
+// EnrollmentRequestRejectHandler rejects an enrollment request
+func (wb Service) EnrollmentRequestRejectHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	requestID, err := enrollmentRequestIDParam(c)
+	if err != nil {
+		formatStandardResponse("EnrollmentRequestReject", err.Error(), c)
+		return
+	}
+
+	if err = wb.Manage.EnrollmentRequestReject(requestID, user.Username); err != nil {
+		formatStandardResponse("EnrollmentRequestReject", err.Error(), c)
+		return
+	}
+	formatStandardResponse("", "", c)
+}
+
+func enrollmentRequestIDParam(c *gin.Context) (uint, error) {
+	requestID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid enrollment request ID: %s", c.Param("id"))
+	}
+	return uint(requestID), nil
+}
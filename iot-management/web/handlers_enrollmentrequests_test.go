@@ -0,0 +1,158 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/everactive/dmscore/config/keys"
+	iddomain "github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/service"
+	"github.com/everactive/dmscore/iot-identity/web"
+	"github.com/everactive/dmscore/iot-management/service/manage"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func TestService_EnrollmentRequestListHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		permissions int
+		manageErr   error
+		want        int
+		wantLen     int
+		wantErr     string
+	}{
+		{"valid", "/v1/enrollment-requests?status=pending", 300, nil, http.StatusOK, 1, ""},
+		{"invalid-permissions", "/v1/enrollment-requests?status=pending", 200, nil, http.StatusUnauthorized, 0, "UserAuth"},
+		{"invalid-status", "/v1/enrollment-requests?status=pending", 300, errors.New("MOCK error list"), http.StatusBadRequest, 0, "EnrollmentRequestList"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("EnrollmentRequestList", "pending").Return([]iddomain.EnrollmentRequest{{ID: 1, Status: "pending"}}, tt.manageErr)
+
+			w := sendRequest("GET", tt.url, nil, wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			result := EnrollmentRequestsResponse{}
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Errorf("Error decoding the enrollment requests response: %v", err)
+			}
+			if result.Code != tt.wantErr {
+				t.Errorf("Web.EnrollmentRequestListHandler() got = %v, want %v", result.Code, tt.wantErr)
+			}
+			if len(result.EnrollmentRequests) != tt.wantLen {
+				t.Errorf("Web.EnrollmentRequestListHandler() got %v requests, want %v", len(result.EnrollmentRequests), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestService_EnrollmentRequestApproveHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		permissions int
+		data        []byte
+		manageErr   error
+		want        int
+		wantErr     string
+	}{
+		{"valid", "/v1/enrollment-requests/1/approve", 300, []byte(`{"orgid":"abc"}`), nil, http.StatusOK, ""},
+		{"invalid-permissions", "/v1/enrollment-requests/1/approve", 200, []byte(`{"orgid":"abc"}`), nil, http.StatusUnauthorized, "UserAuth"},
+		{"invalid-id", "/v1/enrollment-requests/one/approve", 300, []byte(`{"orgid":"abc"}`), nil, http.StatusBadRequest, "EnrollmentRequestApprove"},
+		{"invalid-data", "/v1/enrollment-requests/1/approve", 300, []byte(`\u1000`), nil, http.StatusBadRequest, "EnrollmentRequestApprove"},
+		{"invalid-approve", "/v1/enrollment-requests/1/approve", 300, []byte(`{"orgid":"abc"}`), errors.New("MOCK error approve"), http.StatusBadRequest, "EnrollmentRequestApprove"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("EnrollmentRequestApprove", uint(1), "jamesj", service.ApproveEnrollmentRequest{OrganizationID: "abc"}).Return("a111", tt.manageErr)
+
+			w := sendRequest("POST", tt.url, bytes.NewReader(tt.data), wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			result := web.RegisterResponse{}
+			if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+				t.Errorf("Error decoding the approve response: %v", err)
+			}
+			if result.Code != tt.wantErr {
+				t.Errorf("Web.EnrollmentRequestApproveHandler() got = %v, want %v", result.Code, tt.wantErr)
+			}
+			if tt.wantErr == "" && result.ID != "a111" {
+				t.Errorf("Web.EnrollmentRequestApproveHandler() device ID = %v, want a111", result.ID)
+			}
+		})
+	}
+}
+
+func TestService_EnrollmentRequestRejectHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		permissions int
+		manageErr   error
+		want        int
+		wantErr     string
+	}{
+		{"valid", "/v1/enrollment-requests/1/reject", 300, nil, http.StatusOK, ""},
+		{"invalid-permissions", "/v1/enrollment-requests/1/reject", 200, nil, http.StatusUnauthorized, "UserAuth"},
+		{"invalid-id", "/v1/enrollment-requests/one/reject", 300, nil, http.StatusBadRequest, "EnrollmentRequestReject"},
+		{"invalid-reject", "/v1/enrollment-requests/1/reject", 300, errors.New("MOCK error reject"), http.StatusBadRequest, "EnrollmentRequestReject"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("EnrollmentRequestReject", uint(1), "jamesj").Return(tt.manageErr)
+
+			w := sendRequest("POST", tt.url, nil, wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			result, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if result.Code != tt.wantErr {
+				t.Errorf("Web.EnrollmentRequestRejectHandler() got = %v, want %v", result.Code, tt.wantErr)
+			}
+		})
+	}
+}
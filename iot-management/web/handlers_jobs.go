@@ -0,0 +1,111 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/everactive/dmscore/iot-devicetwin/web"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// JobsResponse defines the response to list the jobs of an organization
+type JobsResponse struct {
+	web.StandardResponse
+	Jobs []domain.Job `json:"jobs"`
+}
+
+// JobResponse defines the response to fetch a job
+type JobResponse struct {
+	web.StandardResponse
+	Job domain.Job `json:"job"`
+}
+
+// JobListHandler is the API method to list the jobs of an organization
+func (wb Service) JobListHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	jobs, err := wb.Manage.JobList(c.Param("orgid"), user.Username, user.Role)
+	if err != nil {
+		formatStandardResponse("JobList", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, JobsResponse{Jobs: jobs})
+}
+
+// JobGetHandler is the API method to fetch a job with the progress of its steps
+func (wb Service) JobGetHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	jobID, err := jobIDParam(c)
+	if err != nil {
+		formatStandardResponse("JobGet", err.Error(), c)
+		return
+	}
+
+	job, err := wb.Manage.JobGet(c.Param("orgid"), user.Username, user.Role, jobID)
+	if err != nil {
+		formatStandardResponse("JobGet", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, JobResponse{Job: job})
+}
+
+// JobResumeHandler is the API method to run a failed or waiting job again
+func (wb Service) JobResumeHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	jobID, err := jobIDParam(c)
+	if err != nil {
+		formatStandardResponse("JobResume", err.Error(), c)
+		return
+	}
+
+	job, err := wb.Manage.JobResume(c.Param("orgid"), user.Username, user.Role, jobID)
+	if err != nil {
+		formatStandardResponse("JobResume", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, JobResponse{Job: job})
+}
+
+func jobIDParam(c *gin.Context) (int64, error) {
+	jobID, err := strconv.ParseInt(c.Param("jobid"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid job ID: %s", c.Param("jobid"))
+	}
+	return jobID, nil
+}
@@ -0,0 +1,83 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/everactive/dmscore/iot-management/service/manage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_JobHandlers(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		permissions int
+		err         error
+		want        int
+		wantErr     string
+	}{
+		{"valid-list", "GET", "/v1/abc/jobs", 300, nil, http.StatusOK, ""},
+		{"valid-get", "GET", "/v1/abc/jobs/1", 300, nil, http.StatusOK, ""},
+		{"valid-resume", "POST", "/v1/abc/jobs/1/resume", 300, nil, http.StatusOK, ""},
+		{"invalid-list", "GET", "/v1/abc/jobs", 300, errors.New("MOCK error"), http.StatusBadRequest, "JobList"},
+		{"invalid-get", "GET", "/v1/abc/jobs/1", 300, manage.ErrJobNotFound, http.StatusBadRequest, "JobGet"},
+		{"invalid-get-id", "GET", "/v1/abc/jobs/one", 300, nil, http.StatusBadRequest, "JobGet"},
+		{"invalid-resume", "POST", "/v1/abc/jobs/1/resume", 300, errors.New("MOCK error"), http.StatusBadRequest, "JobResume"},
+		{"invalid-resume-id", "POST", "/v1/abc/jobs/one/resume", 300, nil, http.StatusBadRequest, "JobResume"},
+		{"valid-standard-list", "GET", "/v1/abc/jobs", 100, nil, http.StatusOK, ""},
+		{"invalid-permissions-list", "GET", "/v1/abc/jobs", 0, nil, http.StatusUnauthorized, "UserAuth"},
+		{"valid-standard-get", "GET", "/v1/abc/jobs/1", 100, nil, http.StatusOK, ""},
+		{"invalid-permissions-get", "GET", "/v1/abc/jobs/1", 0, nil, http.StatusUnauthorized, "UserAuth"},
+		{"valid-standard-resume", "POST", "/v1/abc/jobs/1/resume", 100, nil, http.StatusOK, ""},
+		{"invalid-permissions-resume", "POST", "/v1/abc/jobs/1/resume", 0, nil, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := createAndSetJWTSecret(t)
+
+			job := domain.Job{ID: 1, OrganizationID: "abc", Status: domain.JobStatusCompleted}
+			manageMock := &manage.MockManage{}
+			manageMock.On("JobList", "abc", "jamesj", mock.Anything).Return([]domain.Job{job}, tt.err)
+			manageMock.On("JobGet", "abc", "jamesj", mock.Anything, int64(1)).Return(job, tt.err)
+			manageMock.On("JobResume", "abc", "jamesj", mock.Anything, int64(1)).Return(job, tt.err)
+
+			wb := NewService(manageMock, gin.Default())
+			w := sendRequest(tt.method, tt.url, nil, wb, "jamesj", secret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.JobHandlers() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"net/http"
 
 	"github.com/everactive/dmscore/iot-devicetwin/web"
+	"github.com/everactive/dmscore/iot-identity/service"
 	"github.com/everactive/dmscore/iot-management/datastore"
 	"github.com/everactive/dmscore/iot-management/domain"
 	"github.com/gin-gonic/gin"
@@ -55,6 +56,12 @@ type UserOrganizationsResponse struct {
 	Organizations []UserOrganization `json:"organizations"`
 }
 
+// OrganizationRolesResponse defines the response to list the roles of the members of an organization
+type OrganizationRolesResponse struct {
+	web.StandardResponse
+	Roles []domain.OrganizationRole `json:"roles"`
+}
+
 func formatOrganizationsResponse(orgs []domain.Organization, w http.ResponseWriter) {
 	response := OrganizationsResponse{Organizations: orgs}
 	_ = encodeResponse(response, w)
@@ -125,7 +132,7 @@ func (wb Service) OrganizationCreateHandler(c *gin.Context) {
 		return
 	}
 
-	if err = wb.Manage.OrganizationCreate(org); err != nil {
+	if err = wb.Manage.OrganizationCreate(user.Username, org); err != nil {
 		formatStandardResponse("OrgCreate", err.Error(), c)
 		return
 	}
@@ -161,13 +168,55 @@ func (wb Service) OrganizationUpdateHandler(c *gin.Context) {
 		return
 	}
 
-	if err = wb.Manage.OrganizationUpdate(org); err != nil {
+	if err = wb.Manage.OrganizationUpdate(user.Username, org); err != nil {
 		formatStandardResponse("OrgUpdate", err.Error(), c)
 		return
 	}
 	formatStandardResponse("", "", c)
 }
 
+// OrganizationCABundleHandler fetches the PEM bundle of CAs that brokers should trust for an organization's devices
+func (wb Service) OrganizationCABundleHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	bundle, err := wb.Manage.OrganizationCABundle(c.Param("id"), user.Username, user.Role)
+	if err != nil {
+		c.Writer.Header().Set("Content-Type", JSONHeader)
+		formatStandardResponse("OrgCA", err.Error(), c)
+		return
+	}
+	c.Data(http.StatusOK, PEMHeader, bundle)
+}
+
+// OrganizationCARotateHandler replaces the CA of an organization
+func (wb Service) OrganizationCARotateHandler(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	// An empty body generates a new CA with the default overlap
+	req := service.RotateOrganizationCARequest{}
+	err = json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil && err != io.EOF {
+		formatStandardResponse("OrgCARotate", err.Error(), c)
+		return
+	}
+
+	if err = wb.Manage.OrganizationCARotate(c.Param("id"), user.Username, req); err != nil {
+		formatStandardResponse("OrgCARotate", err.Error(), c)
+		return
+	}
+	formatStandardResponse("", "", c)
+}
+
 // OrganizationsForUserHandler fetches the organizations for a user
 func (wb Service) OrganizationsForUserHandler(c *gin.Context) {
 	w := c.Writer
@@ -213,9 +262,68 @@ func (wb Service) OrganizationUpdateForUserHandler(c *gin.Context) {
 		formatStandardResponse("UserAuth", "", c)
 		return
 	}
-	if err := wb.Manage.OrganizationForUserToggle(c.Param("orgid"), c.Param("username")); err != nil {
+	if err := wb.Manage.OrganizationForUserToggle(c.Param("orgid"), user.Username, c.Param("username")); err != nil {
 		formatStandardResponse("UserOrg", "", c)
 		return
 	}
 	formatStandardResponse("", "", c)
 }
+
+// OrganizationRoleListHandler lists the members of an organization with their roles
+func (wb Service) OrganizationRoleListHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	roles, err := wb.Manage.OrganizationRoleList(c.Param("id"), user.Username, user.Role)
+	if err != nil {
+		formatStandardResponse("OrgRoles", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, OrganizationRolesResponse{Roles: roles})
+}
+
+// OrganizationRoleSetHandler assigns a role to a user in an organization
+func (wb Service) OrganizationRoleSetHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	req := domain.OrganizationRole{}
+	err = json.NewDecoder(c.Request.Body).Decode(&req)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		formatStandardResponse("OrgRoleSet", "No role supplied", c)
+		return
+		// Check for parsing errors
+	case err != nil:
+		formatStandardResponse("OrgRoleSet", err.Error(), c)
+		return
+	}
+
+	if err = wb.Manage.OrganizationRoleSet(c.Param("id"), user.Username, user.Role, c.Param("username"), req.Role); err != nil {
+		formatStandardResponse("OrgRoleSet", err.Error(), c)
+		return
+	}
+	formatStandardResponse("", "", c)
+}
+
+// OrganizationRoleDeleteHandler removes a user from an organization
+func (wb Service) OrganizationRoleDeleteHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	if err = wb.Manage.OrganizationRoleDelete(c.Param("id"), user.Username, user.Role, c.Param("username")); err != nil {
+		formatStandardResponse("OrgRoleDelete", err.Error(), c)
+		return
+	}
+	formatStandardResponse("", "", c)
+}
@@ -117,10 +117,10 @@ func TestService_OrganizationCreateHandler(t *testing.T) {
 				if err != nil {
 					t.Error(err)
 				}
-				manageMock.On("OrganizationCreate", org).Return(nil)
+				manageMock.On("OrganizationCreate", "jamesj", org).Return(nil)
 				manageMock.On("OrganizationGet", org.Name).Return(domain2.Organization{}, nil)
 			} else {
-				manageMock.On("OrganizationCreate", mock.Anything).Return(errors.New("some error, doesn't matter"))
+				manageMock.On("OrganizationCreate", "jamesj", mock.Anything).Return(errors.New("some error, doesn't matter"))
 			}
 			w := sendRequest("POST", tt.url, bytes.NewReader(tt.data), wb, tt.username, viper.GetString(keys.JwtSecret), tt.permissions)
 			if w.Code != tt.want {
@@ -172,9 +172,9 @@ func TestService_OrganizationUpdateHandler(t *testing.T) {
 				if err != nil {
 					t.Error(err)
 				}
-				manageMock.On("OrganizationUpdate", org).Return(nil)
+				manageMock.On("OrganizationUpdate", "jamesj", org).Return(nil)
 			} else {
-				manageMock.On("OrganizationUpdate", mock.Anything).Return(errors.New("some error test, doesn't matter"))
+				manageMock.On("OrganizationUpdate", "jamesj", mock.Anything).Return(errors.New("some error test, doesn't matter"))
 			}
 
 			w := sendRequest("PUT", tt.url, bytes.NewReader(tt.data), wb, tt.username, viper.GetString(keys.JwtSecret), tt.permissions)
@@ -301,9 +301,9 @@ func TestService_OrganizationUpdateForUserHandler(t *testing.T) {
 
 			_, orgID := path.Split(tt.url)
 			if tt.wantErr == "" {
-				manageMock.On("OrganizationForUserToggle", orgID, tt.username).Return(nil)
+				manageMock.On("OrganizationForUserToggle", orgID, tt.username, tt.username).Return(nil)
 			} else {
-				manageMock.On("OrganizationForUserToggle", orgID, tt.username).Return(errors.New("doesn't matter"))
+				manageMock.On("OrganizationForUserToggle", orgID, tt.username, tt.username).Return(errors.New("doesn't matter"))
 			}
 
 			w := sendRequest("POST", tt.url, nil, wb, tt.username, viper.GetString(keys.JwtSecret), tt.permissions)
@@ -322,6 +322,53 @@ func TestService_OrganizationUpdateForUserHandler(t *testing.T) {
 	}
 }
 
+func TestService_OrganizationRoleHandlers(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		data        []byte
+		permissions int
+		err         error
+		want        int
+		wantErr     string
+	}{
+		{"valid-list", "GET", "/v1/organizations/abc/roles", nil, 100, nil, http.StatusOK, ""},
+		{"valid-set", "PUT", "/v1/organizations/abc/roles/sarahj", []byte(`{"role":"operator"}`), 100, nil, http.StatusOK, ""},
+		{"valid-delete", "DELETE", "/v1/organizations/abc/roles/sarahj", nil, 100, nil, http.StatusOK, ""},
+		{"invalid-list", "GET", "/v1/organizations/abc/roles", nil, 100, manage.NotAuthorizedErr, http.StatusBadRequest, "OrgRoles"},
+		{"invalid-set", "PUT", "/v1/organizations/abc/roles/sarahj", []byte(`{"role":"owner"}`), 100, errors.New("MOCK error"), http.StatusBadRequest, "OrgRoleSet"},
+		{"invalid-set-empty", "PUT", "/v1/organizations/abc/roles/sarahj", nil, 100, nil, http.StatusBadRequest, "OrgRoleSet"},
+		{"invalid-set-data", "PUT", "/v1/organizations/abc/roles/sarahj", []byte(`\u1000`), 100, nil, http.StatusBadRequest, "OrgRoleSet"},
+		{"invalid-delete", "DELETE", "/v1/organizations/abc/roles/sarahj", nil, 100, errors.New("MOCK error"), http.StatusBadRequest, "OrgRoleDelete"},
+		{"invalid-permissions", "GET", "/v1/organizations/abc/roles", nil, 0, nil, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			manageMock.On("OrganizationRoleList", "abc", "jamesj", tt.permissions).Return([]domain2.OrganizationRole{{Username: "jamesj", Role: "org-admin"}}, tt.err)
+			manageMock.On("OrganizationRoleSet", "abc", "jamesj", tt.permissions, "sarahj", mock.Anything).Return(tt.err)
+			manageMock.On("OrganizationRoleDelete", "abc", "jamesj", tt.permissions, "sarahj").Return(tt.err)
+
+			wb := NewService(manageMock, gin.Default())
+			w := sendRequest(tt.method, tt.url, bytes.NewReader(tt.data), wb, "jamesj", secret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.OrganizationRoleHandlers() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
 func createAndSetJWTSecret(t *testing.T) string {
 	secret, err := crypt.CreateSecret(32)
 	if err != nil {
@@ -331,3 +378,93 @@ func createAndSetJWTSecret(t *testing.T) string {
 	viper.Set(keys.JwtSecret, secret)
 	return secret
 }
+
+func TestService_OrganizationCABundleHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		username    string
+		permissions int
+		want        int
+		wantErr     string
+	}{
+		{"valid", "/v1/organizations/abc/ca", "jamesj", 200, http.StatusOK, ""},
+		{"invalid-org", "/v1/organizations/invalid/ca", "jamesj", 200, http.StatusBadRequest, "OrgCA"},
+		{"invalid-permissions", "/v1/organizations/abc/ca", "jamesj", 0, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+
+			orgID := path.Base(path.Dir(tt.url))
+			if tt.wantErr == "" {
+				manageMock.On("OrganizationCABundle", orgID, tt.username, tt.permissions).Return([]byte("-----BEGIN CERTIFICATE-----\n"), nil)
+			} else {
+				manageMock.On("OrganizationCABundle", orgID, tt.username, tt.permissions).Return(nil, errors.New("some error text, doesn't matter"))
+			}
+
+			w := sendRequest("GET", tt.url, nil, wb, tt.username, viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			if tt.wantErr == "" {
+				if w.Header().Get("Content-Type") != PEMHeader {
+					t.Errorf("Web.OrganizationCABundleHandler() content type = %v, want %v", w.Header().Get("Content-Type"), PEMHeader)
+				}
+				return
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.OrganizationCABundleHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_OrganizationCARotateHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		permissions int
+		data        []byte
+		manageErr   error
+		want        int
+		wantErr     string
+	}{
+		{"valid", "/v1/organizations/abc/ca/rotate", 300, []byte(`{"overlap":"24h"}`), nil, http.StatusOK, ""},
+		{"valid-empty", "/v1/organizations/abc/ca/rotate", 300, []byte(``), nil, http.StatusOK, ""},
+		{"invalid-permissions", "/v1/organizations/abc/ca/rotate", 200, []byte(`{}`), nil, http.StatusUnauthorized, "UserAuth"},
+		{"invalid-data", "/v1/organizations/abc/ca/rotate", 300, []byte(`\u1000`), nil, http.StatusBadRequest, "OrgCARotate"},
+		{"invalid-rotate", "/v1/organizations/abc/ca/rotate", 300, []byte(`{"overlap":"soon"}`), errors.New("invalid overlap"), http.StatusBadRequest, "OrgCARotate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("OrganizationCARotate", "abc", "jamesj", mock.Anything).Return(tt.manageErr)
+
+			w := sendRequest("POST", tt.url, bytes.NewReader(tt.data), wb, "jamesj", viper.GetString(keys.JwtSecret), tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.OrganizationCARotateHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
@@ -23,9 +23,11 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 
 	"github.com/everactive/dmscore/iot-identity/service"
 	"github.com/everactive/dmscore/iot-management/datastore"
@@ -33,6 +35,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// defaultExpiringDays is the window used by the certificate expiry report when no days are given
+const defaultExpiringDays = 30
+
 // RegDeviceList is the API method to list the registered devices
 func (wb Service) RegDeviceList(c *gin.Context) {
 	w := c.Writer
@@ -134,6 +139,63 @@ func (wb Service) RegDeviceUpdate(c *gin.Context) {
 	_ = encodeResponse(response, w)
 }
 
+// RegDeviceRevoke is the API method to revoke the certificate of a registered device
+func (wb Service) RegDeviceRevoke(c *gin.Context) {
+	w := c.Writer
+	r := c.Request
+	w.Header().Set("Content-Type", JSONHeader)
+
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Admin)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+	defer func(Body io.ReadCloser) {
+		errInt := Body.Close()
+		if errInt != nil {
+			log.Error(errInt)
+		}
+	}(r.Body)
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		formatStandardResponse("RegDevice", "error reading the request", c)
+		return
+	}
+
+	response := wb.Manage.RegDeviceRevoke(c.Param("orgid"), user.Username, user.Role, c.Param("device"), b)
+	if len(response.Code) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_ = encodeResponse(response, w)
+}
+
+// RegDeviceExpiring is the API method to list the registered devices with a certificate expiring within ?days=
+func (wb Service) RegDeviceExpiring(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	days := defaultExpiringDays
+	if d := c.Query("days"); d != "" {
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 0 {
+			formatStandardResponse("RegDeviceExpiring", "days must be a non-negative number", c)
+			return
+		}
+	}
+
+	response := wb.Manage.RegDeviceExpiring(c.Param("orgid"), user.Username, user.Role, days)
+	if len(response.Code) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_ = encodeResponse(response, w)
+}
+
 // RegisterDevice registers a new device with the Identity service
 func (wb Service) RegisterDevice(c *gin.Context) {
 	w := c.Writer
@@ -178,6 +240,58 @@ func (wb Service) RegisterDevice(c *gin.Context) {
 	_ = encodeResponse(response, w)
 }
 
+// maxRegisterDevicesBytes bounds a bulk registration upload
+const maxRegisterDevicesBytes = 16 * 1024 * 1024
+
+// RegisterDevices registers devices in bulk with the Identity service, from a CSV or JSON lines upload. The format
+// is the format query parameter, or is taken from the content type. The devices are registered in a transaction,
+// unless the mode query parameter is best-effort. A large upload is registered by a job, with a 202 response.
+func (wb Service) RegisterDevices(c *gin.Context) {
+	w := c.Writer
+	w.Header().Set("Content-Type", JSONHeader)
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Admin)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	var bestEffort bool
+	switch c.Query("mode") {
+	case "", "transaction":
+	case "best-effort":
+		bestEffort = true
+	default:
+		formatStandardResponse("RegDevices", "mode must be transaction or best-effort", c)
+		return
+	}
+
+	format := c.Query("format")
+	if len(format) == 0 {
+		format = service.RegistrationFormatJSONLines
+		if c.ContentType() == "text/csv" {
+			format = service.RegistrationFormatCSV
+		}
+	}
+
+	b, err := io.ReadAll(io.LimitReader(c.Request.Body, maxRegisterDevicesBytes+1))
+	if err != nil {
+		formatStandardResponse("RegDevices", "error reading the request", c)
+		return
+	}
+	if len(b) > maxRegisterDevicesBytes {
+		formatStandardResponse("RegDevices", fmt.Sprintf("the upload is larger than %d bytes", maxRegisterDevicesBytes), c)
+		return
+	}
+
+	response := wb.Manage.RegisterDevices(c.Param("orgid"), user.Username, user.Role, format, bestEffort, b)
+	if len(response.Code) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	} else if response.JobID > 0 {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	_ = encodeResponse(response, w)
+}
+
 func decodeDeviceRequest(body []byte) (*service.RegisterDeviceRequest, error) {
 	// Decode the JSON body
 	dev := service.RegisterDeviceRequest{}
@@ -210,6 +210,92 @@ func TestService_RegDeviceUpdate(t *testing.T) {
 	}
 }
 
+func TestService_RegDeviceRevoke(t *testing.T) {
+	d1 := []byte(`{"reason":1}`)
+	tests := []struct {
+		name        string
+		orgID       string
+		deviceID    string
+		url         string
+		data        []byte
+		username    string
+		permissions int
+		want        int
+		wantErr     string
+	}{
+		{"valid", "abc", "a111", "/v1/%s/register/devices/%s/revoke", d1, "jamesj", 300, http.StatusOK, ""},
+		{"invalid-device", "abc", "invalid", "/v1/%s/register/devices/%s/revoke", d1, "jamesj", 300, http.StatusBadRequest, "RegDeviceRevoke"},
+		{"invalid-permissions", "abc", "a111", "/v1/%s/register/devices/%s/revoke", d1, "jamesj", 100, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			jwtSecret := createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+
+			response := web.StandardResponse{Code: tt.wantErr}
+			manageMock.On("RegDeviceRevoke", tt.orgID, tt.username, tt.permissions, tt.deviceID, tt.data).Return(response)
+
+			w := sendRequest("POST", fmt.Sprintf(tt.url, tt.orgID, tt.deviceID), bytes.NewReader(tt.data), wb, tt.username, jwtSecret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.RegDeviceRevoke() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_RegDeviceExpiring(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		days        int
+		username    string
+		permissions int
+		want        int
+		wantErr     string
+	}{
+		{"valid", "/v1/abc/register/devices/expiring?days=7", 7, "jamesj", 200, http.StatusOK, ""},
+		{"valid-default", "/v1/abc/register/devices/expiring", 30, "jamesj", 200, http.StatusOK, ""},
+		{"invalid-days", "/v1/abc/register/devices/expiring?days=soon", 0, "jamesj", 200, http.StatusBadRequest, "RegDeviceExpiring"},
+		{"invalid-org", "/v1/abc/register/devices/expiring", 30, "jamesj", 200, http.StatusBadRequest, "RegDevicesAuth"},
+		{"invalid-permissions", "/v1/abc/register/devices/expiring", 30, "jamesj", 0, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwtSecret := createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+
+			response := web.DevicesResponse{StandardResponse: web.StandardResponse{Code: tt.wantErr}}
+			manageMock.On("RegDeviceExpiring", "abc", tt.username, tt.permissions, tt.days).Return(response)
+
+			w := sendRequest("GET", tt.url, nil, wb, tt.username, jwtSecret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.RegDeviceExpiring() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestService_RegDeviceGetDownload(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -245,3 +331,66 @@ func TestService_RegDeviceGetDownload(t *testing.T) {
 		})
 	}
 }
+
+func TestService_RegisterDevices(t *testing.T) {
+	data := []byte("brand,model,serial\nexample,drone-1000,DR1000A1\n")
+	tests := []struct {
+		name        string
+		url         string
+		format      string
+		bestEffort  bool
+		permissions int
+		manageCode  string
+		jobID       int64
+		want        int
+		wantErr     string
+	}{
+		{"valid", "/v1/abc/register/devices/bulk?format=csv", "csv", false, 300, "", 0, http.StatusOK, ""},
+		{"valid-best-effort", "/v1/abc/register/devices/bulk?mode=best-effort", "jsonl", true, 300, "", 0, http.StatusOK, ""},
+		{"valid-job", "/v1/abc/register/devices/bulk?format=csv", "csv", false, 300, "", 5, http.StatusAccepted, ""},
+		{"invalid-mode", "/v1/abc/register/devices/bulk?mode=all", "jsonl", false, 300, "", 0, http.StatusBadRequest, "RegDevices"},
+		{"invalid-devices", "/v1/abc/register/devices/bulk?format=csv", "csv", false, 300, "RegDevices", 0, http.StatusBadRequest, "RegDevices"},
+		{"invalid-permissions", "/v1/abc/register/devices/bulk", "jsonl", false, 0, "", 0, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwtSecret := createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			wb := NewService(manageMock, gin.Default())
+			manageMock.On("RegisterDevices", "abc", "jamesj", tt.permissions, tt.format, tt.bestEffort, data).Return(web.RegisterDevicesResponse{
+				StandardResponse: web.StandardResponse{Code: tt.manageCode},
+				JobID:            tt.jobID,
+			})
+
+			w := sendRequest("POST", tt.url, bytes.NewReader(data), wb, "jamesj", jwtSecret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.RegisterDevices() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_RegisterDevicesTooLarge(t *testing.T) {
+	jwtSecret := createAndSetJWTSecret(t)
+	manageMock := &manage.MockManage{}
+	wb := NewService(manageMock, gin.Default())
+
+	data := bytes.Repeat([]byte("example,drone-1000,DR1000A1\n"), maxRegisterDevicesBytes/20)
+	w := sendRequest("POST", "/v1/abc/register/devices/bulk?format=csv", bytes.NewReader(data), wb, "jamesj", jwtSecret, 300)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected HTTP status '%d', got: %v", http.StatusBadRequest, w.Code)
+	}
+	resp, err := parseStandardResponse(w.Body)
+	if err != nil || resp.Code != "RegDevices" {
+		t.Errorf("Web.RegisterDevices() got = %v, want RegDevices: %v", resp.Code, err)
+	}
+}
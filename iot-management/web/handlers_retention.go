@@ -0,0 +1,52 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"net/http"
+
+	"github.com/everactive/dmscore/iot-devicetwin/web"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// RetentionReportResponse defines the response to report the data the retention service would purge
+type RetentionReportResponse struct {
+	web.StandardResponse
+	Report domain.RetentionReport `json:"report"`
+}
+
+// RetentionReportHandler is the API method to report the data that the retention service would purge now,
+// without purging it
+func (wb Service) RetentionReportHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	report, err := wb.Manage.RetentionReport()
+	if err != nil {
+		formatStandardResponse("RetentionReport", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, RetentionReportResponse{Report: report})
+}
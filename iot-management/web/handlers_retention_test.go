@@ -0,0 +1,66 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/everactive/dmscore/iot-management/service/manage"
+	"github.com/gin-gonic/gin"
+)
+
+func TestService_RetentionReportHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int
+		err         error
+		want        int
+		wantErr     string
+	}{
+		{"valid", 300, nil, http.StatusOK, ""},
+		{"invalid-report", 300, errors.New("MOCK error"), http.StatusBadRequest, "RetentionReport"},
+		{"invalid-permissions", 200, nil, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := createAndSetJWTSecret(t)
+
+			manageMock := &manage.MockManage{}
+			manageMock.On("RetentionReport").Return(domain.RetentionReport{DryRun: true, Actions: 2}, tt.err)
+
+			wb := NewService(manageMock, gin.Default())
+			w := sendRequest("GET", "/v1/retention/report", nil, wb, "jamesj", secret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.RetentionReportHandler() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
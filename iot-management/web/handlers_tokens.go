@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/everactive/dmscore/iot-devicetwin/web"
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// APITokensResponse defines the response to list API tokens
+type APITokensResponse struct {
+	web.StandardResponse
+	Tokens []domain.APIToken `json:"tokens"`
+}
+
+// APITokenCreateResponse defines the response to create an API token, the only one that holds the token itself
+type APITokenCreateResponse struct {
+	web.StandardResponse
+	Token  domain.APIToken `json:"token"`
+	Secret string          `json:"secret"`
+}
+
+// APITokenListHandler is the API method to list the API tokens of the user, or all of them for superusers
+func (wb Service) APITokenListHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	tokens, err := wb.Manage.APITokenList(user.Username, user.Role)
+	if err != nil {
+		formatStandardResponse("TokenList", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, APITokensResponse{Tokens: tokens})
+}
+
+// APITokenCreateHandler is the API method to create a personal or service API token
+func (wb Service) APITokenCreateHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	req := domain.APITokenRequest{}
+	err = json.NewDecoder(c.Request.Body).Decode(&req)
+	switch {
+	// Check we have some data
+	case err == io.EOF:
+		formatStandardResponse("TokenCreate", "No API token data supplied", c)
+		return
+		// Check for parsing errors
+	case err != nil:
+		formatStandardResponse("TokenCreate", err.Error(), c)
+		return
+	}
+
+	token, secret, err := wb.Manage.APITokenCreate(user.Username, user.Role, req)
+	if err != nil {
+		formatStandardResponse("TokenCreate", err.Error(), c)
+		return
+	}
+	c.JSON(http.StatusOK, APITokenCreateResponse{Token: token, Secret: secret})
+}
+
+// APITokenRevokeHandler is the API method to revoke an API token
+func (wb Service) APITokenRevokeHandler(c *gin.Context) {
+	user, err := getUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		formatStandardResponse("UserAuth", "", c)
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		formatStandardResponse("TokenRevoke", fmt.Sprintf("invalid API token ID: %s", c.Param("id")), c)
+		return
+	}
+
+	if err = wb.Manage.APITokenRevoke(user.Username, user.Role, id); err != nil {
+		formatStandardResponse("TokenRevoke", err.Error(), c)
+		return
+	}
+	formatStandardResponse("", "", c)
+}
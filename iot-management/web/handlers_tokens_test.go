@@ -0,0 +1,124 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * This file is part of the IoT Management Service
+ * Copyright 2019 Canonical Ltd.
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * under the terms of the GNU Affero General Public License version 3, as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful, but WITHOUT
+ * ANY WARRANTY; without even the implied warranties of MERCHANTABILITY,
+ * SATISFACTORY QUALITY, or FITNESS FOR A PARTICULAR PURPOSE.
+ * See the GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/iot-management/domain"
+	"github.com/everactive/dmscore/iot-management/service/manage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_APITokenHandlers(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		data        []byte
+		permissions int
+		err         error
+		want        int
+		wantErr     string
+	}{
+		{"valid-list", "GET", "/v1/tokens", nil, 100, nil, http.StatusOK, ""},
+		{"valid-create", "POST", "/v1/tokens", []byte(`{"name":"ci","organizations":[{"orgid":"abc","role":"viewer"}]}`), 100, nil, http.StatusOK, ""},
+		{"valid-revoke", "DELETE", "/v1/tokens/1", nil, 100, nil, http.StatusOK, ""},
+		{"invalid-list", "GET", "/v1/tokens", nil, 100, errors.New("MOCK error"), http.StatusBadRequest, "TokenList"},
+		{"invalid-create", "POST", "/v1/tokens", []byte(`{"name":"ci"}`), 100, manage.NotAuthorizedErr, http.StatusBadRequest, "TokenCreate"},
+		{"invalid-create-empty", "POST", "/v1/tokens", nil, 100, nil, http.StatusBadRequest, "TokenCreate"},
+		{"invalid-create-data", "POST", "/v1/tokens", []byte(`\u1000`), 100, nil, http.StatusBadRequest, "TokenCreate"},
+		{"invalid-revoke", "DELETE", "/v1/tokens/1", nil, 100, errors.New("MOCK error"), http.StatusBadRequest, "TokenRevoke"},
+		{"invalid-revoke-id", "DELETE", "/v1/tokens/one", nil, 100, nil, http.StatusBadRequest, "TokenRevoke"},
+		{"invalid-permissions", "GET", "/v1/tokens", nil, 0, nil, http.StatusUnauthorized, "UserAuth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := createAndSetJWTSecret(t)
+
+			token := domain.APIToken{ID: 1, Name: "ci", Kind: "personal", Owner: "jamesj", Prefix: "dms_0123456789ab"}
+			manageMock := &manage.MockManage{}
+			manageMock.On("APITokenList", "jamesj", tt.permissions).Return([]domain.APIToken{token}, tt.err)
+			manageMock.On("APITokenCreate", "jamesj", tt.permissions, mock.Anything).Return(token, "dms_0123456789abcdef", tt.err)
+			manageMock.On("APITokenRevoke", "jamesj", tt.permissions, int64(1)).Return(tt.err)
+
+			wb := NewService(manageMock, gin.Default())
+			w := sendRequest(tt.method, tt.url, bytes.NewReader(tt.data), wb, "jamesj", secret, tt.permissions)
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+
+			resp, err := parseStandardResponse(w.Body)
+			if err != nil {
+				t.Errorf("Error parsing response: %v", err)
+			}
+			if resp.Code != tt.wantErr {
+				t.Errorf("Web.APITokenHandlers() got = %v, want %v", resp.Code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestService_APITokenAuth(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		role          int
+		err           error
+		want          int
+	}{
+		{"valid", "Bearer dms_valid", datastore.Standard, nil, http.StatusOK},
+		{"invalid-role", "Bearer dms_valid", datastore.Standard, nil, http.StatusUnauthorized},
+		{"invalid-token", "Bearer dms_invalid", 0, manage.ErrInvalidAPIToken, http.StatusUnauthorized},
+		{"invalid-header", "dms_valid", datastore.Standard, nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manageMock := &manage.MockManage{}
+			manageMock.On("APITokenVerify", "dms_valid").Return(domain.User{Username: "token:0123456789ab", Role: tt.role}, nil)
+			manageMock.On("APITokenVerify", "dms_invalid").Return(domain.User{}, tt.err)
+			manageMock.On("APITokenList", "token:0123456789ab", tt.role).Return([]domain.APIToken{}, nil)
+			manageMock.On("RetentionReport").Return(domain.RetentionReport{}, nil)
+
+			// The retention report needs a superuser, the token list a standard user
+			url := "/v1/tokens"
+			if tt.name == "invalid-role" {
+				url = "/v1/retention/report"
+			}
+
+			wb := NewService(manageMock, gin.Default())
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", url, nil)
+			req.Header.Set("Auth-Type", APITokenAuthType)
+			req.Header.Set("Authorization", tt.authorization)
+			wb.engine.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected HTTP status '%d', got: %v", tt.want, w.Code)
+			}
+		})
+	}
+}
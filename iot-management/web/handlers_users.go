@@ -89,8 +89,8 @@ func (wb Service) UserCreateHandler(c *gin.Context) {
 	w := c.Writer
 	r := c.Request
 	w.Header().Set("Content-Type", JSONHeader)
-	_, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
-	if err != nil {
+	authUser, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if authUser == nil || err != nil {
 		formatStandardResponse("UserAuth", "", c)
 		return
 	}
@@ -109,7 +109,7 @@ func (wb Service) UserCreateHandler(c *gin.Context) {
 	}
 
 	// Create the user
-	err = wb.Manage.CreateUser(user)
+	err = wb.Manage.CreateUser(authUser.Username, user)
 	if err != nil {
 		formatStandardResponseWithStatusCode("UserAuth", err.Error(), http.StatusBadRequest, c)
 		return
@@ -124,8 +124,8 @@ func (wb Service) UserUpdateHandler(c *gin.Context) {
 	w := c.Writer
 	r := c.Request
 	w.Header().Set("Content-Type", JSONHeader)
-	_, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
-	if err != nil {
+	authUser, err := getUserFromContextAndCheckPermissions(c, datastore.Superuser)
+	if authUser == nil || err != nil {
 		formatStandardResponse("UserAuth", "", c)
 		return
 	}
@@ -143,7 +143,7 @@ func (wb Service) UserUpdateHandler(c *gin.Context) {
 	}
 
 	// Create the user
-	err = wb.Manage.UserUpdate(user)
+	err = wb.Manage.UserUpdate(authUser.Username, user)
 	if err != nil {
 		formatStandardResponse("UserUpdate", err.Error(), c)
 		return
@@ -162,7 +162,7 @@ func (wb Service) UserDeleteHandler(c *gin.Context) {
 		formatStandardResponse("UserAuth", "", c)
 		return
 	}
-	if err := wb.Manage.UserDelete(c.Param("username")); err != nil {
+	if err := wb.Manage.UserDelete(user.Username, c.Param("username")); err != nil {
 		formatStandardResponse("UserDelete", err.Error(), c)
 		return
 	}
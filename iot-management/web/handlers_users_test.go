@@ -103,9 +103,9 @@ func TestService_UserCreateHandler(t *testing.T) {
 			manageMock := &manage.MockManage{}
 			wb := NewService(manageMock, gin.Default())
 			if tt.wantErr == "" {
-				manageMock.On("CreateUser", mock.Anything).Return(nil)
+				manageMock.On("CreateUser", username, mock.Anything).Return(nil)
 			} else {
-				manageMock.On("CreateUser", mock.Anything).Return(errors.New("some error text"))
+				manageMock.On("CreateUser", username, mock.Anything).Return(errors.New("some error text"))
 			}
 
 			w := sendRequest("POST", tt.url, bytes.NewReader(tt.data), wb, username, jwtSecret, tt.permissions)
@@ -204,9 +204,9 @@ func TestService_UserUpdateHandler(t *testing.T) {
 
 			_, username := path.Split(tt.url)
 			if tt.wantErr == "" {
-				manageMock.On("UserUpdate", user).Return(nil)
+				manageMock.On("UserUpdate", username, user).Return(nil)
 			} else {
-				manageMock.On("UserUpdate", user).Return(errors.New("some error text"))
+				manageMock.On("UserUpdate", username, user).Return(errors.New("some error text"))
 			}
 
 			w := sendRequestWithBeforeServeHook("PUT", tt.url, bytes.NewReader(tt.data), wb, func(request *http.Request) error {
@@ -265,7 +265,7 @@ func TestService_UserDeleteHandler(t *testing.T) {
 			if tt.wantErr != "" {
 				returnErr = errors.New("some error text")
 			}
-			manageMock.On("UserDelete", username).Return(returnErr)
+			manageMock.On("UserDelete", mock.Anything, username).Return(returnErr)
 
 			w := sendRequestWithBeforeServeHook("DELETE", tt.url, nil, wb, setupServeWithUser(user, jwtSecret))
 			if w.Code != tt.want {
@@ -56,6 +56,34 @@ func (wb Service) addAPI(apiRouter *gin.RouterGroup) {
 	apiRouter.GET("/organizations/:id", wb.OrganizationGetHandler)
 	apiRouter.PUT("/organizations/:id", wb.OrganizationUpdateHandler)
 	apiRouter.POST("/organizations", wb.OrganizationCreateHandler)
+	apiRouter.GET("/organizations/:id/ca", wb.OrganizationCABundleHandler)
+	apiRouter.POST("/organizations/:id/ca/rotate", wb.OrganizationCARotateHandler)
+	apiRouter.GET("/organizations/:id/roles", wb.OrganizationRoleListHandler)
+	apiRouter.PUT("/organizations/:id/roles/:username", wb.OrganizationRoleSetHandler)
+	apiRouter.DELETE("/organizations/:id/roles/:username", wb.OrganizationRoleDeleteHandler)
+
+	apiRouter.GET("/tokens", wb.APITokenListHandler)
+	apiRouter.POST("/tokens", wb.APITokenCreateHandler)
+	apiRouter.DELETE("/tokens/:id", wb.APITokenRevokeHandler)
+
+	apiRouter.GET("/account-keys", wb.AccountKeyListHandler)
+	apiRouter.POST("/account-keys", wb.AccountKeyAddHandler)
+	apiRouter.POST("/account-keys/refresh", wb.AccountKeysRefreshHandler)
+	apiRouter.DELETE("/account-keys/:id", wb.AccountKeyDeleteHandler)
+
+	apiRouter.GET("/auto-registration/rules", wb.AutoRegistrationRuleListHandler)
+	apiRouter.POST("/auto-registration/rules", wb.AutoRegistrationRuleCreateHandler)
+	apiRouter.PUT("/auto-registration/rules/:id", wb.AutoRegistrationRuleUpdateHandler)
+	apiRouter.DELETE("/auto-registration/rules/:id", wb.AutoRegistrationRuleDeleteHandler)
+	apiRouter.POST("/auto-registration/evaluate", wb.AutoRegistrationEvaluateHandler)
+
+	apiRouter.GET("/enrollment-requests", wb.EnrollmentRequestListHandler)
+	apiRouter.POST("/enrollment-requests/:id/approve", wb.EnrollmentRequestApproveHandler)
+	apiRouter.POST("/enrollment-requests/:id/reject", wb.EnrollmentRequestRejectHandler)
+
+	apiRouter.GET("/retention/report", wb.RetentionReportHandler)
+
+	apiRouter.GET("/audit", wb.AuditListHandler)
 
 	// API routes: users
 	apiRouter.GET("/users", wb.UserListHandler)
@@ -69,18 +97,31 @@ func (wb Service) addAPI(apiRouter *gin.RouterGroup) {
 	//// API routes: registered devices
 	apiRouter.GET("/:orgid/register/devices", wb.RegDeviceList)
 	apiRouter.POST("/:orgid/register/devices", wb.RegisterDevice)
+	apiRouter.POST("/:orgid/register/devices/bulk", wb.RegisterDevices)
+	apiRouter.GET("/:orgid/register/devices/expiring", wb.RegDeviceExpiring)
 	apiRouter.GET("/:orgid/register/devices/:device", wb.RegDeviceGet)
 	apiRouter.PUT("/:orgid/register/devices/:device", wb.RegDeviceUpdate)
 	apiRouter.GET("/:orgid/register/devices/:device/download", wb.RegDeviceGetDownload)
+	apiRouter.POST("/:orgid/register/devices/:device/revoke", wb.RegDeviceRevoke)
 
 	//// API routes: devices
 	apiRouter.GET("/:orgid/devices", wb.DevicesListHandler)
+	apiRouter.GET("/:orgid/devices/deleted", wb.DeviceDeletedListHandler)
 	apiRouter.GET("/:orgid/devices/:deviceid", wb.DeviceGetHandler)
 	apiRouter.GET("/:orgid/devices/:deviceid/actions", wb.ActionListHandler)
 	apiRouter.DELETE("/:orgid/devices/:deviceid", wb.DeviceDeleteHandler)
+	apiRouter.POST("/:orgid/devices/:deviceid/transfer", wb.DeviceTransferHandler)
+	apiRouter.GET("/:orgid/devices/:deviceid/transfers", wb.DeviceTransferListHandler)
+	apiRouter.POST("/:orgid/devices/:deviceid/replace", wb.DeviceReplaceHandler)
+	apiRouter.POST("/:orgid/devices/:deviceid/restore", wb.DeviceRestoreHandler)
 	apiRouter.POST("/:orgid/devices/:deviceid/logs", wb.DeviceLogsHandler)
 	apiRouter.POST("/:orgid/devices/:deviceid/users", wb.DeviceUsersActionHandler)
 
+	//// API routes: jobs
+	apiRouter.GET("/:orgid/jobs", wb.JobListHandler)
+	apiRouter.GET("/:orgid/jobs/:jobid", wb.JobGetHandler)
+	apiRouter.POST("/:orgid/jobs/:jobid/resume", wb.JobResumeHandler)
+
 	//// API routes: snap functionality
 	apiRouter.GET("/device/:orgid/:deviceid/snaps", wb.SnapListHandler)
 
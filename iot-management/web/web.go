@@ -37,6 +37,9 @@ var ssoServer UbuntuSingleSignOnServer
 // JSONHeader is the content-type header for JSON responses
 const JSONHeader = "application/json; charset=UTF-8"
 
+// PEMHeader is the content-type header for PEM encoded certificate responses
+const PEMHeader = "application/x-pem-file"
+
 // Service is the implementation of the web API
 type Service struct {
 	Manage manage.Manage
@@ -17,11 +17,77 @@ type DeviceModelRequiredSnap struct {
 	Name          string `gorm:"uniqueIndex"`
 }
 
+// HealthHash holds the snap hashes of the device twin next to the ones last reported by the device in its
+// health message. The hashes are computed from the twin's snaps the way HashVersion says, except the SnapListHash
+// of the legacy version, which is from the last snap list received. A device is drifted when either differs from
+// what it reports.
 type HealthHash struct {
 	gorm.Model
-	LastRefresh        time.Time
-	OrgID              string
-	DeviceID           string
-	SnapListHash       string
-	InstalledSnapsHash string
+	LastRefresh                time.Time
+	OrgID                      string
+	DeviceID                   string
+	SnapListHash               string
+	InstalledSnapsHash         string
+	ReportedSnapListHash       string
+	ReportedInstalledSnapsHash string
+	Drifted                    bool
+	HashVersion                int
+}
+
+// Job is a multi-step operation on a device, with the JSON encoded request that started it
+type Job struct {
+	gorm.Model
+	Kind       string
+	OrgID      string
+	DeviceID   string
+	Username   string
+	Status     string
+	Parameters string
+	Steps      []JobStep
+}
+
+// JobStep is a step of a job with its progress
+type JobStep struct {
+	gorm.Model
+	JobID      uint
+	Position   int
+	Name       string
+	Status     string
+	Message    string
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	Attempts   int
+	RetryAt    *time.Time
+}
+
+// APIToken is a personal or service API token. Only the hash of the token is stored, the prefix identifies it.
+// The token acts as its own user, Username, with the role and the JSON encoded organization roles it is scoped to.
+type APIToken struct {
+	gorm.Model
+	Name          string
+	Kind          string
+	Owner         string
+	Username      string
+	Prefix        string
+	TokenHash     string
+	Role          int
+	Organizations string
+	ExpiresAt     *time.Time
+	LastUsedAt    *time.Time
+	RevokedAt     *time.Time
+}
+
+// AuditEntry is an entry of the append-only audit log, so it has no update or delete timestamps
+type AuditEntry struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	Username   string
+	OrgID      string
+	TargetType string
+	Target     string
+	Action     string
+	Payload    string
+	Result     string
+	Message    string
+	ActionID   string
 }
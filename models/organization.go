@@ -16,6 +16,7 @@ type OrganizationUser struct {
 	ID       uint `gorm:"primarykey"`
 	OrgID    string
 	UserName string `gorm:"column:username"`
+	Role     string
 }
 
 func (OrganizationUser) TableName() string {
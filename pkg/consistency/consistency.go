@@ -0,0 +1,247 @@
+// Package consistency checks that the organization and device data of the identity, device twin and management
+// data stores agree, and repairs the inconsistencies that can be repaired
+package consistency
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	twindatastore "github.com/everactive/dmscore/iot-devicetwin/datastore"
+	identitydatastore "github.com/everactive/dmscore/iot-identity/datastore"
+	"github.com/everactive/dmscore/iot-identity/domain"
+	"github.com/everactive/dmscore/iot-identity/models"
+	managementdatastore "github.com/everactive/dmscore/iot-management/datastore"
+	"github.com/everactive/dmscore/pkg/datastores"
+)
+
+// Kinds of inconsistencies
+const (
+	KindOrganizationNotInManagement = "organization-not-in-management"
+	KindOrganizationNotInIdentity   = "organization-not-in-identity"
+	KindOrganizationName            = "organization-name"
+	KindTwinWithoutRegistration     = "twin-without-registration"
+	KindOrganizationMismatch        = "organization-mismatch"
+	KindEnrolledWithoutTwin         = "enrolled-without-twin"
+	KindGroupLinkOrphaned           = "group-link-orphaned"
+)
+
+// Finding is an inconsistency between the data stores. A repairable finding is fixed when the check repairs it,
+// or has the error of the repair.
+type Finding struct {
+	Kind           string `json:"kind"`
+	OrganizationID string `json:"orgId"`
+	DeviceID       string `json:"deviceId,omitempty"`
+	Message        string `json:"message"`
+	Repairable     bool   `json:"repairable"`
+	Fixed          bool   `json:"fixed"`
+	Error          string `json:"error,omitempty"`
+}
+
+// Checker compares the data stores. The identity data store is the reference for the organizations and the
+// devices, as it issues their credentials.
+type Checker struct {
+	Identity   identitydatastore.DataStore
+	DeviceTwin twindatastore.DataStore
+	Management managementdatastore.DataStore
+}
+
+// NewChecker creates a checker of the data stores
+func NewChecker(dss *datastores.DataStores) *Checker {
+	return &Checker{
+		Identity:   dss.IdentityStore,
+		DeviceTwin: dss.DeviceTwinStore,
+		Management: dss.ManagementStore,
+	}
+}
+
+// Check finds the inconsistencies between the data stores. With fix, the repairable ones are repaired:
+//   - an organization missing from the management data store is created, and a different name is updated
+//   - a device twin without a registration, or with a deleted one, is soft deleted
+//   - a device twin in another organization than its registration is moved to the organization of the registration
+//   - a group link to a deleted, missing or moved device twin is deleted
+//
+// An organization missing from the identity data store and an enrolled device without a device twin are only
+// reported.
+func (c *Checker) Check(fix bool) ([]Finding, error) {
+	orgs, err := c.Identity.OrganizationList()
+	if err != nil {
+		return nil, fmt.Errorf("error listing the organizations: %w", err)
+	}
+
+	findings, err := c.checkOrganizations(orgs, fix)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceFindings, err := c.checkDevices(orgs, fix)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, deviceFindings...)
+
+	// The group links are checked last, as moving a device twin removes its group links
+	linkFindings, err := c.checkGroupLinks(fix)
+	if err != nil {
+		return nil, err
+	}
+	return append(findings, linkFindings...), nil
+}
+
+func (c *Checker) checkOrganizations(orgs []domain.Organization, fix bool) ([]Finding, error) {
+	mgOrgs, err := c.Management.OrganizationList()
+	if err != nil {
+		return nil, fmt.Errorf("error listing the management organizations: %w", err)
+	}
+	mgNames := map[string]string{}
+	for _, o := range mgOrgs {
+		mgNames[o.OrganizationID] = o.Name
+	}
+
+	findings := []Finding{}
+	idOrgs := map[string]bool{}
+	for _, o := range orgs {
+		idOrgs[o.ID] = true
+		org := managementdatastore.Organization{OrganizationID: o.ID, Name: o.Name}
+
+		name, ok := mgNames[o.ID]
+		switch {
+		case !ok:
+			f := Finding{Kind: KindOrganizationNotInManagement, OrganizationID: o.ID,
+				Message: fmt.Sprintf("the organization `%s` is not in the management data store", o.Name)}
+			repair(&f, fix, func() error { return c.Management.OrganizationCreate(org) })
+			findings = append(findings, f)
+		case name != o.Name:
+			f := Finding{Kind: KindOrganizationName, OrganizationID: o.ID,
+				Message: fmt.Sprintf("the organization is named `%s` in the management data store and `%s` in the identity data store", name, o.Name)}
+			repair(&f, fix, func() error { return c.Management.OrganizationUpdate(org) })
+			findings = append(findings, f)
+		}
+	}
+
+	for _, o := range mgOrgs {
+		if !idOrgs[o.OrganizationID] {
+			findings = append(findings, Finding{Kind: KindOrganizationNotInIdentity, OrganizationID: o.OrganizationID,
+				Message: fmt.Sprintf("the organization `%s` is not in the identity data store", o.Name)})
+		}
+	}
+	return findings, nil
+}
+
+func (c *Checker) checkDevices(orgs []domain.Organization, fix bool) ([]Finding, error) {
+	summaries, err := c.Identity.DeviceSummaryList()
+	if err != nil {
+		return nil, fmt.Errorf("error listing the devices: %w", err)
+	}
+	idOrgs := map[string]bool{}
+	for _, o := range orgs {
+		idOrgs[o.ID] = true
+	}
+	registrations := map[string]identitydatastore.DeviceSummary{}
+	deleted := map[string]bool{}
+	for _, d := range summaries {
+		switch {
+		case !idOrgs[d.OrganizationID]:
+		case d.Deleted:
+			deleted[d.ID] = true
+		default:
+			registrations[d.ID] = d
+		}
+	}
+
+	twins, err := c.DeviceTwin.DeviceListAll()
+	if err != nil {
+		return nil, fmt.Errorf("error listing the device twins: %w", err)
+	}
+
+	findings := []Finding{}
+	hasTwin := map[string]bool{}
+	for _, t := range twins {
+		deviceID := t.DeviceID
+		hasTwin[deviceID] = true
+
+		reg, ok := registrations[deviceID]
+		if !ok {
+			f := Finding{Kind: KindTwinWithoutRegistration, OrganizationID: t.OrganisationID, DeviceID: deviceID,
+				Message: "the device twin has no registration"}
+			if deleted[deviceID] {
+				f.Message = "the registration of the device twin is deleted"
+			}
+			repair(&f, fix, func() error { return c.deleteTwin(deviceID) })
+			findings = append(findings, f)
+			continue
+		}
+
+		if reg.OrganizationID != t.OrganisationID {
+			orgID := reg.OrganizationID
+			f := Finding{Kind: KindOrganizationMismatch, OrganizationID: orgID, DeviceID: deviceID,
+				Message: fmt.Sprintf("the device twin is in the organization `%s`", t.OrganisationID)}
+			repair(&f, fix, func() error { return c.transferTwin(deviceID, orgID) })
+			findings = append(findings, f)
+		}
+	}
+
+	for _, d := range summaries {
+		if _, ok := registrations[d.ID]; ok && d.Status == models.StatusEnrolled && !hasTwin[d.ID] {
+			findings = append(findings, Finding{Kind: KindEnrolledWithoutTwin, OrganizationID: d.OrganizationID, DeviceID: d.ID,
+				Message: "the device is enrolled but has no device twin"})
+		}
+	}
+	return findings, nil
+}
+
+// deleteTwin soft deletes a device twin without a live registration. The registration is read again, as the
+// device may have been registered since the registrations were listed.
+func (c *Checker) deleteTwin(deviceID string) error {
+	reg, err := c.Identity.DeviceSummaryGet(deviceID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if reg != nil && !reg.Deleted {
+		return fmt.Errorf("the device has been registered since it was checked")
+	}
+	return c.DeviceTwin.DeviceDelete(deviceID)
+}
+
+// transferTwin moves a device twin to the organization of its registration. The registration is read again, as
+// the device may have been transferred since the registrations were listed.
+func (c *Checker) transferTwin(deviceID, orgID string) error {
+	reg, err := c.Identity.DeviceSummaryGet(deviceID)
+	if err != nil {
+		return err
+	}
+	if reg.Deleted || reg.OrganizationID != orgID {
+		return fmt.Errorf("the registration of the device has changed since it was checked")
+	}
+	return c.DeviceTwin.DeviceTransfer(deviceID, orgID)
+}
+
+func (c *Checker) checkGroupLinks(fix bool) ([]Finding, error) {
+	links, err := c.DeviceTwin.GroupLinkListOrphaned()
+	if err != nil {
+		return nil, fmt.Errorf("error listing the orphaned group links: %w", err)
+	}
+
+	findings := []Finding{}
+	for _, l := range links {
+		linkID := l.ID
+		f := Finding{Kind: KindGroupLinkOrphaned, OrganizationID: l.OrganisationID,
+			Message: fmt.Sprintf("the group %d is linked to the deleted, missing or moved device twin %d", l.GroupID, l.DeviceID)}
+		repair(&f, fix, func() error { return c.DeviceTwin.GroupLinkDelete(linkID) })
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// repair marks a finding as repairable, and repairs it with fix
+func repair(f *Finding, fix bool, repairFunc func() error) {
+	f.Repairable = true
+	if !fix {
+		return
+	}
+	if err := repairFunc(); err != nil {
+		f.Error = err.Error()
+		return
+	}
+	f.Fixed = true
+}
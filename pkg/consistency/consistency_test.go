@@ -0,0 +1,125 @@
+package consistency
+
+import (
+	"testing"
+
+	twindatastore "github.com/everactive/dmscore/iot-devicetwin/datastore"
+	twinmemory "github.com/everactive/dmscore/iot-devicetwin/datastore/memory"
+	identitydatastore "github.com/everactive/dmscore/iot-identity/datastore"
+	identitymemory "github.com/everactive/dmscore/iot-identity/datastore/memory"
+	managementdatastore "github.com/everactive/dmscore/iot-management/datastore"
+	managementmemory "github.com/everactive/dmscore/iot-management/datastore/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func newInconsistentChecker(t *testing.T) *Checker {
+	twin := twinmemory.NewStore()
+	_, err := twin.DeviceCreate(twindatastore.Device{OrganisationID: "abc", DeviceID: "d444"})
+	assert.NoError(t, err)
+	assert.NoError(t, twin.DeviceTransfer("c333", "def"))
+	assert.NoError(t, twin.DeviceDelete("b222"))
+	assert.NoError(t, twin.DeviceDelete("a111"))
+
+	mgmt := managementmemory.NewStore()
+	assert.NoError(t, mgmt.OrganizationCreate(managementdatastore.Organization{OrganizationID: "xyz", Name: "Other Inc"}))
+
+	return &Checker{Identity: identitymemory.NewStore(), DeviceTwin: twin, Management: mgmt}
+}
+
+func kinds(findings []Finding) []string {
+	list := []string{}
+	for _, f := range findings {
+		list = append(list, f.Kind+":"+f.DeviceID)
+	}
+	return list
+}
+
+func TestChecker_Check(t *testing.T) {
+	c := newInconsistentChecker(t)
+
+	findings, err := c.Check(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		KindOrganizationName + ":",
+		KindOrganizationNotInIdentity + ":",
+		KindOrganizationMismatch + ":c333",
+		KindTwinWithoutRegistration + ":d444",
+		KindEnrolledWithoutTwin + ":b222",
+		KindGroupLinkOrphaned + ":",
+	}, kinds(findings))
+	for _, f := range findings {
+		assert.False(t, f.Fixed)
+	}
+
+	// Nothing is changed without fix
+	findings, err = c.Check(false)
+	assert.NoError(t, err)
+	assert.Len(t, findings, 6)
+}
+
+func TestChecker_CheckFix(t *testing.T) {
+	c := newInconsistentChecker(t)
+
+	findings, err := c.Check(true)
+	assert.NoError(t, err)
+	for _, f := range findings {
+		assert.Equal(t, f.Repairable, f.Fixed, f.Kind)
+		assert.Empty(t, f.Error)
+	}
+
+	org, err := c.Management.OrganizationGet("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "Example Inc", org.Name)
+
+	device, err := c.DeviceTwin.DeviceGet("c333")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", device.OrganisationID)
+
+	_, err = c.DeviceTwin.DeviceGet("d444")
+	assert.Error(t, err)
+
+	// Only the findings that can't be repaired are left
+	findings, err = c.Check(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		KindOrganizationNotInIdentity + ":",
+		KindEnrolledWithoutTwin + ":b222",
+	}, kinds(findings))
+}
+
+// registeringStore registers a device once the registrations are listed, as if it registered during the check
+type registeringStore struct {
+	*identitymemory.Store
+	device identitydatastore.DeviceNewRequest
+}
+
+func (s *registeringStore) DeviceSummaryList() ([]identitydatastore.DeviceSummary, error) {
+	devices, err := s.Store.DeviceSummaryList()
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.Store.DeviceNew(s.device)
+	return devices, err
+}
+
+func TestChecker_CheckFixRegisteredDuringCheck(t *testing.T) {
+	c := newInconsistentChecker(t)
+	c.Identity = &registeringStore{
+		Store:  identitymemory.NewStore(),
+		device: identitydatastore.DeviceNewRequest{ID: "d444", OrganizationID: "abc", Brand: "example", Model: "drone-1000", SerialNumber: "DR1000D444"},
+	}
+
+	findings, err := c.Check(true)
+	assert.NoError(t, err)
+	assert.Contains(t, kinds(findings), KindTwinWithoutRegistration+":d444")
+	for _, f := range findings {
+		if f.Kind == KindTwinWithoutRegistration {
+			assert.False(t, f.Fixed)
+			assert.Contains(t, f.Error, "registered since it was checked")
+		}
+	}
+
+	// The device twin of the new registration is kept
+	_, err = c.DeviceTwin.DeviceGet("d444")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,50 @@
+package consistency
+
+import (
+	"context"
+	"time"
+
+	"github.com/everactive/dmscore/config/keys"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Service is a supervised service that periodically checks the data stores and logs the inconsistencies. It does
+// not repair them, that is done with `dmscore check --fix`.
+type Service struct {
+	checker *Checker
+}
+
+// NewService creates the service that periodically checks the data stores
+func NewService(checker *Checker) *Service {
+	return &Service{checker: checker}
+}
+
+// Serve checks the data stores every interval until the context is done. A zero interval disables the checks.
+func (s *Service) Serve(ctx context.Context) error {
+	interval := viper.GetDuration(keys.ConsistencyCheckInterval)
+	if interval <= 0 {
+		log.Info("The consistency check is disabled")
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			findings, err := s.checker.Check(false)
+			if err != nil {
+				log.Errorf("Error checking the consistency of the data stores: %v", err)
+				continue
+			}
+			for _, f := range findings {
+				log.Warnf("Inconsistency %s in the organization `%s` for the device `%s`: %s", f.Kind, f.OrganizationID, f.DeviceID, f.Message)
+			}
+			log.Infof("Found %d inconsistencies in the data stores", len(findings))
+		}
+	}
+}
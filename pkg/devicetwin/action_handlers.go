@@ -0,0 +1,201 @@
+package devicetwin
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/actions"
+	twinmessages "github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/models"
+	"github.com/everactive/dmscore/pkg/messages"
+)
+
+// anyAction registers a handler for every unversioned action
+const anyAction = "*"
+
+// actionDecoder decodes an action response payload into the message type for its version
+type actionDecoder func(payload []byte) (interface{}, error)
+
+// actionHandlerFunc processes a decoded action response from a device
+type actionHandlerFunc func(srv *Service, clientID string, msg MQTT.Message, versionedMessage messages.VersionedMessage, decoded interface{}) error
+
+type actionHandler struct {
+	decode actionDecoder
+	handle actionHandlerFunc
+}
+
+type actionHandlerKey struct {
+	action  string
+	version string
+}
+
+// actionHandlers are the handlers of the action responses, by action and message version. An unversioned message is
+// passed straight through to the legacy device twin. The versioned messages are the ones of the actions.Versions
+// registry, a versioned response is only handled in the version its action is sent with.
+var actionHandlers = map[actionHandlerKey]actionHandler{
+	{action: anyAction, version: ""}:      {handle: handleUnversionedAction},
+	{action: actions.Device, version: ""}: {handle: handleUnversionedDevice},
+	{action: actions.List, version: "2"}:  {decode: decodePublishSnapsV2, handle: handlePublishSnapsV2},
+}
+
+// lookupActionHandler finds the handler for an action and version, falling back to one registered for any action
+func lookupActionHandler(action, version string) (actionHandler, error) {
+	if len(version) > 0 && version != actions.Version(action, actions.Versions[action]) {
+		return actionHandler{}, fmt.Errorf("action message type %s is not sent with version %q", action, version)
+	}
+
+	if h, ok := actionHandlers[actionHandlerKey{action: action, version: version}]; ok {
+		return h, nil
+	}
+
+	if h, ok := actionHandlers[actionHandlerKey{action: anyAction, version: version}]; ok {
+		return h, nil
+	}
+
+	return actionHandler{}, fmt.Errorf("no handler for action message type %s with version %q", action, version)
+}
+
+func handleUnversionedAction(srv *Service, clientID string, msg MQTT.Message, versionedMessage messages.VersionedMessage, _ interface{}) error {
+	err := srv.twin.ActionResponse(clientID, versionedMessage.Id, versionedMessage.Action, msg.Payload())
+	if err != nil {
+		return fmt.Errorf("error in ActionResponse: %w", err)
+	}
+	return nil
+}
+
+// handleUnversionedDevice passes the device details to the legacy device twin, which creates the device the first
+// time it hears from it, and then adds a device that auto-registered to the groups chosen by its rule
+func handleUnversionedDevice(srv *Service, clientID string, msg MQTT.Message, versionedMessage messages.VersionedMessage, decoded interface{}) error {
+	err := handleUnversionedAction(srv, clientID, msg, versionedMessage, decoded)
+
+	// The device twin refuses the details of a device it already has, the groups are still linked if that failed before
+	if linkErr := srv.linkAutoRegistrationGroups(clientID, msg.Payload()); linkErr != nil {
+		logger.Errorf("error adding %s to its auto-registration groups: %v", clientID, linkErr)
+	}
+	return err
+}
+
+// linkAutoRegistrationGroups adds a device to the groups of its auto-registration, creating the groups as needed.
+// The groups are made in the organization the device was registered to, never one the device claims to be in.
+func (srv *Service) linkAutoRegistrationGroups(clientID string, payload []byte) error {
+	if srv.identity == nil {
+		return nil
+	}
+
+	orgID, groups, err := srv.identity.Identity.AutoRegistrationGroups(clientID)
+	if err != nil || len(groups) == 0 {
+		return err
+	}
+
+	d := twinmessages.PublishDevice{}
+	if err := json.Unmarshal(payload, &d); err != nil {
+		return fmt.Errorf("error in device action message: %w", err)
+	}
+	if d.Result == nil || d.Result.OrgId != orgID {
+		return fmt.Errorf("the device action message is not for organization %s", orgID)
+	}
+
+	for _, name := range groups {
+		if _, err := srv.controller.GroupGet(orgID, name); err != nil {
+			if err := srv.controller.GroupCreate(orgID, name); err != nil {
+				return fmt.Errorf("error creating group %s: %w", name, err)
+			}
+		}
+
+		devices, err := srv.controller.GroupGetDevices(orgID, name)
+		if err != nil {
+			return fmt.Errorf("error getting the devices of group %s: %w", name, err)
+		}
+		if containsDevice(devices, clientID) {
+			continue
+		}
+
+		if err := srv.controller.GroupLinkDevice(orgID, name, clientID); err != nil {
+			return fmt.Errorf("error linking group %s: %w", name, err)
+		}
+	}
+
+	return srv.identity.Identity.AutoRegistrationGroupsApplied(clientID)
+}
+
+func containsDevice(devices []twinmessages.Device, deviceID string) bool {
+	for _, d := range devices {
+		if d.DeviceId == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+func decodePublishSnapsV2(payload []byte) (interface{}, error) {
+	var versionedPublishSnaps messages.PublishSnapsV2
+	err := json.Unmarshal(payload, &versionedPublishSnaps)
+	if err != nil {
+		return nil, fmt.Errorf("error trying to unmarshal PublishSnapsV2 message: %w", err)
+	}
+	return &versionedPublishSnaps, nil
+}
+
+func handlePublishSnapsV2(srv *Service, clientID string, msg MQTT.Message, versionedMessage messages.VersionedMessage, decoded interface{}) error {
+	versionedPublishSnaps := decoded.(*messages.PublishSnapsV2)
+
+	// build a message payload for ActionResponse
+	err := srv.sendLegacyActionHandlerUnversionedPayload(clientID, msg, versionedMessage)
+	if err != nil {
+		return fmt.Errorf("error trying to send unversioned payload to legacy action handler: %w", err)
+	}
+
+	if versionedPublishSnaps.Result == nil {
+		return nil
+	}
+
+	var healthHashes models.HealthHash
+
+	tx := srv.db.Find(&healthHashes, &models.HealthHash{DeviceID: clientID})
+	if tx.Error != nil {
+		return fmt.Errorf("error trying to find health hash for %s: %w", versionedPublishSnaps.Id, tx.Error)
+	}
+
+	if tx.RowsAffected == 0 {
+		// Without a health message there's nothing to verify against yet, the next one creates the entry
+		logger.Infof("Received snap list for clientID=%s, actionID=%s but do not have a health hash entry for it yet", clientID, versionedPublishSnaps.Id)
+		return nil
+	}
+
+	version := hashVersion(msg.Payload())
+	hasher, ok := snapHashers[version]
+	if !ok {
+		logger.Warnf("Snap list from %s has unsupported hash version %d, not verifying hashes", clientID, version)
+		return nil
+	}
+
+	// The twin now has this snap list, so its hashes are the twin's hashes. A snap list hash that can't be
+	// computed is the one the device included.
+	expected := models.HealthHash{SnapListHash: versionedPublishSnaps.Result.SnapListHash}
+	if err := computeTwinHashes(&expected, hasher, snapListHashEntries(versionedPublishSnaps.Result.Snaps)); err != nil {
+		return fmt.Errorf("error computing the snap hashes for %s: %w", clientID, err)
+	}
+
+	drifted := expected.InstalledSnapsHash != versionedPublishSnaps.Result.InstalledSnapsHash ||
+		expected.SnapListHash != versionedPublishSnaps.Result.SnapListHash
+	if drifted {
+		logger.Warnf("Snap hashes reported by %s (%s, %s) do not match the ones computed from its snap list (%s, %s)", clientID,
+			versionedPublishSnaps.Result.InstalledSnapsHash, versionedPublishSnaps.Result.SnapListHash, expected.InstalledSnapsHash, expected.SnapListHash)
+	}
+
+	tx = srv.db.Model(&healthHashes).Select("SnapListHash", "InstalledSnapsHash", "Drifted", "HashVersion", "LastRefresh").Updates(&models.HealthHash{
+		SnapListHash:       expected.SnapListHash,
+		InstalledSnapsHash: expected.InstalledSnapsHash,
+		Drifted:            drifted,
+		HashVersion:        version,
+		LastRefresh:        time.Now(),
+	})
+
+	if tx.Error != nil {
+		return fmt.Errorf("error trying to update health hashes for %s: %w", healthHashes.DeviceID, tx.Error)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package devicetwin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/everactive/dmscore/iot-devicetwin/domain"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/actions"
+	twinmessages "github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/iot-devicetwin/service/controller"
+	"github.com/everactive/dmscore/iot-devicetwin/service/devicetwin"
+	identitymocks "github.com/everactive/dmscore/iot-identity/service/mocks"
+	identityweb "github.com/everactive/dmscore/iot-identity/web"
+	mocks "github.com/everactive/dmscore/mocks/external/mqtt"
+	"github.com/everactive/dmscore/pkg/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_lookupActionHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		version    string
+		wantDecode bool
+		wantErr    bool
+	}{
+		{name: "unversioned-list", action: actions.List, version: ""},
+		{name: "unversioned-any", action: actions.Device, version: ""},
+		{name: "v2-list", action: actions.List, version: "2", wantDecode: true},
+		{name: "v2-unhandled-action", action: actions.Device, version: "2", wantErr: true},
+		{name: "unknown-version", action: actions.List, version: "7", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := lookupActionHandler(tt.action, tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, h.handle)
+			assert.Equal(t, tt.wantDecode, h.decode != nil)
+		})
+	}
+}
+
+func Test_actionHandlersMatchVersions(t *testing.T) {
+	// Every versioned action is handled in the version it is sent with, and nothing else is versioned
+	for action, version := range actions.Versions {
+		_, ok := actionHandlers[actionHandlerKey{action: action, version: actions.Version(action, version)}]
+		assert.True(t, ok, "no handler for version %d of %s", version, action)
+	}
+
+	for key := range actionHandlers {
+		if len(key.version) == 0 {
+			continue
+		}
+		assert.Equal(t, key.version, actions.Version(key.action, actions.Versions[key.action]), "%s is not sent with version %s", key.action, key.version)
+	}
+}
+
+func Test_handleUnversionedDevice(t *testing.T) {
+	payload := []byte(`{"id":"1","action":"device","success":true,"result":{"orgId":"abc","deviceId":"a111"}}`)
+
+	tests := []struct {
+		name        string
+		orgID       string
+		groups      []string
+		twinErr     error
+		wantLinks   []string
+		wantApplied bool
+		wantErr     bool
+	}{
+		{"valid-no-groups", "", nil, nil, nil, false, false},
+		{"valid-groups", "abc", []string{"drones", "field"}, nil, []string{"drones"}, true, false},
+		{"valid-existing-device", "abc", []string{"drones", "field"}, errors.New("device already exists"), []string{"drones"}, true, true},
+		{"invalid-other-org", "def", []string{"drones", "field"}, nil, nil, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			twin := &devicetwin.MockDeviceTwin{}
+			twin.On("ActionResponse", "a111", "1", actions.Device, payload).Return(tt.twinErr)
+
+			identityMock := &identitymocks.Identity{}
+			identityMock.On("AutoRegistrationGroups", "a111").Return(tt.orgID, tt.groups, nil)
+			identityMock.On("AutoRegistrationGroupsApplied", "a111").Return(nil)
+
+			// The drones group is new, the device is already in the field group
+			ctrl := &controller.MockController{}
+			ctrl.On("GroupGet", "abc", "drones").Return(domain.Group{}, errors.New("not found"))
+			ctrl.On("GroupCreate", "abc", "drones").Return(nil)
+			ctrl.On("GroupGetDevices", "abc", "drones").Return([]twinmessages.Device{}, nil)
+			ctrl.On("GroupGet", "abc", "field").Return(domain.Group{Name: "field"}, nil)
+			ctrl.On("GroupGetDevices", "abc", "field").Return([]twinmessages.Device{{DeviceId: "a111"}}, nil)
+			ctrl.On("GroupLinkDevice", "abc", "drones", "a111").Return(nil)
+
+			msg := &mocks.Message{}
+			msg.On("Payload").Return(payload)
+
+			srv := &Service{twin: twin, controller: ctrl, identity: &identityweb.IdentityService{Identity: identityMock}}
+			err := handleUnversionedDevice(srv, "a111", msg, messages.VersionedMessage{Id: "1", Action: actions.Device}, nil)
+			assert.Equal(t, tt.wantErr, err != nil)
+
+			ctrl.AssertNumberOfCalls(t, "GroupLinkDevice", len(tt.wantLinks))
+			if tt.wantApplied {
+				identityMock.AssertCalled(t, "AutoRegistrationGroupsApplied", "a111")
+			} else {
+				identityMock.AssertNotCalled(t, "AutoRegistrationGroupsApplied", "a111")
+			}
+		})
+	}
+}
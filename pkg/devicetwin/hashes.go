@@ -0,0 +1,136 @@
+package devicetwin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	twinmessages "github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/models"
+	"github.com/everactive/dmscore/pkg/messages"
+)
+
+// Versions of how the snap hashes of the health messages and snap lists are computed, given by their hashVersion
+// field (see docs/missing-snaps.md)
+const (
+	// hashVersionLegacy is the version of devices that don't send a hashVersion. The installed snaps hash is the
+	// SHA-256 of the sorted snap names, the snap list hash is the SHA-256 of the snap list of snapd, which only the
+	// device can compute.
+	hashVersionLegacy = 1
+	// hashVersionTwin computes both hashes from the snap fields stored in the device twin, so neither is taken from
+	// the device
+	hashVersionTwin = 2
+)
+
+// snapHasher computes the hashes of one hash version. A hasher without snapList can't compute the snap list hash,
+// the one of the last snap list received is used instead.
+type snapHasher struct {
+	installedSnaps func(snaps []snapHashEntry) (string, error)
+	snapList       func(snaps []snapHashEntry) (string, error)
+}
+
+// snapHashers are the hash versions that the reported hashes can be verified for
+var snapHashers = map[int]snapHasher{
+	hashVersionLegacy: {installedSnaps: installedSnapsHash},
+	hashVersionTwin:   {installedSnaps: installedSnapsHash, snapList: snapListHash},
+}
+
+// hashVersionField is the version of the hashes of a health message, or of the result of a snap list
+type hashVersionField struct {
+	HashVersion int               `json:"hashVersion"`
+	Result      *hashVersionField `json:"result"`
+}
+
+// snapHashEntry is a snap as it is hashed, with the fields the device twin stores
+type snapHashEntry struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Revision int    `json:"revision"`
+	Channel  string `json:"channel"`
+	Status   string `json:"status"`
+}
+
+// hashVersion reads the hash version of a payload, the legacy version when it has none
+func hashVersion(payload []byte) int {
+	v := hashVersionField{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return hashVersionLegacy
+	}
+	if v.Result != nil {
+		v.HashVersion = v.Result.HashVersion
+	}
+	if v.HashVersion == 0 {
+		return hashVersionLegacy
+	}
+	return v.HashVersion
+}
+
+// computeTwinHashes sets the hashes of the device twin computed from its snaps. When the hash version can't compute
+// the snap list hash, the one of the last snap list received is kept.
+func computeTwinHashes(healthHashes *models.HealthHash, hasher snapHasher, snaps []snapHashEntry) error {
+	installed, err := hasher.installedSnaps(snaps)
+	if err != nil {
+		return err
+	}
+	healthHashes.InstalledSnapsHash = installed
+
+	if hasher.snapList == nil {
+		return nil
+	}
+
+	snapList, err := hasher.snapList(snaps)
+	if err != nil {
+		return err
+	}
+	healthHashes.SnapListHash = snapList
+	return nil
+}
+
+// installedSnapsHash is the SHA-256, hex encoded, of the JSON array of the snap names sorted alphabetically
+func installedSnapsHash(snaps []snapHashEntry) (string, error) {
+	names := make([]string, 0, len(snaps))
+	for _, s := range snaps {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+
+	return hashJSON(names)
+}
+
+// snapListHash is the SHA-256, hex encoded, of the JSON array of the snaps sorted by name
+func snapListHash(snaps []snapHashEntry) (string, error) {
+	sorted := make([]snapHashEntry, len(snaps))
+	copy(sorted, snaps)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	return hashJSON(sorted)
+}
+
+func hashJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// twinSnapHashEntries converts the snaps of the device twin to the snaps that are hashed
+func twinSnapHashEntries(snaps []twinmessages.DeviceSnap) []snapHashEntry {
+	entries := make([]snapHashEntry, 0, len(snaps))
+	for _, s := range snaps {
+		entries = append(entries, snapHashEntry{Name: s.Name, Version: s.Version, Revision: s.Revision, Channel: s.Channel, Status: s.Status})
+	}
+	return entries
+}
+
+// snapListHashEntries converts the snaps of a snap list to the snaps that are hashed
+func snapListHashEntries(snaps []*messages.DeviceSnap) []snapHashEntry {
+	entries := make([]snapHashEntry, 0, len(snaps))
+	for _, s := range snaps {
+		entries = append(entries, snapHashEntry{Name: s.Name, Version: s.Version, Revision: s.Revision, Channel: s.Channel, Status: s.Status})
+	}
+	return entries
+}
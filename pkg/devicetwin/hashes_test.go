@@ -0,0 +1,84 @@
+package devicetwin
+
+import (
+	"testing"
+
+	"github.com/everactive/dmscore/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_installedSnapsHash(t *testing.T) {
+	tests := []struct {
+		name  string
+		snaps []snapHashEntry
+		want  string
+	}{
+		// sha256 of ["core","pc"]
+		{"sorted", []snapHashEntry{{Name: "core"}, {Name: "pc"}}, "31c0b2f2faa8ed336ad466f7ab22501014db4faa09b544247a622dae058c9bf2"},
+		{"unsorted", []snapHashEntry{{Name: "pc"}, {Name: "core", Revision: 12}}, "31c0b2f2faa8ed336ad466f7ab22501014db4faa09b544247a622dae058c9bf2"},
+		// sha256 of []
+		{"empty", []snapHashEntry{}, "4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := installedSnapsHash(tt.snaps)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_snapListHash(t *testing.T) {
+	core := snapHashEntry{Name: "core", Version: "16", Revision: 12, Channel: "stable", Status: "active"}
+	pc := snapHashEntry{Name: "pc", Version: "1.0", Revision: 3, Channel: "stable", Status: "active"}
+
+	sorted, err := snapListHash([]snapHashEntry{core, pc})
+	assert.NoError(t, err)
+	unsorted, err := snapListHash([]snapHashEntry{pc, core})
+	assert.NoError(t, err)
+	assert.Equal(t, sorted, unsorted)
+
+	pc.Revision = 4
+	refreshed, err := snapListHash([]snapHashEntry{core, pc})
+	assert.NoError(t, err)
+	assert.NotEqual(t, sorted, refreshed)
+}
+
+func Test_hashVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    int
+	}{
+		{"legacy", `{"deviceId":"a111"}`, hashVersionLegacy},
+		{"twin", `{"deviceId":"a111","hashVersion":2}`, hashVersionTwin},
+		{"unsupported", `{"deviceId":"a111","hashVersion":7}`, 7},
+		{"snap-list", `{"action":"list","result":{"hashVersion":2,"snaps":[]}}`, hashVersionTwin},
+		{"legacy-snap-list", `{"action":"list","result":{"snaps":[]}}`, hashVersionLegacy},
+		{"invalid", `{`, hashVersionLegacy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hashVersion([]byte(tt.payload)))
+		})
+	}
+}
+
+func Test_computeTwinHashes(t *testing.T) {
+	snaps := []snapHashEntry{{Name: "core", Revision: 12}, {Name: "pc", Revision: 3}}
+	installed, err := installedSnapsHash(snaps)
+	assert.NoError(t, err)
+	snapList, err := snapListHash(snaps)
+	assert.NoError(t, err)
+
+	// The legacy snap list hash can only be computed by the device, the last one received is kept
+	legacy := models.HealthHash{SnapListHash: "from-the-last-snap-list"}
+	assert.NoError(t, computeTwinHashes(&legacy, snapHashers[hashVersionLegacy], snaps))
+	assert.Equal(t, installed, legacy.InstalledSnapsHash)
+	assert.Equal(t, "from-the-last-snap-list", legacy.SnapListHash)
+
+	twin := models.HealthHash{SnapListHash: "from-the-last-snap-list"}
+	assert.NoError(t, computeTwinHashes(&twin, snapHashers[hashVersionTwin], snaps))
+	assert.Equal(t, installed, twin.InstalledSnapsHash)
+	assert.Equal(t, snapList, twin.SnapListHash)
+}
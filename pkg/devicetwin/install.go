@@ -4,9 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/everactive/dmscore/config/keys"
 	"github.com/everactive/dmscore/iot-devicetwin/datastore"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/topics"
 	"github.com/everactive/dmscore/iot-devicetwin/service/mqtt"
 	"github.com/everactive/dmscore/models"
 	"github.com/everactive/dmscore/pkg/datastores"
@@ -29,9 +29,10 @@ type InstallService struct {
 	checkerMutex        sync.Mutex
 	stores              *datastores.DataStores
 	legacyPublishChan   chan mqtt.PublishMessage
+	topics              topics.Layout
 }
 
-func NewInstallService(stores *datastores.DataStores, legacyPublishChan chan mqtt.PublishMessage) *suture.Supervisor {
+func NewInstallService(stores *datastores.DataStores, legacyPublishChan chan mqtt.PublishMessage, layout topics.Layout) *suture.Supervisor {
 	sup := suture.NewSimple("install")
 	hearbeatInterval := viper.GetDuration(keys.DefaultServiceHeartbeat)
 	interval := viper.GetDuration(keys.RequiredSnapsInstallServiceCheckInterval)
@@ -41,6 +42,7 @@ func NewInstallService(stores *datastores.DataStores, legacyPublishChan chan mqt
 		supervisor:        sup,
 		stores:            stores,
 		legacyPublishChan: legacyPublishChan,
+		topics:            layout,
 	}
 
 	sup.Add(i)
@@ -89,7 +91,7 @@ func (i *InstallService) createOrRefreshChecker(legacyPublishChan chan mqtt.Publ
 
 	checkIntervalDuration := viper.GetDuration(keys.RequiredSnapsCheckInterval)
 
-	i.checkerService = NewChecker(legacyPublishChan, checkIntervalDuration)
+	i.checkerService = NewChecker(legacyPublishChan, checkIntervalDuration, i.topics)
 
 	serviceToken := i.supervisor.Add(i.checkerService)
 	i.checkerServiceToken = &serviceToken
@@ -103,9 +105,10 @@ func (i *InstallService) createOrRefreshChecker(legacyPublishChan chan mqtt.Publ
 	return nil
 }
 
-func NewChecker(legacyPublishChan chan mqtt.PublishMessage, checkIntervalDuration time.Duration) *Checker {
+func NewChecker(legacyPublishChan chan mqtt.PublishMessage, checkIntervalDuration time.Duration, layout topics.Layout) *Checker {
 	return &Checker{
 		legacyPublishChan: legacyPublishChan,
+		topics:            layout,
 		deviceList:        map[string]*datastore.Device{},
 		currentModels:     map[string][]models.DeviceModelRequiredSnap{},
 		deviceCheckTicker: time.NewTicker(checkIntervalDuration),
@@ -119,6 +122,7 @@ type Checker struct {
 	deviceMutex       sync.Mutex
 	legacyPublishChan chan mqtt.PublishMessage
 	deviceCheckTicker *time.Ticker
+	topics            topics.Layout
 }
 
 func (c *Checker) RefreshDevices(dss *datastores.DataStores) error {
@@ -281,7 +285,7 @@ func (c *Checker) checkNextDevice() error {
 		return nil
 	}
 
-	t := fmt.Sprintf("devices/actions/%s/required-install", sanitizeSerial(nextDevice.SerialNumber))
+	t := c.topics.RequiredInstallTopic(nextDevice.OrganisationID, sanitizeSerial(nextDevice.SerialNumber))
 	m := messages.RequiredInstall{
 		Id:    ksuid2.New().String(),
 		Snaps: requiredForThisDevice,
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/everactive/dmscore/config/keys"
 	devicetwindatastore "github.com/everactive/dmscore/iot-devicetwin/datastore"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/topics"
 	"github.com/everactive/dmscore/iot-devicetwin/service/mqtt"
 	identitydatastore "github.com/everactive/dmscore/iot-identity/datastore"
 	"github.com/everactive/dmscore/iot-identity/domain"
@@ -374,6 +375,7 @@ func TestNewInstallService(t *testing.T) {
 	type args struct {
 		stores            *datastores.DataStores
 		legacyPublishChan chan mqtt.PublishMessage
+		layout            topics.Layout
 	}
 	tests := []struct {
 		name string
@@ -384,7 +386,7 @@ func TestNewInstallService(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equalf(t, tt.want, NewInstallService(tt.args.stores, tt.args.legacyPublishChan), "NewInstallService(%v, %v)", tt.args.stores, tt.args.legacyPublishChan)
+			assert.Equalf(t, tt.want, NewInstallService(tt.args.stores, tt.args.legacyPublishChan, tt.args.layout), "NewInstallService(%v, %v, %v)", tt.args.stores, tt.args.legacyPublishChan, tt.args.layout)
 		})
 	}
 }
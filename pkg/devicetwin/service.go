@@ -9,6 +9,7 @@ import (
 	"github.com/everactive/dmscore/config/keys"
 	devicetwinconfig "github.com/everactive/dmscore/iot-devicetwin/config"
 	"github.com/everactive/dmscore/iot-devicetwin/pkg/actions"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/topics"
 	"github.com/everactive/dmscore/iot-devicetwin/service/controller"
 	"github.com/everactive/dmscore/iot-devicetwin/service/devicetwin"
 	"github.com/everactive/dmscore/iot-devicetwin/service/mqtt"
@@ -25,14 +26,12 @@ import (
 	"github.com/thejerf/suture/v4"
 	"gorm.io/gorm"
 	"path"
-	"strings"
 	"time"
 )
 
 const (
-	clientIDMQTTTopicPartsCount = 4
-	defaultChannelBufferSize    = 10
-	serviceName                 = "DeviceTwin"
+	defaultChannelBufferSize = 10
+	serviceName              = "DeviceTwin"
 )
 
 var (
@@ -44,6 +43,17 @@ var (
 	rtClock                    = clock.New()
 )
 
+// topicLayout builds the MQTT topic layout from the configuration
+func topicLayout() topics.Layout {
+	return topics.Layout{
+		Prefix:          viper.GetString(keys.MQTTTopicPrefix),
+		Health:          viper.GetString(keys.MQTTHealthTopic),
+		Pub:             viper.GetString(keys.MQTTPubTopic),
+		Sub:             viper.GetString(keys.MQTTSubTopic),
+		RequiredInstall: viper.GetString(keys.MQTTRequiredInstallTopic),
+	}
+}
+
 func createDeviceTwinWebService(port string, ctrl controller.Controller) *devicetwinweb.Service {
 	return devicetwinweb.NewService(port, ctrl)
 }
@@ -62,6 +72,8 @@ type Service struct {
 	twin                 devicetwin.DeviceTwin
 	identity             *identityweb.IdentityService
 	datastore            datastore2.ConsolidatedDataStore
+	topics               topics.Layout
+	snapLists            *snapListCoalescer
 }
 
 var GetMQTTConnection = getMQTTConnection
@@ -125,13 +137,24 @@ func New(identity *identityweb.IdentityService, dss *datastore2.DataStores) (*su
 	legacyActionChan := make(chan MQTT.Message, defaultChannelBufferSize)
 	legacyPublishChan := make(chan mqtt.PublishMessage, defaultChannelBufferSize)
 
+	layout := topicLayout()
+
 	twin := devicetwin.NewService(dss.DeviceTwinStore, dss.ManagementStore)
-	ctrl := controller.NewService(legacyHealthChan, legacyActionChan, legacyPublishChan, twin)
+	actionTimeout := viper.GetDuration(keys.ActionFollowUpTimeout)
+	ctrl := controller.NewService(legacyHealthChan, legacyActionChan, legacyPublishChan, twin, layout, actionTimeout)
 
 	servicePort := viper.GetString(keys.GetDeviceTwinKey(keys.ServicePort))
 
 	w := CreateDeviceTwinWebService(servicePort, ctrl)
 
+	snapListMinInterval := viper.GetDuration(keys.SnapListMinInterval)
+	snapListPendingTimeout := viper.GetDuration(keys.SnapListPendingTimeout)
+	snapLists := newSnapListCoalescer(snapListMinInterval, snapListPendingTimeout, rtClock)
+
+	if viper.GetBool(keys.RefreshSnapListOnAnyChange) {
+		logger.Warnf("%s is deprecated and ignored, a snap list is requested whenever reported hashes don't match the device twin", keys.RefreshSnapListOnAnyChange)
+	}
+
 	service := &Service{
 		deviceTwinWebService: w,
 		healthChan:           make(chan MQTT.Message, defaultChannelBufferSize),
@@ -141,6 +164,8 @@ func New(identity *identityweb.IdentityService, dss *datastore2.DataStores) (*su
 		twin:                 twin,
 		controller:           ctrl,
 		identity:             identity,
+		topics:               layout,
+		snapLists:            snapLists,
 	}
 
 	// Set up the MQTT client and handle pub/sub from here... as the MQTT and DeviceTwin services are mutually dependent
@@ -157,7 +182,7 @@ func New(identity *identityweb.IdentityService, dss *datastore2.DataStores) (*su
 	service.legacyActionChan = legacyActionChan
 	service.legacyPublishChan = legacyPublishChan
 
-	installService := NewInstallService(dss, legacyPublishChan)
+	installService := NewInstallService(dss, legacyPublishChan, layout)
 
 	sup.Add(service)
 	sup.Add(ctrl)
@@ -240,7 +265,7 @@ func (srv *Service) sendLegacyActionHandlerUnversionedPayload(clientID string, m
 }
 
 func (srv *Service) actionMessageHandler(msg MQTT.Message) error {
-	clientID := getClientID(msg)
+	_, clientID := getClientID(msg, srv.topics.ParsePub)
 	logger.Printf("Action response from %s", clientID)
 
 	// is this a versioned message?
@@ -249,6 +274,16 @@ func (srv *Service) actionMessageHandler(msg MQTT.Message) error {
 		return fmt.Errorf("error in action message: %w", err)
 	}
 
+	// Any snap list response, successful or not, means another one can be requested
+	if versionedMessage.Action == actions.List {
+		srv.snapLists.Responded(clientID)
+	}
+
+	// The device has responded, so any snap list that was waiting on this action can be requested
+	if err := srv.controller.ActionResponded(clientID, versionedMessage.Id); err != nil {
+		logger.Errorf("error following up action %s: %v", versionedMessage.Id, err)
+	}
+
 	// Check if there is an error and handle it
 	if !versionedMessage.Success {
 		return fmt.Errorf("error in action `%s`: (%s) %s", versionedMessage.Action, versionedMessage.Id, versionedMessage.Message)
@@ -256,78 +291,33 @@ func (srv *Service) actionMessageHandler(msg MQTT.Message) error {
 
 	logger.Infof("Received action message type %s, sending to iot-devicetwin", versionedMessage.Action)
 
-	// If it's unversioned it will be the string zero value (empty), if it's a version we know, handle it, otherwise error
-	switch versionedMessage.Version {
-	case "":
-		err := srv.twin.ActionResponse(clientID, versionedMessage.Id, versionedMessage.Action, msg.Payload())
-		if err != nil {
-			return fmt.Errorf("error in ActionResponse: %w", err)
-		}
-	case "2":
-		// we should only be expecting the list action
-		switch versionedMessage.Action {
-		case actions.List:
-			// handle it here
-			var versionedPublishSnaps messages.PublishSnapsV2
-			err := json.Unmarshal(msg.Payload(), &versionedPublishSnaps)
-			if err != nil {
-				return fmt.Errorf("error trying to unmarshal PublishSnapsV2 message: %w", err)
-			}
-			// update hashes
-			var healthHashes models.HealthHash
-
-			tx := srv.db.Find(&healthHashes, &models.HealthHash{DeviceID: clientID})
-			if tx.Error != nil {
-				return fmt.Errorf("error trying to find health hash for %s: %w", versionedPublishSnaps.Id, tx.Error)
-			}
-
-			if tx.RowsAffected == 0 {
-				// If we received a list of snaps for device and we don't have a health has
-				// entry for it yet, ignore it for now.
-				logger.Infof("Received snap list for clientID=%s, actionID=%s but do not have a health hash entry for it yet; will still process it", clientID, versionedPublishSnaps.Id)
-				// build a message payload for ActionResponse
-				err = srv.sendLegacyActionHandlerUnversionedPayload(clientID, msg, versionedMessage)
-				if err != nil {
-					return fmt.Errorf("error trying to send unversioned payload to legacy action handler: %w", err)
-				}
-				return nil
-			}
-
-			// OK- we have our health hash entry, update it
-			tx = srv.db.Model(&healthHashes).Updates(&models.HealthHash{
-				DeviceID:           healthHashes.DeviceID,
-				SnapListHash:       versionedPublishSnaps.Result.SnapListHash,
-				InstalledSnapsHash: versionedPublishSnaps.Result.InstalledSnapsHash,
-				LastRefresh:        time.Now(),
-			})
-
-			if tx.Error != nil {
-				return fmt.Errorf("error trying to update health hashes for %s: %w", healthHashes.DeviceID, tx.Error)
-			}
-
-			// build a message payload for ActionResponse
-			err = srv.sendLegacyActionHandlerUnversionedPayload(clientID, msg, versionedMessage)
-			if err != nil {
-				return fmt.Errorf("error trying to send unversioned payload to legacy action handler: %w", err)
-			}
-			return nil
-		default:
-			logger.Errorf("Received a versioned action message we cannot handled: %s", versionedMessage.Action)
-			return fmt.Errorf("error trying to handle versioned action message type %s", versionedMessage.Action)
-		}
-	default:
-		err := fmt.Errorf("received a versioned action message with a version we don't expect: %s", versionedMessage.Version)
+	handler, err := lookupActionHandler(versionedMessage.Action, versionedMessage.Version)
+	if err != nil {
 		logger.Error(err)
 		return err
+	}
 
+	// Keep track of the highest protocol version the device has spoken so actions can be sent with it
+	if version, err := actions.ProtocolVersion(versionedMessage.Version); err == nil {
+		if err := srv.twin.DeviceProtocolVersion(clientID, version); err != nil {
+			logger.Errorf("error recording protocol version %d for %s: %v", version, clientID, err)
+		}
 	}
 
-	return nil
+	var decoded interface{}
+	if handler.decode != nil {
+		decoded, err = handler.decode(msg.Payload())
+		if err != nil {
+			return err
+		}
+	}
+
+	return handler.handle(srv, clientID, msg, versionedMessage, decoded)
 }
 
 func (srv *Service) healthMessageHandler(msg MQTT.Message) error {
 	// After sending the message to the legacy handler, do our own processing
-	clientID := getClientID(msg)
+	orgID, clientID := getClientID(msg, srv.topics.ParseHealth)
 	logger.Printf("Health update from %s", clientID)
 
 	// Parse the body
@@ -341,6 +331,11 @@ func (srv *Service) healthMessageHandler(msg MQTT.Message) error {
 		return fmt.Errorf("client/device ID mismatch: %s from the topic and %s from the message; discarding", clientID, h.DeviceId)
 	}
 
+	// If the topic layout carries the organization, it has to match as well
+	if len(orgID) > 0 && orgID != h.OrgId {
+		return fmt.Errorf("organization ID mismatch: %s from the topic and %s from the message; discarding", orgID, h.OrgId)
+	}
+
 	logger.Infof("Received health message %+v, sending to iot-devicetwin", msg)
 	srv.legacyHealthChan <- msg
 
@@ -356,45 +351,70 @@ func (srv *Service) healthMessageHandler(msg MQTT.Message) error {
 		return nil
 	}
 
+	// What the device reports is checked against the hashes computed from the device twin, the way its hash
+	// version says
+	version := hashVersion(msg.Payload())
+	hasher, ok := snapHashers[version]
+	if !ok {
+		logger.Warnf("Health message from %s has unsupported hash version %d, not verifying hashes", healthMessage.DeviceId, version)
+		return nil
+	}
+
+	snaps, err := srv.twin.DeviceSnaps(healthMessage.OrgId, healthMessage.DeviceId)
+	if err != nil {
+		// Most likely a device the twin doesn't know yet, the legacy handler requests its details and snaps
+		logger.Infof("Could not get the device twin snaps of %s, not verifying hashes: %v", healthMessage.DeviceId, err)
+		return nil
+	}
+
 	var healthHashes models.HealthHash
 	tx := srv.db.Find(&healthHashes, &models.HealthHash{DeviceID: healthMessage.DeviceId})
 	if tx.Error != nil {
 		return fmt.Errorf("error trying to find health hash for %s: %w", healthMessage.DeviceId, tx.Error)
 	}
 
-	if tx.RowsAffected == 0 {
-		srv.db.Create(&models.HealthHash{
-			LastRefresh:        time.Now(),
-			OrgID:              healthMessage.OrgId,
-			DeviceID:           healthMessage.DeviceId,
-			SnapListHash:       healthMessage.SnapListHash,
-			InstalledSnapsHash: healthMessage.InstalledSnapsHash,
-		})
-
-		return nil
+	if err := computeTwinHashes(&healthHashes, hasher, twinSnapHashEntries(snaps)); err != nil {
+		return fmt.Errorf("error computing the snap hashes of %s: %w", healthMessage.DeviceId, err)
 	}
 
-	refreshOnAnyChanges := viper.GetBool(keys.RefreshSnapListOnAnyChange)
+	healthHashes.OrgID = healthMessage.OrgId
+	healthHashes.DeviceID = healthMessage.DeviceId
+	healthHashes.LastRefresh = time.Now()
+	healthHashes.HashVersion = version
+	healthHashes.ReportedSnapListHash = healthMessage.SnapListHash
+	healthHashes.ReportedInstalledSnapsHash = healthMessage.InstalledSnapsHash
+	healthHashes.Drifted = healthHashes.SnapListHash != healthMessage.SnapListHash ||
+		healthHashes.InstalledSnapsHash != healthMessage.InstalledSnapsHash
 
-	if healthHashes.SnapListHash == healthMessage.SnapListHash &&
-		(healthHashes.InstalledSnapsHash == healthMessage.InstalledSnapsHash || (healthHashes.InstalledSnapsHash != healthMessage.InstalledSnapsHash && !refreshOnAnyChanges)) {
-		// Just update and return
-		srv.db.Model(&healthHashes).Updates(&models.HealthHash{LastRefresh: time.Now()})
-		log.Infof("Update health hash last refresh time for %s to now. SnapListHash=%s and InstallSnapsHash=%s",
+	tx = srv.db.Save(&healthHashes)
+	if tx.Error != nil {
+		return fmt.Errorf("error trying to save health hash for %s: %w", healthMessage.DeviceId, tx.Error)
+	}
+
+	if !healthHashes.Drifted {
+		log.Tracef("Health hashes for %s match the device twin. SnapListHash=%s and InstallSnapsHash=%s",
 			healthHashes.DeviceID, healthHashes.SnapListHash, healthHashes.InstalledSnapsHash)
 		return nil
 	}
 
-	// if they don't match, then we need to request the updated list
-	srv.controller.DeviceSnapList(healthMessage.OrgId, healthMessage.DeviceId)
+	// if they don't match, then we need to request the updated list, unless one was requested recently
+	if !srv.snapLists.Request(healthMessage.DeviceId) {
+		logger.Infof("Snap list request for %s coalesced, one is pending or was sent recently", healthMessage.DeviceId)
+		return nil
+	}
+
+	if _, err := srv.controller.DeviceSnapList(healthMessage.OrgId, healthMessage.DeviceId); err != nil {
+		srv.snapLists.Cancel(healthMessage.DeviceId)
+		return fmt.Errorf("error requesting snap list for %s: %w", healthMessage.DeviceId, err)
+	}
 
 	return nil
 }
 
 // SubscribeToActions subscribes to the published topics from the devices
 func (srv *Service) SubscribeToActions() error {
-	healthTopic := viper.GetString(keys.MQTTHealthTopic)
-	pubTopic := viper.GetString(keys.MQTTPubTopic)
+	healthTopic := srv.topics.HealthFilter()
+	pubTopic := srv.topics.PubFilter()
 
 	// Subscribe to the device health messages
 	if err := srv.MQTT.Subscribe(healthTopic, srv.healthChannelForwarder); err != nil {
@@ -420,12 +440,12 @@ func (srv *Service) healthChannelForwarder(_ MQTT.Client, msg MQTT.Message) {
 	srv.healthChan <- msg
 }
 
-// getClientID sets the client ID from the topic
-func getClientID(msg MQTT.Message) string {
-	parts := strings.Split(msg.Topic(), "/")
-	if len(parts) != clientIDMQTTTopicPartsCount-1 {
-		logger.Printf("Error in health message: expected %d parts, got %d", clientIDMQTTTopicPartsCount-1, len(parts))
-		return ""
+// getClientID gets the organization (if the topic layout has one) and client ID from the topic
+func getClientID(msg MQTT.Message, parse func(string) (string, string, error)) (string, string) {
+	orgID, clientID, err := parse(msg.Topic())
+	if err != nil {
+		logger.Printf("Error in message topic: %v", err)
+		return "", ""
 	}
-	return parts[2]
+	return orgID, clientID
 }
@@ -9,6 +9,8 @@ import (
 	"github.com/everactive/dmscore/config/keys"
 	"github.com/everactive/dmscore/iot-devicetwin/config"
 	devicetwindatastore "github.com/everactive/dmscore/iot-devicetwin/datastore"
+	devicetwinmessages "github.com/everactive/dmscore/iot-devicetwin/pkg/messages"
+	"github.com/everactive/dmscore/iot-devicetwin/pkg/topics"
 	"github.com/everactive/dmscore/iot-devicetwin/service/controller"
 	"github.com/everactive/dmscore/iot-devicetwin/service/devicetwin"
 	"github.com/everactive/dmscore/iot-devicetwin/service/factory"
@@ -284,7 +286,7 @@ func TestService_SubscribeToActions(t *testing.T) {
 			viper.Set(keys.MQTTHealthTopic, tt.fields.expectedHealthTopic)
 			viper.Set(keys.MQTTPubTopic, tt.fields.expectedPublishTopic)
 
-			srv := &Service{}
+			srv := &Service{topics: topicLayout()}
 
 			mqttMock := &mqtt.MockConnect{}
 			mqttMock.On("Subscribe", tt.fields.expectedHealthTopic, mock.AnythingOfType("mqtt.MessageHandler")).Return(tt.args.expectedHealthTopicReturn)
@@ -450,6 +452,10 @@ func TestService_actionMessageHandler(t *testing.T) {
 
 			dt := &devicetwin.MockDeviceTwin{}
 
+			ctrl := &controller.MockController{}
+			ctrl.On("ActionResponded", tt.args.expectedDeviceID, mock.AnythingOfType("string")).Return(nil)
+			srv.controller = ctrl
+
 			if tt.versionedPath {
 				publishSnaps := messages.PublishSnaps{
 					Action:  tt.args.expectedPublishSnapsV2Message.Action,
@@ -468,6 +474,7 @@ func TestService_actionMessageHandler(t *testing.T) {
 					t.FailNow()
 				}
 				dt.On("ActionResponse", tt.args.expectedDeviceID, tt.args.expectedPublishSnapsV2Message.Id, tt.args.expectedPublishSnapsV2Message.Action, payload).Return(nil)
+				dt.On("DeviceProtocolVersion", tt.args.expectedDeviceID, 2).Return(nil)
 
 				srv.db = db
 				srv.twin = dt
@@ -483,6 +490,7 @@ func TestService_actionMessageHandler(t *testing.T) {
 				}
 
 				dt.On("ActionResponse", tt.args.expectedDeviceID, tt.args.expectedPublishSnapsMessage.Id, tt.args.expectedPublishSnapsMessage.Action, payload).Return(nil)
+				dt.On("DeviceProtocolVersion", tt.args.expectedDeviceID, 1).Return(nil)
 
 				srv.twin = dt
 
@@ -502,6 +510,10 @@ func TestService_healthMessageHandler(t *testing.T) {
 		expectedHealthMessage messages.Health
 		previousHealthMessage *messages.Health
 	}
+	twinSnaps := []devicetwinmessages.DeviceSnap{{Name: "core"}, {Name: "pc"}}
+	twinInstalledSnapsHash, err := installedSnapsHash(twinSnapHashEntries(twinSnaps))
+	assert.NoError(t, err)
+
 	tests := []struct {
 		name                 string
 		fields               fields
@@ -509,6 +521,8 @@ func TestService_healthMessageHandler(t *testing.T) {
 		wantErr              bool
 		needsDatabase        bool
 		addHealthHashesFirst bool
+		twinErr              error
+		wantDrifted          bool
 	}{
 		{
 			name:    "valid-no-hashes",
@@ -517,7 +531,7 @@ func TestService_healthMessageHandler(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name:   "valid hashes not changed",
+			name:   "unknown device not verified",
 			fields: fields{},
 			args: args{
 				expectedTopic: "devices/health/1",
@@ -529,6 +543,22 @@ func TestService_healthMessageHandler(t *testing.T) {
 					SnapListHash:       "456DEF",
 				},
 			},
+			wantErr: false,
+			twinErr: errors.New("device not found"),
+		},
+		{
+			name:   "valid hashes not changed",
+			fields: fields{},
+			args: args{
+				expectedTopic: "devices/health/1",
+				expectedHealthMessage: messages.Health{
+					DeviceId:           "1",
+					InstalledSnapsHash: twinInstalledSnapsHash,
+					OrgId:              "RealOrgDotCom",
+					Refresh:            time.Now().String(),
+					SnapListHash:       "456DEF",
+				},
+			},
 			wantErr:              false,
 			needsDatabase:        true,
 			addHealthHashesFirst: true,
@@ -548,6 +578,7 @@ func TestService_healthMessageHandler(t *testing.T) {
 			},
 			wantErr:       false,
 			needsDatabase: true,
+			wantDrifted:   true,
 		},
 		{
 			name:   "valid hashes exist but changed",
@@ -572,6 +603,7 @@ func TestService_healthMessageHandler(t *testing.T) {
 			wantErr:              false,
 			needsDatabase:        true,
 			addHealthHashesFirst: true,
+			wantDrifted:          true,
 		},
 	}
 	for _, tt := range tests {
@@ -586,8 +618,18 @@ func TestService_healthMessageHandler(t *testing.T) {
 
 			healthChan := make(chan MQTT.Message)
 
+			dt := &devicetwin.MockDeviceTwin{}
+			dt.On("DeviceSnaps", tt.args.expectedHealthMessage.OrgId, tt.args.expectedHealthMessage.DeviceId).Return(twinSnaps, tt.twinErr)
+
+			ctrl := &controller.MockController{}
+			if tt.wantDrifted {
+				ctrl.On("DeviceSnapList", tt.args.expectedHealthMessage.OrgId, tt.args.expectedHealthMessage.DeviceId).Return("", nil)
+			}
+
 			srv := &Service{
 				legacyHealthChan: healthChan,
+				twin:             dt,
+				controller:       ctrl,
 			}
 
 			if tt.needsDatabase {
@@ -620,6 +662,7 @@ func TestService_healthMessageHandler(t *testing.T) {
 					healthHash.SnapListHash = tt.args.expectedHealthMessage.SnapListHash
 					healthHash.InstalledSnapsHash = tt.args.expectedHealthMessage.InstalledSnapsHash
 				}
+				srv.db.Save(&healthHash)
 			}
 
 			wg := sync.WaitGroup{}
@@ -638,9 +681,13 @@ func TestService_healthMessageHandler(t *testing.T) {
 			if tt.needsDatabase {
 				var hh models.HealthHash
 				srv.db.Find(&hh, &models.HealthHash{DeviceID: tt.args.expectedHealthMessage.DeviceId})
-				assert.Equal(t, tt.args.expectedHealthMessage.SnapListHash, hh.SnapListHash)
-				assert.Equal(t, tt.args.expectedHealthMessage.InstalledSnapsHash, hh.InstalledSnapsHash)
+				assert.Equal(t, tt.args.expectedHealthMessage.SnapListHash, hh.ReportedSnapListHash)
+				assert.Equal(t, tt.args.expectedHealthMessage.InstalledSnapsHash, hh.ReportedInstalledSnapsHash)
+				assert.Equal(t, twinInstalledSnapsHash, hh.InstalledSnapsHash)
+				assert.Equal(t, tt.wantDrifted, hh.Drifted)
 			}
+
+			ctrl.AssertExpectations(t)
 		})
 	}
 }
@@ -732,7 +779,7 @@ func Test_getClientID(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mockedMessage := &mocks.Message{}
 			mockedMessage.On("Topic").Return(fmt.Sprintf("device/health/%s", tt.args.expectedClientID))
-			if got := getClientID(mockedMessage); got != tt.args.expectedClientID {
+			if _, got := getClientID(mockedMessage, topics.Layout{}.ParseHealth); got != tt.args.expectedClientID {
 				t.Errorf("getClientID() = %v, want %v", got, tt.want)
 			}
 		})
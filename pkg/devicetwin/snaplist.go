@@ -0,0 +1,134 @@
+package devicetwin
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/everactive/dmscore/pkg/metrics"
+)
+
+// snapListState is the last snap list request sent to a device
+type snapListState struct {
+	lastRequest time.Time
+	pending     bool
+}
+
+// snapListCoalescer limits the snap list requests sent to each device when its health hashes change. A request
+// is only sent if none is pending and the last one was at least minInterval ago. A pending request that never gets
+// a response stops blocking new ones after pendingTimeout. The devices whose window has expired are evicted, so
+// only the devices with a recent request are kept.
+type snapListCoalescer struct {
+	minInterval    time.Duration
+	pendingTimeout time.Duration
+	clock          clock.Clock
+	mutex          sync.Mutex
+	devices        map[string]*snapListState
+	lastPrune      time.Time
+}
+
+func newSnapListCoalescer(minInterval, pendingTimeout time.Duration, clk clock.Clock) *snapListCoalescer {
+	return &snapListCoalescer{
+		minInterval:    minInterval,
+		pendingTimeout: pendingTimeout,
+		clock:          clk,
+		devices:        map[string]*snapListState{},
+	}
+}
+
+// Request reports whether a snap list request should be sent to the device now, marking it pending if so.
+// A nil coalescer allows every request.
+func (c *snapListCoalescer) Request(deviceID string) bool {
+	if c == nil {
+		return true
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.clock.Now()
+	c.prune(now)
+
+	state, ok := c.devices[deviceID]
+	if ok {
+		if !c.expired(state, now) {
+			metrics.SnapList.Add(metrics.SnapListCoalesced, 1)
+			return false
+		}
+	} else {
+		state = &snapListState{}
+		c.devices[deviceID] = state
+	}
+
+	if !state.pending {
+		metrics.SnapList.Add(metrics.SnapListPending, 1)
+	}
+
+	state.lastRequest = now
+	state.pending = true
+	metrics.SnapList.Add(metrics.SnapListRequested, 1)
+
+	return true
+}
+
+// Cancel clears the pending flag for a request that could not be sent, without counting it as a response
+func (c *snapListCoalescer) Cancel(deviceID string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if state, ok := c.devices[deviceID]; ok {
+		c.clearPending(state)
+		delete(c.devices, deviceID)
+	}
+}
+
+// Responded clears the pending flag once a snap list response arrives from the device
+func (c *snapListCoalescer) Responded(deviceID string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	metrics.SnapList.Add(metrics.SnapListResponded, 1)
+	if state, ok := c.devices[deviceID]; ok {
+		c.clearPending(state)
+	}
+}
+
+// expired reports whether the window of the last request to a device is over, a new request is then sent
+func (c *snapListCoalescer) expired(state *snapListState, now time.Time) bool {
+	elapsed := now.Sub(state.lastRequest)
+	return elapsed >= c.minInterval && (!state.pending || elapsed >= c.pendingTimeout)
+}
+
+// prune evicts the devices whose window has expired, at most once per window
+func (c *snapListCoalescer) prune(now time.Time) {
+	window := c.minInterval
+	if c.pendingTimeout > window {
+		window = c.pendingTimeout
+	}
+	if now.Sub(c.lastPrune) < window {
+		return
+	}
+	c.lastPrune = now
+
+	for deviceID, state := range c.devices {
+		if c.expired(state, now) {
+			c.clearPending(state)
+			delete(c.devices, deviceID)
+		}
+	}
+}
+
+func (c *snapListCoalescer) clearPending(state *snapListState) {
+	if state.pending {
+		state.pending = false
+		metrics.SnapList.Add(metrics.SnapListPending, -1)
+	}
+}
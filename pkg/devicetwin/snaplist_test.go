@@ -0,0 +1,77 @@
+package devicetwin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_snapListCoalescer(t *testing.T) {
+	const deviceID = "some-device-id"
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		respond bool
+		want    bool
+	}{
+		{name: "pending", advance: time.Second, want: false},
+		{name: "pending-past-min-interval", advance: time.Minute, want: false},
+		{name: "pending-timed-out", advance: 10 * time.Minute, want: true},
+		{name: "responded-within-min-interval", advance: time.Second, respond: true, want: false},
+		{name: "responded-past-min-interval", advance: time.Minute, respond: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClock := clock.NewMock()
+			c := newSnapListCoalescer(30*time.Second, 5*time.Minute, mockClock)
+
+			assert.True(t, c.Request(deviceID))
+
+			if tt.respond {
+				c.Responded(deviceID)
+			}
+			mockClock.Add(tt.advance)
+
+			assert.Equal(t, tt.want, c.Request(deviceID))
+			assert.True(t, c.Request("another-device-id"))
+		})
+	}
+}
+
+func Test_snapListCoalescer_Cancel(t *testing.T) {
+	c := newSnapListCoalescer(30*time.Second, 5*time.Minute, clock.NewMock())
+
+	assert.True(t, c.Request("some-device-id"))
+	c.Cancel("some-device-id")
+	assert.True(t, c.Request("some-device-id"))
+}
+
+func Test_snapListCoalescer_prune(t *testing.T) {
+	mockClock := clock.NewMock()
+	c := newSnapListCoalescer(30*time.Second, 5*time.Minute, mockClock)
+
+	assert.True(t, c.Request("responded-device-id"))
+	c.Responded("responded-device-id")
+	assert.True(t, c.Request("pending-device-id"))
+
+	mockClock.Add(time.Minute)
+	assert.True(t, c.Request("some-device-id"))
+	assert.Len(t, c.devices, 3)
+
+	mockClock.Add(4*time.Minute + 30*time.Second)
+	assert.False(t, c.Request("some-device-id"))
+	assert.Len(t, c.devices, 1)
+	assert.Contains(t, c.devices, "some-device-id")
+}
+
+func Test_snapListCoalescer_nil(t *testing.T) {
+	var c *snapListCoalescer
+
+	assert.True(t, c.Request("some-device-id"))
+	assert.True(t, c.Request("some-device-id"))
+	c.Responded("some-device-id")
+	c.Cancel("some-device-id")
+}
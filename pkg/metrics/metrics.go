@@ -0,0 +1,27 @@
+// Package metrics holds the service counters, published with expvar
+package metrics
+
+import (
+	"expvar"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SnapListRequested counts snap list requests sent to devices because of health hash changes
+	SnapListRequested = "requested"
+	// SnapListCoalesced counts snap list requests that were dropped because one was already pending or too recent
+	SnapListCoalesced = "coalesced"
+	// SnapListResponded counts snap list responses received from devices
+	SnapListResponded = "responded"
+	// SnapListPending is the number of devices with a snap list request waiting on a response
+	SnapListPending = "pending"
+)
+
+// SnapList tracks the snap list requests triggered by health hash changes
+var SnapList = expvar.NewMap("snapList")
+
+// Handler serves all the published metrics as JSON
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(expvar.Handler())
+}
@@ -127,3 +127,28 @@ func (h *HandlerService) RequiredModelSnaps(c *gin.Context) {
 	c.JSON(http.StatusOK, &device)
 	return
 }
+
+// DriftedDevices gets the devices whose reported snaps don't match the device twin
+func (h *HandlerService) DriftedDevices(c *gin.Context) {
+	user, err := web.GetUserFromContextAndCheckPermissions(c, datastore.Standard)
+	if user == nil || err != nil {
+		response := api.StandardResponse{Code: "UserAuth", Message: ErrUserInvalidOrNotAuthorized.Error()}
+		c.JSON(http.StatusUnauthorized, &response)
+		return
+	}
+
+	healthHashes, err := h.manage.DriftedDevices(c.Param("orgid"), user.Username, user.Role)
+	if err != nil {
+		if err == manage.NotAuthorizedErr {
+			response := api.StandardResponse{Code: "UserAuth"}
+			c.JSON(http.StatusUnauthorized, &response)
+			return
+		}
+
+		response := api.StandardResponse{Code: "Error", Message: err.Error()}
+		c.JSON(http.StatusInternalServerError, &response)
+		return
+	}
+
+	c.JSON(http.StatusOK, &healthHashes)
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/everactive/dmscore/iot-management/datastore"
 	"github.com/everactive/dmscore/iot-management/service/manage"
 	"github.com/everactive/dmscore/iot-management/web"
-	"github.com/everactive/ginkeycloak"
+	"github.com/everactive/dmscore/pkg/metrics"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -58,8 +58,13 @@ func New(srv manage.Manage, db *gorm.DB) *suture.Supervisor {
 			tokenIntrospectPath := viper.GetString(configkey.OAuth2TokenIntrospectPath)
 			requiredScope := viper.GetString(configkey.OAuth2ClientRequiredScope)
 
-			a := ginkeycloak.New(clientID, secret, host, port, scheme, requiredScope, tokenIntrospectPath, log.StandardLogger())
-			web.VerifyTokenAndUser = auth.VerifyKeycloakTokenWithAuth(a)
+			mappings, err := auth.LoadRoleMappings()
+			if err != nil {
+				log.Errorf("Keycloak role mappings are not properly configured, rejecting all tokens: %v", err)
+			} else {
+				in := auth.NewIntrospector(clientID, secret, host, port, scheme, requiredScope, tokenIntrospectPath)
+				web.VerifyTokenAndUser = auth.VerifyKeycloakToken(in, mappings)
+			}
 		}
 	}
 
@@ -77,6 +82,8 @@ func New(srv manage.Manage, db *gorm.DB) *suture.Supervisor {
 	group.POST("/:orgid/models/:model/required", hs.AddRequiredModelSnap)
 	group.DELETE("/:orgid/models/:model/required", hs.DeleteRequiredModelSnap)
 	group.GET("/:orgid/models/:model/required", hs.RequiredModelSnaps)
+	group.GET("/:orgid/devices/drifted", hs.DriftedDevices)
+	group.GET("/metrics", metrics.Handler())
 
 	return sup
 }